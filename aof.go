@@ -0,0 +1,983 @@
+package goredis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// appendfsync 配置的取值：每条命令写入后 fsync、每秒在后台 fsync 一次，或者交给操作系统
+const (
+	AOF_FSYNC_NO = iota
+	AOF_FSYNC_ALWAYS
+	AOF_FSYNC_EVERYSEC
+)
+
+// aofFsyncNames 是各个 fsync 策略在配置中的名称
+var aofFsyncNames = []string{"no", "always", "everysec"}
+
+// AOF_REWRITE_ITEMS_PER_CMD 是重写 AOF 时一条 RPUSH、SADD 或 ZADD 命令最多包含的元素个数
+const AOF_REWRITE_ITEMS_PER_CMD = 64
+
+// appendRESPCommand 把命令以 RESP 数组的形式追加到 buf，与客户端发送命令的格式相同
+func appendRESPCommand(buf []byte, argv []string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(argv)), 10)
+	buf = append(buf, "\r\n"...)
+	for _, arg := range argv {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// feedAppendOnlyFile 把传播的命令追加到 AOF 文件，数据库变化时先写入 SELECT
+//
+// 调用方持有 propagateMu 或命令写锁，命令按修改数据集的顺序写入。命令在回复客户端之前
+// 就写入文件（write 系统调用），之后即使服务器崩溃也不会丢失；操作系统崩溃时可能丢失多少
+// 取决于 appendfsync 策略。后台重写 AOF 期间，命令同时追加到重写缓冲区，重写结束时接在新文件后面。
+func (rs *RedisServer) feedAppendOnlyFile(cmds []propagatedCommand) {
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	if rs.aofFile != nil || rs.aofWaitRewrite {
+		rs.aofSeq++
+	}
+	if rs.aofRewriting {
+		rs.aofRewriteBuf = catAppendOnlyCommands(rs.aofRewriteBuf, cmds, &rs.aofRewriteSelectedDB)
+	}
+	if rs.aofFile == nil {
+		return
+	}
+	rs.aofBuf = catAppendOnlyCommands(rs.aofBuf, cmds, &rs.aofSelectedDB)
+	rs.flushAppendOnlyFile()
+}
+
+// catAppendOnlyCommands 把命令追加到 buf，*selected 是 buf 中最后一条 SELECT 选择的数据库
+func catAppendOnlyCommands(buf []byte, cmds []propagatedCommand, selected *int) []byte {
+	for _, pc := range cmds {
+		if pc.dbid >= 0 && pc.dbid != *selected {
+			buf = appendRESPCommand(buf, []string{"SELECT", strconv.Itoa(pc.dbid)})
+			*selected = pc.dbid
+		}
+		buf = appendRESPCommand(buf, pc.argv)
+	}
+	return buf
+}
+
+// flushAppendOnlyFile 把缓冲区写入 AOF 文件（调用方需持有 aofMu）
+//
+// 写入失败时去掉写入了一部分的命令，缓冲区留待 serverCron 重试，期间拒绝写命令；
+// appendfsync 为 always 时无法保证已回复的写命令被持久化，直接退出。
+func (rs *RedisServer) flushAppendOnlyFile() {
+	if len(rs.aofBuf) == 0 {
+		return
+	}
+	policy := rs.aofFsync.Load()
+	n, err := rs.aofFile.Write(rs.aofBuf)
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		if policy == AOF_FSYNC_ALWAYS {
+			log.Printf("Can't recover from AOF write error when the AOF fsync policy is 'always': %v. Exiting...", err)
+			os.Exit(1)
+		}
+		if rs.aofLastWriteErr == nil {
+			log.Printf("Error writing to the AOF file: %v", err)
+		}
+		if n > 0 {
+			if terr := rs.aofFile.Truncate(rs.aofCurrentSize); terr != nil {
+				// 无法去掉写入了一部分的命令，只能把已写入的部分从缓冲区中去掉，
+				// 文件末尾留下一条不完整的命令
+				log.Printf("Could not remove short write from the append-only file. Redis may refuse to load the AOF the next time it starts. ftruncate: %v", terr)
+				rs.aofCurrentSize += int64(n)
+				rs.aofBuf = rs.aofBuf[n:]
+			}
+		}
+		rs.aofLastWriteErr = err
+		return
+	}
+
+	rs.aofCurrentSize += int64(n)
+	rs.aofBuf = rs.aofBuf[:0]
+	rs.aofWrittenSeq = rs.aofSeq
+	if rs.aofLastWriteErr != nil {
+		log.Println("AOF write error looks solved, Redis can write again.")
+		rs.aofLastWriteErr = nil
+	}
+	switch policy {
+	case AOF_FSYNC_ALWAYS:
+		if err := rs.aofFile.Sync(); err != nil {
+			log.Printf("Can't persist AOF for fsync error when the AOF fsync policy is 'always': %v. Exiting...", err)
+			os.Exit(1)
+		}
+		rs.aofFsynced(rs.aofWrittenSeq)
+	case AOF_FSYNC_EVERYSEC:
+		rs.aofFsyncPending = true
+	case AOF_FSYNC_NO:
+		// 不 fsync 时由操作系统决定何时写入磁盘，WAITAOF 把写入文件视为已经 fsync
+		rs.aofFsynced(rs.aofWrittenSeq)
+	}
+}
+
+// aofCron 由 serverCron 每秒调用一次：重试失败的写入，appendfsync 为 everysec 时在后台 fsync
+func (rs *RedisServer) aofCron() {
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	if rs.aofFile == nil {
+		return
+	}
+	if rs.aofLastWriteErr != nil {
+		rs.flushAppendOnlyFile()
+	}
+	if rs.aofFsync.Load() == AOF_FSYNC_EVERYSEC && rs.aofFsyncPending && !rs.aofFsyncInProgress {
+		rs.aofFsyncPending = false
+		rs.aofFsyncInProgress = true
+		go rs.aofBackgroundFsync(rs.aofFile, rs.aofWrittenSeq)
+	}
+}
+
+// aofBackgroundFsync 在后台 fsync AOF 文件，不阻塞写入；失败时拒绝写命令并在下一秒重试
+//
+// seq 是开始 fsync 时已经写入文件的命令序号，成功后它之前的命令都已经 fsync。
+func (rs *RedisServer) aofBackgroundFsync(f AppendLog, seq int64) {
+	err := f.Sync()
+	defer rs.replicationSendFack()
+	defer rs.handleClientsWaitingAcks()
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	if rs.aofFile != f {
+		// AOF 已经关闭或者换成了新的文件
+		return
+	}
+	rs.aofFsyncInProgress = false
+	if err != nil {
+		if rs.aofLastFsyncErr == nil {
+			log.Printf("Can't persist AOF for fsync error when the AOF fsync policy is 'everysec': %v", err)
+		}
+		rs.aofLastFsyncErr = err
+		rs.aofFsyncPending = true
+		return
+	}
+	if rs.aofLastFsyncErr != nil {
+		log.Println("AOF fsync error looks solved, Redis can write again.")
+		rs.aofLastFsyncErr = nil
+	}
+	rs.aofFsynced(seq)
+}
+
+// aofFsynced 记录序号 seq 之前的命令都已经 fsync，等待的 WAITAOF 可能可以返回（调用方需持有 aofMu）
+func (rs *RedisServer) aofFsynced(seq int64) {
+	if seq <= rs.aofFsyncedSeq {
+		return
+	}
+	rs.aofFsyncedSeq = seq
+	rs.signalAcksReady()
+	i := 0
+	for ; i < len(rs.aofReplOffs) && rs.aofReplOffs[i].seq <= seq; i++ {
+		rs.aofFsyncedReplOff = rs.aofReplOffs[i].offset
+	}
+	if i > 0 {
+		rs.aofReplOffs = rs.aofReplOffs[i:]
+		rs.aofFackChanged.Store(true)
+	}
+}
+
+// aofReplOffset 是副本执行到复制偏移量 offset 时 AOF 的命令序号 seq
+type aofReplOffset struct {
+	seq    int64
+	offset int64
+}
+
+// aofTrackReplOffset 在副本把主节点的命令流计入复制偏移量 offset 之后调用，这之前的命令
+// 在 AOF 中 fsync 之后，offset 以 FACK 报告给主节点（调用方需持有 propagateMu 或命令写锁）
+//
+// 命令先写入 AOF 再计入偏移量，此时的 aofSeq 就是执行到 offset 的命令序号。没有开启 AOF 时不报告 FACK。
+func (rs *RedisServer) aofTrackReplOffset(offset int64) {
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	switch {
+	case rs.aofFile == nil && !rs.aofWaitRewrite:
+		rs.aofReplOffs = nil
+	case rs.aofFsyncedSeq >= rs.aofSeq:
+		if offset > rs.aofFsyncedReplOff {
+			rs.aofFsyncedReplOff = offset
+			rs.aofFackChanged.Store(true)
+		}
+	case len(rs.aofReplOffs) > 0 && rs.aofReplOffs[len(rs.aofReplOffs)-1].seq == rs.aofSeq:
+		rs.aofReplOffs[len(rs.aofReplOffs)-1].offset = offset
+	default:
+		rs.aofReplOffs = append(rs.aofReplOffs, aofReplOffset{seq: rs.aofSeq, offset: offset})
+	}
+}
+
+// writeDeniedByDiskError 在 AOF 写入或 fsync 出错时返回拒绝写命令的 MISCONF 错误，否则返回 nil
+func (rs *RedisServer) writeDeniedByDiskError() *RESPValue {
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	err := rs.aofLastWriteErr
+	if err == nil {
+		err = rs.aofLastFsyncErr
+	}
+	if err == nil {
+		return nil
+	}
+	return NewErrorValue("MISCONF Errors writing to the AOF file: " + err.Error())
+}
+
+// errAofTruncated 表示 AOF 文件在一条命令的中间结束，通常是写入时服务器崩溃或磁盘已满
+var errAofTruncated = errors.New("unexpected end of file")
+
+// newAofClient 创建加载 AOF 时执行命令的伪客户端，它没有连接，命令不会阻塞
+func newAofClient(rs *RedisServer) *client {
+	return &client{
+		server:              rs,
+		db:                  rs.databases[0],
+		resp:                RESP2,
+		denyBlocking:        true,
+		pubsubChannels:      make(map[string]struct{}),
+		pubsubPatterns:      make(map[string]struct{}),
+		pubsubShardChannels: make(map[string]struct{}),
+	}
+}
+
+// loadAppendOnlyFile 重放 AOF 文件的内容 data 中的命令重建数据集，调用方需保证服务器中还没有数据
+//
+// 文件在一条命令的中间结束，或者结束时还有没有 EXEC 的事务时，aof-load-truncated 为 yes
+// 则把文件截断到最后一条完整的命令（事务则截断到 MULTI 之前）后继续启动，否则拒绝启动；
+// 格式错误和未知命令总是拒绝启动。出错的位置以文件中的偏移量报告。
+func (rs *RedisServer) loadAppendOnlyFile(path string, data []byte) error {
+	start := time.Now()
+	valid, truncated, err := rs.aofLoad(path, data)
+	if err != nil {
+		return err
+	}
+
+	if truncated != nil {
+		rs.mutex.RLock()
+		loadTruncated := rs.aofLoadTruncated
+		rs.mutex.RUnlock()
+		if !loadTruncated {
+			return fmt.Errorf("%v. You can: 1) Make a backup of your AOF file, then use goRedis --check-aof --fix %s. 2) Alternatively you can set the 'aof-load-truncated' configuration option to yes and restart the server.", truncated, path)
+		}
+		log.Printf("!!! Warning: short read while loading the AOF file %s!!! %v", path, truncated)
+		log.Printf("!!! Truncating the AOF at offset %d !!!", valid)
+		if err := rs.persister.TruncateLog(path, int64(valid)); err != nil {
+			return fmt.Errorf("Error truncating the AOF file %s: %v", path, err)
+		}
+		log.Println("AOF loaded anyway because aof-load-truncated is enabled")
+	}
+	log.Printf("DB loaded from append only file: %.3f seconds", time.Since(start).Seconds())
+	return nil
+}
+
+// aofLoad 从 AOF 文件的内容 data 重建数据集，返回最后一条完整的命令之后的偏移量
+//
+// 文件以 RDB 前导部分开头时先加载它，再重放之后的命令。文件不完整时 truncated 说明原因，
+// 数据集中是偏移量 valid 之前的命令执行后的结果；格式错误和未知命令返回 err。
+func (rs *RedisServer) aofLoad(path string, data []byte) (valid int, truncated error, err error) {
+	c := newAofClient(rs)
+	pos := 0
+	// 重放时过期的键仍然视为存在，命令的结果与原来执行时相同，之后由传播的 DEL 删除
+	rs.mutex.Lock()
+	rs.setKeepExpired(true)
+	rs.mutex.Unlock()
+	defer func() {
+		rs.mutex.Lock()
+		rs.setKeepExpired(false)
+		rs.mutex.Unlock()
+	}()
+	if bytes.HasPrefix(data, []byte("REDIS")) {
+		log.Println("Reading RDB preamble from AOF file...")
+		// 与 Redis 一样保留前导部分中已经过期的键：之后的命令可能还会用到它们（例如 PERSIST），
+		// 仍然过期的键之后照常删除
+		n, err := rs.rdbLoadKeepExpired(data, nil, true)
+		if err != nil {
+			return 0, nil, fmt.Errorf("Error reading the RDB preamble of the AOF file %s, AOF loading aborted: %v", path, err)
+		}
+		log.Println("Reading the remaining AOF tail...")
+		pos, valid = n, n
+	}
+	for pos < len(data) {
+		argv, n, err := aofReadCommand(data[pos:])
+		if err == errAofTruncated {
+			truncated = fmt.Errorf("Unexpected end of file reading the append only file %s at offset %d", path, pos)
+			break
+		}
+		if err != nil {
+			return valid, nil, fmt.Errorf("Bad file format reading the append only file %s at offset %d (%v): make a backup of your AOF file, then fix or truncate it", path, pos, err)
+		}
+		if lookupCommand(argv[0]) == nil {
+			return valid, nil, fmt.Errorf("Unknown command '%s' reading the append only file %s at offset %d", argv[0], path, pos)
+		}
+		command := NewArrayValue(make([]*RESPValue, len(argv)))
+		for i, arg := range argv {
+			command.Array[i] = NewBulkStringValue(arg)
+		}
+		rs.processCommand(c, command)
+		pos += n
+		// 事务中的命令在 EXEC 时才执行，截断时要去掉整个没有结束的事务
+		if !c.multi {
+			valid = pos
+		}
+	}
+	if truncated == nil && c.multi {
+		log.Println("Revert incomplete MULTI/EXEC transaction in AOF file")
+		truncated = fmt.Errorf("Unexpected end of file reading the append only file %s: MULTI at offset %d without EXEC", path, valid)
+	}
+	return valid, truncated, nil
+}
+
+// aofReadCommand 从 data 的开头读取一条 RESP 数组形式的命令，返回参数和命令占用的字节数
+//
+// data 在命令的中间结束时返回 errAofTruncated，已读到的部分不符合格式时返回其他错误。
+func aofReadCommand(data []byte) ([]string, int, error) {
+	pos := 0
+	readLength := func(prefix byte) (int, error) {
+		if pos == len(data) {
+			return 0, errAofTruncated
+		}
+		if data[pos] != prefix {
+			return 0, fmt.Errorf("expected '%c', got '%c'", prefix, data[pos])
+		}
+		end := bytes.IndexByte(data[pos:], '\n')
+		if end < 0 {
+			return 0, errAofTruncated
+		}
+		line := data[pos+1 : pos+end]
+		pos += end + 1
+		if len(line) == 0 || line[len(line)-1] != '\r' {
+			return 0, errors.New("line not terminated by CRLF")
+		}
+		n, err := strconv.Atoi(string(line[:len(line)-1]))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid length '%s'", line[:len(line)-1])
+		}
+		return n, nil
+	}
+
+	argc, err := readLength('*')
+	if err != nil {
+		return nil, 0, err
+	}
+	if argc < 1 {
+		return nil, 0, errors.New("empty command")
+	}
+	argv := make([]string, argc)
+	for i := range argv {
+		n, err := readLength('$')
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(data)-pos < n+2 {
+			return nil, 0, errAofTruncated
+		}
+		if data[pos+n] != '\r' || data[pos+n+1] != '\n' {
+			return nil, 0, errors.New("argument not terminated by CRLF")
+		}
+		argv[i] = string(data[pos : pos+n])
+		pos += n + 2
+	}
+	return argv, pos, nil
+}
+
+// aofOpenOnServerStart 在启动加载完成后按 appendonly 配置打开 AOF 文件
+//
+// 文件已经存在时在末尾继续追加，否则用当前的数据集（从 RDB 文件加载）创建。
+func (rs *RedisServer) aofOpenOnServerStart() error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.loaded = true
+	if !rs.aofEnabled {
+		return nil
+	}
+
+	path := filepath.Join(rs.dir, rs.aofFilename)
+	f, size, err := rs.persister.OpenLog(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		data := rs.aofRewriteBase()
+		f, err = rs.aofCreateLog(path, data)
+		if err != nil {
+			return fmt.Errorf("Can't create the append-only file %s: %v", rs.aofFilename, err)
+		}
+		size = int64(len(data))
+		log.Println("Append only file created from the current dataset")
+	}
+	if err != nil {
+		return fmt.Errorf("Can't open the append-only file %s: %v", rs.aofFilename, err)
+	}
+	rs.aofMu.Lock()
+	rs.aofSwitchFile(f, size)
+	rs.aofMu.Unlock()
+	return nil
+}
+
+// aofCreateLog 通过存储后端创建内容为 data 的 AOF 文件，返回向它追加的日志
+func (rs *RedisServer) aofCreateLog(path string, data []byte) (AppendLog, error) {
+	lw, err := rs.persister.CreateLog(path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = lw.Write(data)
+	if err == nil {
+		err = lw.Sync()
+	}
+	if err != nil {
+		lw.Abort()
+		return nil, err
+	}
+	return lw.Commit(true)
+}
+
+// aofSwitchFile 开始向 f 追加命令，size 是文件现有的长度，也作为自动重写的基准长度（调用方需持有 aofMu）
+//
+// 之前打开的文件在后台关闭：它可能已经被新文件替换，关闭时要释放整个文件的磁盘空间。
+func (rs *RedisServer) aofSwitchFile(f AppendLog, size int64) {
+	if old := rs.aofFile; old != nil {
+		go old.Close()
+	}
+	rs.aofFile = f
+	rs.aofBuf = nil
+	rs.aofSelectedDB = -1
+	rs.aofCurrentSize = size
+	rs.aofRewriteBaseSize = size
+	rs.aofLastWriteErr = nil
+	rs.aofLastFsyncErr = nil
+	rs.aofFsyncPending = false
+	rs.aofFsyncInProgress = false
+	rs.aofWaitRewrite = false
+	// 新文件已经 fsync，包含了到目前为止的所有命令
+	rs.aofWrittenSeq = rs.aofSeq
+	rs.aofFsynced(rs.aofSeq)
+}
+
+// startAppendOnly 打开 AOF：在后台把当前数据集重写为新的 AOF 文件，重写完成后开始向它追加写命令
+//
+// 调用方需持有服务器写锁和 propagateMu。已经有重写在进行时直接等它完成：它的重写缓冲区
+// 包含了开始以来所有的写命令。后台保存在进行或者事务中已有尚未传播的写命令时，
+// 重写由 serverCron 稍后开始。
+func (rs *RedisServer) startAppendOnly() error {
+	rs.aofMu.Lock()
+	rewriting := rs.aofRewriting
+	rs.aofWaitRewrite = true
+	// 重写完成之前数据集还不在 AOF 中，WAITAOF 和 FACK 要等到新文件 fsync
+	rs.aofSeq++
+	rs.aofMu.Unlock()
+	if rewriting {
+		return nil
+	}
+	if rs.rdbSaving.Load() || len(rs.pendingPropagate) > 0 {
+		rs.aofRewriteScheduled.Store(true)
+		log.Println("AOF was enabled but there is already another background operation. An AOF background was scheduled to start when possible.")
+		return nil
+	}
+	if err := rs.rewriteAppendOnlyFileBackground(); err != nil {
+		rs.aofMu.Lock()
+		rs.aofWaitRewrite = false
+		rs.aofMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// stopAppendOnly 关闭 AOF：写入缓冲区中剩余的命令并 fsync 后关闭文件（调用方需持有服务器写锁）
+//
+// 正在进行的后台重写继续完成并替换 AOF 文件，但不再打开它。
+func (rs *RedisServer) stopAppendOnly() {
+	rs.aofRewriteScheduled.Store(false)
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	rs.aofWaitRewrite = false
+	if rs.aofFile == nil {
+		return
+	}
+	rs.flushAppendOnlyFile()
+	if err := rs.aofFile.Sync(); err != nil {
+		log.Printf("Error fsyncing the append only file: %v", err)
+	} else {
+		rs.aofFsynced(rs.aofWrittenSeq)
+	}
+	rs.aofFile.Close()
+	rs.aofFile = nil
+	rs.aofBuf = nil
+	rs.aofLastWriteErr = nil
+	rs.aofLastFsyncErr = nil
+	rs.aofFsyncPending = false
+	rs.aofFsyncInProgress = false
+}
+
+// aofKillRewriteOnShutdown 在退出前停止后台重写并删除它的临时文件
+//
+// 开启 AOF 后第一次重写还没有完成时 AOF 文件还不存在，除非 force，否则返回 false 拒绝退出。
+func (rs *RedisServer) aofKillRewriteOnShutdown(force bool) bool {
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	if !rs.aofRewriting {
+		return true
+	}
+	if rs.aofWaitRewrite {
+		if !force {
+			log.Println("Writing initial AOF, can't exit.")
+			return false
+		}
+		log.Println("Writing initial AOF. Exit anyway.")
+	}
+	log.Println("There is a child rewriting the AOF. Killing it!")
+	if rs.aofRewriteLog != nil {
+		rs.aofRewriteLog.Abort()
+	}
+	return true
+}
+
+// aofKillRewrite 停止进行中的后台重写并等待它结束，用于数据集被整体替换时（调用方需持有命令写锁）
+//
+// 重写还没有创建新日志时等它创建之后再丢弃，重写随之失败；持有命令写锁期间不会开始新的重写。
+func (rs *RedisServer) aofKillRewrite() {
+	for {
+		rs.aofMu.Lock()
+		rewriting := rs.aofRewriting
+		if rewriting && rs.aofRewriteLog != nil {
+			log.Println("Killing the background AOF rewrite.")
+			rs.aofRewriteLog.Abort()
+			rs.aofRewriteLog = nil
+		}
+		rs.aofMu.Unlock()
+		if !rewriting {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// aofFlushOnShutdown 在退出前写入缓冲区中剩余的命令并 fsync
+func (rs *RedisServer) aofFlushOnShutdown() {
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	if rs.aofFile == nil {
+		return
+	}
+	log.Println("Calling fsync() on the AOF file.")
+	rs.flushAppendOnlyFile()
+	rs.aofFile.Sync()
+}
+
+// setAppendOnly 设置 appendonly 配置，启动完成后立即打开或关闭 AOF（调用方需持有服务器写锁和 propagateMu）
+func setAppendOnly(rs *RedisServer, value string) error {
+	var enabled bool
+	if err := parseYesNo(value, &enabled); err != nil {
+		return err
+	}
+	if enabled == rs.aofEnabled {
+		return nil
+	}
+	if rs.loaded {
+		if enabled {
+			if err := rs.startAppendOnly(); err != nil {
+				return errors.New("Unable to turn on AOF. Check server logs.")
+			}
+		} else {
+			rs.stopAppendOnly()
+		}
+	}
+	rs.aofEnabled = enabled
+	return nil
+}
+
+// parseAofFsync 解析 appendfsync 配置（不区分大小写）
+func parseAofFsync(value string) (int32, error) {
+	for policy, name := range aofFsyncNames {
+		if strings.EqualFold(value, name) {
+			return int32(policy), nil
+		}
+	}
+	return 0, errors.New("argument(s) must be one of the following: always, everysec, no")
+}
+
+// errAofRewriteInProgress 表示已有 AOF 重写在进行
+var errAofRewriteInProgress = errors.New("Background append only file rewriting already in progress")
+
+// rewriteAppendOnlyFileBackground 把数据集重写为 AOF 的内容，然后在后台 goroutine 中写入新的 AOF 文件
+//
+// 调用方需持有 propagateMu（或命令写锁）和服务器锁（读锁即可）：重写得到的是一致的快照，
+// 此后传播的写命令都追加到重写缓冲区，写完快照后接在新文件后面，新文件因此与当前的 AOF 等价。
+func (rs *RedisServer) rewriteAppendOnlyFileBackground() error {
+	rs.aofMu.Lock()
+	rewriting := rs.aofRewriting
+	rs.aofMu.Unlock()
+	if rewriting {
+		return errAofRewriteInProgress
+	}
+
+	data := rs.aofRewriteBase()
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	rs.aofRewriteTry = time.Now().Unix()
+	rs.aofRewriteScheduled.Store(false)
+	rs.aofRewrites++
+	rs.aofRewriting = true
+	rs.aofRewriteBuf = nil
+	rs.aofRewriteSelectedDB = -1
+	log.Println("Background append only file rewriting started")
+	go rs.aofRewriteBackground(rs.dir, rs.aofFilename, data)
+	return nil
+}
+
+// aofRewriteBackground 把重写的数据集和重写缓冲区写入存储后端创建的新日志，然后替换 AOF 文件
+//
+// 重写期间积累的命令先在不持有 aofMu 时写入并 fsync，最后持有 aofMu 写入剩余的少量命令、
+// 提交新日志替换 AOF 文件，开启了 AOF 时改为向新文件追加，这期间写命令只需短暂等待。
+func (rs *RedisServer) aofRewriteBackground(dir, filename string, data []byte) {
+	lw, err := rs.persister.CreateLog(filepath.Join(dir, filename))
+	if err != nil {
+		rs.aofMu.Lock()
+		rs.aofRewriteDone(false)
+		rs.aofMu.Unlock()
+		return
+	}
+	rs.aofMu.Lock()
+	rs.aofRewriteLog = lw
+	rs.aofMu.Unlock()
+
+	size := int64(len(data))
+	_, err = lw.Write(data)
+	if err == nil {
+		rs.aofMu.Lock()
+		diff := rs.aofRewriteBuf
+		rs.aofRewriteBuf = nil
+		rs.aofMu.Unlock()
+		size += int64(len(diff))
+		if _, err = lw.Write(diff); err == nil {
+			err = lw.Sync()
+		}
+	}
+
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	diff := rs.aofRewriteBuf
+	if err == nil {
+		if _, err = lw.Write(diff); err == nil {
+			err = lw.Sync()
+		}
+	}
+	var newLog AppendLog
+	if err == nil {
+		newLog, err = lw.Commit(rs.aofFile != nil || rs.aofWaitRewrite)
+	} else {
+		log.Printf("Error writing the rewritten AOF file: %v", err)
+		lw.Abort()
+	}
+	if err != nil {
+		rs.aofRewriteDone(false)
+		return
+	}
+	log.Printf("Residual parent diff successfully flushed to the rewritten AOF (%.2f MB)", float64(len(diff))/(1024*1024))
+	size += int64(len(diff))
+	if newLog != nil {
+		// 旧文件中还没有写入的命令也在重写缓冲区中，已经写入了新文件
+		rs.aofSwitchFile(newLog, size)
+	}
+	rs.aofRewriteDone(true)
+}
+
+// aofRewriteDone 结束后台重写，记录结果（调用方需持有 aofMu）
+//
+// 开启 AOF 时的重写失败后，由 serverCron 稍后重试。
+func (rs *RedisServer) aofRewriteDone(ok bool) {
+	rs.aofRewriting = false
+	rs.aofRewriteBuf = nil
+	rs.aofRewriteLog = nil
+	rs.aofLastBgrewriteOK = ok
+	rs.aofLastRewriteTime = time.Now().Unix() - rs.aofRewriteTry
+	if !ok {
+		log.Println("Background AOF rewrite terminated with error")
+		if rs.aofWaitRewrite {
+			rs.aofRewriteScheduled.Store(true)
+		}
+		return
+	}
+	log.Println("Background AOF rewrite finished successfully")
+}
+
+// aofRewriteInProgress 返回是否有 AOF 重写在进行
+func (rs *RedisServer) aofRewriteInProgress() bool {
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	return rs.aofRewriting
+}
+
+// handleWaitaof 处理 WAITAOF numlocal numreplicas timeout 命令
+//
+// 阻塞到这个客户端之前的写命令在本地的 AOF 文件中 fsync（numlocal 为 1 时），并且至少
+// numreplicas 个副本在它们的 AOF 中 fsync，返回本地是否已经 fsync 和已经 fsync 的副本数。
+// 等待的是命令开始时已经传播的所有写命令，其中包括这个客户端的写命令：本地等待当时的 AOF 命令序号，
+// 副本等待当时的复制偏移量，由副本以 REPLCONF ACK 的 FACK 报告。timeout 是毫秒数，0 表示永久等待，
+// 超时时返回当时的状态；事务中不阻塞，直接返回当前的状态；在副本上执行时报错。
+// 与 WAIT 一样需要等待副本时在命令流中发送 REPLCONF GETACK *，以 blockForAcks 等待。
+func (rs *RedisServer) handleWaitaof(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	numlocal, err1 := strconv.ParseInt(args[0], 10, 64)
+	numreplicas, err2 := strconv.ParseInt(args[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		return NewErrorValue("ERR value is not an integer or out of range")
+	}
+	ms, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return NewErrorValue("ERR timeout is not an integer or out of range")
+	}
+	if ms < 0 {
+		return NewErrorValue("ERR timeout is negative")
+	}
+	rs.replMu.Lock()
+	replica := rs.masterHost != ""
+	rs.replMu.Unlock()
+	if replica {
+		return NewErrorValue("ERR WAITAOF cannot be used with replica instances. Please also note that writes to replicas are just local and are not propagated.")
+	}
+	rs.mutex.RLock()
+	enabled := rs.aofEnabled
+	rs.mutex.RUnlock()
+	if numlocal > 0 && !enabled {
+		return NewErrorValue("ERR WAITAOF cannot be used when numlocal is set but appendonly is disabled.")
+	}
+
+	// 正在执行的写命令（包括刚刚服务了这个客户端的阻塞命令的写入方）传播完成之后再取序号和偏移量
+	rs.propagateMu.Lock()
+	rs.aofMu.Lock()
+	localTarget := rs.aofSeq
+	rs.aofMu.Unlock()
+	rs.replMu.Lock()
+	replTarget := rs.masterReplOffset
+	acked := rs.replicationCountAofAcks(replTarget)
+	rs.replMu.Unlock()
+	if acked < numreplicas && !c.denyBlocking {
+		rs.replicationFeedSlaves([]propagatedCommand{{dbid: -1, argv: []string{"REPLCONF", "GETACK", "*"}}})
+	}
+	rs.propagateMu.Unlock()
+
+	current := func() (acklocal, ackreplicas int64) {
+		rs.aofMu.Lock()
+		acklocal = int64(infoFlag(enabled && rs.aofFsyncedSeq >= localTarget))
+		rs.aofMu.Unlock()
+		rs.replMu.Lock()
+		defer rs.replMu.Unlock()
+		return acklocal, rs.replicationCountAofAcks(replTarget)
+	}
+	reply := func(acklocal, ackreplicas int64) *RESPValue {
+		return NewArrayValue([]*RESPValue{NewIntegerValue(acklocal), NewIntegerValue(ackreplicas)})
+	}
+	return rs.blockForAcks(c, time.Duration(ms)*time.Millisecond, func() *RESPValue {
+		if acklocal, ackreplicas := current(); acklocal >= numlocal && ackreplicas >= numreplicas {
+			return reply(acklocal, ackreplicas)
+		}
+		return nil
+	}, func() *RESPValue {
+		return reply(current())
+	})
+}
+
+// handleBgrewriteaof 处理 BGREWRITEAOF 命令，在后台把 AOF 文件重写为重建当前数据集的最少命令
+//
+// 后台保存在进行，或者事务中已有尚未传播的写命令时，重写由 serverCron 在它们结束后开始。
+func (rs *RedisServer) handleBgrewriteaof(c *client, command *RESPValue) *RESPValue {
+	rs.propagateMu.Lock()
+	defer rs.propagateMu.Unlock()
+	if rs.aofRewriteInProgress() {
+		return NewErrorValue("ERR " + errAofRewriteInProgress.Error())
+	}
+	if rs.rdbSaving.Load() || len(rs.pendingPropagate) > 0 {
+		rs.aofRewriteScheduled.Store(true)
+		return NewSimpleStringValue("Background append only file rewriting scheduled")
+	}
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	if err := rs.rewriteAppendOnlyFileBackground(); err != nil {
+		return NewErrorValue("ERR Can't execute an AOF background rewriting. Please check the server logs for more information.")
+	}
+	return NewSimpleStringValue("Background append only file rewriting started")
+}
+
+// aofRewriteCron 在没有后台保存和 AOF 重写进行时检查是否需要开始 AOF 重写：BGREWRITEAOF
+// 和开启 AOF 时推迟的重写，或者 AOF 文件比上次重写后增长了 auto-aof-rewrite-percentage
+//
+// 上次重写失败时，要等 CONFIG_BGSAVE_RETRY_DELAY 秒之后才会再次尝试。
+func (rs *RedisServer) aofRewriteCron() {
+	if rs.rdbSaving.Load() {
+		return
+	}
+	rs.aofMu.Lock()
+	canRetry := rs.aofLastBgrewriteOK || time.Now().Unix()-rs.aofRewriteTry > CONFIG_BGSAVE_RETRY_DELAY
+	var growth int64
+	start := false
+	if !rs.aofRewriting && canRetry {
+		if rs.aofRewriteScheduled.Load() {
+			start = true
+		} else if perc := rs.aofRewritePerc.Load(); perc > 0 && rs.aofFile != nil &&
+			rs.aofCurrentSize > rs.aofRewriteMinSize.Load() {
+			growth = rs.aofCurrentSize*100/max(rs.aofRewriteBaseSize, 1) - 100
+			start = growth >= perc
+		}
+	}
+	rs.aofMu.Unlock()
+	if !start {
+		return
+	}
+
+	// 与命令一样取得命令锁，脚本超时时跳过这一次
+	if run := rs.lockExec(false); run != nil {
+		return
+	}
+	defer rs.unlockExec(false)
+	rs.propagateMu.Lock()
+	defer rs.propagateMu.Unlock()
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	if growth > 0 {
+		log.Printf("Starting automatic rewriting of AOF on %d%% growth", growth)
+	}
+	rs.rewriteAppendOnlyFileBackground()
+}
+
+// aofRewriteBase 返回重写的 AOF 文件中表示当前数据集的部分（调用方需持有命令锁和服务器读锁）
+//
+// aof-use-rdb-preamble 为 yes 时是 RDB 格式的快照，加载时不必逐条执行命令，比命令快得多；
+// 之后追加的写命令仍然是命令格式。
+func (rs *RedisServer) aofRewriteBase() []byte {
+	if rs.aofUseRdbPreamble {
+		return rs.rdbEncode(true)
+	}
+	return rs.aofRewriteData()
+}
+
+// aofRewriteData 把整个数据集重写为能重建它的最少命令
+//
+// 依次是各个函数库的 FUNCTION LOAD，以及每个非空数据库的 SELECT 和其中每个键的命令，
+// 有过期时间的键之后是 PEXPIREAT。
+// 调用方需持有服务器读锁。
+func (rs *RedisServer) aofRewriteData() []byte {
+	var buf []byte
+	names := make([]string, 0, len(rs.libraries))
+	for name := range rs.libraries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf = appendRESPCommand(buf, []string{"FUNCTION", "LOAD", rs.libraries[name].code})
+	}
+
+	for _, db := range rs.databases {
+		if db.store.Len() == 0 {
+			continue
+		}
+		buf = appendRESPCommand(buf, []string{"SELECT", strconv.Itoa(db.id)})
+		db.store.ForEach(func(key string, obj *RedisObject) {
+			buf = aofRewriteObject(buf, key, obj, rs.rdbCompression)
+			if when := db.store.GetExpire(key); when >= 0 {
+				buf = appendRESPCommand(buf, []string{"PEXPIREAT", key, strconv.FormatInt(when, 10)})
+			}
+		})
+	}
+	return buf
+}
+
+// aofRewriteObject 追加重建一个键的命令
+//
+// 没有对应写命令能够原样重建的类型（Count-Min Sketch 和 Top-K）用 RESTORE 和 DUMP 的载荷重建，
+// compress 对应 rdbcompression 配置。
+func aofRewriteObject(buf []byte, key string, obj *RedisObject, compress bool) []byte {
+	switch obj.Type {
+	case OBJ_STRING:
+		return appendRESPCommand(buf, []string{"SET", key, string(obj.Value.([]byte))})
+	case OBJ_LIST:
+		var items []string
+		obj.Value.(*List).Iterate(false, func(_ int, value string) bool {
+			items = append(items, value)
+			return true
+		})
+		return aofRewriteItems(buf, "RPUSH", key, items, 1)
+	case OBJ_SET:
+		return aofRewriteItems(buf, "SADD", key, obj.Value.(*Set).Members(), 1)
+	case OBJ_ZSET:
+		zset := obj.Value.(*ZSet)
+		items := make([]string, 0, 2*zset.Len())
+		for _, entry := range zset.RangeByRank(0, zset.Len()-1, false) {
+			items = append(items, formatFloat(entry.score), entry.member)
+		}
+		return aofRewriteItems(buf, "ZADD", key, items, 2)
+	case OBJ_HASH:
+		hash := obj.Value.(*Hash)
+		items := make([]string, 0, 2*hash.Len())
+		hash.Iterate(func(field, value string) bool {
+			items = append(items, field, value)
+			return true
+		})
+		return aofRewriteItems(buf, "HSET", key, items, 2)
+	case OBJ_STREAM:
+		return aofRewriteStream(buf, key, obj.Value.(*Stream))
+	case OBJ_CMS, OBJ_TOPK:
+		return appendRESPCommand(buf, []string{"RESTORE", key, "0", string(rdbDumpObject(obj, compress))})
+	default:
+		panic(fmt.Sprintf("unknown object type %d", obj.Type))
+	}
+}
+
+// aofRewriteItems 把元素分批追加为若干条 name key item... 命令，每个元素占 width 个参数
+func aofRewriteItems(buf []byte, name, key string, items []string, width int) []byte {
+	for len(items) > 0 {
+		n := min(len(items), AOF_REWRITE_ITEMS_PER_CMD*width)
+		argv := append([]string{name, key}, items[:n]...)
+		buf = appendRESPCommand(buf, argv)
+		items = items[n:]
+	}
+	return buf
+}
+
+// aofRewriteStream 追加重建流的命令
+//
+// 条目用 XADD 逐个添加，空流用 XADD MAXLEN 0 添加再删除一个条目来创建；XSETID 恢复最后的 ID
+// 和添加过的条目数。之后创建各个消费者组及其消费者，并用 XCLAIM FORCE 恢复待确认条目的
+// 所属消费者、投递时间和投递次数。
+func aofRewriteStream(buf []byte, key string, s *Stream) []byte {
+	if s.Len() > 0 {
+		for _, node := range s.nodes {
+			for _, entry := range node.entries {
+				argv := append([]string{"XADD", key, entry.id.String()}, entry.fields...)
+				buf = appendRESPCommand(buf, argv)
+			}
+		}
+	} else {
+		buf = appendRESPCommand(buf, []string{"XADD", key, "MAXLEN", "0", "0-1", "x", "y"})
+	}
+	buf = appendRESPCommand(buf, []string{"XSETID", key, s.lastID.String(),
+		"ENTRIESADDED", strconv.FormatUint(s.entriesAdded, 10), "MAXDELETEDID", "0-0"})
+
+	for _, name := range s.groupNames() {
+		cg := s.cgroups[name]
+		buf = appendRESPCommand(buf, []string{"XGROUP", "CREATE", key, name, cg.lastID.String(),
+			"ENTRIESREAD", strconv.FormatInt(cg.entriesRead, 10)})
+		for _, cname := range cg.consumerNames() {
+			buf = appendRESPCommand(buf, []string{"XGROUP", "CREATECONSUMER", key, name, cname})
+		}
+		cg.pel.Ascend(streamID{}, func(id streamID, nack *streamNACK) bool {
+			buf = appendRESPCommand(buf, []string{"XCLAIM", key, name, nack.consumer.name, "0", id.String(),
+				"TIME", strconv.FormatInt(nack.deliveryTime, 10),
+				"RETRYCOUNT", strconv.FormatInt(nack.deliveryCount, 10), "JUSTID", "FORCE"})
+			return true
+		})
+	}
+	return buf
+}
@@ -0,0 +1,486 @@
+package goredis
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// readAofArgv 读取服务器的 AOF 文件，返回其中各条命令的参数，跳过 RDB 前导部分
+func readAofArgv(t *testing.T, ts *testServer) [][]string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(ts.dir, "appendonly.aof"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(data, []byte("REDIS")) {
+		n, err := NewRedisServer("127.0.0.1", 0, 16).rdbLoad(data, nil)
+		if err != nil {
+			t.Fatalf("AOF RDB preamble: %v", err)
+		}
+		data = data[n:]
+	}
+	var cmds [][]string
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		v, err := ParseRESP(reader)
+		if err == io.EOF {
+			return cmds
+		}
+		if err != nil || v.Type != RESP_ARRAY {
+			t.Fatalf("AOF file is not a sequence of commands: %v", err)
+		}
+		argv := make([]string, len(v.Array))
+		for i, arg := range v.Array {
+			argv[i] = arg.Str
+		}
+		cmds = append(cmds, argv)
+	}
+}
+
+// readAofCommands 读取服务器的 AOF 文件，每条命令返回为以空格分隔的参数
+func readAofCommands(t *testing.T, ts *testServer) []string {
+	t.Helper()
+	var cmds []string
+	for _, argv := range readAofArgv(t, ts) {
+		cmds = append(cmds, strings.Join(argv, " "))
+	}
+	return cmds
+}
+
+// expectAof 检查 AOF 文件中的命令，want 中的 * 匹配任意一个或多个非空白字符
+func expectAof(t *testing.T, ts *testServer, want ...string) {
+	t.Helper()
+	got := readAofCommands(t, ts)
+	ok := len(got) == len(want)
+	for i := 0; ok && i < len(want); i++ {
+		pattern := strings.ReplaceAll(regexp.QuoteMeta(want[i]), `\*`, `\S+`)
+		ok = regexp.MustCompile("^" + pattern + "$").MatchString(got[i])
+	}
+	if !ok {
+		t.Fatalf("AOF contains\n  %s\nwant\n  %s", strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+	}
+}
+
+func TestAofRecordsWriteCommands(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "appendfsync always")
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("v", "GET", "k")
+	c.mustDo("0", "SREM", "missing", "x")
+	c.mustDo("1", "RPUSH", "n", "1")
+	c.mustDo("3", "SADD", "s", "a", "b", "c")
+	c.do("SPOP", "s", "2")
+	c.mustDo("OK", "SELECT", "1")
+	c.mustDo("OK", "SET", "k", "other")
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "SET", "a", "1")
+	c.mustDo("QUEUED", "GET", "a")
+	c.mustDo("QUEUED", "RPUSH", "l", "x")
+	c.mustDo("[OK 1 1]", "EXEC")
+
+	// 只读命令和没有修改数据集的写命令不写入，随机弹出改写为删除弹出的成员，
+	// 事务包装在 MULTI/EXEC 中
+	expectAof(t, ts,
+		"SELECT 0",
+		"SET k v",
+		"RPUSH n 1",
+		"SADD s a b c",
+		"SREM s * *",
+		"SELECT 1",
+		"SET k other",
+		"MULTI",
+		"SET a 1",
+		"RPUSH l x",
+		"EXEC",
+	)
+}
+
+func TestAofScriptsPropagateCommands(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "appendfsync always")
+	c := ts.connect(t)
+	c.mustDo("OK", "EVAL", "return redis.call('SET', KEYS[1], 'x')", "1", "one")
+	c.mustDo("1", "EVAL", "redis.call('SET', 'a', '1'); redis.call('GET', 'a'); return redis.call('RPUSH', 'l', 'x')", "0")
+	c.mustDo("(nil)", "EVAL", "return redis.call('GET', 'a') and nil", "0")
+	// 脚本中的命令各自传播，多条时包装在 MULTI/EXEC 中，只读脚本不写入
+	expectAof(t, ts,
+		"SELECT 0",
+		"SET one x",
+		"MULTI",
+		"SET a 1",
+		"RPUSH l x",
+		"EXEC",
+	)
+}
+
+func TestAofNondeterministicCommandsRewritten(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "appendfsync always")
+	c := ts.connect(t)
+	id := replyString(c.do("XADD", "s", "*", "f", "v"))
+	id2 := replyString(c.do("XADD", "s", "MAXLEN", "~", "10", "*", "f", "w"))
+	c.mustDo("OK", "XGROUP", "CREATE", "s", "g", "0")
+	c.mustDo("[[s [["+id+" [f v]]]]]", "XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">")
+	c.mustDo("["+id+"]", "XCLAIM", "s", "g", "bob", "0", id, "JUSTID")
+	// 自动生成的 ID 传播为实际的 ID，近似裁剪传播为裁剪后的长度，
+	// XCLAIM 传播为创建消费者和确定地设置待确认条目状态的 XCLAIM FORCE
+	expectAof(t, ts,
+		"SELECT 0",
+		"XADD s "+id+" f v",
+		"XADD s MAXLEN = 2 "+id2+" f w",
+		"XGROUP CREATE s g 0",
+		"XREADGROUP GROUP g alice COUNT 1 STREAMS s >",
+		"MULTI",
+		"XGROUP CREATECONSUMER s g bob",
+		"XCLAIM s g bob 0 "+id+" TIME * RETRYCOUNT 1 FORCE JUSTID LASTID "+id,
+		"EXEC",
+	)
+}
+
+func TestAofBlockedCommandFollowsWriter(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "appendfsync always")
+	blocked := ts.connect(t)
+	blocked.send("BLPOP", "list", "0")
+	waitFor(t, "BLPOP to block", func() bool { return ts.blockedOn("list") == 1 })
+	c := ts.connect(t)
+	c.mustDo("1", "RPUSH", "list", "x")
+	blocked.expect("[list x]")
+	// 被服务的阻塞命令紧接在唤醒它的写命令之后
+	expectAof(t, ts,
+		"SELECT 0",
+		"RPUSH list x",
+		"LPOP list",
+	)
+}
+
+func TestAofBlockingCommandsWrittenNonBlocking(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "appendfsync always")
+	c := ts.connect(t)
+	c.mustDo("4", "RPUSH", "list", "a", "b", "c", "d")
+	c.mustDo("2", "ZADD", "z", "1", "m", "2", "n")
+	id := replyString(c.do("XADD", "s", "1-1", "f", "v"))
+	c.mustDo("OK", "XGROUP", "CREATE", "s", "g", "0")
+
+	// 立即完成的阻塞命令同样写为对应的非阻塞命令
+	c.mustDo("[list d]", "BRPOP", "missing", "list", "0")
+	c.mustDo("c", "BLMOVE", "list", "dst", "RIGHT", "LEFT", "0")
+	c.mustDo("b", "BRPOPLPUSH", "list", "dst", "0")
+	c.mustDo("[list [a]]", "BLMPOP", "0", "2", "missing", "list", "LEFT", "COUNT", "5")
+	c.mustDo("[z m 1]", "BZPOPMIN", "z", "0")
+	c.mustDo("[[s [["+id+" [f v]]]]]", "XREADGROUP", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", "s", ">")
+
+	// 阻塞后被服务的命令也一样
+	blocked := ts.connect(t)
+	blocked.send("XREADGROUP", "GROUP", "g", "BLOCK", "BLOCK", "0", "COUNT", "1", "STREAMS", "s", ">")
+	waitFor(t, "XREADGROUP to block", func() bool { return ts.blockedOn("s") == 1 })
+	c.mustDo("1-2", "XADD", "s", "1-2", "f", "w")
+	blocked.expect("[[s [[1-2 [f w]]]]]")
+
+	expectAof(t, ts,
+		"SELECT 0",
+		"RPUSH list a b c d",
+		"ZADD z 1 m 2 n",
+		"XADD s 1-1 f v",
+		"XGROUP CREATE s g 0",
+		"RPOP list",
+		"LMOVE list dst RIGHT LEFT",
+		"RPOPLPUSH list dst",
+		"LMPOP 1 list LEFT COUNT 5",
+		"ZPOPMIN z",
+		"XREADGROUP GROUP g alice STREAMS s >",
+		"XADD s 1-2 f w",
+		"XREADGROUP GROUP g BLOCK COUNT 1 STREAMS s >",
+	)
+}
+
+func TestAofConfig(t *testing.T) {
+	ts := startTestServer(t, "aof-use-rdb-preamble no")
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("2", "RPUSH", "list", "a", "b")
+	if _, err := os.Stat(filepath.Join(ts.dir, "appendonly.aof")); err == nil {
+		t.Fatal("AOF file created with appendonly no")
+	}
+
+	// 打开 AOF 时在后台把当前数据集重写为命令，之后的写命令追加在后面
+	c.mustDo("OK", "CONFIG", "SET", "appendonly", "yes")
+	waitFor(t, "AOF rewrite to finish", func() bool { return !ts.rs.aofRewriteInProgress() })
+	c.mustDo("OK", "SET", "after", "1")
+	c.mustDo("OK", "CONFIG", "SET", "appendonly", "no")
+	c.mustDo("OK", "SET", "ignored", "1")
+	got := readAofCommands(t, ts)
+	if len(got) != 5 || got[0] != "SELECT 0" || got[3] != "SELECT 0" || got[4] != "SET after 1" {
+		t.Fatalf("AOF contains %q", got)
+	}
+	rewritten := []string{got[1], got[2]}
+	if !(rewritten[0] == "SET k v" && rewritten[1] == "RPUSH list a b") && !(rewritten[1] == "SET k v" && rewritten[0] == "RPUSH list a b") {
+		t.Fatalf("dataset rewritten as %q", rewritten)
+	}
+
+	c.mustDo("[appendfsync everysec]", "CONFIG", "GET", "appendfsync")
+	c.mustDo("OK", "CONFIG", "SET", "appendfsync", "ALWAYS")
+	c.mustDo("[appendfsync always]", "CONFIG", "GET", "appendfsync")
+	if v := c.do("CONFIG", "SET", "appendfsync", "sometimes"); v.Type != RESP_ERROR {
+		t.Fatalf("invalid appendfsync accepted: %s", replyString(v))
+	}
+	if v := c.do("CONFIG", "SET", "appendfilename", "other.aof"); v.Type != RESP_ERROR {
+		t.Fatalf("appendfilename changed at runtime: %s", replyString(v))
+	}
+}
+
+func TestBgrewriteaof(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "appendfsync always", "aof-use-rdb-preamble no")
+	c := ts.connect(t)
+	for i := 0; i < 200; i++ {
+		c.mustDo(strconv.Itoa(i+1), "RPUSH", "list", strconv.Itoa(i))
+	}
+	c.mustDo("OK", "LTRIM", "list", "100", "-1")
+	c.mustDo("OK", "SET", "k", "old")
+	c.mustDo("OK", "SET", "k", "new")
+
+	c.mustDo("Background append only file rewriting started", "BGREWRITEAOF")
+	// 重写期间的写命令追加到重写缓冲区，接在新文件后面
+	c.mustDo("OK", "SET", "during", "rewrite")
+	waitFor(t, "AOF rewrite to finish", func() bool { return !ts.rs.aofRewriteInProgress() })
+	c.mustDo("OK", "SET", "after", "rewrite")
+
+	got := readAofCommands(t, ts)
+	var want []string
+	want = append(want, "SELECT 0")
+	var items []string
+	for i := 100; i < 200; i++ {
+		items = append(items, strconv.Itoa(i))
+	}
+	rewritten := []string{
+		"RPUSH list " + strings.Join(items[:AOF_REWRITE_ITEMS_PER_CMD], " "),
+		"RPUSH list " + strings.Join(items[AOF_REWRITE_ITEMS_PER_CMD:], " "),
+		"SET k new",
+	}
+	// 重写的键按数据库中的顺序排列，这里只比较集合
+	if len(got) < 6 || got[0] != "SELECT 0" {
+		t.Fatalf("rewritten AOF contains %q", got)
+	}
+	keys := got[1:4]
+	sort.Strings(keys)
+	if strings.Join(keys, "\n") != strings.Join(rewritten, "\n") {
+		t.Fatalf("dataset rewritten as %q", keys)
+	}
+	// 重写缓冲区和新文件各自从 SELECT 开始
+	var tail []string
+	for _, cmd := range got[4:] {
+		if cmd != "SELECT 0" {
+			tail = append(tail, cmd)
+		}
+	}
+	if strings.Join(tail, ",") != "SET during rewrite,SET after rewrite" {
+		t.Fatalf("commands after the rewrite: %q", tail)
+	}
+
+	// 重写在进行时再次 BGREWRITEAOF 报错
+	ts.rs.aofMu.Lock()
+	ts.rs.aofRewriting = true
+	ts.rs.aofMu.Unlock()
+	c.mustDo("(error) ERR Background append only file rewriting already in progress", "BGREWRITEAOF")
+	ts.rs.aofMu.Lock()
+	ts.rs.aofRewriting = false
+	ts.rs.aofMu.Unlock()
+}
+
+func TestAofRewriteRebuildsDataset(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "aof-use-rdb-preamble no")
+	c := ts.connect(t)
+	c.mustDo("3", "SADD", "set", "a", "b", "c")
+	c.mustDo("2", "ZADD", "zset", "1.5", "x", "2", "y")
+	c.mustDo("1", "HSET", "hash", "f", "v")
+	c.mustDo("1", "PFADD", "hll", "a")
+	c.mustDo("OK", "SET", "str", "with space")
+	c.mustDo("5-1", "XADD", "stream", "5-1", "f", "v")
+	c.mustDo("6-1", "XADD", "stream", "6-1", "f", "w")
+	c.mustDo("OK", "XGROUP", "CREATE", "stream", "g", "0")
+	c.do("XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "stream", ">")
+	c.mustDo("lib", "FUNCTION", "LOAD", "#!lua name=lib\nredis.register_function('f', function() return 7 end)")
+	c.mustDo("OK", "SELECT", "2")
+	c.mustDo("1", "RPUSH", "other", "x")
+
+	c.mustDo("Background append only file rewriting started", "BGREWRITEAOF")
+	waitFor(t, "AOF rewrite to finish", func() bool { return !ts.rs.aofRewriteInProgress() })
+
+	// 在另一个服务器上重放重写的文件，得到相同的数据集
+	replay := startTestServer(t).connect(t)
+	for _, argv := range readAofArgv(t, ts) {
+		if v := replay.do(argv...); v.Type == RESP_ERROR {
+			t.Fatalf("replaying %q: %s", argv, v.Str)
+		}
+	}
+	replay.mustDo("[x]", "LRANGE", "other", "0", "-1")
+	replay.mustDo("OK", "SELECT", "0")
+	replay.mustDo("3", "SCARD", "set")
+	replay.mustDo("[x 1.5 y 2]", "ZRANGE", "zset", "0", "-1", "WITHSCORES")
+	replay.mustDo("v", "HGET", "hash", "f")
+	replay.mustDo("1", "PFCOUNT", "hll")
+	replay.mustDo("with space", "GET", "str")
+	replay.mustDo("[[5-1 [f v]] [6-1 [f w]]]", "XRANGE", "stream", "-", "+")
+	replay.mustDo("[1 5-1 5-1 [[alice 1]]]", "XPENDING", "stream", "g")
+	replay.mustDo("7", "FCALL", "f", "0")
+}
+
+func TestAofAutoRewrite(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "aof-use-rdb-preamble no", "auto-aof-rewrite-min-size 1kb", "auto-aof-rewrite-percentage 100")
+	c := ts.connect(t)
+	c.mustDo("[auto-aof-rewrite-min-size 1024]", "CONFIG", "GET", "auto-aof-rewrite-min-size")
+	value := strings.Repeat("x", 100)
+	// 反复覆盖同一个键，AOF 文件增长到超过最小长度后被自动重写为一条 SET
+	for i := 0; i < 20; i++ {
+		c.mustDo("OK", "SET", "k", value)
+	}
+	waitFor(t, "automatic AOF rewrite", func() bool {
+		ts.rs.aofMu.Lock()
+		defer ts.rs.aofMu.Unlock()
+		return !ts.rs.aofRewriting && ts.rs.aofRewriteBaseSize > 0 && ts.rs.aofCurrentSize < 1024
+	})
+	if got := readAofCommands(t, ts); len(got) != 2 || got[1] != "SET k "+value {
+		t.Fatalf("AOF contains %d commands after the rewrite", len(got))
+	}
+}
+
+func TestAofReloadAfterRestart(t *testing.T) {
+	for _, policy := range []string{"always", "everysec", "no"} {
+		t.Run(policy, func(t *testing.T) {
+			ts := startTestServer(t, "appendonly yes", "appendfsync "+policy)
+			c := ts.connect(t)
+			c.mustDo("OK", "SET", "str", "v")
+			c.mustDo("3", "RPUSH", "list", "a", "b", "c")
+			c.mustDo("OK", "SELECT", "3")
+			c.mustDo("OK", "MULTI")
+			c.mustDo("QUEUED", "SADD", "set", "x")
+			c.mustDo("QUEUED", "SET", "str", "db3")
+			c.mustDo("[1 OK]", "EXEC")
+
+			ts = startTestServerIn(t, ts.dir, "appendonly yes")
+			c = ts.connect(t)
+			c.mustDo("v", "GET", "str")
+			c.mustDo("[a b c]", "LRANGE", "list", "0", "-1")
+			c.mustDo("OK", "SELECT", "3")
+			c.mustDo("[x]", "SMEMBERS", "set")
+			c.mustDo("db3", "GET", "str")
+		})
+	}
+}
+
+// truncatedAof 是最后一条命令不完整的 AOF 文件，返回文件内容和完整命令的长度
+func truncatedAof() (string, int) {
+	valid := "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n" +
+		"*3\r\n$5\r\nRPUSH\r\n$1\r\nl\r\n$1\r\nx\r\n"
+	return valid + "*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1", len(valid)
+}
+
+func TestAofLoadTruncatedTail(t *testing.T) {
+	dir := testDir(t)
+	data, valid := truncatedAof()
+	path := filepath.Join(dir, "appendonly.aof")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := startTestServerIn(t, dir, "appendonly yes", "aof-load-truncated yes")
+	c := ts.connect(t)
+	c.mustDo("1", "GET", "a")
+	c.mustDo("[x]", "LRANGE", "l", "0", "-1")
+	c.mustDo("(nil)", "GET", "b")
+
+	// 不完整的命令被截断，之后的写命令接在最后一条完整的命令后面
+	c.mustDo("OK", "SET", "b", "2")
+	ts = startTestServerIn(t, dir, "appendonly yes", "aof-load-truncated no")
+	ts.connect(t).mustDo("2", "GET", "b")
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := data[:valid] + "*2\r\n$6\r\nSELECT\r\n$1\r\n0\r\n*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1\r\n2\r\n"
+	if string(got) != want {
+		t.Fatalf("AOF was not truncated at offset %d: %q", valid, got)
+	}
+}
+
+func TestAofLoadTruncatedRefusesToStart(t *testing.T) {
+	dir := testDir(t)
+	data, valid := truncatedAof()
+	path := filepath.Join(dir, "appendonly.aof")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := NewRedisServer("127.0.0.1", 0, 16)
+	rs.dir = dir
+	rs.aofEnabled = true
+	rs.aofLoadTruncated = false
+	err := rs.loadDataFromDisk()
+	if err == nil || !strings.Contains(err.Error(), "at offset "+strconv.Itoa(valid)) {
+		t.Fatalf("loading a truncated AOF: got %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != data {
+		t.Fatal("AOF was modified although aof-load-truncated is no")
+	}
+}
+
+func TestAofLoadRejectsBadFormat(t *testing.T) {
+	dir := testDir(t)
+	if err := os.WriteFile(filepath.Join(dir, "appendonly.aof"), []byte("*1\r\n$4\r\nPING\r\ngarbage\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rs := NewRedisServer("127.0.0.1", 0, 16)
+	rs.dir = dir
+	rs.aofEnabled = true
+	if err := rs.loadDataFromDisk(); err == nil || !strings.Contains(err.Error(), "Bad file format") {
+		t.Fatalf("loading a corrupt AOF: got %v", err)
+	}
+}
+
+func TestAofLoadDropsUnfinishedTransaction(t *testing.T) {
+	dir := testDir(t)
+	data := "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n" +
+		"*1\r\n$5\r\nMULTI\r\n*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1\r\n2\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "appendonly.aof"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 没有 EXEC 的事务与不完整的命令一样截断
+	ts := startTestServerIn(t, dir, "appendonly yes", "aof-load-truncated yes")
+	c := ts.connect(t)
+	c.mustDo("1", "GET", "a")
+	c.mustDo("(nil)", "GET", "b")
+}
+
+func TestAofRdbPreamble(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes")
+	c := ts.connect(t)
+	c.mustDo("3", "RPUSH", "list", "a", "b", "c")
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("Background append only file rewriting started", "BGREWRITEAOF")
+	waitFor(t, "AOF rewrite to finish", func() bool { return !ts.rs.aofRewriteInProgress() })
+	c.mustDo("OK", "SET", "after", "rewrite")
+
+	// 重写的数据集以 RDB 格式保存，之后的写命令仍然以命令追加
+	data, err := os.ReadFile(filepath.Join(ts.dir, "appendonly.aof"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("REDIS")) || !bytes.Contains(data, []byte("aof-base")) {
+		t.Fatalf("AOF starts with %q", data[:min(16, len(data))])
+	}
+	if got := readAofCommands(t, ts); strings.Join(got, ",") != "SELECT 0,SET after rewrite" {
+		t.Fatalf("AOF tail contains %q", got)
+	}
+
+	ts = startTestServerIn(t, ts.dir, "appendonly yes")
+	c = ts.connect(t)
+	c.mustDo("[a b c]", "LRANGE", "list", "0", "-1")
+	c.mustDo("v", "GET", "k")
+	c.mustDo("rewrite", "GET", "after")
+}
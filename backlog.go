@@ -0,0 +1,56 @@
+package goredis
+
+// replBacklog 是复制积压缓冲区：命令流中最近的若干字节组成的环形缓冲区
+//
+// 副本短暂断开后以 PSYNC replid offset 重新连接时，只要 offset 之后的命令流还在缓冲区中，
+// 就回复 +CONTINUE 并从这里补发，不必重新全量同步。offset 是缓冲区中第一个字节的复制偏移量，
+// 复制偏移量从 1 开始计数，缓冲区中最后一个字节的偏移量就是 masterReplOffset。字段由 replMu 保护。
+type replBacklog struct {
+	buf     []byte
+	idx     int // 下一个字节写入的位置
+	histlen int // 缓冲区中有效的字节数
+	offset  int64
+}
+
+// newReplBacklog 创建大小为 size 的空缓冲区，之后写入的第一个字节的复制偏移量是 offset
+func newReplBacklog(size int64, offset int64) *replBacklog {
+	return &replBacklog{buf: make([]byte, size), offset: offset}
+}
+
+// feed 追加命令流，缓冲区满了以后覆盖最早的字节
+func (b *replBacklog) feed(p []byte) {
+	for len(p) > 0 {
+		n := copy(b.buf[b.idx:], p)
+		b.idx = (b.idx + n) % len(b.buf)
+		b.histlen += n
+		p = p[n:]
+	}
+	if b.histlen > len(b.buf) {
+		b.offset += int64(b.histlen - len(b.buf))
+		b.histlen = len(b.buf)
+	}
+}
+
+// contains 返回从复制偏移量 offset 开始的命令流是否都在缓冲区中，offset 可以是下一个要写入的字节
+func (b *replBacklog) contains(offset int64) bool {
+	return offset >= b.offset && offset <= b.offset+int64(b.histlen)
+}
+
+// copyFrom 返回从复制偏移量 offset 开始的命令流的副本（调用方需先用 contains 检查）
+func (b *replBacklog) copyFrom(offset int64) []byte {
+	skip := int(offset - b.offset)
+	start := (b.idx - b.histlen + skip + len(b.buf)) % len(b.buf)
+	data := make([]byte, 0, b.histlen-skip)
+	if end := start + b.histlen - skip; end <= len(b.buf) {
+		return append(data, b.buf[start:end]...)
+	}
+	data = append(data, b.buf[start:]...)
+	return append(data, b.buf[:b.idx]...)
+}
+
+// resize 改变缓冲区的大小，保留最近的命令流
+func (b *replBacklog) resize(size int64) {
+	data := b.copyFrom(b.offset)
+	*b = replBacklog{buf: make([]byte, size), offset: b.offset}
+	b.feed(data)
+}
@@ -0,0 +1,37 @@
+package goredis
+
+import "testing"
+
+func TestReplBacklogWrapsAround(t *testing.T) {
+	b := newReplBacklog(8, 1)
+	b.feed([]byte("abcde"))
+	if !b.contains(1) || !b.contains(6) || b.contains(7) {
+		t.Fatalf("backlog offset %d histlen %d", b.offset, b.histlen)
+	}
+	if got := string(b.copyFrom(3)); got != "cde" {
+		t.Fatalf("copyFrom(3) = %q", got)
+	}
+
+	// 写满后覆盖最早的字节，第一个字节的偏移量随之前进
+	b.feed([]byte("fghij"))
+	if b.offset != 3 || b.contains(2) {
+		t.Fatalf("backlog offset %d after wrapping", b.offset)
+	}
+	if got := string(b.copyFrom(3)); got != "cdefghij" {
+		t.Fatalf("copyFrom(3) = %q", got)
+	}
+	if got := string(b.copyFrom(11)); got != "" {
+		t.Fatalf("copyFrom(11) = %q", got)
+	}
+
+	// 缩小后只保留最近的命令流
+	b.resize(4)
+	if b.offset != 7 || string(b.copyFrom(7)) != "ghij" {
+		t.Fatalf("after resize: offset %d data %q", b.offset, b.copyFrom(b.offset))
+	}
+	b.resize(16)
+	b.feed([]byte("k"))
+	if got := string(b.copyFrom(7)); got != "ghijk" {
+		t.Fatalf("after growing: %q", got)
+	}
+}
@@ -0,0 +1,363 @@
+package goredis
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// BITFIELD 的子命令
+const (
+	BITFIELD_GET = iota
+	BITFIELD_SET
+	BITFIELD_INCRBY
+)
+
+// BITFIELD 的溢出处理策略
+const (
+	BITFIELD_OVERFLOW_WRAP = iota
+	BITFIELD_OVERFLOW_SAT
+	BITFIELD_OVERFLOW_FAIL
+)
+
+// bitfieldOp 表示 BITFIELD 中的一个操作
+type bitfieldOp struct {
+	opcode   int
+	offset   int64
+	bits     uint
+	signed   bool
+	value    int64 // SET 的新值或 INCRBY 的增量
+	overflow int
+}
+
+// parseBitfieldType 解析 i8、u16 这样的类型，有符号最多 64 位，无符号最多 63 位
+func parseBitfieldType(arg string) (signed bool, bits uint, errResp *RESPValue) {
+	errResp = NewErrorValue("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	if len(arg) < 2 {
+		return false, 0, errResp
+	}
+	switch arg[0] {
+	case 'i', 'I':
+		signed = true
+	case 'u', 'U':
+	default:
+		return false, 0, errResp
+	}
+	n, err := strconv.Atoi(arg[1:])
+	if err != nil || n < 1 || (signed && n > 64) || (!signed && n > 63) {
+		return false, 0, errResp
+	}
+	return signed, uint(n), nil
+}
+
+// parseBitfieldOffset 解析位偏移量，"#N" 表示第 N 个宽度为 bits 的字段
+func parseBitfieldOffset(arg string, bits uint) (int64, *RESPValue) {
+	errResp := NewErrorValue("ERR bit offset is not an integer or out of range")
+	multiple := strings.HasPrefix(arg, "#")
+	if multiple {
+		arg = arg[1:]
+	}
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, errResp
+	}
+	if multiple {
+		if offset > maxBitOffset/int64(bits) {
+			return 0, errResp
+		}
+		offset *= int64(bits)
+	}
+	if offset > maxBitOffset {
+		return 0, errResp
+	}
+	return offset, nil
+}
+
+// getUnsignedBitfield 读取从 offset 开始的 bits 位无符号整数，高位在前
+func getUnsignedBitfield(buf []byte, offset int64, bits uint) uint64 {
+	var value uint64
+	for i := int64(0); i < int64(bits); i++ {
+		value = value<<1 | uint64(getBit(buf, offset+i))
+	}
+	return value
+}
+
+// getSignedBitfield 读取从 offset 开始的 bits 位有符号整数（补码）
+func getSignedBitfield(buf []byte, offset int64, bits uint) int64 {
+	value := getUnsignedBitfield(buf, offset, bits)
+	if bits < 64 && value&(1<<(bits-1)) != 0 {
+		value |= math.MaxUint64 << bits
+	}
+	return int64(value)
+}
+
+// setUnsignedBitfield 把 value 的低 bits 位写入从 offset 开始的位置，调用方需保证 buf 足够长
+func setUnsignedBitfield(buf []byte, offset int64, bits uint, value uint64) {
+	for i := int64(0); i < int64(bits); i++ {
+		bit := byte(value>>(int64(bits)-1-i)) & 1
+		byteIndex := (offset + i) >> 3
+		shift := 7 - uint((offset+i)&7)
+		buf[byteIndex] = buf[byteIndex]&^(1<<shift) | bit<<shift
+	}
+}
+
+// checkUnsignedBitfieldOverflow 检查 value+incr 是否超出 bits 位无符号整数的范围，
+// 溢出时按策略在 limit 中给出替代值（FAIL 时不设置），返回 1 表示上溢，-1 表示下溢，0 表示未溢出
+func checkUnsignedBitfieldOverflow(value uint64, incr int64, bits uint, overflow int, limit *uint64) int {
+	maxValue := uint64(1)<<bits - 1
+	maxIncr := int64(maxValue - value)
+	minIncr := -int64(value)
+
+	wrap := func() {
+		*limit = (value + uint64(incr)) & maxValue
+	}
+	if value > maxValue || (incr > 0 && incr > maxIncr) {
+		switch overflow {
+		case BITFIELD_OVERFLOW_WRAP:
+			wrap()
+		case BITFIELD_OVERFLOW_SAT:
+			*limit = maxValue
+		}
+		return 1
+	} else if incr < 0 && incr < minIncr {
+		switch overflow {
+		case BITFIELD_OVERFLOW_WRAP:
+			wrap()
+		case BITFIELD_OVERFLOW_SAT:
+			*limit = 0
+		}
+		return -1
+	}
+	return 0
+}
+
+// checkSignedBitfieldOverflow 检查 value+incr 是否超出 bits 位有符号整数的范围，返回值含义同上
+func checkSignedBitfieldOverflow(value, incr int64, bits uint, overflow int, limit *int64) int {
+	maxValue := int64(math.MaxInt64)
+	if bits < 64 {
+		maxValue = int64(1)<<(bits-1) - 1
+	}
+	minValue := -maxValue - 1
+	// bits 为 64 时减法可能回绕，下面的判断会结合 value 的符号排除这种情况
+	maxIncr := maxValue - value
+	minIncr := minValue - value
+
+	wrap := func() {
+		c := uint64(value) + uint64(incr)
+		if bits < 64 {
+			mask := uint64(math.MaxUint64) << bits
+			if c&(1<<(bits-1)) != 0 {
+				c |= mask
+			} else {
+				c &^= mask
+			}
+		}
+		*limit = int64(c)
+	}
+	if value > maxValue || (bits != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		switch overflow {
+		case BITFIELD_OVERFLOW_WRAP:
+			wrap()
+		case BITFIELD_OVERFLOW_SAT:
+			*limit = maxValue
+		}
+		return 1
+	} else if value < minValue || (bits != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		switch overflow {
+		case BITFIELD_OVERFLOW_WRAP:
+			wrap()
+		case BITFIELD_OVERFLOW_SAT:
+			*limit = minValue
+		}
+		return -1
+	}
+	return 0
+}
+
+// parseBitfieldOps 解析 BITFIELD 的操作序列，返回操作列表以及写操作涉及的最高位偏移（没有写操作时为 -1）
+func parseBitfieldOps(args []string, readOnly bool) ([]bitfieldOp, int64, *RESPValue) {
+	var ops []bitfieldOp
+	highestWrite := int64(-1)
+	overflow := BITFIELD_OVERFLOW_WRAP
+
+	for i := 0; i < len(args); i++ {
+		sub := strings.ToUpper(args[i])
+		if sub == "OVERFLOW" {
+			if i+1 >= len(args) {
+				return nil, 0, NewErrorValue("ERR syntax error")
+			}
+			switch strings.ToUpper(args[i+1]) {
+			case "WRAP":
+				overflow = BITFIELD_OVERFLOW_WRAP
+			case "SAT":
+				overflow = BITFIELD_OVERFLOW_SAT
+			case "FAIL":
+				overflow = BITFIELD_OVERFLOW_FAIL
+			default:
+				return nil, 0, NewErrorValue("ERR Invalid OVERFLOW type specified")
+			}
+			i++
+			continue
+		}
+
+		op := bitfieldOp{overflow: overflow}
+		argc := 2
+		switch sub {
+		case "GET":
+			op.opcode = BITFIELD_GET
+		case "SET":
+			op.opcode = BITFIELD_SET
+			argc = 3
+		case "INCRBY":
+			op.opcode = BITFIELD_INCRBY
+			argc = 3
+		default:
+			return nil, 0, NewErrorValue("ERR syntax error")
+		}
+		if i+argc >= len(args) {
+			return nil, 0, NewErrorValue("ERR syntax error")
+		}
+		if readOnly && op.opcode != BITFIELD_GET {
+			return nil, 0, NewErrorValue("ERR BITFIELD_RO only supports the GET subcommand")
+		}
+
+		var errResp *RESPValue
+		if op.signed, op.bits, errResp = parseBitfieldType(args[i+1]); errResp != nil {
+			return nil, 0, errResp
+		}
+		if op.offset, errResp = parseBitfieldOffset(args[i+2], op.bits); errResp != nil {
+			return nil, 0, errResp
+		}
+		if argc == 3 {
+			value, err := strconv.ParseInt(args[i+3], 10, 64)
+			if err != nil {
+				return nil, 0, NewErrorValue("ERR value is not an integer or out of range")
+			}
+			op.value = value
+			highestWrite = max(highestWrite, op.offset+int64(op.bits)-1)
+		}
+		ops = append(ops, op)
+		i += argc
+	}
+	return ops, highestWrite, nil
+}
+
+// execBitfieldOp 在 buf 上执行一个操作并返回回复，写操作要求 buf 已经足够长
+func execBitfieldOp(buf []byte, op bitfieldOp) *RESPValue {
+	if op.opcode == BITFIELD_GET {
+		if op.signed {
+			return NewIntegerValue(getSignedBitfield(buf, op.offset, op.bits))
+		}
+		return NewIntegerValue(int64(getUnsignedBitfield(buf, op.offset, op.bits)))
+	}
+
+	if op.signed {
+		oldValue := getSignedBitfield(buf, op.offset, op.bits)
+		var newValue, retValue, limit int64
+		var overflowed bool
+		if op.opcode == BITFIELD_INCRBY {
+			overflowed = checkSignedBitfieldOverflow(oldValue, op.value, op.bits, op.overflow, &limit) != 0
+			newValue = oldValue + op.value
+			retValue = newValue
+		} else {
+			overflowed = checkSignedBitfieldOverflow(op.value, 0, op.bits, op.overflow, &limit) != 0
+			newValue = op.value
+			retValue = oldValue
+		}
+		if overflowed {
+			if op.overflow == BITFIELD_OVERFLOW_FAIL {
+				return NewNullBulkStringValue()
+			}
+			newValue = limit
+			if op.opcode == BITFIELD_INCRBY {
+				retValue = limit
+			}
+		}
+		setUnsignedBitfield(buf, op.offset, op.bits, uint64(newValue))
+		return NewIntegerValue(retValue)
+	}
+
+	oldValue := getUnsignedBitfield(buf, op.offset, op.bits)
+	var newValue, retValue, limit uint64
+	var overflowed bool
+	if op.opcode == BITFIELD_INCRBY {
+		overflowed = checkUnsignedBitfieldOverflow(oldValue, op.value, op.bits, op.overflow, &limit) != 0
+		newValue = oldValue + uint64(op.value)
+		retValue = newValue
+	} else {
+		overflowed = checkUnsignedBitfieldOverflow(uint64(op.value), 0, op.bits, op.overflow, &limit) != 0
+		newValue = uint64(op.value)
+		retValue = oldValue
+	}
+	if overflowed {
+		if op.overflow == BITFIELD_OVERFLOW_FAIL {
+			return NewNullBulkStringValue()
+		}
+		newValue = limit
+		if op.opcode == BITFIELD_INCRBY {
+			retValue = limit
+		}
+	}
+	setUnsignedBitfield(buf, op.offset, op.bits, newValue)
+	return NewIntegerValue(int64(retValue))
+}
+
+// handleBitField 处理 BITFIELD 和 BITFIELD_RO 命令
+//
+// 所有操作先全部解析，任何一个出错都不会执行；随后在同一把锁内依次执行，
+// 因此一条命令中的多个操作对其他客户端是原子的。
+func (rs *RedisServer) handleBitField(c *client, command *RESPValue, readOnly bool) *RESPValue {
+	name := "bitfield"
+	if readOnly {
+		name = "bitfield_ro"
+	}
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError(name)
+	}
+
+	ops, highestWrite, errResp := parseBitfieldOps(args[1:], readOnly)
+	if errResp != nil {
+		return errResp
+	}
+
+	var buf []byte
+	if highestWrite >= 0 {
+		rs.mutex.Lock()
+		defer rs.mutex.Unlock()
+
+		obj, errResp := c.db.lookupStringForWrite(args[0])
+		if errResp != nil {
+			return errResp
+		}
+		buf = growString(obj, highestWrite>>3+1)
+	} else {
+		rs.mutex.RLock()
+		defer rs.mutex.RUnlock()
+
+		obj, errResp := c.db.lookupString(args[0])
+		if errResp != nil {
+			return errResp
+		}
+		if obj != nil {
+			buf = obj.Value.([]byte)
+		}
+	}
+
+	replies := make([]*RESPValue, len(ops))
+	changes := 0
+	for i, op := range ops {
+		replies[i] = execBitfieldOp(buf, op)
+		if op.opcode != BITFIELD_GET && !replies[i].IsNull {
+			changes++
+		}
+	}
+	if changes > 0 {
+		rs.signalModifiedKey(c.db, args[0])
+		rs.notifyKeyspaceEvent(NOTIFY_STRING, "setbit", args[0], c.db.id)
+	}
+	return NewArrayValue(replies)
+}
@@ -0,0 +1,127 @@
+package goredis
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// wrapBig 把 v 折回 bits 位整数的取值范围，signed 为 true 时使用补码
+func wrapBig(v *big.Int, bits uint, signed bool) *big.Int {
+	mod := new(big.Int).Lsh(big.NewInt(1), bits)
+	r := new(big.Int).Mod(v, mod)
+	if signed && r.Cmp(new(big.Int).Rsh(mod, 1)) >= 0 {
+		r.Sub(r, mod)
+	}
+	return r
+}
+
+// randomIncr 返回随机增量，一半在较小范围内，一半覆盖整个 int64
+func randomIncr(r *rand.Rand) int64 {
+	if r.Intn(2) == 0 {
+		return r.Int63n(1000) - 500
+	}
+	return int64(r.Uint64())
+}
+
+func TestBitfieldOverflowMatchesBigIntModel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		signed := r.Intn(2) == 0
+		var bits uint
+		if signed {
+			bits = uint(r.Intn(64) + 1)
+		} else {
+			bits = uint(r.Intn(63) + 1)
+		}
+		lo, hi := big.NewInt(0), new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+		if signed {
+			lo = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), bits-1))
+			hi = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits-1), big.NewInt(1))
+		}
+		value := wrapBig(big.NewInt(int64(r.Uint64())), bits, signed)
+		incr := randomIncr(r)
+		sum := new(big.Int).Add(value, big.NewInt(incr))
+
+		wantDir := 0
+		switch {
+		case sum.Cmp(hi) > 0:
+			wantDir = 1
+		case sum.Cmp(lo) < 0:
+			wantDir = -1
+		}
+		for _, overflow := range []int{BITFIELD_OVERFLOW_WRAP, BITFIELD_OVERFLOW_SAT} {
+			want := wrapBig(sum, bits, signed)
+			if overflow == BITFIELD_OVERFLOW_SAT && wantDir == 1 {
+				want = hi
+			} else if overflow == BITFIELD_OVERFLOW_SAT && wantDir == -1 {
+				want = lo
+			}
+
+			var dir int
+			var got *big.Int
+			if signed {
+				limit := value.Int64() + incr
+				dir = checkSignedBitfieldOverflow(value.Int64(), incr, bits, overflow, &limit)
+				got = big.NewInt(limit)
+			} else {
+				limit := value.Uint64() + uint64(incr)
+				dir = checkUnsignedBitfieldOverflow(value.Uint64(), incr, bits, overflow, &limit)
+				got = new(big.Int).SetUint64(limit)
+			}
+			if dir != wantDir || got.Cmp(want) != 0 {
+				t.Fatalf("signed=%v bits=%d value=%s incr=%d overflow=%d: got %s (dir %d), want %s (dir %d)",
+					signed, bits, value, incr, overflow, got, dir, want, wantDir)
+			}
+		}
+	}
+}
+
+func TestBitfieldGetSetRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	buf := make([]byte, 32)
+	for i := 0; i < 5000; i++ {
+		bits := uint(r.Intn(64) + 1)
+		offset := int64(r.Intn(len(buf)*8 - int(bits) + 1))
+		value := r.Uint64() >> (64 - bits)
+		before := append([]byte(nil), buf...)
+		setUnsignedBitfield(buf, offset, bits, value)
+		if got := getUnsignedBitfield(buf, offset, bits); got != value {
+			t.Fatalf("u%d at %d: got %d, want %d", bits, offset, got, value)
+		}
+		if got, want := getSignedBitfield(buf, offset, bits), wrapBig(new(big.Int).SetUint64(value), bits, true).Int64(); got != want {
+			t.Fatalf("i%d at %d: got %d, want %d", bits, offset, got, want)
+		}
+		// 字段之外的位保持不变
+		for b := int64(0); b < int64(len(buf)*8); b++ {
+			if (b < offset || b >= offset+int64(bits)) && getBit(buf, b) != getBit(before, b) {
+				t.Fatalf("u%d at %d changed bit %d", bits, offset, b)
+			}
+		}
+	}
+}
+
+func TestBitField(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[1 0]", "BITFIELD", "k", "INCRBY", "i5", "100", "1", "GET", "u4", "0")
+	// SET 返回原值，#N 表示第 N 个该宽度的字段
+	c.mustDo("[0 0]", "BITFIELD", "b", "SET", "u8", "#1", "255", "SET", "u8", "0", "65")
+	c.mustDo("A\xff", "GET", "b")
+	c.mustDo("[65 -1]", "BITFIELD", "b", "GET", "u8", "0", "GET", "i8", "8")
+
+	// 溢出策略对其后的 INCRBY/SET 生效
+	c.mustDo("[1 1]", "BITFIELD", "o", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1")
+	c.mustDo("[2 2]", "BITFIELD", "o", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1")
+	c.mustDo("[3 3]", "BITFIELD", "o", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1")
+	c.mustDo("[0 3]", "BITFIELD", "o", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1")
+	c.mustDo("[(nil)]", "BITFIELD", "o", "OVERFLOW", "FAIL", "INCRBY", "u2", "102", "1")
+	c.mustDo("[0 1 -128 -128]", "BITFIELD", "w", "SET", "i8", "0", "127", "GET", "u2", "0", "INCRBY", "i8", "0", "1", "OVERFLOW", "SAT", "INCRBY", "i8", "0", "-1")
+	c.mustDo("[-9223372036854775808]", "BITFIELD", "big", "INCRBY", "i64", "0", "-9223372036854775808")
+
+	c.mustDo("[65]", "BITFIELD_RO", "b", "GET", "u8", "0")
+	c.mustDo("(error) ERR BITFIELD_RO only supports the GET subcommand", "BITFIELD_RO", "b", "SET", "u8", "0", "1")
+	c.mustDo("(error) ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.", "BITFIELD", "b", "GET", "u64", "0")
+	c.mustDo("(error) ERR Invalid OVERFLOW type specified", "BITFIELD", "b", "OVERFLOW", "FOO")
+	c.mustDo("(error) ERR bit offset is not an integer or out of range", "BITFIELD", "b", "GET", "u8", "-1")
+}
@@ -0,0 +1,426 @@
+package goredis
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// 位偏移量的上限，与 Redis 一样限制字符串最大为 512MB
+const maxBitOffset = 512*1024*1024*8 - 1
+
+// parseBitOffset 解析位偏移量
+func parseBitOffset(arg string) (int64, *RESPValue) {
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || offset < 0 || offset > maxBitOffset {
+		return 0, NewErrorValue("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// growString 确保字符串至少有 size 个字节，不足部分以 0 填充，返回新的内容
+func growString(obj *RedisObject, size int64) []byte {
+	buf := obj.Value.([]byte)
+	if int64(len(buf)) < size {
+		buf = append(buf, make([]byte, size-int64(len(buf)))...)
+		obj.Value = buf
+	}
+	return buf
+}
+
+// lookupStringForWrite 查找字符串对象用于修改，不存在时创建空字符串（调用方需持有写锁）
+func (db *redisDb) lookupStringForWrite(key string) (*RedisObject, *RESPValue) {
+	db.lookupKeyWrite(key)
+	obj, errResp := db.lookupString(key)
+	if errResp != nil {
+		return nil, errResp
+	}
+	if obj == nil {
+		obj = NewStringObject("")
+		db.store.Set(key, obj)
+	}
+	return obj, nil
+}
+
+// getBit 返回 buf 中偏移为 offset 的位，超出长度的位视为 0；第 0 位是首字节的最高位
+func getBit(buf []byte, offset int64) int {
+	byteIndex := offset >> 3
+	if byteIndex >= int64(len(buf)) {
+		return 0
+	}
+	return int(buf[byteIndex]>>(7-uint(offset&7))) & 1
+}
+
+// handleSetBit 处理 SETBIT 命令
+func (rs *RedisServer) handleSetBit(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 {
+		return wrongArgsError("setbit")
+	}
+
+	offset, errResp := parseBitOffset(args[1])
+	if errResp != nil {
+		return errResp
+	}
+	if args[2] != "0" && args[2] != "1" {
+		return NewErrorValue("ERR bit is not an integer or out of range")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	obj, errResp := c.db.lookupStringForWrite(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	buf := growString(obj, offset>>3+1)
+
+	old := getBit(buf, offset)
+	mask := byte(1) << (7 - uint(offset&7))
+	if args[2] == "1" {
+		buf[offset>>3] |= mask
+	} else {
+		buf[offset>>3] &^= mask
+	}
+	rs.signalModifiedKey(c.db, args[0])
+	rs.notifyKeyspaceEvent(NOTIFY_STRING, "setbit", args[0], c.db.id)
+	return NewIntegerValue(int64(old))
+}
+
+// handleGetBit 处理 GETBIT 命令
+func (rs *RedisServer) handleGetBit(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("getbit")
+	}
+
+	offset, errResp := parseBitOffset(args[1])
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	obj, errResp := c.db.lookupString(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if obj == nil {
+		return NewIntegerValue(0)
+	}
+	return NewIntegerValue(int64(getBit(obj.Value.([]byte), offset)))
+}
+
+// popcount 统计 buf 中值为 1 的位数，每次处理 8 个字节
+func popcount(buf []byte) int {
+	count := 0
+	for len(buf) >= 8 {
+		count += bits.OnesCount64(binary.LittleEndian.Uint64(buf))
+		buf = buf[8:]
+	}
+	for _, b := range buf {
+		count += bits.OnesCount8(b)
+	}
+	return count
+}
+
+// normalizeRange 按 Redis 的规则归一化闭区间 [start, end]：负数从末尾倒数，
+// 超出范围的端点被截断，区间为空时 ok 为 false
+func normalizeRange(start, end, length int64) (int64, int64, bool) {
+	if start < 0 {
+		start += length
+	}
+	if end < 0 {
+		end += length
+	}
+	start = max(start, 0)
+	end = max(end, 0)
+	end = min(end, length-1)
+	if start > end || length == 0 {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// parseBitRangeUnit 解析 BYTE/BIT 单位参数，返回是否以位为单位
+func parseBitRangeUnit(arg string) (bool, *RESPValue) {
+	switch strings.ToUpper(arg) {
+	case "BYTE":
+		return false, nil
+	case "BIT":
+		return true, nil
+	}
+	return false, NewErrorValue("ERR syntax error")
+}
+
+// handleBitCount 处理 BITCOUNT 命令
+func (rs *RedisServer) handleBitCount(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("bitcount")
+	}
+	if len(args) == 2 || len(args) > 4 {
+		return NewErrorValue("ERR syntax error")
+	}
+
+	var start, end int64
+	bitUnit := false
+	if len(args) >= 3 {
+		var err1, err2 error
+		start, err1 = strconv.ParseInt(args[1], 10, 64)
+		end, err2 = strconv.ParseInt(args[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		if len(args) == 4 {
+			if bitUnit, errResp = parseBitRangeUnit(args[3]); errResp != nil {
+				return errResp
+			}
+		}
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	obj, errResp := c.db.lookupString(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if obj == nil {
+		return NewIntegerValue(0)
+	}
+	buf := obj.Value.([]byte)
+	if len(args) == 1 {
+		return NewIntegerValue(int64(popcount(buf)))
+	}
+
+	if !bitUnit {
+		start, end, ok := normalizeRange(start, end, int64(len(buf)))
+		if !ok {
+			return NewIntegerValue(0)
+		}
+		return NewIntegerValue(int64(popcount(buf[start : end+1])))
+	}
+
+	start, end, ok := normalizeRange(start, end, int64(len(buf))*8)
+	if !ok {
+		return NewIntegerValue(0)
+	}
+	// 先统计覆盖到的完整字节，再减去首尾字节中区间之外的位
+	firstByte, lastByte := start>>3, end>>3
+	count := popcount(buf[firstByte : lastByte+1])
+	count -= bits.OnesCount8(buf[firstByte] >> (8 - uint(start&7)))
+	count -= bits.OnesCount8(buf[lastByte] << (uint(end&7) + 1))
+	return NewIntegerValue(int64(count))
+}
+
+// bitPos 返回位区间 [start, end] 内第一个值为 bit 的位的偏移，找不到时返回 -1
+func bitPos(buf []byte, start, end int64, bit int) int64 {
+	// 整字节都不可能命中时直接跳过
+	skip := byte(0)
+	if bit == 0 {
+		skip = 0xff
+	}
+	for i := start; i <= end; {
+		if i&7 == 0 && i+7 <= end && buf[i>>3] == skip {
+			i += 8
+			continue
+		}
+		if getBit(buf, i) == bit {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+// handleBitPos 处理 BITPOS 命令
+//
+// 查找 0 时如果没有指定 end 且区间内全是 1，则返回区间之后的第一个位，即把字符串右侧视为以 0 补齐；
+// 指定了 end 时只在区间内查找，找不到返回 -1。
+func (rs *RedisServer) handleBitPos(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("bitpos")
+	}
+	if len(args) > 5 {
+		return NewErrorValue("ERR syntax error")
+	}
+
+	var bit int
+	switch args[1] {
+	case "0":
+		bit = 0
+	case "1":
+		bit = 1
+	default:
+		return NewErrorValue("ERR The bit argument must be 1 or 0.")
+	}
+
+	var start, end int64
+	endGiven, bitUnit := false, false
+	if len(args) >= 3 {
+		var err error
+		if start, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+	}
+	if len(args) >= 4 {
+		var err error
+		if end, err = strconv.ParseInt(args[3], 10, 64); err != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		endGiven = true
+	}
+	if len(args) == 5 {
+		if bitUnit, errResp = parseBitRangeUnit(args[4]); errResp != nil {
+			return errResp
+		}
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	obj, errResp := c.db.lookupString(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	// 不存在的键视为空字符串：找 1 失败，找 0 时第一位就是 0
+	if obj == nil {
+		if bit == 1 {
+			return NewIntegerValue(-1)
+		}
+		return NewIntegerValue(0)
+	}
+	buf := obj.Value.([]byte)
+
+	length := int64(len(buf))
+	if bitUnit {
+		length *= 8
+	}
+	if !endGiven {
+		end = length - 1
+	}
+	start, end, ok := normalizeRange(start, end, length)
+	if !ok {
+		return NewIntegerValue(-1)
+	}
+	if !bitUnit {
+		start, end = start*8, end*8+7
+	}
+
+	pos := bitPos(buf, start, end, bit)
+	if pos == -1 && bit == 0 && !endGiven {
+		return NewIntegerValue(end + 1)
+	}
+	return NewIntegerValue(pos)
+}
+
+// BITOP 的运算类型
+const (
+	BITOP_AND = iota
+	BITOP_OR
+	BITOP_XOR
+	BITOP_NOT
+)
+
+// handleBitOp 处理 BITOP 命令
+//
+// 结果长度为最长的源字符串长度，较短的源字符串视为以 0 补齐，不存在的键视为空字符串。
+// 结果为空时删除目标键。
+func (rs *RedisServer) handleBitOp(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 {
+		return wrongArgsError("bitop")
+	}
+
+	var op int
+	switch strings.ToUpper(args[0]) {
+	case "AND":
+		op = BITOP_AND
+	case "OR":
+		op = BITOP_OR
+	case "XOR":
+		op = BITOP_XOR
+	case "NOT":
+		op = BITOP_NOT
+	default:
+		return NewErrorValue("ERR syntax error")
+	}
+	dest, keys := args[1], args[2:]
+	if op == BITOP_NOT && len(keys) != 1 {
+		return NewErrorValue("ERR BITOP NOT must be called with a single source key.")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	sources := make([][]byte, len(keys))
+	maxLen := 0
+	for i, key := range keys {
+		obj, errResp := c.db.lookupString(key)
+		if errResp != nil {
+			return errResp
+		}
+		if obj != nil {
+			sources[i] = obj.Value.([]byte)
+			maxLen = max(maxLen, len(sources[i]))
+		}
+	}
+
+	if maxLen == 0 {
+		if c.db.lookupKey(dest) != nil {
+			c.db.store.Delete(dest)
+			rs.signalModifiedKey(c.db, dest)
+			rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", dest, c.db.id)
+		}
+		return NewIntegerValue(0)
+	}
+
+	result := make([]byte, maxLen)
+	if op == BITOP_NOT {
+		for i, b := range sources[0] {
+			result[i] = ^b
+		}
+	} else {
+		copy(result, sources[0])
+		for _, src := range sources[1:] {
+			for i := range result {
+				var b byte
+				if i < len(src) {
+					b = src[i]
+				}
+				switch op {
+				case BITOP_AND:
+					result[i] &= b
+				case BITOP_OR:
+					result[i] |= b
+				case BITOP_XOR:
+					result[i] ^= b
+				}
+			}
+		}
+	}
+
+	c.db.store.Set(dest, &RedisObject{Type: OBJ_STRING, Value: result})
+	rs.signalModifiedKey(c.db, dest)
+	rs.notifyKeyspaceEvent(NOTIFY_STRING, "set", dest, c.db.id)
+	return NewIntegerValue(int64(maxLen))
+}
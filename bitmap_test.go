@@ -0,0 +1,96 @@
+package goredis
+
+import "testing"
+
+func TestSetBitAndGetBit(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("0", "GETBIT", "b", "100")
+	c.mustDo("0", "SETBIT", "b", "1", "1")
+	c.mustDo("0", "SETBIT", "b", "7", "1")
+	// 位按大端顺序编号：第 1 位和第 7 位组成 0x41，即 "A"
+	c.mustDo("A", "GET", "b")
+	c.mustDo("1", "SETBIT", "b", "7", "0")
+	c.mustDo("@", "GET", "b")
+	c.mustDo("1", "GETBIT", "b", "1")
+	c.mustDo("0", "GETBIT", "b", "1000")
+
+	// 字符串长度不足时以 0 扩展
+	c.mustDo("0", "SETBIT", "b", "23", "1")
+	c.mustDo("@\x00\x01", "GET", "b")
+	c.mustDo("OK", "SET", "s", "a")
+	c.mustDo("1", "GETBIT", "s", "1")
+
+	c.mustDo("(error) ERR bit is not an integer or out of range", "SETBIT", "b", "0", "2")
+	c.mustDo("(error) ERR bit offset is not an integer or out of range", "SETBIT", "b", "-1", "1")
+	c.mustDo("(error) ERR bit offset is not an integer or out of range", "GETBIT", "b", "4294967296")
+	c.mustDo("1", "RPUSH", "l", "x")
+	c.mustDo("(error) WRONGTYPE Operation against a key holding the wrong kind of value", "SETBIT", "l", "0", "1")
+}
+
+func TestBitCount(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("0", "BITCOUNT", "missing")
+	c.mustDo("OK", "SET", "s", "foobar")
+	c.mustDo("26", "BITCOUNT", "s")
+	c.mustDo("4", "BITCOUNT", "s", "0", "0")
+	c.mustDo("6", "BITCOUNT", "s", "1", "1")
+	c.mustDo("7", "BITCOUNT", "s", "-2", "-1")
+	c.mustDo("0", "BITCOUNT", "s", "3", "1")
+	// BIT 单位的范围：第 5 到第 30 位
+	c.mustDo("17", "BITCOUNT", "s", "5", "30", "BIT")
+	c.mustDo("0", "BITCOUNT", "s", "-1", "-1", "BIT")
+	c.mustDo("1", "BITCOUNT", "s", "-2", "-2", "BIT")
+	c.mustDo("(error) ERR syntax error", "BITCOUNT", "s", "0")
+	c.mustDo("(error) ERR syntax error", "BITCOUNT", "s", "0", "1", "WORD")
+}
+
+func TestBitOp(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "a", "\x0f\xf0")
+	c.mustDo("OK", "SET", "b", "\xff")
+	// 较短的字符串以 0 补齐
+	c.mustDo("2", "BITOP", "AND", "dst", "a", "b")
+	c.mustDo("\x0f\x00", "GET", "dst")
+	c.mustDo("2", "BITOP", "OR", "dst", "a", "b")
+	c.mustDo("\xff\xf0", "GET", "dst")
+	c.mustDo("2", "BITOP", "XOR", "dst", "a", "b", "missing")
+	c.mustDo("\xf0\xf0", "GET", "dst")
+	c.mustDo("2", "BITOP", "NOT", "dst", "a")
+	c.mustDo("\xf0\x0f", "GET", "dst")
+
+	// 结果为空时删除目标键
+	c.mustDo("0", "BITOP", "OR", "dst", "missing")
+	c.mustDo("(nil)", "GET", "dst")
+	c.mustDo("(error) ERR BITOP NOT must be called with a single source key.", "BITOP", "NOT", "dst", "a", "b")
+	c.mustDo("(error) ERR syntax error", "BITOP", "NAND", "dst", "a")
+}
+
+func TestBitPos(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("0", "BITPOS", "missing", "0")
+	c.mustDo("-1", "BITPOS", "missing", "1")
+
+	c.mustDo("OK", "SET", "a", "\xff\xf0\x00")
+	c.mustDo("12", "BITPOS", "a", "0")
+	c.mustDo("OK", "SET", "b", "\x00\xff\xf0")
+	c.mustDo("8", "BITPOS", "b", "1", "0")
+	c.mustDo("16", "BITPOS", "b", "1", "2")
+	c.mustDo("16", "BITPOS", "b", "1", "2", "-1", "BYTE")
+	c.mustDo("8", "BITPOS", "b", "1", "7", "15", "BIT")
+	c.mustDo("8", "BITPOS", "b", "1", "7", "-3", "BIT")
+
+	// 全为 1 时，没有指定 end 就认为右侧补了 0，指定 end 时返回 -1
+	c.mustDo("OK", "SET", "ones", "\xff\xff")
+	c.mustDo("16", "BITPOS", "ones", "0")
+	c.mustDo("16", "BITPOS", "ones", "0", "1")
+	c.mustDo("-1", "BITPOS", "ones", "0", "0", "-1")
+	c.mustDo("OK", "SET", "zeros", "\x00\x00")
+	c.mustDo("-1", "BITPOS", "zeros", "1")
+
+	c.mustDo("(error) ERR The bit argument must be 1 or 0.", "BITPOS", "a", "2")
+	c.mustDo("(error) ERR syntax error", "BITPOS", "a", "1", "0", "1", "WORD")
+}
@@ -0,0 +1,281 @@
+package goredis
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 客户端阻塞的原因
+const (
+	BLOCKED_KEYS = iota // 列表、有序集合和流的阻塞命令，等待键就绪
+	BLOCKED_ACKS        // WAIT 和 WAITAOF，等待副本的确认或本地 AOF 的 fsync
+)
+
+// blockedClient 表示一个阻塞的客户端
+//
+// 阻塞命令把自己的执行逻辑封装成 try：等待的条件可能满足时（键就绪、副本发来 ACK、AOF 完成 fsync）
+// 由引起变化的一方在持有写锁的情况下代为执行，结果通过 result 交还给阻塞的连接。这样键上的数据
+// 总是按阻塞的先后顺序（FIFO）分配给等待者，不会被同时唤醒的多个客户端争抢。
+// timeoutReply 返回超时时的回复。
+type blockedClient struct {
+	btype        int
+	c            *client
+	db           *redisDb
+	keys         []string
+	try          func() *RESPValue
+	timeoutReply func() *RESPValue
+	result       chan *RESPValue
+	served       bool
+}
+
+// readyKey 标识某个数据库中的一个就绪键
+type readyKey struct {
+	db  *redisDb
+	key string
+}
+
+// blockForKeys 执行 try，若返回 nil 则阻塞在客户端当前数据库的 keys 上，直到某个键就绪后 try 成功或超时
+//
+// try 总是在持有写锁时被调用，返回 nil 表示暂时无法完成，需继续等待。
+// timeout 为 0 表示永久阻塞，超时返回 null 数组。事务和脚本中的阻塞命令不会阻塞，
+// 与立即超时相同。等待的方式见 blockClient。
+func (rs *RedisServer) blockForKeys(c *client, keys []string, timeout time.Duration, try func() *RESPValue) *RESPValue {
+	db := c.db
+	rs.mutex.Lock()
+	if resp := try(); resp != nil {
+		rs.mutex.Unlock()
+		return resp
+	}
+	if c.denyBlocking {
+		rs.mutex.Unlock()
+		return NewNullArrayValue()
+	}
+
+	bc := &blockedClient{
+		btype:        BLOCKED_KEYS,
+		c:            c,
+		db:           db,
+		keys:         keys,
+		try:          try,
+		timeoutReply: NewNullArrayValue,
+		result:       make(chan *RESPValue, 1),
+	}
+	for _, key := range keys {
+		db.blockedKeys[key] = append(db.blockedKeys[key], bc)
+	}
+	rs.mutex.Unlock()
+	return rs.blockClient(bc, timeout)
+}
+
+// blockForAcks 执行 try，若返回 nil 则等待副本的确认或本地 AOF 的 fsync，直到 try 成功或超时
+//
+// 用于 WAIT 和 WAITAOF。try 在持有写锁时被调用，current 返回当前的状态，作为超时时的回复；
+// 事务和脚本中不阻塞，直接返回 current。timeout 为 0 表示永久等待。
+func (rs *RedisServer) blockForAcks(c *client, timeout time.Duration, try, current func() *RESPValue) *RESPValue {
+	rs.mutex.Lock()
+	if resp := try(); resp != nil {
+		rs.mutex.Unlock()
+		return resp
+	}
+	if c.denyBlocking {
+		defer rs.mutex.Unlock()
+		return current()
+	}
+
+	bc := &blockedClient{
+		btype:        BLOCKED_ACKS,
+		c:            c,
+		try:          try,
+		timeoutReply: current,
+		result:       make(chan *RESPValue, 1),
+	}
+	rs.clientsWaitingAcks = append(rs.clientsWaitingAcks, bc)
+	rs.mutex.Unlock()
+	return rs.blockClient(bc, timeout)
+}
+
+// blockClient 等待已经加入等待队列的 bc 被服务、超时或者客户端断开
+//
+// 等待期间让出命令锁和 propagateMu，阻塞的客户端不会挡住 EXEC 和其他写命令；
+// 命令由服务它的一方传播，自身不再传播。timeout 为 0 表示永久等待，超时返回 bc.timeoutReply。
+// 客户端在阻塞期间断开时从等待队列中移除，返回 nil。
+func (rs *RedisServer) blockClient(bc *blockedClient, timeout time.Duration) *RESPValue {
+	c := bc.c
+	c.preventPropagation()
+	if c.propagateLocked {
+		c.propagateLocked = false
+		rs.propagateMu.Unlock()
+	}
+	rs.execMu.RUnlock()
+	defer rs.execMu.RLock()
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	gone, stopWatch := c.watchDisconnect()
+	defer stopWatch()
+
+	timedOut := false
+	select {
+	case resp := <-bc.result:
+		return resp
+	case <-timer:
+		timedOut = true
+	case <-gone:
+		// 断开的客户端不再被服务，否则写入方为它取走的数据无人接收而丢失
+	}
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	// 超时或断开与被服务可能同时发生，以已经交付的结果为准
+	if bc.served {
+		return <-bc.result
+	}
+	rs.unblockClient(bc)
+	if !timedOut {
+		return nil
+	}
+	return bc.timeoutReply()
+}
+
+// watchDisconnect 在客户端阻塞期间监视连接，连接关闭（读到 EOF 或出错）时关闭返回的 gone
+//
+// 阻塞期间处理命令的 goroutine 不读取连接，这里用 Peek 代为读取：读到的数据留在 reader 的缓冲区中，
+// 客户端在阻塞期间以管道发送的命令在解除阻塞后照常执行；缓冲区满后不再监视。stop 结束监视，
+// 它返回之后处理命令的 goroutine 才能再次使用 reader。没有连接的伪客户端的 gone 永远不会关闭。
+func (c *client) watchDisconnect() (gone <-chan struct{}, stop func()) {
+	if c.conn == nil || c.reader == nil {
+		return nil, func() {}
+	}
+	goneCh := make(chan struct{})
+	done := make(chan struct{})
+	var stopping atomic.Bool
+	go func() {
+		defer close(done)
+		for n := c.reader.Buffered() + 1; n <= c.reader.Size(); n = c.reader.Buffered() + 1 {
+			if _, err := c.reader.Peek(n); err != nil {
+				// stop 设置的读取期限到期不是断开
+				if !stopping.Load() {
+					close(goneCh)
+				}
+				return
+			}
+		}
+	}()
+	return goneCh, func() {
+		stopping.Store(true)
+		c.conn.SetReadDeadline(time.Now())
+		<-done
+		c.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// unblockClient 将客户端从等待队列中移除（调用方需持有写锁）
+func (rs *RedisServer) unblockClient(bc *blockedClient) {
+	if bc.btype == BLOCKED_ACKS {
+		for i, other := range rs.clientsWaitingAcks {
+			if other == bc {
+				rs.clientsWaitingAcks = append(rs.clientsWaitingAcks[:i], rs.clientsWaitingAcks[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+	for _, key := range bc.keys {
+		queue := bc.db.blockedKeys[key]
+		for i, other := range queue {
+			if other == bc {
+				queue = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(bc.db.blockedKeys, key)
+		} else {
+			bc.db.blockedKeys[key] = queue
+		}
+	}
+}
+
+// signalKeyAsReady 标记键可能可以服务阻塞的客户端（调用方需持有写锁）
+func (rs *RedisServer) signalKeyAsReady(db *redisDb, key string) {
+	if len(db.blockedKeys[key]) == 0 {
+		return
+	}
+	rs.readyKeys[readyKey{db, key}] = struct{}{}
+	rs.hasReadyKeys.Store(true)
+}
+
+// handleClientsBlockedOnKeys 在命令执行后服务阻塞在就绪键上的客户端（调用方需持有 propagateMu 或命令写锁）
+//
+// 被服务的命令修改了数据集时，紧接着写入方的命令传播，传播的是阻塞客户端当前的命令。
+func (rs *RedisServer) handleClientsBlockedOnKeys() {
+	if !rs.hasReadyKeys.Load() {
+		return
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	// 服务过程中可能产生新的就绪键（例如 BLMOVE 推入目标列表），循环直到没有为止
+	for len(rs.readyKeys) > 0 {
+		ready := rs.readyKeys
+		rs.readyKeys = make(map[readyKey]struct{})
+
+		for rk := range ready {
+			// 按顺序逐个尝试：列表等数据被取走后，其余等待者的 try 会返回 nil 而继续等待；
+			// 流的读者互不影响，前面的等待者没有结果时后面的仍可能被服务
+			for _, bc := range append([]*blockedClient(nil), rk.db.blockedKeys[rk.key]...) {
+				if bc.served {
+					continue
+				}
+				// 与 runCommand 一样，写命令先删除它的键中已经过期的（例如 BLMOVE 的目标）
+				if cmd := lookupCommand(bc.c.current.Array[0].Str); cmd.flags&CMD_WRITE != 0 {
+					rs.expireCommandKeys(bc.c, cmd, bc.c.current)
+				}
+				before := rs.dirty.Load()
+				resp := bc.try()
+				if resp != nil && rs.dirty.Load() != before {
+					rs.alsoPropagate(bc.db.id, bc.c.propagateArgv())
+				}
+				rs.propagatePending()
+				if resp == nil {
+					continue
+				}
+				rs.unblockClient(bc)
+				bc.served = true
+				bc.result <- resp
+			}
+		}
+	}
+	rs.hasReadyKeys.Store(false)
+}
+
+// signalAcksReady 标记副本发来了 ACK 或者本地 AOF 完成了 fsync，等待的 WAIT 和 WAITAOF 可能可以返回
+//
+// 发出信号的一方在释放自己持有的锁之后调用 handleClientsWaitingAcks；serverCron 也会定期检查。
+func (rs *RedisServer) signalAcksReady() {
+	rs.hasAcksReady.Store(true)
+}
+
+// handleClientsWaitingAcks 按阻塞的先后顺序服务条件已经满足的 WAIT 和 WAITAOF
+//
+// 调用方不能持有服务器锁、replMu 和 aofMu：try 在写锁下读取复制和 AOF 的状态。
+func (rs *RedisServer) handleClientsWaitingAcks() {
+	if !rs.hasAcksReady.Swap(false) {
+		return
+	}
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	for _, bc := range append([]*blockedClient(nil), rs.clientsWaitingAcks...) {
+		resp := bc.try()
+		if resp == nil {
+			continue
+		}
+		rs.unblockClient(bc)
+		bc.served = true
+		bc.result <- resp
+	}
+}
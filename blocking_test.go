@@ -0,0 +1,102 @@
+package goredis
+
+import (
+	"testing"
+	"time"
+)
+
+// blockedOn 返回阻塞在 0 号数据库的键 key 上的客户端数量
+func (ts *testServer) blockedOn(key string) int {
+	return ts.blockedOnDb(0, key)
+}
+
+// blockedOnDb 返回阻塞在 id 号数据库的键 key 上的客户端数量
+func (ts *testServer) blockedOnDb(id int, key string) int {
+	ts.rs.mutex.RLock()
+	defer ts.rs.mutex.RUnlock()
+	return len(ts.rs.databases[id].blockedKeys[key])
+}
+
+func TestBlockingServedInFIFOOrder(t *testing.T) {
+	ts := startTestServer(t)
+	first, second, writer := ts.connect(t), ts.connect(t), ts.connect(t)
+
+	first.send("BLPOP", "q", "0")
+	waitFor(t, "first client to block", func() bool { return ts.blockedOn("q") == 1 })
+	second.send("BLPOP", "q", "0")
+	waitFor(t, "second client to block", func() bool { return ts.blockedOn("q") == 2 })
+
+	writer.mustDo("1", "RPUSH", "q", "a")
+	if got := replyString(first.read()); got != "[q a]" {
+		t.Fatalf("first waiter got %s", got)
+	}
+	writer.mustDo("1", "RPUSH", "q", "b")
+	if got := replyString(second.read()); got != "[q b]" {
+		t.Fatalf("second waiter got %s", got)
+	}
+}
+
+func TestBlockingTimeout(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	start := time.Now()
+	c.mustDo("(nil)", "BLPOP", "q", "0.1")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("BLPOP returned after %v", elapsed)
+	}
+	if n := ts.blockedOn("q"); n != 0 {
+		t.Fatalf("%d clients still blocked after timeout", n)
+	}
+}
+
+func TestBlockedMoveServesNextWaiter(t *testing.T) {
+	ts := startTestServer(t)
+	mover, popper, writer := ts.connect(t), ts.connect(t), ts.connect(t)
+
+	// BLMOVE 推入目标列表后，阻塞在目标列表上的客户端在同一轮中被服务
+	mover.send("BLMOVE", "src", "dst", "LEFT", "LEFT", "0")
+	waitFor(t, "mover to block", func() bool { return ts.blockedOn("src") == 1 })
+	popper.send("BRPOP", "dst", "0")
+	waitFor(t, "popper to block", func() bool { return ts.blockedOn("dst") == 1 })
+
+	writer.mustDo("1", "RPUSH", "src", "x")
+	if got := replyString(mover.read()); got != "x" {
+		t.Fatalf("BLMOVE got %s", got)
+	}
+	if got := replyString(popper.read()); got != "[dst x]" {
+		t.Fatalf("BRPOP got %s", got)
+	}
+	writer.mustDo("0", "LLEN", "dst")
+}
+
+func TestBlockedClientDisconnectDoesNotLoseData(t *testing.T) {
+	ts := startTestServer(t)
+	blocked, writer := ts.connect(t), ts.connect(t)
+
+	blocked.send("BLPOP", "q", "0")
+	waitFor(t, "client to block", func() bool { return ts.blockedOn("q") == 1 })
+	blocked.conn.Close()
+	waitFor(t, "disconnected client to be unblocked", func() bool { return ts.blockedOn("q") == 0 })
+
+	writer.mustDo("1", "RPUSH", "q", "x")
+	writer.mustDo("[x]", "LRANGE", "q", "0", "-1")
+}
+
+func TestBlockedClientPipelinedCommands(t *testing.T) {
+	ts := startTestServer(t)
+	blocked, writer := ts.connect(t), ts.connect(t)
+
+	// 阻塞期间到达的命令在解除阻塞后执行
+	blocked.send("BLMOVE", "src", "dst", "LEFT", "RIGHT", "0")
+	waitFor(t, "client to block", func() bool { return ts.blockedOn("src") == 1 })
+	blocked.send("LLEN", "dst")
+	time.Sleep(50 * time.Millisecond)
+
+	writer.mustDo("1", "RPUSH", "src", "x")
+	if got := replyString(blocked.read()); got != "x" {
+		t.Fatalf("BLMOVE got %s", got)
+	}
+	if got := replyString(blocked.read()); got != "1" {
+		t.Fatalf("pipelined LLEN got %s", got)
+	}
+}
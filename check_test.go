@@ -0,0 +1,85 @@
+package goredis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newCheckServer 返回 --check-rdb 和 --check-aof 使用的服务器，dir 为 dir
+func newCheckServer(t *testing.T, dir string) *RedisServer {
+	t.Helper()
+	rs := NewRedisServer("127.0.0.1", 0, 16)
+	if err := setDir(rs, dir); err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func TestCheckRdb(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("1", "RPUSH", "l", "x")
+	c.mustDo("OK", "SAVE")
+	path := filepath.Join(ts.dir, "dump.rdb")
+
+	// 省略文件名时检查 dir 下的 dbfilename
+	if code := newCheckServer(t, ts.dir).checkMain([]string{"--check-rdb"}); code != 0 {
+		t.Fatalf("--check-rdb exited with %d on a valid file", code)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := filepath.Join(ts.dir, "corrupt.rdb")
+	data[len(data)-1] ^= 0xFF
+	if err := os.WriteFile(corrupt, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := newCheckServer(t, ts.dir).checkMain([]string{"--check-rdb", corrupt}); code != 1 {
+		t.Fatalf("--check-rdb exited with %d on a bad checksum", code)
+	}
+	if code := newCheckServer(t, ts.dir).checkMain([]string{"--check-rdb", filepath.Join(ts.dir, "missing.rdb")}); code != 1 {
+		t.Fatalf("--check-rdb exited with %d on a missing file", code)
+	}
+}
+
+func TestCheckAof(t *testing.T) {
+	dir := testDir(t)
+	data, valid := truncatedAof()
+	path := filepath.Join(dir, "appendonly.aof")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不完整的文件只有指定 --fix 时才截断
+	if code := newCheckServer(t, dir).checkMain([]string{"--check-aof"}); code != 1 {
+		t.Fatalf("--check-aof exited with %d on a truncated file", code)
+	}
+	if got, _ := os.ReadFile(path); string(got) != data {
+		t.Fatal("--check-aof modified the file without --fix")
+	}
+	if code := newCheckServer(t, dir).checkMain([]string{"--check-aof", "--fix", path}); code != 0 {
+		t.Fatalf("--check-aof --fix exited with %d", code)
+	}
+	if got, _ := os.ReadFile(path); string(got) != data[:valid] {
+		t.Fatalf("--check-aof --fix left %q", got)
+	}
+	if code := newCheckServer(t, dir).checkMain([]string{"--check-aof"}); code != 0 {
+		t.Fatalf("--check-aof exited with %d on the fixed file", code)
+	}
+
+	// 格式错误不能自动修复
+	bad := filepath.Join(dir, "bad.aof")
+	if err := os.WriteFile(bad, []byte("*1\r\n$4\r\nPING\r\ngarbage\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := newCheckServer(t, dir).checkMain([]string{"--check-aof", "--fix", bad}); code != 1 {
+		t.Fatalf("--check-aof --fix exited with %d on a corrupt file", code)
+	}
+
+	if code := newCheckServer(t, dir).checkMain([]string{"--check-aof", "a.aof", "b.aof"}); code != 1 {
+		t.Fatalf("--check-aof exited with %d on extra arguments", code)
+	}
+}
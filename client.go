@@ -0,0 +1,375 @@
+package goredis
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 输出缓冲区限制区分的客户端类别
+const (
+	CLIENT_TYPE_NORMAL = iota
+	CLIENT_TYPE_REPLICA
+	CLIENT_TYPE_PUBSUB
+	CLIENT_TYPE_COUNT
+)
+
+// clientTypeNames 是各类别在 client-output-buffer-limit 配置中的名称
+var clientTypeNames = [CLIENT_TYPE_COUNT]string{"normal", "slave", "pubsub"}
+
+// clientTypeByName 按名称（不区分大小写）查找客户端类别，replica 是 slave 的别名，找不到时返回 -1
+func clientTypeByName(name string) int {
+	if strings.EqualFold(name, "replica") {
+		return CLIENT_TYPE_REPLICA
+	}
+	for class, typeName := range clientTypeNames {
+		if strings.EqualFold(name, typeName) {
+			return class
+		}
+	}
+	return -1
+}
+
+// clientBufferLimit 是一类客户端的输出缓冲区限制，hard 和 soft 为 0 表示不限制
+type clientBufferLimit struct {
+	hard        int64
+	soft        int64
+	softSeconds int64
+}
+
+// defaultClientOutputBufferLimits 是与 Redis 相同的默认限制
+var defaultClientOutputBufferLimits = [CLIENT_TYPE_COUNT]clientBufferLimit{
+	CLIENT_TYPE_NORMAL:  {0, 0, 0},
+	CLIENT_TYPE_REPLICA: {256 << 20, 64 << 20, 60},
+	CLIENT_TYPE_PUBSUB:  {32 << 20, 8 << 20, 60},
+}
+
+// client 保存一个客户端连接的状态
+type client struct {
+	id     int64
+	conn   net.Conn
+	reader *bufio.Reader // 读取命令的缓冲，客户端阻塞期间由 watchDisconnect 代为读取
+	server *RedisServer
+	db     *redisDb // 当前选择的数据库
+	name   string   // HELLO SETNAME 设置的连接名
+
+	// 事务状态：MULTI 之后的命令进入 multiQueue，排队时出错则 multiError 为 true，
+	// EXEC 以 EXECABORT 拒绝执行；inExec 在 EXEC 执行队列中的命令时为 true
+	multi      bool
+	multiQueue []multiCmd
+	multiError bool
+	inExec     bool
+
+	// ASKING 之后为 true，下一条命令（或者事务）可以访问本节点正在导入的槽
+	asking bool
+
+	// 执行事务时和脚本的伪客户端上为 true，阻塞命令不会阻塞
+	denyBlocking bool
+
+	// 执行主节点命令流的伪客户端上为 true，见 newMasterClient；replStream 是已经读取、
+	// 还没有计入复制偏移量的命令流，只由执行主节点命令的一方访问
+	master     bool
+	replStream []byte
+
+	// 作为副本连接到本节点时的同步状态，由 replMu 保护（见 replication.go）：
+	//   replState 是同步的进度，SLAVE_STATE_NONE 表示不是副本；replOldSync 表示以 SYNC
+	//   而不是 PSYNC 请求同步，不回复 +FULLRESYNC；replListeningPort、replIPAddress 和 replCapaEOF 来自 REPLCONF；
+	//   replCapaPsync2 表示副本支持 +CONTINUE 带上新的复制 ID；
+	//   replSnapshot 是全量同步使用的快照，replPsyncOffset 是它对应的复制偏移量；
+	//   replAckOff 是副本以 REPLCONF ACK 报告的最大复制偏移量，replAckTime 是最近一次 ACK 的时间
+	//   （等待 BGSAVE 开始时是请求同步的时间）；replAofOff 是副本以 ACK 后面的 FACK 报告的、
+	//   已经 fsync 到它的 AOF 中的最大复制偏移量，副本没有开启 AOF 时为 0；replWaitAck 表示无盘复制的快照已经发送完，
+	//   等待副本的第一个 ACK 之后开始发送命令流
+	replState         int
+	replOldSync       bool
+	replListeningPort int
+	replIPAddress     string
+	replCapaEOF       bool
+	replCapaPsync2    bool
+	replSnapshot      *replSnapshot
+	replPsyncOffset   int64
+	replAckOff        int64
+	replAckTime       time.Time
+	replAofOff        int64
+	replWaitAck       bool
+
+	// WATCH 的键，以及其中是否有键在 EXEC 之前被修改，由服务器写锁保护
+	watchedKeys []watchedKey
+	dirtyCAS    bool
+
+	// 命令传播的状态，只由执行命令的一方访问（见 RedisServer.runCommand）：
+	//   current 是正在执行的命令（阻塞期间由服务它的一方读取），rewrittenArgv 是为了让重放得到相同结果而改写的传播参数，
+	//   nil 表示按原样传播；preventPropagate 表示命令不按自身传播，例如已经用 alsoPropagate
+	//   传播了等价的命令，或者阻塞后由写入方代为执行并传播；
+	//   propagateLocked 表示 call 正为这条写命令持有 propagateMu，阻塞时释放。
+	current          *RESPValue
+	rewrittenArgv    []string
+	preventPropagate bool
+	propagateLocked  bool
+
+	// 发布者所在的 goroutine 也会向订阅者发送消息。回复先追加到输出缓冲区，
+	// 再由 writeLoop 写入连接，发布者不会因为订阅者不读数据而阻塞。
+	// 以下字段都由 writeMu 保护：
+	//   resp 是 HELLO 协商的协议版本，决定回复的编码方式；
+	//   pubsub 表示客户端是否有订阅，决定适用哪一类输出缓冲区限制；
+	//   obufSize 是尚未写入连接的字节数，包括正在写入的部分；
+	//   obufSoftLimitReachedTime 是缓冲区开始持续超过软限制的时间；
+	//   closing 之后不再接受新的回复，写完剩余数据后 writeLoop 退出；
+	//   replyOff 和 replySkip 由 CLIENT REPLY 设置，为 true 时丢弃回复，
+	//   replySkipNext 表示跳过下一条命令的回复；
+	//   replica 表示连接是副本，适用 slave 类的输出缓冲区限制；全量同步的 RDB 发送完之前
+	//   replHold 为 true，命令流暂存在 replBuf（计入 obufSize），replBulk 是等待发送的 RDB
+	//   （磁盘方式是内存中的 RDB，无盘复制是读取后台保存的数据的管道）。
+	writeMu                  sync.Mutex
+	writeCond                *sync.Cond
+	resp                     int
+	pubsub                   bool
+	obuf                     []byte
+	obufSize                 int64
+	obufSoftLimitReachedTime time.Time
+	closing                  bool
+	replyOff                 bool
+	replySkip                bool
+	replySkipNext            bool
+	replica                  bool
+	replHold                 bool
+	replBuf                  []byte
+	replBulk                 io.Reader
+	writerDone               chan struct{}
+
+	// 订阅的频道、模式和分片频道，由 pubsubMu 保护
+	pubsubChannels      map[string]struct{}
+	pubsubPatterns      map[string]struct{}
+	pubsubShardChannels map[string]struct{}
+}
+
+// newClient 创建新连接对应的客户端并启动 writeLoop，默认使用 0 号数据库和 RESP2 协议
+func newClient(rs *RedisServer, conn net.Conn) *client {
+	c := &client{
+		id:                  rs.lastClientID.Add(1),
+		conn:                conn,
+		reader:              bufio.NewReader(conn),
+		server:              rs,
+		db:                  rs.databases[0],
+		resp:                RESP2,
+		writerDone:          make(chan struct{}),
+		pubsubChannels:      make(map[string]struct{}),
+		pubsubPatterns:      make(map[string]struct{}),
+		pubsubShardChannels: make(map[string]struct{}),
+	}
+	c.writeCond = sync.NewCond(&c.writeMu)
+	go c.writeLoop()
+	return c
+}
+
+// write 把一个回复追加到输出缓冲区，超过输出缓冲区限制时断开连接
+func (c *client) write(resp *RESPValue) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closing || c.replyOff || c.replySkip {
+		return
+	}
+	c.appendOutput(resp.SerializeRESPProto(c.resp), false)
+}
+
+// writeRaw 把已经编码的数据追加到输出缓冲区，用于向副本发送的换行和命令流
+//
+// stream 为 true 时是复制的命令流，全量同步的 RDB 发送完之前暂存起来，之后再发送。
+func (c *client) writeRaw(data []byte, stream bool) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closing {
+		return
+	}
+	c.appendOutput(data, stream && c.replHold)
+}
+
+// appendOutput 追加要发送的数据，hold 为 true 时追加到 replBuf，超过输出缓冲区限制时断开连接
+// （调用方需持有 writeMu）
+func (c *client) appendOutput(data []byte, hold bool) {
+	if hold {
+		c.replBuf = append(c.replBuf, data...)
+	} else {
+		c.obuf = append(c.obuf, data...)
+	}
+	c.obufSize += int64(len(data))
+	if c.outputBufferLimitReached() {
+		log.Printf("Client id=%d addr=%s closed for overcoming of output buffer limits.", c.id, c.conn.RemoteAddr())
+		c.closing = true
+		c.obuf, c.replBuf = nil, nil
+		c.dropReplBulk()
+		// 关闭连接让阻塞在写入上的 writeLoop 和读取命令的 goroutine 都立即返回
+		c.conn.Close()
+	}
+	c.writeCond.Signal()
+}
+
+// outputBufferLimitReached 判断输出缓冲区是否超过了客户端所属类别的限制（调用方需持有 writeMu）
+//
+// 超过硬限制立即断开；超过软限制时开始计时，持续超过 softSeconds 秒后断开，
+// 期间缓冲区降到软限制以下则重新计时。
+func (c *client) outputBufferLimitReached() bool {
+	class := CLIENT_TYPE_NORMAL
+	if c.replica {
+		class = CLIENT_TYPE_REPLICA
+	} else if c.pubsub {
+		class = CLIENT_TYPE_PUBSUB
+	}
+	limit := c.server.clientOutputBufferLimits.Load()[class]
+
+	if limit.hard > 0 && c.obufSize >= limit.hard {
+		return true
+	}
+	if limit.soft == 0 || c.obufSize < limit.soft {
+		c.obufSoftLimitReachedTime = time.Time{}
+		return false
+	}
+	now := time.Now()
+	if c.obufSoftLimitReachedTime.IsZero() {
+		c.obufSoftLimitReachedTime = now
+		return false
+	}
+	return now.Sub(c.obufSoftLimitReachedTime) > time.Duration(limit.softSeconds)*time.Second
+}
+
+// writeLoop 把输出缓冲区中的数据写入连接，直到客户端关闭或写入出错
+//
+// 副本全量同步的 RDB 在之前的回复写完之后发送，发送完毕后副本开始接收暂存的命令流。
+func (c *client) writeLoop() {
+	defer close(c.writerDone)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	for {
+		for len(c.obuf) == 0 && c.replBulk == nil && !c.closing {
+			c.writeCond.Wait()
+		}
+		if len(c.obuf) == 0 && (c.replBulk == nil || c.closing) {
+			c.dropReplBulk()
+			return
+		}
+		if len(c.obuf) == 0 {
+			bulk := c.replBulk
+			c.replBulk = nil
+			c.writeMu.Unlock()
+			_, err := io.Copy(c.conn, bulk)
+			if err == nil {
+				c.server.replicationBulkSent(c)
+			}
+			c.writeMu.Lock()
+			if err != nil {
+				closeReplBulk(bulk)
+				c.closing = true
+				c.obuf, c.replBuf = nil, nil
+				return
+			}
+			continue
+		}
+		buf := c.obuf
+		c.obuf = nil
+
+		c.writeMu.Unlock()
+		_, err := c.conn.Write(buf)
+		c.writeMu.Lock()
+
+		c.obufSize -= int64(len(buf))
+		if err != nil {
+			c.closing = true
+			c.obuf = nil
+			return
+		}
+	}
+}
+
+// dropReplBulk 丢弃等待发送的 RDB（调用方需持有 writeMu）
+func (c *client) dropReplBulk() {
+	closeReplBulk(c.replBulk)
+	c.replBulk = nil
+}
+
+// closeReplBulk 在不再发送 RDB 时调用，无盘复制时关闭管道，后台保存不再等待这个副本
+func closeReplBulk(bulk io.Reader) {
+	if closer, ok := bulk.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// close 停止接受新的回复，等输出缓冲区中已有的数据写完后关闭连接
+func (c *client) close() {
+	c.writeMu.Lock()
+	c.closing = true
+	c.writeCond.Signal()
+	c.writeMu.Unlock()
+
+	<-c.writerDone
+	c.conn.Close()
+}
+
+// setProtocol 切换客户端使用的协议版本
+func (c *client) setProtocol(proto int) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.resp = proto
+}
+
+// setPubSub 记录客户端是否有订阅，有订阅的客户端适用 pubsub 类的输出缓冲区限制
+func (c *client) setPubSub(pubsub bool) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.pubsub = pubsub
+}
+
+// afterCommand 在每条命令执行完之后调用，CLIENT REPLY SKIP 只跳过它之后的一条命令的回复
+func (c *client) afterCommand() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.replySkip = c.replySkipNext
+	c.replySkipNext = false
+}
+
+// handleClient 处理 CLIENT 命令，目前支持 REPLY 子命令
+func (rs *RedisServer) handleClient(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "REPLY":
+		if len(args) != 2 {
+			return wrongArgsError("client|reply")
+		}
+		return c.setReplyMode(args[1])
+	default:
+		return NewErrorValue("ERR unknown subcommand '" + args[0] + "'. Try CLIENT HELP.")
+	}
+}
+
+// setReplyMode 处理 CLIENT REPLY ON|OFF|SKIP
+//
+// OFF 之后不再回复，直到 CLIENT REPLY ON；SKIP 跳过下一条命令的回复。OFF 和 SKIP
+// 本身也没有回复，期间推送的发布订阅消息同样被丢弃。
+func (c *client) setReplyMode(mode string) *RESPValue {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	switch strings.ToUpper(mode) {
+	case "ON":
+		c.replyOff = false
+		c.replySkipNext = false
+		return NewSimpleStringValue("OK")
+	case "OFF":
+		c.replyOff = true
+		return nil
+	case "SKIP":
+		if !c.replyOff {
+			c.replySkipNext = true
+		}
+		return nil
+	default:
+		return NewErrorValue("ERR syntax error")
+	}
+}
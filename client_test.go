@@ -0,0 +1,89 @@
+package goredis
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientOutputBufferLimitConfig(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[client-output-buffer-limit normal 0 0 0 slave 268435456 67108864 60 pubsub 33554432 8388608 60]",
+		"CONFIG", "GET", "client-output-buffer-limit")
+	// 只修改出现的类别，replica 是 slave 的别名
+	c.mustDo("OK", "CONFIG", "SET", "client-output-buffer-limit", "pubsub 1mb 512kb 10 replica 1k 0 0")
+	c.mustDo("[client-output-buffer-limit normal 0 0 0 slave 1000 0 0 pubsub 1048576 524288 10]",
+		"CONFIG", "GET", "client-output-buffer-limit")
+	for _, value := range []string{"pubsub 1mb 1mb", "master 0 0 0", "normal 1x 0 0", "normal 0 0 -1"} {
+		if got := replyString(c.do("CONFIG", "SET", "client-output-buffer-limit", value)); !strings.HasPrefix(got, "(error)") {
+			t.Fatalf("CONFIG SET client-output-buffer-limit %q returned %s", value, got)
+		}
+	}
+}
+
+func TestOutputBufferSoftLimit(t *testing.T) {
+	rs := NewRedisServer("127.0.0.1", 0, 1)
+	rs.clientOutputBufferLimits.Store(&[CLIENT_TYPE_COUNT]clientBufferLimit{
+		CLIENT_TYPE_PUBSUB: {hard: 1000, soft: 100, softSeconds: 1},
+	})
+	c := &client{server: rs, obufSize: 500}
+	// 普通客户端不受 pubsub 类的限制
+	if c.outputBufferLimitReached() {
+		t.Fatal("normal client should not be limited")
+	}
+	c.pubsub = true
+	if c.outputBufferLimitReached() || c.obufSoftLimitReachedTime.IsZero() {
+		t.Fatal("soft limit should start the timer without closing the client")
+	}
+	c.obufSoftLimitReachedTime = time.Now().Add(-2 * time.Second)
+	if !c.outputBufferLimitReached() {
+		t.Fatal("soft limit exceeded for longer than soft seconds")
+	}
+	// 降到软限制以下后重新计时
+	c.obufSize = 50
+	if c.outputBufferLimitReached() || !c.obufSoftLimitReachedTime.IsZero() {
+		t.Fatal("dropping below the soft limit should reset the timer")
+	}
+	c.obufSize = 1000
+	if !c.outputBufferLimitReached() {
+		t.Fatal("hard limit should close the client immediately")
+	}
+}
+
+func TestSlowSubscriberIsDisconnected(t *testing.T) {
+	ts := startTestServer(t)
+	sub, pub := ts.connect(t), ts.connect(t)
+	pub.mustDo("OK", "CONFIG", "SET", "client-output-buffer-limit", "pubsub 1kb 0 0")
+	sub.mustDo("[subscribe ch 1]", "SUBSCRIBE", "ch")
+	pub.mustDo("1", "PUBLISH", "ch", "small")
+	// 超过硬限制的消息让订阅者被断开，发布者不受影响
+	pub.mustDo("1", "PUBLISH", "ch", strings.Repeat("x", 2048))
+	// 断开时尚未写出的消息被丢弃，这里只读到连接关闭为止
+	sub.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.Copy(io.Discard, sub.reader); err != nil {
+		t.Fatalf("expected the subscriber to be disconnected, got %v", err)
+	}
+	waitFor(t, "the subscription to be removed", func() bool {
+		return replyString(pub.do("PUBSUB", "NUMSUB", "ch")) == "[ch 0]"
+	})
+	pub.mustDo("0", "PUBLISH", "ch", "after")
+}
+
+func TestClientReply(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	// OFF 和 SKIP 本身没有回复，下一条收到的回复是 ON 的 OK
+	c.send("CLIENT", "REPLY", "OFF")
+	c.send("SET", "a", "1")
+	c.send("GET", "a")
+	c.mustDo("OK", "CLIENT", "REPLY", "ON")
+	c.mustDo("1", "GET", "a")
+
+	c.send("CLIENT", "REPLY", "SKIP")
+	c.send("SET", "b", "2")
+	c.mustDo("2", "GET", "b")
+	c.mustDo("(error) ERR syntax error", "CLIENT", "REPLY", "MAYBE")
+	c.mustDo("(error) ERR unknown subcommand 'NOPE'. Try CLIENT HELP.", "CLIENT", "NOPE")
+}
@@ -0,0 +1,1173 @@
+package goredis
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CLUSTER_SLOTS 是集群的哈希槽数量
+const CLUSTER_SLOTS = 16384
+
+// 集群的状态：所有需要的槽都有节点负责时为 CLUSTER_OK
+const (
+	CLUSTER_OK = iota
+	CLUSTER_FAIL
+)
+
+// 集群节点的标志
+const (
+	CLUSTER_NODE_MASTER    = 1 << iota // 主节点
+	CLUSTER_NODE_MYSELF                // 本节点
+	CLUSTER_NODE_PFAIL                 // 超过 cluster-node-timeout 没有回复，可能已经下线
+	CLUSTER_NODE_HANDSHAKE             // CLUSTER MEET 或者其他节点介绍的新节点，还没有第一次回复
+)
+
+// clusterNodeFlagNames 是节点标志在 nodes.conf 中的名称，按输出的顺序排列
+var clusterNodeFlagNames = []struct {
+	flag int
+	name string
+}{
+	{CLUSTER_NODE_MYSELF, "myself"},
+	{CLUSTER_NODE_MASTER, "master"},
+	{CLUSTER_NODE_PFAIL, "fail?"},
+	{CLUSTER_NODE_HANDSHAKE, "handshake"},
+}
+
+// 命令不能在本节点执行的原因，见 getNodeByQuery
+const (
+	CLUSTER_REDIR_NONE          = iota // 可以在本节点执行
+	CLUSTER_REDIR_CROSS_SLOT           // 键不在同一个槽中
+	CLUSTER_REDIR_DOWN_STATE           // 集群下线
+	CLUSTER_REDIR_DOWN_RO_STATE        // 集群下线，只接受读命令
+	CLUSTER_REDIR_DOWN_UNBOUND         // 槽没有节点负责
+	CLUSTER_REDIR_UNSTABLE             // 槽正在迁移，多个键中只有一部分在本节点
+	CLUSTER_REDIR_ASK                  // 槽正在迁移，键已经不在本节点
+	CLUSTER_REDIR_MOVED                // 槽由其他节点负责
+)
+
+// crc16Table 是 CRC16/XMODEM（多项式 0x1021）的查找表
+var crc16Table = makeCRC16Table()
+
+// makeCRC16Table 计算 crc16Table
+func makeCRC16Table() *[256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return &table
+}
+
+// crc16 计算与 Redis 集群相同的 CRC16/XMODEM 校验和
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// keyHashSlot 返回键所在的哈希槽
+//
+// 键中含有 {...} 且括号之间不为空时只计算第一对括号中的部分（哈希标签），
+// 因此 {user1000}.following 和 {user1000}.followers 在同一个槽中。
+func keyHashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) & (CLUSTER_SLOTS - 1))
+}
+
+// clusterNode 是集群中的一个节点
+//
+// name 是 40 个十六进制字符的节点 ID，ip 和 port 是客户端连接的地址，本节点还不知道自己的地址时
+// ip 为空；configEpoch 是节点声明它负责的槽时使用的配置纪元，slots 是它负责的槽的位图。
+// 其他节点的 ctime 是加入的时间，pingSent 是发出的还没有回复的 CLUSTER GOSSIP 的时间（没有时为零值），
+// pongReceived 是最近一次收到回复的时间，linkConnected 表示到它的连接是否建立（见 clusterLinkLoop）。
+type clusterNode struct {
+	name          string
+	ip            string
+	port          int
+	flags         int
+	configEpoch   uint64
+	slots         [CLUSTER_SLOTS / 8]byte
+	numSlots      int
+	ctime         time.Time
+	pingSent      time.Time
+	pongReceived  time.Time
+	linkConnected bool
+}
+
+// hasSlot 判断节点是否负责槽 slot
+func (n *clusterNode) hasSlot(slot int) bool {
+	return n.slots[slot/8]&(1<<(slot%8)) != 0
+}
+
+// setSlot 在节点的位图中加入槽 slot
+func (n *clusterNode) setSlot(slot int) {
+	if !n.hasSlot(slot) {
+		n.slots[slot/8] |= 1 << (slot % 8)
+		n.numSlots++
+	}
+}
+
+// clearSlot 从节点的位图中去掉槽 slot
+func (n *clusterNode) clearSlot(slot int) {
+	if n.hasSlot(slot) {
+		n.slots[slot/8] &^= 1 << (slot % 8)
+		n.numSlots--
+	}
+}
+
+// clusterState 是本节点看到的集群状态，由服务器的 clusterMu 保护
+//
+// slots 记录每个槽由哪个节点负责，没有节点负责时为 nil；migratingSlotsTo 和 importingSlotsFrom
+// 是 CLUSTER SETSLOT 设置的正在迁出到和迁入自哪个节点的槽。currentEpoch 和 lastVoteEpoch
+// 与节点的配置一起保存在 configPath 指向的 nodes.conf 中，重启后恢复。statsMessagesSent 和
+// statsMessagesReceived 是按类型统计的发出和收到的 CLUSTER GOSSIP 消息数量，见 CLUSTER INFO。
+type clusterState struct {
+	myself             *clusterNode
+	nodes              map[string]*clusterNode
+	slots              [CLUSTER_SLOTS]*clusterNode
+	migratingSlotsTo   [CLUSTER_SLOTS]*clusterNode
+	importingSlotsFrom [CLUSTER_SLOTS]*clusterNode
+	currentEpoch       uint64
+	lastVoteEpoch      uint64
+	state              int
+	configPath         string
+
+	statsMessagesSent     [CLUSTERMSG_TYPE_COUNT]uint64
+	statsMessagesReceived [CLUSTERMSG_TYPE_COUNT]uint64
+}
+
+// clusterInit 在启动时加载 cluster-config-file，没有时以新的节点 ID 创建并保存
+//
+// 集群模式下只能使用 0 号数据库，也不能通过 replicaof 配置成为副本。
+func (rs *RedisServer) clusterInit() error {
+	if rs.masterHost != "" {
+		return errors.New("replicaof directive not allowed in cluster mode")
+	}
+	cs := &clusterState{
+		nodes:      make(map[string]*clusterNode),
+		state:      CLUSTER_FAIL,
+		configPath: filepath.Join(rs.dir, rs.clusterConfigFile),
+	}
+	rs.cluster = cs
+
+	data, err := rs.persister.ReadSnapshot(cs.configPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		cs.myself = &clusterNode{name: newReplid(), port: rs.port, flags: CLUSTER_NODE_MYSELF | CLUSTER_NODE_MASTER}
+		if !isWildcardAddr(rs.host) {
+			cs.myself.ip = rs.host
+		}
+		cs.nodes[cs.myself.name] = cs.myself
+		log.Printf("No cluster configuration found, I'm %s", cs.myself.name)
+	case err != nil:
+		return fmt.Errorf("Unable to read the cluster config file %s: %v", cs.configPath, err)
+	default:
+		if err := cs.loadConfig(data); err != nil {
+			return fmt.Errorf("Unrecoverable error: corrupted cluster config file %s: %v", cs.configPath, err)
+		}
+		// 端口以启动参数为准
+		cs.myself.port = rs.port
+		log.Printf("Node configuration loaded, I'm %.40s", cs.myself.name)
+	}
+	rs.clusterUpdateState()
+	return rs.clusterSaveConfig()
+}
+
+// isWildcardAddr 判断监听地址是否是所有网卡的通配地址，这时无法从中得知本节点的地址
+func isWildcardAddr(host string) bool {
+	ip := net.ParseIP(host)
+	return host == "" || (ip != nil && ip.IsUnspecified())
+}
+
+// clusterVerifyConfigWithData 在加载数据之后检查数据与集群配置是否一致
+//
+// 只有 0 号数据库可以有数据。键所在的槽还没有节点负责时由本节点负责，
+// 否则这些键既不能访问也不会被迁移走。
+func (rs *RedisServer) clusterVerifyConfigWithData() error {
+	for _, db := range rs.databases[1:] {
+		if db.store.Len() > 0 {
+			return errors.New("You can't have keys in a DB different than DB 0 when in Cluster mode. Exiting.")
+		}
+	}
+	cs := rs.cluster
+	claimed := false
+	rs.databases[0].store.ForEach(func(key string, obj *RedisObject) {
+		slot := keyHashSlot(key)
+		if cs.slots[slot] == nil {
+			log.Printf("I have keys for unassigned slot %d. Taking responsibility for it.", slot)
+			cs.addSlot(cs.myself, slot)
+			claimed = true
+		}
+	})
+	if !claimed {
+		return nil
+	}
+	rs.clusterUpdateState()
+	return rs.clusterSaveConfig()
+}
+
+// addSlot 让节点 n 负责槽 slot（调用方需持有 clusterMu）
+func (cs *clusterState) addSlot(n *clusterNode, slot int) {
+	if old := cs.slots[slot]; old != nil {
+		old.clearSlot(slot)
+	}
+	cs.slots[slot] = n
+	n.setSlot(slot)
+}
+
+// delSlot 让槽 slot 不再由任何节点负责（调用方需持有 clusterMu）
+func (cs *clusterState) delSlot(slot int) {
+	if n := cs.slots[slot]; n != nil {
+		n.clearSlot(slot)
+		cs.slots[slot] = nil
+	}
+}
+
+// clusterUpdateState 根据槽的分配重新计算集群的状态（调用方需持有 clusterMu）
+//
+// cluster-require-full-coverage 为 yes 时，有槽没有节点负责集群就下线，拒绝所有涉及键的命令；
+// 为 no 时集群总是在线，只拒绝访问没有节点负责的槽的命令。
+func (rs *RedisServer) clusterUpdateState() {
+	cs := rs.cluster
+	state := CLUSTER_OK
+	if rs.clusterRequireFullCoverage {
+		for _, n := range cs.slots {
+			if n == nil {
+				state = CLUSTER_FAIL
+				break
+			}
+		}
+	}
+	if state != cs.state {
+		cs.state = state
+		if state == CLUSTER_OK {
+			log.Printf("Cluster state changed: ok")
+		} else {
+			log.Printf("Cluster state changed: fail")
+		}
+	}
+}
+
+// clusterSaveConfig 把节点和纪元以 Redis 的 nodes.conf 格式原子地写入配置文件（调用方需持有 clusterMu）
+func (rs *RedisServer) clusterSaveConfig() error {
+	cs := rs.cluster
+	err := rs.persister.WriteSnapshot(cs.configPath, func(w io.Writer) error {
+		var b strings.Builder
+		for _, n := range cs.nodes {
+			if n.flags&CLUSTER_NODE_HANDSHAKE != 0 {
+				continue
+			}
+			b.WriteString(cs.genNodeDescription(n))
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "vars currentEpoch %d lastVoteEpoch %d\n", cs.currentEpoch, cs.lastVoteEpoch)
+		_, err := io.WriteString(w, b.String())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Fatal: can't update cluster config file %s: %v", cs.configPath, err)
+	}
+	return nil
+}
+
+// clusterSaveConfigOrLog 保存集群配置，失败时记录日志（调用方需持有 clusterMu）
+func (rs *RedisServer) clusterSaveConfigOrLog() {
+	if err := rs.clusterSaveConfig(); err != nil {
+		log.Print(err)
+	}
+}
+
+// genNodeDescription 生成节点在 nodes.conf 中的一行（调用方需持有 clusterMu）
+//
+// 格式与 Redis 相同：<id> <ip:port@cport> <flags> <master> <ping-sent> <pong-recv> <config-epoch>
+// <link-state> <slot> ...，槽按连续的区间输出，本节点的行最后是 [slot->-id] 和 [slot-<-id] 形式的
+// 正在迁出和迁入的槽。集群总线端口总是客户端端口加 10000。
+func (cs *clusterState) genNodeDescription(n *clusterNode) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s:%d@%d ", n.name, n.ip, n.port, n.port+10000)
+	var flags []string
+	for _, f := range clusterNodeFlagNames {
+		if n.flags&f.flag != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	if len(flags) == 0 {
+		flags = append(flags, "noflags")
+	}
+	b.WriteString(strings.Join(flags, ","))
+	linkState := "disconnected"
+	if n == cs.myself || n.linkConnected {
+		linkState = "connected"
+	}
+	fmt.Fprintf(&b, " - %d %d %d %s", unixMilliOrZero(n.pingSent), unixMilliOrZero(n.pongReceived), n.configEpoch, linkState)
+	for _, r := range n.slotRanges() {
+		if r[0] == r[1] {
+			fmt.Fprintf(&b, " %d", r[0])
+		} else {
+			fmt.Fprintf(&b, " %d-%d", r[0], r[1])
+		}
+	}
+	if n == cs.myself {
+		for slot := 0; slot < CLUSTER_SLOTS; slot++ {
+			if to := cs.migratingSlotsTo[slot]; to != nil {
+				fmt.Fprintf(&b, " [%d->-%s]", slot, to.name)
+			} else if from := cs.importingSlotsFrom[slot]; from != nil {
+				fmt.Fprintf(&b, " [%d-<-%s]", slot, from.name)
+			}
+		}
+	}
+	return b.String()
+}
+
+// unixMilliOrZero 返回时间的 Unix 毫秒数，零值返回 0
+func unixMilliOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// slotRanges 把节点负责的槽合并为连续的区间 [start, end]
+func (n *clusterNode) slotRanges() [][2]int {
+	var ranges [][2]int
+	start := -1
+	for slot := 0; slot <= CLUSTER_SLOTS; slot++ {
+		if slot < CLUSTER_SLOTS && n.hasSlot(slot) {
+			if start == -1 {
+				start = slot
+			}
+			continue
+		}
+		if start != -1 {
+			ranges = append(ranges, [2]int{start, slot - 1})
+			start = -1
+		}
+	}
+	return ranges
+}
+
+// loadConfig 解析 nodes.conf 的内容
+func (cs *clusterState) loadConfig(data []byte) error {
+	var migrations []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "vars" {
+			for i := 1; i+1 < len(fields); i += 2 {
+				v, err := strconv.ParseUint(fields[i+1], 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid value for %s", fields[i])
+				}
+				switch fields[i] {
+				case "currentEpoch":
+					cs.currentEpoch = v
+				case "lastVoteEpoch":
+					cs.lastVoteEpoch = v
+				}
+			}
+			continue
+		}
+		if len(fields) < 8 {
+			return errors.New("too few fields in a node line")
+		}
+		n, err := parseNodeLine(fields)
+		if err != nil {
+			return err
+		}
+		n.ctime = time.Now()
+		cs.nodes[n.name] = n
+		if n.flags&CLUSTER_NODE_MYSELF != 0 {
+			if cs.myself != nil {
+				return errors.New("more than one node flagged as myself")
+			}
+			cs.myself = n
+		}
+		for _, r := range fields[8:] {
+			if strings.HasPrefix(r, "[") {
+				migrations = append(migrations, r)
+				continue
+			}
+			start, end, err := parseSlotRange(r)
+			if err != nil {
+				return err
+			}
+			for slot := start; slot <= end; slot++ {
+				cs.addSlot(n, slot)
+			}
+		}
+	}
+	if cs.myself == nil {
+		return errors.New("no node flagged as myself")
+	}
+	// 正在迁移的槽引用的节点可能在后面的行中，最后再解析
+	for _, m := range migrations {
+		slotStr, id, importing := strings.Cut(strings.Trim(m, "[]"), "-<-")
+		if !importing {
+			var ok bool
+			if slotStr, id, ok = strings.Cut(strings.Trim(m, "[]"), "->-"); !ok {
+				return fmt.Errorf("invalid slot migration %q", m)
+			}
+		}
+		slot, err := strconv.Atoi(slotStr)
+		n := cs.nodes[id]
+		if err != nil || slot < 0 || slot >= CLUSTER_SLOTS || n == nil {
+			return fmt.Errorf("invalid slot migration %q", m)
+		}
+		if importing {
+			cs.importingSlotsFrom[slot] = n
+		} else {
+			cs.migratingSlotsTo[slot] = n
+		}
+	}
+	return nil
+}
+
+// parseNodeLine 解析 nodes.conf 中一行的前八个字段，不包括槽
+func parseNodeLine(fields []string) (*clusterNode, error) {
+	n := &clusterNode{name: fields[0]}
+	if len(n.name) != 40 {
+		return nil, fmt.Errorf("invalid node name %q", n.name)
+	}
+	addr, _, _ := strings.Cut(fields[1], ",")
+	addr, _, _ = strings.Cut(addr, "@")
+	colon := strings.LastIndexByte(addr, ':')
+	if colon < 0 {
+		return nil, fmt.Errorf("invalid address %q", fields[1])
+	}
+	port, err := strconv.Atoi(addr[colon+1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q", fields[1])
+	}
+	n.ip, n.port = addr[:colon], port
+	for _, name := range strings.Split(fields[2], ",") {
+		for _, f := range clusterNodeFlagNames {
+			if f.name == name {
+				n.flags |= f.flag
+			}
+		}
+	}
+	if n.configEpoch, err = strconv.ParseUint(fields[6], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid config epoch %q", fields[6])
+	}
+	return n, nil
+}
+
+// parseSlotRange 解析 nodes.conf 中的一个槽或槽区间
+func parseSlotRange(s string) (int, int, error) {
+	startStr, endStr, isRange := strings.Cut(s, "-")
+	start, err := strconv.Atoi(startStr)
+	end := start
+	if err == nil && isRange {
+		end, err = strconv.Atoi(endStr)
+	}
+	if err != nil || start < 0 || end >= CLUSTER_SLOTS || start > end {
+		return 0, 0, fmt.Errorf("invalid slot range %q", s)
+	}
+	return start, end, nil
+}
+
+// getNodeByQuery 找出应该执行命令的节点，返回节点、键所在的槽和不能在本节点执行的原因
+//
+// 与 Redis 的规则相同：命令（EXEC 则是事务中排队的所有命令）的键必须都在同一个槽中，槽要有节点负责，
+// 集群也要在线，集群下线时 cluster-allow-reads-when-down 为 yes 仍然执行读命令。槽由其他节点负责时
+// 返回 MOVED。槽正在迁出时，键都还在本节点则在本节点执行，都已经不在时返回 ASK 让客户端到目标节点
+// 执行，只有一部分在本节点时返回 TRYAGAIN；槽正在迁入时，只有 ASKING 之后的命令在本节点执行，
+// 其中多个键的命令在键都已经迁入之前同样返回 TRYAGAIN。没有键的命令总是在本节点执行，这时返回的槽为 -1。
+func (rs *RedisServer) getNodeByQuery(c *client, cmd *redisCommand, command *RESPValue) (*clusterNode, int, int) {
+	cmds := []multiCmd{{cmd: cmd, command: command}}
+	write := cmd.flags&CMD_WRITE != 0
+	if cmd.name == "exec" {
+		cmds = c.multiQueue
+		write = c.multiHasWrite()
+	}
+
+	// 槽正在迁移时需要检查键是否还在本节点
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	rs.clusterMu.RLock()
+	defer rs.clusterMu.RUnlock()
+	cs := rs.cluster
+	var n *clusterNode
+	slot := -1
+	migrating, importing, multipleKeys := false, false, false
+	missingKeys, existingKeys := 0, 0
+	for _, mc := range cmds {
+		for _, key := range commandKeys(mc.cmd, mc.command.Array) {
+			s := keyHashSlot(key)
+			if slot == -1 {
+				slot = s
+				if n = cs.slots[s]; n == nil {
+					return nil, slot, CLUSTER_REDIR_DOWN_UNBOUND
+				}
+				if n == cs.myself && cs.migratingSlotsTo[s] != nil {
+					migrating = true
+				} else if cs.importingSlotsFrom[s] != nil {
+					importing = true
+				}
+			} else if s != slot {
+				return nil, slot, CLUSTER_REDIR_CROSS_SLOT
+			} else {
+				multipleKeys = true
+			}
+			if migrating || importing {
+				if rs.databases[0].store.Get(key) == nil {
+					missingKeys++
+				} else {
+					existingKeys++
+				}
+			}
+		}
+	}
+	if n == nil {
+		return cs.myself, slot, CLUSTER_REDIR_NONE
+	}
+	if cs.state != CLUSTER_OK {
+		if !rs.clusterAllowReadsWhenDown {
+			return nil, slot, CLUSTER_REDIR_DOWN_STATE
+		}
+		if write {
+			return nil, slot, CLUSTER_REDIR_DOWN_RO_STATE
+		}
+	}
+	if migrating && missingKeys > 0 {
+		if existingKeys > 0 {
+			return nil, slot, CLUSTER_REDIR_UNSTABLE
+		}
+		return cs.migratingSlotsTo[slot], slot, CLUSTER_REDIR_ASK
+	}
+	if importing && c.asking {
+		if multipleKeys && missingKeys > 0 {
+			return nil, slot, CLUSTER_REDIR_UNSTABLE
+		}
+		return cs.myself, slot, CLUSTER_REDIR_NONE
+	}
+	if n != cs.myself {
+		return n, slot, CLUSTER_REDIR_MOVED
+	}
+	return n, slot, CLUSTER_REDIR_NONE
+}
+
+// clusterRedirectError 返回命令不能在本节点执行时的错误回复，MOVED 和 ASK 给出应该执行命令的节点 n 的地址
+func (rs *RedisServer) clusterRedirectError(n *clusterNode, slot, code int) *RESPValue {
+	switch code {
+	case CLUSTER_REDIR_CROSS_SLOT:
+		return NewErrorValue("CROSSSLOT Keys in request don't hash to the same slot")
+	case CLUSTER_REDIR_UNSTABLE:
+		return NewErrorValue("TRYAGAIN Multiple keys request during rehashing of slot")
+	case CLUSTER_REDIR_DOWN_STATE:
+		return NewErrorValue("CLUSTERDOWN The cluster is down")
+	case CLUSTER_REDIR_DOWN_RO_STATE:
+		return NewErrorValue("CLUSTERDOWN The cluster is down and only accepts read commands")
+	case CLUSTER_REDIR_ASK, CLUSTER_REDIR_MOVED:
+		rs.clusterMu.RLock()
+		addr := fmt.Sprintf("%s:%d", n.ip, n.port)
+		rs.clusterMu.RUnlock()
+		if code == CLUSTER_REDIR_ASK {
+			return NewErrorValue(fmt.Sprintf("ASK %d %s", slot, addr))
+		}
+		return NewErrorValue(fmt.Sprintf("MOVED %d %s", slot, addr))
+	default:
+		return NewErrorValue("CLUSTERDOWN Hash slot not served")
+	}
+}
+
+// clusterCheckCommand 在集群模式下检查命令能否在本节点执行，可以时返回 nil
+//
+// 只检查有键的命令和 EXEC；主节点传来的命令和加载 AOF 时的命令（AOF 伪客户端没有连接）总是执行。
+func (rs *RedisServer) clusterCheckCommand(c *client, cmd *redisCommand, command *RESPValue) *RESPValue {
+	if c.master || c.conn == nil {
+		return nil
+	}
+	if _, ok := commandKeySpecs[cmd.name]; !ok && cmd.name != "exec" {
+		return nil
+	}
+	if n, slot, code := rs.getNodeByQuery(c, cmd, command); code != CLUSTER_REDIR_NONE {
+		return rs.clusterRedirectError(n, slot, code)
+	}
+	return nil
+}
+
+// scriptVerifyClusterState 在集群模式下检查脚本中的命令能否在本节点执行，可以时返回 nil
+//
+// 脚本声明的键已经在 EVAL 时检查过，这里拒绝访问其他节点的键或跨槽的命令。
+func (rs *RedisServer) scriptVerifyClusterState(cmd *redisCommand, command *RESPValue) *RESPValue {
+	n, _, code := rs.getNodeByQuery(rs.luaClient, cmd, command)
+	switch code {
+	case CLUSTER_REDIR_NONE:
+		if n == rs.cluster.myself {
+			return nil
+		}
+	case CLUSTER_REDIR_DOWN_STATE:
+		return NewErrorValue("ERR Script attempted to execute a command while the cluster is down")
+	case CLUSTER_REDIR_DOWN_RO_STATE:
+		return NewErrorValue("ERR Script attempted to execute a write command while the cluster is down and readonly")
+	case CLUSTER_REDIR_CROSS_SLOT:
+		return NewErrorValue("ERR Command '" + cmd.name + "' in script attempted to access keys that do not hash to the same slot")
+	}
+	return NewErrorValue("ERR Script attempted to access a non local key in a cluster node script")
+}
+
+// handleCluster 处理 CLUSTER 命令
+//
+// 支持 KEYSLOT、ADDSLOTS、ADDSLOTSRANGE、DELSLOTS、DELSLOTSRANGE、FLUSHSLOTS、SETSLOT、
+// COUNTKEYSINSLOT、GETKEYSINSLOT 和 MEET，修改槽的分配后立即保存 nodes.conf；
+// GOSSIP 是节点之间交换集群状态的内部命令（见 cluster_bus.go）。
+func (rs *RedisServer) handleCluster(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if !rs.clusterEnabled {
+		return NewErrorValue("ERR This instance has cluster support disabled")
+	}
+
+	sub := strings.ToLower(args[0])
+	switch sub {
+	case "keyslot":
+		if len(args) != 2 {
+			return wrongArgsError("cluster|keyslot")
+		}
+		return NewIntegerValue(int64(keyHashSlot(args[1])))
+	case "addslots", "delslots":
+		if len(args) < 2 {
+			return wrongArgsError("cluster|" + sub)
+		}
+		slots := make([]int, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			slot, errResp := parseSlot(arg)
+			if errResp != nil {
+				return errResp
+			}
+			slots = append(slots, slot)
+		}
+		return rs.clusterAddDelSlots(slots, sub == "addslots")
+	case "addslotsrange", "delslotsrange":
+		if len(args) < 3 || len(args)%2 == 0 {
+			return wrongArgsError("cluster|" + sub)
+		}
+		var slots []int
+		for i := 1; i < len(args); i += 2 {
+			start, errResp := parseSlot(args[i])
+			if errResp != nil {
+				return errResp
+			}
+			end, errResp := parseSlot(args[i+1])
+			if errResp != nil {
+				return errResp
+			}
+			if start > end {
+				return NewErrorValue(fmt.Sprintf("ERR start slot number %d is greater than end slot number %d", start, end))
+			}
+			for slot := start; slot <= end; slot++ {
+				slots = append(slots, slot)
+			}
+		}
+		return rs.clusterAddDelSlots(slots, sub == "addslotsrange")
+	case "flushslots":
+		if len(args) != 1 {
+			return wrongArgsError("cluster|flushslots")
+		}
+		return rs.clusterFlushSlots()
+	case "countkeysinslot":
+		if len(args) != 2 {
+			return wrongArgsError("cluster|countkeysinslot")
+		}
+		slot, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		if slot < 0 || slot >= CLUSTER_SLOTS {
+			return NewErrorValue("ERR Invalid slot")
+		}
+		rs.mutex.RLock()
+		defer rs.mutex.RUnlock()
+		return NewIntegerValue(int64(len(rs.databases[0].keysInSlot(int(slot), -1))))
+	case "getkeysinslot":
+		if len(args) != 3 {
+			return wrongArgsError("cluster|getkeysinslot")
+		}
+		slot, err1 := strconv.ParseInt(args[1], 10, 64)
+		count, err2 := strconv.ParseInt(args[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		if slot < 0 || slot >= CLUSTER_SLOTS || count < 0 {
+			return NewErrorValue("ERR Invalid slot or number of keys")
+		}
+		rs.mutex.RLock()
+		defer rs.mutex.RUnlock()
+		keys := rs.databases[0].keysInSlot(int(slot), int(count))
+		result := make([]*RESPValue, len(keys))
+		for i, key := range keys {
+			result[i] = NewBulkStringValue(key)
+		}
+		return NewArrayValue(result)
+	case "setslot":
+		if len(args) < 3 {
+			return wrongArgsError("cluster|setslot")
+		}
+		slot, errResp := parseSlot(args[1])
+		if errResp != nil {
+			return errResp
+		}
+		return rs.clusterSetSlot(slot, strings.ToLower(args[2]), args[3:])
+	case "meet":
+		if len(args) != 3 && len(args) != 4 {
+			return wrongArgsError("cluster|meet")
+		}
+		return rs.clusterMeet(args[1:])
+	case "info", "myid", "nodes", "slots", "shards":
+		if len(args) != 1 {
+			return wrongArgsError("cluster|" + sub)
+		}
+		return rs.clusterIntrospect(c, sub)
+	case "gossip":
+		if len(args) < 4 {
+			return wrongArgsError("cluster|gossip")
+		}
+		return rs.clusterHandleGossip(c, args[1:])
+	default:
+		return NewErrorValue("ERR unknown subcommand '" + args[0] + "'. Try CLUSTER HELP.")
+	}
+}
+
+// parseSlot 解析槽号
+func parseSlot(s string) (int, *RESPValue) {
+	slot, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || slot < 0 || slot >= CLUSTER_SLOTS {
+		return 0, NewErrorValue("ERR Invalid or out of range slot")
+	}
+	return int(slot), nil
+}
+
+// clusterAddDelSlots 让本节点开始（add 为 true）或停止负责一组槽，任何一个槽不满足条件时都不修改
+func (rs *RedisServer) clusterAddDelSlots(slots []int, add bool) *RESPValue {
+	rs.clusterMu.Lock()
+	defer rs.clusterMu.Unlock()
+	cs := rs.cluster
+	seen := make(map[int]bool, len(slots))
+	for _, slot := range slots {
+		if add && cs.slots[slot] != nil {
+			return NewErrorValue(fmt.Sprintf("ERR Slot %d is already busy", slot))
+		}
+		if !add && cs.slots[slot] == nil {
+			return NewErrorValue(fmt.Sprintf("ERR Slot %d is already unassigned", slot))
+		}
+		if seen[slot] {
+			return NewErrorValue(fmt.Sprintf("ERR Slot %d specified multiple times", slot))
+		}
+		seen[slot] = true
+	}
+	for _, slot := range slots {
+		if add {
+			cs.addSlot(cs.myself, slot)
+		} else {
+			cs.delSlot(slot)
+		}
+	}
+	rs.clusterUpdateState()
+	rs.clusterSaveConfigOrLog()
+	return NewSimpleStringValue("OK")
+}
+
+// clusterFlushSlots 让本节点不再负责任何槽，只能在数据库为空时执行
+func (rs *RedisServer) clusterFlushSlots() *RESPValue {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	if rs.databases[0].store.Len() != 0 {
+		return NewErrorValue("ERR DB must be empty to perform CLUSTER FLUSHSLOTS.")
+	}
+	rs.clusterMu.Lock()
+	defer rs.clusterMu.Unlock()
+	cs := rs.cluster
+	for slot, n := range cs.slots {
+		if n == cs.myself {
+			cs.delSlot(slot)
+		}
+	}
+	rs.clusterUpdateState()
+	rs.clusterSaveConfigOrLog()
+	return NewSimpleStringValue("OK")
+}
+
+// keysInSlot 返回数据库中槽 slot 的至多 count 个键，count 为负数时返回所有的键（调用方需持有锁）
+//
+// 需要遍历整个键空间，与 KEYS 一样只适合小数据集或迁移槽时使用。
+func (db *redisDb) keysInSlot(slot, count int) []string {
+	var keys []string
+	db.store.ForEach(func(key string, obj *RedisObject) {
+		if (count < 0 || len(keys) < count) && keyHashSlot(key) == slot {
+			keys = append(keys, key)
+		}
+	})
+	return keys
+}
+
+// clusterSetSlot 处理 CLUSTER SETSLOT slot IMPORTING|MIGRATING|STABLE|NODE [node-id]
+//
+// 与 Redis 相同，迁移槽时先在目标节点上设置 IMPORTING、在源节点上设置 MIGRATING，把键移到目标节点后，
+// 在两个节点上以 NODE 把槽交给目标节点。目标节点这时增加自己的配置纪元，其他节点从 CLUSTER GOSSIP
+// 中得知槽的新主人；源节点还有这个槽的键时不能把槽交给其他节点。
+func (rs *RedisServer) clusterSetSlot(slot int, action string, args []string) *RESPValue {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	rs.clusterMu.Lock()
+	defer rs.clusterMu.Unlock()
+	cs := rs.cluster
+
+	var n *clusterNode
+	switch {
+	case action == "stable" && len(args) == 0:
+		cs.migratingSlotsTo[slot], cs.importingSlotsFrom[slot] = nil, nil
+		rs.clusterSaveConfigOrLog()
+		return NewSimpleStringValue("OK")
+	case (action == "migrating" || action == "importing" || action == "node") && len(args) == 1:
+		if n = cs.nodes[args[0]]; n == nil || n.flags&CLUSTER_NODE_HANDSHAKE != 0 {
+			if action == "node" {
+				return NewErrorValue("ERR Unknown node " + args[0])
+			}
+			return NewErrorValue("ERR I don't know about node " + args[0])
+		}
+	default:
+		return NewErrorValue("ERR Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP")
+	}
+
+	switch action {
+	case "migrating":
+		if cs.slots[slot] != cs.myself {
+			return NewErrorValue(fmt.Sprintf("ERR I'm not the owner of hash slot %d", slot))
+		}
+		cs.migratingSlotsTo[slot] = n
+	case "importing":
+		if cs.slots[slot] == cs.myself {
+			return NewErrorValue(fmt.Sprintf("ERR I'm already the owner of hash slot %d", slot))
+		}
+		cs.importingSlotsFrom[slot] = n
+	case "node":
+		hasKeys := len(rs.databases[0].keysInSlot(slot, 1)) > 0
+		if cs.slots[slot] == cs.myself && n != cs.myself && hasKeys {
+			return NewErrorValue(fmt.Sprintf("ERR Can't assign hashslot %d to a different node while I still hold keys for this hash slot.", slot))
+		}
+		if !hasKeys {
+			cs.migratingSlotsTo[slot] = nil
+		}
+		cs.addSlot(n, slot)
+		if n == cs.myself && cs.importingSlotsFrom[slot] != nil {
+			if cs.bumpConfigEpochWithoutConsensus() {
+				log.Printf("configEpoch updated after importing slot %d", slot)
+			}
+			cs.importingSlotsFrom[slot] = nil
+		}
+		rs.clusterUpdateState()
+	}
+	rs.clusterSaveConfigOrLog()
+	return NewSimpleStringValue("OK")
+}
+
+// bumpConfigEpochWithoutConsensus 在本节点的配置纪元不是唯一最大的时候，把它设为新的 currentEpoch
+// （调用方需持有 clusterMu），返回是否修改了配置纪元
+//
+// 本节点不经过其他节点同意就接管了槽（例如导入完成）时调用，让新的槽分配在比较纪元时胜出。
+func (cs *clusterState) bumpConfigEpochWithoutConsensus() bool {
+	maxEpoch := cs.currentEpoch
+	for _, n := range cs.nodes {
+		maxEpoch = max(maxEpoch, n.configEpoch)
+	}
+	if cs.myself.configEpoch != 0 && cs.myself.configEpoch == maxEpoch {
+		return false
+	}
+	cs.currentEpoch = maxEpoch + 1
+	cs.myself.configEpoch = cs.currentEpoch
+	log.Printf("New configEpoch set to %d", cs.myself.configEpoch)
+	return true
+}
+
+// keySpec 描述命令参数中键的位置，下标从命令名的 0 开始
+//
+// 与 Redis 命令表的 firstkey、lastkey 和 step 相同：键从 first 开始每隔 step 个参数一个，
+// 到 last 结束，last 为负数时从末尾倒数；find 不为 nil 时由它找出键的下标。
+type keySpec struct {
+	first, last, step int
+	find              func(argv []*RESPValue) []int
+}
+
+// commandKeySpecs 列出有键的命令的键的位置，没有列出的命令不涉及键
+var commandKeySpecs = map[string]keySpec{
+	// 通用
+	"set":     {1, 1, 1, nil},
+	"get":     {1, 1, 1, nil},
+	"object":  {find: keyAtIfPresent(2)},
+	"move":    {1, 1, 1, nil},
+	"dump":    {1, 1, 1, nil},
+	"restore": {1, 1, 1, nil},
+	"del":     {1, -1, 1, nil},
+
+	// 过期
+	"expire":      {1, 1, 1, nil},
+	"pexpire":     {1, 1, 1, nil},
+	"expireat":    {1, 1, 1, nil},
+	"pexpireat":   {1, 1, 1, nil},
+	"ttl":         {1, 1, 1, nil},
+	"pttl":        {1, 1, 1, nil},
+	"expiretime":  {1, 1, 1, nil},
+	"pexpiretime": {1, 1, 1, nil},
+	"persist":     {1, 1, 1, nil},
+
+	// 事务与脚本
+	"watch":    {1, -1, 1, nil},
+	"eval":     {find: numKeysAt(2)},
+	"evalsha":  {find: numKeysAt(2)},
+	"fcall":    {find: numKeysAt(2)},
+	"fcall_ro": {find: numKeysAt(2)},
+	"gocall":   {find: numKeysAt(2)},
+
+	// 列表
+	"lpush":      {1, 1, 1, nil},
+	"rpush":      {1, 1, 1, nil},
+	"lpushx":     {1, 1, 1, nil},
+	"rpushx":     {1, 1, 1, nil},
+	"lpop":       {1, 1, 1, nil},
+	"rpop":       {1, 1, 1, nil},
+	"blpop":      {1, -2, 1, nil},
+	"brpop":      {1, -2, 1, nil},
+	"llen":       {1, 1, 1, nil},
+	"lrange":     {1, 1, 1, nil},
+	"ltrim":      {1, 1, 1, nil},
+	"lmove":      {1, 2, 1, nil},
+	"rpoplpush":  {1, 2, 1, nil},
+	"blmove":     {1, 2, 1, nil},
+	"brpoplpush": {1, 2, 1, nil},
+	"lmpop":      {find: numKeysAt(1)},
+	"blmpop":     {find: numKeysAt(2)},
+	"lpos":       {1, 1, 1, nil},
+
+	// 集合
+	"hset":        {1, 1, 1, nil},
+	"hdel":        {1, 1, 1, nil},
+	"hget":        {1, 1, 1, nil},
+	"hexists":     {1, 1, 1, nil},
+	"hlen":        {1, 1, 1, nil},
+	"hgetall":     {1, 1, 1, nil},
+	"sadd":        {1, 1, 1, nil},
+	"srem":        {1, 1, 1, nil},
+	"smembers":    {1, 1, 1, nil},
+	"sismember":   {1, 1, 1, nil},
+	"smismember":  {1, 1, 1, nil},
+	"scard":       {1, 1, 1, nil},
+	"spop":        {1, 1, 1, nil},
+	"srandmember": {1, 1, 1, nil},
+	"sinter":      {1, -1, 1, nil},
+	"sintercard":  {find: numKeysAt(1)},
+	"sunion":      {1, -1, 1, nil},
+	"sdiff":       {1, -1, 1, nil},
+	"sinterstore": {1, -1, 1, nil},
+	"sunionstore": {1, -1, 1, nil},
+	"sdiffstore":  {1, -1, 1, nil},
+	"smove":       {1, 2, 1, nil},
+	"sscan":       {1, 1, 1, nil},
+
+	// 有序集合
+	"zadd":             {1, 1, 1, nil},
+	"zincrby":          {1, 1, 1, nil},
+	"zscore":           {1, 1, 1, nil},
+	"zmscore":          {1, 1, 1, nil},
+	"zrange":           {1, 1, 1, nil},
+	"zrangestore":      {1, 2, 1, nil},
+	"zrangebyscore":    {1, 1, 1, nil},
+	"zrevrangebyscore": {1, 1, 1, nil},
+	"zrangebylex":      {1, 1, 1, nil},
+	"zrevrangebylex":   {1, 1, 1, nil},
+	"zcard":            {1, 1, 1, nil},
+	"zcount":           {1, 1, 1, nil},
+	"zlexcount":        {1, 1, 1, nil},
+	"zrem":             {1, 1, 1, nil},
+	"zremrangebyrank":  {1, 1, 1, nil},
+	"zremrangebyscore": {1, 1, 1, nil},
+	"zremrangebylex":   {1, 1, 1, nil},
+	"zpopmin":          {1, 1, 1, nil},
+	"zpopmax":          {1, 1, 1, nil},
+	"bzpopmin":         {1, -2, 1, nil},
+	"bzpopmax":         {1, -2, 1, nil},
+	"zrandmember":      {1, 1, 1, nil},
+	"zscan":            {1, 1, 1, nil},
+	"zunion":           {find: numKeysAt(1)},
+	"zinter":           {find: numKeysAt(1)},
+	"zdiff":            {find: numKeysAt(1)},
+	"zunionstore":      {find: storeAndNumKeys},
+	"zinterstore":      {find: storeAndNumKeys},
+	"zdiffstore":       {find: storeAndNumKeys},
+	"zrank":            {1, 1, 1, nil},
+	"zrevrank":         {1, 1, 1, nil},
+
+	// 流
+	"xadd":       {1, 1, 1, nil},
+	"xrange":     {1, 1, 1, nil},
+	"xrevrange":  {1, 1, 1, nil},
+	"xlen":       {1, 1, 1, nil},
+	"xtrim":      {1, 1, 1, nil},
+	"xsetid":     {1, 1, 1, nil},
+	"xread":      {find: streamsKeys},
+	"xgroup":     {find: keyAtIfPresent(2)},
+	"xreadgroup": {find: streamsKeys},
+	"xack":       {1, 1, 1, nil},
+	"xpending":   {1, 1, 1, nil},
+	"xclaim":     {1, 1, 1, nil},
+	"xautoclaim": {1, 1, 1, nil},
+	"xinfo":      {find: keyAtIfPresent(2)},
+
+	// 位图与 HyperLogLog
+	"setbit":      {1, 1, 1, nil},
+	"getbit":      {1, 1, 1, nil},
+	"bitcount":    {1, 1, 1, nil},
+	"bitpos":      {1, 1, 1, nil},
+	"bitop":       {2, -1, 1, nil},
+	"bitfield":    {1, 1, 1, nil},
+	"bitfield_ro": {1, 1, 1, nil},
+	"pfadd":       {1, 1, 1, nil},
+	"pfcount":     {1, -1, 1, nil},
+	"pfmerge":     {1, -1, 1, nil},
+
+	// 地理位置
+	"geoadd":               {1, 1, 1, nil},
+	"geopos":               {1, 1, 1, nil},
+	"geodist":              {1, 1, 1, nil},
+	"geohash":              {1, 1, 1, nil},
+	"geosearch":            {1, 1, 1, nil},
+	"geosearchstore":       {1, 2, 1, nil},
+	"georadius":            {find: georadiusKeys(6)},
+	"georadius_ro":         {1, 1, 1, nil},
+	"georadiusbymember":    {find: georadiusKeys(5)},
+	"georadiusbymember_ro": {1, 1, 1, nil},
+
+	// 分片频道与槽绑定，与键一样检查
+	"ssubscribe":   {1, -1, 1, nil},
+	"sunsubscribe": {1, -1, 1, nil},
+	"spublish":     {1, 1, 1, nil},
+
+	// Count-Min Sketch 与 Top-K
+	"cms.initbydim": {1, 1, 1, nil},
+	"cms.incrby":    {1, 1, 1, nil},
+	"cms.query":     {1, 1, 1, nil},
+	"topk.reserve":  {1, 1, 1, nil},
+	"topk.add":      {1, 1, 1, nil},
+	"topk.list":     {1, 1, 1, nil},
+}
+
+// commandKeys 返回命令参数中的键
+func commandKeys(cmd *redisCommand, argv []*RESPValue) []string {
+	spec, ok := commandKeySpecs[cmd.name]
+	if !ok {
+		return nil
+	}
+	var idx []int
+	if spec.find != nil {
+		idx = spec.find(argv)
+	} else {
+		last := spec.last
+		if last < 0 {
+			last += len(argv)
+		}
+		for i := spec.first; i <= last && i < len(argv); i += spec.step {
+			idx = append(idx, i)
+		}
+	}
+	keys := make([]string, len(idx))
+	for i, j := range idx {
+		keys[i] = argv[j].Str
+	}
+	return keys
+}
+
+// keyAtIfPresent 返回只在参数足够时下标 pos 处有一个键的查找函数，用于 OBJECT ENCODING key 等子命令
+func keyAtIfPresent(pos int) func(argv []*RESPValue) []int {
+	return func(argv []*RESPValue) []int {
+		if len(argv) <= pos {
+			return nil
+		}
+		return []int{pos}
+	}
+}
+
+// numKeysAt 返回下标 pos 处是键的个数、其后紧跟这些键的查找函数，用于 EVAL、LMPOP 等命令；
+// 键的个数不合法时没有键，由命令自己报错
+func numKeysAt(pos int) func(argv []*RESPValue) []int {
+	return func(argv []*RESPValue) []int {
+		if len(argv) <= pos {
+			return nil
+		}
+		n, err := strconv.Atoi(argv[pos].Str)
+		if err != nil || n <= 0 || n > len(argv)-pos-1 {
+			return nil
+		}
+		idx := make([]int, n)
+		for i := range idx {
+			idx[i] = pos + 1 + i
+		}
+		return idx
+	}
+}
+
+// storeAndNumKeys 是 ZUNIONSTORE 等命令的键：目标键，以及由下标 2 处的个数指定的源键
+func storeAndNumKeys(argv []*RESPValue) []int {
+	return append([]int{1}, numKeysAt(2)(argv)...)
+}
+
+// streamsKeys 是 XREAD 和 XREADGROUP 的键：STREAMS 之后的参数的前一半
+func streamsKeys(argv []*RESPValue) []int {
+	for i := 1; i < len(argv); i++ {
+		if !strings.EqualFold(argv[i].Str, "streams") {
+			continue
+		}
+		rest := len(argv) - i - 1
+		if rest == 0 || rest%2 != 0 {
+			return nil
+		}
+		idx := make([]int, rest/2)
+		for j := range idx {
+			idx[j] = i + 1 + j
+		}
+		return idx
+	}
+	return nil
+}
+
+// georadiusKeys 返回 GEORADIUS 和 GEORADIUSBYMEMBER 的键的查找函数：源键，以及从下标 from 开始的
+// 选项中 STORE 或 STOREDIST 指定的目标键
+func georadiusKeys(from int) func(argv []*RESPValue) []int {
+	return func(argv []*RESPValue) []int {
+		idx := []int{1}
+		for i := from; i+1 < len(argv); i++ {
+			if opt := argv[i].Str; strings.EqualFold(opt, "store") || strings.EqualFold(opt, "storedist") {
+				idx = append(idx, i+1)
+				i++
+			}
+		}
+		return idx
+	}
+}
@@ -0,0 +1,429 @@
+package goredis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clusterPingPeriod 是节点之间交换 CLUSTER GOSSIP 的间隔，clusterConnectTimeout 是连接其他节点的超时时间
+const (
+	clusterPingPeriod     = time.Second
+	clusterConnectTimeout = time.Second
+)
+
+// CLUSTER GOSSIP 消息的类型，用于 CLUSTER INFO 中的消息统计：PING 和 MEET 是发出的 GOSSIP，PONG 是它的回复
+const (
+	CLUSTERMSG_TYPE_PING = iota
+	CLUSTERMSG_TYPE_PONG
+	CLUSTERMSG_TYPE_MEET
+	CLUSTERMSG_TYPE_COUNT
+)
+
+// clusterMsgTypeNames 是消息类型在 CLUSTER INFO 中的名称
+var clusterMsgTypeNames = [CLUSTERMSG_TYPE_COUNT]string{"ping", "pong", "meet"}
+
+// 集群的节点之间不使用单独的集群总线，而是每隔 clusterPingPeriod 通过客户端端口互相发送内部命令
+//
+//	CLUSTER GOSSIP PING|MEET <currentEpoch> <本节点的 nodes.conf 行> [其他节点的 nodes.conf 行 ...]
+//
+// 对方以同样格式的数组（currentEpoch 和各节点的行，它自己的行在最前）回复，两边都用对方的行更新
+// 对方的地址、配置纪元和负责的槽，其他节点的行只用来发现新的节点。CLUSTER MEET 让本节点向新节点发送
+// MEET，对方因此接受这个还不认识的节点；之后两者在 GOSSIP 中互相介绍已知的节点，最终所有节点两两相连。
+// 同一个槽被多个节点声明时，配置纪元大的节点胜出，与 Redis 集群相同。
+
+// clusterStart 在开始接受连接后连接 nodes.conf 中已知的其他节点
+func (rs *RedisServer) clusterStart() {
+	rs.clusterMu.RLock()
+	defer rs.clusterMu.RUnlock()
+	for _, n := range rs.cluster.nodes {
+		if n != rs.cluster.myself {
+			go rs.clusterLinkLoop(n)
+		}
+	}
+}
+
+// clusterMeet 处理 CLUSTER MEET ip port [cluster-bus-port]，与 ip:port 上的节点握手，让它加入本节点所在的集群
+//
+// 立即回复 OK，握手在后台进行；cluster-bus-port 只检查格式，节点之间总是通过客户端端口通信。
+func (rs *RedisServer) clusterMeet(args []string) *RESPValue {
+	port, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return NewErrorValue("ERR Invalid base port specified: " + args[1])
+	}
+	if len(args) == 3 {
+		if _, err := strconv.ParseInt(args[2], 10, 64); err != nil {
+			return NewErrorValue("ERR Invalid bus port specified: " + args[2])
+		}
+	}
+	ip := net.ParseIP(args[0])
+	if ip == nil || port <= 0 || port > 65535 {
+		return NewErrorValue("ERR Invalid node address specified: " + args[0] + ":" + args[1])
+	}
+	rs.clusterMu.Lock()
+	defer rs.clusterMu.Unlock()
+	rs.clusterStartHandshake(ip.String(), int(port))
+	return NewSimpleStringValue("OK")
+}
+
+// clusterStartHandshake 以临时的节点 ID 加入 ip:port 上的节点并开始向它发送 MEET（调用方需持有 clusterMu）
+//
+// 已经有节点使用这个地址时什么也不做；收到对方的第一次回复后换成它真正的节点 ID（见 clusterProcessGossip）。
+func (rs *RedisServer) clusterStartHandshake(ip string, port int) {
+	cs := rs.cluster
+	for _, n := range cs.nodes {
+		if n != cs.myself && n.ip == ip && n.port == port {
+			return
+		}
+	}
+	rs.clusterAddNode(&clusterNode{name: newReplid(), ip: ip, port: port, flags: CLUSTER_NODE_HANDSHAKE | CLUSTER_NODE_MASTER})
+}
+
+// clusterAddNode 把节点加入集群并开始与它交换状态（调用方需持有 clusterMu）
+func (rs *RedisServer) clusterAddNode(n *clusterNode) {
+	n.ctime = time.Now()
+	rs.cluster.nodes[n.name] = n
+	go rs.clusterLinkLoop(n)
+}
+
+// clusterDelNode 把节点从集群中删除，它负责和正在迁移的槽不再有主人（调用方需持有 clusterMu）
+func (rs *RedisServer) clusterDelNode(n *clusterNode) {
+	cs := rs.cluster
+	for slot := 0; slot < CLUSTER_SLOTS; slot++ {
+		if cs.slots[slot] == n {
+			cs.delSlot(slot)
+		}
+		if cs.migratingSlotsTo[slot] == n {
+			cs.migratingSlotsTo[slot] = nil
+		}
+		if cs.importingSlotsFrom[slot] == n {
+			cs.importingSlotsFrom[slot] = nil
+		}
+	}
+	delete(cs.nodes, n.name)
+}
+
+// gossipMessage 返回发送给其他节点的 currentEpoch 和各节点的 nodes.conf 行，本节点的行在最前
+// （调用方需持有 clusterMu）
+func (cs *clusterState) gossipMessage() []string {
+	msg := []string{strconv.FormatUint(cs.currentEpoch, 10), cs.genNodeDescription(cs.myself)}
+	for _, n := range cs.nodes {
+		if n != cs.myself && n.flags&CLUSTER_NODE_HANDSHAKE == 0 {
+			msg = append(msg, cs.genNodeDescription(n))
+		}
+	}
+	return msg
+}
+
+// clusterLinkLoop 每隔 clusterPingPeriod 向节点 n 发送 CLUSTER GOSSIP 并处理它的回复，直到节点被删除
+//
+// 连接断开或出错后下一次重新连接。超过 cluster-node-timeout 没有回复的节点标记为 fail?，
+// 收到回复后清除；握手在超时之前还没有完成的节点被删除。
+func (rs *RedisServer) clusterLinkLoop(n *clusterNode) {
+	var conn net.Conn
+	var reader *bufio.Reader
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for ; ; time.Sleep(clusterPingPeriod) {
+		rs.clusterMu.Lock()
+		cs := rs.cluster
+		if cs.nodes[n.name] != n {
+			// 节点已经被删除：握手超时，或者握手发现它就是本节点或已知的节点
+			rs.clusterMu.Unlock()
+			return
+		}
+		now := time.Now()
+		timeout := time.Duration(rs.clusterNodeTimeout) * time.Millisecond
+		if n.flags&CLUSTER_NODE_HANDSHAKE != 0 && now.Sub(n.ctime) > max(timeout, time.Second) {
+			log.Printf("Handshake with node %s:%d timed out.", n.ip, n.port)
+			rs.clusterDelNode(n)
+			rs.clusterMu.Unlock()
+			return
+		}
+		if !n.pingSent.IsZero() && now.Sub(n.pingSent) > timeout && n.flags&CLUSTER_NODE_PFAIL == 0 {
+			log.Printf("*** NODE %.40s possibly failing", n.name)
+			n.flags |= CLUSTER_NODE_PFAIL
+		}
+		if n.pingSent.IsZero() {
+			n.pingSent = now
+		}
+		typ := CLUSTERMSG_TYPE_PING
+		if n.flags&CLUSTER_NODE_HANDSHAKE != 0 {
+			typ = CLUSTERMSG_TYPE_MEET
+		}
+		addr := net.JoinHostPort(n.ip, strconv.Itoa(n.port))
+		msg := append([]string{"CLUSTER", "GOSSIP", clusterMsgTypeNames[typ]}, cs.gossipMessage()...)
+		rs.clusterMu.Unlock()
+
+		if conn == nil {
+			var err error
+			if conn, err = net.DialTimeout("tcp", addr, clusterConnectTimeout); err != nil {
+				conn = nil
+				continue
+			}
+			reader = bufio.NewReader(conn)
+		}
+		reply, err := clusterSendGossip(conn, reader, msg)
+		if err != nil {
+			conn.Close()
+			conn = nil
+			rs.clusterMu.Lock()
+			n.linkConnected = false
+			rs.clusterMu.Unlock()
+			continue
+		}
+		localIP, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+		rs.clusterMu.Lock()
+		cs.statsMessagesSent[typ]++
+		cs.statsMessagesReceived[CLUSTERMSG_TYPE_PONG]++
+		if err := rs.clusterProcessGossip(n, false, reply, n.ip, localIP); err != nil {
+			log.Printf("Error processing CLUSTER GOSSIP reply from %s: %v", addr, err)
+		}
+		rs.clusterMu.Unlock()
+	}
+}
+
+// clusterSendGossip 发送一条 CLUSTER GOSSIP 并读取回复的数组
+func clusterSendGossip(conn net.Conn, reader *bufio.Reader, msg []string) ([]string, error) {
+	argv := make([]*RESPValue, len(msg))
+	for i, arg := range msg {
+		argv[i] = NewBulkStringValue(arg)
+	}
+	conn.SetDeadline(time.Now().Add(replTimeout))
+	if _, err := conn.Write(NewArrayValue(argv).SerializeRESP()); err != nil {
+		return nil, err
+	}
+	reply, err := ParseRESP(reader)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Type == RESP_ERROR {
+		return nil, errors.New(reply.Str)
+	}
+	if reply.Type != RESP_ARRAY || len(reply.Array) < 2 {
+		return nil, errors.New("unexpected reply to CLUSTER GOSSIP")
+	}
+	result := make([]string, len(reply.Array))
+	for i, v := range reply.Array {
+		result[i] = v.Str
+	}
+	return result, nil
+}
+
+// clusterHandleGossip 处理其他节点发来的 CLUSTER GOSSIP PING|MEET currentEpoch line [line ...]，回复本节点的状态
+func (rs *RedisServer) clusterHandleGossip(c *client, args []string) *RESPValue {
+	meet := strings.EqualFold(args[0], "meet")
+	if !meet && !strings.EqualFold(args[0], "ping") {
+		return NewErrorValue("ERR syntax error")
+	}
+	peerIP, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	localIP, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+
+	rs.clusterMu.Lock()
+	defer rs.clusterMu.Unlock()
+	cs := rs.cluster
+	if meet {
+		cs.statsMessagesReceived[CLUSTERMSG_TYPE_MEET]++
+	} else {
+		cs.statsMessagesReceived[CLUSTERMSG_TYPE_PING]++
+	}
+	if err := rs.clusterProcessGossip(nil, meet, args[1:], peerIP, localIP); err != nil {
+		return NewErrorValue("ERR " + err.Error())
+	}
+	cs.statsMessagesSent[CLUSTERMSG_TYPE_PONG]++
+	msg := cs.gossipMessage()
+	result := make([]*RESPValue, len(msg))
+	for i, s := range msg {
+		result[i] = NewBulkStringValue(s)
+	}
+	return NewArrayValue(result)
+}
+
+// clusterProcessGossip 用其他节点发来的 currentEpoch 和各节点的行更新集群状态（调用方需持有 clusterMu）
+//
+// link 是本节点发送 GOSSIP 的目标节点，处理的是它的回复；处理收到的 GOSSIP 时 link 为 nil，这时只接受
+// 已知节点的 PING 和任意节点的 MEET。peerIP 是对方的地址，对方还不知道自己的地址时使用；
+// localIP 是连接的本地地址，本节点还不知道自己的地址时以它为准。
+func (rs *RedisServer) clusterProcessGossip(link *clusterNode, meet bool, msg []string, peerIP, localIP string) error {
+	cs := rs.cluster
+	epoch, err := strconv.ParseUint(msg[0], 10, 64)
+	if err != nil {
+		return errors.New("invalid currentEpoch")
+	}
+	hdr, err := parseGossipLine(msg[1])
+	if err != nil {
+		return err
+	}
+	if hdr.ip == "" {
+		hdr.ip = peerIP
+	}
+	dirty := false
+	if cs.myself.ip == "" && localIP != "" {
+		cs.myself.ip = localIP
+		log.Printf("IP address for this node updated to %s", localIP)
+		dirty = true
+	}
+
+	sender := cs.nodes[hdr.name]
+	if link != nil {
+		now := time.Now()
+		link.pingSent, link.pongReceived, link.linkConnected = time.Time{}, now, true
+		if link.flags&CLUSTER_NODE_PFAIL != 0 {
+			link.flags &^= CLUSTER_NODE_PFAIL
+			log.Printf("Clear FAIL state for node %.40s: is reachable again.", link.name)
+		}
+		if link.flags&CLUSTER_NODE_HANDSHAKE != 0 {
+			if sender != nil || hdr.name == cs.myself.name {
+				// 这个地址上是已知的节点或者本节点自己
+				rs.clusterDelNode(link)
+				return nil
+			}
+			delete(cs.nodes, link.name)
+			link.name = hdr.name
+			link.flags &^= CLUSTER_NODE_HANDSHAKE
+			cs.nodes[link.name] = link
+			sender = link
+			log.Printf("Handshake with node %.40s completed.", link.name)
+			dirty = true
+		} else if sender != link {
+			return fmt.Errorf("node %s:%d reports a different node ID %.40s", link.ip, link.port, hdr.name)
+		}
+	} else if sender == nil {
+		if !meet || hdr.name == cs.myself.name {
+			return nil
+		}
+		sender = &clusterNode{name: hdr.name, flags: CLUSTER_NODE_MASTER}
+		rs.clusterAddNode(sender)
+		log.Printf("Node %.40s (%s:%d) added to the cluster by MEET", hdr.name, hdr.ip, hdr.port)
+		dirty = true
+	}
+	if sender == cs.myself {
+		return nil
+	}
+
+	if sender.ip != hdr.ip || sender.port != hdr.port {
+		if sender.ip != "" {
+			log.Printf("Address updated for node %.40s, now %s:%d", sender.name, hdr.ip, hdr.port)
+		}
+		sender.ip, sender.port = hdr.ip, hdr.port
+		dirty = true
+	}
+	if epoch > cs.currentEpoch {
+		cs.currentEpoch = epoch
+		dirty = true
+	}
+	if hdr.configEpoch > sender.configEpoch {
+		sender.configEpoch = hdr.configEpoch
+		dirty = true
+	}
+	if rs.clusterUpdateSlotsConfigWith(sender, hdr) {
+		dirty = true
+	}
+	if rs.clusterHandleConfigEpochCollision(sender) {
+		dirty = true
+	}
+
+	// 其他节点的行只用来发现新节点，与 CLUSTER MEET 一样握手
+	for _, line := range msg[2:] {
+		n, err := parseGossipLine(line)
+		if err != nil || n.ip == "" || n.flags&CLUSTER_NODE_HANDSHAKE != 0 {
+			continue
+		}
+		if n.name != cs.myself.name && cs.nodes[n.name] == nil {
+			rs.clusterStartHandshake(n.ip, n.port)
+		}
+	}
+
+	if dirty {
+		rs.clusterUpdateState()
+		rs.clusterSaveConfigOrLog()
+	}
+	return nil
+}
+
+// parseGossipLine 解析 GOSSIP 中的一行，返回的节点只用于读取其中的地址、配置纪元和槽
+func parseGossipLine(line string) (*clusterNode, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 8 {
+		return nil, errors.New("too few fields in a node line")
+	}
+	n, err := parseNodeLine(fields)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range fields[8:] {
+		if strings.HasPrefix(r, "[") {
+			continue
+		}
+		start, end, err := parseSlotRange(r)
+		if err != nil {
+			return nil, err
+		}
+		for slot := start; slot <= end; slot++ {
+			n.setSlot(slot)
+		}
+	}
+	return n, nil
+}
+
+// clusterUpdateSlotsConfigWith 接受 sender 声明负责的槽（调用方需持有 clusterMu），返回是否有变化
+//
+// 槽没有主人，或者主人的配置纪元比 sender 的小时，槽交给 sender；本节点正在导入的槽不受影响。
+// 本节点失去的槽中的键留在本地，但之后对它们的访问都被重定向到新的主人。
+func (rs *RedisServer) clusterUpdateSlotsConfigWith(sender, claimed *clusterNode) bool {
+	cs := rs.cluster
+	changed := false
+	for slot := 0; slot < CLUSTER_SLOTS; slot++ {
+		if !claimed.hasSlot(slot) {
+			continue
+		}
+		cur := cs.slots[slot]
+		if cur == sender || cs.importingSlotsFrom[slot] != nil {
+			continue
+		}
+		if cur == nil || cur.configEpoch < sender.configEpoch {
+			if cur == cs.myself {
+				log.Printf("Configuration change detected: slot %d is now served by %.40s", slot, sender.name)
+				cs.migratingSlotsTo[slot] = nil
+			}
+			cs.addSlot(sender, slot)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// clusterHandleConfigEpochCollision 处理本节点与 sender 配置纪元相同的情况（调用方需持有 clusterMu），
+// 返回是否修改了本节点的配置纪元
+//
+// 与 Redis 相同，节点 ID 较小的一方把配置纪元设为新的 currentEpoch，最终所有节点的配置纪元各不相同，
+// 新建的集群中所有节点的配置纪元都是 0，也因此很快变得各不相同。
+func (rs *RedisServer) clusterHandleConfigEpochCollision(sender *clusterNode) bool {
+	cs := rs.cluster
+	if sender.configEpoch != cs.myself.configEpoch || sender.name <= cs.myself.name {
+		return false
+	}
+	cs.currentEpoch++
+	cs.myself.configEpoch = cs.currentEpoch
+	log.Printf("WARNING: configEpoch collision with node %.40s. configEpoch set to %d", sender.name, cs.myself.configEpoch)
+	return true
+}
+
+// handleAsking 处理 ASKING 命令，之后的一条命令（或者事务）可以访问本节点正在导入的槽
+//
+// 客户端收到 -ASK 重定向后先发送 ASKING，再在目标节点上重新执行命令。
+func (rs *RedisServer) handleAsking(c *client, command *RESPValue) *RESPValue {
+	if !rs.clusterEnabled {
+		return NewErrorValue("ERR This instance has cluster support disabled")
+	}
+	c.asking = true
+	return NewSimpleStringValue("OK")
+}
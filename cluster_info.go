@@ -0,0 +1,182 @@
+package goredis
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// clusterIntrospect 处理 CLUSTER INFO、MYID、NODES、SLOTS 和 SHARDS，回复的格式与 Redis 相同，
+// 客户端启动时用它们建立槽到节点的映射
+func (rs *RedisServer) clusterIntrospect(c *client, sub string) *RESPValue {
+	// SHARDS 中本节点的复制偏移量由 replMu 保护，replMu 在 clusterMu 之前取得
+	var replOffset int64
+	if sub == "shards" {
+		rs.replMu.Lock()
+		replOffset = rs.masterReplOffset
+		rs.replMu.Unlock()
+	}
+
+	rs.clusterMu.RLock()
+	defer rs.clusterMu.RUnlock()
+	cs := rs.cluster
+	switch sub {
+	case "info":
+		return NewBulkStringValue(cs.genClusterInfoString())
+	case "myid":
+		return NewBulkStringValue(cs.myself.name)
+	case "nodes":
+		var b strings.Builder
+		for _, n := range cs.sortedNodes() {
+			b.WriteString(cs.genNodeDescription(n))
+			b.WriteString("\n")
+		}
+		return NewBulkStringValue(b.String())
+	case "slots":
+		return cs.clusterReplySlots(c)
+	default:
+		return cs.clusterReplyShards(c, replOffset)
+	}
+}
+
+// sortedNodes 返回按节点 ID 排序的所有节点，让 CLUSTER NODES 和 SHARDS 的输出顺序稳定（调用方需持有 clusterMu）
+func (cs *clusterState) sortedNodes() []*clusterNode {
+	nodes := make([]*clusterNode, 0, len(cs.nodes))
+	for _, n := range cs.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].name < nodes[j].name })
+	return nodes
+}
+
+// genClusterInfoString 生成 CLUSTER INFO 的内容（调用方需持有 clusterMu）
+//
+// 没有故障转移，节点不会进入 fail 状态，cluster_slots_fail 总是 0；cluster_slots_pfail 是
+// 标记为 fail? 的节点负责的槽数。cluster_size 是至少负责一个槽的主节点数量。
+func (cs *clusterState) genClusterInfoString() string {
+	assigned, pfail := 0, 0
+	for _, n := range cs.slots {
+		if n == nil {
+			continue
+		}
+		assigned++
+		if n.flags&CLUSTER_NODE_PFAIL != 0 {
+			pfail++
+		}
+	}
+	size := 0
+	for _, n := range cs.nodes {
+		if n.flags&CLUSTER_NODE_MASTER != 0 && n.numSlots > 0 {
+			size++
+		}
+	}
+	state := "ok"
+	if cs.state != CLUSTER_OK {
+		state = "fail"
+	}
+
+	var b strings.Builder
+	infoField(&b, "cluster_state", state)
+	infoField(&b, "cluster_slots_assigned", assigned)
+	infoField(&b, "cluster_slots_ok", assigned-pfail)
+	infoField(&b, "cluster_slots_pfail", pfail)
+	infoField(&b, "cluster_slots_fail", 0)
+	infoField(&b, "cluster_known_nodes", len(cs.nodes))
+	infoField(&b, "cluster_size", size)
+	infoField(&b, "cluster_current_epoch", cs.currentEpoch)
+	infoField(&b, "cluster_my_epoch", cs.myself.configEpoch)
+	genClusterMessageStats(&b, "sent", &cs.statsMessagesSent)
+	genClusterMessageStats(&b, "received", &cs.statsMessagesReceived)
+	infoField(&b, "total_cluster_links_buffer_limit_exceeded", 0)
+	return b.String()
+}
+
+// genClusterMessageStats 生成 CLUSTER INFO 中一个方向的消息统计：各类型的数量（只列出不为 0 的类型）和总数
+func genClusterMessageStats(b *strings.Builder, dir string, stats *[CLUSTERMSG_TYPE_COUNT]uint64) {
+	var total uint64
+	for typ, count := range stats {
+		if count > 0 {
+			infoField(b, "cluster_stats_messages_"+clusterMsgTypeNames[typ]+"_"+dir, count)
+			total += count
+		}
+	}
+	infoField(b, "cluster_stats_messages_"+dir, total)
+}
+
+// nodeEndpoint 返回回复给客户端 c 的节点地址（调用方需持有 clusterMu）
+//
+// 本节点还不知道自己的地址时（绑定在通配地址上，还没有其他节点告诉它）使用 c 连接的本地地址，
+// 客户端总是可以用这个地址连接本节点。
+func (cs *clusterState) nodeEndpoint(c *client, n *clusterNode) string {
+	if n.ip == "" && n == cs.myself && c.conn != nil {
+		ip, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+		return ip
+	}
+	return n.ip
+}
+
+// clusterReplySlots 生成 CLUSTER SLOTS 的回复（调用方需持有 clusterMu）
+//
+// 按槽的顺序，每一段由同一个节点负责的连续的槽回复 [起始槽, 结束槽, [ip, port, 节点 ID, {}]]，
+// 最后的映射是 Redis 7 加入的节点元数据，这里总是为空；集群模式下没有副本，每段只有主节点。
+func (cs *clusterState) clusterReplySlots(c *client) *RESPValue {
+	var result []*RESPValue
+	for start := 0; start < CLUSTER_SLOTS; {
+		n := cs.slots[start]
+		end := start
+		for end+1 < CLUSTER_SLOTS && cs.slots[end+1] == n {
+			end++
+		}
+		if n != nil {
+			result = append(result, NewArrayValue([]*RESPValue{
+				NewIntegerValue(int64(start)),
+				NewIntegerValue(int64(end)),
+				NewArrayValue([]*RESPValue{
+					NewBulkStringValue(cs.nodeEndpoint(c, n)),
+					NewIntegerValue(int64(n.port)),
+					NewBulkStringValue(n.name),
+					NewMapValue(nil),
+				}),
+			}))
+		}
+		start = end + 1
+	}
+	return NewArrayValue(result)
+}
+
+// clusterReplyShards 生成 CLUSTER SHARDS 的回复（调用方需持有 clusterMu）
+//
+// 每个主节点是一个分片（没有副本），包括还没有负责任何槽的节点：slots 是它负责的槽区间的起止槽号，
+// nodes 是分片中节点的 id、port、ip、endpoint、role、replication-offset 和 health。
+// 节点之间不交换复制偏移量，其他节点的 replication-offset 为 0；没有故障转移，health 总是 online。
+func (cs *clusterState) clusterReplyShards(c *client, replOffset int64) *RESPValue {
+	var shards []*RESPValue
+	for _, n := range cs.sortedNodes() {
+		if n.flags&CLUSTER_NODE_HANDSHAKE != 0 {
+			continue
+		}
+		var slots []*RESPValue
+		for _, r := range n.slotRanges() {
+			slots = append(slots, NewIntegerValue(int64(r[0])), NewIntegerValue(int64(r[1])))
+		}
+		offset := int64(0)
+		if n == cs.myself {
+			offset = replOffset
+		}
+		ip := cs.nodeEndpoint(c, n)
+		node := NewMapValue([]*RESPValue{
+			NewBulkStringValue("id"), NewBulkStringValue(n.name),
+			NewBulkStringValue("port"), NewIntegerValue(int64(n.port)),
+			NewBulkStringValue("ip"), NewBulkStringValue(ip),
+			NewBulkStringValue("endpoint"), NewBulkStringValue(ip),
+			NewBulkStringValue("role"), NewBulkStringValue("master"),
+			NewBulkStringValue("replication-offset"), NewIntegerValue(offset),
+			NewBulkStringValue("health"), NewBulkStringValue("online"),
+		})
+		shards = append(shards, NewMapValue([]*RESPValue{
+			NewBulkStringValue("slots"), NewArrayValue(slots),
+			NewBulkStringValue("nodes"), NewArrayValue([]*RESPValue{node}),
+		}))
+	}
+	return NewArrayValue(shards)
+}
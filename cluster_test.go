@@ -0,0 +1,236 @@
+package goredis
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// clusterReady 返回本节点是否已经与集群中的其他 nodes-1 个节点完成握手，并且所有的槽都有节点负责
+func (ts *testServer) clusterReady(nodes int) bool {
+	ts.rs.clusterMu.RLock()
+	defer ts.rs.clusterMu.RUnlock()
+	cs := ts.rs.cluster
+	if cs.state != CLUSTER_OK || len(cs.nodes) != nodes {
+		return false
+	}
+	for _, n := range cs.nodes {
+		if n.flags&CLUSTER_NODE_HANDSHAKE != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// startTestCluster 启动两个节点组成的集群，第一个节点负责槽 0-8191，第二个负责 8192-16383
+func startTestCluster(t *testing.T) (*testServer, *testServer) {
+	t.Helper()
+	a := startTestServer(t, "cluster-enabled yes")
+	b := startTestServer(t, "cluster-enabled yes")
+	ca, cb := a.connect(t), b.connect(t)
+	ca.mustDo("OK", "CLUSTER", "ADDSLOTSRANGE", "0", "8191")
+	cb.mustDo("OK", "CLUSTER", "ADDSLOTSRANGE", "8192", "16383")
+	host, port, _ := strings.Cut(b.addr, ":")
+	ca.mustDo("OK", "CLUSTER", "MEET", host, port)
+	waitFor(t, "cluster to come up", func() bool { return a.clusterReady(2) && b.clusterReady(2) })
+	return a, b
+}
+
+func TestKeyHashSlot(t *testing.T) {
+	cases := map[string]int{
+		"foo":                  12182,
+		"bar":                  5061,
+		"{user1000}.following": keyHashSlot("user1000"),
+		"{user1000}.followers": keyHashSlot("user1000"),
+		// 空的哈希标签不起作用，只看第一对括号
+		"foo{}{bar}":    keyHashSlot("foo{}{bar}"),
+		"foo{{bar}}":    keyHashSlot("{bar"),
+		"foo{bar}{zap}": keyHashSlot("bar"),
+	}
+	for key, want := range cases {
+		if got := keyHashSlot(key); got != want {
+			t.Errorf("keyHashSlot(%q) = %d, want %d", key, got, want)
+		}
+	}
+	if keyHashSlot("foo{}{bar}") == keyHashSlot("bar") {
+		t.Error("empty hash tag was skipped")
+	}
+}
+
+func TestClusterSlots(t *testing.T) {
+	ts := startTestServer(t, "cluster-enabled yes")
+	c := ts.connect(t)
+	c.mustDo("12182", "CLUSTER", "KEYSLOT", "foo")
+	// 还没有分配槽时集群下线
+	c.mustDo("(error) CLUSTERDOWN Hash slot not served", "GET", "foo")
+	c.mustDo("OK", "CLUSTER", "ADDSLOTSRANGE", "0", "8191")
+	c.mustDo("(error) CLUSTERDOWN The cluster is down", "GET", "bar")
+	c.mustDo("OK", "CLUSTER", "ADDSLOTSRANGE", "8192", "16382")
+	c.mustDo("OK", "CLUSTER", "ADDSLOTS", "16383")
+	c.mustDo("(error) ERR Slot 0 is already busy", "CLUSTER", "ADDSLOTS", "0")
+	c.mustDo("(error) ERR Invalid or out of range slot", "CLUSTER", "ADDSLOTS", "16384")
+
+	c.mustDo("1", "SADD", "foo", "1")
+	c.mustDo("1", "SADD", "{foo}.x", "2")
+	c.mustDoSorted("[1 2]", "SUNION", "foo", "{foo}.x")
+	c.mustDo("(error) CROSSSLOT Keys in request don't hash to the same slot", "SUNION", "foo", "bar")
+	c.mustDo("2", "CLUSTER", "COUNTKEYSINSLOT", "12182")
+	c.mustDoSorted("[foo {foo}.x]", "CLUSTER", "GETKEYSINSLOT", "12182", "10")
+	c.mustDo("(error) ERR DB must be empty to perform CLUSTER FLUSHSLOTS.", "CLUSTER", "FLUSHSLOTS")
+
+	// 事务在排队和 EXEC 时都检查槽
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "SCARD", "foo")
+	c.mustDo("QUEUED", "GET", "bar")
+	c.mustDo("(error) CROSSSLOT Keys in request don't hash to the same slot", "EXEC")
+	c.mustDo("(error) ERR Command 'sunion' in script attempted to access keys that do not hash to the same slot",
+		"EVAL", "return redis.call('SUNION', KEYS[1], 'bar')", "1", "foo")
+
+	c.mustDo("(error) ERR SELECT is not allowed in cluster mode", "SELECT", "1")
+	c.mustDo("OK", "SELECT", "0")
+	c.mustDo("(error) ERR REPLICAOF not allowed in cluster mode.", "REPLICAOF", "127.0.0.1", "1")
+	c.mustDo("OK", "CLUSTER", "DELSLOTS", "16383")
+	c.mustDo("(error) ERR Slot 16383 is already unassigned", "CLUSTER", "DELSLOTSRANGE", "16383", "16383")
+
+	// 槽的分配保存在 nodes.conf 中，重启后恢复
+	c.mustDo("OK", "SAVE")
+	conf, err := os.ReadFile(filepath.Join(ts.dir, "nodes.conf"))
+	if err != nil || !strings.Contains(string(conf), "myself,master") || !strings.Contains(string(conf), "0-16382") {
+		t.Fatalf("nodes.conf %q: %v", conf, err)
+	}
+	restarted := startTestServerIn(t, ts.dir, "cluster-enabled yes")
+	rc := restarted.connect(t)
+	rc.mustDo("(error) CLUSTERDOWN The cluster is down", "GET", "foo")
+	rc.mustDo("OK", "CLUSTER", "ADDSLOTS", "16383")
+	rc.mustDo("1", "SCARD", "foo")
+}
+
+func TestClusterDownConfig(t *testing.T) {
+	ts := startTestServer(t, "cluster-enabled yes", "cluster-require-full-coverage no")
+	c := ts.connect(t)
+	c.mustDo("OK", "CLUSTER", "ADDSLOTSRANGE", "0", "8191")
+	// 不要求覆盖全部的槽时，本节点负责的槽照常使用
+	c.mustDo("OK", "SET", "bar", "1")
+	c.mustDo("(error) CLUSTERDOWN Hash slot not served", "GET", "foo")
+
+	c.mustDo("OK", "CONFIG", "SET", "cluster-require-full-coverage", "yes")
+	c.mustDo("OK", "CONFIG", "SET", "cluster-allow-reads-when-down", "yes")
+	c.mustDo("1", "GET", "bar")
+	c.mustDo("(error) CLUSTERDOWN The cluster is down and only accepts read commands", "SET", "bar", "2")
+}
+
+func TestClusterDisabled(t *testing.T) {
+	c := startTestServer(t).connect(t)
+	c.mustDo("(error) ERR This instance has cluster support disabled", "CLUSTER", "KEYSLOT", "foo")
+	if info := c.do("INFO", "cluster").Str; infoValue(t, info, "cluster_enabled") != "0" {
+		t.Fatalf("INFO cluster:\n%s", info)
+	}
+}
+
+func TestClusterRedirection(t *testing.T) {
+	a, b := startTestCluster(t)
+	ca, cb := a.connect(t), b.connect(t)
+	ca.mustDo("12182", "CLUSTER", "KEYSLOT", "foo")
+	ca.mustDo("5061", "CLUSTER", "KEYSLOT", "bar")
+
+	ca.mustDo("OK", "SET", "bar", "1")
+	ca.mustDo("(error) MOVED 12182 "+b.addr, "SET", "foo", "1")
+	cb.mustDo("OK", "SET", "foo", "1")
+	cb.mustDo("(error) MOVED 5061 "+a.addr, "GET", "bar")
+	ca.mustDo("(error) CROSSSLOT Keys in request don't hash to the same slot", "SUNION", "bar", "foo")
+	// 没有键的命令总是在本节点执行
+	ca.mustDo("PONG", "PING")
+
+	// 排队时被重定向的命令让 EXEC 失败；排队的命令在 EXEC 时还要检查键都在同一个槽中
+	ca.mustDo("OK", "MULTI")
+	ca.mustDo("(error) MOVED 12182 "+b.addr, "GET", "foo")
+	ca.mustDo("(error) EXECABORT Transaction discarded because of previous errors.", "EXEC")
+	ca.mustDo("866", "CLUSTER", "KEYSLOT", "hello")
+	ca.mustDo("OK", "MULTI")
+	ca.mustDo("QUEUED", "GET", "bar")
+	ca.mustDo("QUEUED", "GET", "hello")
+	ca.mustDo("(error) CROSSSLOT Keys in request don't hash to the same slot", "EXEC")
+	ca.mustDo("1", "GET", "bar")
+}
+
+func TestClusterAskRedirection(t *testing.T) {
+	a, b := startTestCluster(t)
+	ca, cb := a.connect(t), b.connect(t)
+	idA, idB := ca.do("CLUSTER", "MYID").Str, cb.do("CLUSTER", "MYID").Str
+	slot := strconv.Itoa(keyHashSlot("bar"))
+	ca.mustDo("1", "RPUSH", "{bar}present", "1")
+	cb.mustDo("OK", "CLUSTER", "SETSLOT", slot, "IMPORTING", idA)
+	ca.mustDo("OK", "CLUSTER", "SETSLOT", slot, "MIGRATING", idB)
+
+	// 迁出的节点执行键还在本节点的命令，键已经不在时返回 ASK
+	ca.mustDo("[1]", "LRANGE", "{bar}present", "0", "-1")
+	ca.mustDo("(error) ASK "+slot+" "+b.addr, "GET", "{bar}moved")
+	ca.mustDo("(error) TRYAGAIN Multiple keys request during rehashing of slot", "SUNION", "{bar}present", "{bar}moved")
+
+	// 迁入的节点只执行 ASKING 之后的一条命令
+	cb.mustDo("(error) MOVED "+slot+" "+a.addr, "SET", "{bar}moved", "2")
+	cb.mustDo("OK", "ASKING")
+	cb.mustDo("OK", "SET", "{bar}moved", "2")
+	cb.mustDo("(error) MOVED "+slot+" "+a.addr, "GET", "{bar}moved")
+	cb.mustDo("OK", "ASKING")
+	cb.mustDo("2", "GET", "{bar}moved")
+
+	// 迁移完成后槽由迁入的节点负责
+	ca.mustDo("1", "LPOP", "{bar}present")
+	cb.mustDo("OK", "CLUSTER", "SETSLOT", slot, "NODE", idB)
+	ca.mustDo("OK", "CLUSTER", "SETSLOT", slot, "NODE", idB)
+	ca.mustDo("(error) MOVED "+slot+" "+b.addr, "GET", "{bar}moved")
+	cb.mustDo("2", "GET", "{bar}moved")
+}
+
+func TestClusterIntrospection(t *testing.T) {
+	a, b := startTestCluster(t)
+	ca := a.connect(t)
+	idA, idB := ca.do("CLUSTER", "MYID").Str, b.connect(t).do("CLUSTER", "MYID").Str
+	if idA != a.rs.cluster.myself.name || len(idB) != 40 {
+		t.Fatalf("CLUSTER MYID returned %q and %q", idA, idB)
+	}
+
+	info := ca.do("CLUSTER", "INFO").Str
+	for field, want := range map[string]string{
+		"cluster_state":          "ok",
+		"cluster_slots_assigned": "16384",
+		"cluster_known_nodes":    "2",
+		"cluster_size":           "2",
+	} {
+		if got := infoValue(t, info, field); got != want {
+			t.Errorf("%s:%s, want %s", field, got, want)
+		}
+	}
+
+	// CLUSTER NODES 每行一个节点：ID、地址、标志、……、负责的槽
+	nodes := strings.Split(strings.TrimSpace(ca.do("CLUSTER", "NODES").Str), "\n")
+	if len(nodes) != 2 {
+		t.Fatalf("CLUSTER NODES:\n%s", strings.Join(nodes, "\n"))
+	}
+	for _, line := range nodes {
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case idA:
+			if fields[2] != "myself,master" || fields[len(fields)-1] != "0-8191" {
+				t.Errorf("CLUSTER NODES line for myself: %s", line)
+			}
+		case idB:
+			if fields[2] != "master" || !strings.HasPrefix(fields[1], b.addr) || fields[len(fields)-1] != "8192-16383" {
+				t.Errorf("CLUSTER NODES line for the other node: %s", line)
+			}
+		default:
+			t.Errorf("unknown node in CLUSTER NODES: %s", line)
+		}
+	}
+
+	hostA, portA, _ := strings.Cut(a.addr, ":")
+	hostB, portB, _ := strings.Cut(b.addr, ":")
+	ca.mustDo(fmt.Sprintf("[[0 8191 [%s %s %s []]] [8192 16383 [%s %s %s []]]]", hostA, portA, idA, hostB, portB, idB), "CLUSTER", "SLOTS")
+	if shards := ca.do("CLUSTER", "SHARDS"); len(shards.Array) != 2 {
+		t.Fatalf("CLUSTER SHARDS: %s", replyString(shards))
+	}
+}
@@ -0,0 +1,15 @@
+// goredis 是服务器的命令行入口，参数见 goredis.Main
+package main
+
+import (
+	"log"
+	"os"
+
+	goredis "goRedis"
+)
+
+func main() {
+	if err := goredis.Main(os.Args[1:], nil); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,54 @@
+package goredis
+
+import "math"
+
+// CountMinSketch 表示 Count-Min Sketch 类型的值
+//
+// depth 行、每行 width 个计数器，元素在每一行按以行号为种子的哈希落到一个计数器上。
+// 增加计数时每行对应的计数器都加上增量，查询时取各行计数器的最小值：
+// 哈希冲突只会让估计值偏大，不会偏小。计数器为 32 位无符号整数，溢出时饱和。
+type CountMinSketch struct {
+	width    uint64
+	depth    uint64
+	counters []uint32
+	count    uint64 // 所有增量之和
+}
+
+// NewCountMinSketch 创建指定宽度和深度的 Count-Min Sketch
+func NewCountMinSketch(width, depth uint64) *CountMinSketch {
+	return &CountMinSketch{
+		width:    width,
+		depth:    depth,
+		counters: make([]uint32, width*depth),
+	}
+}
+
+// counterIndex 返回元素在第 row 行对应的计数器下标
+func (cms *CountMinSketch) counterIndex(item []byte, row uint64) uint64 {
+	return row*cms.width + murmurHash64A(item, row)%cms.width
+}
+
+// IncrBy 将元素的计数增加 incr，返回增加后的估计值
+func (cms *CountMinSketch) IncrBy(item []byte, incr uint32) uint32 {
+	minCount := uint32(math.MaxUint32)
+	for row := uint64(0); row < cms.depth; row++ {
+		i := cms.counterIndex(item, row)
+		if cms.counters[i] > math.MaxUint32-incr {
+			cms.counters[i] = math.MaxUint32
+		} else {
+			cms.counters[i] += incr
+		}
+		minCount = min(minCount, cms.counters[i])
+	}
+	cms.count += uint64(incr)
+	return minCount
+}
+
+// Query 返回元素计数的估计值
+func (cms *CountMinSketch) Query(item []byte) uint32 {
+	minCount := uint32(math.MaxUint32)
+	for row := uint64(0); row < cms.depth; row++ {
+		minCount = min(minCount, cms.counters[cms.counterIndex(item, row)])
+	}
+	return minCount
+}
@@ -0,0 +1,116 @@
+package goredis
+
+import (
+	"math"
+	"strconv"
+)
+
+// cmsMaxCounters 限制单个 Count-Min Sketch 的计数器总数，避免一条命令分配过多内存
+const cmsMaxCounters = 1 << 28
+
+// lookupCMS 查找 Count-Min Sketch，键不存在或类型不匹配时返回错误响应（调用方需持有锁）
+func (db *redisDb) lookupCMS(key string) (*CountMinSketch, *RESPValue) {
+	obj := db.lookupKey(key)
+	if obj == nil {
+		return nil, NewErrorValue("CMS: key does not exist")
+	}
+	if obj.Type != OBJ_CMS {
+		return nil, NewErrorValue(wrongTypeErr)
+	}
+	return obj.Value.(*CountMinSketch), nil
+}
+
+// lookupCMSWrite 与 lookupCMS 相同，用于原地修改Count-Min Sketch（调用方需持有写锁）
+func (db *redisDb) lookupCMSWrite(key string) (*CountMinSketch, *RESPValue) {
+	db.lookupKeyWrite(key)
+	return db.lookupCMS(key)
+}
+
+// handleCMSInitByDim 处理 CMS.INITBYDIM 命令
+func (rs *RedisServer) handleCMSInitByDim(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 {
+		return wrongArgsError("cms.initbydim")
+	}
+	width, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil || width == 0 {
+		return NewErrorValue("CMS: invalid width")
+	}
+	depth, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil || depth == 0 {
+		return NewErrorValue("CMS: invalid depth")
+	}
+	if width > cmsMaxCounters/depth {
+		return NewErrorValue("CMS: width * depth is too large")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if c.db.lookupKey(args[0]) != nil {
+		return NewErrorValue("CMS: key already exists")
+	}
+	c.db.store.Set(args[0], NewCMSObject(width, depth))
+	rs.signalModifiedKey(c.db, args[0])
+	return NewSimpleStringValue("OK")
+}
+
+// handleCMSIncrBy 处理 CMS.INCRBY 命令，返回每个元素增加后的估计计数
+func (rs *RedisServer) handleCMSIncrBy(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 || len(args)%2 != 1 {
+		return wrongArgsError("cms.incrby")
+	}
+	incrs := make([]uint32, 0, len(args)/2)
+	for i := 2; i < len(args); i += 2 {
+		incr, err := strconv.ParseInt(args[i], 10, 64)
+		if err != nil || incr < 0 || incr > math.MaxUint32 {
+			return NewErrorValue("CMS: Cannot parse number")
+		}
+		incrs = append(incrs, uint32(incr))
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	cms, errResp := c.db.lookupCMSWrite(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	replies := make([]*RESPValue, len(incrs))
+	for i, incr := range incrs {
+		replies[i] = NewIntegerValue(int64(cms.IncrBy([]byte(args[1+2*i]), incr)))
+	}
+	rs.signalModifiedKey(c.db, args[0])
+	return NewArrayValue(replies)
+}
+
+// handleCMSQuery 处理 CMS.QUERY 命令，返回每个元素的估计计数
+func (rs *RedisServer) handleCMSQuery(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("cms.query")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	cms, errResp := c.db.lookupCMS(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	replies := make([]*RESPValue, len(args)-1)
+	for i, item := range args[1:] {
+		replies[i] = NewIntegerValue(int64(cms.Query([]byte(item))))
+	}
+	return NewArrayValue(replies)
+}
@@ -0,0 +1,124 @@
+package goredis
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCountMinSketchNeverUnderestimates(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	cms := NewCountMinSketch(200, 5)
+	exact := make(map[string]uint32)
+	for i := 0; i < 20000; i++ {
+		item := "i" + strconv.Itoa(int(r.ExpFloat64()*50))
+		incr := uint32(1 + r.Intn(3))
+		exact[item] += incr
+		if got := cms.IncrBy([]byte(item), incr); got < exact[item] {
+			t.Fatalf("IncrBy(%s) = %d, below exact count %d", item, got, exact[item])
+		}
+	}
+	for item, want := range exact {
+		if got := cms.Query([]byte(item)); got < want {
+			t.Fatalf("Query(%s) = %d, below exact count %d", item, got, want)
+		}
+	}
+}
+
+func TestCMSCommands(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(error) CMS: key does not exist", "CMS.QUERY", "cms", "a")
+	c.mustDo("OK", "CMS.INITBYDIM", "cms", "2000", "5")
+	c.mustDo("(error) CMS: key already exists", "CMS.INITBYDIM", "cms", "2000", "5")
+	c.mustDo("[5 3]", "CMS.INCRBY", "cms", "a", "5", "b", "3")
+	c.mustDo("[7]", "CMS.INCRBY", "cms", "a", "2")
+	c.mustDo("[7 3 0]", "CMS.QUERY", "cms", "a", "b", "c")
+	c.mustDo("(error) CMS: Cannot parse number", "CMS.INCRBY", "cms", "a", "x")
+	c.mustDo("(error) CMS: invalid width", "CMS.INITBYDIM", "cms2", "0", "5")
+	c.mustDo("OK", "SET", "str", "x")
+	c.mustDo("(error) WRONGTYPE Operation against a key holding the wrong kind of value", "CMS.QUERY", "str", "a")
+}
+
+func TestTopKCommands(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(error) TopK: key does not exist", "TOPK.LIST", "tk")
+	c.mustDo("OK", "TOPK.RESERVE", "tk", "2", "50", "5", "0.9")
+	c.mustDo("(error) TopK: key already exists", "TOPK.RESERVE", "tk", "2")
+
+	// 没有元素被挤出时返回 null
+	c.mustDo("[(nil) (nil)]", "TOPK.ADD", "tk", "a", "a")
+	for i := 0; i < 5; i++ {
+		c.do("TOPK.ADD", "tk", "b", "b", "c")
+	}
+	c.mustDo("[b 10 c 5]", "TOPK.LIST", "tk", "WITHCOUNT")
+	// c 之外的新元素计数超过 c 后把它挤出前 k 名
+	for i := 0; i < 6; i++ {
+		c.do("TOPK.ADD", "tk", "d")
+	}
+	c.mustDo("[b d]", "TOPK.LIST", "tk")
+
+	c.mustDo("(error) TopK: invalid k", "TOPK.RESERVE", "tk2", "0")
+	c.mustDo("(error) TopK: invalid decay value. must be '<= 1' & '> 0'", "TOPK.RESERVE", "tk2", "1", "8", "7", "0")
+}
+
+func TestTopKDecayDeterministic(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	items := make([][]byte, 5000)
+	for i := range items {
+		items[i] = []byte("i" + strconv.Itoa(int(r.ExpFloat64()*20)))
+	}
+	// 桶很少，元素之间频繁冲突而触发衰减
+	a, b := NewTopK(5, 8, 3, 0.9), NewTopK(5, 8, 3, 0.9)
+	var restored *TopK
+	for i, item := range items {
+		if i == len(items)/2 {
+			obj, err := rdbRestoreObject(rdbDumpObject(&RedisObject{Type: OBJ_TOPK, Value: a}, false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			restored = obj.Value.(*TopK)
+		}
+		expelledA, expelledB := a.Add(item), b.Add(item)
+		if restored != nil {
+			if expelled := restored.Add(item); string(expelled) != string(expelledA) {
+				t.Fatalf("restored Add(%s) expelled %q, want %q", item, expelled, expelledA)
+			}
+		}
+		if string(expelledA) != string(expelledB) {
+			t.Fatalf("Add(%s) expelled %q and %q", item, expelledA, expelledB)
+		}
+	}
+	for _, topk := range []*TopK{b, restored} {
+		if !reflect.DeepEqual(topk.buckets, a.buckets) || !reflect.DeepEqual(topk.List(), a.List()) {
+			t.Fatal("Top-K fed the same items diverged")
+		}
+	}
+}
+
+func TestTopKReplicaAndAofMatchMaster(t *testing.T) {
+	master := startTestServer(t, "appendonly yes", "appendfsync always", "aof-use-rdb-preamble no")
+	c := master.connect(t)
+	c.mustDo("OK", "TOPK.RESERVE", "tk", "3", "4", "2", "0.9")
+	add := func(round int) {
+		for i := 0; i < 50; i++ {
+			c.do("TOPK.ADD", "tk", "a"+strconv.Itoa(i%7), "b"+strconv.Itoa((i+round)%5), "c")
+		}
+	}
+	// 全量同步带上发生器的状态，之后的命令在副本上得到同样的衰减
+	add(0)
+	replica := startReplica(t, master)
+	add(1)
+	c.mustDo("1", "WAIT", "1", "0")
+
+	want := replyString(c.do("TOPK.LIST", "tk", "WITHCOUNT"))
+	if got := replyString(replica.connect(t).do("TOPK.LIST", "tk", "WITHCOUNT")); got != want {
+		t.Fatalf("replica Top-K %s, master %s", got, want)
+	}
+	reloaded := startTestServerIn(t, master.dir, "appendonly yes")
+	if got := replyString(reloaded.connect(t).do("TOPK.LIST", "tk", "WITHCOUNT")); got != want {
+		t.Fatalf("Top-K reloaded from AOF %s, master %s", got, want)
+	}
+}
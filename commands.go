@@ -0,0 +1,377 @@
+package goredis
+
+import (
+	"strings"
+	"time"
+)
+
+// 命令标志
+const (
+	CMD_NO_MULTI     = 1 << iota // 不能在事务中排队
+	CMD_EXCLUSIVE                // 执行期间独占服务器，其他连接的命令都要等待
+	CMD_NO_SCRIPT                // 不能在脚本中调用
+	CMD_WRITE                    // 可能修改数据，只读脚本中不能调用
+	CMD_NO_PROPAGATE             // 自身不传播，其中执行的命令各自传播（EXEC、EVAL 等）
+)
+
+// commandProc 是命令的处理函数
+type commandProc func(rs *RedisServer, c *client, command *RESPValue) *RESPValue
+
+// redisCommand 描述一个命令
+type redisCommand struct {
+	name  string
+	proc  commandProc
+	arity int // 包括命令名在内的参数个数，-n 表示至少 n 个
+	flags int
+}
+
+// commandList 列出所有命令，参数个数与 Redis 相同
+var commandList = []*redisCommand{
+	// 通用
+	{"ping", (*RedisServer).handlePing, -1, 0},
+	{"echo", (*RedisServer).handleEcho, 2, 0},
+	{"set", (*RedisServer).handleSet, -3, CMD_WRITE},
+	{"get", (*RedisServer).handleGet, 2, 0},
+	{"quit", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue { return rs.handleQuit(c) }, -1, CMD_NO_SCRIPT},
+	{"hello", (*RedisServer).handleHello, -1, CMD_NO_SCRIPT},
+	{"info", (*RedisServer).handleInfo, -1, 0},
+	{"config", (*RedisServer).handleConfig, -2, CMD_NO_SCRIPT},
+	{"object", (*RedisServer).handleObject, -2, 0},
+	{"shutdown", (*RedisServer).handleShutdown, -1, CMD_NO_MULTI | CMD_NO_SCRIPT},
+	{"client", (*RedisServer).handleClient, -2, CMD_NO_SCRIPT},
+
+	// 键空间
+	{"del", (*RedisServer).handleDel, -2, CMD_WRITE},
+	{"keys", (*RedisServer).handleKeys, 2, 0},
+	{"scan", (*RedisServer).handleScan, -2, 0},
+	{"dbsize", (*RedisServer).handleDBSize, 1, 0},
+	{"flushdb", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleFlush(c, command, false)
+	}, -1, CMD_WRITE},
+	{"flushall", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleFlush(c, command, true)
+	}, -1, CMD_WRITE},
+	{"select", (*RedisServer).handleSelect, 2, 0},
+	{"swapdb", (*RedisServer).handleSwapDB, 3, CMD_WRITE},
+	{"move", (*RedisServer).handleMove, 3, CMD_WRITE},
+	{"dump", (*RedisServer).handleDump, 2, 0},
+	{"restore", (*RedisServer).handleRestore, -4, CMD_WRITE},
+
+	// 过期
+	{"expire", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleExpire(c, command, "expire", time.Second, false)
+	}, -3, CMD_WRITE},
+	{"pexpire", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleExpire(c, command, "pexpire", time.Millisecond, false)
+	}, -3, CMD_WRITE},
+	{"expireat", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleExpire(c, command, "expireat", time.Second, true)
+	}, -3, CMD_WRITE},
+	{"pexpireat", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleExpire(c, command, "pexpireat", time.Millisecond, true)
+	}, -3, CMD_WRITE},
+	{"ttl", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleTTL(c, command, false)
+	}, 2, 0},
+	{"pttl", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleTTL(c, command, true)
+	}, 2, 0},
+	{"expiretime", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleExpireTime(c, command, false)
+	}, 2, 0},
+	{"pexpiretime", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleExpireTime(c, command, true)
+	}, 2, 0},
+	{"persist", (*RedisServer).handlePersist, 2, CMD_WRITE},
+
+	// 事务
+	{"multi", (*RedisServer).handleMulti, 1, CMD_NO_SCRIPT},
+	{"exec", (*RedisServer).handleExec, 1, CMD_EXCLUSIVE | CMD_NO_SCRIPT | CMD_NO_PROPAGATE},
+	{"discard", (*RedisServer).handleDiscard, 1, CMD_NO_SCRIPT},
+	{"watch", (*RedisServer).handleWatch, -2, CMD_NO_SCRIPT},
+	{"unwatch", (*RedisServer).handleUnwatch, 1, CMD_NO_SCRIPT},
+
+	// 脚本
+	{"eval", (*RedisServer).handleEval, -3, CMD_EXCLUSIVE | CMD_NO_SCRIPT | CMD_NO_PROPAGATE},
+	{"evalsha", (*RedisServer).handleEvalSha, -3, CMD_EXCLUSIVE | CMD_NO_SCRIPT | CMD_NO_PROPAGATE},
+	{"script", (*RedisServer).handleScript, -2, CMD_EXCLUSIVE | CMD_NO_SCRIPT},
+	{"function", (*RedisServer).handleFunction, -2, CMD_EXCLUSIVE | CMD_NO_SCRIPT},
+	{"fcall", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleFCall(c, command, false)
+	}, -3, CMD_EXCLUSIVE | CMD_NO_SCRIPT | CMD_NO_PROPAGATE},
+	{"fcall_ro", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleFCall(c, command, true)
+	}, -3, CMD_EXCLUSIVE | CMD_NO_SCRIPT | CMD_NO_PROPAGATE},
+	{"gocall", (*RedisServer).handleGoCall, -3, CMD_EXCLUSIVE | CMD_NO_SCRIPT | CMD_NO_PROPAGATE},
+
+	// 持久化
+	{"save", (*RedisServer).handleSave, 1, CMD_NO_MULTI | CMD_NO_SCRIPT},
+	{"bgsave", (*RedisServer).handleBgsave, -1, CMD_NO_SCRIPT},
+	{"bgrewriteaof", (*RedisServer).handleBgrewriteaof, 1, CMD_NO_SCRIPT},
+	{"lastsave", (*RedisServer).handleLastSave, 1, 0},
+	{"waitaof", (*RedisServer).handleWaitaof, 4, CMD_NO_SCRIPT},
+
+	// 复制
+	{"replicaof", (*RedisServer).handleReplicaof, 3, CMD_NO_SCRIPT},
+	{"slaveof", (*RedisServer).handleReplicaof, 3, CMD_NO_SCRIPT},
+	{"psync", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleSync(c, command, true)
+	}, -3, CMD_NO_MULTI | CMD_NO_SCRIPT},
+	{"sync", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleSync(c, command, false)
+	}, 1, CMD_NO_MULTI | CMD_NO_SCRIPT},
+	{"replconf", (*RedisServer).handleReplconf, -1, CMD_NO_SCRIPT},
+	{"wait", (*RedisServer).handleWait, 3, CMD_NO_SCRIPT},
+	{"failover", (*RedisServer).handleFailover, -1, CMD_EXCLUSIVE | CMD_NO_MULTI | CMD_NO_SCRIPT},
+
+	// 集群
+	{"cluster", (*RedisServer).handleCluster, -2, CMD_NO_SCRIPT},
+	{"asking", (*RedisServer).handleAsking, 1, 0},
+
+	// 列表
+	{"lpush", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handlePush(c, command, "lpush", LIST_HEAD, false)
+	}, -3, CMD_WRITE},
+	{"rpush", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handlePush(c, command, "rpush", LIST_TAIL, false)
+	}, -3, CMD_WRITE},
+	{"lpushx", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handlePush(c, command, "lpushx", LIST_HEAD, true)
+	}, -3, CMD_WRITE},
+	{"rpushx", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handlePush(c, command, "rpushx", LIST_TAIL, true)
+	}, -3, CMD_WRITE},
+	{"lpop", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handlePop(c, command, "lpop", LIST_HEAD)
+	}, -2, CMD_WRITE},
+	{"rpop", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handlePop(c, command, "rpop", LIST_TAIL)
+	}, -2, CMD_WRITE},
+	{"blpop", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleBPop(c, command, "blpop", LIST_HEAD)
+	}, -3, CMD_WRITE},
+	{"brpop", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleBPop(c, command, "brpop", LIST_TAIL)
+	}, -3, CMD_WRITE},
+	{"llen", (*RedisServer).handleLLen, 2, 0},
+	{"lrange", (*RedisServer).handleLRange, 4, 0},
+	{"ltrim", (*RedisServer).handleLTrim, 4, CMD_WRITE},
+	{"lmove", (*RedisServer).handleLMove, 5, CMD_WRITE},
+	{"rpoplpush", (*RedisServer).handleRPopLPush, 3, CMD_WRITE},
+	{"blmove", (*RedisServer).handleBLMove, 6, CMD_WRITE},
+	{"brpoplpush", (*RedisServer).handleBRPopLPush, 4, CMD_WRITE},
+	{"lmpop", (*RedisServer).handleLMPop, -4, CMD_WRITE},
+	{"blmpop", (*RedisServer).handleBLMPop, -5, CMD_WRITE},
+	{"lpos", (*RedisServer).handleLPos, -3, 0},
+
+	// 哈希
+	{"hset", (*RedisServer).handleHSet, -4, CMD_WRITE},
+	{"hdel", (*RedisServer).handleHDel, -3, CMD_WRITE},
+	{"hget", (*RedisServer).handleHGet, 3, 0},
+	{"hexists", (*RedisServer).handleHExists, 3, 0},
+	{"hlen", (*RedisServer).handleHLen, 2, 0},
+	{"hgetall", (*RedisServer).handleHGetAll, 2, 0},
+
+	// 集合
+	{"sadd", (*RedisServer).handleSAdd, -3, CMD_WRITE},
+	{"srem", (*RedisServer).handleSRem, -3, CMD_WRITE},
+	{"smembers", (*RedisServer).handleSMembers, 2, 0},
+	{"sismember", (*RedisServer).handleSIsMember, 3, 0},
+	{"smismember", (*RedisServer).handleSMIsMember, -3, 0},
+	{"scard", (*RedisServer).handleSCard, 2, 0},
+	{"spop", (*RedisServer).handleSPop, -2, CMD_WRITE},
+	{"srandmember", (*RedisServer).handleSRandMember, -2, 0},
+	{"sinter", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleSetAlgebra(c, command, "sinter", SET_OP_INTER)
+	}, -2, 0},
+	{"sintercard", (*RedisServer).handleSInterCard, -3, 0},
+	{"sunion", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleSetAlgebra(c, command, "sunion", SET_OP_UNION)
+	}, -2, 0},
+	{"sdiff", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleSetAlgebra(c, command, "sdiff", SET_OP_DIFF)
+	}, -2, 0},
+	{"sinterstore", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleSetAlgebraStore(c, command, "sinterstore", SET_OP_INTER)
+	}, -3, CMD_WRITE},
+	{"sunionstore", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleSetAlgebraStore(c, command, "sunionstore", SET_OP_UNION)
+	}, -3, CMD_WRITE},
+	{"sdiffstore", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleSetAlgebraStore(c, command, "sdiffstore", SET_OP_DIFF)
+	}, -3, CMD_WRITE},
+	{"smove", (*RedisServer).handleSMove, 4, CMD_WRITE},
+	{"sscan", (*RedisServer).handleSScan, -3, 0},
+
+	// 有序集合
+	{"zadd", (*RedisServer).handleZAdd, -4, CMD_WRITE},
+	{"zincrby", (*RedisServer).handleZIncrBy, 4, CMD_WRITE},
+	{"zscore", (*RedisServer).handleZScore, 3, 0},
+	{"zmscore", (*RedisServer).handleZMScore, -3, 0},
+	{"zrange", (*RedisServer).handleZRange, -4, 0},
+	{"zrangestore", (*RedisServer).handleZRangeStore, -5, CMD_WRITE},
+	{"zrangebyscore", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZRangeByGeneric(c, command, "zrangebyscore", ZRANGE_SCORE, false)
+	}, -4, 0},
+	{"zrevrangebyscore", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZRangeByGeneric(c, command, "zrevrangebyscore", ZRANGE_SCORE, true)
+	}, -4, 0},
+	{"zrangebylex", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZRangeByGeneric(c, command, "zrangebylex", ZRANGE_LEX, false)
+	}, -4, 0},
+	{"zrevrangebylex", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZRangeByGeneric(c, command, "zrevrangebylex", ZRANGE_LEX, true)
+	}, -4, 0},
+	{"zcard", (*RedisServer).handleZCard, 2, 0},
+	{"zcount", (*RedisServer).handleZCount, 4, 0},
+	{"zlexcount", (*RedisServer).handleZLexCount, 4, 0},
+	{"zrem", (*RedisServer).handleZRem, -3, CMD_WRITE},
+	{"zremrangebyrank", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZRemRangeGeneric(c, command, "zremrangebyrank", ZRANGE_RANK)
+	}, 4, CMD_WRITE},
+	{"zremrangebyscore", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZRemRangeGeneric(c, command, "zremrangebyscore", ZRANGE_SCORE)
+	}, 4, CMD_WRITE},
+	{"zremrangebylex", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZRemRangeGeneric(c, command, "zremrangebylex", ZRANGE_LEX)
+	}, 4, CMD_WRITE},
+	{"zpopmin", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZPop(c, command, "zpopmin", false)
+	}, -2, CMD_WRITE},
+	{"zpopmax", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZPop(c, command, "zpopmax", true)
+	}, -2, CMD_WRITE},
+	{"bzpopmin", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleBZPop(c, command, "bzpopmin", false)
+	}, -3, CMD_WRITE},
+	{"bzpopmax", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleBZPop(c, command, "bzpopmax", true)
+	}, -3, CMD_WRITE},
+	{"zrandmember", (*RedisServer).handleZRandMember, -2, 0},
+	{"zscan", (*RedisServer).handleZScan, -3, 0},
+	{"zunion", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZSetOp(c, command, "zunion", SET_OP_UNION)
+	}, -3, 0},
+	{"zinter", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZSetOp(c, command, "zinter", SET_OP_INTER)
+	}, -3, 0},
+	{"zdiff", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZSetOp(c, command, "zdiff", SET_OP_DIFF)
+	}, -3, 0},
+	{"zunionstore", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZSetOpStore(c, command, "zunionstore", SET_OP_UNION)
+	}, -4, CMD_WRITE},
+	{"zinterstore", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZSetOpStore(c, command, "zinterstore", SET_OP_INTER)
+	}, -4, CMD_WRITE},
+	{"zdiffstore", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZSetOpStore(c, command, "zdiffstore", SET_OP_DIFF)
+	}, -4, CMD_WRITE},
+	{"zrank", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZRank(c, command, "zrank", false)
+	}, -3, 0},
+	{"zrevrank", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleZRank(c, command, "zrevrank", true)
+	}, -3, 0},
+
+	// 流
+	{"xadd", (*RedisServer).handleXAdd, -5, CMD_WRITE},
+	{"xrange", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleXRange(c, command, "xrange", false)
+	}, -4, 0},
+	{"xrevrange", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleXRange(c, command, "xrevrange", true)
+	}, -4, 0},
+	{"xlen", (*RedisServer).handleXLen, 2, 0},
+	{"xtrim", (*RedisServer).handleXTrim, -4, CMD_WRITE},
+	{"xsetid", (*RedisServer).handleXSetID, -3, CMD_WRITE},
+	{"xread", (*RedisServer).handleXRead, -4, 0},
+	{"xgroup", (*RedisServer).handleXGroup, -2, CMD_WRITE},
+	{"xreadgroup", (*RedisServer).handleXReadGroup, -7, CMD_WRITE},
+	{"xack", (*RedisServer).handleXAck, -4, CMD_WRITE},
+	{"xpending", (*RedisServer).handleXPending, -3, 0},
+	{"xclaim", (*RedisServer).handleXClaim, -6, CMD_WRITE},
+	{"xautoclaim", (*RedisServer).handleXAutoClaim, -6, CMD_WRITE},
+	{"xinfo", (*RedisServer).handleXInfo, -2, 0},
+
+	// 位图
+	{"setbit", (*RedisServer).handleSetBit, 4, CMD_WRITE},
+	{"getbit", (*RedisServer).handleGetBit, 3, 0},
+	{"bitcount", (*RedisServer).handleBitCount, -2, 0},
+	{"bitpos", (*RedisServer).handleBitPos, -3, 0},
+	{"bitop", (*RedisServer).handleBitOp, -4, CMD_WRITE},
+	{"bitfield", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleBitField(c, command, false)
+	}, -2, CMD_WRITE},
+	{"bitfield_ro", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleBitField(c, command, true)
+	}, -2, 0},
+
+	// HyperLogLog
+	{"pfadd", (*RedisServer).handlePFAdd, -2, CMD_WRITE},
+	{"pfcount", (*RedisServer).handlePFCount, -2, 0},
+	{"pfmerge", (*RedisServer).handlePFMerge, -2, CMD_WRITE},
+
+	// 地理位置
+	{"geoadd", (*RedisServer).handleGeoAdd, -5, CMD_WRITE},
+	{"geopos", (*RedisServer).handleGeoPos, -2, 0},
+	{"geodist", (*RedisServer).handleGeoDist, -4, 0},
+	{"geohash", (*RedisServer).handleGeoHash, -2, 0},
+	{"geosearch", (*RedisServer).handleGeoSearch, -7, 0},
+	{"geosearchstore", (*RedisServer).handleGeoSearchStore, -8, CMD_WRITE},
+	{"georadius", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleGeoRadius(c, command, "georadius", false)
+	}, -6, CMD_WRITE},
+	{"georadius_ro", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleGeoRadius(c, command, "georadius_ro", true)
+	}, -6, 0},
+	{"georadiusbymember", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleGeoRadiusByMember(c, command, "georadiusbymember", false)
+	}, -5, CMD_WRITE},
+	{"georadiusbymember_ro", func(rs *RedisServer, c *client, command *RESPValue) *RESPValue {
+		return rs.handleGeoRadiusByMember(c, command, "georadiusbymember_ro", true)
+	}, -5, 0},
+
+	// 发布订阅
+	{"subscribe", (*RedisServer).handleSubscribe, -2, CMD_NO_SCRIPT},
+	{"unsubscribe", (*RedisServer).handleUnsubscribe, -1, CMD_NO_SCRIPT},
+	{"psubscribe", (*RedisServer).handlePSubscribe, -2, CMD_NO_SCRIPT},
+	{"punsubscribe", (*RedisServer).handlePUnsubscribe, -1, CMD_NO_SCRIPT},
+	{"publish", (*RedisServer).handlePublish, 3, 0},
+	{"ssubscribe", (*RedisServer).handleSSubscribe, -2, CMD_NO_SCRIPT},
+	{"sunsubscribe", (*RedisServer).handleSUnsubscribe, -1, CMD_NO_SCRIPT},
+	{"spublish", (*RedisServer).handleSPublish, 3, 0},
+	{"pubsub", (*RedisServer).handlePubSub, -2, 0},
+
+	// Count-Min Sketch 与 Top-K
+	{"cms.initbydim", (*RedisServer).handleCMSInitByDim, 4, CMD_WRITE},
+	{"cms.incrby", (*RedisServer).handleCMSIncrBy, -4, CMD_WRITE},
+	{"cms.query", (*RedisServer).handleCMSQuery, -3, 0},
+	{"topk.reserve", (*RedisServer).handleTopKReserve, -3, CMD_WRITE},
+	{"topk.add", (*RedisServer).handleTopKAdd, -3, CMD_WRITE},
+	{"topk.list", (*RedisServer).handleTopKList, -2, 0},
+}
+
+// commandTable 以小写的命令名索引 commandList
+//
+// 在 init 中填充，避免与需要查表执行其他命令的处理函数形成初始化循环。
+var commandTable = make(map[string]*redisCommand)
+
+func init() {
+	for _, cmd := range commandList {
+		commandTable[cmd.name] = cmd
+	}
+}
+
+// lookupCommand 按名称（不区分大小写）查找命令，找不到时返回 nil
+func lookupCommand(name string) *redisCommand {
+	return commandTable[strings.ToLower(name)]
+}
+
+// checkArity 判断参数个数（包括命令名）是否符合命令的要求
+func (cmd *redisCommand) checkArity(argc int) bool {
+	if cmd.arity > 0 {
+		return argc == cmd.arity
+	}
+	return argc >= -cmd.arity
+}
@@ -0,0 +1,836 @@
+package goredis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configParam 描述一个可以通过 CONFIG GET/SET 访问的配置项
+//
+// get 和 set 在持有服务器写锁（CONFIG GET 时为读锁）的情况下调用。
+// immutable 的配置项只能在启动时指定，CONFIG SET 会拒绝修改；其中有 set 的可以在配置文件中设置。
+type configParam struct {
+	name      string
+	immutable bool
+	get       func(rs *RedisServer) string
+	set       func(rs *RedisServer, value string) error
+}
+
+// configParams 是所有支持的配置项
+var configParams = []*configParam{
+	{
+		name:      "bind",
+		immutable: true,
+		get:       func(rs *RedisServer) string { return rs.host },
+	},
+	{
+		name:      "port",
+		immutable: true,
+		get:       func(rs *RedisServer) string { return strconv.Itoa(rs.port) },
+	},
+	{
+		name:      "databases",
+		immutable: true,
+		get:       func(rs *RedisServer) string { return strconv.Itoa(len(rs.databases)) },
+	},
+	{
+		name: "client-output-buffer-limit",
+		get: func(rs *RedisServer) string {
+			return formatClientOutputBufferLimits(rs.clientOutputBufferLimits.Load())
+		},
+		set: func(rs *RedisServer, value string) error {
+			limits, err := parseClientOutputBufferLimits(value, rs.clientOutputBufferLimits.Load())
+			if err != nil {
+				return err
+			}
+			rs.clientOutputBufferLimits.Store(limits)
+			return nil
+		},
+	},
+	{
+		name: "lua-time-limit",
+		get:  func(rs *RedisServer) string { return strconv.FormatInt(rs.luaTimeLimit, 10) },
+		set:  setLuaTimeLimit,
+	},
+	{
+		name: "busy-reply-threshold",
+		get:  func(rs *RedisServer) string { return strconv.FormatInt(rs.luaTimeLimit, 10) },
+		set:  setLuaTimeLimit,
+	},
+	{
+		name: "dir",
+		get:  func(rs *RedisServer) string { return rs.dir },
+		set:  setDir,
+	},
+	{
+		name: "dbfilename",
+		get:  func(rs *RedisServer) string { return rs.dbfilename },
+		set: func(rs *RedisServer, value string) error {
+			if value == "" || filepath.Base(value) != value {
+				return errors.New("dbfilename can't be a path, just a filename")
+			}
+			rs.dbfilename = value
+			return nil
+		},
+	},
+	{
+		name: "rdbcompression",
+		get:  func(rs *RedisServer) string { return formatYesNo(rs.rdbCompression) },
+		set:  func(rs *RedisServer, value string) error { return parseYesNo(value, &rs.rdbCompression) },
+	},
+	{
+		name: "rdbchecksum",
+		get:  func(rs *RedisServer) string { return formatYesNo(rs.rdbChecksum) },
+		set:  func(rs *RedisServer, value string) error { return parseYesNo(value, &rs.rdbChecksum) },
+	},
+	{
+		name: "save",
+		get:  func(rs *RedisServer) string { return formatSaveParams(rs.saveParams) },
+		set: func(rs *RedisServer, value string) error {
+			params, err := parseSaveParams(value)
+			if err != nil {
+				return err
+			}
+			rs.saveParams = params
+			return nil
+		},
+	},
+	{
+		name: "appendonly",
+		get:  func(rs *RedisServer) string { return formatYesNo(rs.aofEnabled) },
+		set:  setAppendOnly,
+	},
+	{
+		name:      "appendfilename",
+		immutable: true,
+		get:       func(rs *RedisServer) string { return rs.aofFilename },
+		set: func(rs *RedisServer, value string) error {
+			if value == "" || filepath.Base(value) != value {
+				return errors.New("appendfilename can't be a path, just a filename")
+			}
+			rs.aofFilename = value
+			return nil
+		},
+	},
+	{
+		name: "aof-load-truncated",
+		get:  func(rs *RedisServer) string { return formatYesNo(rs.aofLoadTruncated) },
+		set:  func(rs *RedisServer, value string) error { return parseYesNo(value, &rs.aofLoadTruncated) },
+	},
+	{
+		name: "aof-use-rdb-preamble",
+		get:  func(rs *RedisServer) string { return formatYesNo(rs.aofUseRdbPreamble) },
+		set:  func(rs *RedisServer, value string) error { return parseYesNo(value, &rs.aofUseRdbPreamble) },
+	},
+	{
+		name: "appendfsync",
+		get:  func(rs *RedisServer) string { return aofFsyncNames[rs.aofFsync.Load()] },
+		set: func(rs *RedisServer, value string) error {
+			policy, err := parseAofFsync(value)
+			if err != nil {
+				return err
+			}
+			rs.aofFsync.Store(policy)
+			return nil
+		},
+	},
+	{
+		name: "auto-aof-rewrite-percentage",
+		get:  func(rs *RedisServer) string { return strconv.FormatInt(rs.aofRewritePerc.Load(), 10) },
+		set: func(rs *RedisServer, value string) error {
+			perc, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || perc < 0 {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			rs.aofRewritePerc.Store(perc)
+			return nil
+		},
+	},
+	{
+		name: "auto-aof-rewrite-min-size",
+		get:  func(rs *RedisServer) string { return strconv.FormatInt(rs.aofRewriteMinSize.Load(), 10) },
+		set: func(rs *RedisServer, value string) error {
+			size, ok := parseMemory(value)
+			if !ok {
+				return errors.New("argument must be a memory value")
+			}
+			rs.aofRewriteMinSize.Store(size)
+			return nil
+		},
+	},
+	{
+		name: "notify-keyspace-events",
+		get:  func(rs *RedisServer) string { return formatNotifyFlags(rs.notifyKeyspaceEvents) },
+		set: func(rs *RedisServer, value string) error {
+			flags, err := parseNotifyFlags(value)
+			if err != nil {
+				return err
+			}
+			rs.notifyKeyspaceEvents = flags
+			return nil
+		},
+	},
+	{
+		name: "repl-backlog-size",
+		get: func(rs *RedisServer) string {
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			return strconv.FormatInt(rs.replBacklogSize, 10)
+		},
+		set: setReplBacklogSize,
+	},
+	{
+		name: "repl-backlog-ttl",
+		get: func(rs *RedisServer) string {
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			return strconv.FormatInt(rs.replBacklogTTL, 10)
+		},
+		set: func(rs *RedisServer, value string) error {
+			ttl, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || ttl < 0 {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			rs.replBacklogTTL = ttl
+			return nil
+		},
+	},
+	{
+		name: "repl-diskless-sync",
+		get: func(rs *RedisServer) string {
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			return formatYesNo(rs.replDisklessSync)
+		},
+		set: func(rs *RedisServer, value string) error {
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			return parseYesNo(value, &rs.replDisklessSync)
+		},
+	},
+	{
+		name: "repl-diskless-sync-delay",
+		get: func(rs *RedisServer) string {
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			return strconv.FormatInt(rs.replDisklessSyncDelay, 10)
+		},
+		set: func(rs *RedisServer, value string) error {
+			delay, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || delay < 0 {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			rs.replDisklessSyncDelay = delay
+			return nil
+		},
+	},
+	{
+		name: "repl-diskless-sync-max-replicas",
+		get: func(rs *RedisServer) string {
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			return strconv.FormatInt(rs.replDisklessSyncMaxReplicas, 10)
+		},
+		set: func(rs *RedisServer, value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			rs.replDisklessSyncMaxReplicas = n
+			return nil
+		},
+	},
+	{
+		name: "replica-read-only",
+		get:  getReplicaReadOnly,
+		set:  setReplicaReadOnly,
+	},
+	{
+		name: "slave-read-only",
+		get:  getReplicaReadOnly,
+		set:  setReplicaReadOnly,
+	},
+	{
+		name: "replica-priority",
+		get:  getReplicaPriority,
+		set:  setReplicaPriority,
+	},
+	{
+		name: "slave-priority",
+		get:  getReplicaPriority,
+		set:  setReplicaPriority,
+	},
+	{
+		name: "replica-announced",
+		get: func(rs *RedisServer) string {
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			return formatYesNo(rs.replicaAnnounced)
+		},
+		set: func(rs *RedisServer, value string) error {
+			rs.replMu.Lock()
+			defer rs.replMu.Unlock()
+			return parseYesNo(value, &rs.replicaAnnounced)
+		},
+	},
+	{
+		name:      "replicaof",
+		immutable: true,
+		get:       getReplicaof,
+		set:       setReplicaof,
+	},
+	{
+		name:      "slaveof",
+		immutable: true,
+		get:       getReplicaof,
+		set:       setReplicaof,
+	},
+	{
+		name:      "cluster-enabled",
+		immutable: true,
+		get:       func(rs *RedisServer) string { return formatYesNo(rs.clusterEnabled) },
+		set: func(rs *RedisServer, value string) error {
+			return parseYesNo(value, &rs.clusterEnabled)
+		},
+	},
+	{
+		name:      "cluster-config-file",
+		immutable: true,
+		get:       func(rs *RedisServer) string { return rs.clusterConfigFile },
+		set: func(rs *RedisServer, value string) error {
+			if value == "" || filepath.Base(value) != value {
+				return errors.New("cluster-config-file can't be a path, just a filename")
+			}
+			rs.clusterConfigFile = value
+			return nil
+		},
+	},
+	{
+		name: "cluster-require-full-coverage",
+		get: func(rs *RedisServer) string {
+			rs.clusterMu.RLock()
+			defer rs.clusterMu.RUnlock()
+			return formatYesNo(rs.clusterRequireFullCoverage)
+		},
+		set: func(rs *RedisServer, value string) error {
+			rs.clusterMu.Lock()
+			defer rs.clusterMu.Unlock()
+			if err := parseYesNo(value, &rs.clusterRequireFullCoverage); err != nil {
+				return err
+			}
+			if rs.cluster != nil {
+				rs.clusterUpdateState()
+			}
+			return nil
+		},
+	},
+	{
+		name: "cluster-allow-reads-when-down",
+		get: func(rs *RedisServer) string {
+			rs.clusterMu.RLock()
+			defer rs.clusterMu.RUnlock()
+			return formatYesNo(rs.clusterAllowReadsWhenDown)
+		},
+		set: func(rs *RedisServer, value string) error {
+			rs.clusterMu.Lock()
+			defer rs.clusterMu.Unlock()
+			return parseYesNo(value, &rs.clusterAllowReadsWhenDown)
+		},
+	},
+	{
+		name: "cluster-node-timeout",
+		get: func(rs *RedisServer) string {
+			rs.clusterMu.RLock()
+			defer rs.clusterMu.RUnlock()
+			return strconv.FormatInt(rs.clusterNodeTimeout, 10)
+		},
+		set: func(rs *RedisServer, value string) error {
+			timeout, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || timeout <= 0 {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			rs.clusterMu.Lock()
+			defer rs.clusterMu.Unlock()
+			rs.clusterNodeTimeout = timeout
+			return nil
+		},
+	},
+}
+
+// setLuaTimeLimit 设置脚本超时时间，lua-time-limit 和 busy-reply-threshold 是同一个配置项，0 表示不限制
+func setLuaTimeLimit(rs *RedisServer, value string) error {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		return errors.New("argument couldn't be parsed into an integer")
+	}
+	rs.luaTimeLimit = ms
+	return nil
+}
+
+// replBacklogMinSize 是复制积压缓冲区的最小大小，设置得更小时使用这个大小
+const replBacklogMinSize = 16 * 1024
+
+// setReplBacklogSize 设置复制积压缓冲区的大小，已有的缓冲区立即改变大小，保留最近的命令流
+func setReplBacklogSize(rs *RedisServer, value string) error {
+	size, ok := parseMemory(value)
+	if !ok || size <= 0 {
+		return errors.New("argument must be a memory value")
+	}
+	size = max(size, replBacklogMinSize)
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	rs.replBacklogSize = size
+	if rs.replBacklog != nil && int64(len(rs.replBacklog.buf)) != size {
+		rs.replBacklog.resize(size)
+	}
+	return nil
+}
+
+// getReplicaReadOnly 和 setReplicaReadOnly 访问 replica-read-only 配置，slave-read-only 是同一个配置项
+func getReplicaReadOnly(rs *RedisServer) string {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	return formatYesNo(rs.replicaReadOnly)
+}
+
+func setReplicaReadOnly(rs *RedisServer, value string) error {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	return parseYesNo(value, &rs.replicaReadOnly)
+}
+
+// getReplicaPriority 和 setReplicaPriority 访问 replica-priority 配置，slave-priority 是同一个配置项
+func getReplicaPriority(rs *RedisServer) string {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	return strconv.FormatInt(rs.replicaPriority, 10)
+}
+
+func setReplicaPriority(rs *RedisServer, value string) error {
+	priority, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || priority < 0 || priority > math.MaxInt32 {
+		return errors.New("argument couldn't be parsed into an integer")
+	}
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	rs.replicaPriority = priority
+	return nil
+}
+
+// getReplicaof 返回主节点的 host port，本节点是主节点时为空字符串
+func getReplicaof(rs *RedisServer) string {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if rs.masterHost == "" {
+		return ""
+	}
+	return rs.masterHost + " " + strconv.Itoa(rs.masterPort)
+}
+
+// setReplicaof 在配置文件中设置主节点，replicaof 和 slaveof 是同一个配置项，Start 时开始同步
+func setReplicaof(rs *RedisServer, value string) error {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return errors.New("wrong number of arguments")
+	}
+	port, err := strconv.Atoi(fields[1])
+	if err != nil || port < 0 || port > 65535 {
+		return errors.New("Invalid master port")
+	}
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	rs.masterHost, rs.masterPort = fields[0], port
+	return nil
+}
+
+// parseYesNo 解析 yes/no 形式的布尔配置（不区分大小写）
+func parseYesNo(value string, dst *bool) error {
+	switch strings.ToLower(value) {
+	case "yes":
+		*dst = true
+	case "no":
+		*dst = false
+	default:
+		return errors.New("argument must be 'yes' or 'no'")
+	}
+	return nil
+}
+
+// formatYesNo 以 yes/no 输出布尔配置
+func formatYesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// setDir 设置 RDB 文件所在的目录，保存为绝对路径，目录必须已经存在
+//
+// 与 Redis 不同，服务器不切换工作目录，只在保存文件时使用这个目录。
+func setDir(rs *RedisServer, value string) error {
+	dir, err := filepath.Abs(value)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("No such file or directory")
+		}
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("Not a directory")
+	}
+	rs.dir = dir
+	return nil
+}
+
+// parseClientOutputBufferLimits 解析 client-output-buffer-limit 配置
+//
+// 配置由若干组 <class> <hard> <soft> <soft seconds> 组成，只有出现的类别被修改，
+// 其余类别沿用 old 中的限制。
+func parseClientOutputBufferLimits(value string, old *[CLIENT_TYPE_COUNT]clientBufferLimit) (*[CLIENT_TYPE_COUNT]clientBufferLimit, error) {
+	fields := strings.Fields(value)
+	if len(fields)%4 != 0 {
+		return nil, errors.New("Wrong number of arguments in buffer limit configuration.")
+	}
+	limits := *old
+	for i := 0; i < len(fields); i += 4 {
+		class := clientTypeByName(fields[i])
+		if class < 0 {
+			return nil, errors.New("Invalid client class specified in buffer limit configuration.")
+		}
+		hard, hardOk := parseMemory(fields[i+1])
+		soft, softOk := parseMemory(fields[i+2])
+		softSeconds, err := strconv.ParseInt(fields[i+3], 10, 64)
+		if !hardOk || !softOk || err != nil || softSeconds < 0 {
+			return nil, errors.New("Error in hard, soft or soft_seconds setting in buffer limit configuration.")
+		}
+		limits[class] = clientBufferLimit{hard: hard, soft: soft, softSeconds: softSeconds}
+	}
+	return &limits, nil
+}
+
+// formatClientOutputBufferLimits 按配置的格式输出所有类别的限制，大小以字节为单位
+func formatClientOutputBufferLimits(limits *[CLIENT_TYPE_COUNT]clientBufferLimit) string {
+	parts := make([]string, 0, CLIENT_TYPE_COUNT)
+	for class, limit := range limits {
+		parts = append(parts, fmt.Sprintf("%s %d %d %d", clientTypeNames[class], limit.hard, limit.soft, limit.softSeconds))
+	}
+	return strings.Join(parts, " ")
+}
+
+// lookupConfigParam 按名称（不区分大小写）查找配置项
+func lookupConfigParam(name string) *configParam {
+	for _, param := range configParams {
+		if strings.EqualFold(param.name, name) {
+			return param
+		}
+	}
+	return nil
+}
+
+// handleConfig 处理 CONFIG 命令，支持 GET 和 SET 子命令
+func (rs *RedisServer) handleConfig(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("config")
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if len(args) < 2 {
+			return wrongArgsError("config|get")
+		}
+		return rs.configGet(args[1:])
+	case "SET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return wrongArgsError("config|set")
+		}
+		// 打开 AOF 时要重写当前数据集，期间不能有写命令修改了数据集而还没有传播
+		rs.propagateMu.Lock()
+		defer rs.propagateMu.Unlock()
+		return rs.configSet(args[1:])
+	default:
+		return NewErrorValue("ERR unknown subcommand '" + args[0] + "'. Try CONFIG HELP.")
+	}
+}
+
+// configGet 以映射返回名称匹配任一 glob 模式的配置项，RESP2 下名称、值交替排列
+func (rs *RedisServer) configGet(patterns []string) *RESPValue {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	var matched []*configParam
+	for _, param := range configParams {
+		for _, pattern := range patterns {
+			if stringMatch(pattern, param.name, true) {
+				matched = append(matched, param)
+				break
+			}
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].name < matched[j].name })
+
+	replies := make([]*RESPValue, 0, 2*len(matched))
+	for _, param := range matched {
+		replies = append(replies, NewBulkStringValue(param.name), NewBulkStringValue(param.get(rs)))
+	}
+	return NewMapValue(replies)
+}
+
+// configSet 设置一个或多个配置项
+//
+// 所有名称先全部检查，任何一个设置失败时已经设置的配置项会恢复原值，
+// 因此一条 CONFIG SET 要么全部生效，要么都不生效。
+func (rs *RedisServer) configSet(pairs []string) *RESPValue {
+	params := make([]*configParam, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		param := lookupConfigParam(pairs[i])
+		if param == nil {
+			return NewErrorValue("ERR Unknown option or number of arguments for CONFIG SET - '" + pairs[i] + "'")
+		}
+		if param.immutable {
+			return configSetError(pairs[i], "can't set immutable config")
+		}
+		for _, prev := range params {
+			if prev == param {
+				return configSetError(pairs[i], "duplicate parameter")
+			}
+		}
+		params = append(params, param)
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	olds := make([]string, len(params))
+	for i, param := range params {
+		olds[i] = param.get(rs)
+	}
+	for i, param := range params {
+		if err := param.set(rs, pairs[2*i+1]); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				params[j].set(rs, olds[j])
+			}
+			return configSetError(pairs[2*i], err.Error())
+		}
+	}
+	return NewSimpleStringValue("OK")
+}
+
+// configSetError 返回 CONFIG SET 失败的错误
+func configSetError(name, reason string) *RESPValue {
+	return NewErrorValue("ERR CONFIG SET failed (possibly related to argument '" + name + "') - " + reason)
+}
+
+// configDirective 是配置文件中的一条指令，name 为小写的配置项名称
+type configDirective struct {
+	line int
+	text string
+	name string
+	args []string
+}
+
+// configFileError 返回配置文件中某条指令的错误，格式与 Redis 启动时的报错相同
+func configFileError(d configDirective, reason string) error {
+	return fmt.Errorf("\n*** FATAL CONFIG FILE ERROR ***\nReading the configuration file, at line %d\n>>> '%s'\n%s", d.line, d.text, reason)
+}
+
+// loadConfigFile 读取配置文件，返回其中的指令
+//
+// 格式与 redis.conf 相同：每行一条指令，指令名之后是参数，参数可以用单引号或双引号括起来；
+// 空行和以 # 开头的行被忽略。
+func loadConfigFile(path string) ([]configDirective, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Fatal error, can't open config file '%s': %v", path, err)
+	}
+	var directives []configDirective
+	for i, text := range strings.Split(string(content), "\n") {
+		text = strings.TrimSpace(text)
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		d := configDirective{line: i + 1, text: text}
+		fields, ok := splitConfigArgs(text)
+		if !ok {
+			return nil, configFileError(d, "Unbalanced quotes in configuration line")
+		}
+		d.name = strings.ToLower(fields[0])
+		d.args = fields[1:]
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+// splitConfigArgs 按 Redis 的 sdssplitargs 规则拆分一行配置
+//
+// 双引号中支持 \n、\t 等转义和 \xHH 形式的十六进制字节，单引号中只支持 \'，
+// 右引号之后必须是空白或行尾，引号不配对时返回 false。
+func splitConfigArgs(line string) ([]string, bool) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i == len(line) {
+			return args, true
+		}
+		var arg []byte
+		switch line[i] {
+		case '"':
+			i++
+			for {
+				if i >= len(line) {
+					return nil, false
+				}
+				c := line[i]
+				if c == '"' {
+					i++
+					break
+				}
+				if c == '\\' && i+1 < len(line) {
+					if line[i+1] == 'x' && i+3 < len(line) {
+						if v, err := strconv.ParseUint(line[i+2:i+4], 16, 8); err == nil {
+							arg = append(arg, byte(v))
+							i += 4
+							continue
+						}
+					}
+					switch line[i+1] {
+					case 'n':
+						c = '\n'
+					case 'r':
+						c = '\r'
+					case 't':
+						c = '\t'
+					case 'b':
+						c = '\b'
+					case 'a':
+						c = '\a'
+					default:
+						c = line[i+1]
+					}
+					i++
+				}
+				arg = append(arg, c)
+				i++
+			}
+		case '\'':
+			i++
+			for {
+				if i >= len(line) {
+					return nil, false
+				}
+				c := line[i]
+				if c == '\'' {
+					i++
+					break
+				}
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+				}
+				arg = append(arg, line[i])
+				i++
+			}
+		default:
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				arg = append(arg, line[i])
+				i++
+			}
+			args = append(args, string(arg))
+			continue
+		}
+		if i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			return nil, false
+		}
+		args = append(args, string(arg))
+	}
+}
+
+// startupConfig 从配置文件的指令中取出创建服务器之前就要确定的监听地址、端口和数据库数量
+func startupConfig(directives []configDirective, host *string, port, databases *int) error {
+	for _, d := range directives {
+		switch d.name {
+		case "bind":
+			// 服务器只监听一个地址，bind 列出多个地址时使用第一个
+			if len(d.args) == 0 {
+				return configFileError(d, "Bad directive or wrong number of arguments")
+			}
+			*host = d.args[0]
+		case "port", "databases":
+			if len(d.args) != 1 {
+				return configFileError(d, "Bad directive or wrong number of arguments")
+			}
+			n, err := strconv.Atoi(d.args[0])
+			if d.name == "port" {
+				if err != nil || n < 0 || n > 65535 {
+					return configFileError(d, "Invalid port")
+				}
+				*port = n
+			} else {
+				if err != nil || n < 1 {
+					return configFileError(d, "Invalid number of databases")
+				}
+				*databases = n
+			}
+		}
+	}
+	return nil
+}
+
+// applyConfigFile 把配置文件中的其余指令应用到刚创建的服务器
+//
+// 多行 save 指令的规则合并在一起，save "" 清除之前的规则；第一条 save 指令替换默认规则。
+// bind、port 等创建服务器之前就要确定的配置项已由 startupConfig 处理，这里跳过。
+func (rs *RedisServer) applyConfigFile(directives []configDirective) error {
+	var saveParams []saveParam
+	saveSeen := false
+	for _, d := range directives {
+		param := lookupConfigParam(d.name)
+		if param == nil || len(d.args) == 0 {
+			return configFileError(d, "Bad directive or wrong number of arguments")
+		}
+		if param.set == nil {
+			continue
+		}
+		value := strings.Join(d.args, " ")
+		if d.name == "save" {
+			params, err := parseSaveParams(value)
+			if err != nil {
+				return configFileError(d, err.Error())
+			}
+			if !saveSeen || len(params) == 0 {
+				saveParams = nil
+			}
+			saveParams = append(saveParams, params...)
+			saveSeen = true
+			continue
+		}
+		if err := param.set(rs, value); err != nil {
+			return configFileError(d, err.Error())
+		}
+	}
+	if saveSeen {
+		rs.saveParams = saveParams
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package goredis
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitConfigArgs(t *testing.T) {
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{`save 900 1`, []string{"save", "900", "1"}},
+		{`save ""`, []string{"save", ""}},
+		{"dir  \t/tmp/x ", []string{"dir", "/tmp/x"}},
+		{`dbfilename "a b.rdb"`, []string{"dbfilename", "a b.rdb"}},
+		{`x "\x41\n\"q"`, []string{"x", "A\n\"q"}},
+		{`x 'it\'s' 'a\nb'`, []string{"x", "it's", `a\nb`}},
+	}
+	for _, c := range cases {
+		got, ok := splitConfigArgs(c.line)
+		if !ok || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitConfigArgs(%q) = %q, %v, want %q", c.line, got, ok, c.want)
+		}
+	}
+	for _, line := range []string{`x "abc`, `x 'abc`, `x "a"b`} {
+		if _, ok := splitConfigArgs(line); ok {
+			t.Errorf("splitConfigArgs(%q) accepted unbalanced quotes", line)
+		}
+	}
+}
+
+// writeConfig 把 lines 写入临时目录下的配置文件并返回其路径
+func writeConfig(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(testDir(t), "redis.conf")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigFileErrorsReportLine(t *testing.T) {
+	cases := []struct {
+		lines []string
+		want  string
+	}{
+		{[]string{"# comment", "", `dir "unterminated`}, "at line 3"},
+		{[]string{"save 900 1", "no-such-option yes"}, "at line 2"},
+		{[]string{"save 900"}, "Invalid save parameters"},
+		{[]string{"port 70000"}, "Invalid port"},
+	}
+	for _, c := range cases {
+		err := Main([]string{writeConfig(t, c.lines...)}, func(*RedisServer) error {
+			t.Fatalf("%q: server created despite config error", c.lines)
+			return nil
+		})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%q: error %v, want it to contain %q", c.lines, err, c.want)
+		}
+	}
+}
+
+func TestMainLoadsConfigFile(t *testing.T) {
+	stop := errors.New("stop before Start")
+	path := writeConfig(t,
+		"bind 127.0.0.2 127.0.0.3",
+		"port 7001",
+		"databases 8",
+		"save 900 1",
+		"save 300 10",
+		`dbfilename "snap.rdb"`,
+	)
+	var got *RedisServer
+	// 命令行上配置文件之后的参数优先
+	err := Main([]string{path, "127.0.0.1"}, func(server *RedisServer) error {
+		got = server
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("Main returned %v", err)
+	}
+	if got.host != "127.0.0.1" || got.port != 7001 || len(got.databases) != 8 {
+		t.Fatalf("server created with %s:%d and %d databases", got.host, got.port, len(got.databases))
+	}
+	if s := formatSaveParams(got.saveParams); s != "900 1 300 10" {
+		t.Fatalf("save rules %q", s)
+	}
+	if got.dbfilename != "snap.rdb" {
+		t.Fatalf("dbfilename %q", got.dbfilename)
+	}
+
+	// save "" 清除之前的规则，之后的 save 重新累积
+	got = nil
+	Main([]string{writeConfig(t, "save 900 1", `save ""`, "save 60 5")}, func(server *RedisServer) error {
+		got = server
+		return stop
+	})
+	if s := formatSaveParams(got.saveParams); s != "60 5" {
+		t.Fatalf("save rules %q", s)
+	}
+}
+
+func TestConfigSave(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[save ]", "CONFIG", "GET", "save")
+	c.mustDo("OK", "CONFIG", "SET", "save", "900 1 300 10")
+	c.mustDo("[save 900 1 300 10]", "CONFIG", "GET", "save")
+	if v := c.do("CONFIG", "SET", "save", "900"); v.Type != RESP_ERROR {
+		t.Fatalf("odd save parameters accepted: %s", replyString(v))
+	}
+	c.mustDo("OK", "CONFIG", "SET", "save", "")
+	c.mustDo("[save ]", "CONFIG", "GET", "save")
+}
+
+func TestSaveRuleStartsBackgroundSave(t *testing.T) {
+	ts := startTestServer(t, "save 60 2")
+	c := ts.connect(t)
+	// 把上次保存时间提前，规则的时间条件已经满足，只差修改次数
+	ts.rs.lastSave.Store(time.Now().Unix() - 120)
+	c.mustDo("OK", "SET", "a", "1")
+	time.Sleep(300 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(ts.dir, "dump.rdb")); err == nil {
+		t.Fatal("saved after one change")
+	}
+	c.mustDo("OK", "SET", "b", "2")
+	waitFor(t, "automatic save", func() bool {
+		_, err := os.Stat(filepath.Join(ts.dir, "dump.rdb"))
+		return err == nil && ts.rs.dirty.Load() == ts.rs.savedDirty.Load()
+	})
+	c.mustDo("2", "DBSIZE")
+}
+
+func TestBgsaveSchedule(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("(error) ERR syntax error", "BGSAVE", "NOW")
+
+	// 模拟正在进行的保存
+	ts.rs.rdbSaving.Store(true)
+	c.mustDo("(error) ERR Background save already in progress", "BGSAVE")
+	c.mustDo("Background saving scheduled", "BGSAVE", "SCHEDULE")
+	time.Sleep(300 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(ts.dir, "dump.rdb")); err == nil {
+		t.Fatal("scheduled save started while another save was running")
+	}
+	ts.rs.rdbSaving.Store(false)
+	waitFor(t, "scheduled save", func() bool {
+		_, err := os.Stat(filepath.Join(ts.dir, "dump.rdb"))
+		return err == nil && !ts.rs.rdbSaving.Load()
+	})
+}
+
+func TestFlushallSavesWithSaveRules(t *testing.T) {
+	ts := startTestServer(t, "save 3600 1")
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("OK", "SAVE")
+	c.mustDo("OK", "FLUSHALL")
+	// FLUSHALL 同步保存了空的数据集，重启后不会恢复 k
+	restarted := startTestServerIn(t, ts.dir)
+	restarted.connect(t).mustDo("0", "DBSIZE")
+
+	// 没有自动保存规则时 FLUSHALL 不写文件
+	plain := startTestServer(t)
+	pc := plain.connect(t)
+	pc.mustDo("OK", "SET", "k", "v")
+	pc.mustDo("OK", "FLUSHALL")
+	if _, err := os.Stat(filepath.Join(plain.dir, "dump.rdb")); err == nil {
+		t.Fatal("FLUSHALL saved without save rules")
+	}
+}
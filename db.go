@@ -0,0 +1,467 @@
+package goredis
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisDb 表示一个编号的逻辑数据库
+//
+// 阻塞在键上的客户端和 WATCH 键的客户端都按数据库分别记录：不同数据库中的同名键互不相干。
+type redisDb struct {
+	id          int
+	store       *keyspace
+	blockedKeys map[string][]*blockedClient
+	watchedKeys map[string][]*client
+	// keepExpired 为 true 时过期的键仍然视为存在：重放 AOF 和执行主节点传来的命令时，
+	// 命令看到的键要与原来执行时相同，过期的键只由传来的 DEL 删除
+	keepExpired bool
+}
+
+// newRedisDb 创建编号为 id 的空数据库
+func newRedisDb(id int) *redisDb {
+	return &redisDb{
+		id:          id,
+		store:       newKeyspace(),
+		blockedKeys: make(map[string][]*blockedClient),
+		watchedKeys: make(map[string][]*client),
+	}
+}
+
+// handleKeys 处理 KEYS 命令，返回匹配 glob 模式的所有键
+//
+// KEYS 需要遍历整个键空间并在此期间持有读锁，只适合调试或小数据集，生产环境应使用 SCAN。
+func (rs *RedisServer) handleKeys(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 {
+		return wrongArgsError("keys")
+	}
+	pattern := args[0]
+	all := pattern == "*"
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	keys := make([]*RESPValue, 0)
+	c.db.store.ForEach(func(key string, _ *RedisObject) {
+		if c.db.keyIsExpired(key) {
+			return
+		}
+		if all || stringMatch(pattern, key, false) {
+			keys = append(keys, NewBulkStringValue(key))
+		}
+	})
+	return NewArrayValue(keys)
+}
+
+// handleScan 处理 SCAN 命令
+//
+// 每次调用只在持有读锁期间访问 COUNT 个键，调用之间不持有锁；MATCH 和 TYPE 在访问之后过滤，
+// 因此一次调用返回的键可能少于 COUNT 甚至为空，只有游标为 0 才表示扫描结束。
+func (rs *RedisServer) handleScan(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("scan")
+	}
+
+	opts, errResp := parseScanArgs(args, true)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	cursor, entries := c.db.store.Scan(opts.cursor, opts.count)
+	keys := make([]*RESPValue, 0, len(entries))
+	for _, entry := range entries {
+		if c.db.keyIsExpired(entry.key) {
+			continue
+		}
+		if opts.typeName != "" && !strings.EqualFold(objectTypeName(entry.obj), opts.typeName) {
+			continue
+		}
+		if opts.matches(entry.key) {
+			keys = append(keys, NewBulkStringValue(entry.key))
+		}
+	}
+	return scanReply(cursor, keys)
+}
+
+// handleDel 处理 DEL 命令，返回删除的键的数量
+func (rs *RedisServer) handleDel(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	deleted := 0
+	for _, key := range args {
+		// 主节点执行时过期的键已经先被删除；副本上过期的键只能由主节点传来的 DEL 删除，所以直接删除
+		if !c.db.store.Delete(key) {
+			continue
+		}
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+		deleted++
+	}
+	return NewIntegerValue(int64(deleted))
+}
+
+// handleDBSize 处理 DBSIZE 命令
+//
+// 与 Redis 一样直接返回键空间中键的数量，包括已经过期、还没有被删除的键。
+func (rs *RedisServer) handleDBSize(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 0 {
+		return wrongArgsError("dbsize")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	return NewIntegerValue(int64(c.db.store.Len()))
+}
+
+// parseFlushMode 解析 FLUSHDB 和 FLUSHALL 的可选参数，返回是否异步释放
+func parseFlushMode(args []string) (bool, *RESPValue) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	if len(args) > 1 {
+		return false, NewErrorValue("ERR syntax error")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "ASYNC":
+		return true, nil
+	case "SYNC":
+		return false, nil
+	default:
+		return false, NewErrorValue("ERR syntax error")
+	}
+}
+
+// empty 清空数据库并返回被替换下来的旧键空间（调用方需持有写锁）
+//
+// 清空操作只是换上一个新的键空间，旧键空间的释放由调用方决定：同步模式下在返回之前丢弃，
+// 异步模式下交给后台 goroutine，这样清空大数据库时不会在持有锁期间阻塞其他客户端。
+func (db *redisDb) empty() *keyspace {
+	old := db.store
+	db.store = newKeyspace()
+	return old
+}
+
+// freeKeyspace 释放旧键空间中的所有对象，async 为 true 时在后台进行
+//
+// 清空一个很大的 map 需要遍历所有桶，同步模式下由执行命令的连接承担这部分开销。
+func freeKeyspace(old *keyspace, async bool) {
+	release := func() {
+		clear(old.index)
+		clear(old.expires)
+		clear(old.entries)
+		old.entries = nil
+	}
+	if async {
+		go release()
+		return
+	}
+	release()
+}
+
+// handleFlush 处理 FLUSHDB 和 FLUSHALL 命令，all 为 true 时清空所有数据库
+func (rs *RedisServer) handleFlush(c *client, command *RESPValue, all bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	async, errResp := parseFlushMode(args)
+	if errResp != nil {
+		return errResp
+	}
+
+	var olds []*keyspace
+	rs.mutex.Lock()
+	if all {
+		for _, db := range rs.databases {
+			rs.touchAllWatchedKeysInDb(db, nil)
+			olds = append(olds, db.empty())
+		}
+	} else {
+		rs.touchAllWatchedKeysInDb(c.db, nil)
+		olds = append(olds, c.db.empty())
+	}
+	rs.mutex.Unlock()
+
+	// 清空的数据库即使原本为空也计一次修改，命令因此总会被传播
+	rs.dirty.Add(1)
+	for _, old := range olds {
+		rs.dirty.Add(int64(old.Len()))
+		freeKeyspace(old, async)
+	}
+	// 与 Redis 一样，配置了自动保存时 FLUSHALL 立即保存空的数据集，
+	// 避免重启时从旧的 RDB 文件中恢复已清空的数据
+	if all {
+		rs.mutex.RLock()
+		save := len(rs.saveParams) > 0
+		rs.mutex.RUnlock()
+		if save && rs.rdbSave() == errRdbSaveInProgress {
+			rs.bgsaveScheduled.Store(true)
+		}
+	}
+	return NewSimpleStringValue("OK")
+}
+
+// handleSelect 处理 SELECT 命令，切换当前连接使用的数据库
+func (rs *RedisServer) handleSelect(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 {
+		return wrongArgsError("select")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return NewErrorValue("ERR value is not an integer or out of range")
+	}
+	if rs.clusterEnabled && id != 0 {
+		return NewErrorValue("ERR SELECT is not allowed in cluster mode")
+	}
+	if id < 0 || id >= len(rs.databases) {
+		return NewErrorValue("ERR DB index is out of range")
+	}
+	c.db = rs.databases[id]
+	return NewSimpleStringValue("OK")
+}
+
+// handleSwapDB 处理 SWAPDB 命令，原子地交换两个数据库的内容
+//
+// 只交换键空间，阻塞的客户端仍然留在原来编号的数据库上：连接到某个编号的客户端
+// 在交换之后立即看到另一个数据库的数据，阻塞在其中的客户端也可能因此被服务。
+func (rs *RedisServer) handleSwapDB(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("swapdb")
+	}
+	if rs.clusterEnabled {
+		return NewErrorValue("ERR SWAPDB is not allowed in cluster mode")
+	}
+	id1, err := strconv.Atoi(args[0])
+	if err != nil {
+		return NewErrorValue("ERR invalid first DB index")
+	}
+	id2, err := strconv.Atoi(args[1])
+	if err != nil {
+		return NewErrorValue("ERR invalid second DB index")
+	}
+	if id1 < 0 || id1 >= len(rs.databases) || id2 < 0 || id2 >= len(rs.databases) {
+		return NewErrorValue("ERR DB index is out of range")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	db1, db2 := rs.databases[id1], rs.databases[id2]
+	rs.touchAllWatchedKeysInDb(db1, db2)
+	rs.touchAllWatchedKeysInDb(db2, db1)
+	db1.store, db2.store = db2.store, db1.store
+	rs.dirty.Add(1)
+	rs.scanDatabaseForReadyKeys(db1)
+	rs.scanDatabaseForReadyKeys(db2)
+	return NewSimpleStringValue("OK")
+}
+
+// signalModifiedKey 在键被修改后调用，让 WATCH 了该键的客户端的事务失败，并计入自动保存的修改次数（调用方需持有写锁）
+//
+// 每个修改键的命令都要在修改之后调用，包括删除键以及原地修改已有的值。
+func (rs *RedisServer) signalModifiedKey(db *redisDb, key string) {
+	touchWatchedKey(db, key)
+	rs.dirty.Add(1)
+}
+
+// scanDatabaseForReadyKeys 将数据库中有阻塞客户端且存在的键标记为就绪（调用方需持有写锁）
+func (rs *RedisServer) scanDatabaseForReadyKeys(db *redisDb) {
+	for key := range db.blockedKeys {
+		if db.lookupKey(key) != nil {
+			rs.signalKeyAsReady(db, key)
+		}
+	}
+}
+
+// handleMove 处理 MOVE 命令，把键移动到另一个数据库，键不存在或目标数据库中已有同名键时返回 0
+func (rs *RedisServer) handleMove(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("move")
+	}
+	if rs.clusterEnabled {
+		return NewErrorValue("ERR MOVE is not allowed in cluster mode")
+	}
+	id, err := strconv.Atoi(args[1])
+	if err != nil {
+		return NewErrorValue("ERR value is not an integer or out of range")
+	}
+	if id < 0 || id >= len(rs.databases) {
+		return NewErrorValue("ERR DB index is out of range")
+	}
+	dst := rs.databases[id]
+	if dst == c.db {
+		return NewErrorValue("ERR source and destination objects are the same")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	key := args[0]
+	obj := c.db.lookupKey(key)
+	if obj == nil || dst.lookupKey(key) != nil {
+		return NewIntegerValue(0)
+	}
+	when := c.db.store.GetExpire(key)
+	dst.store.Set(key, obj)
+	if when >= 0 {
+		dst.store.SetExpire(key, when)
+	}
+	c.db.store.Delete(key)
+	rs.signalModifiedKey(c.db, key)
+	rs.signalModifiedKey(dst, key)
+	rs.signalKeyAsReady(dst, key)
+	rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "move_from", key, c.db.id)
+	rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "move_to", key, dst.id)
+	return NewIntegerValue(1)
+}
+
+// handleDump 处理 DUMP 命令，以与 Redis 相同的格式序列化键的值，键不存在时返回 nil
+//
+// 载荷是 RDB 编码的值，末尾是 RDB 版本和 CRC64，可以用 RESTORE 在本服务器或 Redis 中重建这个键。
+func (rs *RedisServer) handleDump(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	obj := c.db.lookupKey(args[0])
+	if obj == nil {
+		return NewNullBulkStringValue()
+	}
+	return NewBulkStringValue(string(rdbDumpObject(obj, rs.rdbCompression)))
+}
+
+// handleRestore 处理 RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+//
+// 用 DUMP 的载荷创建键，键已存在时报错，除非指定 REPLACE。ttl 为 0 时创建永久的键，否则是毫秒数，
+// 指定 ABSTTL 时是过期的 Unix 毫秒时间；时间已过时不创建（REPLACE 时删除已有的键）。
+// IDLETIME 和 FREQ 只做检查，不记录访问信息。
+func (rs *RedisServer) handleRestore(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	key := args[0]
+	ttl, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return NewErrorValue("ERR value is not an integer or out of range")
+	}
+	replace, absTTL, idle, freq := false, false, false, false
+	for i := 3; i < len(args); i++ {
+		additional := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "REPLACE":
+			replace = true
+		case opt == "ABSTTL":
+			absTTL = true
+		case opt == "IDLETIME" && additional >= 1 && !freq:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return NewErrorValue("ERR value is not an integer or out of range")
+			}
+			if n < 0 {
+				return NewErrorValue("ERR Invalid IDLETIME value, must be >= 0")
+			}
+			idle = true
+			i++
+		case opt == "FREQ" && additional >= 1 && !idle:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return NewErrorValue("ERR value is not an integer or out of range")
+			}
+			if n < 0 || n > 255 {
+				return NewErrorValue("ERR Invalid FREQ value, must be >= 0 and <= 255")
+			}
+			freq = true
+			i++
+		default:
+			return NewErrorValue("ERR syntax error")
+		}
+	}
+	if ttl < 0 {
+		return NewErrorValue("ERR Invalid TTL value, must be >= 0")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	existing := c.db.lookupKey(key)
+	if existing != nil && !replace {
+		return NewErrorValue("BUSYKEY Target key name already exists.")
+	}
+	obj, err := rdbRestoreObject([]byte(args[2]))
+	if err == errDumpPayload {
+		return NewErrorValue("ERR " + err.Error())
+	}
+	if err != nil {
+		return NewErrorValue("ERR Bad data format")
+	}
+
+	// 与 EXPIRE 一样换算为绝对时间，传播为 ABSTTL，重放时键在同一时刻过期
+	if ttl > 0 && !absTTL {
+		now := time.Now().UnixMilli()
+		if ttl > math.MaxInt64-now {
+			return NewErrorValue("ERR invalid expire time in 'restore' command")
+		}
+		ttl += now
+	}
+	if ttl > 0 && ttl <= time.Now().UnixMilli() && !c.db.keepExpired {
+		// 已经过期的键不创建，REPLACE 删除的键以 DEL 传播
+		if existing != nil {
+			c.db.store.Delete(key)
+			rs.signalModifiedKey(c.db, key)
+			rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+			c.rewriteArgv("DEL", key)
+		}
+		return NewSimpleStringValue("OK")
+	}
+	c.db.store.Set(key, obj)
+	if ttl > 0 {
+		c.db.store.SetExpire(key, ttl)
+		if !absTTL {
+			argv := c.propagateArgv()
+			argv[2] = strconv.FormatInt(ttl, 10)
+			c.rewriteArgv(append(argv, "ABSTTL")...)
+		}
+	}
+	rs.signalModifiedKey(c.db, key)
+	rs.signalKeyAsReady(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "restore", key, c.db.id)
+	return NewSimpleStringValue("OK")
+}
@@ -0,0 +1,278 @@
+package goredis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestKeys(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[]", "KEYS", "*")
+	c.mustDo("OK", "SET", "hello", "1")
+	c.mustDo("OK", "SET", "hallo", "1")
+	c.mustDo("1", "RPUSH", "hxllo", "1")
+	c.mustDo("1", "SADD", "world", "1")
+	c.mustDoSorted("[hallo hello hxllo world]", "KEYS", "*")
+	c.mustDoSorted("[hallo hello hxllo]", "KEYS", "h?llo")
+	c.mustDoSorted("[hallo hello]", "KEYS", "h[ae]llo")
+	c.mustDoSorted("[hxllo]", "KEYS", "h[^e-a]llo")
+	c.mustDo("[]", "KEYS", "nothing*")
+}
+
+func TestDBSize(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("0", "DBSIZE")
+	c.mustDo("OK", "SET", "a", "1")
+	c.mustDo("1", "RPUSH", "b", "1")
+	c.mustDo("2", "DBSIZE")
+	// 集合被清空后键被删除
+	c.mustDo("1", "LPOP", "b")
+	c.mustDo("1", "DBSIZE")
+	c.mustDo("(error) ERR wrong number of arguments for 'dbsize' command", "DBSIZE", "x")
+}
+
+func TestFlush(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	for _, mode := range [][]string{{"FLUSHDB"}, {"FLUSHDB", "ASYNC"}, {"FLUSHALL", "SYNC"}, {"FLUSHALL", "async"}} {
+		c.mustDo("OK", "SET", "a", "1")
+		c.mustDo("1", "SADD", "s", "x")
+		c.mustDo("OK", mode...)
+		c.mustDo("0", "DBSIZE")
+		c.mustDo("(nil)", "GET", "a")
+	}
+	c.mustDo("(error) ERR syntax error", "FLUSHDB", "LAZY")
+	c.mustDo("(error) ERR syntax error", "FLUSHALL", "ASYNC", "SYNC")
+}
+
+func TestSelect(t *testing.T) {
+	ts := startTestServer(t)
+	c, other := ts.connect(t), ts.connect(t)
+	c.mustDo("OK", "SET", "k", "db0")
+	c.mustDo("OK", "SELECT", "1")
+	c.mustDo("(nil)", "GET", "k")
+	c.mustDo("OK", "SET", "k", "db1")
+	c.mustDo("1", "DBSIZE")
+	// 每个连接有自己的当前数据库
+	other.mustDo("db0", "GET", "k")
+	c.mustDo("OK", "SELECT", "0")
+	c.mustDo("db0", "GET", "k")
+
+	// FLUSHDB 只清空当前数据库，FLUSHALL 清空所有数据库
+	other.mustDo("OK", "FLUSHDB")
+	c.mustDo("OK", "SELECT", "1")
+	c.mustDo("db1", "GET", "k")
+	other.mustDo("OK", "FLUSHALL")
+	c.mustDo("(nil)", "GET", "k")
+
+	c.mustDo("(error) ERR DB index is out of range", "SELECT", "16")
+	c.mustDo("(error) ERR value is not an integer or out of range", "SELECT", "x")
+}
+
+func TestBlockingIsPerDatabase(t *testing.T) {
+	ts := startTestServer(t)
+	c, writer := ts.connect(t), ts.connect(t)
+	c.mustDo("OK", "SELECT", "2")
+	c.send("BLPOP", "q", "0")
+	waitFor(t, "client to block", func() bool { return ts.blockedOnDb(2, "q") == 1 })
+
+	// 其他数据库中的同名键不会唤醒客户端
+	writer.mustDo("1", "RPUSH", "q", "db0")
+	writer.mustDo("OK", "SELECT", "2")
+	writer.mustDo("1", "RPUSH", "q", "db2")
+	if got := replyString(c.read()); got != "[q db2]" {
+		t.Fatalf("BLPOP in db 2 got %s", got)
+	}
+	writer.mustDo("OK", "SELECT", "0")
+	writer.mustDo("[db0]", "LRANGE", "q", "0", "-1")
+}
+
+func TestSwapDB(t *testing.T) {
+	ts := startTestServer(t)
+	c, other := ts.connect(t), ts.connect(t)
+	c.mustDo("OK", "SET", "k", "db0")
+	other.mustDo("OK", "SELECT", "1")
+	other.mustDo("OK", "SET", "k", "db1")
+	c.mustDo("OK", "SWAPDB", "0", "1")
+	c.mustDo("db1", "GET", "k")
+	other.mustDo("db0", "GET", "k")
+
+	// 交换后出现数据的键会唤醒阻塞在其上的客户端
+	other.mustDo("1", "RPUSH", "q", "x")
+	c.send("BLPOP", "q", "0")
+	waitFor(t, "client to block", func() bool { return ts.blockedOnDb(0, "q") == 1 })
+	other.mustDo("OK", "SWAPDB", "1", "0")
+	if got := replyString(c.read()); got != "[q x]" {
+		t.Fatalf("BLPOP after SWAPDB got %s", got)
+	}
+
+	c.mustDo("(error) ERR invalid first DB index", "SWAPDB", "x", "1")
+	c.mustDo("(error) ERR invalid second DB index", "SWAPDB", "1", "x")
+	c.mustDo("(error) ERR DB index is out of range", "SWAPDB", "0", "16")
+}
+
+func TestMove(t *testing.T) {
+	ts := startTestServer(t)
+	c, other := ts.connect(t), ts.connect(t)
+	other.mustDo("OK", "SELECT", "1")
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("1", "MOVE", "k", "1")
+	c.mustDo("(nil)", "GET", "k")
+	other.mustDo("v", "GET", "k")
+	c.mustDo("0", "MOVE", "k", "1")
+
+	// 目标数据库已有同名键时不移动
+	c.mustDo("OK", "SET", "k", "v0")
+	c.mustDo("0", "MOVE", "k", "1")
+	c.mustDo("v0", "GET", "k")
+
+	// 移动到的键会唤醒目标数据库中阻塞的客户端
+	other.send("BLPOP", "q", "0")
+	waitFor(t, "client to block", func() bool { return ts.blockedOnDb(1, "q") == 1 })
+	c.mustDo("1", "RPUSH", "q", "x")
+	c.mustDo("1", "MOVE", "q", "1")
+	if got := replyString(other.read()); got != "[q x]" {
+		t.Fatalf("BLPOP after MOVE got %s", got)
+	}
+
+	c.mustDo("(error) ERR source and destination objects are the same", "MOVE", "k", "0")
+	c.mustDo("(error) ERR DB index is out of range", "MOVE", "k", "16")
+}
+
+func TestDumpPayloadFormat(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "k", "hello")
+	payload := []byte(c.do("DUMP", "k").Str)
+	// 与 Redis 相同：RDB 类型和值，之后是 2 字节的 RDB 版本和 8 字节的 CRC64
+	body := payload[:len(payload)-8]
+	if string(body) != "\x00\x05hello\x0b\x00" {
+		t.Fatalf("DUMP payload %q", payload)
+	}
+	if sum := binary.LittleEndian.Uint64(payload[len(body):]); sum != crc64Jones(0, body) {
+		t.Fatalf("DUMP checksum %x, want %x", sum, crc64Jones(0, body))
+	}
+	c.mustDo("(nil)", "DUMP", "missing")
+}
+
+func TestDumpRestore(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "str", "v")
+	c.mustDo("3", "RPUSH", "list", "a", "b", "c")
+	c.mustDo("2", "SADD", "set", "1", "2")
+	c.mustDo("2", "ZADD", "zset", "1.5", "x", "2", "y")
+	c.mustDo("5-1", "XADD", "stream", "5-1", "f", "v")
+	c.mustDo("OK", "XGROUP", "CREATE", "stream", "g", "0")
+	c.do("XREADGROUP", "GROUP", "g", "alice", "STREAMS", "stream", ">")
+	c.mustDo("OK", "CMS.INITBYDIM", "cms", "10", "2")
+	c.mustDo("[3]", "CMS.INCRBY", "cms", "a", "3")
+
+	for _, key := range []string{"str", "list", "set", "zset", "stream", "cms"} {
+		payload := c.do("DUMP", key).Str
+		c.mustDo("OK", "RESTORE", key+":copy", "0", payload)
+	}
+	c.mustDo("v", "GET", "str:copy")
+	c.mustDo("[a b c]", "LRANGE", "list:copy", "0", "-1")
+	c.mustDo("[1 2]", "SMEMBERS", "set:copy")
+	c.mustDo("[x 1.5 y 2]", "ZRANGE", "zset:copy", "0", "-1", "WITHSCORES")
+	c.mustDo("[[5-1 [f v]]]", "XRANGE", "stream:copy", "-", "+")
+	c.mustDo("[1 5-1 5-1 [[alice 1]]]", "XPENDING", "stream:copy", "g")
+	c.mustDo("[3]", "CMS.QUERY", "cms:copy", "a")
+}
+
+func TestRestoreErrors(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("3", "RPUSH", "list", "a", "b", "c")
+	payload := c.do("DUMP", "list").Str
+
+	c.mustDo("(error) BUSYKEY Target key name already exists.", "RESTORE", "list", "0", payload)
+	c.mustDo("OK", "SET", "str", "v")
+	c.mustDo("OK", "RESTORE", "str", "0", payload, "REPLACE")
+	c.mustDo("[a b c]", "LRANGE", "str", "0", "-1")
+
+	corrupt := []byte(payload)
+	corrupt[1] ^= 0xFF
+	c.mustDo("(error) ERR DUMP payload version or checksum are wrong", "RESTORE", "k", "0", string(corrupt))
+	c.mustDo("(error) ERR Invalid TTL value, must be >= 0", "RESTORE", "k", "-1", payload)
+	c.mustDo("(error) ERR Invalid IDLETIME value, must be >= 0", "RESTORE", "k", "0", payload, "IDLETIME", "-1")
+	c.mustDo("(error) ERR Invalid FREQ value, must be >= 0 and <= 255", "RESTORE", "k", "0", payload, "FREQ", "256")
+	c.mustDo("(error) ERR syntax error", "RESTORE", "k", "0", payload, "IDLETIME", "1", "FREQ", "1")
+	c.mustDo("0", "LLEN", "k")
+
+	// 已经过期的绝对时间不创建键，REPLACE 时删除已有的键
+	past := fmt.Sprint(time.Now().Add(-time.Hour).UnixMilli())
+	c.mustDo("OK", "RESTORE", "k", past, payload, "ABSTTL")
+	c.mustDo("0", "LLEN", "k")
+	c.mustDo("OK", "RESTORE", "str", past, payload, "ABSTTL", "REPLACE")
+	c.mustDo("0", "LLEN", "str")
+}
+
+func TestAofRewriteRestoresSketches(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "aof-use-rdb-preamble no")
+	c := ts.connect(t)
+	c.mustDo("OK", "CMS.INITBYDIM", "cms", "10", "2")
+	c.mustDo("[3]", "CMS.INCRBY", "cms", "a", "3")
+	c.mustDo("Background append only file rewriting started", "BGREWRITEAOF")
+	waitFor(t, "AOF rewrite to finish", func() bool { return !ts.rs.aofRewriteInProgress() })
+
+	// Count-Min Sketch 没有能重建它的写命令，重写为 RESTORE
+	cmds := readAofArgv(t, ts)
+	if len(cmds) != 2 || cmds[1][0] != "RESTORE" || cmds[1][1] != "cms" {
+		t.Fatalf("AOF contains %q", cmds)
+	}
+	ts = startTestServerIn(t, ts.dir, "appendonly yes")
+	ts.connect(t).mustDo("[3]", "CMS.QUERY", "cms", "a")
+}
+
+func TestRestoreWithTTL(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "appendfsync always", "aof-use-rdb-preamble no")
+	c := ts.connect(t)
+	c.mustDo("3", "RPUSH", "list", "a", "b", "c")
+	payload := c.do("DUMP", "list").Str
+
+	c.mustDo("OK", "RESTORE", "copy", "0", payload)
+	c.mustDo("[a b c]", "LRANGE", "copy", "0", "-1")
+	c.mustDo("-1", "TTL", "copy")
+	c.mustDo("(error) BUSYKEY Target key name already exists.", "RESTORE", "copy", "0", payload)
+
+	// 相对时间换算为绝对时间，传播为 ABSTTL
+	c.mustDo("OK", "RESTORE", "rel", "100000", payload)
+	c.mustDo("100", "TTL", "rel")
+	future := fmt.Sprint(time.Now().Add(time.Hour).UnixMilli())
+	c.mustDo("OK", "RESTORE", "abs", future, payload, "ABSTTL")
+	c.mustDo(future, "PEXPIRETIME", "abs")
+	c.mustDo("(error) ERR invalid expire time in 'restore' command", "RESTORE", "big", "9223372036854775807", payload)
+
+	// 已经过期的时间不创建键，REPLACE 时删除已有的键并传播为 DEL
+	past := fmt.Sprint(time.Now().Add(-time.Hour).UnixMilli())
+	c.mustDo("OK", "RESTORE", "none", past, payload, "ABSTTL")
+	c.mustDo("0", "LLEN", "none")
+	c.mustDo("OK", "RESTORE", "copy", past, payload, "ABSTTL", "REPLACE")
+	c.mustDo("0", "LLEN", "copy")
+
+	var restores [][]string
+	var dels []string
+	for _, argv := range readAofArgv(t, ts) {
+		switch argv[0] {
+		case "RESTORE":
+			restores = append(restores, argv)
+		case "DEL":
+			dels = append(dels, argv[1])
+		}
+	}
+	if len(restores) != 3 || len(dels) != 1 || dels[0] != "copy" {
+		t.Fatalf("AOF has RESTORE %q and DEL %q", restores, dels)
+	}
+	if rel := restores[1]; rel[1] != "rel" || rel[2] != replyString(c.do("PEXPIRETIME", "rel")) || rel[len(rel)-1] != "ABSTTL" {
+		t.Fatalf("relative TTL propagated as %q", rel[:3])
+	}
+	if abs := restores[2]; abs[2] != future || abs[len(abs)-1] != "ABSTTL" {
+		t.Fatalf("absolute TTL propagated as %q", abs[:3])
+	}
+}
@@ -0,0 +1,47 @@
+package goredis_test
+
+import (
+	"log"
+	"os"
+	"strconv"
+
+	goredis "goRedis"
+)
+
+func ExampleNewRedisServer() {
+	server := goredis.NewRedisServer("127.0.0.1", 6379, 16)
+	log.Fatal(server.Start())
+}
+
+func ExampleMain() {
+	// 与 cmd/goredis 相同地处理命令行参数，启动之前注册 Go 函数
+	err := goredis.Main(os.Args[1:], func(server *goredis.RedisServer) error {
+		return server.RegisterGoFunction("hello", func(call *goredis.GoCall) *goredis.RESPValue {
+			return goredis.NewBulkStringValue("hello " + call.Args[0])
+		})
+	})
+	log.Fatal(err)
+}
+
+func ExampleRedisServer_RegisterGoFunction() {
+	server := goredis.NewRedisServer("127.0.0.1", 6379, 16)
+	err := server.RegisterGoFunction("incrby", func(call *goredis.GoCall) *goredis.RESPValue {
+		n, _ := strconv.Atoi(call.Call("GET", call.Keys[0]).Str)
+		d, _ := strconv.Atoi(call.Args[0])
+		call.Call("SET", call.Keys[0], strconv.Itoa(n+d))
+		return goredis.NewIntegerValue(int64(n + d))
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Fatal(server.Start())
+}
+
+func ExampleRedisServer_SetPersister() {
+	// 纯内存的服务器：SAVE、BGSAVE 和 AOF 照常执行，但不写入任何文件；配置文件和命令行参数照常生效
+	err := goredis.Main(os.Args[1:], func(server *goredis.RedisServer) error {
+		server.SetPersister(goredis.NopPersister{})
+		return nil
+	})
+	log.Fatal(err)
+}
@@ -0,0 +1,261 @@
+package goredis
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 主动过期的参数，与 Redis 的默认值相同
+const (
+	ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP  = 20 // 每个数据库每轮检查的键数
+	ACTIVE_EXPIRE_CYCLE_ACCEPTABLE     = 10 // 一轮中过期的键不超过这个百分比时不再继续检查这个数据库
+	ACTIVE_EXPIRE_CYCLE_SLOW_TIME_PERC = 25 // 每次主动过期最多占用 serverCron 周期的百分比
+)
+
+// keyIsExpired 判断键是否设置了过期时间并且已经到期（调用方需持有锁）
+func (db *redisDb) keyIsExpired(key string) bool {
+	if db.keepExpired || db.store.ExpiresLen() == 0 {
+		return false
+	}
+	when := db.store.GetExpire(key)
+	return when >= 0 && when <= time.Now().UnixMilli()
+}
+
+// deleteExpiredKey 删除已经过期的键，发布 expired 事件，并以 DEL 传播给 AOF 和副本（调用方需持有写锁，以及 propagateMu 或命令写锁）
+//
+// 删除不计入 dirty：命令执行之前删除时，命令本身没有修改数据集就不会被传播。
+func (rs *RedisServer) deleteExpiredKey(db *redisDb, key string) {
+	db.store.Delete(key)
+	touchWatchedKey(db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_EXPIRED, "expired", key, db.id)
+	rs.alsoPropagate(db.id, []string{"DEL", key})
+}
+
+// setKeepExpired 设置所有数据库是否把过期的键视为存在（调用方需持有写锁）
+func (rs *RedisServer) setKeepExpired(keep bool) {
+	for _, db := range rs.databases {
+		db.keepExpired = keep
+	}
+}
+
+// expireCommandKeys 在写命令执行之前删除它的键中已经过期的（调用方需持有写锁，以及 propagateMu 或命令写锁）
+//
+// 与 Redis 一样只有主节点删除过期的键：DEL 先于命令传播，副本和重放 AOF 时命令看到的键与这里相同。
+// 副本上过期的键只是视为不存在，等待主节点传播的 DEL，主节点传来的命令也不会删除它们。
+func (rs *RedisServer) expireCommandKeys(c *client, cmd *redisCommand, command *RESPValue) {
+	if c.master {
+		return
+	}
+	for _, key := range commandKeys(cmd, command.Array) {
+		if !c.db.keyIsExpired(key) {
+			continue
+		}
+		rs.replMu.Lock()
+		replica := rs.masterHost != ""
+		rs.replMu.Unlock()
+		if replica {
+			return
+		}
+		rs.deleteExpiredKey(c.db, key)
+	}
+}
+
+// activeExpireCycle 主动删除已经过期的键，由 serverCron 每 100 毫秒调用一次
+//
+// 与 Redis 的慢速周期相同：每个数据库每轮随机检查 ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP 个有过期时间的键，
+// 删除其中已经到期的；到期的超过 ACTIVE_EXPIRE_CYCLE_ACCEPTABLE% 时继续检查这个数据库，
+// 整个过程最多占用 ACTIVE_EXPIRE_CYCLE_SLOW_TIME_PERC% 的周期。这样不再被访问的过期键也会被删除，
+// 而不会一直占用内存。副本不主动删除，故障转移暂停写入期间也不删除。
+func (rs *RedisServer) activeExpireCycle() {
+	rs.replMu.Lock()
+	skip := rs.masterHost != "" || rs.failover != nil
+	rs.replMu.Unlock()
+	if skip {
+		return
+	}
+
+	// 与命令一样取得命令锁，脚本超时时跳过这一次
+	if run := rs.lockExec(false); run != nil {
+		return
+	}
+	defer rs.unlockExec(false)
+	rs.propagateMu.Lock()
+	defer rs.propagateMu.Unlock()
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	defer rs.propagatePending()
+
+	deadline := time.Now().Add(100 * time.Millisecond * ACTIVE_EXPIRE_CYCLE_SLOW_TIME_PERC / 100)
+	for _, db := range rs.databases {
+		for db.store.ExpiresLen() > 0 && time.Now().Before(deadline) {
+			now := time.Now().UnixMilli()
+			sampled, expired := 0, 0
+			// map 的遍历从随机的位置开始，相当于随机抽样
+			for key, when := range db.store.expires {
+				if sampled == ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP {
+					break
+				}
+				sampled++
+				if when <= now {
+					rs.deleteExpiredKey(db, key)
+					expired++
+				}
+			}
+			if expired*100 <= sampled*ACTIVE_EXPIRE_CYCLE_ACCEPTABLE {
+				break
+			}
+		}
+	}
+}
+
+// handleExpire 处理 EXPIRE、PEXPIRE、EXPIREAT 和 PEXPIREAT 命令
+//
+// unit 是时间参数的单位，abs 表示时间参数是 Unix 时间而不是相对时间。
+// 与 Redis 一样传播为 PEXPIREAT，重放时键在同一时刻过期；时间已经过去时删除键，传播为 DEL。
+func (rs *RedisServer) handleExpire(c *client, command *RESPValue, name string, unit time.Duration, abs bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError(name)
+	}
+
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return NewErrorValue("ERR value is not an integer or out of range")
+	}
+	var nx, xx, gt, lt bool
+	for _, opt := range args[2:] {
+		switch strings.ToUpper(opt) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return NewErrorValue("ERR Unsupported option " + opt)
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return NewErrorValue("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return NewErrorValue("ERR GT and LT options at the same time are not compatible")
+	}
+
+	// 换算为 Unix 毫秒，溢出时与 Redis 一样报错
+	scale := int64(unit / time.Millisecond)
+	if n > math.MaxInt64/scale || n < math.MinInt64/scale {
+		return NewErrorValue("ERR invalid expire time in '" + name + "' command")
+	}
+	when := n * scale
+	if !abs {
+		now := time.Now().UnixMilli()
+		if when > math.MaxInt64-now {
+			return NewErrorValue("ERR invalid expire time in '" + name + "' command")
+		}
+		when += now
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	key := args[0]
+	if c.db.lookupKey(key) == nil {
+		return NewIntegerValue(0)
+	}
+	current := c.db.store.GetExpire(key)
+	switch {
+	case nx && current >= 0,
+		xx && current < 0,
+		gt && (current < 0 || when <= current),
+		lt && current >= 0 && when >= current:
+		return NewIntegerValue(0)
+	}
+
+	// 主节点传来的和重放 AOF 的命令总是设置过期时间，之后由传播的 DEL 删除
+	if when <= time.Now().UnixMilli() && !c.db.keepExpired {
+		c.db.store.Delete(key)
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+		c.rewriteArgv("DEL", key)
+		return NewIntegerValue(1)
+	}
+	c.db.store.SetExpire(key, when)
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "expire", key, c.db.id)
+	c.rewriteArgv("PEXPIREAT", key, strconv.FormatInt(when, 10))
+	return NewIntegerValue(1)
+}
+
+// handleTTL 处理 TTL 和 PTTL 命令，返回剩余的生存时间，键不存在时返回 -2，没有过期时间时返回 -1
+func (rs *RedisServer) handleTTL(c *client, command *RESPValue, ms bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	if c.db.lookupKey(args[0]) == nil {
+		return NewIntegerValue(-2)
+	}
+	when := c.db.store.GetExpire(args[0])
+	if when < 0 {
+		return NewIntegerValue(-1)
+	}
+	ttl := max(when-time.Now().UnixMilli(), 0)
+	if !ms {
+		ttl = (ttl + 500) / 1000
+	}
+	return NewIntegerValue(ttl)
+}
+
+// handleExpireTime 处理 EXPIRETIME 和 PEXPIRETIME 命令，返回过期的 Unix 时间，键不存在时返回 -2，没有过期时间时返回 -1
+func (rs *RedisServer) handleExpireTime(c *client, command *RESPValue, ms bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	if c.db.lookupKey(args[0]) == nil {
+		return NewIntegerValue(-2)
+	}
+	when := c.db.store.GetExpire(args[0])
+	if when < 0 {
+		return NewIntegerValue(-1)
+	}
+	if !ms {
+		when /= 1000
+	}
+	return NewIntegerValue(when)
+}
+
+// handlePersist 处理 PERSIST 命令，清除键的过期时间，返回是否清除了
+func (rs *RedisServer) handlePersist(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	key := args[0]
+	if c.db.lookupKey(key) == nil || !c.db.store.Persist(key) {
+		return NewIntegerValue(0)
+	}
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "persist", key, c.db.id)
+	return NewIntegerValue(1)
+}
@@ -0,0 +1,154 @@
+package goredis
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpireCommands(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("0", "EXPIRE", "missing", "100")
+	c.mustDo("-2", "TTL", "missing")
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("-1", "TTL", "k")
+	c.mustDo("-1", "PEXPIRETIME", "k")
+
+	c.mustDo("1", "EXPIRE", "k", "100")
+	c.mustDo("100", "TTL", "k")
+	if pttl, _ := strconv.Atoi(replyString(c.do("PTTL", "k"))); pttl <= 99000 || pttl > 100000 {
+		t.Fatalf("PTTL = %d", pttl)
+	}
+	at := time.Now().Add(time.Hour).Unix()
+	c.mustDo("1", "EXPIREAT", "k", strconv.FormatInt(at, 10))
+	c.mustDo(strconv.FormatInt(at, 10), "EXPIRETIME", "k")
+	c.mustDo(strconv.FormatInt(at*1000, 10), "PEXPIRETIME", "k")
+
+	// NX、XX、GT、LT 与 Redis 相同，没有过期时间视为无穷大
+	c.mustDo("0", "EXPIRE", "k", "10", "NX")
+	c.mustDo("0", "EXPIRE", "k", "10", "GT")
+	c.mustDo("1", "EXPIRE", "k", "10", "LT")
+	c.mustDo("1", "EXPIRE", "k", "20", "XX", "GT")
+	c.mustDo("1", "PERSIST", "k")
+	c.mustDo("0", "PERSIST", "k")
+	c.mustDo("0", "EXPIRE", "k", "10", "XX")
+	c.mustDo("0", "EXPIRE", "k", "10", "GT")
+	c.mustDo("1", "EXPIRE", "k", "10", "LT")
+	c.mustDo("(error) ERR NX and XX, GT or LT options at the same time are not compatible", "EXPIRE", "k", "10", "NX", "XX")
+	c.mustDo("(error) ERR GT and LT options at the same time are not compatible", "EXPIRE", "k", "10", "GT", "LT")
+	c.mustDo("(error) ERR Unsupported option FOO", "EXPIRE", "k", "10", "FOO")
+	c.mustDo("(error) ERR invalid expire time in 'expire' command", "EXPIRE", "k", "9223372036854775807")
+	c.mustDo("(error) ERR value is not an integer or out of range", "PEXPIRE", "k", "x")
+
+	// 整体替换值时过期时间被清除
+	c.mustDo("OK", "SET", "k", "v2")
+	c.mustDo("-1", "TTL", "k")
+
+	// 时间已经过去时直接删除
+	c.mustDo("1", "EXPIRE", "k", "-1")
+	c.mustDo("(nil)", "GET", "k")
+	c.mustDo("0", "DBSIZE")
+
+	c.mustDo("OK", "SET", "a", "1")
+	c.mustDo("OK", "SET", "b", "2")
+	c.mustDo("2", "DEL", "a", "b", "c")
+}
+
+func TestExpireLazyAndActive(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	for i := 0; i < 50; i++ {
+		c.mustDo("OK", "SET", "k"+strconv.Itoa(i), "v")
+		c.mustDo("1", "PEXPIRE", "k"+strconv.Itoa(i), "50")
+	}
+	c.mustDo("OK", "SET", "lazy", "v")
+	c.mustDo("1", "PEXPIRE", "lazy", "50")
+	c.mustDo("OK", "SET", "keep", "v")
+	time.Sleep(60 * time.Millisecond)
+
+	// 过期的键立即视为不存在，不必等它被删除
+	c.mustDo("(nil)", "GET", "lazy")
+	c.mustDo("-2", "TTL", "lazy")
+	c.mustDo("[keep]", "KEYS", "*")
+	c.mustDo("[0 [keep]]", "SCAN", "0", "COUNT", "100")
+
+	// 没有被访问的过期键由主动过期删除
+	waitFor(t, "active expiry", func() bool { return replyString(c.do("DBSIZE")) == "1" })
+	c.mustDo("v", "GET", "keep")
+}
+
+func TestExpirePropagation(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "appendfsync always", "aof-use-rdb-preamble no")
+	c := ts.connect(t)
+	c.mustDo("3", "RPUSH", "l", "a", "b", "c")
+	c.mustDo("1", "EXPIRE", "l", "100")
+	when := replyString(c.do("PEXPIRETIME", "l"))
+	c.mustDo("1", "PEXPIRE", "l", "20")
+	when2 := replyString(c.do("PEXPIRETIME", "l"))
+	c.mustDo("OK", "SET", "gone", "v")
+	c.mustDo("1", "EXPIRE", "gone", "0")
+	time.Sleep(30 * time.Millisecond)
+
+	// 写命令执行之前删除过期的键，DEL 与命令一起传播
+	c.mustDo("0", "LPUSHX", "l", "x")
+	c.mustDo("1", "RPUSH", "l", "y")
+	c.mustDo("-1", "TTL", "l")
+	expectAof(t, ts,
+		"SELECT 0",
+		"RPUSH l a b c",
+		"PEXPIREAT l "+when,
+		"PEXPIREAT l "+when2,
+		"SET gone v",
+		"DEL gone",
+		"DEL l",
+		"RPUSH l y",
+	)
+}
+
+func TestExpireReplication(t *testing.T) {
+	master := startTestServer(t)
+	c := master.connect(t)
+	c.mustDo("OK", "SET", "synced", "v")
+	c.mustDo("1", "PEXPIRE", "synced", "1000")
+	c.mustDo("OK", "SET", "keep", "v")
+	replica := startReplica(t, master)
+	r := replica.connect(t)
+
+	// 全量同步带上过期时间，之后的命令以 PEXPIREAT 传播
+	r.mustDo(replyString(c.do("PEXPIRETIME", "synced")), "PEXPIRETIME", "synced")
+	c.mustDo("1", "PEXPIRE", "keep", "100000")
+	c.mustDo("1", "WAIT", "1", "0")
+	r.mustDo(replyString(c.do("PEXPIRETIME", "keep")), "PEXPIRETIME", "keep")
+
+	// 副本上过期的键视为不存在，由主节点传播的 DEL 删除
+	waitFor(t, "the master to delete the expired key", func() bool { return replyString(c.do("DBSIZE")) == "1" })
+	c.mustDo("1", "WAIT", "1", "0")
+	r.mustDo("1", "DBSIZE")
+	r.mustDo("(nil)", "GET", "synced")
+}
+
+func TestExpireAofReplayKeepsExpiredKeys(t *testing.T) {
+	// 原来执行时 l 还没有过期：重放时命令看到的 l 要与当时相同
+	dir := testDir(t)
+	var data []byte
+	for _, argv := range [][]string{
+		{"SELECT", "0"},
+		{"RPUSH", "l", "a"},
+		{"PEXPIREAT", "l", "1"},
+		{"LPUSHX", "l", "x"},
+		{"PERSIST", "l"},
+	} {
+		data = appendRESPCommand(data, argv)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "appendonly.aof"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := startTestServerIn(t, dir, "appendonly yes")
+	c := ts.connect(t)
+	c.mustDo("[x a]", "LRANGE", "l", "0", "-1")
+	c.mustDo("-1", "TTL", "l")
+}
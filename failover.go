@@ -0,0 +1,236 @@
+package goredis
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 故障转移的状态
+const (
+	FAILOVER_WAIT_FOR_SYNC = iota + 1 // 已经暂停写入，等待副本赶上复制偏移量
+	FAILOVER_IN_PROGRESS              // 已经成为目标副本的副本，等待它接受 PSYNC FAILOVER
+)
+
+// failoverStateNames 是 INFO replication 中 master_failover_state 的取值
+var failoverStateNames = map[int]string{
+	0:                      "no-failover",
+	FAILOVER_WAIT_FOR_SYNC: "waiting-for-sync",
+	FAILOVER_IN_PROGRESS:   "failover-in-progress",
+}
+
+// errFailoverRejected 表示目标副本拒绝了 PSYNC FAILOVER
+var errFailoverRejected = errors.New("Failover target rejected psync request")
+
+// failoverState 是进行中的 FAILOVER
+//
+// host 和 port 是目标副本，没有指定时为空，第一个赶上复制偏移量的副本成为目标；end 是 TIMEOUT
+// 指定的截止时间（零值表示一直等待），force 表示超时后不再等待，直接转移到目标副本。
+// 故障转移期间暂停可能写入的命令，结束时关闭 paused 唤醒它们。字段由 replMu 保护。
+type failoverState struct {
+	state  int
+	host   string
+	port   int
+	end    time.Time
+	force  bool
+	paused chan struct{}
+}
+
+// target 返回目标副本在日志中的名称
+func (fo *failoverState) target() string {
+	if fo.host == "" {
+		return "any replica"
+	}
+	return net.JoinHostPort(fo.host, strconv.Itoa(fo.port))
+}
+
+// handleFailover 处理 FAILOVER [TO host port [FORCE]] [ABORT] [TIMEOUT milliseconds] 命令
+//
+// 与 Redis 相同的协调故障转移：暂停写命令，在命令流中发送 REPLCONF GETACK * 后立即回复 OK；
+// 目标副本（没有指定时是任一副本）确认了当前的复制偏移量后，本节点成为它的副本，并以
+// PSYNC replid offset FAILOVER 请求同步，目标副本收到后成为主节点，两者的数据集因此完全一致。
+// 超过 TIMEOUT 还没有副本赶上时放弃，指定了 FORCE 时则直接转移到目标副本。ABORT 放弃进行中的
+// 故障转移，已经成为副本时重新成为主节点。故障转移成功或放弃后，暂停的写命令继续执行，
+// 本节点已经成为只读副本时它们得到 READONLY 错误。
+func (rs *RedisServer) handleFailover(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if rs.clusterEnabled {
+		return NewErrorValue("ERR FAILOVER not allowed in cluster mode.")
+	}
+	var host string
+	var port, timeout int64
+	var force, abort bool
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "to") && host == "" && i+2 < len(args):
+			n, err := strconv.ParseInt(args[i+2], 10, 64)
+			if err != nil {
+				return NewErrorValue("ERR value is not an integer or out of range")
+			}
+			host, port = args[i+1], n
+			i += 2
+		case strings.EqualFold(args[i], "timeout") && timeout == 0 && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return NewErrorValue("ERR value is not an integer or out of range")
+			}
+			if n <= 0 {
+				return NewErrorValue("ERR FAILOVER timeout must be greater than 0")
+			}
+			timeout = n
+			i++
+		case strings.EqualFold(args[i], "force") && !force:
+			force = true
+		case strings.EqualFold(args[i], "abort") && !abort:
+			abort = true
+		default:
+			return NewErrorValue("ERR syntax error")
+		}
+	}
+
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if abort {
+		if rs.failover == nil {
+			return NewErrorValue("ERR No failover in progress.")
+		}
+		rs.abortFailover("Failover manually aborted")
+		return NewSimpleStringValue("OK")
+	}
+	if force && (timeout == 0 || host == "") {
+		return NewErrorValue("ERR FAILOVER with force option requires both a timeout and target HOST and IP.")
+	}
+	if rs.masterHost != "" {
+		return NewErrorValue("ERR FAILOVER is not valid when server is a replica.")
+	}
+	if len(rs.replicas) == 0 {
+		return NewErrorValue("ERR FAILOVER requires connected replicas.")
+	}
+	if rs.failover != nil {
+		return NewErrorValue("ERR FAILOVER already in progress.")
+	}
+	fo := &failoverState{state: FAILOVER_WAIT_FOR_SYNC, force: force, paused: make(chan struct{})}
+	if host != "" {
+		replica := rs.findReplica(host, int(port))
+		if replica == nil {
+			return NewErrorValue("ERR FAILOVER target HOST and PORT is not a replica.")
+		}
+		if replica.replState != SLAVE_STATE_ONLINE {
+			return NewErrorValue("ERR FAILOVER target replica is not online.")
+		}
+		fo.host, fo.port = host, int(port)
+	}
+	if timeout > 0 {
+		fo.end = time.Now().Add(time.Duration(timeout) * time.Millisecond)
+	}
+	rs.failover = fo
+	log.Printf("FAILOVER requested to %s.", fo.target())
+
+	// FAILOVER 是独占命令，这时没有执行中的写命令，之后的写命令都会暂停（见 failoverPausedFor）
+	rs.replicationFeedStream(catAppendOnlyCommands(nil, []propagatedCommand{{dbid: -1, argv: []string{"REPLCONF", "GETACK", "*"}}}, &rs.replSelectedDB))
+	return NewSimpleStringValue("OK")
+}
+
+// findReplica 返回地址和端口为 host:port 的副本，没有时返回 nil（调用方需持有 replMu）
+func (rs *RedisServer) findReplica(host string, port int) *client {
+	for _, c := range rs.replicas {
+		if h, p := replicaAddr(c); strings.EqualFold(h, host) && p == port {
+			return c
+		}
+	}
+	return nil
+}
+
+// updateFailoverStatus 在等待副本赶上时检查故障转移能否开始（调用方需持有 replMu）
+//
+// 副本发送 ACK 和 replicationCron 时调用。目标副本确认了当前的复制偏移量时，本节点成为它的副本；
+// 超时的时候，指定了 FORCE 则不再等待，否则放弃。
+func (rs *RedisServer) updateFailoverStatus() {
+	fo := rs.failover
+	if fo == nil || fo.state != FAILOVER_WAIT_FOR_SYNC {
+		return
+	}
+	if !fo.end.IsZero() && !time.Now().Before(fo.end) {
+		if !fo.force {
+			rs.abortFailover("Replica never caught up before timeout")
+			return
+		}
+		log.Printf("FAILOVER to %s time out exceeded, failing over.", fo.target())
+		fo.state = FAILOVER_IN_PROGRESS
+		rs.replicationSetMaster(fo.host, fo.port)
+		return
+	}
+
+	var replica *client
+	if fo.host != "" {
+		replica = rs.findReplica(fo.host, fo.port)
+	} else {
+		for _, c := range rs.replicas {
+			if c.replState == SLAVE_STATE_ONLINE && c.replAckOff == rs.masterReplOffset {
+				replica = c
+				fo.host, fo.port = replicaAddr(c)
+				break
+			}
+		}
+	}
+	if replica == nil || replica.replAckOff != rs.masterReplOffset {
+		return
+	}
+	log.Printf("Failover target %s is synced, failing over.", fo.target())
+	fo.state = FAILOVER_IN_PROGRESS
+	rs.replicationSetMaster(fo.host, fo.port)
+}
+
+// failoverFinished 在目标副本接受了 PSYNC FAILOVER 时调用，结束故障转移，恢复暂停的写命令
+func (rs *RedisServer) failoverFinished(link *masterLink) {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if fo := rs.failover; fo != nil && fo.state == FAILOVER_IN_PROGRESS && rs.masterLink == link {
+		log.Printf("FAILOVER to %s succeeded.", fo.target())
+		rs.clearFailover()
+	}
+}
+
+// abortFailover 放弃故障转移，已经成为目标副本的副本时重新成为主节点（调用方需持有 replMu）
+func (rs *RedisServer) abortFailover(reason string) {
+	fo := rs.failover
+	if fo.state == FAILOVER_IN_PROGRESS {
+		rs.replicationUnsetMaster()
+	}
+	log.Printf("FAILOVER to %s aborted: %s", fo.target(), reason)
+	rs.clearFailover()
+}
+
+// clearFailover 清除故障转移的状态，唤醒暂停的写命令（调用方需持有 replMu）
+func (rs *RedisServer) clearFailover() {
+	close(rs.failover.paused)
+	rs.failover = nil
+}
+
+// failoverPausedFor 在故障转移期间对可能写入的命令返回暂停结束时关闭的 channel，否则返回 nil
+//
+// 可能写入的命令是写命令、含有写命令的事务和脚本；主节点传来的命令不暂停。
+func (rs *RedisServer) failoverPausedFor(c *client, cmd *redisCommand) <-chan struct{} {
+	if c.master {
+		return nil
+	}
+	switch {
+	case cmd.flags&CMD_WRITE != 0:
+	case cmd.name == "exec" && c.multiHasWrite():
+	case cmd.name == "eval" || cmd.name == "evalsha" || cmd.name == "fcall" || cmd.name == "gocall":
+	default:
+		return nil
+	}
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if rs.failover == nil {
+		return nil
+	}
+	return rs.failover.paused
+}
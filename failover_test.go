@@ -0,0 +1,128 @@
+package goredis
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// role 返回 INFO replication 中的 role
+func (ts *testServer) role(t *testing.T) string {
+	return infoValue(t, ts.connect(t).do("INFO", "replication").Str, "role")
+}
+
+// startSilentReplica 连接 master 完成全量同步，之后不再发送 ACK，master 的 WAIT 和 FAILOVER 等不到它
+func startSilentReplica(t *testing.T, master *testServer) {
+	t.Helper()
+	conn, err := net.Dial("tcp", master.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	reader := bufio.NewReader(conn)
+	for _, cmd := range []string{"PING", "REPLCONF listening-port 1", "REPLCONF capa eof capa psync2", "PSYNC ? -1"} {
+		var argv []*RESPValue
+		for _, arg := range strings.Fields(cmd) {
+			argv = append(argv, NewBulkStringValue(arg))
+		}
+		conn.Write(NewArrayValue(argv).SerializeRESP())
+		line, err := reader.ReadString('\n')
+		if err != nil || line[0] == '-' {
+			t.Fatalf("%s: %q %v", cmd, line, err)
+		}
+	}
+	// PSYNC 的回复之后是 RDB，主节点可能先发送换行保持连接
+	line := "\n"
+	for line == "\n" {
+		if line, err = reader.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		t.Fatalf("RDB length %q", line)
+	}
+	if _, err := io.CopyN(io.Discard, reader, int64(n)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "silent replica to come online", func() bool { return master.onlineReplicas() == 1 })
+	go io.Copy(io.Discard, reader)
+}
+
+func TestFailover(t *testing.T) {
+	master := startTestServer(t)
+	replica := startReplica(t, master)
+	c := master.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("OK", "FAILOVER")
+
+	// 副本成为主节点，原来的主节点成为它的副本，数据集一致
+	waitFor(t, "failover to finish", func() bool {
+		return replica.role(t) == "master" && master.role(t) == "slave" && master.masterLinkUp()
+	})
+	if state := infoValue(t, c.do("INFO", "replication").Str, "master_failover_state"); state != "no-failover" {
+		t.Fatalf("master_failover_state:%s", state)
+	}
+	c.mustDo("(error) READONLY You can't write against a read only replica.", "SET", "k", "w")
+	r := replica.connect(t)
+	r.mustDo("v", "GET", "k")
+	r.mustDo("OK", "SET", "k", "w")
+	r.mustDo("1", "WAIT", "1", "0")
+	c.mustDo("w", "GET", "k")
+}
+
+func TestFailoverTimeoutResumesWrites(t *testing.T) {
+	master := startTestServer(t)
+	startSilentReplica(t, master)
+	c, other := master.connect(t), master.connect(t)
+	c.mustDo("OK", "FAILOVER", "TIMEOUT", "300")
+	if state := infoValue(t, c.do("INFO", "replication").Str, "master_failover_state"); state != "waiting-for-sync" {
+		t.Fatalf("master_failover_state:%s", state)
+	}
+
+	// 等待副本期间写命令暂停，只读命令照常执行；超时放弃后写命令继续执行
+	start := time.Now()
+	other.send("SET", "k", "v")
+	c.mustDo("(nil)", "GET", "k")
+	if got := replyString(other.read()); got != "OK" {
+		t.Fatalf("paused SET got %s", got)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("SET returned after %v during failover", elapsed)
+	}
+	if role := master.role(t); role != "master" {
+		t.Fatalf("role:%s after the failover timed out", role)
+	}
+}
+
+func TestFailoverAbort(t *testing.T) {
+	master := startTestServer(t)
+	startSilentReplica(t, master)
+	c, other := master.connect(t), master.connect(t)
+	c.mustDo("OK", "FAILOVER")
+	other.send("SET", "k", "v")
+	c.mustDo("(error) ERR FAILOVER already in progress.", "FAILOVER")
+	c.mustDo("(error) ERR REPLICAOF not allowed while failing over.", "REPLICAOF", "127.0.0.1", "1")
+	c.mustDo("OK", "FAILOVER", "ABORT")
+	if got := replyString(other.read()); got != "OK" {
+		t.Fatalf("paused SET got %s", got)
+	}
+	c.mustDo("(error) ERR No failover in progress.", "FAILOVER", "ABORT")
+}
+
+func TestFailoverErrors(t *testing.T) {
+	master := startTestServer(t)
+	c := master.connect(t)
+	c.mustDo("(error) ERR FAILOVER requires connected replicas.", "FAILOVER")
+	c.mustDo("(error) ERR FAILOVER with force option requires both a timeout and target HOST and IP.", "FAILOVER", "FORCE")
+	c.mustDo("(error) ERR FAILOVER timeout must be greater than 0", "FAILOVER", "TIMEOUT", "0")
+	c.mustDo("(error) ERR syntax error", "FAILOVER", "NOW")
+
+	replica := startReplica(t, master)
+	c.mustDo("(error) ERR FAILOVER target HOST and PORT is not a replica.", "FAILOVER", "TO", "127.0.0.1", "1")
+	replica.connect(t).mustDo("(error) ERR FAILOVER is not valid when server is a replica.", "FAILOVER")
+}
@@ -0,0 +1,483 @@
+package goredis
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// functionLibrary 是 FUNCTION LOAD 加载的函数库，code 是包括元数据行在内的完整代码
+type functionLibrary struct {
+	name      string
+	code      string
+	functions map[string]*luaFunction
+}
+
+// luaFunction 是函数库中用 redis.register_function 注册的函数
+type luaFunction struct {
+	name        string
+	description string
+	flags       []string
+	noWrites    bool // 带 no-writes 标志，可以用 FCALL_RO 调用
+	library     *functionLibrary
+	callback    *lua.LFunction
+}
+
+// functionFlags 是 redis.register_function 接受的函数标志
+var functionFlags = map[string]bool{
+	"no-writes":             true,
+	"allow-oom":             true,
+	"allow-stale":           true,
+	"no-cluster":            true,
+	"allow-cross-slot-keys": true,
+}
+
+// luaFunctionChunkName 是函数库代码在错误信息中的名称
+const luaFunctionChunkName = "user_function"
+
+// functionLoadTimeout 是 FUNCTION LOAD 执行库代码的时间上限，与 Redis 相同
+const functionLoadTimeout = 500 * time.Millisecond
+
+// functionsInit 创建执行函数的 Lua 解释器并清空所有函数库
+//
+// 函数与 EVAL 脚本使用不同的解释器，SCRIPT FLUSH 不影响函数。
+func (rs *RedisServer) functionsInit() {
+	L := rs.newLuaState()
+	redis := L.GetGlobal("redis").(*lua.LTable)
+	redis.RawSetString("register_function", L.NewFunction(rs.luaRegisterFunction))
+
+	rs.functionsLua = L
+	rs.libraries = make(map[string]*functionLibrary)
+	rs.functions = make(map[string]*luaFunction)
+}
+
+// validFunctionName 判断函数名或库名是否只由字母、数字和下划线组成且不为空
+func validFunctionName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, ch := range name {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLibraryMetadata 解析代码第一行的 #!lua name=<库名>，返回库名和去掉元数据后的代码
+//
+// 元数据行替换为空行，错误信息中的行号与原代码一致。
+func parseLibraryMetadata(code string) (string, string, *RESPValue) {
+	if !strings.HasPrefix(code, "#!") {
+		return "", "", NewErrorValue("ERR Missing library metadata")
+	}
+	shebang, body, _ := strings.Cut(code, "\n")
+	fields := strings.Fields(shebang[2:])
+	if len(fields) == 0 {
+		return "", "", NewErrorValue("ERR Missing library metadata")
+	}
+	if !strings.EqualFold(fields[0], "lua") {
+		return "", "", NewErrorValue("ERR Engine '" + fields[0] + "' not found")
+	}
+	name := ""
+	for _, field := range fields[1:] {
+		value, ok := strings.CutPrefix(field, "name=")
+		if !ok {
+			return "", "", NewErrorValue("ERR Invalid metadata value given: " + field)
+		}
+		name = value
+	}
+	if name == "" {
+		return "", "", NewErrorValue("ERR Library name was not given")
+	}
+	if !validFunctionName(name) {
+		return "", "", NewErrorValue("ERR Library names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	return name, "\n" + body, nil
+}
+
+// functionsCreateLibrary 编译并执行函数库代码，把注册的函数加入服务器，返回库名
+//
+// 同名的库已存在时，replace 为 true 则替换，否则报错；任何一步出错时已有的库不受影响。
+func (rs *RedisServer) functionsCreateLibrary(code string, replace bool) (string, *RESPValue) {
+	name, body, errResp := parseLibraryMetadata(code)
+	if errResp != nil {
+		return "", errResp
+	}
+	old := rs.libraries[name]
+	if old != nil && !replace {
+		return "", NewErrorValue("ERR Library '" + name + "' already exists")
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(body), luaFunctionChunkName)
+	if err != nil {
+		return "", NewErrorValue("ERR Error compiling function: " + luaErrorLine(err.Error()))
+	}
+	proto, err := lua.Compile(chunk, luaFunctionChunkName)
+	if err != nil {
+		return "", NewErrorValue("ERR Error compiling function: " + luaErrorLine(err.Error()))
+	}
+
+	// 执行库代码，其中的 redis.register_function 把函数注册到 functionsLoading；
+	// 库代码只应注册函数，执行超过 functionLoadTimeout 时终止
+	lib := &functionLibrary{name: name, code: code, functions: make(map[string]*luaFunction)}
+	L := rs.functionsLua
+	ctx, cancel := context.WithTimeout(context.Background(), functionLoadTimeout)
+	defer cancel()
+	rs.functionsLoading = lib
+	L.SetContext(ctx)
+	L.Push(L.NewFunctionFromProto(proto))
+	err = L.PCall(0, 0, nil)
+	L.RemoveContext()
+	rs.functionsLoading = nil
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", NewErrorValue("ERR FUNCTION LOAD timeout")
+		}
+		return "", NewErrorValue("ERR Error registering functions: " + luaErrorLine(luaErrorMessage(err)))
+	}
+	if len(lib.functions) == 0 {
+		return "", NewErrorValue("ERR No functions registered")
+	}
+	for fname := range lib.functions {
+		if existing, ok := rs.functions[fname]; ok && existing.library != old {
+			return "", NewErrorValue("ERR Function " + fname + " already exists")
+		}
+	}
+
+	if old != nil {
+		rs.functionsDeleteLibrary(old)
+	}
+	rs.libraries[name] = lib
+	for fname, fn := range lib.functions {
+		rs.functions[fname] = fn
+	}
+	return name, nil
+}
+
+// functionsDeleteLibrary 删除函数库及其中的所有函数
+func (rs *RedisServer) functionsDeleteLibrary(lib *functionLibrary) {
+	for fname := range lib.functions {
+		delete(rs.functions, fname)
+	}
+	delete(rs.libraries, lib.name)
+}
+
+// luaRegisterFunction 实现 redis.register_function，只能在 FUNCTION LOAD 执行库代码时调用
+//
+// 可以用 redis.register_function(name, callback) 或
+// redis.register_function{function_name = ..., callback = ..., flags = {...}, description = ...} 两种形式。
+func (rs *RedisServer) luaRegisterFunction(L *lua.LState) int {
+	lib := rs.functionsLoading
+	if lib == nil {
+		L.RaiseError("redis.register_function can only be called on FUNCTION LOAD command")
+	}
+
+	fn := &luaFunction{library: lib}
+	switch L.GetTop() {
+	case 1:
+		tbl, ok := L.Get(1).(*lua.LTable)
+		if !ok {
+			L.RaiseError("calling redis.register_function with a single argument is only applicable to Lua table (representing named arguments).")
+		}
+		var argErr string
+		tbl.ForEach(func(k, v lua.LValue) {
+			if argErr != "" {
+				return
+			}
+			switch k.String() {
+			case "function_name":
+				s, ok := v.(lua.LString)
+				if !ok {
+					argErr = "function_name argument given to redis.register_function must be a string"
+				}
+				fn.name = string(s)
+			case "description":
+				s, ok := v.(lua.LString)
+				if !ok {
+					argErr = "description argument given to redis.register_function must be a string"
+				}
+				fn.description = string(s)
+			case "callback":
+				f, ok := v.(*lua.LFunction)
+				if !ok {
+					argErr = "callback argument given to redis.register_function must be a function"
+				}
+				fn.callback = f
+			case "flags":
+				flags, ok := v.(*lua.LTable)
+				if !ok {
+					argErr = "flags argument to redis.register_function must be a table representing function flags"
+					return
+				}
+				flags.ForEach(func(_, flag lua.LValue) {
+					s, ok := flag.(lua.LString)
+					if !ok || !functionFlags[string(s)] {
+						argErr = "unknown flag given"
+						return
+					}
+					fn.flags = append(fn.flags, string(s))
+					if s == "no-writes" {
+						fn.noWrites = true
+					}
+				})
+			default:
+				argErr = "unknown argument given to redis.register_function"
+			}
+		})
+		if argErr != "" {
+			L.RaiseError("%s", argErr)
+		}
+		if fn.name == "" {
+			L.RaiseError("redis.register_function must get a function name argument")
+		}
+		if fn.callback == nil {
+			L.RaiseError("redis.register_function must get a callback argument")
+		}
+	case 2:
+		name, ok := L.Get(1).(lua.LString)
+		if !ok {
+			L.RaiseError("first argument to redis.register_function must be a string")
+		}
+		callback, ok := L.Get(2).(*lua.LFunction)
+		if !ok {
+			L.RaiseError("second argument to redis.register_function must be a function")
+		}
+		fn.name, fn.callback = string(name), callback
+	default:
+		L.RaiseError("wrong number of arguments to redis.register_function")
+	}
+
+	if !validFunctionName(fn.name) {
+		L.RaiseError("Function names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	if _, ok := lib.functions[fn.name]; ok {
+		L.RaiseError("Function already exists in the library")
+	}
+	lib.functions[fn.name] = fn
+	return 0
+}
+
+// handleFCall 处理 FCALL 和 FCALL_RO function numkeys [key ...] [arg ...] 命令
+//
+// 函数以键名数组和参数数组两个参数调用。FCALL_RO 只能调用带 no-writes 标志的函数，
+// 带该标志的函数中不能执行写命令。
+func (rs *RedisServer) handleFCall(c *client, command *RESPValue, readOnly bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	fn, ok := rs.functions[args[0]]
+	if !ok {
+		return NewErrorValue("ERR Function not found")
+	}
+	if readOnly && !fn.noWrites {
+		return NewErrorValue("ERR Can not execute a script with write flag using *_ro command.")
+	}
+	keys, argv, errResp := splitNumKeys(args[1:])
+	if errResp != nil {
+		return errResp
+	}
+	L := rs.functionsLua
+	return rs.luaCall(c, L, fn.callback, []lua.LValue{luaStringArray(L, keys), luaStringArray(L, argv)}, fn.name, fn.noWrites)
+}
+
+// handleFunction 处理 FUNCTION LOAD/LIST/DELETE/KILL/FLUSH/DUMP/RESTORE 命令
+func (rs *RedisServer) handleFunction(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "LOAD":
+		if len(args) < 2 || len(args) > 3 {
+			return wrongArgsError("function|load")
+		}
+		replace := false
+		if len(args) == 3 {
+			if !strings.EqualFold(args[1], "REPLACE") {
+				return NewErrorValue("ERR Unknown option given: " + args[1])
+			}
+			replace = true
+		}
+		name, errResp := rs.functionsCreateLibrary(args[len(args)-1], replace)
+		if errResp != nil {
+			return errResp
+		}
+		rs.dirty.Add(1)
+		return NewBulkStringValue(name)
+	case "LIST":
+		return rs.functionList(c, args[1:])
+	case "DELETE":
+		if len(args) != 2 {
+			return wrongArgsError("function|delete")
+		}
+		lib, ok := rs.libraries[args[1]]
+		if !ok {
+			return NewErrorValue("ERR Library not found")
+		}
+		rs.functionsDeleteLibrary(lib)
+		rs.dirty.Add(1)
+		return NewSimpleStringValue("OK")
+	case "KILL":
+		if len(args) != 1 {
+			return wrongArgsError("function|kill")
+		}
+		return rs.scriptKill(true)
+	case "FLUSH":
+		if len(args) > 2 {
+			return wrongArgsError("function|flush")
+		}
+		if len(args) == 2 && !strings.EqualFold(args[1], "SYNC") && !strings.EqualFold(args[1], "ASYNC") {
+			return NewErrorValue("ERR FUNCTION FLUSH only supports SYNC|ASYNC option")
+		}
+		rs.functionsLua.Close()
+		rs.functionsInit()
+		rs.dirty.Add(1)
+		return NewSimpleStringValue("OK")
+	case "DUMP":
+		if len(args) != 1 {
+			return wrongArgsError("function|dump")
+		}
+		return NewBulkStringValue(string(rs.functionsDump()))
+	case "RESTORE":
+		if len(args) < 2 || len(args) > 3 {
+			return wrongArgsError("function|restore")
+		}
+		policy := "APPEND"
+		if len(args) == 3 {
+			policy = strings.ToUpper(args[2])
+			if policy != "FLUSH" && policy != "APPEND" && policy != "REPLACE" {
+				return NewErrorValue("ERR Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE.")
+			}
+		}
+		return rs.functionsRestore([]byte(args[1]), policy)
+	default:
+		return NewErrorValue("ERR unknown subcommand '" + args[0] + "'. Try FUNCTION HELP.")
+	}
+}
+
+// functionList 处理 FUNCTION LIST [WITHCODE] [LIBRARYNAME pattern]，按库名排序返回函数库的信息
+func (rs *RedisServer) functionList(c *client, args []string) *RESPValue {
+	withCode := false
+	pattern := ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "WITHCODE") && !withCode:
+			withCode = true
+		case strings.EqualFold(args[i], "LIBRARYNAME") && pattern == "":
+			if i+1 >= len(args) {
+				return NewErrorValue("ERR library name argument was not given")
+			}
+			pattern = args[i+1]
+			i++
+		default:
+			return NewErrorValue("ERR Unknown argument " + args[i])
+		}
+	}
+
+	names := make([]string, 0, len(rs.libraries))
+	for name := range rs.libraries {
+		if pattern == "" || stringMatch(pattern, name, false) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	libs := make([]*RESPValue, 0, len(names))
+	for _, name := range names {
+		lib := rs.libraries[name]
+		fnames := make([]string, 0, len(lib.functions))
+		for fname := range lib.functions {
+			fnames = append(fnames, fname)
+		}
+		sort.Strings(fnames)
+
+		functions := make([]*RESPValue, 0, len(fnames))
+		for _, fname := range fnames {
+			fn := lib.functions[fname]
+			description := NewNullBulkStringValue()
+			if fn.description != "" {
+				description = NewBulkStringValue(fn.description)
+			}
+			flags := make([]*RESPValue, 0, len(fn.flags))
+			for _, flag := range fn.flags {
+				flags = append(flags, NewBulkStringValue(flag))
+			}
+			functions = append(functions, NewMapValue([]*RESPValue{
+				NewBulkStringValue("name"), NewBulkStringValue(fn.name),
+				NewBulkStringValue("description"), description,
+				NewBulkStringValue("flags"), NewArrayValue(flags),
+			}))
+		}
+
+		info := []*RESPValue{
+			NewBulkStringValue("library_name"), NewBulkStringValue(lib.name),
+			NewBulkStringValue("engine"), NewBulkStringValue("LUA"),
+			NewBulkStringValue("functions"), NewArrayValue(functions),
+		}
+		if withCode {
+			info = append(info, NewBulkStringValue("library_code"), NewBulkStringValue(lib.code))
+		}
+		libs = append(libs, NewMapValue(info))
+	}
+	return NewArrayValue(libs)
+}
+
+// functionsDump 以 RDB 格式序列化所有函数库：每个库是 FUNCTION2 操作码和库代码，
+// 最后是 RDB 版本和 CRC64，与 Redis 的 FUNCTION DUMP 相同
+func (rs *RedisServer) functionsDump() []byte {
+	e := &rdbEncoder{compress: rs.rdbCompression}
+	rs.rdbAppendFunctions(e)
+	return rdbAppendDumpFooter(e.buf)
+}
+
+// functionsRestore 加载 FUNCTION DUMP 生成的载荷
+//
+// policy 为 FLUSH 时先删除所有库，APPEND 时库名冲突报错，REPLACE 时替换同名的库。
+// 任何一个库加载失败时恢复原有的函数库。
+func (rs *RedisServer) functionsRestore(payload []byte, policy string) *RESPValue {
+	data, ok := rdbVerifyDumpPayload(payload)
+	if !ok {
+		return NewErrorValue("ERR payload version or checksum are wrong")
+	}
+	var codes []string
+	r := &rdbReader{data: data}
+	for !r.eof() {
+		opcode, _ := r.readByte()
+		if opcode != RDB_OPCODE_FUNCTION2 {
+			return NewErrorValue("ERR given type is not a function")
+		}
+		code, err := r.readString()
+		if err != nil {
+			return NewErrorValue("ERR payload version or checksum are wrong")
+		}
+		codes = append(codes, code)
+	}
+
+	libraries := make(map[string]*functionLibrary, len(rs.libraries))
+	for name, lib := range rs.libraries {
+		libraries[name] = lib
+	}
+	functions := make(map[string]*luaFunction, len(rs.functions))
+	for name, fn := range rs.functions {
+		functions[name] = fn
+	}
+	if policy == "FLUSH" {
+		rs.libraries = make(map[string]*functionLibrary)
+		rs.functions = make(map[string]*luaFunction)
+	}
+	for _, code := range codes {
+		if _, errResp := rs.functionsCreateLibrary(code, policy == "REPLACE"); errResp != nil {
+			rs.libraries, rs.functions = libraries, functions
+			return errResp
+		}
+	}
+	rs.dirty.Add(1)
+	return NewSimpleStringValue("OK")
+}
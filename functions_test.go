@@ -0,0 +1,114 @@
+package goredis
+
+import (
+	"strings"
+	"testing"
+)
+
+const testLibrary = `#!lua name=mylib
+redis.register_function('myset', function(keys, args) return redis.call('SET', keys[1], args[1]) end)
+redis.register_function{
+	function_name = 'myget',
+	callback = function(keys) return redis.call('GET', keys[1]) end,
+	description = 'read a key',
+	flags = {'no-writes'},
+}
+redis.register_function{
+	function_name = 'sneaky',
+	callback = function(keys) return redis.call('SET', keys[1], 'x') end,
+	flags = {'no-writes'},
+}
+`
+
+func TestFunctionLoadAndCall(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("mylib", "FUNCTION", "LOAD", testLibrary)
+	c.mustDo("(error) ERR Library 'mylib' already exists", "FUNCTION", "LOAD", testLibrary)
+	c.mustDo("mylib", "FUNCTION", "LOAD", "REPLACE", testLibrary)
+
+	c.mustDo("OK", "FCALL", "myset", "1", "k", "v")
+	c.mustDo("v", "FCALL", "myget", "1", "k")
+	c.mustDo("v", "FCALL_RO", "myget", "1", "k")
+	c.mustDo("(error) ERR Can not execute a script with write flag using *_ro command.", "FCALL_RO", "myset", "1", "k", "v")
+	// 带 no-writes 标志的函数不能执行写命令
+	c.mustDo("(error) ERR Write commands are not allowed from read-only scripts.", "FCALL", "sneaky", "1", "k")
+	c.mustDo("v", "GET", "k")
+	c.mustDo("(error) ERR Function not found", "FCALL", "nosuch", "0")
+
+	// 函数与脚本使用不同的解释器，SCRIPT FLUSH 不影响函数
+	c.mustDo("OK", "SCRIPT", "FLUSH")
+	c.mustDo("v", "FCALL", "myget", "1", "k")
+
+	c.mustDo("OK", "FUNCTION", "DELETE", "mylib")
+	c.mustDo("(error) ERR Library not found", "FUNCTION", "DELETE", "mylib")
+	c.mustDo("(error) ERR Function not found", "FCALL", "myget", "1", "k")
+}
+
+func TestFunctionLoadErrors(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	for code, want := range map[string]string{
+		"return 1":                            "ERR Missing library metadata",
+		"#!python name=x\n":                   "ERR Engine 'python' not found",
+		"#!lua\n":                             "ERR Library name was not given",
+		"#!lua name=a-b\n":                    "ERR Library names can only contain letters",
+		"#!lua name=empty\nreturn 1":          "ERR No functions registered",
+		"#!lua name=bad\nreturn (":            "ERR Error compiling function",
+		"#!lua name=glob\nx = 1":              "ERR Error registering functions",
+		"#!lua name=call\nredis.call('PING')": "ERR Error registering functions",
+	} {
+		if got := replyString(c.do("FUNCTION", "LOAD", code)); !strings.HasPrefix(got, "(error) "+want) {
+			t.Errorf("FUNCTION LOAD %q: got %s, want %s", code, got, want)
+		}
+	}
+	c.mustDo("mylib", "FUNCTION", "LOAD", testLibrary)
+	// 其他库中已有同名函数时加载失败
+	c.mustDo("(error) ERR Function myset already exists", "FUNCTION", "LOAD",
+		"#!lua name=other\nredis.register_function('myset', function() return 1 end)")
+	c.mustDo("[]", "FUNCTION", "LIST", "LIBRARYNAME", "other")
+}
+
+func TestFunctionList(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("mylib", "FUNCTION", "LOAD", testLibrary)
+	c.mustDo("lib2", "FUNCTION", "LOAD", "#!lua name=lib2\nredis.register_function('f2', function() return 2 end)")
+	c.mustDo("[[library_name lib2 engine LUA functions [[name f2 description (nil) flags []]]]]",
+		"FUNCTION", "LIST", "LIBRARYNAME", "lib*")
+	c.mustDo("[[library_name mylib engine LUA functions [[name myget description read a key flags [no-writes]] "+
+		"[name myset description (nil) flags []] [name sneaky description (nil) flags [no-writes]]] library_code "+
+		testLibrary+"]]",
+		"FUNCTION", "LIST", "WITHCODE", "LIBRARYNAME", "my*")
+	c.mustDo("(error) ERR Unknown argument NOPE", "FUNCTION", "LIST", "NOPE")
+
+	c.mustDo("(error) ERR FUNCTION FLUSH only supports SYNC|ASYNC option", "FUNCTION", "FLUSH", "NOW")
+	c.mustDo("OK", "FUNCTION", "FLUSH")
+	c.mustDo("[]", "FUNCTION", "LIST")
+}
+
+func TestFunctionDumpRestore(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("mylib", "FUNCTION", "LOAD", testLibrary)
+	c.mustDo("lib2", "FUNCTION", "LOAD", "#!lua name=lib2\nredis.register_function('f2', function() return 2 end)")
+	dump := c.do("FUNCTION", "DUMP").Str
+
+	c.mustDo("OK", "FUNCTION", "DELETE", "mylib")
+	// APPEND 遇到同名的库时整体失败，已有的库不变
+	c.mustDo("(error) ERR Library 'lib2' already exists", "FUNCTION", "RESTORE", dump)
+	c.mustDo("(error) ERR Function not found", "FCALL", "myset", "1", "k", "v")
+	c.mustDo("OK", "FUNCTION", "RESTORE", dump, "REPLACE")
+	c.mustDo("OK", "FCALL", "myset", "1", "k", "v")
+	c.mustDo("OK", "FUNCTION", "RESTORE", dump, "FLUSH")
+	c.mustDo("2", "FCALL", "f2", "0")
+
+	other := startTestServer(t).connect(t)
+	other.mustDo("OK", "FUNCTION", "RESTORE", dump)
+	other.mustDo("2", "FCALL", "f2", "0")
+
+	c.mustDo("(error) ERR Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE.", "FUNCTION", "RESTORE", dump, "MERGE")
+	corrupt := []byte(dump)
+	corrupt[len(corrupt)-1] ^= 0xff
+	c.mustDo("(error) ERR payload version or checksum are wrong", "FUNCTION", "RESTORE", string(corrupt))
+}
@@ -0,0 +1,647 @@
+package goredis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GEOSEARCH 结果的排序方式
+const (
+	GEO_SORT_NONE = iota
+	GEO_SORT_ASC
+	GEO_SORT_DESC
+)
+
+// 地理位置搜索命令的变体，决定可以接受哪些选项
+const (
+	GEO_CMD_SEARCH = iota
+	GEO_CMD_SEARCHSTORE
+	GEO_CMD_RADIUS    // GEORADIUS 和 GEORADIUSBYMEMBER，可以带 STORE/STOREDIST
+	GEO_CMD_RADIUS_RO // 只读的 GEORADIUS_RO 和 GEORADIUSBYMEMBER_RO
+)
+
+// geoPoint 表示一个搜索结果，dist 以米为单位
+type geoPoint struct {
+	member    string
+	longitude float64
+	latitude  float64
+	dist      float64
+	score     float64
+}
+
+// geoSearchSpec 表示解析后的搜索参数
+type geoSearchSpec struct {
+	fromMember    string
+	hasFromMember bool
+	hasFromLonLat bool
+	hasShape      bool
+	shape         geoShape
+	sort          int
+	count         int64 // 0 表示不限制
+	any           bool
+	withDist      bool
+	withHash      bool
+	withCoord     bool
+	store         bool
+	storeKey      string
+	storeDist     bool
+	storeEvent    string // 写入目标键时发出的键空间通知事件
+}
+
+// parseLongLat 解析经纬度参数
+func parseLongLat(longArg, latArg string) (float64, float64, *RESPValue) {
+	longitude, ok1 := parseFloat(longArg)
+	latitude, ok2 := parseFloat(latArg)
+	if !ok1 || !ok2 {
+		return 0, 0, NewErrorValue("ERR value is not a valid float")
+	}
+	if !geoValidLongLat(longitude, latitude) {
+		return 0, 0, NewErrorValue(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", longitude, latitude))
+	}
+	return longitude, latitude, nil
+}
+
+// parseGeoUnit 解析距离单位，返回换算为米的系数
+func parseGeoUnit(arg string) (float64, *RESPValue) {
+	switch strings.ToLower(arg) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, NewErrorValue("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+// parseGeoRadius 解析半径和单位
+func parseGeoRadius(shape *geoShape, radiusArg, unitArg string) *RESPValue {
+	radius, ok := parseFloat(radiusArg)
+	if !ok {
+		return NewErrorValue("ERR need numeric radius")
+	}
+	if radius < 0 {
+		return NewErrorValue("ERR radius cannot be negative")
+	}
+	conversion, errResp := parseGeoUnit(unitArg)
+	if errResp != nil {
+		return errResp
+	}
+	shape.kind = GEO_SHAPE_RADIUS
+	shape.radius = radius
+	shape.conversion = conversion
+	return nil
+}
+
+// parseGeoBox 解析矩形的宽、高和单位
+func parseGeoBox(shape *geoShape, widthArg, heightArg, unitArg string) *RESPValue {
+	width, ok := parseFloat(widthArg)
+	if !ok {
+		return NewErrorValue("ERR need numeric width")
+	}
+	height, ok := parseFloat(heightArg)
+	if !ok {
+		return NewErrorValue("ERR need numeric height")
+	}
+	if width < 0 || height < 0 {
+		return NewErrorValue("ERR height or width cannot be negative")
+	}
+	conversion, errResp := parseGeoUnit(unitArg)
+	if errResp != nil {
+		return errResp
+	}
+	shape.kind = GEO_SHAPE_BOX
+	shape.width = width
+	shape.height = height
+	shape.conversion = conversion
+	return nil
+}
+
+// parseGeoSearchOptions 解析 GEOSEARCH 系列命令的选项，GEORADIUS 系列的中心和半径由调用方预先填入 spec
+func parseGeoSearchOptions(args []string, spec *geoSearchSpec, cmd int, name string) *RESPValue {
+	search := cmd == GEO_CMD_SEARCH || cmd == GEO_CMD_SEARCHSTORE
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch arg := strings.ToUpper(args[i]); {
+		case arg == "WITHDIST":
+			spec.withDist = true
+		case arg == "WITHHASH":
+			spec.withHash = true
+		case arg == "WITHCOORD":
+			spec.withCoord = true
+		case arg == "ANY":
+			spec.any = true
+		case arg == "ASC":
+			spec.sort = GEO_SORT_ASC
+		case arg == "DESC":
+			spec.sort = GEO_SORT_DESC
+		case arg == "COUNT" && remaining >= 1:
+			count, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return NewErrorValue("ERR value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return NewErrorValue("ERR COUNT must be > 0")
+			}
+			spec.count = count
+			i++
+		case (arg == "STORE" || arg == "STOREDIST") && remaining >= 1 && cmd == GEO_CMD_RADIUS:
+			spec.store = true
+			spec.storeKey = args[i+1]
+			spec.storeDist = arg == "STOREDIST"
+			spec.storeEvent = "georadiusstore"
+			i++
+		case arg == "STOREDIST" && cmd == GEO_CMD_SEARCHSTORE:
+			spec.storeDist = true
+		case arg == "FROMMEMBER" && search && remaining >= 1 && !spec.hasFromMember && !spec.hasFromLonLat:
+			spec.fromMember = args[i+1]
+			spec.hasFromMember = true
+			i++
+		case arg == "FROMLONLAT" && search && remaining >= 2 && !spec.hasFromMember && !spec.hasFromLonLat:
+			longitude, latitude, errResp := parseLongLat(args[i+1], args[i+2])
+			if errResp != nil {
+				return errResp
+			}
+			spec.shape.longitude, spec.shape.latitude = longitude, latitude
+			spec.hasFromLonLat = true
+			i += 2
+		case arg == "BYRADIUS" && search && remaining >= 2 && !spec.hasShape:
+			if errResp := parseGeoRadius(&spec.shape, args[i+1], args[i+2]); errResp != nil {
+				return errResp
+			}
+			spec.hasShape = true
+			i += 2
+		case arg == "BYBOX" && search && remaining >= 3 && !spec.hasShape:
+			if errResp := parseGeoBox(&spec.shape, args[i+1], args[i+2], args[i+3]); errResp != nil {
+				return errResp
+			}
+			spec.hasShape = true
+			i += 3
+		default:
+			return NewErrorValue("ERR syntax error")
+		}
+	}
+
+	if spec.store && (spec.withDist || spec.withHash || spec.withCoord) {
+		option := "STORE option in GEORADIUS"
+		if cmd == GEO_CMD_SEARCHSTORE {
+			option = "GEOSEARCHSTORE"
+		}
+		return NewErrorValue(fmt.Sprintf("ERR %s is not compatible with WITHDIST, WITHHASH and WITHCOORD options", option))
+	}
+	if search && !spec.hasFromMember && !spec.hasFromLonLat {
+		return NewErrorValue(fmt.Sprintf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", name))
+	}
+	if search && !spec.hasShape {
+		return NewErrorValue(fmt.Sprintf("ERR exactly one of BYRADIUS and BYBOX can be specified for %s", name))
+	}
+	if spec.any && spec.count == 0 {
+		return NewErrorValue("ERR the ANY argument requires COUNT argument")
+	}
+	return nil
+}
+
+// geoMembersOfShape 返回有序集合中位于搜索区域内的成员，limit 大于 0 时找到足够数量即停止
+func geoMembersOfShape(zset *ZSet, shape *geoShape, limit int64) []geoPoint {
+	radius := geohashCalculateAreasByShapeWGS84(shape)
+	boxes := append([]geoHashBits{radius.hash}, radius.neighbors[:]...)
+
+	var points []geoPoint
+	for i, box := range boxes {
+		// 被排除的相邻格子为零值
+		if box.bits == 0 && box.step == 0 {
+			continue
+		}
+		// 半径很大时相邻格子可能相同，跳过已经搜索过的格子以免结果重复
+		duplicate := false
+		for _, prev := range boxes[:i] {
+			if prev == box {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+
+		minScore, maxScore := geohashScoreRange(box)
+		lo, hi := zset.ScoreRangeRanks(&zscoreRange{min: minScore, max: maxScore, maxex: true})
+		if lo > hi {
+			continue
+		}
+		for _, entry := range zset.RangeByRank(lo, hi, false) {
+			longitude, latitude := geoDecodeScore(entry.score)
+			dist, ok := geoWithinShape(shape, longitude, latitude)
+			if !ok {
+				continue
+			}
+			points = append(points, geoPoint{entry.member, longitude, latitude, dist, entry.score})
+			if limit > 0 && int64(len(points)) >= limit {
+				return points
+			}
+		}
+	}
+	return points
+}
+
+// geoDeleteStoreKey 在搜索结果为空时删除目标键（调用方需持有写锁）
+func (rs *RedisServer) geoDeleteStoreKey(c *client, spec *geoSearchSpec) {
+	if c.db.lookupKey(spec.storeKey) != nil {
+		c.db.store.Delete(spec.storeKey)
+		rs.signalModifiedKey(c.db, spec.storeKey)
+		rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", spec.storeKey, c.db.id)
+	}
+}
+
+// geoSearch 在有序集合 key 中执行搜索，返回结果或写入 spec.storeKey（调用方需持有锁，写入时需持有写锁）
+func (rs *RedisServer) geoSearch(c *client, key string, spec *geoSearchSpec) *RESPValue {
+	zset, errResp := c.db.lookupZSet(key)
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		if spec.store {
+			rs.geoDeleteStoreKey(c, spec)
+			return NewIntegerValue(0)
+		}
+		return NewArrayValue([]*RESPValue{})
+	}
+
+	shape := spec.shape
+	if spec.hasFromMember {
+		score, ok := zset.Score(spec.fromMember)
+		if !ok {
+			return NewErrorValue("ERR could not decode requested zset member")
+		}
+		shape.longitude, shape.latitude = geoDecodeScore(score)
+	}
+
+	// 指定 COUNT 时需要返回最近的若干个，因此默认按距离升序；ANY 则返回最先找到的若干个
+	sortOrder := spec.sort
+	if spec.count != 0 && sortOrder == GEO_SORT_NONE && !spec.any {
+		sortOrder = GEO_SORT_ASC
+	}
+
+	limit := int64(0)
+	if spec.any {
+		limit = spec.count
+	}
+	points := geoMembersOfShape(zset, &shape, limit)
+	switch sortOrder {
+	case GEO_SORT_ASC:
+		sort.SliceStable(points, func(i, j int) bool { return points[i].dist < points[j].dist })
+	case GEO_SORT_DESC:
+		sort.SliceStable(points, func(i, j int) bool { return points[i].dist > points[j].dist })
+	}
+	if spec.count > 0 && int64(len(points)) > spec.count {
+		points = points[:spec.count]
+	}
+
+	if spec.store {
+		if len(points) == 0 {
+			rs.geoDeleteStoreKey(c, spec)
+			return NewIntegerValue(0)
+		}
+		result := NewZSet()
+		for _, p := range points {
+			score := p.score
+			if spec.storeDist {
+				score = p.dist / shape.conversion
+			}
+			result.Add(p.member, score)
+		}
+		c.db.store.Set(spec.storeKey, &RedisObject{Type: OBJ_ZSET, Value: result})
+		rs.signalModifiedKey(c.db, spec.storeKey)
+		rs.notifyKeyspaceEvent(NOTIFY_ZSET, spec.storeEvent, spec.storeKey, c.db.id)
+		rs.signalKeyAsReady(c.db, spec.storeKey)
+		return NewIntegerValue(int64(len(points)))
+	}
+
+	replies := make([]*RESPValue, len(points))
+	for i, p := range points {
+		if !spec.withDist && !spec.withHash && !spec.withCoord {
+			replies[i] = NewBulkStringValue(p.member)
+			continue
+		}
+		item := []*RESPValue{NewBulkStringValue(p.member)}
+		if spec.withDist {
+			item = append(item, NewBulkStringValue(strconv.FormatFloat(p.dist/shape.conversion, 'f', 4, 64)))
+		}
+		if spec.withHash {
+			item = append(item, NewIntegerValue(int64(p.score)))
+		}
+		if spec.withCoord {
+			item = append(item, geoCoordReply(p.longitude, p.latitude))
+		}
+		replies[i] = NewArrayValue(item)
+	}
+	return NewArrayValue(replies)
+}
+
+// handleGeoDist 处理 GEODIST 命令，任一成员不存在时返回 null
+func (rs *RedisServer) handleGeoDist(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 {
+		return wrongArgsError("geodist")
+	}
+	if len(args) > 4 {
+		return NewErrorValue("ERR syntax error")
+	}
+
+	conversion := 1.0
+	if len(args) == 4 {
+		if conversion, errResp = parseGeoUnit(args[3]); errResp != nil {
+			return errResp
+		}
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return NewNullBulkStringValue()
+	}
+	score1, ok1 := zset.Score(args[1])
+	score2, ok2 := zset.Score(args[2])
+	if !ok1 || !ok2 {
+		return NewNullBulkStringValue()
+	}
+
+	lon1, lat1 := geoDecodeScore(score1)
+	lon2, lat2 := geoDecodeScore(score2)
+	dist := geohashGetDistance(lon1, lat1, lon2, lat2) / conversion
+	return NewBulkStringValue(strconv.FormatFloat(dist, 'f', 4, 64))
+}
+
+// handleGeoHash 处理 GEOHASH 命令，返回成员位置的标准 geohash 字符串
+func (rs *RedisServer) handleGeoHash(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("geohash")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+
+	replies := make([]*RESPValue, 0, len(args)-1)
+	for _, member := range args[1:] {
+		var score float64
+		var ok bool
+		if zset != nil {
+			score, ok = zset.Score(member)
+		}
+		if !ok {
+			replies = append(replies, NewNullBulkStringValue())
+			continue
+		}
+		replies = append(replies, NewBulkStringValue(geohashString(geoDecodeScore(score))))
+	}
+	return NewArrayValue(replies)
+}
+
+// handleGeoSearch 处理 GEOSEARCH 命令
+func (rs *RedisServer) handleGeoSearch(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("geosearch")
+	}
+
+	spec := &geoSearchSpec{}
+	if errResp := parseGeoSearchOptions(args[1:], spec, GEO_CMD_SEARCH, "geosearch"); errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	return rs.geoSearch(c, args[0], spec)
+}
+
+// handleGeoSearchStore 处理 GEOSEARCHSTORE 命令，结果为空时删除目标键
+func (rs *RedisServer) handleGeoSearchStore(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("geosearchstore")
+	}
+
+	spec := &geoSearchSpec{store: true, storeKey: args[0], storeEvent: "geosearchstore"}
+	if errResp := parseGeoSearchOptions(args[2:], spec, GEO_CMD_SEARCHSTORE, "geosearchstore"); errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	return rs.geoSearch(c, args[1], spec)
+}
+
+// handleGeoRadius 处理已废弃的 GEORADIUS 和 GEORADIUS_RO 命令，转换为等价的 FROMLONLAT + BYRADIUS 搜索
+func (rs *RedisServer) handleGeoRadius(c *client, command *RESPValue, name string, readOnly bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 5 {
+		return wrongArgsError(name)
+	}
+
+	spec := &geoSearchSpec{hasFromLonLat: true, hasShape: true}
+	longitude, latitude, errResp := parseLongLat(args[1], args[2])
+	if errResp != nil {
+		return errResp
+	}
+	spec.shape.longitude, spec.shape.latitude = longitude, latitude
+	if errResp := parseGeoRadius(&spec.shape, args[3], args[4]); errResp != nil {
+		return errResp
+	}
+	return rs.geoRadiusGeneric(c, args[0], args[5:], spec, name, readOnly)
+}
+
+// handleGeoRadiusByMember 处理已废弃的 GEORADIUSBYMEMBER 和 GEORADIUSBYMEMBER_RO 命令，
+// 转换为等价的 FROMMEMBER + BYRADIUS 搜索
+func (rs *RedisServer) handleGeoRadiusByMember(c *client, command *RESPValue, name string, readOnly bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 4 {
+		return wrongArgsError(name)
+	}
+
+	spec := &geoSearchSpec{fromMember: args[1], hasFromMember: true, hasShape: true}
+	if errResp := parseGeoRadius(&spec.shape, args[2], args[3]); errResp != nil {
+		return errResp
+	}
+	return rs.geoRadiusGeneric(c, args[0], args[4:], spec, name, readOnly)
+}
+
+// geoRadiusGeneric 解析 GEORADIUS 系列命令的选项并执行搜索
+func (rs *RedisServer) geoRadiusGeneric(c *client, key string, options []string, spec *geoSearchSpec, name string, readOnly bool) *RESPValue {
+	cmd := GEO_CMD_RADIUS
+	if readOnly {
+		cmd = GEO_CMD_RADIUS_RO
+	}
+	if errResp := parseGeoSearchOptions(options, spec, cmd, name); errResp != nil {
+		return errResp
+	}
+
+	if spec.store {
+		rs.mutex.Lock()
+		defer rs.mutex.Unlock()
+	} else {
+		rs.mutex.RLock()
+		defer rs.mutex.RUnlock()
+	}
+	return rs.geoSearch(c, key, spec)
+}
+
+// geoCoordReply 返回 [经度, 纬度] 数组
+func geoCoordReply(longitude, latitude float64) *RESPValue {
+	return NewArrayValue([]*RESPValue{
+		NewBulkStringValue(formatHumanFloat(longitude)),
+		NewBulkStringValue(formatHumanFloat(latitude)),
+	})
+}
+
+// handleGeoAdd 处理 GEOADD 命令，坐标编码为 52 位 geohash 后作为分数存入有序集合
+func (rs *RedisServer) handleGeoAdd(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 4 {
+		return wrongArgsError("geoadd")
+	}
+
+	key := args[0]
+	flags := 0
+	i := 1
+parseFlags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			flags |= ZADD_NX
+		case "XX":
+			flags |= ZADD_XX
+		case "CH":
+			flags |= ZADD_CH
+		default:
+			break parseFlags
+		}
+	}
+
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 || (flags&ZADD_NX != 0 && flags&ZADD_XX != 0) {
+		return NewErrorValue("ERR syntax error")
+	}
+
+	// 先校验所有坐标，保证出错时不修改任何数据
+	scores := make([]float64, len(triples)/3)
+	for j := range scores {
+		longitude, latitude, errResp := parseLongLat(triples[j*3], triples[j*3+1])
+		if errResp != nil {
+			return errResp
+		}
+		scores[j] = geoEncodeScore(longitude, latitude)
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	zset, errResp := c.db.lookupZSetWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		if flags&ZADD_XX != 0 {
+			return NewIntegerValue(0)
+		}
+		obj := NewZSetObject()
+		c.db.store.Set(key, obj)
+		zset = obj.Value.(*ZSet)
+	}
+
+	added, changed := 0, 0
+	for j, score := range scores {
+		a, u, _, _, _ := zsetAdd(zset, triples[j*3+2], score, flags)
+		if a {
+			added++
+		}
+		if u {
+			changed++
+		}
+	}
+	// GEOADD 以 ZADD 的方式写入，通知事件也与 ZADD 相同
+	if added > 0 || changed > 0 {
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_ZSET, "zadd", key, c.db.id)
+	}
+	if zset.Len() == 0 {
+		c.db.store.Delete(key)
+	}
+	if added > 0 {
+		rs.signalKeyAsReady(c.db, key)
+	}
+
+	if flags&ZADD_CH != 0 {
+		return NewIntegerValue(int64(added + changed))
+	}
+	return NewIntegerValue(int64(added))
+}
+
+// handleGeoPos 处理 GEOPOS 命令，不存在的成员返回 null
+func (rs *RedisServer) handleGeoPos(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("geopos")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+
+	replies := make([]*RESPValue, 0, len(args)-1)
+	for _, member := range args[1:] {
+		var score float64
+		var ok bool
+		if zset != nil {
+			score, ok = zset.Score(member)
+		}
+		if !ok {
+			replies = append(replies, NewNullArrayValue())
+			continue
+		}
+		replies = append(replies, geoCoordReply(geoDecodeScore(score)))
+	}
+	return NewArrayValue(replies)
+}
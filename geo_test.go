@@ -0,0 +1,138 @@
+package goredis
+
+import (
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestGeoAddAndGeoPos(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("2", "GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")
+	// 分数是 52 位交错编码的 geohash，与 Redis 完全相同
+	c.mustDo("3479099956230698", "ZSCORE", "Sicily", "Palermo")
+	c.mustDo("3479447370796909", "ZSCORE", "Sicily", "Catania")
+	c.mustDo("[[13.36138933897018433 38.11555639549629859] [15.08726745843887329 37.50266842333162032] (nil)]",
+		"GEOPOS", "Sicily", "Palermo", "Catania", "missing")
+	c.mustDo("[(nil)]", "GEOPOS", "missing", "Palermo")
+
+	c.mustDo("0", "GEOADD", "Sicily", "NX", "0", "0", "Palermo")
+	c.mustDo("0", "GEOADD", "Sicily", "XX", "0", "0", "Agrigento")
+	c.mustDo("1", "GEOADD", "Sicily", "XX", "CH", "13.583333", "37.316667", "Palermo")
+	c.mustDo("(error) ERR invalid longitude,latitude pair 0.000000,86.000000", "GEOADD", "Sicily", "0", "86", "x")
+	c.mustDo("(error) ERR value is not a valid float", "GEOADD", "Sicily", "x", "0", "y")
+	c.mustDo("(error) ERR syntax error", "GEOADD", "Sicily", "NX", "XX", "0", "0", "y")
+}
+
+func TestInterleaveRoundTrip(t *testing.T) {
+	for _, v := range [][2]uint32{{0, 0}, {1, 0}, {0, 1}, {0xffffffff, 0}, {0x12345678, 0x9abcdef0}, {0xffffffff, 0xffffffff}} {
+		x, y := deinterleave64(interleave64(v[0], v[1]))
+		if x != v[0] || y != v[1] {
+			t.Errorf("deinterleave64(interleave64(%#x, %#x)) = %#x, %#x", v[0], v[1], x, y)
+		}
+	}
+	// x 占偶数位，y 占奇数位
+	if got := interleave64(1, 0); got != 1 {
+		t.Errorf("interleave64(1, 0) = %#x", got)
+	}
+	if got := interleave64(0, 1); got != 2 {
+		t.Errorf("interleave64(0, 1) = %#x", got)
+	}
+}
+
+func TestGeoSearch(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("4", "GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania",
+		"12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2")
+	c.mustDo("[Catania Palermo]", "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC")
+	c.mustDo("[[Catania 56.4413] [Palermo 190.4424] [edge2 279.7403] [edge1 279.7405]]",
+		"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "ASC", "WITHDIST")
+	c.mustDo("[edge1 edge2]", "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "DESC", "COUNT", "2")
+	c.mustDo("[Palermo edge1 Catania]", "GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "200", "km", "ASC")
+	c.mustDo("[]", "GEOSEARCH", "missing", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km")
+
+	// GEOSEARCHSTORE 默认保存 geohash 分数，STOREDIST 时保存距离
+	c.mustDo("2", "GEOSEARCHSTORE", "dst", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km")
+	c.mustDo("3479099956230698", "ZSCORE", "dst", "Palermo")
+	c.mustDo("2", "GEOSEARCHSTORE", "dst", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "STOREDIST")
+	c.mustDo("[Catania 56.4412578701582 Palermo 190.4424298477578]", "ZRANGE", "dst", "0", "-1", "WITHSCORES")
+
+	c.mustDo("(error) ERR could not decode requested zset member", "GEOSEARCH", "Sicily", "FROMMEMBER", "nobody", "BYRADIUS", "1", "km")
+	c.mustDo("(error) ERR exactly one of BYRADIUS and BYBOX can be specified for geosearch", "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "ASC", "WITHDIST")
+	c.mustDo("(error) ERR the ANY argument requires COUNT argument", "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "ANY")
+	c.mustDo("(error) ERR unsupported unit provided. please use M, KM, FT, MI", "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "yd")
+}
+
+func TestGeoSearchMatchesBruteForce(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	r := rand.New(rand.NewSource(1))
+
+	type point struct{ lon, lat float64 }
+	points := make(map[string]point)
+	args := []string{"GEOADD", "pts"}
+	for i := 0; i < 500; i++ {
+		lon, lat := 10+r.Float64()*10, 35+r.Float64()*10
+		name := "p" + strconv.Itoa(i)
+		// 比较时使用编码后还原出的坐标，与服务器看到的一致
+		lon, lat = geoDecodeScore(geoEncodeScore(lon, lat))
+		points[name] = point{lon, lat}
+		args = append(args, strconv.FormatFloat(lon, 'f', -1, 64), strconv.FormatFloat(lat, 'f', -1, 64), name)
+	}
+	c.do(args...)
+
+	for i := 0; i < 50; i++ {
+		lon, lat := 10+r.Float64()*10, 35+r.Float64()*10
+		radius := 10000 + r.Float64()*300000
+		var want []string
+		for name, p := range points {
+			if geohashGetDistance(lon, lat, p.lon, p.lat) <= radius {
+				want = append(want, name)
+			}
+		}
+		slices.Sort(want)
+
+		v := c.do("GEOSEARCH", "pts", "FROMLONLAT", strconv.FormatFloat(lon, 'f', -1, 64), strconv.FormatFloat(lat, 'f', -1, 64),
+			"BYRADIUS", strconv.FormatFloat(radius, 'f', -1, 64), "m")
+		got := make([]string, len(v.Array))
+		for j, e := range v.Array {
+			got[j] = e.Str
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Fatalf("search around %f,%f radius %f: got %d members, want %d", lon, lat, radius, len(got), len(want))
+		}
+	}
+}
+
+func TestGeoDistAndGeoHash(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("2", "GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")
+	c.mustDo("166274.1516", "GEODIST", "Sicily", "Palermo", "Catania")
+	c.mustDo("166.2742", "GEODIST", "Sicily", "Palermo", "Catania", "km")
+	c.mustDo("103.3182", "GEODIST", "Sicily", "Palermo", "Catania", "mi")
+	c.mustDo("(nil)", "GEODIST", "Sicily", "Palermo", "missing")
+	c.mustDo("(error) ERR unsupported unit provided. please use M, KM, FT, MI", "GEODIST", "Sicily", "Palermo", "Catania", "yd")
+	c.mustDo("[sqc8b49rny0 sqdtr74hyu0 (nil)]", "GEOHASH", "Sicily", "Palermo", "Catania", "missing")
+}
+
+func TestGeoRadius(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("2", "GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")
+	c.mustDo("[[Palermo 190.4424] [Catania 56.4413]]", "GEORADIUS", "Sicily", "15", "37", "200", "km", "WITHDIST")
+	c.mustDo("[Catania]", "GEORADIUS", "Sicily", "15", "37", "200", "km", "ASC", "COUNT", "1")
+	c.mustDo("[Palermo Catania]", "GEORADIUSBYMEMBER", "Sicily", "Palermo", "200", "km", "ASC")
+	c.mustDo("[Catania]", "GEORADIUS_RO", "Sicily", "15", "37", "100", "km")
+
+	c.mustDo("2", "GEORADIUS", "Sicily", "15", "37", "200", "km", "STORE", "dst")
+	c.mustDo("[Palermo Catania]", "ZRANGE", "dst", "0", "-1")
+	c.mustDo("1", "GEORADIUSBYMEMBER", "Sicily", "Catania", "10", "km", "STOREDIST", "dst")
+	c.mustDo("[Catania 0]", "ZRANGE", "dst", "0", "-1", "WITHSCORES")
+	c.mustDo("(error) ERR STORE option in GEORADIUS is not compatible with WITHDIST, WITHHASH and WITHCOORD options", "GEORADIUS", "Sicily", "15", "37", "200", "km", "WITHDIST", "STORE", "dst")
+	c.mustDo("(error) ERR syntax error", "GEORADIUS_RO", "Sicily", "15", "37", "200", "km", "STORE", "dst")
+}
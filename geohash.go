@@ -0,0 +1,395 @@
+package goredis
+
+import (
+	"math"
+)
+
+// 经纬度范围与编码精度，与 Redis 相同
+//
+// 纬度限制在 Web 墨卡托投影的有效范围内，每个坐标用 26 位表示，交织后得到 52 位的 geohash，
+// 恰好能被 float64 精确表示，因此可以直接作为有序集合的分数。
+const (
+	geoLatMin  = -85.05112878
+	geoLatMax  = 85.05112878
+	geoLongMin = -180.0
+	geoLongMax = 180.0
+	geoStepMax = 26
+)
+
+// geoHashBits 表示精度为 step 的 geohash，bits 的偶数位为纬度，奇数位为经度
+type geoHashBits struct {
+	bits uint64
+	step uint
+}
+
+// geoHashRange 表示一个坐标分量的区间
+type geoHashRange struct {
+	min, max float64
+}
+
+// geoHashArea 表示 geohash 对应的经纬度矩形
+type geoHashArea struct {
+	hash      geoHashBits
+	longitude geoHashRange
+	latitude  geoHashRange
+}
+
+// interleave64 交织两个 32 位整数：x 的位放在偶数位，y 的位放在奇数位
+func interleave64(x, y uint32) uint64 {
+	spread := func(v uint64) uint64 {
+		v = (v | v<<16) & 0x0000FFFF0000FFFF
+		v = (v | v<<8) & 0x00FF00FF00FF00FF
+		v = (v | v<<4) & 0x0F0F0F0F0F0F0F0F
+		v = (v | v<<2) & 0x3333333333333333
+		v = (v | v<<1) & 0x5555555555555555
+		return v
+	}
+	return spread(uint64(x)) | spread(uint64(y))<<1
+}
+
+// deinterleave64 是 interleave64 的逆运算，返回偶数位和奇数位
+func deinterleave64(v uint64) (uint32, uint32) {
+	squash := func(v uint64) uint32 {
+		v &= 0x5555555555555555
+		v = (v | v>>1) & 0x3333333333333333
+		v = (v | v>>2) & 0x0F0F0F0F0F0F0F0F
+		v = (v | v>>4) & 0x00FF00FF00FF00FF
+		v = (v | v>>8) & 0x0000FFFF0000FFFF
+		v = (v | v>>16) & 0x00000000FFFFFFFF
+		return uint32(v)
+	}
+	return squash(v), squash(v >> 1)
+}
+
+// geohashEncode 在给定的经纬度范围内以 step 位精度编码坐标
+func geohashEncode(longRange, latRange geoHashRange, longitude, latitude float64, step uint) geoHashBits {
+	latOffset := (latitude - latRange.min) / (latRange.max - latRange.min)
+	longOffset := (longitude - longRange.min) / (longRange.max - longRange.min)
+	latOffset *= float64(uint64(1) << step)
+	longOffset *= float64(uint64(1) << step)
+	return geoHashBits{bits: interleave64(uint32(latOffset), uint32(longOffset)), step: step}
+}
+
+// geohashDecode 返回 geohash 覆盖的经纬度矩形
+func geohashDecode(longRange, latRange geoHashRange, hash geoHashBits) geoHashArea {
+	ilato, ilono := deinterleave64(hash.bits)
+	latScale := latRange.max - latRange.min
+	longScale := longRange.max - longRange.min
+	cells := float64(uint64(1) << hash.step)
+	return geoHashArea{
+		hash: hash,
+		latitude: geoHashRange{
+			min: latRange.min + float64(ilato)/cells*latScale,
+			max: latRange.min + float64(ilato+1)/cells*latScale,
+		},
+		longitude: geoHashRange{
+			min: longRange.min + float64(ilono)/cells*longScale,
+			max: longRange.min + float64(ilono+1)/cells*longScale,
+		},
+	}
+}
+
+// geoWGS84Ranges 返回 Redis 使用的经纬度范围
+func geoWGS84Ranges() (geoHashRange, geoHashRange) {
+	return geoHashRange{geoLongMin, geoLongMax}, geoHashRange{geoLatMin, geoLatMax}
+}
+
+// geohashEncodeWGS84 以 step 位精度编码坐标
+func geohashEncodeWGS84(longitude, latitude float64, step uint) geoHashBits {
+	longRange, latRange := geoWGS84Ranges()
+	return geohashEncode(longRange, latRange, longitude, latitude, step)
+}
+
+// geohashDecodeWGS84 返回 geohash 覆盖的经纬度矩形
+func geohashDecodeWGS84(hash geoHashBits) geoHashArea {
+	longRange, latRange := geoWGS84Ranges()
+	return geohashDecode(longRange, latRange, hash)
+}
+
+// geohashDecodeAreaToLongLat 返回矩形的中心点，并限制在合法范围内
+func geohashDecodeAreaToLongLat(area geoHashArea) (float64, float64) {
+	longitude := (area.longitude.min + area.longitude.max) / 2
+	latitude := (area.latitude.min + area.latitude.max) / 2
+	longitude = min(max(longitude, geoLongMin), geoLongMax)
+	latitude = min(max(latitude, geoLatMin), geoLatMax)
+	return longitude, latitude
+}
+
+// geoEncodeScore 把坐标编码为有序集合的分数
+func geoEncodeScore(longitude, latitude float64) float64 {
+	return float64(geohashEncodeWGS84(longitude, latitude, geoStepMax).bits)
+}
+
+// geoDecodeScore 把有序集合的分数解码为坐标
+func geoDecodeScore(score float64) (float64, float64) {
+	hash := geoHashBits{bits: uint64(score), step: geoStepMax}
+	return geohashDecodeAreaToLongLat(geohashDecodeWGS84(hash))
+}
+
+// geohashAlphabet 是标准 geohash 使用的 base32 字母表
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohashString 返回坐标的标准 11 字符 geohash
+//
+// 标准 geohash 的纬度范围是 ±90，与内部编码不同，需要重新编码。52 位只够 10 个字符，
+// 为了与常见实现保持 11 个字符的长度，最后一个字符固定为 0。
+func geohashString(longitude, latitude float64) string {
+	hash := geohashEncode(geoHashRange{-180, 180}, geoHashRange{-90, 90}, longitude, latitude, geoStepMax)
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0
+		if i < 10 {
+			idx = int(hash.bits>>(52-uint(i+1)*5)) & 0x1f
+		}
+		buf[i] = geohashAlphabet[idx]
+	}
+	return string(buf)
+}
+
+// geoValidLongLat 检查坐标是否在可以编码的范围内
+func geoValidLongLat(longitude, latitude float64) bool {
+	return !math.IsNaN(longitude) && !math.IsNaN(latitude) &&
+		longitude >= geoLongMin && longitude <= geoLongMax &&
+		latitude >= geoLatMin && latitude <= geoLatMax
+}
+
+// 距离计算相关常量
+const (
+	geoEarthRadiusInMeters = 6372797.560856
+	geoMercatorMax         = 20037726.37
+)
+
+// 搜索形状类型
+const (
+	GEO_SHAPE_RADIUS = iota
+	GEO_SHAPE_BOX
+)
+
+// geoShape 表示搜索区域：以 (longitude, latitude) 为中心的圆形或矩形，
+// 半径、宽和高以 conversion 对应的单位表示，乘以 conversion 后为米
+type geoShape struct {
+	kind          int
+	longitude     float64
+	latitude      float64
+	conversion    float64
+	radius        float64
+	width, height float64
+}
+
+// geoHashRadius 是覆盖搜索区域的 geohash 格子：中心格子及其 8 个相邻格子，
+// 不需要搜索的相邻格子被置为零值
+type geoHashRadius struct {
+	hash      geoHashBits
+	area      geoHashArea
+	neighbors [8]geoHashBits
+}
+
+// 相邻格子在 geoHashRadius.neighbors 中的下标
+const (
+	geoNorth = iota
+	geoSouth
+	geoEast
+	geoWest
+	geoNorthEast
+	geoNorthWest
+	geoSouthEast
+	geoSouthWest
+)
+
+func degRad(ang float64) float64 {
+	return ang * (math.Pi / 180.0)
+}
+
+func radDeg(ang float64) float64 {
+	return ang / (math.Pi / 180.0)
+}
+
+// geohashGetLatDistance 返回两个纬度之间的距离（米）
+func geohashGetLatDistance(lat1d, lat2d float64) float64 {
+	return geoEarthRadiusInMeters * math.Abs(degRad(lat2d)-degRad(lat1d))
+}
+
+// geohashGetDistance 使用 haversine 公式计算两点之间的距离（米）
+func geohashGetDistance(lon1d, lat1d, lon2d, lat2d float64) float64 {
+	lat1r, lon1r := degRad(lat1d), degRad(lon1d)
+	lat2r, lon2r := degRad(lat2d), degRad(lon2d)
+	v := math.Sin((lon2r - lon1r) / 2)
+	// 经度相同时退化为纬度距离，避免不必要的计算
+	if v == 0 {
+		return geohashGetLatDistance(lat1d, lat2d)
+	}
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2.0 * geoEarthRadiusInMeters * math.Asin(math.Sqrt(a))
+}
+
+// geoWithinShape 判断点是否在搜索区域内，在区域内时同时返回到中心的距离（米）
+func geoWithinShape(shape *geoShape, longitude, latitude float64) (float64, bool) {
+	if shape.kind == GEO_SHAPE_RADIUS {
+		distance := geohashGetDistance(shape.longitude, shape.latitude, longitude, latitude)
+		return distance, distance <= shape.radius*shape.conversion
+	}
+
+	// 纬度方向的距离计算代价更小，先检查
+	width, height := shape.width*shape.conversion, shape.height*shape.conversion
+	if geohashGetLatDistance(latitude, shape.latitude) > height/2 {
+		return 0, false
+	}
+	if geohashGetDistance(longitude, latitude, shape.longitude, latitude) > width/2 {
+		return 0, false
+	}
+	return geohashGetDistance(shape.longitude, shape.latitude, longitude, latitude), true
+}
+
+// geohashBoundingBox 返回包围搜索区域的经纬度矩形：最小经度、最小纬度、最大经度、最大纬度
+func geohashBoundingBox(shape *geoShape) [4]float64 {
+	width, height := shape.radius*shape.conversion, shape.radius*shape.conversion
+	if shape.kind == GEO_SHAPE_BOX {
+		width = shape.width / 2 * shape.conversion
+		height = shape.height / 2 * shape.conversion
+	}
+
+	latDelta := radDeg(height / geoEarthRadiusInMeters)
+	longDeltaTop := radDeg(width / geoEarthRadiusInMeters / math.Cos(degRad(shape.latitude+latDelta)))
+	longDeltaBottom := radDeg(width / geoEarthRadiusInMeters / math.Cos(degRad(shape.latitude-latDelta)))
+	// 经度跨度在离赤道更远的一侧更大
+	longDelta := longDeltaTop
+	if shape.latitude < 0 {
+		longDelta = longDeltaBottom
+	}
+	return [4]float64{
+		shape.longitude - longDelta,
+		shape.latitude - latDelta,
+		shape.longitude + longDelta,
+		shape.latitude + latDelta,
+	}
+}
+
+// geohashEstimateStepsByRadius 估算能用 3x3 个格子覆盖给定半径的 geohash 精度
+func geohashEstimateStepsByRadius(rangeMeters, latitude float64) uint {
+	if rangeMeters == 0 {
+		return geoStepMax
+	}
+	step := 1
+	for rangeMeters < geoMercatorMax {
+		rangeMeters *= 2
+		step++
+	}
+	// 保证大多数情况下范围能被覆盖
+	step -= 2
+
+	// 高纬度地区格子在经度方向上更窄，需要更低的精度
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+	return uint(min(max(step, 1), geoStepMax))
+}
+
+// geohashMoveX 在经度方向上移动 d 个格子（d 为 1 或 -1）
+func geohashMoveX(hash geoHashBits, d int) geoHashBits {
+	x := hash.bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.bits & 0x5555555555555555
+	zz := uint64(0x5555555555555555) >> (64 - hash.step*2)
+	if d > 0 {
+		x += zz + 1
+	} else {
+		x |= zz
+		x -= zz + 1
+	}
+	x &= 0xaaaaaaaaaaaaaaaa >> (64 - hash.step*2)
+	return geoHashBits{bits: x | y, step: hash.step}
+}
+
+// geohashMoveY 在纬度方向上移动 d 个格子（d 为 1 或 -1）
+func geohashMoveY(hash geoHashBits, d int) geoHashBits {
+	x := hash.bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.bits & 0x5555555555555555
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.step*2)
+	if d > 0 {
+		y += zz + 1
+	} else {
+		y |= zz
+		y -= zz + 1
+	}
+	y &= 0x5555555555555555 >> (64 - hash.step*2)
+	return geoHashBits{bits: x | y, step: hash.step}
+}
+
+// geohashNeighbors 返回 geohash 的 8 个相邻格子
+func geohashNeighbors(hash geoHashBits) [8]geoHashBits {
+	var n [8]geoHashBits
+	n[geoEast] = geohashMoveX(hash, 1)
+	n[geoWest] = geohashMoveX(hash, -1)
+	n[geoSouth] = geohashMoveY(hash, -1)
+	n[geoNorth] = geohashMoveY(hash, 1)
+	n[geoSouthWest] = geohashMoveY(geohashMoveX(hash, -1), -1)
+	n[geoSouthEast] = geohashMoveY(geohashMoveX(hash, 1), -1)
+	n[geoNorthWest] = geohashMoveY(geohashMoveX(hash, -1), 1)
+	n[geoNorthEast] = geohashMoveY(geohashMoveX(hash, 1), 1)
+	return n
+}
+
+// geohashCalculateAreasByShapeWGS84 计算覆盖搜索区域的 geohash 格子
+func geohashCalculateAreasByShapeWGS84(shape *geoShape) geoHashRadius {
+	bounds := geohashBoundingBox(shape)
+	minLon, minLat, maxLon, maxLat := bounds[0], bounds[1], bounds[2], bounds[3]
+
+	// 矩形以中心到角的距离作为半径
+	radiusMeters := shape.radius
+	if shape.kind == GEO_SHAPE_BOX {
+		radiusMeters = math.Sqrt((shape.width/2)*(shape.width/2) + (shape.height/2)*(shape.height/2))
+	}
+	radiusMeters *= shape.conversion
+
+	steps := geohashEstimateStepsByRadius(radiusMeters, shape.latitude)
+	hash := geohashEncodeWGS84(shape.longitude, shape.latitude, steps)
+	neighbors := geohashNeighbors(hash)
+
+	// 搜索区域靠近中心格子的边缘时，估算的精度可能不足以让相邻格子覆盖整个区域，此时降低一级精度
+	north := geohashDecodeWGS84(neighbors[geoNorth])
+	south := geohashDecodeWGS84(neighbors[geoSouth])
+	east := geohashDecodeWGS84(neighbors[geoEast])
+	west := geohashDecodeWGS84(neighbors[geoWest])
+	decreaseStep := north.latitude.max < maxLat || south.latitude.min > minLat ||
+		east.longitude.max < maxLon || west.longitude.min > minLon
+	if steps > 1 && decreaseStep {
+		steps--
+		hash = geohashEncodeWGS84(shape.longitude, shape.latitude, steps)
+		neighbors = geohashNeighbors(hash)
+	}
+	area := geohashDecodeWGS84(hash)
+
+	// 排除不可能与搜索区域相交的相邻格子
+	if steps >= 2 {
+		if area.latitude.min < minLat {
+			neighbors[geoSouth] = geoHashBits{}
+			neighbors[geoSouthWest] = geoHashBits{}
+			neighbors[geoSouthEast] = geoHashBits{}
+		}
+		if area.latitude.max > maxLat {
+			neighbors[geoNorth] = geoHashBits{}
+			neighbors[geoNorthEast] = geoHashBits{}
+			neighbors[geoNorthWest] = geoHashBits{}
+		}
+		if area.longitude.min < minLon {
+			neighbors[geoWest] = geoHashBits{}
+			neighbors[geoSouthWest] = geoHashBits{}
+			neighbors[geoNorthWest] = geoHashBits{}
+		}
+		if area.longitude.max > maxLon {
+			neighbors[geoEast] = geoHashBits{}
+			neighbors[geoSouthEast] = geoHashBits{}
+			neighbors[geoNorthEast] = geoHashBits{}
+		}
+	}
+	return geoHashRadius{hash: hash, area: area, neighbors: neighbors}
+}
+
+// geohashScoreRange 返回格子内所有点的分数区间 [min, max)
+func geohashScoreRange(hash geoHashBits) (float64, float64) {
+	shift := geoStepMax*2 - hash.step*2
+	return float64(hash.bits << shift), float64((hash.bits + 1) << shift)
+}
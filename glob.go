@@ -0,0 +1,132 @@
+package goredis
+
+// stringMatch 判断 str 是否匹配 glob 模式，语义与 Redis 的 stringmatchlen 一致：
+// "*" 匹配任意长度（包括空）的字符，"?" 匹配任意单个字符，"[abc]" 匹配方括号中的
+// 任意字符（支持 a-z 范围和开头的 ^ 取反），"\x" 匹配字符 x 本身。
+//
+// KEYS、SCAN MATCH 和 PSUBSCRIBE 等都使用这个函数，模式来自客户端，因此需要防止
+// "a*a*a*...b" 这类模式造成指数级回溯，见 stringMatchImpl。
+func stringMatch(pattern, str string, nocase bool) bool {
+	skipLongerMatches := false
+	return stringMatchImpl(pattern, str, nocase, &skipLongerMatches, 0)
+}
+
+// stringMatchMaxNesting 限制 "*" 递归的深度，超过时视为不匹配
+const stringMatchMaxNesting = 1000
+
+// stringMatchImpl 是 stringMatch 的实现
+//
+// 当 "*" 之后的剩余模式对 str 的某个后缀匹配失败并且已经尝试到了 str 的末尾时，
+// 对更短的后缀也不可能匹配成功，skipLongerMatches 用于把这一结论传回外层的 "*"，
+// 让它们停止继续尝试，从而把最坏情况从指数级降到多项式级。
+func stringMatchImpl(pattern, str string, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > stringMatchMaxNesting {
+		return false
+	}
+	p, s := 0, 0
+	for p < len(pattern) && s <= len(str) {
+		switch pattern[p] {
+		case '*':
+			// 合并连续的 *
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			// "*" 之后的模式不能匹配空串（连续的 * 已合并），因此只需尝试非空的后缀
+			for i := s; i < len(str); i++ {
+				if stringMatchImpl(pattern[p+1:], str[i:], nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+			}
+			*skipLongerMatches = true
+			return false
+
+		case '?':
+			if s >= len(str) {
+				return false
+			}
+			s++
+
+		case '[':
+			if s >= len(str) {
+				return false
+			}
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			match := false
+			for p < len(pattern) && pattern[p] != ']' {
+				if pattern[p] == '\\' && p+1 < len(pattern) {
+					p++
+					if equalFold(pattern[p], str[s], nocase) {
+						match = true
+					}
+				} else if p+2 < len(pattern) && pattern[p+1] == '-' {
+					start, end := pattern[p], pattern[p+2]
+					if start > end {
+						start, end = end, start
+					}
+					c := str[s]
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					if c >= start && c <= end {
+						match = true
+					}
+					p += 2
+				} else if equalFold(pattern[p], str[s], nocase) {
+					match = true
+				}
+				p++
+			}
+			if p >= len(pattern) {
+				// 缺少 ] 时视为模式结束
+				p--
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s++
+
+		case '\\':
+			if p+1 < len(pattern) {
+				p++
+			}
+			fallthrough
+
+		default:
+			if s >= len(str) || !equalFold(pattern[p], str[s], nocase) {
+				return false
+			}
+			s++
+		}
+		p++
+	}
+	return p == len(pattern) && s == len(str)
+}
+
+// equalFold 比较两个字节，nocase 为 true 时忽略 ASCII 大小写
+func equalFold(a, b byte, nocase bool) bool {
+	if nocase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
+
+// toLower 将 ASCII 大写字母转换为小写
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
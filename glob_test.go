@@ -0,0 +1,63 @@
+package goredis
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStringMatch(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		nocase       bool
+		want         bool
+	}{
+		{"*", "", false, true},
+		{"*", "anything", false, true},
+		{"h?llo", "hello", false, true},
+		{"h?llo", "hllo", false, false},
+		{"h*llo", "hllo", false, true},
+		{"h*llo", "heeeello", false, true},
+		{"h**o", "hello", false, true},
+		{"h[ae]llo", "hallo", false, true},
+		{"h[ae]llo", "hillo", false, false},
+		{"h[^e]llo", "hallo", false, true},
+		{"h[^e]llo", "hello", false, false},
+		{"h[a-b]llo", "hbllo", false, true},
+		{"h[b-a]llo", "hbllo", false, true},
+		{"h[a-b]llo", "hcllo", false, false},
+		{`h\*llo`, "h*llo", false, true},
+		{`h\*llo`, "hello", false, false},
+		{`[\]]`, "]", false, true},
+		{"HELLO", "hello", false, false},
+		{"HELLO", "hello", true, true},
+		{"[A-C]x", "bx", true, true},
+		{"a*b*c", "aXbYc", false, true},
+		{"a*b*c", "aXbY", false, false},
+		{"[abc", "a", false, true},
+	}
+	for _, tt := range tests {
+		if got := stringMatch(tt.pattern, tt.str, tt.nocase); got != tt.want {
+			t.Errorf("stringMatch(%q, %q, %v) = %v, want %v", tt.pattern, tt.str, tt.nocase, got, tt.want)
+		}
+	}
+}
+
+func TestStringMatchPathologicalPattern(t *testing.T) {
+	// 没有回溯上限时这个匹配需要指数级时间
+	pattern := strings.Repeat("a*", 40) + "b"
+	str := strings.Repeat("a", 60)
+	done := make(chan bool)
+	go func() { done <- stringMatch(pattern, str, false) }()
+	select {
+	case got := <-done:
+		if got {
+			t.Fatalf("pathological pattern matched")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("pathological pattern did not finish")
+	}
+	if !stringMatch(strings.Repeat("a*", 40), strings.Repeat("a", 60), false) {
+		t.Fatalf("a*a*... should match a string of a's")
+	}
+}
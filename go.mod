@@ -1,3 +1,5 @@
 module goRedis
 
 go 1.22.2
+
+require github.com/yuin/gopher-lua v1.1.1
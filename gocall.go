@@ -0,0 +1,92 @@
+package goredis
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// GoFunction 是用 RegisterGoFunction 注册、由 GOCALL 调用的 Go 函数，返回值直接作为命令的回复
+//
+// 函数与 EVAL 脚本一样在独占命令锁的情况下执行，执行期间其他连接的命令都要等待，
+// 因此通过 GoCall.Call 执行的多条命令不会与其他命令交错。函数不能被 SCRIPT KILL 终止。
+type GoFunction func(call *GoCall) *RESPValue
+
+// GoCall 是一次 GOCALL 调用，Keys 和 Args 分别是调用时给出的键名和其余参数
+type GoCall struct {
+	Keys []string
+	Args []string
+
+	rs *RedisServer
+}
+
+// Call 在调用者当前的数据库中执行一条命令并返回回复
+//
+// 与 Lua 中的 redis.pcall 相同，命令出错时返回错误回复，由函数决定如何处理；
+// 事务、订阅和脚本类命令不能使用。
+func (gc *GoCall) Call(args ...string) *RESPValue {
+	if len(args) == 0 {
+		return NewErrorValue("ERR Please specify at least one argument for this redis lib call")
+	}
+	elems := make([]*RESPValue, len(args))
+	for i, arg := range args {
+		elems[i] = NewBulkStringValue(arg)
+	}
+	return gc.rs.scriptExecCommand(elems)
+}
+
+// RegisterGoFunction 注册可以用 GOCALL 调用的 Go 函数，函数名只能由字母、数字和下划线组成
+//
+// 嵌入服务器的程序通常在 Start 之前注册，运行期间注册也是安全的。
+func (rs *RedisServer) RegisterGoFunction(name string, fn GoFunction) error {
+	if !validFunctionName(name) {
+		return fmt.Errorf("invalid Go function name '%s'", name)
+	}
+	if fn == nil {
+		return errors.New("nil Go function")
+	}
+
+	// GOCALL 在持有 execMu 写锁时读取 goFunctions
+	rs.execMu.Lock()
+	defer rs.execMu.Unlock()
+	if _, ok := rs.goFunctions[name]; ok {
+		return fmt.Errorf("Go function '%s' already exists", name)
+	}
+	rs.goFunctions[name] = fn
+	return nil
+}
+
+// handleGoCall 处理 GOCALL function numkeys [key ...] [arg ...] 命令，调用注册的 Go 函数
+func (rs *RedisServer) handleGoCall(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	fn, ok := rs.goFunctions[args[0]]
+	if !ok {
+		return NewErrorValue("ERR Function not found")
+	}
+	keys, argv, errResp := splitNumKeys(args[1:])
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.luaClient.db = c.db
+	rs.luaReadOnly = false
+	return rs.goCall(args[0], fn, &GoCall{Keys: keys, Args: argv, rs: rs})
+}
+
+// goCall 调用 Go 函数，函数 panic 时记录日志并返回错误，服务器继续运行
+func (rs *RedisServer) goCall(name string, fn GoFunction, call *GoCall) (resp *RESPValue) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Go function '%s' panicked: %v", name, r)
+			resp = NewErrorValue(fmt.Sprintf("ERR Error running Go function '%s': %v", name, r))
+		}
+	}()
+	resp = fn(call)
+	if resp == nil {
+		return NewNullBulkStringValue()
+	}
+	return resp
+}
@@ -0,0 +1,48 @@
+package goredis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGoCall(t *testing.T) {
+	ts := startTestServer(t)
+	// 运行期间注册同样安全
+	ts.rs.RegisterGoFunction("getset", func(call *GoCall) *RESPValue {
+		old := call.Call("GET", call.Keys[0])
+		call.Call("SET", call.Keys[0], call.Args[0])
+		return old
+	})
+	ts.rs.RegisterGoFunction("fail", func(call *GoCall) *RESPValue {
+		panic("boom")
+	})
+	ts.rs.RegisterGoFunction("nested", func(call *GoCall) *RESPValue {
+		return call.Call("MULTI")
+	})
+	c := ts.connect(t)
+	c.mustDo("(nil)", "GOCALL", "getset", "1", "k", "a")
+	c.mustDo("a", "GOCALL", "getset", "1", "k", "b")
+	c.mustDo("b", "GET", "k")
+	c.mustDo("(error) ERR Error running Go function 'fail': boom", "GOCALL", "fail", "0")
+	c.mustDo("(error) ERR Function not found", "GOCALL", "missing", "0")
+	c.mustDo("(error) ERR This Redis command is not allowed from script", "GOCALL", "nested", "0")
+	c.mustDo("(error) ERR Number of keys can't be greater than number of args", "GOCALL", "getset", "2", "k")
+	// 服务器在函数 panic 之后继续运行
+	c.mustDo("PONG", "PING")
+}
+
+func TestRegisterGoFunction(t *testing.T) {
+	rs := NewRedisServer("127.0.0.1", 0, 1)
+	fn := func(call *GoCall) *RESPValue { return nil }
+	if err := rs.RegisterGoFunction("f", fn); err != nil {
+		t.Fatal(err)
+	}
+	for name, f := range map[string]GoFunction{"f": fn, "bad-name": fn, "": fn, "nilfn": nil} {
+		if err := rs.RegisterGoFunction(name, f); err == nil {
+			t.Errorf("registering %q should fail", name)
+		}
+	}
+	if got := rs.goCall("f", fn, &GoCall{rs: rs}); !got.IsNull || !strings.HasPrefix(got.ToString(), "BulkString") {
+		t.Fatalf("nil reply converted to %s", got.ToString())
+	}
+}
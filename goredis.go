@@ -0,0 +1,81 @@
+// Package goredis 是一个用 Go 实现的 Redis 服务器。
+//
+// 命令行入口在 cmd/goredis 中；嵌入服务器的程序用 NewRedisServer 创建服务器，或者以 Main
+// 按命令行参数和配置文件启动，在 Start 之前注册 Go 函数（RegisterGoFunction）或者替换存储后端（SetPersister）。
+package goredis
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Main 按命令行参数 args（不含程序名）启动服务器，直到服务器出错才返回
+//
+// 参数的格式是 [redis.conf] [host] [port] [databases]：第一个参数以 .conf 结尾时作为配置文件，
+// 命令行上的其余参数优先于配置文件；之后是 --check-rdb 或 --check-aof 时只检查持久化文件，
+// 以检查的结果退出进程。setup 不为 nil 时在应用配置之后、Start 之前调用，返回错误时不启动服务器。
+func Main(args []string, setup func(server *RedisServer) error) error {
+	// 默认配置
+	host := "127.0.0.1"
+	port := 6379
+	databases := 16
+
+	var directives []configDirective
+	if len(args) > 0 && strings.HasSuffix(args[0], ".conf") {
+		var err error
+		if directives, err = loadConfigFile(args[0]); err != nil {
+			return err
+		}
+		if err := startupConfig(directives, &host, &port, &databases); err != nil {
+			return err
+		}
+		args = args[1:]
+	}
+
+	// --check-rdb 和 --check-aof 只检查持久化文件，不启动服务器
+	if len(args) > 0 && strings.HasPrefix(args[0], "--check-") {
+		server := NewRedisServer(host, port, databases)
+		if err := server.applyConfigFile(directives); err != nil {
+			return err
+		}
+		if setup != nil {
+			if err := setup(server); err != nil {
+				return err
+			}
+		}
+		os.Exit(server.checkMain(args))
+	}
+
+	// 从命令行参数读取配置
+	if len(args) > 0 {
+		host = args[0]
+	}
+	if len(args) > 1 {
+		if p, err := strconv.Atoi(args[1]); err == nil {
+			port = p
+		}
+	}
+	if len(args) > 2 {
+		if n, err := strconv.Atoi(args[2]); err == nil && n > 0 {
+			databases = n
+		}
+	}
+
+	server := NewRedisServer(host, port, databases)
+	if err := server.applyConfigFile(directives); err != nil {
+		return err
+	}
+	if setup != nil {
+		if err := setup(server); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Starting Redis server on %s:%d\n", host, port)
+	fmt.Println("Usage: go run ./cmd/goredis [redis.conf] [host] [port] [databases]")
+	fmt.Println("Example: go run ./cmd/goredis 127.0.0.1 6379 16")
+
+	return server.Start()
+}
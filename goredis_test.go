@@ -0,0 +1,22 @@
+package goredis
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMainAppliesArgsBeforeSetup(t *testing.T) {
+	stop := errors.New("stop before Start")
+	var got *RedisServer
+	err := Main([]string{"127.0.0.1", "7000", "4"}, func(server *RedisServer) error {
+		got = server
+		return stop
+	})
+	// setup 返回错误时 Main 不启动服务器，直接返回该错误
+	if err != stop {
+		t.Fatalf("Main returned %v", err)
+	}
+	if got.host != "127.0.0.1" || got.port != 7000 || len(got.databases) != 4 {
+		t.Fatalf("server created with %s:%d and %d databases", got.host, got.port, len(got.databases))
+	}
+}
@@ -0,0 +1,49 @@
+package goredis
+
+// Hash 表示哈希类型的值：字段到值的映射
+//
+// 目前只用哈希表编码，不像 Redis 那样对小哈希使用 listpack；遍历的顺序不确定，与 Redis 的哈希表相同。
+type Hash struct {
+	fields map[string]string
+}
+
+// NewHash 创建空哈希
+func NewHash() *Hash {
+	return &Hash{fields: make(map[string]string)}
+}
+
+// Len 返回字段数量
+func (h *Hash) Len() int {
+	return len(h.fields)
+}
+
+// Get 返回字段的值，以及字段是否存在
+func (h *Hash) Get(field string) (string, bool) {
+	value, ok := h.fields[field]
+	return value, ok
+}
+
+// Set 设置字段的值，返回字段是否是新增的
+func (h *Hash) Set(field, value string) bool {
+	_, exists := h.fields[field]
+	h.fields[field] = value
+	return !exists
+}
+
+// Delete 删除字段，返回字段是否存在
+func (h *Hash) Delete(field string) bool {
+	if _, ok := h.fields[field]; !ok {
+		return false
+	}
+	delete(h.fields, field)
+	return true
+}
+
+// Iterate 遍历所有字段和值，fn 返回 false 时停止
+func (h *Hash) Iterate(fn func(field, value string) bool) {
+	for field, value := range h.fields {
+		if !fn(field, value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package goredis
+
+// handleHSet 处理 HSET 命令，返回新增的字段数
+func (rs *RedisServer) handleHSet(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 || len(args)%2 != 1 {
+		return wrongArgsError("hset")
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	hash, errResp := c.db.lookupHashWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if hash == nil {
+		obj := NewHashObject()
+		c.db.store.Set(key, obj)
+		hash = obj.Value.(*Hash)
+	}
+
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		if hash.Set(args[i], args[i+1]) {
+			added++
+		}
+	}
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_HASH, "hset", key, c.db.id)
+	return NewIntegerValue(int64(added))
+}
+
+// handleHDel 处理 HDEL 命令，返回删除的字段数，最后一个字段被删除时删除键
+func (rs *RedisServer) handleHDel(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("hdel")
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	hash, errResp := c.db.lookupHashWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if hash == nil {
+		return NewIntegerValue(0)
+	}
+
+	deleted := 0
+	for _, field := range args[1:] {
+		if hash.Delete(field) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_HASH, "hdel", key, c.db.id)
+		if hash.Len() == 0 {
+			c.db.store.Delete(key)
+			rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+		}
+	}
+	return NewIntegerValue(int64(deleted))
+}
+
+// handleHGet 处理 HGET 命令
+func (rs *RedisServer) handleHGet(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("hget")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	hash, errResp := c.db.lookupHash(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if hash == nil {
+		return NewNullBulkStringValue()
+	}
+	value, ok := hash.Get(args[1])
+	if !ok {
+		return NewNullBulkStringValue()
+	}
+	return NewBulkStringValue(value)
+}
+
+// handleHExists 处理 HEXISTS 命令
+func (rs *RedisServer) handleHExists(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("hexists")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	hash, errResp := c.db.lookupHash(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if hash == nil {
+		return NewIntegerValue(0)
+	}
+	if _, ok := hash.Get(args[1]); ok {
+		return NewIntegerValue(1)
+	}
+	return NewIntegerValue(0)
+}
+
+// handleHLen 处理 HLEN 命令
+func (rs *RedisServer) handleHLen(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 {
+		return wrongArgsError("hlen")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	hash, errResp := c.db.lookupHash(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if hash == nil {
+		return NewIntegerValue(0)
+	}
+	return NewIntegerValue(int64(hash.Len()))
+}
+
+// handleHGetAll 处理 HGETALL 命令，RESP3 下返回映射
+func (rs *RedisServer) handleHGetAll(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 {
+		return wrongArgsError("hgetall")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	hash, errResp := c.db.lookupHash(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	elems := []*RESPValue{}
+	if hash != nil {
+		hash.Iterate(func(field, value string) bool {
+			elems = append(elems, NewBulkStringValue(field), NewBulkStringValue(value))
+			return true
+		})
+	}
+	return NewMapValue(elems)
+}
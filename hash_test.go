@@ -0,0 +1,30 @@
+package goredis
+
+import "testing"
+
+func TestHashCommands(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("2", "HSET", "h", "f1", "a", "f2", "b")
+	c.mustDo("0", "HSET", "h", "f1", "c")
+	c.mustDo("c", "HGET", "h", "f1")
+	c.mustDo("(nil)", "HGET", "h", "missing")
+	c.mustDo("(nil)", "HGET", "nokey", "f")
+	c.mustDo("1", "HEXISTS", "h", "f2")
+	c.mustDo("0", "HEXISTS", "h", "f3")
+	c.mustDo("2", "HLEN", "h")
+	c.mustDo("[0 [h]]", "SCAN", "0", "TYPE", "hash")
+	c.mustDo("hashtable", "OBJECT", "ENCODING", "h")
+	c.mustDo("(error) ERR wrong number of arguments for 'hset' command", "HSET", "h", "f1")
+
+	// 最后一个字段被删除时删除键
+	c.mustDo("1", "HDEL", "h", "f1", "f3")
+	c.mustDo("[f2 b]", "HGETALL", "h")
+	c.mustDo("1", "HDEL", "h", "f2")
+	c.mustDo("0", "DBSIZE")
+	c.mustDo("[]", "HGETALL", "h")
+
+	c.mustDo("OK", "SET", "s", "v")
+	c.mustDo("(error) "+wrongTypeErr, "HSET", "s", "f", "v")
+	c.mustDo("(error) "+wrongTypeErr, "HGET", "s", "f")
+}
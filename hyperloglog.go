@@ -0,0 +1,470 @@
+package goredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// HyperLogLog 参数，与 Redis 相同：2^14 个 6 位寄存器，标准误差约 0.81%
+const (
+	hllP           = 14
+	hllQ           = 64 - hllP
+	hllRegisters   = 1 << hllP
+	hllPMask       = hllRegisters - 1
+	hllBits        = 6
+	hllRegisterMax = 1<<hllBits - 1
+	hllHdrSize     = 16
+	hllDenseSize   = hllHdrSize + (hllRegisters*hllBits+7)/8
+	hllAlphaInf    = 0.721347520444481703680
+)
+
+// HyperLogLog 的编码
+const (
+	hllDense  = 0
+	hllSparse = 1
+)
+
+// 稀疏编码的参数
+const (
+	hllSparseMaxBytes    = 3000 // 稀疏编码（含头部）超过该长度时转换为稠密编码
+	hllSparseValMax      = 32   // VAL 操作码能表示的最大寄存器值
+	hllSparseValMaxLen   = 4
+	hllSparseZeroMaxLen  = 64
+	hllSparseXZeroMaxLen = 16384
+)
+
+// hllMagic 是 HyperLogLog 字符串的前四个字节
+var hllMagic = []byte("HYLL")
+
+// HyperLogLog 以字符串的形式保存，布局与 Redis 一致，因此 GET/SET 得到的内容可以在两者之间互通：
+//
+//	+------+---+-----+----------+
+//	| HYLL | E | N/U | Cardin.  |
+//	+------+---+-----+----------+
+//
+// 4 字节魔数、1 字节编码、3 字节保留，随后是 8 字节小端序的基数缓存，
+// 缓存最高字节的最高位为 1 表示缓存失效。头部之后是寄存器数据，有两种编码：
+//
+// 稠密编码下每个寄存器占 6 位，从低位开始依次排列，共 12KB。
+//
+// 稀疏编码把寄存器序列表示为游程，适合大部分寄存器为 0 的小基数场景：
+//
+//	00xxxxxx          ZERO：连续 xxxxxx+1 个值为 0 的寄存器（1-64）
+//	01xxxxxx yyyyyyyy XZERO：连续 14 位长度 +1 个值为 0 的寄存器（1-16384）
+//	1vvvvvxx          VAL：连续 xx+1 个值为 vvvvv+1 的寄存器（值 1-32，长度 1-4）
+//
+// 新建的 HyperLogLog 使用稀疏编码，当出现大于 32 的寄存器值或长度超过 hllSparseMaxBytes 时转换为稠密编码。
+
+// newHLL 创建空的 HyperLogLog，使用稀疏编码
+func newHLL() []byte {
+	buf := make([]byte, hllHdrSize, hllHdrSize+2)
+	copy(buf, hllMagic)
+	buf[4] = hllSparse
+	return hllSparseAppendRun(buf, 0, hllRegisters)
+}
+
+// newDenseHLL 创建空的稠密编码 HyperLogLog
+func newDenseHLL() []byte {
+	buf := make([]byte, hllDenseSize)
+	copy(buf, hllMagic)
+	buf[4] = hllDense
+	return buf
+}
+
+// isHLL 检查字符串是否具有 HyperLogLog 的头部，稀疏编码的内容还需用 hllSparseValid 检查
+func isHLL(buf []byte) bool {
+	if len(buf) < hllHdrSize || !bytes.Equal(buf[:4], hllMagic) {
+		return false
+	}
+	switch buf[4] {
+	case hllDense:
+		return len(buf) == hllDenseSize
+	case hllSparse:
+		return true
+	}
+	return false
+}
+
+// hllCacheValid 判断头部缓存的基数是否有效
+func hllCacheValid(buf []byte) bool {
+	return buf[15]&(1<<7) == 0
+}
+
+// hllInvalidateCache 使头部缓存的基数失效
+func hllInvalidateCache(buf []byte) {
+	buf[15] |= 1 << 7
+}
+
+// hllGetCache 读取头部缓存的基数
+func hllGetCache(buf []byte) uint64 {
+	return binary.LittleEndian.Uint64(buf[8:16])
+}
+
+// hllSetCache 写入头部缓存的基数
+func hllSetCache(buf []byte, card uint64) {
+	binary.LittleEndian.PutUint64(buf[8:16], card)
+}
+
+// murmurHash64A 是 Redis 用于 HyperLogLog 的 64 位哈希函数
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	h := seed ^ (uint64(len(data)) * m)
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hllPatLen 返回元素对应的寄存器下标，以及哈希剩余部分中第一个 1 出现的位置（从 1 开始）
+func hllPatLen(ele []byte) (int, uint8) {
+	hash := murmurHash64A(ele, 0xadc83b19)
+	index := int(hash & hllPMask)
+	hash >>= hllP
+	// 保证循环一定结束，count 最大为 hllQ+1
+	hash |= 1 << hllQ
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// hllDenseGetRegister 读取稠密编码中的第 regnum 个寄存器
+func hllDenseGetRegister(regs []byte, regnum int) uint8 {
+	byteIndex := regnum * hllBits / 8
+	fb := uint(regnum * hllBits & 7)
+	b0 := uint(regs[byteIndex])
+	var b1 uint
+	if byteIndex+1 < len(regs) {
+		b1 = uint(regs[byteIndex+1])
+	}
+	return uint8((b0>>fb | b1<<(8-fb)) & hllRegisterMax)
+}
+
+// hllDenseSetRegister 设置稠密编码中的第 regnum 个寄存器
+func hllDenseSetRegister(regs []byte, regnum int, val uint8) {
+	byteIndex := regnum * hllBits / 8
+	fb := uint(regnum * hllBits & 7)
+	v := uint(val)
+	regs[byteIndex] &^= byte(hllRegisterMax << fb)
+	regs[byteIndex] |= byte(v << fb)
+	if byteIndex+1 < len(regs) {
+		regs[byteIndex+1] &^= byte(hllRegisterMax >> (8 - fb))
+		regs[byteIndex+1] |= byte(v >> (8 - fb))
+	}
+}
+
+// hllDenseSet 在寄存器的当前值小于 count 时更新它，返回是否发生了变化
+func hllDenseSet(regs []byte, index int, count uint8) bool {
+	if hllDenseGetRegister(regs, index) < count {
+		hllDenseSetRegister(regs, index, count)
+		return true
+	}
+	return false
+}
+
+// hllSparseRun 表示稀疏编码中连续 length 个值为 val 的寄存器
+type hllSparseRun struct {
+	val    uint8
+	length int
+}
+
+// hllSparseWalk 按顺序遍历稀疏编码中的游程，fn 返回 false 时停止遍历
+//
+// 数据损坏（操作码不完整或寄存器总数不是 hllRegisters）时返回 false，提前停止时返回 true。
+func hllSparseWalk(regs []byte, fn func(start int, run hllSparseRun) bool) bool {
+	start := 0
+	for i := 0; i < len(regs); {
+		b := regs[i]
+		var run hllSparseRun
+		switch {
+		case b&0xc0 == 0x00:
+			run.length = int(b&0x3f) + 1
+			i++
+		case b&0xc0 == 0x40:
+			if i+1 >= len(regs) {
+				return false
+			}
+			run.length = (int(b&0x3f)<<8 | int(regs[i+1])) + 1
+			i += 2
+		default:
+			run.val = (b>>2)&0x1f + 1
+			run.length = int(b&0x03) + 1
+			i++
+		}
+		if start+run.length > hllRegisters {
+			return false
+		}
+		if !fn(start, run) {
+			return true
+		}
+		start += run.length
+	}
+	return start == hllRegisters
+}
+
+// hllSparseValid 检查稀疏编码的寄存器数据是否完整
+func hllSparseValid(regs []byte) bool {
+	return hllSparseWalk(regs, func(int, hllSparseRun) bool { return true })
+}
+
+// hllSparseGetRegister 读取稀疏编码中的第 regnum 个寄存器
+func hllSparseGetRegister(regs []byte, regnum int) uint8 {
+	var val uint8
+	hllSparseWalk(regs, func(start int, run hllSparseRun) bool {
+		if regnum < start+run.length {
+			val = run.val
+			return false
+		}
+		return true
+	})
+	return val
+}
+
+// hllSparseAppendRun 把连续 length 个值为 val 的寄存器编码后追加到 out
+func hllSparseAppendRun(out []byte, val uint8, length int) []byte {
+	for length > 0 {
+		switch {
+		case val != 0:
+			n := min(length, hllSparseValMaxLen)
+			out = append(out, 0x80|(val-1)<<2|byte(n-1))
+			length -= n
+		case length > hllSparseZeroMaxLen:
+			n := min(length, hllSparseXZeroMaxLen)
+			out = append(out, 0x40|byte((n-1)>>8), byte(n-1))
+			length -= n
+		default:
+			out = append(out, byte(length-1))
+			length = 0
+		}
+	}
+	return out
+}
+
+// hllSparseEncode 把游程编码后追加到 out，相邻的同值游程会被合并
+func hllSparseEncode(out []byte, runs []hllSparseRun) []byte {
+	for i := 0; i < len(runs); {
+		run := runs[i]
+		for i++; i < len(runs) && runs[i].val == run.val; i++ {
+			run.length += runs[i].length
+		}
+		out = hllSparseAppendRun(out, run.val, run.length)
+	}
+	return out
+}
+
+// hllSparseToDense 把稀疏编码转换为稠密编码，保留头部中的基数缓存
+func hllSparseToDense(buf []byte) []byte {
+	dense := newDenseHLL()
+	copy(dense[5:hllHdrSize], buf[5:hllHdrSize])
+	regs := dense[hllHdrSize:]
+	hllSparseWalk(buf[hllHdrSize:], func(start int, run hllSparseRun) bool {
+		if run.val != 0 {
+			for i := start; i < start+run.length; i++ {
+				hllDenseSetRegister(regs, i, run.val)
+			}
+		}
+		return true
+	})
+	return dense
+}
+
+// hllSparseSet 在寄存器的当前值小于 count 时更新它，返回新的内容以及是否发生了变化
+//
+// 更新时把覆盖该寄存器的游程拆成至多三段后重新编码；寄存器值超出 VAL 的表示范围，
+// 或编码后超过 hllSparseMaxBytes 时转换为稠密编码。
+func hllSparseSet(buf []byte, index int, count uint8) ([]byte, bool) {
+	regs := buf[hllHdrSize:]
+	if hllSparseGetRegister(regs, index) >= count {
+		return buf, false
+	}
+	if count > hllSparseValMax {
+		dense := hllSparseToDense(buf)
+		hllDenseSet(dense[hllHdrSize:], index, count)
+		return dense, true
+	}
+
+	var runs []hllSparseRun
+	hllSparseWalk(regs, func(start int, run hllSparseRun) bool {
+		if index < start || index >= start+run.length {
+			runs = append(runs, run)
+			return true
+		}
+		if before := index - start; before > 0 {
+			runs = append(runs, hllSparseRun{run.val, before})
+		}
+		runs = append(runs, hllSparseRun{count, 1})
+		if after := start + run.length - index - 1; after > 0 {
+			runs = append(runs, hllSparseRun{run.val, after})
+		}
+		return true
+	})
+
+	out := make([]byte, hllHdrSize, len(buf)+3)
+	copy(out, buf[:hllHdrSize])
+	out = hllSparseEncode(out, runs)
+	if len(out) > hllSparseMaxBytes {
+		dense := hllSparseToDense(buf)
+		hllDenseSet(dense[hllHdrSize:], index, count)
+		return dense, true
+	}
+	return out, true
+}
+
+// hllAdd 把元素加入 HyperLogLog，返回新的内容（编码可能发生变化）以及是否有寄存器发生了变化
+func hllAdd(buf []byte, ele []byte) ([]byte, bool) {
+	index, count := hllPatLen(ele)
+	if buf[4] == hllSparse {
+		return hllSparseSet(buf, index, count)
+	}
+	return buf, hllDenseSet(buf[hllHdrSize:], index, count)
+}
+
+// hllMerge 把 HyperLogLog 的寄存器按最大值合并到 registers 中，registers 的每个元素对应一个寄存器
+func hllMerge(registers []uint8, buf []byte) {
+	regs := buf[hllHdrSize:]
+	if buf[4] == hllSparse {
+		hllSparseWalk(regs, func(start int, run hllSparseRun) bool {
+			if run.val != 0 {
+				for i := start; i < start+run.length; i++ {
+					registers[i] = max(registers[i], run.val)
+				}
+			}
+			return true
+		})
+		return
+	}
+	for i := 0; i < hllRegisters; i++ {
+		if val := hllDenseGetRegister(regs, i); val > registers[i] {
+			registers[i] = val
+		}
+	}
+}
+
+// hllStore 把以每个寄存器一个字节表示的寄存器写回 HyperLogLog，返回新的内容
+//
+// 原本是稀疏编码且结果仍能以稀疏编码表示时保持稀疏编码，否则使用稠密编码。
+func hllStore(buf []byte, registers []uint8) []byte {
+	if buf[4] == hllSparse {
+		var runs []hllSparseRun
+		fits := true
+		for i, val := range registers {
+			if val > hllSparseValMax {
+				fits = false
+				break
+			}
+			if i > 0 && registers[i-1] == val {
+				runs[len(runs)-1].length++
+			} else {
+				runs = append(runs, hllSparseRun{val, 1})
+			}
+		}
+		if fits {
+			out := make([]byte, hllHdrSize)
+			copy(out, buf[:hllHdrSize])
+			if out = hllSparseEncode(out, runs); len(out) <= hllSparseMaxBytes {
+				return out
+			}
+		}
+		dense := newDenseHLL()
+		copy(dense[5:hllHdrSize], buf[5:hllHdrSize])
+		buf = dense
+	}
+
+	regs := buf[hllHdrSize:]
+	for i, val := range registers {
+		hllDenseSetRegister(regs, i, val)
+	}
+	return buf
+}
+
+// hllTau 和 hllSigma 是 Otmar Ertl 提出的改进估计算法中的修正函数
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			break
+		}
+	}
+	return z / 3
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			break
+		}
+	}
+	return z
+}
+
+// hllEstimate 根据寄存器值的直方图估算基数
+func hllEstimate(reghisto *[64]int) uint64 {
+	m := float64(hllRegisters)
+	z := m * hllTau((m-float64(reghisto[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(reghisto[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(reghisto[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+// hllCount 估算单个 HyperLogLog 的基数
+func hllCount(buf []byte) uint64 {
+	var reghisto [64]int
+	regs := buf[hllHdrSize:]
+	if buf[4] == hllSparse {
+		hllSparseWalk(regs, func(_ int, run hllSparseRun) bool {
+			reghisto[run.val] += run.length
+			return true
+		})
+	} else {
+		for i := 0; i < hllRegisters; i++ {
+			reghisto[hllDenseGetRegister(regs, i)]++
+		}
+	}
+	return hllEstimate(&reghisto)
+}
+
+// hllCountRegisters 估算以每个寄存器一个字节表示的 HyperLogLog 的基数，用于多个键的并集
+func hllCountRegisters(regs []uint8) uint64 {
+	var reghisto [64]int
+	for _, val := range regs {
+		reghisto[val]++
+	}
+	return hllEstimate(&reghisto)
+}
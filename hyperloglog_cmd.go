@@ -0,0 +1,155 @@
+package goredis
+
+// HyperLogLog 类型错误信息
+const hllWrongTypeErr = "WRONGTYPE Key is not a valid HyperLogLog string value."
+
+// lookupHLL 查找 HyperLogLog，键不存在时返回 nil，不是合法的 HyperLogLog 时返回错误响应（调用方需持有锁）
+func (db *redisDb) lookupHLL(key string) (*RedisObject, *RESPValue) {
+	obj := db.lookupKey(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.Type != OBJ_STRING {
+		return nil, NewErrorValue(wrongTypeErr)
+	}
+	buf := obj.Value.([]byte)
+	if !isHLL(buf) {
+		return nil, NewErrorValue(hllWrongTypeErr)
+	}
+	if buf[4] == hllSparse && !hllSparseValid(buf[hllHdrSize:]) {
+		return nil, NewErrorValue("INVALIDOBJ Corrupted HLL object detected")
+	}
+	return obj, nil
+}
+
+// lookupHLLWrite 与 lookupHLL 相同，用于原地修改HyperLogLog（调用方需持有写锁）
+func (db *redisDb) lookupHLLWrite(key string) (*RedisObject, *RESPValue) {
+	db.lookupKeyWrite(key)
+	return db.lookupHLL(key)
+}
+
+// handlePFAdd 处理 PFADD 命令，近似基数发生变化（包括新建键）时返回 1
+func (rs *RedisServer) handlePFAdd(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("pfadd")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	obj, errResp := c.db.lookupHLLWrite(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	updated := false
+	if obj == nil {
+		obj = &RedisObject{Type: OBJ_STRING, Value: newHLL()}
+		c.db.store.Set(args[0], obj)
+		updated = true
+	}
+
+	buf := obj.Value.([]byte)
+	for _, ele := range args[1:] {
+		var changed bool
+		if buf, changed = hllAdd(buf, []byte(ele)); changed {
+			updated = true
+		}
+	}
+	if !updated {
+		return NewIntegerValue(0)
+	}
+	hllInvalidateCache(buf)
+	obj.Value = buf
+	rs.signalModifiedKey(c.db, args[0])
+	rs.notifyKeyspaceEvent(NOTIFY_STRING, "pfadd", args[0], c.db.id)
+	return NewIntegerValue(1)
+}
+
+// handlePFCount 处理 PFCOUNT 命令
+//
+// 单个键时使用并更新头部缓存的基数，多个键时返回它们并集的近似基数。
+// 因为可能写回缓存，PFCOUNT 需要持有写锁。
+func (rs *RedisServer) handlePFCount(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("pfcount")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if len(args) == 1 {
+		// 缓存的基数直接写入对象
+		obj, errResp := c.db.lookupHLLWrite(args[0])
+		if errResp != nil {
+			return errResp
+		}
+		if obj == nil {
+			return NewIntegerValue(0)
+		}
+		buf := obj.Value.([]byte)
+		if hllCacheValid(buf) {
+			return NewIntegerValue(int64(hllGetCache(buf)))
+		}
+		card := hllCount(buf)
+		hllSetCache(buf, card)
+		return NewIntegerValue(int64(card))
+	}
+
+	registers := make([]uint8, hllRegisters)
+	for _, key := range args {
+		obj, errResp := c.db.lookupHLL(key)
+		if errResp != nil {
+			return errResp
+		}
+		if obj != nil {
+			hllMerge(registers, obj.Value.([]byte))
+		}
+	}
+	return NewIntegerValue(int64(hllCountRegisters(registers)))
+}
+
+// handlePFMerge 处理 PFMERGE 命令，目标键已存在时也参与合并
+func (rs *RedisServer) handlePFMerge(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("pfmerge")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	registers := make([]uint8, hllRegisters)
+	for _, key := range args {
+		obj, errResp := c.db.lookupHLL(key)
+		if errResp != nil {
+			return errResp
+		}
+		if obj != nil {
+			hllMerge(registers, obj.Value.([]byte))
+		}
+	}
+
+	obj := c.db.lookupKeyWrite(args[0])
+	if obj == nil {
+		obj = &RedisObject{Type: OBJ_STRING, Value: newHLL()}
+		c.db.store.Set(args[0], obj)
+	}
+	buf := hllStore(obj.Value.([]byte), registers)
+	hllInvalidateCache(buf)
+	obj.Value = buf
+	// 与 Redis 一样，PFMERGE 以 pfadd 事件通知
+	rs.signalModifiedKey(c.db, args[0])
+	rs.notifyKeyspaceEvent(NOTIFY_STRING, "pfadd", args[0], c.db.id)
+	return NewSimpleStringValue("OK")
+}
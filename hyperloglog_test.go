@@ -0,0 +1,137 @@
+package goredis
+
+import (
+	"strconv"
+	"testing"
+)
+
+// hllEncoding 返回键中 HyperLogLog 的编码：hllSparse 或 hllDense
+func hllEncoding(t *testing.T, c *testClient, key string) byte {
+	t.Helper()
+	buf := c.do("GET", key).Str
+	if len(buf) < hllHdrSize || buf[:4] != "HYLL" {
+		t.Fatalf("%s is not a HyperLogLog", key)
+	}
+	return buf[4]
+}
+
+// pfaddRange 以每条命令 100 个元素的方式添加 prefix0 到 prefix(n-1)
+func pfaddRange(t *testing.T, c *testClient, key, prefix string, n int) {
+	t.Helper()
+	for i := 0; i < n; i += 100 {
+		args := []string{"PFADD", key}
+		for j := i; j < min(i+100, n); j++ {
+			args = append(args, prefix+strconv.Itoa(j))
+		}
+		c.do(args...)
+	}
+}
+
+// checkCount 检查 PFCOUNT 的结果与 want 的误差在 2% 以内
+func checkCount(t *testing.T, c *testClient, want int, keys ...string) {
+	t.Helper()
+	got := c.do(append([]string{"PFCOUNT"}, keys...)...).Num
+	if diff := float64(got-int64(want)) / float64(want); diff > 0.02 || diff < -0.02 {
+		t.Fatalf("PFCOUNT %v = %d, want about %d", keys, got, want)
+	}
+}
+
+func TestHyperLogLogCount(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("0", "PFCOUNT", "hll")
+	// 新建键时即使没有元素也返回 1
+	c.mustDo("1", "PFADD", "hll")
+	c.mustDo("0", "PFADD", "hll")
+	c.mustDo("1", "PFADD", "hll", "a", "b", "c")
+	c.mustDo("0", "PFADD", "hll", "a", "b", "c")
+	c.mustDo("3", "PFCOUNT", "hll")
+
+	pfaddRange(t, c, "big", "a", 20000)
+	checkCount(t, c, 20000, "big")
+	// 缓存的基数在新增元素后失效
+	pfaddRange(t, c, "big", "b", 10000)
+	checkCount(t, c, 30000, "big")
+	// 多个键时返回并集的近似基数
+	pfaddRange(t, c, "other", "a", 5000)
+	pfaddRange(t, c, "other", "c", 5000)
+	checkCount(t, c, 35000, "big", "other", "missing")
+}
+
+func TestHyperLogLogRejectsCorruptValues(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "str", "not a hll")
+	c.mustDo("(error) WRONGTYPE Key is not a valid HyperLogLog string value.", "PFADD", "str", "a")
+	c.mustDo("(error) WRONGTYPE Key is not a valid HyperLogLog string value.", "PFCOUNT", "str")
+	c.mustDo("1", "RPUSH", "l", "a")
+	c.mustDo("(error) WRONGTYPE Operation against a key holding the wrong kind of value", "PFCOUNT", "l")
+
+	pfaddRange(t, c, "hll", "a", 10)
+	buf := []byte(c.do("GET", "hll").Str)
+	// 稀疏编码的 VAL 操作码让寄存器超出范围
+	for i := hllHdrSize; i < len(buf); i++ {
+		buf[i] = 0xff
+	}
+	c.mustDo("OK", "SET", "bad", string(buf))
+	if got := replyString(c.do("PFCOUNT", "bad")); got[:7] != "(error)" {
+		t.Fatalf("PFCOUNT of a corrupt HyperLogLog returned %s", got)
+	}
+}
+
+func TestPFMerge(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	pfaddRange(t, c, "h1", "a", 3000)
+	pfaddRange(t, c, "h2", "b", 2000)
+	pfaddRange(t, c, "dst", "c", 1000)
+
+	// 目标键已存在时也参与合并
+	c.mustDo("OK", "PFMERGE", "dst", "h1", "h2", "missing")
+	checkCount(t, c, 6000, "dst")
+	c.mustDo("OK", "PFMERGE", "empty")
+	c.mustDo("0", "PFCOUNT", "empty")
+	c.mustDo("OK", "SET", "str", "x")
+	c.mustDo("(error) WRONGTYPE Key is not a valid HyperLogLog string value.", "PFMERGE", "dst", "str")
+}
+
+func TestHyperLogLogSparseToDense(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+
+	pfaddRange(t, c, "hll", "a", 100)
+	if enc := hllEncoding(t, c, "hll"); enc != hllSparse {
+		t.Fatalf("small HyperLogLog has encoding %d", enc)
+	}
+	checkCount(t, c, 100, "hll")
+
+	pfaddRange(t, c, "hll", "a", 20000)
+	if enc := hllEncoding(t, c, "hll"); enc != hllDense {
+		t.Fatalf("large HyperLogLog has encoding %d", enc)
+	}
+	checkCount(t, c, 20000, "hll")
+	// 重复的元素不改变寄存器
+	c.mustDo("0", "PFADD", "hll", "a1", "a2", "a3")
+}
+
+func TestHyperLogLogMergeEncodings(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	pfaddRange(t, c, "sparse", "s", 200)
+	pfaddRange(t, c, "dense", "d", 10000)
+
+	checkCount(t, c, 10200, "sparse", "dense")
+	c.mustDo("OK", "PFMERGE", "merged", "sparse", "dense")
+	if enc := hllEncoding(t, c, "merged"); enc != hllDense {
+		t.Fatalf("merged HyperLogLog has encoding %d", enc)
+	}
+	checkCount(t, c, 10200, "merged")
+
+	// 只合并稀疏编码的 HyperLogLog 时结果仍是稀疏编码
+	pfaddRange(t, c, "sparse2", "t", 200)
+	c.mustDo("OK", "PFMERGE", "small", "sparse", "sparse2")
+	if enc := hllEncoding(t, c, "small"); enc != hllSparse {
+		t.Fatalf("merge of sparse HyperLogLogs has encoding %d", enc)
+	}
+	checkCount(t, c, 400, "small")
+}
@@ -0,0 +1,231 @@
+package goredis
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// infoSection 是 INFO 输出中的一节，gen 生成这一节的字段
+type infoSection struct {
+	name  string
+	title string
+	gen   func(rs *RedisServer, b *strings.Builder)
+}
+
+// infoSections 按输出的顺序列出 INFO 的各节
+var infoSections = []infoSection{
+	{"server", "Server", (*RedisServer).genServerInfo},
+	{"persistence", "Persistence", (*RedisServer).genPersistenceInfo},
+	{"replication", "Replication", (*RedisServer).genReplicationInfo},
+	{"cluster", "Cluster", (*RedisServer).genClusterInfo},
+	{"keyspace", "Keyspace", (*RedisServer).genKeyspaceInfo},
+}
+
+// handleInfo 处理 INFO [section [section ...]] 命令，以 Redis 的格式返回服务器信息
+//
+// 没有参数或者参数为 default、all、everything 时返回所有的节；节名不区分大小写，未知的节名被忽略。
+func (rs *RedisServer) handleInfo(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	all := len(args) == 0
+	wanted := make(map[string]bool, len(args))
+	for _, arg := range args {
+		switch name := strings.ToLower(arg); name {
+		case "default", "all", "everything":
+			all = true
+		default:
+			wanted[name] = true
+		}
+	}
+
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !all && !wanted[section.name] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + section.title + "\r\n")
+		section.gen(rs, &b)
+	}
+	return NewBulkStringValue(b.String())
+}
+
+// infoField 追加一个 name:value 字段
+func infoField(b *strings.Builder, name string, value any) {
+	fmt.Fprintf(b, "%s:%v\r\n", name, value)
+}
+
+// infoStatus 返回状态字段的值：成功为 ok，失败为 err
+func infoStatus(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "err"
+}
+
+// infoFlag 返回标志字段的值：是为 1，否为 0
+func infoFlag(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// genServerInfo 生成 Server 节
+func (rs *RedisServer) genServerInfo(b *strings.Builder) {
+	infoField(b, "redis_version", redisVersion)
+}
+
+// genPersistenceInfo 生成 Persistence 节：RDB 保存和 AOF 的状态与统计
+//
+// 字段与 Redis 相同，没有 fork 子进程，因此不输出写时复制相关的字段。
+func (rs *RedisServer) genPersistenceInfo(b *strings.Builder) {
+	now := time.Now().Unix()
+	rs.mutex.RLock()
+	aofEnabled := rs.aofEnabled
+	rs.mutex.RUnlock()
+
+	bgsaveStart := rs.rdbBgsaveStart.Load()
+	currentBgsaveTime := int64(-1)
+	if bgsaveStart != 0 {
+		currentBgsaveTime = now - bgsaveStart
+	}
+	infoField(b, "loading", 0)
+	infoField(b, "rdb_changes_since_last_save", rs.dirty.Load()-rs.savedDirty.Load())
+	infoField(b, "rdb_bgsave_in_progress", infoFlag(bgsaveStart != 0))
+	infoField(b, "rdb_last_save_time", rs.lastSave.Load())
+	infoField(b, "rdb_last_bgsave_status", infoStatus(rs.lastBgsaveOK.Load()))
+	infoField(b, "rdb_last_bgsave_time_sec", rs.rdbLastBgsaveTime.Load())
+	infoField(b, "rdb_current_bgsave_time_sec", currentBgsaveTime)
+	infoField(b, "rdb_saves", rs.rdbSaves.Load())
+
+	rs.aofMu.Lock()
+	defer rs.aofMu.Unlock()
+	currentRewriteTime := int64(-1)
+	if rs.aofRewriting {
+		currentRewriteTime = now - rs.aofRewriteTry
+	}
+	infoField(b, "aof_enabled", infoFlag(aofEnabled))
+	infoField(b, "aof_rewrite_in_progress", infoFlag(rs.aofRewriting))
+	infoField(b, "aof_rewrite_scheduled", infoFlag(rs.aofRewriteScheduled.Load()))
+	infoField(b, "aof_last_rewrite_time_sec", rs.aofLastRewriteTime)
+	infoField(b, "aof_current_rewrite_time_sec", currentRewriteTime)
+	infoField(b, "aof_last_bgrewrite_status", infoStatus(rs.aofLastBgrewriteOK))
+	infoField(b, "aof_rewrites", rs.aofRewrites)
+	infoField(b, "aof_last_write_status", infoStatus(rs.aofLastWriteErr == nil))
+	if rs.aofFile != nil {
+		infoField(b, "aof_current_size", rs.aofCurrentSize)
+		infoField(b, "aof_base_size", rs.aofRewriteBaseSize)
+		infoField(b, "aof_pending_rewrite", infoFlag(rs.aofRewriteScheduled.Load()))
+		infoField(b, "aof_buffer_length", len(rs.aofBuf))
+	}
+}
+
+// genReplicationInfo 生成 Replication 节：角色，作为副本时主节点的地址、连接的状态、全量同步的进度、
+// 复制偏移量和副本的配置，连接到本节点的副本，故障转移的状态，以及复制 ID、复制偏移量和积压缓冲区
+func (rs *RedisServer) genReplicationInfo(b *strings.Builder) {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if rs.masterHost == "" {
+		infoField(b, "role", "master")
+	} else {
+		infoField(b, "role", "slave")
+		infoField(b, "master_host", rs.masterHost)
+		infoField(b, "master_port", rs.masterPort)
+		state, lastIO := REPL_STATE_CONNECT, int64(-1)
+		if link := rs.masterLink; link != nil {
+			state = link.state
+			if state == REPL_STATE_CONNECTED {
+				lastIO = int64(time.Since(link.lastIO).Seconds())
+			}
+		}
+		status := "down"
+		if state == REPL_STATE_CONNECTED {
+			status = "up"
+		}
+		infoField(b, "master_link_status", status)
+		infoField(b, "master_last_io_seconds_ago", lastIO)
+		infoField(b, "master_sync_in_progress", infoFlag(state == REPL_STATE_TRANSFER))
+		readOffset := rs.masterReplOffset
+		if state == REPL_STATE_CONNECTED {
+			readOffset += rs.masterLink.pending
+		}
+		infoField(b, "slave_read_repl_offset", readOffset)
+		infoField(b, "slave_repl_offset", rs.masterReplOffset)
+		if link := rs.masterLink; state == REPL_STATE_TRANSFER {
+			perc := 0.0
+			if link.transferSize > 0 {
+				perc = float64(link.transferRead) / float64(link.transferSize) * 100
+			}
+			infoField(b, "master_sync_total_bytes", link.transferSize)
+			infoField(b, "master_sync_read_bytes", link.transferRead)
+			infoField(b, "master_sync_left_bytes", link.transferSize-link.transferRead)
+			infoField(b, "master_sync_perc", fmt.Sprintf("%.2f", perc))
+			infoField(b, "master_sync_last_io_seconds_ago", int64(time.Since(link.transferLastIO).Seconds()))
+		}
+		if state != REPL_STATE_CONNECTED {
+			downSince := int64(-1)
+			if link := rs.masterLink; link != nil && !link.downSince.IsZero() {
+				downSince = int64(time.Since(link.downSince).Seconds())
+			}
+			infoField(b, "master_link_down_since_seconds", downSince)
+		}
+		infoField(b, "slave_priority", rs.replicaPriority)
+		infoField(b, "slave_read_only", infoFlag(rs.replicaReadOnly))
+		infoField(b, "replica_announced", infoFlag(rs.replicaAnnounced))
+	}
+
+	infoField(b, "connected_slaves", len(rs.replicas))
+	for i, c := range rs.replicas {
+		host, port := replicaAddr(c)
+		infoField(b, fmt.Sprintf("slave%d", i), fmt.Sprintf("ip=%s,port=%d,state=%s,offset=%d,lag=%d",
+			host, port, slaveStateNames[c.replState], c.replAckOff, int64(time.Since(c.replAckTime).Seconds())))
+	}
+
+	failoverState := 0
+	if rs.failover != nil {
+		failoverState = rs.failover.state
+	}
+	infoField(b, "master_failover_state", failoverStateNames[failoverState])
+
+	replid2 := rs.replid2
+	if replid2 == "" {
+		replid2 = strings.Repeat("0", 40)
+	}
+	infoField(b, "master_replid", rs.replid)
+	infoField(b, "master_replid2", replid2)
+	infoField(b, "master_repl_offset", rs.masterReplOffset)
+	infoField(b, "second_repl_offset", rs.secondReplidOffset)
+	backlogOffset, backlogHistlen := int64(0), 0
+	if rs.replBacklog != nil {
+		backlogOffset, backlogHistlen = rs.replBacklog.offset, rs.replBacklog.histlen
+	}
+	infoField(b, "repl_backlog_active", infoFlag(rs.replBacklog != nil))
+	infoField(b, "repl_backlog_size", rs.replBacklogSize)
+	infoField(b, "repl_backlog_first_byte_offset", backlogOffset)
+	infoField(b, "repl_backlog_histlen", backlogHistlen)
+}
+
+// genClusterInfo 生成 Cluster 节：是否开启了集群模式
+func (rs *RedisServer) genClusterInfo(b *strings.Builder) {
+	infoField(b, "cluster_enabled", infoFlag(rs.clusterEnabled))
+}
+
+// genKeyspaceInfo 生成 Keyspace 节：每个非空数据库的键数和有过期时间的键数
+//
+// 与 Redis 的格式相同，例如 db0:keys=1,expires=0,avg_ttl=0；没有统计平均生存时间，avg_ttl 总是 0。
+func (rs *RedisServer) genKeyspaceInfo(b *strings.Builder) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	for _, db := range rs.databases {
+		if db.store.Len() == 0 {
+			continue
+		}
+		infoField(b, fmt.Sprintf("db%d", db.id), fmt.Sprintf("keys=%d,expires=%d,avg_ttl=0", db.store.Len(), db.store.ExpiresLen()))
+	}
+}
@@ -0,0 +1,143 @@
+package goredis
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// infoValue 返回 INFO 输出中字段 name 的值，字段不存在时测试失败
+func infoValue(t *testing.T, info, name string) string {
+	t.Helper()
+	for _, line := range strings.Split(info, "\r\n") {
+		if value, ok := strings.CutPrefix(line, name+":"); ok {
+			return value
+		}
+	}
+	t.Fatalf("INFO has no field %s:\n%s", name, info)
+	return ""
+}
+
+func TestInfoSections(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	all := c.do("INFO").Str
+	if !strings.HasPrefix(all, "# Server\r\n") || !strings.Contains(all, "\r\n\r\n# Persistence\r\n") {
+		t.Fatalf("INFO returned %q", all)
+	}
+	if got := c.do("INFO", "everything").Str; !strings.HasPrefix(got, "# Server\r\n") || !strings.Contains(got, "# Persistence\r\n") {
+		t.Fatalf("INFO everything returned %q", got)
+	}
+	// 节名不区分大小写，未知的节被忽略
+	persistence := c.do("INFO", "PERSISTENCE", "nosuchsection").Str
+	if !strings.HasPrefix(persistence, "# Persistence\r\n") || strings.Contains(persistence, "# Server") {
+		t.Fatalf("INFO persistence returned %q", persistence)
+	}
+	c.mustDo("", "INFO", "nosuchsection")
+}
+
+func TestInfoPersistence(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "a", "1")
+	c.mustDo("2", "RPUSH", "l", "x", "y")
+	info := c.do("INFO", "persistence").Str
+	if v := infoValue(t, info, "rdb_changes_since_last_save"); v != "2" {
+		t.Fatalf("rdb_changes_since_last_save:%s", v)
+	}
+	if v := infoValue(t, info, "aof_enabled"); v != "0" {
+		t.Fatalf("aof_enabled:%s", v)
+	}
+
+	c.mustDo("OK", "SAVE")
+	c.mustDo("Background saving started", "BGSAVE")
+	waitFor(t, "BGSAVE to finish", func() bool {
+		return infoValue(t, c.do("INFO", "persistence").Str, "rdb_bgsave_in_progress") == "0"
+	})
+	info = c.do("INFO", "persistence").Str
+	for name, want := range map[string]string{
+		"rdb_changes_since_last_save": "0",
+		"rdb_last_bgsave_status":      "ok",
+		"rdb_current_bgsave_time_sec": "-1",
+		"rdb_saves":                   "2",
+	} {
+		if v := infoValue(t, info, name); v != want {
+			t.Errorf("%s:%s, want %s", name, v, want)
+		}
+	}
+
+	c.mustDo("OK", "CONFIG", "SET", "appendonly", "yes")
+	waitFor(t, "AOF rewrite to finish", func() bool { return !ts.rs.aofRewriteInProgress() })
+	info = c.do("INFO", "persistence").Str
+	for name, want := range map[string]string{
+		"aof_enabled":               "1",
+		"aof_rewrite_in_progress":   "0",
+		"aof_rewrites":              "1",
+		"aof_last_bgrewrite_status": "ok",
+		"aof_last_write_status":     "ok",
+		"aof_buffer_length":         "0",
+	} {
+		if v := infoValue(t, info, name); v != want {
+			t.Errorf("%s:%s, want %s", name, v, want)
+		}
+	}
+	if v := infoValue(t, info, "aof_current_size"); v == "0" {
+		t.Errorf("aof_current_size:%s", v)
+	}
+}
+
+func TestLastSave(t *testing.T) {
+	start := time.Now().Unix()
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	// 没有保存过时是服务器启动的时间
+	first := c.do("LASTSAVE").Num
+	if first < start || first > time.Now().Unix() {
+		t.Fatalf("LASTSAVE %d before any save, server started at %d", first, start)
+	}
+	ts.rs.lastSave.Store(first - 100)
+	c.mustDo("OK", "SAVE")
+	if got := c.do("LASTSAVE").Num; got < first {
+		t.Fatalf("LASTSAVE %d after SAVE", got)
+	}
+	c.mustDo(strconv.FormatInt(ts.rs.lastSave.Load(), 10), "LASTSAVE")
+}
+
+func TestInfoReplication(t *testing.T) {
+	master := startTestServer(t)
+	replica := startReplica(t, master, "replica-priority 50")
+	c := master.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("1", "WAIT", "1", "0")
+
+	info := replica.connect(t).do("INFO", "replication").Str
+	for field, want := range map[string]string{
+		"role":                    "slave",
+		"master_link_status":      "up",
+		"master_sync_in_progress": "0",
+		"slave_priority":          "50",
+		"slave_read_only":         "1",
+		"replica_announced":       "1",
+		"slave_repl_offset":       infoValue(t, c.do("INFO", "replication").Str, "master_repl_offset"),
+	} {
+		if got := infoValue(t, info, field); got != want {
+			t.Errorf("%s:%s, want %s", field, got, want)
+		}
+	}
+	if strings.Contains(info, "master_link_down_since_seconds") || strings.Contains(info, "master_sync_total_bytes") {
+		t.Errorf("INFO replication of a connected replica:\n%s", info)
+	}
+
+	r := replica.connect(t)
+	r.mustDo("OK", "CONFIG", "SET", "slave-priority", "0")
+	r.mustDo("[replica-priority 0]", "CONFIG", "GET", "replica-priority")
+	r.mustDo("OK", "CONFIG", "SET", "replica-announced", "no")
+	info = r.do("INFO", "replication").Str
+	if infoValue(t, info, "slave_priority") != "0" || infoValue(t, info, "replica_announced") != "0" {
+		t.Errorf("INFO replication after CONFIG SET:\n%s", info)
+	}
+	if v := r.do("CONFIG", "SET", "replica-priority", "-1"); v.Type != RESP_ERROR {
+		t.Fatalf("negative priority accepted: %s", replyString(v))
+	}
+}
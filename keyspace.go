@@ -0,0 +1,124 @@
+package goredis
+
+// keyspaceEntry 是键空间中的一个键值对
+type keyspaceEntry struct {
+	key string
+	obj *RedisObject
+}
+
+// keyspace 保存一个数据库的所有键
+//
+// 与集合的哈希表编码一样，键值对紧凑地存放在 entries 中，index 记录每个键的下标，
+// 删除时把末尾的键值对移到空出的位置。元素只会从末尾向前移动，因此从高下标向低下标
+// 扫描的游标可以保证：整个扫描期间一直存在的键至少被返回一次，且扫描过程中不需要持有锁。
+//
+// 与 Redis 的 db->expires 一样，设置了过期时间的键另外记录在 expires 中，值是过期的
+// Unix 时间（毫秒）。删除键或者整体替换键的值时过期时间随之清除。
+type keyspace struct {
+	index   map[string]int
+	entries []keyspaceEntry
+	expires map[string]int64
+}
+
+// newKeyspace 创建空的键空间
+func newKeyspace() *keyspace {
+	return &keyspace{index: make(map[string]int), expires: make(map[string]int64)}
+}
+
+// Len 返回键的数量
+func (ks *keyspace) Len() int {
+	return len(ks.entries)
+}
+
+// Get 返回键对应的对象，不存在时返回 nil
+func (ks *keyspace) Get(key string) *RedisObject {
+	i, ok := ks.index[key]
+	if !ok {
+		return nil
+	}
+	return ks.entries[i].obj
+}
+
+// Set 设置键对应的对象，键已存在时整体替换，原来的过期时间被清除
+func (ks *keyspace) Set(key string, obj *RedisObject) {
+	delete(ks.expires, key)
+	if i, ok := ks.index[key]; ok {
+		ks.entries[i].obj = obj
+		return
+	}
+	ks.index[key] = len(ks.entries)
+	ks.entries = append(ks.entries, keyspaceEntry{key, obj})
+}
+
+// Delete 删除键，返回键是否存在
+func (ks *keyspace) Delete(key string) bool {
+	i, ok := ks.index[key]
+	if !ok {
+		return false
+	}
+	last := len(ks.entries) - 1
+	if i != last {
+		ks.entries[i] = ks.entries[last]
+		ks.index[ks.entries[i].key] = i
+	}
+	ks.entries[last] = keyspaceEntry{}
+	ks.entries = ks.entries[:last]
+	delete(ks.index, key)
+	delete(ks.expires, key)
+	return true
+}
+
+// GetExpire 返回键的过期时间（Unix 毫秒），没有过期时间时返回 -1
+func (ks *keyspace) GetExpire(key string) int64 {
+	if when, ok := ks.expires[key]; ok {
+		return when
+	}
+	return -1
+}
+
+// SetExpire 设置已存在的键的过期时间（Unix 毫秒）
+func (ks *keyspace) SetExpire(key string, when int64) {
+	if _, ok := ks.index[key]; ok {
+		ks.expires[key] = when
+	}
+}
+
+// Persist 清除键的过期时间，返回键原来是否有过期时间
+func (ks *keyspace) Persist(key string) bool {
+	if _, ok := ks.expires[key]; !ok {
+		return false
+	}
+	delete(ks.expires, key)
+	return true
+}
+
+// ExpiresLen 返回设置了过期时间的键的数量
+func (ks *keyspace) ExpiresLen() int {
+	return len(ks.expires)
+}
+
+// ForEach 遍历所有键值对，遍历期间不能修改键空间
+func (ks *keyspace) ForEach(fn func(key string, obj *RedisObject)) {
+	for _, entry := range ks.entries {
+		fn(entry.key, entry.obj)
+	}
+}
+
+// Scan 从游标处开始访问至多 count 个键值对，返回下一次的游标，0 表示扫描结束
+//
+// 游标是下一个要访问的下标加一，从高下标向低下标扫描，原因见 keyspace 的说明。
+func (ks *keyspace) Scan(cursor uint64, count int) (uint64, []keyspaceEntry) {
+	next := len(ks.entries) - 1
+	if cursor > 0 && cursor-1 < uint64(next) {
+		next = int(cursor - 1)
+	}
+
+	result := make([]keyspaceEntry, 0, count)
+	for ; next >= 0 && len(result) < count; next-- {
+		result = append(result, ks.entries[next])
+	}
+	if next < 0 {
+		return 0, result
+	}
+	return uint64(next + 1), result
+}
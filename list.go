@@ -0,0 +1,225 @@
+package goredis
+
+// 每个节点最多容纳的元素数量
+const listNodeSize = 128
+
+// listNode 是列表中的一个数据块，元素按顺序存放在 items 中
+type listNode struct {
+	prev  *listNode
+	next  *listNode
+	items []string
+}
+
+// List 表示列表类型的值
+//
+// 与 Redis 的 quicklist 类似，列表由双向链接的数据块组成，每块最多
+// listNodeSize 个元素。两端的插入和弹出只会触及首尾数据块，移动的元素
+// 数量有上限，因此即使列表有数百万个元素，LPUSH/LPOP/LTRIM 也是均摊 O(1)。
+type List struct {
+	head   *listNode
+	tail   *listNode
+	length int
+}
+
+// NewList 创建空列表
+func NewList() *List {
+	return &List{}
+}
+
+// Len 返回列表长度
+func (l *List) Len() int {
+	return l.length
+}
+
+// PushLeft 在列表头部插入元素
+func (l *List) PushLeft(value string) {
+	if l.head == nil || len(l.head.items) >= listNodeSize {
+		node := &listNode{items: make([]string, 0, 8), next: l.head}
+		if l.head != nil {
+			l.head.prev = node
+		} else {
+			l.tail = node
+		}
+		l.head = node
+	}
+
+	items := append(l.head.items, "")
+	copy(items[1:], items)
+	items[0] = value
+	l.head.items = items
+	l.length++
+}
+
+// PushRight 在列表尾部插入元素
+func (l *List) PushRight(value string) {
+	if l.tail == nil || len(l.tail.items) >= listNodeSize {
+		node := &listNode{items: make([]string, 0, 8), prev: l.tail}
+		if l.tail != nil {
+			l.tail.next = node
+		} else {
+			l.head = node
+		}
+		l.tail = node
+	}
+
+	l.tail.items = append(l.tail.items, value)
+	l.length++
+}
+
+// PopLeft 弹出列表头部元素
+func (l *List) PopLeft() (string, bool) {
+	if l.head == nil {
+		return "", false
+	}
+	value := l.head.items[0]
+	l.head.items[0] = ""
+	l.head.items = l.head.items[1:]
+	l.length--
+	if len(l.head.items) == 0 {
+		l.unlinkNode(l.head)
+	}
+	return value, true
+}
+
+// PopRight 弹出列表尾部元素
+func (l *List) PopRight() (string, bool) {
+	if l.tail == nil {
+		return "", false
+	}
+	last := len(l.tail.items) - 1
+	value := l.tail.items[last]
+	l.tail.items[last] = ""
+	l.tail.items = l.tail.items[:last]
+	l.length--
+	if len(l.tail.items) == 0 {
+		l.unlinkNode(l.tail)
+	}
+	return value, true
+}
+
+// unlinkNode 从链表中摘除节点
+func (l *List) unlinkNode(node *listNode) {
+	if node.prev != nil {
+		node.prev.next = node.next
+	} else {
+		l.head = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		l.tail = node.prev
+	}
+	node.prev, node.next = nil, nil
+}
+
+// locate 返回第 index 个元素所在的数据块及其在块中的下标，index 需在 [0, Len()) 内
+//
+// 与 quicklist 一样按整块跳过，index 在后半部分时从尾部向前查找，访问列表尾部附近的元素
+// 不必从头遍历整个列表。
+func (l *List) locate(index int) (*listNode, int) {
+	if index < l.length/2 {
+		node := l.head
+		for index >= len(node.items) {
+			index -= len(node.items)
+			node = node.next
+		}
+		return node, index
+	}
+	node, back := l.tail, l.length-1-index
+	for back >= len(node.items) {
+		back -= len(node.items)
+		node = node.prev
+	}
+	return node, len(node.items) - 1 - back
+}
+
+// Range 返回 [start, stop] 闭区间内的元素，索引需已归一化
+func (l *List) Range(start, stop int) []string {
+	want := stop - start + 1
+	if want <= 0 || start >= l.length {
+		return []string{}
+	}
+	result := make([]string, 0, want)
+
+	node, offset := l.locate(start)
+	for ; node != nil && len(result) < want; node = node.next {
+		items := node.items[offset:]
+		if len(items) > want-len(result) {
+			items = items[:want-len(result)]
+		}
+		result = append(result, items...)
+		offset = 0
+	}
+	return result
+}
+
+// Trim 只保留 [start, stop] 闭区间内的元素，索引需已归一化；start > stop 时清空列表
+func (l *List) Trim(start, stop int) {
+	if start > stop || start >= l.length {
+		l.head, l.tail, l.length = nil, nil, 0
+		return
+	}
+	l.removeLeft(start)
+	l.removeRight(l.length - (stop - start + 1))
+}
+
+// removeLeft 从头部删除 n 个元素，整块删除时无需移动元素
+func (l *List) removeLeft(n int) {
+	for n > 0 && l.head != nil {
+		node := l.head
+		if len(node.items) <= n {
+			n -= len(node.items)
+			l.length -= len(node.items)
+			l.unlinkNode(node)
+			continue
+		}
+		clear(node.items[:n])
+		node.items = node.items[n:]
+		l.length -= n
+		return
+	}
+}
+
+// removeRight 从尾部删除 n 个元素，整块删除时无需移动元素
+func (l *List) removeRight(n int) {
+	for n > 0 && l.tail != nil {
+		node := l.tail
+		if len(node.items) <= n {
+			n -= len(node.items)
+			l.length -= len(node.items)
+			l.unlinkNode(node)
+			continue
+		}
+		keep := len(node.items) - n
+		clear(node.items[keep:])
+		node.items = node.items[:keep]
+		l.length -= n
+		return
+	}
+}
+
+// Iterate 从头（或从尾，reverse 为 true 时）遍历列表，fn 返回 false 时停止
+func (l *List) Iterate(reverse bool, fn func(index int, value string) bool) {
+	if reverse {
+		index := l.length - 1
+		for node := l.tail; node != nil; node = node.prev {
+			for i := len(node.items) - 1; i >= 0; i-- {
+				if !fn(index, node.items[i]) {
+					return
+				}
+				index--
+			}
+		}
+		return
+	}
+
+	index := 0
+	for node := l.head; node != nil; node = node.next {
+		for _, value := range node.items {
+			if !fn(index, value) {
+				return
+			}
+			index++
+		}
+	}
+}
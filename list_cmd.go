@@ -0,0 +1,654 @@
+package goredis
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 列表方向
+const (
+	LIST_HEAD = iota
+	LIST_TAIL
+)
+
+// parseListWhere 解析 LEFT/RIGHT 方向参数
+func parseListWhere(arg string) (int, bool) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return LIST_HEAD, true
+	case "RIGHT":
+		return LIST_TAIL, true
+	}
+	return 0, false
+}
+
+// listWhereName 返回方向对应的 LEFT/RIGHT 参数
+func listWhereName(where int) string {
+	if where == LIST_HEAD {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+// parseTimeout 解析阻塞命令的超时参数（秒，可为小数），0 表示永久阻塞
+func parseTimeout(arg string) (time.Duration, *RESPValue) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, NewErrorValue("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, NewErrorValue("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// listPush 向列表推入元素，必要时创建列表并返回（调用方需持有锁）
+func (rs *RedisServer) listPush(c *client, key string, list *List, where int, value string) *List {
+	if list == nil {
+		obj := NewListObject()
+		c.db.store.Set(key, obj)
+		list = obj.Value.(*List)
+	}
+	if where == LIST_HEAD {
+		list.PushLeft(value)
+	} else {
+		list.PushRight(value)
+	}
+	rs.signalKeyAsReady(c.db, key)
+	return list
+}
+
+// listPop 从列表弹出元素
+//
+// 弹出后不会删除空列表，调用方弹出完成后需调用 listPopped 发出通知并删除空列表，
+// 这样一条命令弹出多个元素时只产生一次通知，且 del 事件在弹出事件之后。
+func listPop(list *List, where int) (string, bool) {
+	if where == LIST_HEAD {
+		return list.PopLeft()
+	}
+	return list.PopRight()
+}
+
+// listPopped 在从列表弹出元素后发出通知，列表为空时删除键（调用方需持有写锁）
+func (rs *RedisServer) listPopped(c *client, key string, list *List, where int) {
+	event := "rpop"
+	if where == LIST_HEAD {
+		event = "lpop"
+	}
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_LIST, event, key, c.db.id)
+	if list.Len() == 0 {
+		c.db.store.Delete(key)
+		rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+	}
+}
+
+// listPushed 在向列表推入元素后发出通知（调用方需持有写锁）
+func (rs *RedisServer) listPushed(c *client, key string, where int) {
+	event := "rpush"
+	if where == LIST_HEAD {
+		event = "lpush"
+	}
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_LIST, event, key, c.db.id)
+}
+
+// handlePush 处理 LPUSH/RPUSH/LPUSHX/RPUSHX 命令，existing 为 true 时仅在列表已存在时推入
+func (rs *RedisServer) handlePush(c *client, command *RESPValue, name string, where int, existing bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError(name)
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	list, errResp := c.db.lookupListWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if list == nil && existing {
+		return NewIntegerValue(0)
+	}
+	for _, value := range args[1:] {
+		list = rs.listPush(c, key, list, where, value)
+	}
+	rs.listPushed(c, key, where)
+	return NewIntegerValue(int64(list.Len()))
+}
+
+// handlePop 处理 LPOP/RPOP 命令
+func (rs *RedisServer) handlePop(c *client, command *RESPValue, name string, where int) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return wrongArgsError(name)
+	}
+
+	count := -1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return NewErrorValue("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	list, errResp := c.db.lookupListWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if list == nil {
+		if count >= 0 {
+			return NewNullArrayValue()
+		}
+		return NewNullBulkStringValue()
+	}
+
+	if count < 0 {
+		value, _ := listPop(list, where)
+		rs.listPopped(c, key, list, where)
+		return NewBulkStringValue(value)
+	}
+
+	elems := make([]*RESPValue, 0, count)
+	for i := 0; i < count && list.Len() > 0; i++ {
+		value, _ := listPop(list, where)
+		elems = append(elems, NewBulkStringValue(value))
+	}
+	if len(elems) > 0 {
+		rs.listPopped(c, key, list, where)
+	}
+	return NewArrayValue(elems)
+}
+
+// handleLLen 处理 LLEN 命令
+func (rs *RedisServer) handleLLen(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 {
+		return wrongArgsError("llen")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	list, errResp := c.db.lookupList(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if list == nil {
+		return NewIntegerValue(0)
+	}
+	return NewIntegerValue(int64(list.Len()))
+}
+
+// handleLRange 处理 LRANGE 命令
+func (rs *RedisServer) handleLRange(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 {
+		return wrongArgsError("lrange")
+	}
+
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return NewErrorValue("ERR value is not an integer or out of range")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	list, errResp := c.db.lookupList(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if list == nil {
+		return NewArrayValue([]*RESPValue{})
+	}
+
+	// 归一化负索引
+	length := list.Len()
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return NewArrayValue([]*RESPValue{})
+	}
+
+	items := list.Range(start, stop)
+	elems := make([]*RESPValue, len(items))
+	for i, item := range items {
+		elems[i] = NewBulkStringValue(item)
+	}
+	return NewArrayValue(elems)
+}
+
+// handleLTrim 处理 LTRIM 命令
+func (rs *RedisServer) handleLTrim(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 {
+		return wrongArgsError("ltrim")
+	}
+
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return NewErrorValue("ERR value is not an integer or out of range")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	key := args[0]
+	list, errResp := c.db.lookupListWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if list == nil {
+		return NewSimpleStringValue("OK")
+	}
+
+	// 归一化负索引
+	length := list.Len()
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+
+	list.Trim(start, stop)
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_LIST, "ltrim", key, c.db.id)
+	if list.Len() == 0 {
+		c.db.store.Delete(key)
+		rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+	}
+	return NewSimpleStringValue("OK")
+}
+
+// listMove 执行 LMOVE 的核心逻辑，源列表为空时返回 nil（调用方需持有写锁）
+func (rs *RedisServer) listMove(c *client, source, destination string, from, to int) *RESPValue {
+	srcList, errResp := c.db.lookupListWrite(source)
+	if errResp != nil {
+		return errResp
+	}
+	if srcList == nil {
+		return nil
+	}
+
+	// 弹出前检查目标类型，避免元素丢失
+	dstList, errResp := c.db.lookupListWrite(destination)
+	if errResp != nil {
+		return errResp
+	}
+
+	// 先推入再处理源列表，源和目标是同一个列表时不会因为暂时为空而被删除
+	value, _ := listPop(srcList, from)
+	rs.listPush(c, destination, dstList, to, value)
+	rs.listPushed(c, destination, to)
+	rs.listPopped(c, source, srcList, from)
+	return NewBulkStringValue(value)
+}
+
+// handleLMove 处理 LMOVE 命令
+func (rs *RedisServer) handleLMove(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 4 {
+		return wrongArgsError("lmove")
+	}
+
+	from, ok1 := parseListWhere(args[2])
+	to, ok2 := parseListWhere(args[3])
+	if !ok1 || !ok2 {
+		return NewErrorValue("ERR syntax error")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	resp := rs.listMove(c, args[0], args[1], from, to)
+	if resp == nil {
+		return NewNullBulkStringValue()
+	}
+	return resp
+}
+
+// handleRPopLPush 处理 RPOPLPUSH 命令
+func (rs *RedisServer) handleRPopLPush(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("rpoplpush")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	resp := rs.listMove(c, args[0], args[1], LIST_TAIL, LIST_HEAD)
+	if resp == nil {
+		return NewNullBulkStringValue()
+	}
+	return resp
+}
+
+// handleBLMove 处理 BLMOVE 命令
+func (rs *RedisServer) handleBLMove(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 5 {
+		return wrongArgsError("blmove")
+	}
+
+	from, ok1 := parseListWhere(args[2])
+	to, ok2 := parseListWhere(args[3])
+	if !ok1 || !ok2 {
+		return NewErrorValue("ERR syntax error")
+	}
+
+	timeout, errResp := parseTimeout(args[4])
+	if errResp != nil {
+		return errResp
+	}
+
+	// 被服务时按 LMOVE 传播，重放时不会阻塞
+	c.rewriteArgv("LMOVE", args[0], args[1], args[2], args[3])
+	return rs.blockForKeys(c, args[:1], timeout, func() *RESPValue {
+		return rs.listMove(c, args[0], args[1], from, to)
+	})
+}
+
+// handleBRPopLPush 处理 BRPOPLPUSH 命令
+func (rs *RedisServer) handleBRPopLPush(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 {
+		return wrongArgsError("brpoplpush")
+	}
+
+	timeout, errResp := parseTimeout(args[2])
+	if errResp != nil {
+		return errResp
+	}
+
+	c.rewriteArgv("RPOPLPUSH", args[0], args[1])
+	return rs.blockForKeys(c, args[:1], timeout, func() *RESPValue {
+		return rs.listMove(c, args[0], args[1], LIST_TAIL, LIST_HEAD)
+	})
+}
+
+// parseMPopArgs 解析 LMPOP/BLMPOP 的 numkeys key [key ...] LEFT|RIGHT [COUNT count] 部分
+func parseMPopArgs(args []string) (keys []string, where int, count int, errResp *RESPValue) {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys <= 0 {
+		return nil, 0, 0, NewErrorValue("ERR numkeys should be greater than 0")
+	}
+	if len(args) < numKeys+2 {
+		return nil, 0, 0, NewErrorValue("ERR syntax error")
+	}
+	keys = args[1 : numKeys+1]
+
+	where, ok := parseListWhere(args[numKeys+1])
+	if !ok {
+		return nil, 0, 0, NewErrorValue("ERR syntax error")
+	}
+
+	count = 1
+	rest := args[numKeys+2:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToUpper(rest[0]) != "COUNT" {
+			return nil, 0, 0, NewErrorValue("ERR syntax error")
+		}
+		count, err = strconv.Atoi(rest[1])
+		if err != nil || count <= 0 {
+			return nil, 0, 0, NewErrorValue("ERR count should be greater than 0")
+		}
+	}
+	return keys, where, count, nil
+}
+
+// listMPop 从第一个非空列表弹出最多 count 个元素，全部为空时返回 nil（调用方需持有写锁）
+func (rs *RedisServer) listMPop(c *client, keys []string, where int, count int) *RESPValue {
+	for _, key := range keys {
+		list, errResp := c.db.lookupListWrite(key)
+		if errResp != nil {
+			return errResp
+		}
+		if list == nil {
+			continue
+		}
+
+		elems := make([]*RESPValue, 0, count)
+		for i := 0; i < count && list.Len() > 0; i++ {
+			value, _ := listPop(list, where)
+			elems = append(elems, NewBulkStringValue(value))
+		}
+		rs.listPopped(c, key, list, where)
+		return NewArrayValue([]*RESPValue{NewBulkStringValue(key), NewArrayValue(elems)})
+	}
+	return nil
+}
+
+// handleLMPop 处理 LMPOP 命令
+func (rs *RedisServer) handleLMPop(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 {
+		return wrongArgsError("lmpop")
+	}
+
+	keys, where, count, errResp := parseMPopArgs(args)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	resp := rs.listMPop(c, keys, where, count)
+	if resp == nil {
+		return NewNullArrayValue()
+	}
+	return resp
+}
+
+// handleBLMPop 处理 BLMPOP 命令
+func (rs *RedisServer) handleBLMPop(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 4 {
+		return wrongArgsError("blmpop")
+	}
+
+	timeout, errResp := parseTimeout(args[0])
+	if errResp != nil {
+		return errResp
+	}
+
+	keys, where, count, errResp := parseMPopArgs(args[1:])
+	if errResp != nil {
+		return errResp
+	}
+
+	return rs.blockForKeys(c, keys, timeout, func() *RESPValue {
+		resp := rs.listMPop(c, keys, where, count)
+		if resp != nil && resp.Type == RESP_ARRAY {
+			// 按 LMPOP 传播实际弹出元素的键
+			c.rewriteArgv("LMPOP", "1", resp.Array[0].Str, listWhereName(where), "COUNT", strconv.Itoa(count))
+		}
+		return resp
+	})
+}
+
+// handleLPos 处理 LPOS 命令
+func (rs *RedisServer) handleLPos(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("lpos")
+	}
+
+	rank, count, maxLen := 1, -1, 0
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return NewErrorValue("ERR syntax error")
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		switch strings.ToUpper(args[i]) {
+		case "RANK":
+			if n == 0 {
+				return NewErrorValue("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return NewErrorValue("ERR COUNT can't be negative")
+			}
+			count = n
+		case "MAXLEN":
+			if n < 0 {
+				return NewErrorValue("ERR MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return NewErrorValue("ERR syntax error")
+		}
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	list, errResp := c.db.lookupList(args[0])
+	if errResp != nil {
+		return errResp
+	}
+
+	// 负的 RANK 表示从尾部开始查找
+	reverse := rank < 0
+	if reverse {
+		rank = -rank
+	}
+
+	var matches []*RESPValue
+	if list != nil {
+		element := args[1]
+		compared := 0
+		list.Iterate(reverse, func(index int, value string) bool {
+			if maxLen > 0 && compared >= maxLen {
+				return false
+			}
+			compared++
+			if value != element {
+				return true
+			}
+			if rank > 1 {
+				rank--
+				return true
+			}
+			matches = append(matches, NewIntegerValue(int64(index)))
+			// COUNT 0 表示返回所有匹配项
+			return count == 0 || len(matches) < count
+		})
+	}
+
+	if count >= 0 {
+		if matches == nil {
+			matches = []*RESPValue{}
+		}
+		return NewArrayValue(matches)
+	}
+	if len(matches) == 0 {
+		return NewNullBulkStringValue()
+	}
+	return matches[0]
+}
+
+// handleBPop 处理 BLPOP/BRPOP 命令
+func (rs *RedisServer) handleBPop(c *client, command *RESPValue, name string, where int) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError(name)
+	}
+
+	timeout, errResp := parseTimeout(args[len(args)-1])
+	if errResp != nil {
+		return errResp
+	}
+
+	keys := args[:len(args)-1]
+	return rs.blockForKeys(c, keys, timeout, func() *RESPValue {
+		for _, key := range keys {
+			list, errResp := c.db.lookupListWrite(key)
+			if errResp != nil {
+				return errResp
+			}
+			if list == nil {
+				continue
+			}
+			value, _ := listPop(list, where)
+			rs.listPopped(c, key, list, where)
+			// 按 LPOP/RPOP 传播实际弹出元素的键
+			c.rewriteArgv(strings.ToUpper(name[1:]), key)
+			return NewArrayValue([]*RESPValue{NewBulkStringValue(key), NewBulkStringValue(value)})
+		}
+		return nil
+	})
+}
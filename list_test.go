@@ -0,0 +1,257 @@
+package goredis
+
+import (
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLMove(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("3", "RPUSH", "src", "a", "b", "c")
+	c.mustDo("a", "LMOVE", "src", "dst", "LEFT", "RIGHT")
+	c.mustDo("c", "LMOVE", "src", "dst", "RIGHT", "LEFT")
+	c.mustDo("[c a]", "LRANGE", "dst", "0", "-1")
+	c.mustDo("b", "RPOPLPUSH", "src", "dst")
+	c.mustDo("[b c a]", "LRANGE", "dst", "0", "-1")
+	c.mustDo("(nil)", "LMOVE", "src", "dst", "LEFT", "LEFT")
+
+	// 源和目标相同时旋转列表
+	c.mustDo("b", "LMOVE", "dst", "dst", "LEFT", "RIGHT")
+	c.mustDo("[c a b]", "LRANGE", "dst", "0", "-1")
+
+	c.mustDo("(error) ERR syntax error", "LMOVE", "dst", "x", "UP", "LEFT")
+	c.mustDo("OK", "SET", "str", "v")
+	c.mustDo("(error) WRONGTYPE Operation against a key holding the wrong kind of value", "LMOVE", "dst", "str", "LEFT", "LEFT")
+	c.mustDo("[c a b]", "LRANGE", "dst", "0", "-1")
+}
+
+func TestBLMoveWakesUpOnPush(t *testing.T) {
+	ts := startTestServer(t)
+	blocked, writer := ts.connect(t), ts.connect(t)
+
+	blocked.send("BLMOVE", "src", "dst", "RIGHT", "LEFT", "0")
+	waitFor(t, "client to block", func() bool { return ts.blockedOn("src") == 1 })
+	writer.mustDo("1", "LPUSH", "src", "x")
+	if got := replyString(blocked.read()); got != "x" {
+		t.Fatalf("BLMOVE got %s", got)
+	}
+	writer.mustDo("[x]", "LRANGE", "dst", "0", "-1")
+	writer.mustDo("0", "LLEN", "src")
+
+	blocked.send("BRPOPLPUSH", "src", "dst", "0")
+	waitFor(t, "client to block", func() bool { return ts.blockedOn("src") == 1 })
+	writer.mustDo("2", "RPUSH", "src", "y", "z")
+	if got := replyString(blocked.read()); got != "z" {
+		t.Fatalf("BRPOPLPUSH got %s", got)
+	}
+	writer.mustDo("[z x]", "LRANGE", "dst", "0", "-1")
+}
+
+func TestBLMoveTimeout(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	start := time.Now()
+	c.mustDo("(nil)", "BLMOVE", "src", "dst", "LEFT", "LEFT", "0.1")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("BLMOVE returned after %v", elapsed)
+	}
+	if n := ts.blockedOn("src"); n != 0 {
+		t.Fatalf("%d clients still waiting after timeout", n)
+	}
+	c.mustDo("(error) ERR timeout is negative", "BRPOPLPUSH", "src", "dst", "-1")
+}
+
+func TestLMPop(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(nil)", "LMPOP", "2", "a", "b", "LEFT")
+	c.mustDo("3", "RPUSH", "b", "1", "2", "3")
+	// 从第一个非空的列表中弹出
+	c.mustDo("[b [1]]", "LMPOP", "2", "a", "b", "LEFT")
+	c.mustDo("[b [3 2]]", "LMPOP", "2", "a", "b", "RIGHT", "COUNT", "5")
+	c.mustDo("0", "LLEN", "b")
+
+	c.mustDo("(error) ERR numkeys should be greater than 0", "LMPOP", "0", "a", "LEFT")
+	c.mustDo("(error) ERR count should be greater than 0", "LMPOP", "1", "a", "LEFT", "COUNT", "0")
+	c.mustDo("(error) ERR syntax error", "LMPOP", "1", "a", "MIDDLE")
+}
+
+func TestBLMPopWakesUpOnPush(t *testing.T) {
+	ts := startTestServer(t)
+	blocked, writer := ts.connect(t), ts.connect(t)
+
+	blocked.send("BLMPOP", "0", "2", "a", "b", "RIGHT", "COUNT", "2")
+	waitFor(t, "client to block", func() bool { return ts.blockedOn("b") == 1 })
+	writer.mustDo("3", "RPUSH", "b", "x", "y", "z")
+	if got := replyString(blocked.read()); got != "[b [z y]]" {
+		t.Fatalf("BLMPOP got %s", got)
+	}
+	writer.mustDo("[x]", "LRANGE", "b", "0", "-1")
+	blocked.mustDo("(nil)", "BLMPOP", "0.05", "1", "a", "LEFT")
+}
+
+func TestLPos(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("8", "RPUSH", "l", "a", "b", "c", "1", "2", "3", "c", "c")
+	c.mustDo("2", "LPOS", "l", "c")
+	c.mustDo("6", "LPOS", "l", "c", "RANK", "2")
+	c.mustDo("7", "LPOS", "l", "c", "RANK", "-1")
+	c.mustDo("[2 6 7]", "LPOS", "l", "c", "COUNT", "0")
+	c.mustDo("[7 6]", "LPOS", "l", "c", "RANK", "-1", "COUNT", "2")
+	c.mustDo("[]", "LPOS", "l", "c", "COUNT", "0", "MAXLEN", "2")
+	c.mustDo("(nil)", "LPOS", "l", "x")
+	c.mustDo("(nil)", "LPOS", "missing", "x")
+	c.mustDo("(error) ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list", "LPOS", "l", "c", "RANK", "0")
+}
+
+func TestPushX(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("0", "LPUSHX", "l", "a")
+	c.mustDo("0", "RPUSHX", "l", "a")
+	c.mustDo("0", "LLEN", "l")
+	c.mustDo("1", "RPUSH", "l", "b")
+	c.mustDo("3", "LPUSHX", "l", "a", "0")
+	c.mustDo("4", "RPUSHX", "l", "c")
+	c.mustDo("[0 a b c]", "LRANGE", "l", "0", "-1")
+}
+
+// checkList 比较列表与切片模型的长度、完整内容和若干区间
+func checkList(t *testing.T, l *List, model []string) {
+	t.Helper()
+	if l.Len() != len(model) {
+		t.Fatalf("Len() = %d, want %d", l.Len(), len(model))
+	}
+	if len(model) == 0 {
+		return
+	}
+	if got := l.Range(0, len(model)-1); !slices.Equal(got, model) {
+		t.Fatalf("Range(0, %d) = %v, want %v", len(model)-1, got, model)
+	}
+	for _, r := range [][2]int{{0, 0}, {len(model) - 1, len(model) - 1}, {len(model) / 3, len(model) / 2}, {len(model) - 130, len(model) - 1}} {
+		start, stop := max(r[0], 0), r[1]
+		if got := l.Range(start, stop); !slices.Equal(got, model[start:stop+1]) {
+			t.Fatalf("Range(%d, %d) = %v, want %v", start, stop, got, model[start:stop+1])
+		}
+	}
+	var reversed []string
+	l.Iterate(true, func(index int, value string) bool {
+		if value != model[index] {
+			t.Fatalf("Iterate reverse: index %d is %s, want %s", index, value, model[index])
+		}
+		reversed = append(reversed, value)
+		return true
+	})
+	if len(reversed) != len(model) {
+		t.Fatalf("Iterate reverse visited %d elements, want %d", len(reversed), len(model))
+	}
+}
+
+func TestListMatchesSliceModel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	l, model := NewList(), []string(nil)
+	next := 0
+	for i := 0; i < 20000; i++ {
+		switch op := r.Intn(100); {
+		case op < 35:
+			v := strconv.Itoa(next)
+			next++
+			l.PushLeft(v)
+			model = append([]string{v}, model...)
+		case op < 70:
+			v := strconv.Itoa(next)
+			next++
+			l.PushRight(v)
+			model = append(model, v)
+		case op < 82:
+			v, ok := l.PopLeft()
+			if ok != (len(model) > 0) || ok && v != model[0] {
+				t.Fatalf("PopLeft() = %q, %v", v, ok)
+			}
+			if ok {
+				model = model[1:]
+			}
+		case op < 94:
+			v, ok := l.PopRight()
+			if ok != (len(model) > 0) || ok && v != model[len(model)-1] {
+				t.Fatalf("PopRight() = %q, %v", v, ok)
+			}
+			if ok {
+				model = model[:len(model)-1]
+			}
+		default:
+			if len(model) == 0 {
+				continue
+			}
+			start := r.Intn(len(model))
+			stop := start + r.Intn(len(model)-start)
+			if r.Intn(4) == 0 {
+				start = r.Intn(200)
+				stop = len(model) - 1 - r.Intn(200)
+			}
+			l.Trim(start, stop)
+			if start > stop || start >= len(model) {
+				model = nil
+			} else {
+				model = slices.Clone(model[start : stop+1])
+			}
+		}
+		if i%97 == 0 {
+			checkList(t, l, model)
+		}
+	}
+	checkList(t, l, model)
+}
+
+func TestLTrimAcrossNodeBoundaries(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	args := []string{"RPUSH", "l"}
+	for i := 0; i < 3*listNodeSize+10; i++ {
+		args = append(args, strconv.Itoa(i))
+	}
+	c.mustDo(strconv.Itoa(len(args)-2), args...)
+	c.mustDo("[127 128]", "LRANGE", "l", "127", "128")
+	c.mustDo("[393]", "LRANGE", "l", "-1", "-1")
+
+	// 删除的元素跨越整块和半块
+	c.mustDo("OK", "LTRIM", "l", "100", "-100")
+	c.mustDo("195", "LLEN", "l")
+	c.mustDo("[100 101]", "LRANGE", "l", "0", "1")
+	c.mustDo("[293 294]", "LRANGE", "l", "-2", "-1")
+	c.mustDo("[227 228]", "LRANGE", "l", "127", "128")
+	c.mustDo("OK", "LTRIM", "l", "5", "1")
+	c.mustDo("0", "LLEN", "l")
+}
+
+func TestListLocate(t *testing.T) {
+	// 两端插入和 Trim 之后各块的大小不一
+	l, model := NewList(), []string(nil)
+	for i := 0; i < 300; i++ {
+		v := strconv.Itoa(i)
+		l.PushLeft("l" + v)
+		l.PushRight("r" + v)
+		model = append(append([]string{"l" + v}, model...), "r"+v)
+	}
+	l.Trim(50, 500)
+	model = model[50:501]
+	for index, want := range model {
+		node, i := l.locate(index)
+		if node.items[i] != want {
+			t.Fatalf("locate(%d) = %s, want %s", index, node.items[i], want)
+		}
+	}
+
+	// 后半部分的元素从尾部开始查找
+	if node, _ := l.locate(len(model) - 1); node != l.tail {
+		t.Fatal("last element not found in the tail block")
+	}
+	if got := l.Range(len(model)-3, len(model)-1); !slices.Equal(got, model[len(model)-3:]) {
+		t.Fatalf("Range of the last three elements = %v", got)
+	}
+}
@@ -0,0 +1,240 @@
+package goredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// listpack 是 Redis 紧凑保存小列表、集合、有序集合以及流节点的编码，RDB 文件中的流以它保存
+//
+// 格式为 4 字节总长度、2 字节元素个数（都是小端），之后是各个元素，最后是结束标记 0xFF。
+// 每个元素由编码（及长度）、数据和 backlen 组成，backlen 是前两部分的长度，
+// 用于从后往前遍历。
+const (
+	LP_HDR_SIZE        = 6
+	LP_HDR_NUMELE_UNKN = 65535
+	LP_EOF             = 0xFF
+)
+
+// listpack 元素的编码
+const (
+	LP_ENCODING_7BIT_UINT = 0x00
+	LP_ENCODING_6BIT_STR  = 0x80
+	LP_ENCODING_13BIT_INT = 0xC0
+	LP_ENCODING_12BIT_STR = 0xE0
+	LP_ENCODING_16BIT_INT = 0xF1
+	LP_ENCODING_24BIT_INT = 0xF2
+	LP_ENCODING_32BIT_INT = 0xF3
+	LP_ENCODING_64BIT_INT = 0xF4
+	LP_ENCODING_32BIT_STR = 0xF0
+)
+
+// listpackWriter 逐个追加元素构造 listpack
+type listpackWriter struct {
+	buf   []byte
+	count int
+}
+
+// newListpackWriter 创建空的 listpack
+func newListpackWriter() *listpackWriter {
+	return &listpackWriter{buf: make([]byte, LP_HDR_SIZE)}
+}
+
+// appendInt 以整数编码追加元素，选择能容纳 v 的最短编码
+func (lp *listpackWriter) appendInt(v int64) {
+	start := len(lp.buf)
+	switch {
+	case v >= 0 && v <= 127:
+		lp.buf = append(lp.buf, byte(v))
+	case v >= -4096 && v <= 4095:
+		u := uint64(v) & 0x1FFF
+		lp.buf = append(lp.buf, LP_ENCODING_13BIT_INT|byte(u>>8), byte(u))
+	case v >= -32768 && v <= 32767:
+		lp.buf = append(lp.buf, LP_ENCODING_16BIT_INT)
+		lp.buf = binary.LittleEndian.AppendUint16(lp.buf, uint16(v))
+	case v >= -8388608 && v <= 8388607:
+		u := uint32(v)
+		lp.buf = append(lp.buf, LP_ENCODING_24BIT_INT, byte(u), byte(u>>8), byte(u>>16))
+	case v >= -2147483648 && v <= 2147483647:
+		lp.buf = append(lp.buf, LP_ENCODING_32BIT_INT)
+		lp.buf = binary.LittleEndian.AppendUint32(lp.buf, uint32(v))
+	default:
+		lp.buf = append(lp.buf, LP_ENCODING_64BIT_INT)
+		lp.buf = binary.LittleEndian.AppendUint64(lp.buf, uint64(v))
+	}
+	lp.finishEntry(start)
+}
+
+// appendString 追加字符串元素；与 Redis 一样，规范形式的整数字符串以整数编码保存
+func (lp *listpackWriter) appendString(s string) {
+	if len(s) <= 20 {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(v, 10) == s {
+			lp.appendInt(v)
+			return
+		}
+	}
+	start := len(lp.buf)
+	switch n := len(s); {
+	case n < 64:
+		lp.buf = append(lp.buf, LP_ENCODING_6BIT_STR|byte(n))
+	case n < 4096:
+		lp.buf = append(lp.buf, LP_ENCODING_12BIT_STR|byte(n>>8), byte(n))
+	default:
+		lp.buf = append(lp.buf, LP_ENCODING_32BIT_STR)
+		lp.buf = binary.LittleEndian.AppendUint32(lp.buf, uint32(n))
+	}
+	lp.buf = append(lp.buf, s...)
+	lp.finishEntry(start)
+}
+
+// finishEntry 在从 start 开始的元素之后追加 backlen
+func (lp *listpackWriter) finishEntry(start int) {
+	l := uint64(len(lp.buf) - start)
+	switch {
+	case l <= 127:
+		lp.buf = append(lp.buf, byte(l))
+	case l < 16383:
+		lp.buf = append(lp.buf, byte(l>>7), byte(l&127)|128)
+	case l < 2097151:
+		lp.buf = append(lp.buf, byte(l>>14), byte((l>>7)&127)|128, byte(l&127)|128)
+	case l < 268435455:
+		lp.buf = append(lp.buf, byte(l>>21), byte((l>>14)&127)|128, byte((l>>7)&127)|128, byte(l&127)|128)
+	default:
+		lp.buf = append(lp.buf, byte(l>>28), byte((l>>21)&127)|128, byte((l>>14)&127)|128, byte((l>>7)&127)|128, byte(l&127)|128)
+	}
+	lp.count++
+}
+
+// bytes 写入头部和结束标记，返回完整的 listpack
+func (lp *listpackWriter) bytes() []byte {
+	lp.buf = append(lp.buf, LP_EOF)
+	binary.LittleEndian.PutUint32(lp.buf, uint32(len(lp.buf)))
+	count := lp.count
+	if count >= LP_HDR_NUMELE_UNKN {
+		count = LP_HDR_NUMELE_UNKN
+	}
+	binary.LittleEndian.PutUint16(lp.buf[4:], uint16(count))
+	return lp.buf
+}
+
+// errListpackCorrupt 表示 listpack 的结构与其头部或各元素的编码不一致
+var errListpackCorrupt = errors.New("corrupt listpack")
+
+// listpackDecode 校验并解码 listpack，以字符串返回所有元素，整数元素转换为十进制文本
+func listpackDecode(lp []byte) ([]string, error) {
+	if len(lp) < LP_HDR_SIZE+1 || binary.LittleEndian.Uint32(lp) != uint32(len(lp)) || lp[len(lp)-1] != LP_EOF {
+		return nil, errListpackCorrupt
+	}
+	count := int(binary.LittleEndian.Uint16(lp[4:]))
+	var entries []string
+	p := LP_HDR_SIZE
+	end := len(lp) - 1
+	for p < end {
+		start := p
+		value, n, ok := listpackDecodeEntry(lp[p:end])
+		if !ok {
+			return nil, errListpackCorrupt
+		}
+		p += n
+		// 向前遍历时 backlen 的长度由元素长度决定，它的值必须与元素长度一致
+		l := uint64(p - start)
+		size := listpackBacklenSize(l)
+		if size > end-p {
+			return nil, errListpackCorrupt
+		}
+		var backlen uint64
+		for _, b := range lp[p : p+size] {
+			backlen = backlen<<7 | uint64(b&127)
+		}
+		if backlen != l {
+			return nil, errListpackCorrupt
+		}
+		p += size
+		entries = append(entries, value)
+	}
+	if count != LP_HDR_NUMELE_UNKN && count != len(entries) {
+		return nil, errListpackCorrupt
+	}
+	return entries, nil
+}
+
+// listpackDecodeEntry 解码 buf 开头元素的编码和数据，返回元素的值和占用的字节数（不含 backlen）
+func listpackDecodeEntry(buf []byte) (string, int, bool) {
+	if len(buf) == 0 {
+		return "", 0, false
+	}
+	b := buf[0]
+	var v int64
+	var size int
+	switch {
+	case b&0x80 == LP_ENCODING_7BIT_UINT:
+		return strconv.Itoa(int(b)), 1, true
+	case b&0xC0 == LP_ENCODING_6BIT_STR:
+		return listpackString(buf, 1, int(b&0x3F))
+	case b&0xE0 == LP_ENCODING_13BIT_INT:
+		if len(buf) < 2 {
+			return "", 0, false
+		}
+		v = int64(b&0x1F)<<8 | int64(buf[1])
+		if v >= 1<<12 {
+			v -= 1 << 13
+		}
+		return strconv.FormatInt(v, 10), 2, true
+	case b&0xF0 == LP_ENCODING_12BIT_STR:
+		if len(buf) < 2 {
+			return "", 0, false
+		}
+		return listpackString(buf, 2, int(b&0x0F)<<8|int(buf[1]))
+	case b == LP_ENCODING_32BIT_STR:
+		if len(buf) < 5 {
+			return "", 0, false
+		}
+		return listpackString(buf, 5, int(binary.LittleEndian.Uint32(buf[1:])))
+	case b == LP_ENCODING_16BIT_INT:
+		size = 3
+	case b == LP_ENCODING_24BIT_INT:
+		size = 4
+	case b == LP_ENCODING_32BIT_INT:
+		size = 5
+	case b == LP_ENCODING_64BIT_INT:
+		size = 9
+	default:
+		return "", 0, false
+	}
+	if len(buf) < size {
+		return "", 0, false
+	}
+	// 小端的补码整数，读出后按位数做符号扩展
+	var u uint64
+	for i := size - 1; i >= 1; i-- {
+		u = u<<8 | uint64(buf[i])
+	}
+	shift := 64 - 8*(size-1)
+	v = int64(u<<shift) >> shift
+	return strconv.FormatInt(v, 10), size, true
+}
+
+// listpackString 返回从 buf[offset] 开始、长度为 n 的字符串元素
+func listpackString(buf []byte, offset, n int) (string, int, bool) {
+	if n > len(buf)-offset {
+		return "", 0, false
+	}
+	return string(buf[offset : offset+n]), offset + n, true
+}
+
+// listpackBacklenSize 返回长度为 l 的元素的 backlen 占用的字节数
+func listpackBacklenSize(l uint64) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
@@ -0,0 +1,54 @@
+package goredis
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestListpackEncodingMatchesRedis(t *testing.T) {
+	long := strings.Repeat("x", 200)
+	tests := []struct {
+		name  string
+		build func(lp *listpackWriter)
+		entry []byte // 去掉头部和结束标记之后的元素
+	}{
+		{"7bit uint", func(lp *listpackWriter) { lp.appendInt(127) }, []byte{0x7f, 0x01}},
+		{"13bit int", func(lp *listpackWriter) { lp.appendInt(-1) }, []byte{0xdf, 0xff, 0x02}},
+		{"16bit int", func(lp *listpackWriter) { lp.appendInt(10000) }, []byte{0xf1, 0x10, 0x27, 0x03}},
+		{"24bit int", func(lp *listpackWriter) { lp.appendInt(-100000) }, []byte{0xf2, 0x60, 0x79, 0xfe, 0x04}},
+		{"64bit int", func(lp *listpackWriter) { lp.appendInt(1 << 40) }, []byte{0xf4, 0, 0, 0, 0, 0, 1, 0, 0, 0x09}},
+		// 规范形式的整数字符串以整数编码，其他字符串保持原样
+		{"int string", func(lp *listpackWriter) { lp.appendString("42") }, []byte{0x2a, 0x01}},
+		{"non-canonical", func(lp *listpackWriter) { lp.appendString("042") }, []byte{0x83, '0', '4', '2', 0x04}},
+		{"6bit str", func(lp *listpackWriter) { lp.appendString("ab") }, []byte{0x82, 'a', 'b', 0x03}},
+		// 12 位长度的字符串，元素长度 202 的 backlen 占两个字节
+		{"12bit str", func(lp *listpackWriter) { lp.appendString(long) },
+			append(append([]byte{0xe0, 200}, long...), 0x01, 0xca)},
+	}
+	for _, tt := range tests {
+		lp := newListpackWriter()
+		tt.build(lp)
+		got := lp.bytes()
+		want := append([]byte{byte(len(tt.entry) + 7), 0, 0, 0, 1, 0}, tt.entry...)
+		want = append(want, LP_EOF)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got % x, want % x", tt.name, got, want)
+		}
+	}
+}
+
+func TestListpackDecode(t *testing.T) {
+	elems := []string{"a", "", "127", "-1", "10000", "-100000", "4294967296", strings.Repeat("y", 5000), "007"}
+	got, err := listpackDecode(listpackOf(elems...))
+	if err != nil || strings.Join(got, ",") != strings.Join(elems, ",") {
+		t.Fatalf("decoded %v, %v", got, err)
+	}
+
+	lp := listpackOf("a", "b")
+	for _, bad := range [][]byte{lp[:len(lp)-1], lp[:5], append(lp[:len(lp)-1:len(lp)-1], 0x00, LP_EOF)} {
+		if _, err := listpackDecode(bad); err == nil {
+			t.Errorf("decoding % x should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package goredis
+
+import "errors"
+
+// LZF 是 Redis 压缩 RDB 中较长字符串使用的算法，格式与 liblzf 相同：
+// 控制字节小于 32 时表示其后有 ctrl+1 个字面字节；否则高 3 位是匹配长度减 2
+// （为 7 时再读一个字节累加），低 5 位和下一个字节组成回溯距离减 1。
+const (
+	lzfHashLog = 14
+	lzfMaxLit  = 32
+	lzfMaxOff  = 1 << 13
+	lzfMaxRef  = (1 << 8) + (1 << 3)
+)
+
+// errLzfCorrupt 表示压缩数据不完整或与声明的原始长度不符
+var errLzfCorrupt = errors.New("invalid LZF compressed string")
+
+// lzfCompress 压缩 in，压缩结果超过 maxLen 字节时返回 nil，调用方应改为保存原始数据
+func lzfCompress(in []byte, maxLen int) []byte {
+	var htab [1 << lzfHashLog]int32
+	out := make([]byte, 0, maxLen)
+	litStart := 0
+
+	flushLiterals := func(end int) {
+		for litStart < end {
+			n := min(end-litStart, lzfMaxLit)
+			out = append(out, byte(n-1))
+			out = append(out, in[litStart:litStart+n]...)
+			litStart += n
+		}
+	}
+
+	for ip := 0; ip+2 < len(in); {
+		h := (uint32(in[ip])<<16 | uint32(in[ip+1])<<8 | uint32(in[ip+2])) * 2654435761 >> (32 - lzfHashLog)
+		ref := int(htab[h]) - 1
+		htab[h] = int32(ip + 1)
+		off := ip - ref - 1
+		if ref < 0 || off >= lzfMaxOff || in[ref] != in[ip] || in[ref+1] != in[ip+1] || in[ref+2] != in[ip+2] {
+			ip++
+			continue
+		}
+
+		maxRef := min(len(in)-ip, lzfMaxRef)
+		n := 3
+		for n < maxRef && in[ref+n] == in[ip+n] {
+			n++
+		}
+		flushLiterals(ip)
+		if n-2 < 7 {
+			out = append(out, byte((n-2)<<5|off>>8))
+		} else {
+			out = append(out, byte(7<<5|off>>8), byte(n-2-7))
+		}
+		out = append(out, byte(off))
+		if len(out) > maxLen {
+			return nil
+		}
+		ip += n
+		litStart = ip
+	}
+	flushLiterals(len(in))
+	if len(out) > maxLen {
+		return nil
+	}
+	return out
+}
+
+// lzfDecompress 解压 in，解压结果必须正好是 outLen 字节
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	// 压缩数据最多约 1:88 展开，按输入长度限制预分配，避免损坏的长度导致巨大的分配
+	out := make([]byte, 0, min(outLen, 90*len(in)+lzfMaxRef))
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < lzfMaxLit {
+			n := ctrl + 1
+			if n > len(in)-i || n > outLen-len(out) {
+				return nil, errLzfCorrupt
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errLzfCorrupt
+			}
+			n += int(in[i])
+			i++
+		}
+		n += 2
+		if i >= len(in) {
+			return nil, errLzfCorrupt
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 || n > outLen-len(out) {
+			return nil, errLzfCorrupt
+		}
+		// 匹配可以与正在生成的数据重叠，需要逐字节复制
+		for j := 0; j < n; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != outLen {
+		return nil, errLzfCorrupt
+	}
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package goredis
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestLzfRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 5000)
+	rng.Read(random)
+	inputs := [][]byte{
+		[]byte(strings.Repeat("a", 1000)),
+		[]byte(strings.Repeat("hello world ", 500)),
+		// 超过最大回溯距离和最大匹配长度的重复
+		append(append(bytes.Repeat([]byte("xyz"), 3000), random[:100]...), bytes.Repeat([]byte("xyz"), 3000)...),
+	}
+	for _, in := range inputs {
+		out := lzfCompress(in, len(in)-1)
+		if out == nil {
+			t.Fatalf("%d bytes of repetitive data did not compress", len(in))
+		}
+		got, err := lzfDecompress(out, len(in))
+		if err != nil || !bytes.Equal(got, in) {
+			t.Fatalf("round trip of %d bytes failed: %v", len(in), err)
+		}
+	}
+
+	// 随机数据压缩后不会变短
+	if out := lzfCompress(random, len(random)-1); out != nil {
+		t.Fatalf("random data compressed to %d bytes", len(out))
+	}
+}
+
+func TestLzfDecompressRejectsCorruptData(t *testing.T) {
+	in := []byte(strings.Repeat("hello world ", 50))
+	out := lzfCompress(in, len(in))
+	for _, tt := range []struct {
+		data   []byte
+		outLen int
+	}{
+		{out, len(in) - 1},
+		{out, len(in) + 1},
+		{out[:len(out)-1], len(in)},
+		// 回溯引用超出已解压的数据
+		{[]byte{0x00, 'a', 0xe0, 0x10, 0x05}, 20},
+	} {
+		if _, err := lzfDecompress(tt.data, tt.outLen); err == nil {
+			t.Errorf("decompressing % x to %d bytes should fail", tt.data[:min(8, len(tt.data))], tt.outLen)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package goredis
+
+// 事务中不排队、立即执行的命令
+var multiControlCommands = map[string]bool{
+	"multi":   true,
+	"exec":    true,
+	"discard": true,
+	"watch":   true,
+	"quit":    true,
+}
+
+// watchedKey 是客户端 WATCH 的一个键
+type watchedKey struct {
+	db  *redisDb
+	key string
+}
+
+// multiCmd 是事务中排队的一条命令
+type multiCmd struct {
+	cmd     *redisCommand
+	command *RESPValue
+}
+
+// queueMultiCommand 把命令加入事务队列
+func (c *client) queueMultiCommand(cmd *redisCommand, command *RESPValue) {
+	c.multiQueue = append(c.multiQueue, multiCmd{cmd: cmd, command: command})
+}
+
+// multiHasWrite 判断事务队列中是否有写命令
+func (c *client) multiHasWrite() bool {
+	for _, mc := range c.multiQueue {
+		if mc.cmd.flags&CMD_WRITE != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// flagTransaction 在事务中的命令排队失败时标记事务，之后的 EXEC 会被拒绝
+func (c *client) flagTransaction() {
+	if c.multi {
+		c.multiError = true
+	}
+}
+
+// discardTransaction 丢弃排队的命令，退出事务状态并取消 WATCH 的所有键
+func (rs *RedisServer) discardTransaction(c *client) {
+	c.multi = false
+	c.multiQueue = nil
+	c.multiError = false
+	rs.unwatchAllKeys(c)
+}
+
+// watchKey 让客户端 WATCH 当前数据库中的键（调用方需持有写锁）
+func (rs *RedisServer) watchKey(c *client, key string) {
+	for _, wk := range c.watchedKeys {
+		if wk.db == c.db && wk.key == key {
+			return
+		}
+	}
+	c.db.watchedKeys[key] = append(c.db.watchedKeys[key], c)
+	c.watchedKeys = append(c.watchedKeys, watchedKey{db: c.db, key: key})
+}
+
+// unwatchAllKeys 取消客户端 WATCH 的所有键
+func (rs *RedisServer) unwatchAllKeys(c *client) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	for _, wk := range c.watchedKeys {
+		clients := wk.db.watchedKeys[wk.key]
+		for i, other := range clients {
+			if other == c {
+				clients = append(clients[:i], clients[i+1:]...)
+				break
+			}
+		}
+		if len(clients) == 0 {
+			delete(wk.db.watchedKeys, wk.key)
+		} else {
+			wk.db.watchedKeys[wk.key] = clients
+		}
+	}
+	c.watchedKeys = nil
+	c.dirtyCAS = false
+}
+
+// touchWatchedKey 把 WATCH 了该键的客户端标记为 dirtyCAS，它们之后的 EXEC 会失败（调用方需持有写锁）
+func touchWatchedKey(db *redisDb, key string) {
+	for _, c := range db.watchedKeys[key] {
+		c.dirtyCAS = true
+	}
+}
+
+// touchAllWatchedKeysInDb 在数据库被清空或交换时标记受影响的 WATCH 客户端（调用方需持有写锁）
+//
+// 只有在 db 中（交换时还包括 other 中）存在的键才算被修改：清空一个不存在的键不改变它。
+func (rs *RedisServer) touchAllWatchedKeysInDb(db *redisDb, other *redisDb) {
+	for key := range db.watchedKeys {
+		if db.lookupKey(key) != nil || (other != nil && other.lookupKey(key) != nil) {
+			touchWatchedKey(db, key)
+		}
+	}
+}
+
+// handleMulti 处理 MULTI 命令，开始一个事务
+func (rs *RedisServer) handleMulti(c *client, command *RESPValue) *RESPValue {
+	if c.multi {
+		return NewErrorValue("ERR MULTI calls can not be nested")
+	}
+	c.multi = true
+	return NewSimpleStringValue("OK")
+}
+
+// handleDiscard 处理 DISCARD 命令，放弃事务中排队的命令
+func (rs *RedisServer) handleDiscard(c *client, command *RESPValue) *RESPValue {
+	if !c.multi {
+		return NewErrorValue("ERR DISCARD without MULTI")
+	}
+	rs.discardTransaction(c)
+	return NewSimpleStringValue("OK")
+}
+
+// handleExec 处理 EXEC 命令，依次执行事务中排队的命令，以数组返回各命令的回复
+//
+// EXEC 在独占命令锁的情况下执行（见 call），其他连接的命令不会插入事务中间。
+// 排队时出错的事务整体被拒绝；WATCH 的键在 EXEC 之前被修改过时不执行任何命令，
+// 返回 null 数组。执行时某条命令出错（例如类型错误）不影响其他命令，
+// 错误作为该命令的回复放在数组中，这与 Redis 相同，事务不会回滚。
+func (rs *RedisServer) handleExec(c *client, command *RESPValue) *RESPValue {
+	if !c.multi {
+		return NewErrorValue("ERR EXEC without MULTI")
+	}
+	rs.mutex.RLock()
+	dirty := c.dirtyCAS
+	rs.mutex.RUnlock()
+
+	queue, aborted := c.multiQueue, c.multiError
+	rs.discardTransaction(c)
+	if aborted {
+		return NewErrorValue("EXECABORT Transaction discarded because of previous errors.")
+	}
+	if dirty {
+		return NewNullArrayValue()
+	}
+
+	// 执行 AOF 和主节点命令流的伪客户端本身就不能阻塞，结束后保持原样
+	denyBlocking := c.denyBlocking
+	c.denyBlocking = true
+	c.inExec = true
+	defer func() { c.denyBlocking, c.inExec = denyBlocking, false }()
+
+	replies := make([]*RESPValue, len(queue))
+	for i, mc := range queue {
+		replies[i] = rs.runCommand(c, mc.cmd, mc.command)
+	}
+	return NewArrayValue(replies)
+}
+
+// handleWatch 处理 WATCH 命令，EXEC 之前这些键被任何客户端修改时事务不会执行
+func (rs *RedisServer) handleWatch(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if c.multi {
+		return NewErrorValue("ERR WATCH inside MULTI is not allowed")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	for _, key := range args {
+		rs.watchKey(c, key)
+	}
+	return NewSimpleStringValue("OK")
+}
+
+// handleUnwatch 处理 UNWATCH 命令，取消 WATCH 的所有键
+func (rs *RedisServer) handleUnwatch(c *client, command *RESPValue) *RESPValue {
+	rs.unwatchAllKeys(c)
+	return NewSimpleStringValue("OK")
+}
@@ -0,0 +1,156 @@
+package goredis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMultiExec(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(error) ERR EXEC without MULTI", "EXEC")
+	c.mustDo("(error) ERR DISCARD without MULTI", "DISCARD")
+
+	c.mustDo("OK", "MULTI")
+	c.mustDo("(error) ERR MULTI calls can not be nested", "MULTI")
+	c.mustDo("QUEUED", "RPUSH", "l", "a", "b")
+	c.mustDo("QUEUED", "SET", "s", "v")
+	// 执行时出错的命令不影响其他命令
+	c.mustDo("QUEUED", "LPUSH", "s", "x")
+	c.mustDo("QUEUED", "LRANGE", "l", "0", "-1")
+	c.mustDo("[2 OK (error) WRONGTYPE Operation against a key holding the wrong kind of value [a b]]", "EXEC")
+	c.mustDo("v", "GET", "s")
+
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "RPUSH", "l", "c")
+	c.mustDo("OK", "DISCARD")
+	c.mustDo("2", "LLEN", "l")
+	c.mustDo("(error) ERR wrong number of arguments for 'exec' command", "EXEC", "now")
+}
+
+func TestExecAbortsAfterQueueingError(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "RPUSH", "l", "a")
+	c.mustDo("(error) ERR unknown command 'NOSUCH'", "NOSUCH")
+	c.mustDo("(error) ERR wrong number of arguments for 'get' command", "GET")
+	c.mustDo("(error) EXECABORT Transaction discarded because of previous errors.", "EXEC")
+	c.mustDo("0", "LLEN", "l")
+	// EXECABORT 之后退出事务状态
+	c.mustDo("(error) ERR EXEC without MULTI", "EXEC")
+}
+
+func TestBlockingCommandInMultiDoesNotBlock(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "BLPOP", "missing", "0")
+	c.mustDo("QUEUED", "BZPOPMIN", "missing", "0")
+	c.mustDo("QUEUED", "RPUSH", "l", "a")
+	c.mustDo("QUEUED", "BLPOP", "l", "0")
+	c.mustDo("[(nil) (nil) 1 [l a]]", "EXEC")
+}
+
+func TestExecIsNotInterleaved(t *testing.T) {
+	ts := startTestServer(t)
+	c, other, blocked := ts.connect(t), ts.connect(t), ts.connect(t)
+	// 阻塞中的客户端不会挡住 EXEC
+	blocked.send("BLPOP", "q", "0")
+	waitFor(t, "BLPOP to block", func() bool { return ts.blockedOn("q") == 1 })
+
+	c.mustDo("OK", "MULTI")
+	for range 1000 {
+		c.mustDo("QUEUED", "RPUSH", "l", "x")
+	}
+	c.mustDo("QUEUED", "RPUSH", "q", "item")
+	c.send("EXEC")
+	// 另一个连接的命令要么看到事务之前的状态，要么看到之后的状态
+	time.Sleep(time.Millisecond)
+	if got := replyString(other.do("LLEN", "l")); got != "0" && got != "1000" {
+		t.Fatalf("LLEN during EXEC returned %s", got)
+	}
+	if got := c.read(); len(got.Array) != 1001 {
+		t.Fatalf("EXEC returned %d replies", len(got.Array))
+	}
+	blocked.expect("[q item]")
+}
+
+func TestWatchAbortsExecAfterAnotherClientWrites(t *testing.T) {
+	ts := startTestServer(t)
+	c, other := ts.connect(t), ts.connect(t)
+	c.mustDo("1", "RPUSH", "l", "a")
+	c.mustDo("OK", "WATCH", "l", "s")
+	other.mustDo("2", "RPUSH", "l", "b")
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "RPUSH", "l", "c")
+	c.mustDo("(nil)", "EXEC")
+	c.mustDo("[a b]", "LRANGE", "l", "0", "-1")
+
+	// EXEC 之后 WATCH 被取消，下一个事务正常执行
+	other.mustDo("3", "RPUSH", "l", "c")
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "LLEN", "l")
+	c.mustDo("[3]", "EXEC")
+
+	// 没有被修改的键不影响事务，修改在 MULTI 之后、EXEC 之前同样让事务失败
+	c.mustDo("OK", "WATCH", "l", "s")
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "LLEN", "l")
+	other.mustDo("1", "SADD", "s", "x")
+	c.mustDo("(nil)", "EXEC")
+}
+
+func TestWatchedKeyUntouched(t *testing.T) {
+	ts := startTestServer(t)
+	c, other := ts.connect(t), ts.connect(t)
+	c.mustDo("OK", "WATCH", "l")
+	// 读取和对其他键、其他数据库中同名键的修改都不算修改
+	other.mustDo("0", "LLEN", "l")
+	other.mustDo("1", "RPUSH", "other", "x")
+	other.mustDo("OK", "SELECT", "1")
+	other.mustDo("1", "RPUSH", "l", "x")
+	// 失败的写命令不修改键
+	other.mustDo("OK", "SELECT", "0")
+	other.mustDo("0", "RPUSHX", "l", "x")
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "RPUSH", "l", "a")
+	c.mustDo("[1]", "EXEC")
+
+	c.mustDo("OK", "MULTI")
+	c.mustDo("(error) ERR WATCH inside MULTI is not allowed", "WATCH", "l")
+	c.mustDo("OK", "DISCARD")
+
+	// UNWATCH 和 DISCARD 都取消 WATCH
+	c.mustDo("OK", "WATCH", "l")
+	c.mustDo("OK", "UNWATCH")
+	other.mustDo("2", "RPUSH", "l", "b")
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "LLEN", "l")
+	c.mustDo("[2]", "EXEC")
+}
+
+func TestWatchFlushAndSwapDB(t *testing.T) {
+	ts := startTestServer(t)
+	c, other := ts.connect(t), ts.connect(t)
+
+	// 清空数据库只影响存在的键
+	c.mustDo("OK", "WATCH", "missing")
+	other.mustDo("OK", "FLUSHDB")
+	c.mustDo("OK", "MULTI")
+	c.mustDo("[]", "EXEC")
+
+	c.mustDo("1", "RPUSH", "l", "a")
+	c.mustDo("OK", "WATCH", "l")
+	other.mustDo("OK", "FLUSHALL")
+	c.mustDo("OK", "MULTI")
+	c.mustDo("(nil)", "EXEC")
+
+	// 交换后 WATCH 的键的值变化
+	other.mustDo("OK", "SELECT", "1")
+	other.mustDo("1", "RPUSH", "l", "b")
+	c.mustDo("OK", "WATCH", "l")
+	other.mustDo("OK", "SWAPDB", "0", "1")
+	c.mustDo("OK", "MULTI")
+	c.mustDo("(nil)", "EXEC")
+}
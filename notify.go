@@ -0,0 +1,110 @@
+package goredis
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// 键空间通知的类别，与 notify-keyspace-events 配置中的字符一一对应
+const (
+	NOTIFY_KEYSPACE = 1 << iota // K
+	NOTIFY_KEYEVENT             // E
+	NOTIFY_GENERIC              // g
+	NOTIFY_STRING               // $
+	NOTIFY_LIST                 // l
+	NOTIFY_SET                  // s
+	NOTIFY_HASH                 // h
+	NOTIFY_ZSET                 // z
+	NOTIFY_EXPIRED              // x
+	NOTIFY_EVICTED              // e，服务器没有驱逐，不会产生
+	NOTIFY_STREAM               // t
+	NOTIFY_KEY_MISS             // m，不包含在 A 中
+	NOTIFY_LOADED               // 仅供模块使用，没有对应的字符
+	NOTIFY_MODULE               // d
+	NOTIFY_NEW                  // n，不包含在 A 中
+
+	// A 是 g$lshzxetd 的别名
+	NOTIFY_ALL = NOTIFY_GENERIC | NOTIFY_STRING | NOTIFY_LIST | NOTIFY_SET | NOTIFY_HASH |
+		NOTIFY_ZSET | NOTIFY_EXPIRED | NOTIFY_EVICTED | NOTIFY_STREAM | NOTIFY_MODULE
+)
+
+// notifyFlagChars 按 Redis 输出配置时的顺序列出各类别对应的字符
+var notifyFlagChars = []struct {
+	flag int
+	char byte
+}{
+	{NOTIFY_GENERIC, 'g'},
+	{NOTIFY_STRING, '$'},
+	{NOTIFY_LIST, 'l'},
+	{NOTIFY_SET, 's'},
+	{NOTIFY_HASH, 'h'},
+	{NOTIFY_ZSET, 'z'},
+	{NOTIFY_EXPIRED, 'x'},
+	{NOTIFY_EVICTED, 'e'},
+	{NOTIFY_STREAM, 't'},
+	{NOTIFY_MODULE, 'd'},
+	{NOTIFY_KEYSPACE, 'K'},
+	{NOTIFY_KEYEVENT, 'E'},
+	{NOTIFY_KEY_MISS, 'm'},
+	{NOTIFY_NEW, 'n'},
+}
+
+// parseNotifyFlags 解析 notify-keyspace-events 的配置字符串，包含未知字符时返回错误
+func parseNotifyFlags(classes string) (int, error) {
+	flags := 0
+	for i := 0; i < len(classes); i++ {
+		if classes[i] == 'A' {
+			flags |= NOTIFY_ALL
+			continue
+		}
+		found := false
+		for _, fc := range notifyFlagChars {
+			if fc.char == classes[i] {
+				flags |= fc.flag
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, errors.New("Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+		}
+	}
+	return flags, nil
+}
+
+// formatNotifyFlags 把通知类别转换回配置字符串，包含 A 的全部类别时以 A 表示
+func formatNotifyFlags(flags int) string {
+	var sb strings.Builder
+	if flags&NOTIFY_ALL == NOTIFY_ALL {
+		sb.WriteByte('A')
+	}
+	for _, fc := range notifyFlagChars {
+		if flags&NOTIFY_ALL == NOTIFY_ALL && fc.flag&NOTIFY_ALL != 0 {
+			continue
+		}
+		if flags&fc.flag != 0 {
+			sb.WriteByte(fc.char)
+		}
+	}
+	return sb.String()
+}
+
+// notifyKeyspaceEvent 发布键空间通知（调用方需持有写锁）
+//
+// 事件类别被 notify-keyspace-events 启用时，按配置向
+// __keyspace@<db>__:<key> 发布事件名，向 __keyevent@<db>__:<event> 发布键名。
+// 通知在命令修改数据之后、释放锁之前发出，订阅者看到的事件顺序与修改顺序一致。
+func (rs *RedisServer) notifyKeyspaceEvent(typ int, event string, key string, dbid int) {
+	flags := rs.notifyKeyspaceEvents
+	if flags&typ == 0 {
+		return
+	}
+	db := strconv.Itoa(dbid)
+	if flags&NOTIFY_KEYSPACE != 0 {
+		rs.publish("__keyspace@"+db+"__:"+key, event)
+	}
+	if flags&NOTIFY_KEYEVENT != 0 {
+		rs.publish("__keyevent@"+db+"__:"+event, key)
+	}
+}
@@ -0,0 +1,74 @@
+package goredis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotifyKeyspaceEventsFlags(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[notify-keyspace-events ]", "CONFIG", "GET", "notify-keyspace-events")
+	c.mustDo("OK", "CONFIG", "SET", "notify-keyspace-events", "KA")
+	c.mustDo("[notify-keyspace-events AK]", "CONFIG", "GET", "notify-keyspace-events")
+	// 与 Redis 一样接受所有类别，按 Redis 的顺序输出
+	for _, tc := range []struct{ set, get string }{
+		{"Ex", "xE"},
+		{"Ke", "eK"},
+		{"KEA$x", "AKE"},
+		{"Eg$lshzxetd", "AE"},
+		{"Kmn", "Kmn"},
+	} {
+		c.mustDo("OK", "CONFIG", "SET", "notify-keyspace-events", tc.set)
+		c.mustDo("[notify-keyspace-events "+tc.get+"]", "CONFIG", "GET", "notify-keyspace-events")
+	}
+	// 未知的类别报错，配置不变
+	if got := replyString(c.do("CONFIG", "SET", "notify-keyspace-events", "KQ")); got[:7] != "(error)" {
+		t.Fatalf("setting KQ returned %s", got)
+	}
+	c.mustDo("[notify-keyspace-events Kmn]", "CONFIG", "GET", "notify-keyspace-events")
+}
+
+func TestKeyspaceNotificationsExpired(t *testing.T) {
+	ts := startTestServer(t)
+	sub, c := ts.connect(t), ts.connect(t)
+	c.mustDo("OK", "CONFIG", "SET", "notify-keyspace-events", "Ex")
+	sub.mustDo("[subscribe __keyevent@0__:expired 1]", "SUBSCRIBE", "__keyevent@0__:expired")
+
+	// 主动过期和写命令执行之前的删除都发布 expired 事件
+	c.mustDo("OK", "SET", "active", "v")
+	c.mustDo("1", "PEXPIRE", "active", "10")
+	if got := replyString(sub.read()); got != "[message __keyevent@0__:expired active]" {
+		t.Fatalf("got %s", got)
+	}
+	c.mustDo("OK", "SET", "lazy", "v")
+	c.mustDo("1", "EXPIRE", "lazy", "100")
+	ts.rs.mutex.Lock()
+	ts.rs.databases[0].store.SetExpire("lazy", time.Now().UnixMilli()-1)
+	ts.rs.mutex.Unlock()
+	c.mustDo("1", "RPUSH", "lazy", "x")
+	if got := replyString(sub.read()); got != "[message __keyevent@0__:expired lazy]" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	ts := startTestServer(t)
+	sub, c := ts.connect(t), ts.connect(t)
+	c.mustDo("OK", "CONFIG", "SET", "notify-keyspace-events", "KEl")
+	sub.mustDo("[psubscribe __key*__:* 1]", "PSUBSCRIBE", "__key*__:*")
+	c.mustDo("1", "LPUSH", "q", "a")
+	// 未开启的类别不产生通知
+	c.mustDo("1", "SADD", "s", "a")
+	c.mustDo("a", "LPOP", "q")
+	for _, want := range []string{
+		"[pmessage __key*__:* __keyspace@0__:q lpush]",
+		"[pmessage __key*__:* __keyevent@0__:lpush q]",
+		"[pmessage __key*__:* __keyspace@0__:q lpop]",
+		"[pmessage __key*__:* __keyevent@0__:lpop q]",
+	} {
+		if got := replyString(sub.read()); got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package goredis
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// 值对象类型
+const (
+	OBJ_STRING = iota
+	OBJ_LIST
+	OBJ_SET
+	OBJ_ZSET
+	OBJ_STREAM
+	OBJ_CMS
+	OBJ_TOPK
+	OBJ_HASH
+)
+
+// WRONGTYPE 错误信息
+const wrongTypeErr = "WRONGTYPE Operation against a key holding the wrong kind of value"
+
+// RedisObject 表示键空间中存储的一个值
+//
+// snapshot 不为 nil 时对象属于正在写出的后台保存快照，修改之前需要先保存下来。
+type RedisObject struct {
+	Type     int
+	Value    interface{}
+	snapshot atomic.Pointer[rdbCowSnapshot]
+}
+
+// NewStringObject 创建字符串对象
+//
+// 与 Redis 的 sds 一样，字符串的内容以 []byte 保存，SETBIT 等命令可以原地修改。
+func NewStringObject(str string) *RedisObject {
+	return &RedisObject{Type: OBJ_STRING, Value: []byte(str)}
+}
+
+// NewListObject 创建列表对象
+func NewListObject() *RedisObject {
+	return &RedisObject{Type: OBJ_LIST, Value: NewList()}
+}
+
+// NewSetObject 创建集合对象
+func NewSetObject() *RedisObject {
+	return &RedisObject{Type: OBJ_SET, Value: NewSet()}
+}
+
+// NewZSetObject 创建有序集合对象
+func NewZSetObject() *RedisObject {
+	return &RedisObject{Type: OBJ_ZSET, Value: NewZSet()}
+}
+
+// NewStreamObject 创建流对象
+func NewStreamObject() *RedisObject {
+	return &RedisObject{Type: OBJ_STREAM, Value: NewStream()}
+}
+
+// NewHashObject 创建哈希对象
+func NewHashObject() *RedisObject {
+	return &RedisObject{Type: OBJ_HASH, Value: NewHash()}
+}
+
+// NewCMSObject 创建 Count-Min Sketch 对象
+func NewCMSObject(width, depth uint64) *RedisObject {
+	return &RedisObject{Type: OBJ_CMS, Value: NewCountMinSketch(width, depth)}
+}
+
+// NewTopKObject 创建 Top-K 对象
+func NewTopKObject(k int, width, depth uint64, decay float64) *RedisObject {
+	return &RedisObject{Type: OBJ_TOPK, Value: NewTopK(k, width, depth, decay)}
+}
+
+// lookupKey 查找键对应的对象用于读取，不存在或已经过期时返回 nil（调用方需持有锁）
+//
+// 读取不改变对象，后台保存的快照可以同时序列化它，不需要先保存下来。已经过期的键
+// 在这里只是视为不存在，由写命令执行之前的 expireCommandKeys 或者主动过期删除。
+func (db *redisDb) lookupKey(key string) *RedisObject {
+	if db.keyIsExpired(key) {
+		return nil
+	}
+	return db.store.Get(key)
+}
+
+// lookupKeyWrite 查找键对应的对象用于原地修改，不存在时返回 nil（调用方需持有写锁）
+//
+// 对象属于后台保存的快照时先把它保存下来，调用方之后可以原地修改。只检查键是否存在，
+// 或者用新的对象整体替换键的值时用 lookupKey 即可，快照中仍然是原来的对象。
+func (db *redisDb) lookupKeyWrite(key string) *RedisObject {
+	obj := db.lookupKey(key)
+	if obj != nil {
+		if s := obj.snapshot.Load(); s != nil {
+			s.preserve(obj)
+		}
+	}
+	return obj
+}
+
+// lookupString 查找字符串对象，键不存在时返回 nil，类型不匹配时返回错误响应（调用方需持有锁）
+//
+// 返回对象本身而不是内容，以便修改后把新的内容写回 Value。
+func (db *redisDb) lookupString(key string) (*RedisObject, *RESPValue) {
+	obj := db.lookupKey(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.Type != OBJ_STRING {
+		return nil, NewErrorValue(wrongTypeErr)
+	}
+	return obj, nil
+}
+
+// lookupList 查找列表对象，键不存在时返回 nil，类型不匹配时返回错误响应（调用方需持有锁）
+func (db *redisDb) lookupList(key string) (*List, *RESPValue) {
+	obj := db.lookupKey(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.Type != OBJ_LIST {
+		return nil, NewErrorValue(wrongTypeErr)
+	}
+	return obj.Value.(*List), nil
+}
+
+// lookupListWrite 与 lookupList 相同，用于原地修改列表（调用方需持有写锁）
+func (db *redisDb) lookupListWrite(key string) (*List, *RESPValue) {
+	db.lookupKeyWrite(key)
+	return db.lookupList(key)
+}
+
+// lookupSet 查找集合对象，键不存在时返回 nil，类型不匹配时返回错误响应（调用方需持有锁）
+func (db *redisDb) lookupSet(key string) (*Set, *RESPValue) {
+	obj := db.lookupKey(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.Type != OBJ_SET {
+		return nil, NewErrorValue(wrongTypeErr)
+	}
+	return obj.Value.(*Set), nil
+}
+
+// lookupSetWrite 与 lookupSet 相同，用于原地修改集合（调用方需持有写锁）
+func (db *redisDb) lookupSetWrite(key string) (*Set, *RESPValue) {
+	db.lookupKeyWrite(key)
+	return db.lookupSet(key)
+}
+
+// lookupZSet 查找有序集合对象，键不存在时返回 nil，类型不匹配时返回错误响应（调用方需持有锁）
+func (db *redisDb) lookupZSet(key string) (*ZSet, *RESPValue) {
+	obj := db.lookupKey(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.Type != OBJ_ZSET {
+		return nil, NewErrorValue(wrongTypeErr)
+	}
+	return obj.Value.(*ZSet), nil
+}
+
+// lookupZSetWrite 与 lookupZSet 相同，用于原地修改有序集合（调用方需持有写锁）
+func (db *redisDb) lookupZSetWrite(key string) (*ZSet, *RESPValue) {
+	db.lookupKeyWrite(key)
+	return db.lookupZSet(key)
+}
+
+// lookupHash 查找哈希对象，键不存在时返回 nil，类型不匹配时返回错误响应（调用方需持有锁）
+func (db *redisDb) lookupHash(key string) (*Hash, *RESPValue) {
+	obj := db.lookupKey(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.Type != OBJ_HASH {
+		return nil, NewErrorValue(wrongTypeErr)
+	}
+	return obj.Value.(*Hash), nil
+}
+
+// lookupHashWrite 与 lookupHash 相同，用于原地修改哈希（调用方需持有写锁）
+func (db *redisDb) lookupHashWrite(key string) (*Hash, *RESPValue) {
+	db.lookupKeyWrite(key)
+	return db.lookupHash(key)
+}
+
+// lookupStream 查找流对象，键不存在时返回 nil，类型不匹配时返回错误响应（调用方需持有锁）
+func (db *redisDb) lookupStream(key string) (*Stream, *RESPValue) {
+	obj := db.lookupKey(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.Type != OBJ_STREAM {
+		return nil, NewErrorValue(wrongTypeErr)
+	}
+	return obj.Value.(*Stream), nil
+}
+
+// lookupStreamWrite 与 lookupStream 相同，用于原地修改流（调用方需持有写锁）
+func (db *redisDb) lookupStreamWrite(key string) (*Stream, *RESPValue) {
+	db.lookupKeyWrite(key)
+	return db.lookupStream(key)
+}
+
+// objectTypeName 返回对象的类型名称，与 TYPE 命令的输出一致
+func objectTypeName(obj *RedisObject) string {
+	switch obj.Type {
+	case OBJ_LIST:
+		return "list"
+	case OBJ_SET:
+		return "set"
+	case OBJ_ZSET:
+		return "zset"
+	case OBJ_HASH:
+		return "hash"
+	case OBJ_STREAM:
+		return "stream"
+	case OBJ_CMS:
+		return "CMSk-TYPE"
+	case OBJ_TOPK:
+		return "TopK-TYPE"
+	default:
+		return "string"
+	}
+}
+
+// validTypeName 判断是否为 Redis 的类型名称（包括 RedisBloom 的类型名），name 需为小写
+func validTypeName(name string) bool {
+	switch name {
+	case "string", "list", "set", "zset", "hash", "stream", "cmsk-type", "topk-type":
+		return true
+	}
+	return false
+}
+
+// objectEncoding 返回对象的内部编码名称
+func objectEncoding(obj *RedisObject) string {
+	switch obj.Type {
+	case OBJ_LIST:
+		return "quicklist"
+	case OBJ_SET:
+		return obj.Value.(*Set).Encoding()
+	case OBJ_ZSET:
+		return "skiplist"
+	case OBJ_HASH:
+		return "hashtable"
+	case OBJ_STREAM:
+		return "stream"
+	default:
+		return "raw"
+	}
+}
+
+// handleObject 处理 OBJECT 命令，目前支持 ENCODING 子命令
+func (rs *RedisServer) handleObject(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("object")
+	}
+	if strings.ToUpper(args[0]) != "ENCODING" {
+		return NewErrorValue("ERR unknown subcommand '" + args[0] + "'. Try OBJECT HELP.")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	obj := c.db.lookupKey(args[1])
+	if obj == nil {
+		return NewNullBulkStringValue()
+	}
+	return NewBulkStringValue(objectEncoding(obj))
+}
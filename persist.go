@@ -0,0 +1,231 @@
+package goredis
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Persister 是持久化的存储后端：RDB 快照的读写和 AOF 追加日志
+//
+// 服务器只通过它访问持久化文件，路径是 dir 配置下的 dbfilename 或 appendfilename，
+// 其他后端（如对象存储、另一块磁盘上的日志）可以把路径映射为自己的对象名。默认是 FilePersister，
+// 嵌入服务器的程序可以在 Start 之前用 SetPersister 换成其他实现，例如测试中使用 NopPersister；
+// 后端是 Go 的实现而不是配置项，以 Main 启动时在它的 setup 中设置。
+type Persister interface {
+	// ReadSnapshot 读取整个快照，快照不存在时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+	ReadSnapshot(path string) ([]byte, error)
+	// WriteSnapshot 由 write 写出新的快照，完成后原子地替换旧的快照；失败时旧的快照不受影响
+	WriteSnapshot(path string, write func(w io.Writer) error) error
+
+	// ReadLog 读取整个追加日志，日志不存在时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+	ReadLog(path string) ([]byte, error)
+	// TruncateLog 把日志截断到 size 字节，用于去掉加载时发现的不完整的命令
+	TruncateLog(path string, size int64) error
+	// OpenLog 打开已有的日志用于追加，返回日志和它现有的长度
+	OpenLog(path string) (AppendLog, int64, error)
+	// CreateLog 开始写一个新的日志（AOF 重写的结果），Commit 之前 path 上已有的日志不受影响
+	CreateLog(path string) (LogWriter, error)
+}
+
+// AppendLog 是打开用于追加的日志
+type AppendLog interface {
+	io.Writer
+	// Sync 把已写入的内容刷到持久存储
+	Sync() error
+	// Truncate 把日志截断到 size 字节，用于去掉写入了一部分的命令
+	Truncate(size int64) error
+	Close() error
+}
+
+// LogWriter 是正在写入的新日志
+type LogWriter interface {
+	io.Writer
+	// Sync 把已写入的内容刷到持久存储
+	Sync() error
+	// Commit 结束写入并用新日志原子地替换 path 上的日志，reopen 为 true 时返回向新日志追加的 AppendLog；
+	// 失败时新日志被丢弃
+	Commit(reopen bool) (AppendLog, error)
+	// Abort 丢弃新日志，可以在写入的 goroutine 之外调用，之后的 Commit 会失败
+	Abort()
+}
+
+// SetPersister 设置持久化的存储后端，需在 Start 之前调用：启动时从它加载数据集，
+// 之后的 SAVE、BGSAVE、AOF 和 --check-rdb/--check-aof 都使用它
+func (rs *RedisServer) SetPersister(p Persister) {
+	rs.persister = p
+}
+
+// FilePersister 是默认的存储后端，把快照和日志保存为本地文件
+//
+// 新的快照和日志先写入同一目录下的临时文件，刷到磁盘后再改名替换，
+// 因此写入失败或进程中途退出都不会破坏已有的文件。
+type FilePersister struct{}
+
+// ReadSnapshot 读取 RDB 文件
+func (FilePersister) ReadSnapshot(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// WriteSnapshot 把 RDB 内容写入临时文件，fsync 后改名为 path
+func (FilePersister) WriteSnapshot(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "temp-*.rdb")
+	if err != nil {
+		log.Printf("Failed opening the temp RDB file (in server root dir %s) for saving: %v", dir, err)
+		return err
+	}
+	tmp := f.Name()
+	w := bufio.NewWriterSize(f, 64*1024)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Printf("Write error saving DB on disk: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ReadLog 读取 AOF 文件
+func (FilePersister) ReadLog(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// TruncateLog 截断 AOF 文件
+func (FilePersister) TruncateLog(path string, size int64) error {
+	return os.Truncate(path, size)
+}
+
+// OpenLog 以追加方式打开 AOF 文件
+func (FilePersister) OpenLog(path string) (AppendLog, int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// CreateLog 在 AOF 文件所在的目录下创建临时文件
+func (FilePersister) CreateLog(path string) (LogWriter, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "temp-rewriteaof-bg-*.aof")
+	if err != nil {
+		log.Printf("Opening the temp file for AOF rewrite failed: %v", err)
+		return nil, err
+	}
+	return &fileLogWriter{File: f, path: path}, nil
+}
+
+// fileLogWriter 是正在写入的临时 AOF 文件
+type fileLogWriter struct {
+	*os.File
+	path string
+}
+
+// Commit 关闭临时文件并改名为 AOF 文件
+//
+// 需要继续追加时在改名之前打开，之后追加写入的就是改名后的 AOF 文件。
+func (lw *fileLogWriter) Commit(reopen bool) (AppendLog, error) {
+	tmp := lw.Name()
+	err := lw.Close()
+	var f *os.File
+	if err == nil && reopen {
+		f, err = os.OpenFile(tmp, os.O_WRONLY|os.O_APPEND, 0644)
+	}
+	if err == nil {
+		if err = os.Rename(tmp, lw.path); err != nil && f != nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		log.Printf("Error trying to rename the temporary AOF file %s into %s: %v", filepath.Base(tmp), filepath.Base(lw.path), err)
+		os.Remove(tmp)
+		return nil, err
+	}
+	if f == nil {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// Abort 删除临时文件，之后的改名因此失败
+func (lw *fileLogWriter) Abort() {
+	os.Remove(lw.Name())
+	lw.Close()
+}
+
+// NopPersister 是不保存任何内容的存储后端，用于测试或纯内存的部署
+//
+// 快照和日志总是不存在，写入的内容被丢弃，但快照仍然完整地序列化，写入的错误照常返回。
+type NopPersister struct{}
+
+// ReadSnapshot 返回 fs.ErrNotExist
+func (NopPersister) ReadSnapshot(path string) ([]byte, error) {
+	return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+}
+
+// WriteSnapshot 序列化快照并丢弃
+func (NopPersister) WriteSnapshot(path string, write func(w io.Writer) error) error {
+	return write(io.Discard)
+}
+
+// ReadLog 返回 fs.ErrNotExist
+func (NopPersister) ReadLog(path string) ([]byte, error) {
+	return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+}
+
+// TruncateLog 什么都不做
+func (NopPersister) TruncateLog(path string, size int64) error {
+	return nil
+}
+
+// OpenLog 返回丢弃写入内容的日志
+func (NopPersister) OpenLog(path string) (AppendLog, int64, error) {
+	return &nopLog{}, 0, nil
+}
+
+// CreateLog 返回丢弃写入内容的新日志
+func (NopPersister) CreateLog(path string) (LogWriter, error) {
+	return &nopLog{}, nil
+}
+
+// nopLog 丢弃写入的内容
+type nopLog struct {
+	aborted atomic.Bool
+}
+
+func (l *nopLog) Write(p []byte) (int, error) { return len(p), nil }
+func (l *nopLog) Sync() error                 { return nil }
+func (l *nopLog) Truncate(size int64) error   { return nil }
+func (l *nopLog) Close() error                { return nil }
+func (l *nopLog) Abort()                      { l.aborted.Store(true) }
+
+func (l *nopLog) Commit(reopen bool) (AppendLog, error) {
+	if l.aborted.Load() {
+		return nil, fs.ErrNotExist
+	}
+	if !reopen {
+		return nil, nil
+	}
+	return l, nil
+}
@@ -0,0 +1,186 @@
+package goredis
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestNopPersisterWritesNoFiles(t *testing.T) {
+	dir := testDir(t)
+	ts := startTestServerWith(t, dir, func(rs *RedisServer) {
+		rs.SetPersister(NopPersister{})
+	}, "appendonly yes", "appendfsync always")
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("OK", "SAVE")
+	c.mustDo("Background append only file rewriting started", "BGREWRITEAOF")
+	waitFor(t, "AOF rewrite to finish", func() bool { return !ts.rs.aofRewriteInProgress() })
+	c.mustDo("OK", "SET", "after", "rewrite")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() == "dump.rdb" || e.Name() == "appendonly.aof" {
+			t.Fatalf("%s was written", e.Name())
+		}
+	}
+}
+
+// memPersister 把快照和日志保存在内存中，同一个 memPersister 可以供重启后的服务器加载
+type memPersister struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newMemPersister() *memPersister {
+	return &memPersister{files: make(map[string][]byte)}
+}
+
+func (p *memPersister) read(path string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data, ok := p.files[path]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(data), nil
+}
+
+func (p *memPersister) ReadSnapshot(path string) ([]byte, error) { return p.read(path) }
+func (p *memPersister) ReadLog(path string) ([]byte, error)      { return p.read(path) }
+
+func (p *memPersister) WriteSnapshot(path string, write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[path] = buf.Bytes()
+	return nil
+}
+
+func (p *memPersister) TruncateLog(path string, size int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[path] = p.files[path][:size]
+	return nil
+}
+
+func (p *memPersister) OpenLog(path string) (AppendLog, int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return &memLog{p: p, path: path}, int64(len(p.files[path])), nil
+}
+
+func (p *memPersister) CreateLog(path string) (LogWriter, error) {
+	return &memLogWriter{p: p, path: path}, nil
+}
+
+// memLog 向 memPersister 中的日志追加
+type memLog struct {
+	p    *memPersister
+	path string
+}
+
+func (l *memLog) Write(b []byte) (int, error) {
+	l.p.mu.Lock()
+	defer l.p.mu.Unlock()
+	l.p.files[l.path] = append(l.p.files[l.path], b...)
+	return len(b), nil
+}
+
+func (l *memLog) Sync() error  { return nil }
+func (l *memLog) Close() error { return nil }
+
+func (l *memLog) Truncate(size int64) error { return l.p.TruncateLog(l.path, size) }
+
+// memLogWriter 在内存中写新的日志，Commit 时替换 memPersister 中的日志
+type memLogWriter struct {
+	p       *memPersister
+	path    string
+	buf     bytes.Buffer
+	aborted bool
+}
+
+func (w *memLogWriter) Write(b []byte) (int, error) { return w.buf.Write(b) }
+func (w *memLogWriter) Sync() error                 { return nil }
+
+func (w *memLogWriter) Abort() {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	w.aborted = true
+}
+
+func (w *memLogWriter) Commit(reopen bool) (AppendLog, error) {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	if w.aborted {
+		return nil, fs.ErrNotExist
+	}
+	w.p.files[w.path] = bytes.Clone(w.buf.Bytes())
+	if !reopen {
+		return nil, nil
+	}
+	return &memLog{p: w.p, path: w.path}, nil
+}
+
+func TestCustomPersister(t *testing.T) {
+	p := newMemPersister()
+	setup := func(rs *RedisServer) { rs.SetPersister(p) }
+	dir := testDir(t)
+	ts := startTestServerWith(t, dir, setup, "appendonly yes", "appendfsync always")
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("2", "RPUSH", "list", "a", "b")
+	c.mustDo("OK", "SAVE")
+	c.mustDo("Background append only file rewriting started", "BGREWRITEAOF")
+	waitFor(t, "AOF rewrite to finish", func() bool { return !ts.rs.aofRewriteInProgress() })
+	c.mustDo("OK", "SET", "after", "rewrite")
+
+	// 快照和日志都保存在 memPersister 中，重启后的服务器从中加载
+	p.mu.Lock()
+	files := len(p.files)
+	p.mu.Unlock()
+	if files != 2 {
+		t.Fatalf("persister holds %d files, want the RDB and the AOF", files)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("%d entries in dir, want only the config file", len(entries))
+	}
+	for _, conf := range []string{"appendonly yes", "appendonly no"} {
+		restarted := startTestServerWith(t, dir, setup, conf)
+		rc := restarted.connect(t)
+		rc.mustDo("v", "GET", "k")
+		rc.mustDo("[a b]", "LRANGE", "list", "0", "-1")
+		if conf == "appendonly yes" {
+			rc.mustDo("rewrite", "GET", "after")
+		} else {
+			rc.mustDo("(nil)", "GET", "after")
+		}
+	}
+}
+
+func TestMainSetupSelectsPersister(t *testing.T) {
+	stop := errors.New("stop before Start")
+	// setup 在加载配置文件之后、启动之前执行，设置的存储后端与配置一起生效
+	var got *RedisServer
+	err := Main([]string{writeConfig(t, "appendonly yes", "dbfilename snap.rdb")}, func(server *RedisServer) error {
+		server.SetPersister(NopPersister{})
+		got = server
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("Main returned %v", err)
+	}
+	if _, ok := got.persister.(NopPersister); !ok || !got.aofEnabled || got.dbfilename != "snap.rdb" {
+		t.Fatalf("server created with persister %T, appendonly %v, dbfilename %q", got.persister, got.aofEnabled, got.dbfilename)
+	}
+}
@@ -0,0 +1,56 @@
+package goredis
+
+// propagatedCommand 是一条要写入 AOF 和发送给副本的命令，dbid 是执行它的数据库，-1 表示与数据库无关（MULTI/EXEC）
+type propagatedCommand struct {
+	dbid int
+	argv []string
+}
+
+// alsoPropagate 把一条命令加入待传播的命令（调用方需持有 propagateMu 或命令写锁）
+//
+// 命令执行时只是加入列表，由 call 在命令结束后通过 propagatePending 一起传播。
+func (rs *RedisServer) alsoPropagate(dbid int, argv []string) {
+	rs.pendingPropagate = append(rs.pendingPropagate, propagatedCommand{dbid: dbid, argv: argv})
+}
+
+// propagatePending 传播当前命令产生的所有命令，然后清空列表（调用方需持有 propagateMu 或命令写锁）
+//
+// 事务和脚本中的多条命令包装在 MULTI/EXEC 中，重放时与原来一样原子地执行；只有一条时直接传播。
+func (rs *RedisServer) propagatePending() {
+	cmds := rs.pendingPropagate
+	if len(cmds) == 0 {
+		return
+	}
+	rs.pendingPropagate = nil
+	if len(cmds) > 1 {
+		wrapped := make([]propagatedCommand, 0, len(cmds)+2)
+		wrapped = append(wrapped, propagatedCommand{dbid: -1, argv: []string{"MULTI"}})
+		wrapped = append(wrapped, cmds...)
+		cmds = append(wrapped, propagatedCommand{dbid: -1, argv: []string{"EXEC"}})
+	}
+	rs.feedAppendOnlyFile(cmds)
+	rs.replicationFeedSlaves(cmds)
+}
+
+// rewriteArgv 把当前命令传播的参数改写为 argv，用于把结果不确定的命令（如 SPOP）
+// 改写为重放时结果相同的命令
+func (c *client) rewriteArgv(argv ...string) {
+	c.rewrittenArgv = argv
+}
+
+// preventPropagation 让当前命令不按自身传播，命令已经用 alsoPropagate 传播了等价的命令
+func (c *client) preventPropagation() {
+	c.preventPropagate = true
+}
+
+// propagateArgv 返回当前命令要传播的参数：改写过的参数，或者命令本身
+func (c *client) propagateArgv() []string {
+	if c.rewrittenArgv != nil {
+		return c.rewrittenArgv
+	}
+	argv := make([]string, len(c.current.Array))
+	for i, arg := range c.current.Array {
+		argv[i] = arg.Str
+	}
+	return argv
+}
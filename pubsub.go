@@ -0,0 +1,374 @@
+package goredis
+
+import "strings"
+
+// RESP2 客户端在订阅模式下允许执行的命令
+var subscribeModeCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ssubscribe":   true,
+	"sunsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+}
+
+// pubsubType 描述一类订阅：频道订阅、模式订阅或分片频道订阅
+//
+// 各类订阅的登记方式和确认消息的格式完全相同，只是保存在不同的表中。
+// 确认消息中的订阅数量，普通频道和模式合在一起计算，分片频道单独计算。
+type pubsubType struct {
+	subscribeMsg   string
+	unsubscribeMsg string
+	clientSubs     func(c *client) map[string]struct{}
+	serverSubs     func(rs *RedisServer) map[string]map[*client]struct{}
+	subscriptions  func(c *client) int
+}
+
+var (
+	pubsubChannelType = &pubsubType{
+		subscribeMsg:   "subscribe",
+		unsubscribeMsg: "unsubscribe",
+		clientSubs:     func(c *client) map[string]struct{} { return c.pubsubChannels },
+		serverSubs:     func(rs *RedisServer) map[string]map[*client]struct{} { return rs.pubsubChannels },
+		subscriptions:  (*client).subscriptionCount,
+	}
+	pubsubPatternType = &pubsubType{
+		subscribeMsg:   "psubscribe",
+		unsubscribeMsg: "punsubscribe",
+		clientSubs:     func(c *client) map[string]struct{} { return c.pubsubPatterns },
+		serverSubs:     func(rs *RedisServer) map[string]map[*client]struct{} { return rs.pubsubPatterns },
+		subscriptions:  (*client).subscriptionCount,
+	}
+	pubsubShardType = &pubsubType{
+		subscribeMsg:   "ssubscribe",
+		unsubscribeMsg: "sunsubscribe",
+		clientSubs:     func(c *client) map[string]struct{} { return c.pubsubShardChannels },
+		serverSubs:     func(rs *RedisServer) map[string]map[*client]struct{} { return rs.pubsubShardChannels },
+		subscriptions:  func(c *client) int { return len(c.pubsubShardChannels) },
+	}
+)
+
+// pubsubTypes 是所有订阅类型
+var pubsubTypes = []*pubsubType{pubsubChannelType, pubsubPatternType, pubsubShardType}
+
+// subscriptionCount 返回客户端的订阅总数，包括频道和模式（调用方需持有 pubsubMu）
+func (c *client) subscriptionCount() int {
+	return len(c.pubsubChannels) + len(c.pubsubPatterns)
+}
+
+// inSubscribeMode 判断客户端是否处于订阅模式
+//
+// RESP2 的订阅模式下连接只能用于接收消息以及管理订阅，其他命令会被拒绝。
+func (rs *RedisServer) inSubscribeMode(c *client) bool {
+	rs.pubsubMu.RLock()
+	defer rs.pubsubMu.RUnlock()
+	return c.subscriptionCount()+len(c.pubsubShardChannels) > 0
+}
+
+// subscribeModeError 返回订阅模式下执行其他命令的错误
+func subscribeModeError(name string) *RESPValue {
+	return NewErrorValue("ERR Can't execute '" + name +
+		"': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+}
+
+// subscriptionReply 构造订阅和取消订阅的确认消息，channel 为 nil 表示没有可取消的订阅
+//
+// 确认消息和发布的消息都使用推送类型，RESP2 客户端收到的仍然是数组。
+func subscriptionReply(kind string, channel *string, count int) *RESPValue {
+	ch := NewNullBulkStringValue()
+	if channel != nil {
+		ch = NewBulkStringValue(*channel)
+	}
+	return NewPushValue([]*RESPValue{
+		NewBulkStringValue(kind),
+		ch,
+		NewIntegerValue(int64(count)),
+	})
+}
+
+// pubsubSubscribe 订阅频道或模式，返回是否为新订阅（调用方需持有 pubsubMu 写锁）
+func (rs *RedisServer) pubsubSubscribe(c *client, t *pubsubType, name string) bool {
+	clientSubs := t.clientSubs(c)
+	if _, ok := clientSubs[name]; ok {
+		return false
+	}
+	clientSubs[name] = struct{}{}
+	serverSubs := t.serverSubs(rs)
+	subscribers := serverSubs[name]
+	if subscribers == nil {
+		subscribers = make(map[*client]struct{})
+		serverSubs[name] = subscribers
+	}
+	subscribers[c] = struct{}{}
+	c.setPubSub(true)
+	return true
+}
+
+// pubsubUnsubscribe 取消订阅频道或模式，返回之前是否订阅了它（调用方需持有 pubsubMu 写锁）
+func (rs *RedisServer) pubsubUnsubscribe(c *client, t *pubsubType, name string) bool {
+	clientSubs := t.clientSubs(c)
+	if _, ok := clientSubs[name]; !ok {
+		return false
+	}
+	delete(clientSubs, name)
+	serverSubs := t.serverSubs(rs)
+	subscribers := serverSubs[name]
+	delete(subscribers, c)
+	if len(subscribers) == 0 {
+		delete(serverSubs, name)
+	}
+	c.setPubSub(c.subscriptionCount()+len(c.pubsubShardChannels) > 0)
+	return true
+}
+
+// pubsubUnsubscribeAll 在连接断开时取消客户端的所有订阅
+func (rs *RedisServer) pubsubUnsubscribeAll(c *client) {
+	rs.pubsubMu.Lock()
+	defer rs.pubsubMu.Unlock()
+	for _, t := range pubsubTypes {
+		for name := range t.clientSubs(c) {
+			rs.pubsubUnsubscribe(c, t, name)
+		}
+	}
+}
+
+// subscribeCommand 实现 SUBSCRIBE 和 PSUBSCRIBE，对每个频道或模式单独发送一条确认消息
+func (rs *RedisServer) subscribeCommand(c *client, command *RESPValue, t *pubsubType) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError(t.subscribeMsg)
+	}
+
+	rs.pubsubMu.Lock()
+	defer rs.pubsubMu.Unlock()
+
+	replies := make([]*RESPValue, 0, len(args))
+	for _, name := range args {
+		rs.pubsubSubscribe(c, t, name)
+		replies = append(replies, subscriptionReply(t.subscribeMsg, &name, t.subscriptions(c)))
+	}
+	return sendSubscriptionReplies(c, replies)
+}
+
+// unsubscribeCommand 实现 UNSUBSCRIBE 和 PUNSUBSCRIBE，不带参数时取消该类的所有订阅
+func (rs *RedisServer) unsubscribeCommand(c *client, command *RESPValue, t *pubsubType) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.pubsubMu.Lock()
+	defer rs.pubsubMu.Unlock()
+
+	if len(args) == 0 {
+		clientSubs := t.clientSubs(c)
+		if len(clientSubs) == 0 {
+			return sendSubscriptionReplies(c, []*RESPValue{subscriptionReply(t.unsubscribeMsg, nil, t.subscriptions(c))})
+		}
+		for name := range clientSubs {
+			args = append(args, name)
+		}
+	}
+	replies := make([]*RESPValue, 0, len(args))
+	for _, name := range args {
+		rs.pubsubUnsubscribe(c, t, name)
+		replies = append(replies, subscriptionReply(t.unsubscribeMsg, &name, t.subscriptions(c)))
+	}
+	return sendSubscriptionReplies(c, replies)
+}
+
+// sendSubscriptionReplies 发送订阅和取消订阅的确认消息，每个频道或模式一条
+//
+// 事务中的确认消息不能抢在 EXEC 的回复之前发送，而是作为命令在 EXEC 回复中的结果：
+// 只有一条时就是这条消息，有多条时是它们组成的数组，RESP3 中同样以普通数组表示。
+func sendSubscriptionReplies(c *client, replies []*RESPValue) *RESPValue {
+	if !c.inExec {
+		for _, reply := range replies {
+			c.write(reply)
+		}
+		return nil
+	}
+	for i, reply := range replies {
+		replies[i] = NewArrayValue(reply.Array)
+	}
+	if len(replies) == 1 {
+		return replies[0]
+	}
+	return NewArrayValue(replies)
+}
+
+// handleSubscribe 处理 SUBSCRIBE 命令
+func (rs *RedisServer) handleSubscribe(c *client, command *RESPValue) *RESPValue {
+	return rs.subscribeCommand(c, command, pubsubChannelType)
+}
+
+// handleUnsubscribe 处理 UNSUBSCRIBE 命令
+func (rs *RedisServer) handleUnsubscribe(c *client, command *RESPValue) *RESPValue {
+	return rs.unsubscribeCommand(c, command, pubsubChannelType)
+}
+
+// handlePSubscribe 处理 PSUBSCRIBE 命令，模式使用与 KEYS 相同的 glob 语法
+func (rs *RedisServer) handlePSubscribe(c *client, command *RESPValue) *RESPValue {
+	return rs.subscribeCommand(c, command, pubsubPatternType)
+}
+
+// handlePUnsubscribe 处理 PUNSUBSCRIBE 命令
+func (rs *RedisServer) handlePUnsubscribe(c *client, command *RESPValue) *RESPValue {
+	return rs.unsubscribeCommand(c, command, pubsubPatternType)
+}
+
+// handleSSubscribe 处理 SSUBSCRIBE 命令
+func (rs *RedisServer) handleSSubscribe(c *client, command *RESPValue) *RESPValue {
+	return rs.subscribeCommand(c, command, pubsubShardType)
+}
+
+// handleSUnsubscribe 处理 SUNSUBSCRIBE 命令
+func (rs *RedisServer) handleSUnsubscribe(c *client, command *RESPValue) *RESPValue {
+	return rs.unsubscribeCommand(c, command, pubsubShardType)
+}
+
+// handlePublish 处理 PUBLISH 命令，返回收到消息的客户端数量
+func (rs *RedisServer) handlePublish(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("publish")
+	}
+	return NewIntegerValue(int64(rs.publish(args[0], args[1])))
+}
+
+// handleSPublish 处理 SPUBLISH 命令，消息只发给分片频道的订阅者
+func (rs *RedisServer) handleSPublish(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("spublish")
+	}
+
+	rs.pubsubMu.RLock()
+	defer rs.pubsubMu.RUnlock()
+
+	subscribers := rs.pubsubShardChannels[args[0]]
+	if len(subscribers) > 0 {
+		msg := NewPushValue([]*RESPValue{
+			NewBulkStringValue("smessage"),
+			NewBulkStringValue(args[0]),
+			NewBulkStringValue(args[1]),
+		})
+		for sub := range subscribers {
+			sub.write(msg)
+		}
+	}
+	return NewIntegerValue(int64(len(subscribers)))
+}
+
+// publish 向频道的订阅者以及匹配频道的模式的订阅者发送消息，返回接收次数
+//
+// 同一个客户端既订阅了频道又订阅了匹配的模式（或多个匹配的模式）时，会收到多条消息，
+// 每条都计入返回值，这与 Redis 的行为一致。
+func (rs *RedisServer) publish(channel, message string) int {
+	rs.pubsubMu.RLock()
+	defer rs.pubsubMu.RUnlock()
+
+	receivers := 0
+	if subscribers := rs.pubsubChannels[channel]; len(subscribers) > 0 {
+		msg := NewPushValue([]*RESPValue{
+			NewBulkStringValue("message"),
+			NewBulkStringValue(channel),
+			NewBulkStringValue(message),
+		})
+		for sub := range subscribers {
+			sub.write(msg)
+			receivers++
+		}
+	}
+	for pattern, subscribers := range rs.pubsubPatterns {
+		if !stringMatch(pattern, channel, false) {
+			continue
+		}
+		msg := NewPushValue([]*RESPValue{
+			NewBulkStringValue("pmessage"),
+			NewBulkStringValue(pattern),
+			NewBulkStringValue(channel),
+			NewBulkStringValue(message),
+		})
+		for sub := range subscribers {
+			sub.write(msg)
+			receivers++
+		}
+	}
+	return receivers
+}
+
+// handlePubSub 处理 PUBSUB 命令，支持 CHANNELS、NUMSUB、NUMPAT、SHARDCHANNELS 和 SHARDNUMSUB 子命令
+func (rs *RedisServer) handlePubSub(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("pubsub")
+	}
+
+	rs.pubsubMu.RLock()
+	defer rs.pubsubMu.RUnlock()
+
+	sub := strings.ToUpper(args[0])
+	switch sub {
+	case "CHANNELS":
+		// PUBSUB CHANNELS [pattern]：返回至少有一个订阅者的频道，不包括模式订阅
+		if len(args) > 2 {
+			return wrongArgsError("pubsub|channels")
+		}
+		return pubsubChannelList(rs.pubsubChannels, args[1:])
+	case "NUMSUB":
+		// PUBSUB NUMSUB [channel ...]：返回各频道的订阅者数量
+		return pubsubNumSub(rs.pubsubChannels, args[1:])
+	case "NUMPAT":
+		// PUBSUB NUMPAT：返回被订阅的模式数量
+		if len(args) != 1 {
+			return wrongArgsError("pubsub|numpat")
+		}
+		return NewIntegerValue(int64(len(rs.pubsubPatterns)))
+	case "SHARDCHANNELS":
+		// PUBSUB SHARDCHANNELS [pattern]：返回至少有一个订阅者的分片频道
+		if len(args) > 2 {
+			return wrongArgsError("pubsub|shardchannels")
+		}
+		return pubsubChannelList(rs.pubsubShardChannels, args[1:])
+	case "SHARDNUMSUB":
+		// PUBSUB SHARDNUMSUB [channel ...]：返回各分片频道的订阅者数量
+		return pubsubNumSub(rs.pubsubShardChannels, args[1:])
+	default:
+		return NewErrorValue("ERR unknown subcommand '" + args[0] + "'. Try PUBSUB HELP.")
+	}
+}
+
+// pubsubChannelList 返回订阅表中的频道名，pattern 非空时只返回匹配的频道
+func pubsubChannelList(subs map[string]map[*client]struct{}, pattern []string) *RESPValue {
+	channels := make([]*RESPValue, 0)
+	for channel := range subs {
+		if len(pattern) == 0 || stringMatch(pattern[0], channel, false) {
+			channels = append(channels, NewBulkStringValue(channel))
+		}
+	}
+	return NewArrayValue(channels)
+}
+
+// pubsubNumSub 以频道名、订阅者数量交替的形式返回各频道的订阅者数量
+func pubsubNumSub(subs map[string]map[*client]struct{}, channels []string) *RESPValue {
+	replies := make([]*RESPValue, 0, 2*len(channels))
+	for _, channel := range channels {
+		replies = append(replies, NewBulkStringValue(channel), NewIntegerValue(int64(len(subs[channel]))))
+	}
+	return NewArrayValue(replies)
+}
@@ -0,0 +1,137 @@
+package goredis
+
+import "testing"
+
+// expect 读取一条回复并检查其文本形式
+func (tc *testClient) expect(want string) {
+	tc.t.Helper()
+	if got := replyString(tc.read()); got != want {
+		tc.t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestSubscribeAndPublish(t *testing.T) {
+	ts := startTestServer(t)
+	sub, pub := ts.connect(t), ts.connect(t)
+	sub.send("SUBSCRIBE", "news", "sports")
+	sub.expect("[subscribe news 1]")
+	sub.expect("[subscribe sports 2]")
+
+	pub.mustDo("1", "PUBLISH", "news", "hello")
+	sub.expect("[message news hello]")
+	pub.mustDo("0", "PUBLISH", "weather", "rain")
+
+	// 订阅模式下只能执行订阅相关命令和 PING
+	sub.mustDo("(error) ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", "GET", "k")
+	sub.mustDo("[pong ]", "PING")
+	sub.mustDo("[pong hi]", "PING", "hi")
+
+	sub.mustDo("[unsubscribe news 1]", "UNSUBSCRIBE", "news")
+	pub.mustDo("0", "PUBLISH", "news", "hello")
+	sub.mustDo("[unsubscribe sports 0]", "UNSUBSCRIBE")
+	// 退出订阅模式后可以执行普通命令
+	sub.mustDo("(nil)", "GET", "k")
+	sub.mustDo("[unsubscribe (nil) 0]", "UNSUBSCRIBE")
+}
+
+func TestPublishReachesAllSubscribers(t *testing.T) {
+	ts := startTestServer(t)
+	pub := ts.connect(t)
+	subs := []*testClient{ts.connect(t), ts.connect(t), ts.connect(t)}
+	for _, sub := range subs {
+		sub.mustDo("[subscribe ch 1]", "SUBSCRIBE", "ch")
+	}
+	pub.mustDo("3", "PUBLISH", "ch", "m")
+	for _, sub := range subs {
+		sub.expect("[message ch m]")
+	}
+
+	// 断开连接的订阅者不再计数
+	subs[0].conn.Close()
+	waitFor(t, "subscriber to be removed", func() bool {
+		return replyString(pub.do("PUBLISH", "ch", "m")) == "2"
+	})
+}
+
+func TestPatternSubscribe(t *testing.T) {
+	ts := startTestServer(t)
+	sub, pub := ts.connect(t), ts.connect(t)
+	sub.mustDo("[psubscribe news.* 1]", "PSUBSCRIBE", "news.*")
+	sub.mustDo("[subscribe news.tech 2]", "SUBSCRIBE", "news.tech")
+
+	// 同时订阅了频道和匹配模式时收到两条消息，都计入返回值
+	pub.mustDo("2", "PUBLISH", "news.tech", "go")
+	sub.expect("[message news.tech go]")
+	sub.expect("[pmessage news.* news.tech go]")
+	pub.mustDo("1", "PUBLISH", "news.art", "paint")
+	sub.expect("[pmessage news.* news.art paint]")
+	pub.mustDo("0", "PUBLISH", "weather", "rain")
+
+	sub.mustDo("[punsubscribe news.* 1]", "PUNSUBSCRIBE")
+	pub.mustDo("1", "PUBLISH", "news.tech", "go")
+	sub.expect("[message news.tech go]")
+	// PUNSUBSCRIBE 不影响频道订阅
+	sub.mustDo("[punsubscribe (nil) 1]", "PUNSUBSCRIBE")
+	sub.mustDo("[unsubscribe news.tech 0]", "UNSUBSCRIBE")
+}
+
+func TestPubSubIntrospection(t *testing.T) {
+	ts := startTestServer(t)
+	s1, s2, c := ts.connect(t), ts.connect(t), ts.connect(t)
+	s1.send("SUBSCRIBE", "a", "b")
+	s1.expect("[subscribe a 1]")
+	s1.expect("[subscribe b 2]")
+	s2.mustDo("[subscribe a 1]", "SUBSCRIBE", "a")
+	s2.mustDo("[psubscribe x* 2]", "PSUBSCRIBE", "x*")
+	s1.mustDo("[psubscribe x* 3]", "PSUBSCRIBE", "x*")
+
+	c.mustDoSorted("[a b]", "PUBSUB", "CHANNELS")
+	c.mustDo("[b]", "PUBSUB", "CHANNELS", "b*")
+	c.mustDo("[a 2 b 1 c 0]", "PUBSUB", "NUMSUB", "a", "b", "c")
+	c.mustDo("[]", "PUBSUB", "NUMSUB")
+	// 同一个模式只计数一次
+	c.mustDo("1", "PUBSUB", "NUMPAT")
+
+	s1.mustDo("[unsubscribe b 2]", "UNSUBSCRIBE", "b")
+	c.mustDo("[a]", "PUBSUB", "CHANNELS")
+	c.mustDo("(error) ERR unknown subcommand 'FOO'. Try PUBSUB HELP.", "PUBSUB", "FOO")
+}
+
+func TestShardedPubSub(t *testing.T) {
+	ts := startTestServer(t)
+	sub, pub := ts.connect(t), ts.connect(t)
+	sub.mustDo("[subscribe ch 1]", "SUBSCRIBE", "ch")
+	// 分片频道的确认消息只计算分片频道
+	sub.mustDo("[ssubscribe ch 1]", "SSUBSCRIBE", "ch")
+
+	// 分片频道与普通频道是独立的命名空间
+	pub.mustDo("1", "SPUBLISH", "ch", "s")
+	sub.expect("[smessage ch s]")
+	pub.mustDo("1", "PUBLISH", "ch", "p")
+	sub.expect("[message ch p]")
+
+	pub.mustDo("[ch]", "PUBSUB", "SHARDCHANNELS")
+	pub.mustDo("[ch 1 x 0]", "PUBSUB", "SHARDNUMSUB", "ch", "x")
+	sub.mustDo("[sunsubscribe ch 0]", "SUNSUBSCRIBE")
+	pub.mustDo("0", "SPUBLISH", "ch", "s")
+	pub.mustDo("1", "PUBLISH", "ch", "p")
+	sub.expect("[message ch p]")
+}
+
+func TestSubscribeInTransaction(t *testing.T) {
+	ts := startTestServer(t)
+	sub, pub := ts.connect(t), ts.connect(t)
+	sub.mustDo("OK", "MULTI")
+	sub.mustDo("QUEUED", "SUBSCRIBE", "a", "b")
+	sub.mustDo("QUEUED", "PSUBSCRIBE", "x*")
+	sub.mustDo("QUEUED", "SSUBSCRIBE", "s")
+	// 确认消息是各命令在 EXEC 回复中的结果，多个频道时是确认消息组成的数组
+	sub.mustDo("[[[subscribe a 1] [subscribe b 2]] [psubscribe x* 3] [ssubscribe s 1]]", "EXEC")
+
+	pub.mustDo("1", "PUBLISH", "a", "m")
+	sub.expect("[message a m]")
+	pub.mustDo("1", "SPUBLISH", "s", "n")
+	sub.expect("[smessage s n]")
+
+	sub.mustDo("[unsubscribe a 2]", "UNSUBSCRIBE", "a")
+}
@@ -0,0 +1,2033 @@
+package goredis
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RDB 格式的版本和操作码，与 Redis 7.2 相同
+const (
+	RDB_VERSION              = 11
+	RDB_OPCODE_SLOT_INFO     = 244
+	RDB_OPCODE_FUNCTION2     = 245
+	RDB_OPCODE_FUNCTION_PRE  = 246
+	RDB_OPCODE_MODULE_AUX    = 247
+	RDB_OPCODE_IDLE          = 248
+	RDB_OPCODE_FREQ          = 249
+	RDB_OPCODE_AUX           = 250
+	RDB_OPCODE_RESIZEDB      = 251
+	RDB_OPCODE_EXPIRETIME_MS = 252
+	RDB_OPCODE_EXPIRETIME    = 253
+	RDB_OPCODE_SELECTDB      = 254
+	RDB_OPCODE_EOF           = 255
+)
+
+// RDB 中值的类型
+const (
+	RDB_TYPE_STRING             = 0
+	RDB_TYPE_LIST               = 1
+	RDB_TYPE_SET                = 2
+	RDB_TYPE_ZSET               = 3
+	RDB_TYPE_HASH               = 4
+	RDB_TYPE_ZSET_2             = 5
+	RDB_TYPE_MODULE_2           = 7
+	RDB_TYPE_HASH_ZIPMAP        = 9
+	RDB_TYPE_LIST_ZIPLIST       = 10
+	RDB_TYPE_SET_INTSET         = 11
+	RDB_TYPE_ZSET_ZIPLIST       = 12
+	RDB_TYPE_HASH_ZIPLIST       = 13
+	RDB_TYPE_LIST_QUICKLIST     = 14
+	RDB_TYPE_STREAM_LISTPACKS   = 15
+	RDB_TYPE_HASH_LISTPACK      = 16
+	RDB_TYPE_ZSET_LISTPACK      = 17
+	RDB_TYPE_LIST_QUICKLIST_2   = 18
+	RDB_TYPE_STREAM_LISTPACKS_2 = 19
+	RDB_TYPE_SET_LISTPACK       = 20
+	RDB_TYPE_STREAM_LISTPACKS_3 = 21
+)
+
+// RDB_TYPE_LIST_QUICKLIST_2 中节点的类型：单独保存的一个大元素，或者是 listpack
+const (
+	QUICKLIST_NODE_CONTAINER_PLAIN  = 1
+	QUICKLIST_NODE_CONTAINER_PACKED = 2
+)
+
+// 模块类型的值由一串操作码和数据组成，以 RDB_MODULE_OPCODE_EOF 结束
+const (
+	RDB_MODULE_OPCODE_EOF    = 0
+	RDB_MODULE_OPCODE_UINT   = 2
+	RDB_MODULE_OPCODE_DOUBLE = 4
+	RDB_MODULE_OPCODE_STRING = 5
+)
+
+// 流节点 listpack 中条目的标志
+const (
+	STREAM_ITEM_FLAG_DELETED    = 1
+	STREAM_ITEM_FLAG_SAMEFIELDS = 2
+)
+
+// Count-Min Sketch 和 Top-K 在 RDB 中作为模块类型保存。哈希函数和内部布局与 RedisBloom 不同，
+// 因此使用自己的类型名，避免被 RedisBloom 误读
+const (
+	rdbModuleNameCMS  = "goredisCM"
+	rdbModuleNameTopK = "goredisTK"
+	rdbModuleEncver   = 0
+)
+
+// RDB 长度编码的前两位
+const (
+	RDB_6BITLEN  = 0
+	RDB_14BITLEN = 1
+	RDB_32BITLEN = 0x80
+	RDB_64BITLEN = 0x81
+	RDB_ENCVAL   = 3
+)
+
+// 前两位为 RDB_ENCVAL 时字符串的特殊编码：8、16、32 位整数和 LZF 压缩
+const (
+	RDB_ENC_INT8  = 0
+	RDB_ENC_INT16 = 1
+	RDB_ENC_INT32 = 2
+	RDB_ENC_LZF   = 3
+)
+
+// errRdbShort 表示数据在一个完整的值之前结束
+var errRdbShort = errors.New("unexpected end of RDB data")
+
+// crc64Table 是 Redis 使用的 CRC-64/Jones 多项式（反射形式）的查找表
+var crc64Table = crc64.MakeTable(0x95AC9329AC4BC9B5)
+
+// crc64Jones 计算与 Redis 的 crc64 相同的校验和，初值和结果都不取反
+func crc64Jones(crc uint64, data []byte) uint64 {
+	for _, b := range data {
+		crc = crc64Table[byte(crc)^b] ^ (crc >> 8)
+	}
+	return crc
+}
+
+// rdbAppendLen 以 RDB 的长度编码追加 n
+func rdbAppendLen(buf []byte, n uint64) []byte {
+	switch {
+	case n < 1<<6:
+		return append(buf, byte(n))
+	case n < 1<<14:
+		return append(buf, byte(n>>8)|RDB_14BITLEN<<6, byte(n))
+	case n <= 0xffffffff:
+		buf = append(buf, RDB_32BITLEN)
+		return binary.BigEndian.AppendUint32(buf, uint32(n))
+	default:
+		buf = append(buf, RDB_64BITLEN)
+		return binary.BigEndian.AppendUint64(buf, n)
+	}
+}
+
+// rdbAppendDumpFooter 追加 DUMP 类载荷的尾部：2 字节 RDB 版本和 8 字节 CRC64，均为小端
+func rdbAppendDumpFooter(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, RDB_VERSION)
+	return binary.LittleEndian.AppendUint64(buf, crc64Jones(0, buf))
+}
+
+// rdbVerifyDumpPayload 校验 DUMP 类载荷的版本和 CRC64，返回去掉尾部后的数据
+func rdbVerifyDumpPayload(payload []byte) ([]byte, bool) {
+	if len(payload) < 10 {
+		return nil, false
+	}
+	footer := payload[len(payload)-10:]
+	if binary.LittleEndian.Uint16(footer) > RDB_VERSION {
+		return nil, false
+	}
+	if binary.LittleEndian.Uint64(footer[2:]) != crc64Jones(0, payload[:len(payload)-8]) {
+		return nil, false
+	}
+	return payload[:len(payload)-10], true
+}
+
+// errDumpPayload 表示 DUMP 载荷的版本或校验和不正确
+var errDumpPayload = errors.New("DUMP payload version or checksum are wrong")
+
+// rdbDumpObject 以 DUMP 的格式序列化一个值：RDB 类型、RDB 编码的值，以及 RDB 版本和 CRC64
+func rdbDumpObject(obj *RedisObject, compress bool) []byte {
+	e := &rdbEncoder{compress: compress}
+	e.buf = append(e.buf, rdbObjectType(obj))
+	e.appendObject(obj)
+	return rdbAppendDumpFooter(e.buf)
+}
+
+// rdbRestoreObject 解析 DUMP 生成的载荷，版本或校验和不正确时返回 errDumpPayload
+//
+// 值的内容有误、载荷中还有多余的数据或者是空的集合类型时返回其他错误。
+func rdbRestoreObject(payload []byte) (*RedisObject, error) {
+	data, ok := rdbVerifyDumpPayload(payload)
+	if !ok {
+		return nil, errDumpPayload
+	}
+	l := &rdbLoader{
+		rdbReader: rdbReader{data: data},
+		version:   int(binary.LittleEndian.Uint16(payload[len(data):])),
+		now:       time.Now().UnixMilli(),
+	}
+	rdbType, err := l.readByte()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := l.readObject(rdbType)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil || !l.eof() {
+		return nil, errors.New("bad data format")
+	}
+	return obj, nil
+}
+
+// rdbReader 从内存中的 RDB 数据依次读取值
+type rdbReader struct {
+	data []byte
+	pos  int
+}
+
+// readByte 读取一个字节
+func (r *rdbReader) readByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errRdbShort
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+// readBytes 读取 n 个字节
+func (r *rdbReader) readBytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, errRdbShort
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// readLen 读取 RDB 长度编码的整数
+func (r *rdbReader) readLen() (uint64, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b>>6 == RDB_6BITLEN:
+		return uint64(b & 0x3f), nil
+	case b>>6 == RDB_14BITLEN:
+		next, err := r.readByte()
+		if err != nil {
+			return 0, err
+		}
+		return uint64(b&0x3f)<<8 | uint64(next), nil
+	case b == RDB_32BITLEN:
+		buf, err := r.readBytes(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(buf)), nil
+	case b == RDB_64BITLEN:
+		buf, err := r.readBytes(8)
+		if err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(buf), nil
+	default:
+		return 0, errors.New("unknown RDB length encoding")
+	}
+}
+
+// readString 读取字符串，可以是带长度前缀的原始字符串，也可以是整数编码或 LZF 压缩的字符串
+func (r *rdbReader) readString() (string, error) {
+	if r.pos < len(r.data) && r.data[r.pos]>>6 == RDB_ENCVAL {
+		return r.readEncodedString()
+	}
+	n, err := r.readLen()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.readBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// readEncodedString 读取前两位为 RDB_ENCVAL 的特殊编码字符串
+func (r *rdbReader) readEncodedString() (string, error) {
+	b, _ := r.readByte()
+	var size uint64
+	switch b & 0x3f {
+	case RDB_ENC_INT8:
+		size = 1
+	case RDB_ENC_INT16:
+		size = 2
+	case RDB_ENC_INT32:
+		size = 4
+	case RDB_ENC_LZF:
+		clen, err := r.readLen()
+		if err != nil {
+			return "", err
+		}
+		n, err := r.readLen()
+		if err != nil {
+			return "", err
+		}
+		compressed, err := r.readBytes(clen)
+		if err != nil {
+			return "", err
+		}
+		if n > math.MaxInt32 {
+			return "", errLzfCorrupt
+		}
+		data, err := lzfDecompress(compressed, int(n))
+		return string(data), err
+	default:
+		return "", fmt.Errorf("Unknown RDB string encoding type %d", b&0x3f)
+	}
+	buf, err := r.readBytes(size)
+	if err != nil {
+		return "", err
+	}
+	var u uint64
+	for i := len(buf) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(buf[i])
+	}
+	shift := 64 - 8*size
+	return strconv.FormatInt(int64(u<<shift)>>shift, 10), nil
+}
+
+// readUint64 读取 8 字节小端整数
+func (r *rdbReader) readUint64() (uint64, error) {
+	buf, err := r.readBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+// readDouble 读取 8 字节小端 IEEE 754 浮点数
+func (r *rdbReader) readDouble() (float64, error) {
+	u, err := r.readUint64()
+	return math.Float64frombits(u), err
+}
+
+// readStringDouble 读取旧格式（RDB_TYPE_ZSET）中以文本保存的浮点数，
+// 长度字节 253、254、255 分别表示 NaN、+inf 和 -inf
+func (r *rdbReader) readStringDouble() (float64, error) {
+	n, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	buf, err := r.readBytes(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(string(buf), 64)
+	if err != nil {
+		return 0, errors.New("invalid double value")
+	}
+	return f, nil
+}
+
+// readStreamID 读取 16 字节大端格式的流 ID
+func (r *rdbReader) readStreamID() (streamID, error) {
+	buf, err := r.readBytes(16)
+	if err != nil {
+		return streamID{}, err
+	}
+	return streamID{binary.BigEndian.Uint64(buf), binary.BigEndian.Uint64(buf[8:])}, nil
+}
+
+// readLenID 读取以两个长度编码整数保存的流 ID
+func (r *rdbReader) readLenID() (streamID, error) {
+	ms, err := r.readLen()
+	if err != nil {
+		return streamID{}, err
+	}
+	seq, err := r.readLen()
+	return streamID{ms, seq}, err
+}
+
+// eof 判断数据是否已读完
+func (r *rdbReader) eof() bool {
+	return r.pos >= len(r.data)
+}
+
+// rdbModuleID 按 Redis 的规则把 9 个字符的模块类型名和编码版本打包成 64 位的模块 ID
+func rdbModuleID(name string, encver int) uint64 {
+	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	var id uint64
+	for i := 0; i < len(name); i++ {
+		id = id<<6 | uint64(strings.IndexByte(charset, name[i]))
+	}
+	return id<<10 | uint64(encver)
+}
+
+// rdbEncoder 以 RDB 格式把值追加到 buf，compress 对应 rdbcompression 配置
+type rdbEncoder struct {
+	buf      []byte
+	compress bool
+}
+
+// appendLen 以 RDB 的长度编码追加 n
+func (e *rdbEncoder) appendLen(n uint64) {
+	e.buf = rdbAppendLen(e.buf, n)
+}
+
+// appendString 追加字符串，编码方式见 rdbEncodeString
+func (e *rdbEncoder) appendString(s string) {
+	rdbEncodeString(e, s)
+}
+
+// appendBytes 追加以字节切片保存的字符串
+func (e *rdbEncoder) appendBytes(b []byte) {
+	rdbEncodeString(e, b)
+}
+
+// rdbEncodeString 与 Redis 的 rdbSaveRawString 相同：不超过 11 个字符、能表示为 32 位整数的
+// 规范整数字符串以整数编码保存；开启压缩时超过 20 字节的字符串尝试 LZF 压缩，
+// 至少省下 4 字节才使用压缩结果；其余保存为带长度前缀的原始字符串
+func rdbEncodeString[T string | []byte](e *rdbEncoder, s T) {
+	if len(s) <= 11 {
+		if v, err := strconv.ParseInt(string(s), 10, 32); err == nil && strconv.FormatInt(v, 10) == string(s) {
+			e.appendEncodedInt(v)
+			return
+		}
+	}
+	if e.compress && len(s) > 20 {
+		if compressed := lzfCompress([]byte(s), len(s)-4); compressed != nil {
+			e.buf = append(e.buf, RDB_ENCVAL<<6|RDB_ENC_LZF)
+			e.appendLen(uint64(len(compressed)))
+			e.appendLen(uint64(len(s)))
+			e.buf = append(e.buf, compressed...)
+			return
+		}
+	}
+	e.appendLen(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// appendEncodedInt 以最短的整数编码追加 32 位范围内的整数
+func (e *rdbEncoder) appendEncodedInt(v int64) {
+	switch {
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		e.buf = append(e.buf, RDB_ENCVAL<<6|RDB_ENC_INT8, byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		e.buf = append(e.buf, RDB_ENCVAL<<6|RDB_ENC_INT16)
+		e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(v))
+	default:
+		e.buf = append(e.buf, RDB_ENCVAL<<6|RDB_ENC_INT32)
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(v))
+	}
+}
+
+// appendDouble 以 8 字节小端 IEEE 754 格式追加浮点数
+func (e *rdbEncoder) appendDouble(f float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+// appendMillis 以 8 字节小端整数追加毫秒时间
+func (e *rdbEncoder) appendMillis(ms int64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(ms))
+}
+
+// appendStreamID 以 16 字节大端格式追加流 ID，与 Redis 基数树中的键相同
+func (e *rdbEncoder) appendStreamID(id streamID) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, id.ms)
+	e.buf = binary.BigEndian.AppendUint64(e.buf, id.seq)
+}
+
+// rdbObjectType 返回值在 RDB 中的类型
+func rdbObjectType(obj *RedisObject) byte {
+	switch obj.Type {
+	case OBJ_STRING:
+		return RDB_TYPE_STRING
+	case OBJ_LIST:
+		return RDB_TYPE_LIST
+	case OBJ_SET:
+		return RDB_TYPE_SET
+	case OBJ_ZSET:
+		return RDB_TYPE_ZSET_2
+	case OBJ_HASH:
+		return RDB_TYPE_HASH
+	case OBJ_STREAM:
+		return RDB_TYPE_STREAM_LISTPACKS_3
+	case OBJ_CMS, OBJ_TOPK:
+		return RDB_TYPE_MODULE_2
+	default:
+		panic(fmt.Sprintf("unknown object type %d", obj.Type))
+	}
+}
+
+// appendObject 追加值的内容，类型由 rdbObjectType 给出
+func (e *rdbEncoder) appendObject(obj *RedisObject) {
+	switch obj.Type {
+	case OBJ_STRING:
+		e.appendBytes(obj.Value.([]byte))
+	case OBJ_LIST:
+		list := obj.Value.(*List)
+		e.appendLen(uint64(list.Len()))
+		list.Iterate(false, func(_ int, value string) bool {
+			e.appendString(value)
+			return true
+		})
+	case OBJ_SET:
+		set := obj.Value.(*Set)
+		e.appendLen(uint64(set.Len()))
+		set.Iterate(func(member string) bool {
+			e.appendString(member)
+			return true
+		})
+	case OBJ_ZSET:
+		// 与 Redis 一样按分数从高到低保存，加载时从低分端插入跳表更快
+		zset := obj.Value.(*ZSet)
+		e.appendLen(uint64(zset.Len()))
+		for _, entry := range zset.RangeByRank(0, zset.Len()-1, true) {
+			e.appendString(entry.member)
+			e.appendDouble(entry.score)
+		}
+	case OBJ_HASH:
+		hash := obj.Value.(*Hash)
+		e.appendLen(uint64(hash.Len()))
+		hash.Iterate(func(field, value string) bool {
+			e.appendString(field)
+			e.appendString(value)
+			return true
+		})
+	case OBJ_STREAM:
+		e.appendStream(obj.Value.(*Stream))
+	case OBJ_CMS:
+		e.appendCMS(obj.Value.(*CountMinSketch))
+	case OBJ_TOPK:
+		e.appendTopK(obj.Value.(*TopK))
+	default:
+		panic(fmt.Sprintf("unknown object type %d", obj.Type))
+	}
+}
+
+// appendStream 按 RDB_TYPE_STREAM_LISTPACKS_3 的格式追加流
+//
+// 每个节点保存为以首个条目 ID 为键的 listpack，首个条目的字段名作为主字段，
+// 字段名与之相同的条目只保存值。之后是长度、各个 ID 和消费者组。
+func (e *rdbEncoder) appendStream(s *Stream) {
+	e.appendLen(uint64(len(s.nodes)))
+	for _, node := range s.nodes {
+		master := node.entries[0]
+		e.appendLen(16)
+		e.appendStreamID(master.id)
+		e.appendBytes(rdbStreamListpack(node))
+	}
+
+	e.appendLen(uint64(s.length))
+	e.appendLen(s.lastID.ms)
+	e.appendLen(s.lastID.seq)
+	first, _ := s.firstEntry()
+	e.appendLen(first.id.ms)
+	e.appendLen(first.id.seq)
+	// 没有 XDEL，不存在删除过的最大 ID
+	e.appendLen(0)
+	e.appendLen(0)
+	e.appendLen(s.entriesAdded)
+
+	names := s.groupNames()
+	e.appendLen(uint64(len(names)))
+	for _, name := range names {
+		cg := s.cgroups[name]
+		e.appendString(name)
+		e.appendLen(cg.lastID.ms)
+		e.appendLen(cg.lastID.seq)
+		e.appendLen(uint64(cg.entriesRead))
+
+		e.appendLen(uint64(cg.pel.Len()))
+		cg.pel.Ascend(streamID{}, func(id streamID, nack *streamNACK) bool {
+			e.appendStreamID(id)
+			e.appendMillis(nack.deliveryTime)
+			e.appendLen(uint64(nack.deliveryCount))
+			return true
+		})
+
+		consumers := cg.consumerNames()
+		e.appendLen(uint64(len(consumers)))
+		for _, cname := range consumers {
+			consumer := cg.consumers[cname]
+			e.appendString(cname)
+			e.appendMillis(consumer.seenTime)
+			e.appendMillis(consumer.activeTime)
+			// 消费者的 PEL 只保存 ID，投递信息在组的 PEL 中
+			e.appendLen(uint64(consumer.pel.Len()))
+			consumer.pel.Ascend(streamID{}, func(id streamID, _ *streamNACK) bool {
+				e.appendStreamID(id)
+				return true
+			})
+		}
+	}
+}
+
+// rdbStreamListpack 把流节点编码为 Redis 流使用的 listpack
+//
+// 开头是主条目：有效条目数、已删除条目数、主字段数、各主字段名和结束标记 0。
+// 之后每个条目依次是标志、相对主 ID 的毫秒差和序号差、字段（或只有值），
+// 最后是条目的元素个数（不含自身），用于反向遍历。
+func rdbStreamListpack(node *streamNode) []byte {
+	lp := newListpackWriter()
+	master := node.entries[0]
+	masterFields := len(master.fields) / 2
+	lp.appendInt(int64(len(node.entries)))
+	lp.appendInt(0)
+	lp.appendInt(int64(masterFields))
+	for i := 0; i < len(master.fields); i += 2 {
+		lp.appendString(master.fields[i])
+	}
+	lp.appendInt(0)
+
+	for _, entry := range node.entries {
+		numFields := len(entry.fields) / 2
+		sameFields := numFields == masterFields
+		for i := 0; sameFields && i < len(entry.fields); i += 2 {
+			sameFields = entry.fields[i] == master.fields[i]
+		}
+
+		lpCount := int64(numFields) + 3
+		if sameFields {
+			lp.appendInt(STREAM_ITEM_FLAG_SAMEFIELDS)
+		} else {
+			lp.appendInt(0)
+			lpCount += int64(numFields) + 1
+		}
+		lp.appendInt(int64(entry.id.ms - master.id.ms))
+		lp.appendInt(int64(entry.id.seq - master.id.seq))
+		if sameFields {
+			for i := 1; i < len(entry.fields); i += 2 {
+				lp.appendString(entry.fields[i])
+			}
+		} else {
+			lp.appendInt(int64(numFields))
+			for _, field := range entry.fields {
+				lp.appendString(field)
+			}
+		}
+		lp.appendInt(lpCount)
+	}
+	return lp.bytes()
+}
+
+// appendModuleUint 追加模块值中的无符号整数
+func (e *rdbEncoder) appendModuleUint(n uint64) {
+	e.appendLen(RDB_MODULE_OPCODE_UINT)
+	e.appendLen(n)
+}
+
+// appendModuleDouble 追加模块值中的浮点数
+func (e *rdbEncoder) appendModuleDouble(f float64) {
+	e.appendLen(RDB_MODULE_OPCODE_DOUBLE)
+	e.appendDouble(f)
+}
+
+// appendModuleString 追加模块值中的字符串
+func (e *rdbEncoder) appendModuleString(s []byte) {
+	e.appendLen(RDB_MODULE_OPCODE_STRING)
+	e.appendBytes(s)
+}
+
+// appendCMS 追加 Count-Min Sketch：宽度、深度、总计数，以及小端 32 位计数器组成的字符串
+func (e *rdbEncoder) appendCMS(cms *CountMinSketch) {
+	e.appendLen(rdbModuleID(rdbModuleNameCMS, rdbModuleEncver))
+	e.appendModuleUint(cms.width)
+	e.appendModuleUint(cms.depth)
+	e.appendModuleUint(cms.count)
+	counters := make([]byte, 0, 4*len(cms.counters))
+	for _, counter := range cms.counters {
+		counters = binary.LittleEndian.AppendUint32(counters, counter)
+	}
+	e.appendModuleString(counters)
+	e.appendLen(RDB_MODULE_OPCODE_EOF)
+}
+
+// appendTopK 追加 Top-K：参数、衰减的伪随机数发生器状态、所有桶（小端的 64 位指纹和 32 位计数），
+// 以及堆中非空的元素（指纹、计数和元素本身）
+func (e *rdbEncoder) appendTopK(topk *TopK) {
+	e.appendLen(rdbModuleID(rdbModuleNameTopK, rdbModuleEncver))
+	e.appendModuleUint(uint64(topk.k))
+	e.appendModuleUint(topk.width)
+	e.appendModuleUint(topk.depth)
+	e.appendModuleDouble(topk.decay)
+	e.appendModuleUint(topk.rng)
+	buckets := make([]byte, 0, 12*len(topk.buckets))
+	for _, bucket := range topk.buckets {
+		buckets = binary.LittleEndian.AppendUint64(buckets, bucket.fp)
+		buckets = binary.LittleEndian.AppendUint32(buckets, bucket.count)
+	}
+	e.appendModuleString(buckets)
+
+	var entries []topkHeapEntry
+	for _, entry := range topk.heap {
+		if entry.item != nil {
+			entries = append(entries, entry)
+		}
+	}
+	e.appendModuleUint(uint64(len(entries)))
+	for _, entry := range entries {
+		e.appendModuleUint(entry.fp)
+		e.appendModuleUint(uint64(entry.count))
+		e.appendModuleString(entry.item)
+	}
+	e.appendLen(RDB_MODULE_OPCODE_EOF)
+}
+
+// appendAux 追加一个辅助字段
+func (e *rdbEncoder) appendAux(key, value string) {
+	e.buf = append(e.buf, RDB_OPCODE_AUX)
+	e.appendString(key)
+	e.appendString(value)
+}
+
+// rdbAppendFunctions 按库名顺序追加所有函数库，每个库是 FUNCTION2 操作码和库代码
+func (rs *RedisServer) rdbAppendFunctions(e *rdbEncoder) {
+	names := make([]string, 0, len(rs.libraries))
+	for name := range rs.libraries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e.buf = append(e.buf, RDB_OPCODE_FUNCTION2)
+		e.appendString(rs.libraries[name].code)
+	}
+}
+
+// rdbSaveInfo 是全量同步的 RDB 中与复制有关的辅助字段
+//
+// replid 和 offset 是快照对应的复制 ID 和复制偏移量，streamDB 是这时命令流选择的数据库：
+// 副本的命令流转发自它的主节点，快照之后不一定以 SELECT 开始，它的副本加载快照后从这个数据库开始执行。
+type rdbSaveInfo struct {
+	streamDB int
+	replid   string
+	offset   int64
+}
+
+// rdbEncodeHeader 返回 RDB 文件开头的部分：魔数和版本、辅助字段和函数库，aofBase 表示用作 AOF 文件的 RDB 前导部分，
+// rsi 不为 nil 时还有复制的辅助字段
+func (rs *RedisServer) rdbEncodeHeader(aofBase bool, rsi *rdbSaveInfo) *rdbEncoder {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	e := &rdbEncoder{buf: []byte(fmt.Sprintf("REDIS%04d", RDB_VERSION)), compress: rs.rdbCompression}
+	e.appendAux("redis-ver", redisVersion)
+	e.appendAux("redis-bits", strconv.Itoa(strconv.IntSize))
+	e.appendAux("ctime", strconv.FormatInt(time.Now().Unix(), 10))
+	e.appendAux("used-mem", strconv.FormatUint(mem.HeapAlloc, 10))
+	if aofBase {
+		e.appendAux("aof-base", "1")
+	} else {
+		e.appendAux("aof-base", "0")
+	}
+	if rsi != nil {
+		e.appendAux("repl-stream-db", strconv.Itoa(rsi.streamDB))
+		e.appendAux("repl-id", rsi.replid)
+		e.appendAux("repl-offset", strconv.FormatInt(rsi.offset, 10))
+	}
+
+	rs.rdbAppendFunctions(e)
+	return e
+}
+
+// appendSelectDB 追加数据库的开头：SELECTDB 和 RESIZEDB，size 是其中键的数量，expires 是其中有过期时间的键的数量
+func (e *rdbEncoder) appendSelectDB(id, size, expires int) {
+	e.buf = append(e.buf, RDB_OPCODE_SELECTDB)
+	e.appendLen(uint64(id))
+	e.buf = append(e.buf, RDB_OPCODE_RESIZEDB)
+	e.appendLen(uint64(size))
+	e.appendLen(uint64(expires))
+}
+
+// appendExpireTime 在键值对之前追加键的过期时间（EXPIRETIME_MS 和小端的 Unix 毫秒），when 为负数表示没有过期时间
+func (e *rdbEncoder) appendExpireTime(when int64) {
+	if when < 0 {
+		return
+	}
+	e.buf = append(e.buf, RDB_OPCODE_EXPIRETIME_MS)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(when))
+}
+
+// appendEntry 追加一个键值对：类型、键和值
+func (e *rdbEncoder) appendEntry(key string, obj *RedisObject) {
+	e.buf = append(e.buf, rdbObjectType(obj))
+	e.appendString(key)
+	e.appendObject(obj)
+}
+
+// rdbEncode 把整个数据集序列化为 RDB 文件的内容，aofBase 表示用作 AOF 文件的 RDB 前导部分
+//
+// 依次是魔数和版本、辅助字段、函数库、各个非空数据库的键值对、EOF 和 CRC64 校验和。
+// 调用方需持有命令锁（读锁即可）和服务器读锁，得到的是某一时刻的一致视图。
+func (rs *RedisServer) rdbEncode(aofBase bool) []byte {
+	e := rs.rdbEncodeHeader(aofBase, nil)
+	for _, db := range rs.databases {
+		if db.store.Len() == 0 {
+			continue
+		}
+		e.appendSelectDB(db.id, db.store.Len(), db.store.ExpiresLen())
+		db.store.ForEach(func(key string, obj *RedisObject) {
+			e.appendExpireTime(db.store.GetExpire(key))
+			e.appendEntry(key, obj)
+		})
+	}
+
+	e.buf = append(e.buf, RDB_OPCODE_EOF)
+	var checksum uint64
+	if rs.rdbChecksum {
+		checksum = crc64Jones(0, e.buf)
+	}
+	return binary.LittleEndian.AppendUint64(e.buf, checksum)
+}
+
+// defaultDir 返回 dir 配置的默认值，即启动时的工作目录
+func defaultDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	return dir
+}
+
+// rdbSnapshot 在持有服务器读锁时序列化数据集，同时取得保存的目录、文件名和此时的修改次数
+func (rs *RedisServer) rdbSnapshot() (data []byte, dir, filename string, dirty int64) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	return rs.rdbEncode(false), rs.dir, rs.dbfilename, rs.dirty.Load()
+}
+
+// rdbWriteFile 通过存储后端把 RDB 内容保存为 dir 下的 filename，替换已有的 RDB 文件
+func (rs *RedisServer) rdbWriteFile(dir, filename string, data []byte) error {
+	return rs.rdbWriteFileFunc(dir, filename, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// rdbWriteFileFunc 与 rdbWriteFile 相同，RDB 的内容由 write 逐步写入
+func (rs *RedisServer) rdbWriteFileFunc(dir, filename string, write func(w io.Writer) error) error {
+	return rs.persister.WriteSnapshot(filepath.Join(dir, filename), write)
+}
+
+// errRdbSaveInProgress 表示已有 SAVE 或 BGSAVE 在进行
+var errRdbSaveInProgress = errors.New("Background save already in progress")
+
+// rdbSave 同步保存 RDB 文件，成功后记录快照包含的修改次数并更新上次保存时间
+//
+// SAVE、BGSAVE 和自动保存通过 rdbSaving 串行执行，快照之后的修改仍然计入 dirty - savedDirty。
+func (rs *RedisServer) rdbSave() error {
+	if !rs.rdbSaving.CompareAndSwap(false, true) {
+		return errRdbSaveInProgress
+	}
+	defer rs.rdbSaving.Store(false)
+
+	data, dir, filename, dirty := rs.rdbSnapshot()
+	rs.rdbFileMu.Lock()
+	err := rs.rdbWriteFile(dir, filename, data)
+	rs.rdbFileMu.Unlock()
+	if err != nil {
+		return err
+	}
+	log.Println("DB saved on disk")
+	rs.savedDirty.Store(dirty)
+	rs.lastSave.Store(time.Now().Unix())
+	rs.lastBgsaveOK.Store(true)
+	rs.rdbSaves.Add(1)
+	return nil
+}
+
+// rdbSaveBackground 取得数据集的写时复制快照，然后在后台 goroutine 中序列化并写入 RDB 文件
+//
+// 调用方需持有命令锁（读锁即可），事务和脚本不会执行到一半，得到的是一致的快照。
+// 取得快照只需在持有服务器读锁时复制键的列表，序列化和写入磁盘期间写命令照常执行，
+// 快照中的对象在第一次被修改之前先被序列化，见 rdbCowSnapshot。
+func (rs *RedisServer) rdbSaveBackground() error {
+	return rs.rdbSaveBackgroundNotify(nil, nil)
+}
+
+// rdbSaveBackgroundNotify 与 rdbSaveBackground 相同，rsi 不为 nil 时写入复制的辅助字段，
+// done 不为 nil 时在保存结束后以保存的内容调用它
+//
+// 用于全量同步：写入文件的同时把 RDB 记在内存中，之后不必再读取文件，期间替换了文件也不影响
+// 发送给副本的快照。保存失败时以 nil 调用 done。
+func (rs *RedisServer) rdbSaveBackgroundNotify(rsi *rdbSaveInfo, done func(rdb []byte)) error {
+	if !rs.rdbSaving.CompareAndSwap(false, true) {
+		return errRdbSaveInProgress
+	}
+	start := time.Now().Unix()
+	rs.bgsaveScheduled.Store(false)
+	rs.lastBgsaveTry.Store(start)
+	rs.rdbBgsaveStart.Store(start)
+
+	rs.mutex.RLock()
+	snapshot := rs.newRdbCowSnapshot(rsi)
+	dir, filename, dirty := rs.dir, rs.dbfilename, rs.dirty.Load()
+	rs.mutex.RUnlock()
+	log.Println("Background saving started")
+	go func() {
+		defer rs.rdbSaving.Store(false)
+		defer func() {
+			rs.rdbLastBgsaveTime.Store(time.Now().Unix() - start)
+			rs.rdbBgsaveStart.Store(0)
+		}()
+		defer snapshot.release()
+		rs.rdbFileMu.Lock()
+		defer rs.rdbFileMu.Unlock()
+		write := snapshot.writeTo
+		var buf bytes.Buffer
+		if done != nil {
+			write = func(w io.Writer) error { return snapshot.writeTo(io.MultiWriter(w, &buf)) }
+		}
+		if err := rs.rdbWriteFileFunc(dir, filename, write); err != nil {
+			log.Println("Background saving error")
+			rs.lastBgsaveOK.Store(false)
+			if done != nil {
+				done(nil)
+			}
+			return
+		}
+		log.Println("DB saved on disk")
+		log.Println("Background saving terminated with success")
+		rs.savedDirty.Store(dirty)
+		rs.lastSave.Store(time.Now().Unix())
+		rs.lastBgsaveOK.Store(true)
+		rs.rdbSaves.Add(1)
+		if done != nil {
+			done(buf.Bytes())
+		}
+	}()
+	return nil
+}
+
+// rdbSaveBackgroundStream 与 rdbSaveBackgroundNotify 一样在后台保存快照，但不写入 RDB 文件，
+// 而是调用 save，由它用 writeTo 把快照写到需要的地方（无盘复制时是副本的连接）
+//
+// 快照没有保存到磁盘，不改变上次保存的时间和结果，也不影响自动保存的条件。
+func (rs *RedisServer) rdbSaveBackgroundStream(rsi *rdbSaveInfo, save func(writeTo func(io.Writer) error)) error {
+	if !rs.rdbSaving.CompareAndSwap(false, true) {
+		return errRdbSaveInProgress
+	}
+	start := time.Now().Unix()
+	rs.rdbBgsaveStart.Store(start)
+
+	rs.mutex.RLock()
+	snapshot := rs.newRdbCowSnapshot(rsi)
+	rs.mutex.RUnlock()
+	go func() {
+		defer rs.rdbSaving.Store(false)
+		defer func() {
+			rs.rdbLastBgsaveTime.Store(time.Now().Unix() - start)
+			rs.rdbBgsaveStart.Store(0)
+		}()
+		defer snapshot.release()
+		save(snapshot.writeTo)
+	}()
+	return nil
+}
+
+// handleSave 处理 SAVE 命令，同步地把数据集保存到 RDB 文件，完成后才回复
+func (rs *RedisServer) handleSave(c *client, command *RESPValue) *RESPValue {
+	if err := rs.rdbSave(); err != nil {
+		if err == errRdbSaveInProgress {
+			return NewErrorValue("ERR " + err.Error())
+		}
+		return NewErrorValue("ERR")
+	}
+	return NewSimpleStringValue("OK")
+}
+
+// handleLastSave 处理 LASTSAVE 命令，返回上次成功保存 RDB 文件的 Unix 时间（秒）
+//
+// 没有保存过时是服务器启动的时间。
+func (rs *RedisServer) handleLastSave(c *client, command *RESPValue) *RESPValue {
+	return NewIntegerValue(rs.lastSave.Load())
+}
+
+// handleBgsave 处理 BGSAVE [SCHEDULE] 命令，在后台把数据集保存到 RDB 文件
+//
+// 同一时刻只能有一个保存或 AOF 重写在进行。指定 SCHEDULE 时，已有保存或重写在进行不报错，
+// 而是在它结束后由 serverCron 开始新的后台保存。
+func (rs *RedisServer) handleBgsave(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) > 1 || (len(args) == 1 && !strings.EqualFold(args[0], "SCHEDULE")) {
+		return NewErrorValue("ERR syntax error")
+	}
+	schedule := len(args) == 1
+	if rs.aofRewriteInProgress() {
+		if schedule {
+			rs.bgsaveScheduled.Store(true)
+			return NewSimpleStringValue("Background saving scheduled")
+		}
+		return NewErrorValue("ERR Another child process is active (AOF?): can't BGSAVE right now. Use BGSAVE SCHEDULE in order to schedule a BGSAVE whenever possible.")
+	}
+	if err := rs.rdbSaveBackground(); err != nil {
+		if schedule {
+			rs.bgsaveScheduled.Store(true)
+			return NewSimpleStringValue("Background saving scheduled")
+		}
+		return NewErrorValue("ERR " + err.Error())
+	}
+	return NewSimpleStringValue("Background saving started")
+}
+
+// CONFIG_BGSAVE_RETRY_DELAY 是后台保存失败后，自动保存再次尝试之前等待的秒数
+const CONFIG_BGSAVE_RETRY_DELAY = 5
+
+// saveParam 是一条自动保存规则：距上次保存超过 seconds 秒且至少有 changes 次修改时保存
+type saveParam struct {
+	seconds int64
+	changes int64
+}
+
+// defaultSaveParams 是 save 配置的默认值，与 Redis 7 相同
+var defaultSaveParams = []saveParam{{3600, 1}, {300, 100}, {60, 10000}}
+
+// serverCron 每 100 毫秒执行一次周期性任务：主动删除过期的键，按 save 规则和 BGSAVE SCHEDULE 开始后台保存，
+// 开始推迟的和自动的 AOF 重写，服务条件已经满足的 WAIT 和 WAITAOF（例如 AOF 重写完成后新文件已经 fsync），
+// 每秒一次重试失败的 AOF 写入和在后台 fsync AOF 文件
+func (rs *RedisServer) serverCron() {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for tick := 1; ; tick++ {
+		<-ticker.C
+		rs.activeExpireCycle()
+		rs.rdbSaveCron()
+		rs.aofRewriteCron()
+		rs.handleClientsWaitingAcks()
+		if tick%10 == 0 {
+			rs.aofCron()
+			rs.replicationCron()
+		}
+	}
+}
+
+// rdbSaveCron 在没有保存和 AOF 重写进行时检查是否需要开始后台保存
+//
+// 上次后台保存失败时，要等 CONFIG_BGSAVE_RETRY_DELAY 秒之后才会再次尝试。
+func (rs *RedisServer) rdbSaveCron() {
+	if rs.rdbSaving.Load() || rs.aofRewriteInProgress() {
+		return
+	}
+	now := time.Now().Unix()
+	canRetry := rs.lastBgsaveOK.Load() || now-rs.lastBgsaveTry.Load() > CONFIG_BGSAVE_RETRY_DELAY
+	if !canRetry {
+		return
+	}
+
+	var trigger *saveParam
+	if !rs.bgsaveScheduled.Load() {
+		dirty, elapsed := rs.dirty.Load()-rs.savedDirty.Load(), now-rs.lastSave.Load()
+		rs.mutex.RLock()
+		for _, sp := range rs.saveParams {
+			if dirty >= sp.changes && elapsed > sp.seconds {
+				trigger = &sp
+				break
+			}
+		}
+		rs.mutex.RUnlock()
+		if trigger == nil {
+			return
+		}
+	}
+
+	// 与命令一样取得命令锁，脚本超时时跳过这一次
+	if run := rs.lockExec(false); run != nil {
+		return
+	}
+	defer rs.unlockExec(false)
+	if trigger != nil {
+		log.Printf("%d changes in %d seconds. Saving...", trigger.changes, trigger.seconds)
+	}
+	rs.rdbSaveBackground()
+}
+
+// parseSaveParams 解析 save 配置：成对的秒数和修改次数，空字符串表示关闭自动保存
+func parseSaveParams(value string) ([]saveParam, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return nil, errors.New("Invalid save parameters")
+	}
+	params := make([]saveParam, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err1 := strconv.ParseInt(fields[i], 10, 64)
+		changes, err2 := strconv.ParseInt(fields[i+1], 10, 64)
+		if err1 != nil || err2 != nil || seconds < 0 || changes < 0 {
+			return nil, errors.New("Invalid save parameters")
+		}
+		params = append(params, saveParam{seconds: seconds, changes: changes})
+	}
+	return params, nil
+}
+
+// formatSaveParams 按配置的格式输出自动保存规则
+func formatSaveParams(params []saveParam) string {
+	parts := make([]string, 0, 2*len(params))
+	for _, sp := range params {
+		parts = append(parts, strconv.FormatInt(sp.seconds, 10), strconv.FormatInt(sp.changes, 10))
+	}
+	return strings.Join(parts, " ")
+}
+
+// loadDataFromDisk 在启动时加载 dir 下的数据文件：开启了 AOF 并且 AOF 文件存在时重放 AOF 文件，
+// 否则加载 RDB 文件，文件不存在时以空数据集启动
+//
+// 加载的数据集与磁盘上的文件一致，加载时的修改不计入尚未保存的修改。
+func (rs *RedisServer) loadDataFromDisk() error {
+	defer func() { rs.savedDirty.Store(rs.dirty.Load()) }()
+	if rs.aofEnabled {
+		path := filepath.Join(rs.dir, rs.aofFilename)
+		data, err := rs.persister.ReadLog(path)
+		if !errors.Is(err, fs.ErrNotExist) {
+			if err != nil {
+				return fmt.Errorf("Fatal error: can't open the append log file %s for reading: %v", path, err)
+			}
+			return rs.loadAppendOnlyFile(path, data)
+		}
+	}
+
+	path := filepath.Join(rs.dir, rs.dbfilename)
+	data, err := rs.persister.ReadSnapshot(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Fatal error loading the DB: %v. Exiting.", err)
+	}
+	start := time.Now()
+	if _, err := rs.rdbLoad(data, nil); err != nil {
+		return fmt.Errorf("Error loading RDB file %s: %v", path, err)
+	}
+	log.Printf("DB loaded from disk: %.3f seconds", time.Since(start).Seconds())
+	return nil
+}
+
+// rdbLoader 解析 RDB 文件时的状态
+type rdbLoader struct {
+	rdbReader
+	version   int
+	now       int64
+	stores    []*keyspace
+	functions []string
+	rsi       *rdbSaveInfo
+
+	// keepExpired 为 true 时已经过期的键照常加载，见 rdbLoad
+	keepExpired bool
+}
+
+// rdbLoad 从 RDB 文件的内容恢复数据集和函数库，返回 RDB 数据（到校验和为止）的长度，
+// 调用方需保证服务器中还没有数据
+//
+// 所有键先加载到新的键空间中，整个文件（包括末尾的校验和）检查通过后才替换各数据库，
+// 出错时返回的错误带有出错位置的偏移量。AOF 文件的 RDB 前导部分之后还有命令，由调用方处理。
+//
+// 与 Redis 一样，主节点不再加载已经过期的键；副本保留它们，等待主节点传播的 DEL。
+func (rs *RedisServer) rdbLoad(data []byte, rsi *rdbSaveInfo) (int, error) {
+	rs.replMu.Lock()
+	replica := rs.masterHost != ""
+	rs.replMu.Unlock()
+	return rs.rdbLoadKeepExpired(data, rsi, replica)
+}
+
+// rdbLoadKeepExpired 与 rdbLoad 相同，keepExpired 为 true 时已经过期的键也照常加载
+func (rs *RedisServer) rdbLoadKeepExpired(data []byte, rsi *rdbSaveInfo, keepExpired bool) (int, error) {
+	if len(data) < 9 || string(data[:5]) != "REDIS" {
+		return 0, errors.New("Wrong signature trying to load DB from file")
+	}
+	version, err := strconv.Atoi(string(data[5:9]))
+	if err != nil || version < 1 || version > RDB_VERSION {
+		return 0, fmt.Errorf("Can't handle RDB format version %s", data[5:9])
+	}
+
+	l := &rdbLoader{
+		rdbReader: rdbReader{data: data, pos: 9},
+		version:   version,
+		now:       time.Now().UnixMilli(),
+		stores:    make([]*keyspace, len(rs.databases)),
+		rsi:       rsi,
+
+		keepExpired: keepExpired,
+	}
+	for i := range l.stores {
+		l.stores[i] = newKeyspace()
+	}
+	if err := l.load(); err != nil {
+		return 0, fmt.Errorf("%v (at offset %d)", err, l.pos)
+	}
+
+	for _, code := range l.functions {
+		if _, errResp := rs.functionsCreateLibrary(code, false); errResp != nil {
+			return 0, fmt.Errorf("Failed loading library: %s", errResp.Str)
+		}
+	}
+	for i, db := range rs.databases {
+		db.store = l.stores[i]
+	}
+	return l.pos, nil
+}
+
+// load 依次读取操作码和键值对直到 EOF，然后校验 CRC64
+func (l *rdbLoader) load() error {
+	db := 0
+	var expireAt int64 = -1
+	for {
+		opcode, err := l.readByte()
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case RDB_OPCODE_EXPIRETIME_MS:
+			var ms uint64
+			ms, err = l.readUint64()
+			expireAt = int64(ms)
+		case RDB_OPCODE_EXPIRETIME:
+			var buf []byte
+			if buf, err = l.readBytes(4); err == nil {
+				expireAt = int64(binary.LittleEndian.Uint32(buf)) * 1000
+			}
+		case RDB_OPCODE_IDLE:
+			_, err = l.readLen()
+		case RDB_OPCODE_FREQ:
+			_, err = l.readByte()
+		case RDB_OPCODE_SELECTDB:
+			var id uint64
+			if id, err = l.readLen(); err == nil && id >= uint64(len(l.stores)) {
+				return fmt.Errorf("Data file was created with a Redis server configured to handle more than %d databases", len(l.stores))
+			}
+			db = int(id)
+		case RDB_OPCODE_RESIZEDB:
+			if _, err = l.readLen(); err == nil {
+				_, err = l.readLen()
+			}
+		case RDB_OPCODE_SLOT_INFO:
+			for i := 0; i < 3 && err == nil; i++ {
+				_, err = l.readLen()
+			}
+		case RDB_OPCODE_AUX:
+			var key, value string
+			if key, err = l.readString(); err == nil {
+				value, err = l.readString()
+			}
+			switch key {
+			case "redis-ver":
+				log.Printf("Loading RDB produced by version %s", value)
+			case "ctime":
+				if ctime, err := strconv.ParseInt(value, 10, 64); err == nil {
+					log.Printf("RDB age %d seconds", l.now/1000-ctime)
+				}
+			case "repl-stream-db":
+				if id, err := strconv.Atoi(value); err == nil && l.rsi != nil && id >= 0 && id < len(l.stores) {
+					l.rsi.streamDB = id
+				}
+			case "repl-id":
+				if l.rsi != nil {
+					l.rsi.replid = value
+				}
+			case "repl-offset":
+				if offset, err := strconv.ParseInt(value, 10, 64); err == nil && l.rsi != nil {
+					l.rsi.offset = offset
+				}
+			}
+		case RDB_OPCODE_FUNCTION2:
+			var code string
+			code, err = l.readString()
+			l.functions = append(l.functions, code)
+		case RDB_OPCODE_FUNCTION_PRE:
+			return errors.New("Pre-release function format not supported")
+		case RDB_OPCODE_MODULE_AUX:
+			return errors.New("The RDB file contains AUX module data I can't load")
+		case RDB_OPCODE_EOF:
+			return l.verifyChecksum()
+		default:
+			key, err := l.readString()
+			if err != nil {
+				return err
+			}
+			obj, err := l.readObject(opcode)
+			if err != nil {
+				return fmt.Errorf("Error loading key '%s': %v", key, err)
+			}
+			if l.stores[db].Get(key) != nil {
+				return fmt.Errorf("Duplicate key '%s' found in RDB file", key)
+			}
+			// 与 Redis 一样跳过空的集合类型，以及（除非 keepExpired）已经过期的键
+			switch {
+			case obj == nil:
+				log.Printf("Empty key '%s' in RDB file skipped", key)
+			case expireAt >= 0 && expireAt < l.now && !l.keepExpired:
+			default:
+				l.stores[db].Set(key, obj)
+				if expireAt >= 0 {
+					l.stores[db].SetExpire(key, expireAt)
+				}
+			}
+			expireAt = -1
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// verifyChecksum 读取 EOF 之后的 CRC64 并校验，版本 5 之前的文件没有校验和，为 0 表示保存时未计算
+func (l *rdbLoader) verifyChecksum() error {
+	if l.version < 5 {
+		return nil
+	}
+	expected := crc64Jones(0, l.data[:l.pos])
+	checksum, err := l.readUint64()
+	if err != nil {
+		return err
+	}
+	if checksum != 0 && checksum != expected {
+		return fmt.Errorf("Wrong RDB checksum expected: (%016x) got (%016x)", checksum, expected)
+	}
+	return nil
+}
+
+// readObject 读取 rdbType 类型的值，空的集合类型返回 nil
+//
+// 除本服务器保存的类型外，还支持 Redis 各版本使用的紧凑编码（intset、ziplist、listpack
+// 和 quicklist），加载后转换为对应的数据结构。
+func (l *rdbLoader) readObject(rdbType byte) (*RedisObject, error) {
+	switch rdbType {
+	case RDB_TYPE_STRING:
+		str, err := l.readString()
+		if err != nil {
+			return nil, err
+		}
+		return &RedisObject{Type: OBJ_STRING, Value: []byte(str)}, nil
+	case RDB_TYPE_LIST, RDB_TYPE_SET:
+		n, err := l.readLen()
+		if err != nil {
+			return nil, err
+		}
+		var elems []string
+		for i := uint64(0); i < n; i++ {
+			elem, err := l.readString()
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		if rdbType == RDB_TYPE_LIST {
+			return rdbListObject(elems), nil
+		}
+		return rdbSetObject(elems)
+	case RDB_TYPE_ZSET, RDB_TYPE_ZSET_2:
+		n, err := l.readLen()
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		obj := NewZSetObject()
+		for i := uint64(0); i < n; i++ {
+			member, err := l.readString()
+			if err != nil {
+				return nil, err
+			}
+			var score float64
+			if rdbType == RDB_TYPE_ZSET_2 {
+				score, err = l.readDouble()
+			} else {
+				score, err = l.readStringDouble()
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := rdbZSetAdd(obj.Value.(*ZSet), member, score); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	case RDB_TYPE_LIST_ZIPLIST, RDB_TYPE_SET_INTSET, RDB_TYPE_SET_LISTPACK, RDB_TYPE_ZSET_ZIPLIST, RDB_TYPE_ZSET_LISTPACK:
+		blob, err := l.readString()
+		if err != nil {
+			return nil, err
+		}
+		var elems []string
+		switch rdbType {
+		case RDB_TYPE_SET_INTSET:
+			elems, err = intsetDecode([]byte(blob))
+		case RDB_TYPE_SET_LISTPACK, RDB_TYPE_ZSET_LISTPACK:
+			elems, err = listpackDecode([]byte(blob))
+		default:
+			elems, err = ziplistDecode([]byte(blob))
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch rdbType {
+		case RDB_TYPE_LIST_ZIPLIST:
+			return rdbListObject(elems), nil
+		case RDB_TYPE_SET_INTSET, RDB_TYPE_SET_LISTPACK:
+			return rdbSetObject(elems)
+		default:
+			return rdbZSetObject(elems)
+		}
+	case RDB_TYPE_LIST_QUICKLIST, RDB_TYPE_LIST_QUICKLIST_2:
+		return l.readQuicklist(rdbType)
+	case RDB_TYPE_HASH:
+		n, err := l.readLen()
+		if err != nil {
+			return nil, err
+		}
+		var elems []string
+		for i := uint64(0); i < 2*n; i++ {
+			elem, err := l.readString()
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return rdbHashObject(elems)
+	case RDB_TYPE_HASH_ZIPMAP, RDB_TYPE_HASH_ZIPLIST, RDB_TYPE_HASH_LISTPACK:
+		blob, err := l.readString()
+		if err != nil {
+			return nil, err
+		}
+		var elems []string
+		switch rdbType {
+		case RDB_TYPE_HASH_ZIPMAP:
+			elems, err = zipmapDecode([]byte(blob))
+		case RDB_TYPE_HASH_ZIPLIST:
+			elems, err = ziplistDecode([]byte(blob))
+		default:
+			elems, err = listpackDecode([]byte(blob))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return rdbHashObject(elems)
+	case RDB_TYPE_STREAM_LISTPACKS, RDB_TYPE_STREAM_LISTPACKS_2, RDB_TYPE_STREAM_LISTPACKS_3:
+		s, err := l.readStream(rdbType)
+		if err != nil {
+			return nil, err
+		}
+		return &RedisObject{Type: OBJ_STREAM, Value: s}, nil
+	case RDB_TYPE_MODULE_2:
+		return l.readModule()
+	default:
+		return nil, fmt.Errorf("Unknown RDB encoding type %d", rdbType)
+	}
+}
+
+// readQuicklist 读取 quicklist 编码的列表：若干节点，每个节点是一个 ziplist；
+// RDB_TYPE_LIST_QUICKLIST_2 的节点是 listpack，或者是单独保存的一个大元素（PLAIN）
+func (l *rdbLoader) readQuicklist(rdbType byte) (*RedisObject, error) {
+	n, err := l.readLen()
+	if err != nil {
+		return nil, err
+	}
+	var elems []string
+	for i := uint64(0); i < n; i++ {
+		container := uint64(QUICKLIST_NODE_CONTAINER_PACKED)
+		if rdbType == RDB_TYPE_LIST_QUICKLIST_2 {
+			if container, err = l.readLen(); err != nil {
+				return nil, err
+			}
+			if container != QUICKLIST_NODE_CONTAINER_PLAIN && container != QUICKLIST_NODE_CONTAINER_PACKED {
+				return nil, errors.New("Quicklist integrity check failed")
+			}
+		}
+		blob, err := l.readString()
+		if err != nil {
+			return nil, err
+		}
+		if container == QUICKLIST_NODE_CONTAINER_PLAIN {
+			elems = append(elems, blob)
+			continue
+		}
+		var node []string
+		if rdbType == RDB_TYPE_LIST_QUICKLIST_2 {
+			node, err = listpackDecode([]byte(blob))
+		} else {
+			node, err = ziplistDecode([]byte(blob))
+		}
+		if err != nil {
+			return nil, err
+		}
+		// 与 Redis 一样跳过空节点
+		elems = append(elems, node...)
+	}
+	return rdbListObject(elems), nil
+}
+
+// rdbListObject 用加载的元素创建列表，没有元素时返回 nil
+func rdbListObject(elems []string) *RedisObject {
+	if len(elems) == 0 {
+		return nil
+	}
+	obj := NewListObject()
+	list := obj.Value.(*List)
+	for _, elem := range elems {
+		list.PushRight(elem)
+	}
+	return obj
+}
+
+// rdbSetObject 用加载的元素创建集合，没有元素时返回 nil
+func rdbSetObject(elems []string) (*RedisObject, error) {
+	if len(elems) == 0 {
+		return nil, nil
+	}
+	obj := NewSetObject()
+	set := obj.Value.(*Set)
+	for _, elem := range elems {
+		if !set.Add(elem) {
+			return nil, errors.New("Duplicate set members detected")
+		}
+	}
+	return obj, nil
+}
+
+// rdbHashObject 用交替排列的字段和值创建哈希，没有字段时返回 nil
+func rdbHashObject(elems []string) (*RedisObject, error) {
+	if len(elems)%2 != 0 {
+		return nil, errors.New("Hash listpack integrity check failed")
+	}
+	if len(elems) == 0 {
+		return nil, nil
+	}
+	obj := NewHashObject()
+	hash := obj.Value.(*Hash)
+	for i := 0; i < len(elems); i += 2 {
+		if !hash.Set(elems[i], elems[i+1]) {
+			return nil, errors.New("Duplicate hash fields detected")
+		}
+	}
+	return obj, nil
+}
+
+// rdbZSetObject 用紧凑编码中交替排列的成员和分数创建有序集合，没有元素时返回 nil
+func rdbZSetObject(elems []string) (*RedisObject, error) {
+	if len(elems)%2 != 0 {
+		return nil, errors.New("Zset listpack integrity check failed")
+	}
+	if len(elems) == 0 {
+		return nil, nil
+	}
+	obj := NewZSetObject()
+	for i := 0; i < len(elems); i += 2 {
+		score, err := strconv.ParseFloat(elems[i+1], 64)
+		if err != nil {
+			return nil, errors.New("Zset listpack integrity check failed")
+		}
+		if err := rdbZSetAdd(obj.Value.(*ZSet), elems[i], score); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// rdbZSetAdd 向加载中的有序集合添加成员，拒绝 NaN 分数和重复的成员
+func rdbZSetAdd(zset *ZSet, member string, score float64) error {
+	if math.IsNaN(score) {
+		return errors.New("Zset with NAN score detected")
+	}
+	if !zset.Add(member, score) {
+		return errors.New("Duplicate zset fields detected")
+	}
+	return nil
+}
+
+// intsetDecode 校验并解码 intset：4 字节的元素宽度（2、4 或 8）、4 字节的元素个数，
+// 之后是按升序排列的小端整数，都以十进制文本返回
+func intsetDecode(is []byte) ([]string, error) {
+	corrupt := errors.New("Intset integrity check failed")
+	if len(is) < 8 {
+		return nil, corrupt
+	}
+	width := binary.LittleEndian.Uint32(is)
+	count := uint64(binary.LittleEndian.Uint32(is[4:]))
+	if (width != 2 && width != 4 && width != 8) || uint64(len(is)-8) != count*uint64(width) {
+		return nil, corrupt
+	}
+	elems := make([]string, count)
+	var prev int64
+	for i := range elems {
+		b := is[8+i*int(width):]
+		var v int64
+		switch width {
+		case 2:
+			v = int64(int16(binary.LittleEndian.Uint16(b)))
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(b)))
+		default:
+			v = int64(binary.LittleEndian.Uint64(b))
+		}
+		if i > 0 && v <= prev {
+			return nil, corrupt
+		}
+		prev = v
+		elems[i] = strconv.FormatInt(v, 10)
+	}
+	return elems, nil
+}
+
+// readStream 读取流：各节点的 listpack、长度和 ID 等元数据，以及消费者组
+//
+// 旧版本的格式没有首个 ID、entriesAdded 和消费者的 activeTime 等字段，按 Redis 的方式估算。
+func (l *rdbLoader) readStream(rdbType byte) (*Stream, error) {
+	s := NewStream()
+	nodes, err := l.readLen()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < nodes; i++ {
+		key, err := l.readString()
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != 16 {
+			return nil, errors.New("Stream node key entry is not the size of a stream ID")
+		}
+		lp, err := l.readString()
+		if err != nil {
+			return nil, err
+		}
+		master := streamID{binary.BigEndian.Uint64([]byte(key)), binary.BigEndian.Uint64([]byte(key[8:]))}
+		if err := rdbLoadStreamListpack(s, master, lp); err != nil {
+			return nil, err
+		}
+	}
+
+	length, err := l.readLen()
+	if err != nil {
+		return nil, err
+	}
+	if length != uint64(s.length) {
+		return nil, errors.New("Stream length doesn't match the number of entries")
+	}
+	lastID, err := l.readLenID()
+	if err != nil {
+		return nil, err
+	}
+	if s.length > 0 && lastID.compare(s.lastID) < 0 {
+		return nil, errors.New("Stream last ID is smaller than the last entry ID")
+	}
+	s.lastID = lastID
+	s.entriesAdded = length
+	if rdbType != RDB_TYPE_STREAM_LISTPACKS {
+		// 首个 ID 由条目得出，没有 XDEL 也就不需要删除过的最大 ID
+		for i := 0; i < 2; i++ {
+			if _, err := l.readLenID(); err != nil {
+				return nil, err
+			}
+		}
+		if s.entriesAdded, err = l.readLen(); err != nil {
+			return nil, err
+		}
+		if s.entriesAdded < length {
+			return nil, errors.New("Stream entries added is smaller than its length")
+		}
+	}
+
+	groups, err := l.readLen()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < groups; i++ {
+		if err := l.readStreamGroup(s, rdbType); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// readStreamGroup 读取一个消费者组：组的 PEL 带有投递时间和次数，各消费者的 PEL 只有 ID
+func (l *rdbLoader) readStreamGroup(s *Stream, rdbType byte) error {
+	name, err := l.readString()
+	if err != nil {
+		return err
+	}
+	lastID, err := l.readLenID()
+	if err != nil {
+		return err
+	}
+	var entriesRead int64
+	if rdbType == RDB_TYPE_STREAM_LISTPACKS {
+		entriesRead = s.estimateEntriesRead(lastID)
+	} else {
+		n, err := l.readLen()
+		if err != nil {
+			return err
+		}
+		entriesRead = int64(n)
+	}
+	cg := s.createGroup(name, lastID, entriesRead)
+	if cg == nil {
+		return fmt.Errorf("Duplicated consumer group name %s", name)
+	}
+
+	pending, err := l.readLen()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < pending; i++ {
+		id, err := l.readStreamID()
+		if err != nil {
+			return err
+		}
+		deliveryTime, err := l.readUint64()
+		if err != nil {
+			return err
+		}
+		deliveryCount, err := l.readLen()
+		if err != nil {
+			return err
+		}
+		if cg.pel.Get(id) != nil {
+			return errors.New("Duplicated global PEL entry loading stream consumer group")
+		}
+		cg.pel.Add(id, &streamNACK{deliveryTime: int64(deliveryTime), deliveryCount: int64(deliveryCount)})
+	}
+
+	consumers, err := l.readLen()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < consumers; i++ {
+		cname, err := l.readString()
+		if err != nil {
+			return err
+		}
+		seenTime, err := l.readUint64()
+		if err != nil {
+			return err
+		}
+		activeTime := seenTime
+		if rdbType == RDB_TYPE_STREAM_LISTPACKS_3 {
+			if activeTime, err = l.readUint64(); err != nil {
+				return err
+			}
+		}
+		consumer := cg.createConsumer(cname, int64(seenTime))
+		if consumer == nil {
+			return fmt.Errorf("Duplicated consumer name %s", cname)
+		}
+		consumer.activeTime = int64(activeTime)
+
+		n, err := l.readLen()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < n; j++ {
+			id, err := l.readStreamID()
+			if err != nil {
+				return err
+			}
+			nack := cg.pel.Get(id)
+			if nack == nil {
+				return errors.New("Consumer entry not found in group global PEL")
+			}
+			if nack.consumer != nil {
+				return errors.New("Duplicated consumer PEL entry loading a stream consumer group")
+			}
+			nack.consumer = consumer
+			consumer.pel.Add(id, nack)
+		}
+	}
+
+	orphan := false
+	cg.pel.Ascend(streamID{}, func(_ streamID, nack *streamNACK) bool {
+		orphan = nack.consumer == nil
+		return !orphan
+	})
+	if orphan {
+		return errors.New("Stream CG PEL entry without consumer")
+	}
+	return nil
+}
+
+// rdbLoadStreamListpack 解析一个流节点的 listpack，把其中未删除的条目追加到流中，格式见 rdbStreamListpack
+func rdbLoadStreamListpack(s *Stream, master streamID, lp string) error {
+	elems, err := listpackDecode([]byte(lp))
+	if err != nil {
+		return err
+	}
+	corrupt := errors.New("Stream listpack integrity check failed")
+	p := 0
+	next := func() (string, bool) {
+		if p >= len(elems) {
+			return "", false
+		}
+		p++
+		return elems[p-1], true
+	}
+	nextInt := func() (int64, bool) {
+		str, ok := next()
+		if !ok {
+			return 0, false
+		}
+		v, err := strconv.ParseInt(str, 10, 64)
+		return v, err == nil
+	}
+
+	count, ok1 := nextInt()
+	deleted, ok2 := nextInt()
+	numFields, ok3 := nextInt()
+	if !ok1 || !ok2 || !ok3 || count < 0 || deleted < 0 || numFields < 0 || numFields > int64(len(elems)) {
+		return corrupt
+	}
+	masterFields := make([]string, numFields)
+	for i := range masterFields {
+		if masterFields[i], ok1 = next(); !ok1 {
+			return corrupt
+		}
+	}
+	if terminator, ok := nextInt(); !ok || terminator != 0 {
+		return corrupt
+	}
+
+	valid := int64(0)
+	for p < len(elems) {
+		flags, ok1 := nextInt()
+		msDiff, ok2 := nextInt()
+		seqDiff, ok3 := nextInt()
+		if !ok1 || !ok2 || !ok3 {
+			return corrupt
+		}
+		id := streamID{master.ms + uint64(msDiff), master.seq + uint64(seqDiff)}
+
+		var fields []string
+		lpCount := int64(3)
+		if flags&STREAM_ITEM_FLAG_SAMEFIELDS != 0 {
+			fields = make([]string, 0, 2*numFields)
+			for _, field := range masterFields {
+				value, ok := next()
+				if !ok {
+					return corrupt
+				}
+				fields = append(fields, field, value)
+			}
+			lpCount += numFields
+		} else {
+			n, ok := nextInt()
+			if !ok || n <= 0 || n > int64(len(elems)) {
+				return corrupt
+			}
+			fields = make([]string, 2*n)
+			for i := range fields {
+				if fields[i], ok = next(); !ok {
+					return corrupt
+				}
+			}
+			lpCount += 2*n + 1
+		}
+		if n, ok := nextInt(); !ok || n != lpCount {
+			return corrupt
+		}
+
+		if flags&STREAM_ITEM_FLAG_DELETED != 0 {
+			continue
+		}
+		if s.length > 0 && id.compare(s.lastID) <= 0 {
+			return errors.New("Stream entry IDs are not in ascending order")
+		}
+		s.Append(id, fields)
+		valid++
+	}
+	if valid != count {
+		return corrupt
+	}
+	return nil
+}
+
+// rdbModuleName 从模块 ID 中取出模块类型名和编码版本，是 rdbModuleID 的逆运算
+func rdbModuleName(id uint64) (string, int) {
+	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	name := make([]byte, 9)
+	for i := range name {
+		name[i] = charset[id>>(10+6*(8-i))&63]
+	}
+	return string(name), int(id & 1023)
+}
+
+// readModule 读取模块类型的值，只支持本服务器保存的 Count-Min Sketch 和 Top-K
+func (l *rdbLoader) readModule() (*RedisObject, error) {
+	id, err := l.readLen()
+	if err != nil {
+		return nil, err
+	}
+	name, encver := rdbModuleName(id)
+	switch {
+	case name == rdbModuleNameCMS && encver == rdbModuleEncver:
+		cms, err := l.readCMS()
+		if err != nil {
+			return nil, err
+		}
+		return &RedisObject{Type: OBJ_CMS, Value: cms}, nil
+	case name == rdbModuleNameTopK && encver == rdbModuleEncver:
+		topk, err := l.readTopK()
+		if err != nil {
+			return nil, err
+		}
+		return &RedisObject{Type: OBJ_TOPK, Value: topk}, nil
+	default:
+		return nil, fmt.Errorf("The RDB file contains module data I can't load: no matching module type '%s'", name)
+	}
+}
+
+// errRdbModuleValue 表示模块值中的操作码与期望的类型不符
+var errRdbModuleValue = errors.New("Error loading module value")
+
+// readModuleOpcode 读取模块值中的下一个操作码，检查是否为期望的类型
+func (l *rdbLoader) readModuleOpcode(want uint64) error {
+	opcode, err := l.readLen()
+	if err != nil {
+		return err
+	}
+	if opcode != want {
+		return errRdbModuleValue
+	}
+	return nil
+}
+
+// readModuleUint 读取模块值中的无符号整数
+func (l *rdbLoader) readModuleUint() (uint64, error) {
+	if err := l.readModuleOpcode(RDB_MODULE_OPCODE_UINT); err != nil {
+		return 0, err
+	}
+	return l.readLen()
+}
+
+// readModuleDouble 读取模块值中的浮点数
+func (l *rdbLoader) readModuleDouble() (float64, error) {
+	if err := l.readModuleOpcode(RDB_MODULE_OPCODE_DOUBLE); err != nil {
+		return 0, err
+	}
+	return l.readDouble()
+}
+
+// readModuleString 读取模块值中的字符串
+func (l *rdbLoader) readModuleString() (string, error) {
+	if err := l.readModuleOpcode(RDB_MODULE_OPCODE_STRING); err != nil {
+		return "", err
+	}
+	return l.readString()
+}
+
+// readCMS 读取 rdbAppendCMS 保存的 Count-Min Sketch
+func (l *rdbLoader) readCMS() (*CountMinSketch, error) {
+	var dims [3]uint64
+	for i := range dims {
+		n, err := l.readModuleUint()
+		if err != nil {
+			return nil, err
+		}
+		dims[i] = n
+	}
+	width, depth, count := dims[0], dims[1], dims[2]
+	if width == 0 || depth == 0 || width > cmsMaxCounters/depth {
+		return nil, errors.New("Invalid Count-Min Sketch dimensions")
+	}
+	counters, err := l.readModuleString()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(counters)) != 4*width*depth {
+		return nil, errRdbModuleValue
+	}
+	if err := l.readModuleOpcode(RDB_MODULE_OPCODE_EOF); err != nil {
+		return nil, err
+	}
+
+	cms := NewCountMinSketch(width, depth)
+	cms.count = count
+	for i := range cms.counters {
+		cms.counters[i] = binary.LittleEndian.Uint32([]byte(counters[4*i:]))
+	}
+	return cms, nil
+}
+
+// readTopK 读取 rdbAppendTopK 保存的 Top-K
+func (l *rdbLoader) readTopK() (*TopK, error) {
+	var dims [3]uint64
+	for i := range dims {
+		n, err := l.readModuleUint()
+		if err != nil {
+			return nil, err
+		}
+		dims[i] = n
+	}
+	k, width, depth := dims[0], dims[1], dims[2]
+	decay, err := l.readModuleDouble()
+	if err != nil {
+		return nil, err
+	}
+	if k == 0 || k > topkMaxBuckets || width == 0 || depth == 0 || width > topkMaxBuckets/depth || !(decay > 0 && decay <= 1) {
+		return nil, errors.New("Invalid Top-K parameters")
+	}
+	rng, err := l.readModuleUint()
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := l.readModuleString()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(buckets)) != 12*width*depth {
+		return nil, errRdbModuleValue
+	}
+	topk := NewTopK(int(k), width, depth, decay)
+	topk.rng = rng
+	for i := range topk.buckets {
+		b := []byte(buckets[12*i:])
+		topk.buckets[i] = topkBucket{fp: binary.LittleEndian.Uint64(b), count: binary.LittleEndian.Uint32(b[8:])}
+	}
+
+	n, err := l.readModuleUint()
+	if err != nil {
+		return nil, err
+	}
+	if n > k {
+		return nil, errRdbModuleValue
+	}
+	for i := uint64(0); i < n; i++ {
+		fp, err := l.readModuleUint()
+		if err != nil {
+			return nil, err
+		}
+		count, err := l.readModuleUint()
+		if err != nil {
+			return nil, err
+		}
+		item, err := l.readModuleString()
+		if err != nil {
+			return nil, err
+		}
+		if count > math.MaxUint32 {
+			return nil, errRdbModuleValue
+		}
+		topk.heap[i] = topkHeapEntry{fp: fp, item: []byte(item), count: uint32(count)}
+	}
+	heap.Init(&topk.heap)
+	return topk, l.readModuleOpcode(RDB_MODULE_OPCODE_EOF)
+}
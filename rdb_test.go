@@ -0,0 +1,476 @@
+package goredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readRdbFile 读取服务器保存的 RDB 文件，检查魔数和校验和
+func readRdbFile(t *testing.T, ts *testServer) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(ts.dir, "dump.rdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("REDIS0011")) {
+		t.Fatalf("RDB file starts with %q", data[:min(9, len(data))])
+	}
+	body := data[:len(data)-8]
+	if body[len(body)-1] != RDB_OPCODE_EOF {
+		t.Fatal("RDB file does not end with EOF")
+	}
+	if sum := binary.LittleEndian.Uint64(data[len(body):]); sum != crc64Jones(0, body) {
+		t.Fatalf("RDB checksum %x, want %x", sum, crc64Jones(0, body))
+	}
+	return data
+}
+
+func TestSaveWritesRdbFile(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "greeting", "hello")
+	c.mustDo("3", "RPUSH", "list", "a", "b", "c")
+	c.mustDo("lib", "FUNCTION", "LOAD", "#!lua name=lib\nredis.register_function('f', function() return 7 end)")
+	c.mustDo("OK", "SAVE")
+
+	data := readRdbFile(t, ts)
+	// 字符串键：类型、键名和值
+	if !bytes.Contains(data, []byte("\x00\x08greeting\x05hello")) {
+		t.Fatal("string key not found in the RDB file")
+	}
+	if !bytes.Contains(data, []byte{RDB_OPCODE_FUNCTION2}) || !bytes.Contains(data, []byte("#!lua name=lib")) {
+		t.Fatal("function library not found in the RDB file")
+	}
+
+	// 保存到 dbfilename 配置的文件名
+	c.mustDo("OK", "CONFIG", "SET", "dbfilename", "other.rdb")
+	c.mustDo("OK", "SAVE")
+	if _, err := os.Stat(filepath.Join(ts.dir, "other.rdb")); err != nil {
+		t.Fatal(err)
+	}
+	c.mustDo("(error) ERR CONFIG SET failed (possibly related to argument 'dbfilename') - dbfilename can't be a path, just a filename",
+		"CONFIG", "SET", "dbfilename", "sub/dump.rdb")
+	c.mustDo("(error) ERR CONFIG SET failed (possibly related to argument 'dir') - No such file or directory",
+		"CONFIG", "SET", "dir", filepath.Join(ts.dir, "missing"))
+	c.mustDo("[dir "+ts.dir+"]", "CONFIG", "GET", "dir")
+}
+
+func TestBgsaveSnapshotIgnoresLaterWrites(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "str", "before-bgsave")
+	c.mustDo("Background saving started", "BGSAVE")
+	// 快照在回复之前取得，之后的修改不在快照中
+	c.mustDo("OK", "SET", "str", "after-bgsave")
+	c.mustDo("1", "RPUSH", "list", "after-marker")
+	waitFor(t, "BGSAVE to finish", func() bool { return !ts.rs.rdbSaving.Load() })
+
+	data := readRdbFile(t, ts)
+	if !bytes.Contains(data, []byte("before-bgsave")) {
+		t.Fatal("snapshot is missing the value written before BGSAVE")
+	}
+	if bytes.Contains(data, []byte("after-bgsave")) || bytes.Contains(data, []byte("after-marker")) {
+		t.Fatal("snapshot contains writes made after BGSAVE")
+	}
+	c.mustDo("(error) ERR syntax error", "BGSAVE", "NOW")
+}
+
+func TestRdbSaveAndReload(t *testing.T) {
+	dir := testDir(t)
+	c := startTestServerIn(t, dir).connect(t)
+	c.mustDo("OK", "SET", "str", "hello")
+	c.mustDo("OK", "SET", "num", "12345")
+	c.mustDo("3", "RPUSH", "list", "a", "b", "c")
+	c.mustDo("2", "SADD", "set", "x", "y")
+	c.mustDo("3", "SADD", "intset", "1", "2", "3")
+	c.mustDo("2", "ZADD", "zset", "1.5", "m1", "2", "m2")
+	c.mustDo("2", "HSET", "hash", "f1", "v1", "f2", "12")
+	c.mustDo("1-1", "XADD", "stream", "1-1", "f", "v")
+	c.mustDo("2-1", "XADD", "stream", "2-1", "f", "w", "g", "x")
+	c.mustDo("OK", "XGROUP", "CREATE", "stream", "grp", "0")
+	c.mustDo("[[stream [[1-1 [f v]]]]]", "XREADGROUP", "GROUP", "grp", "alice", "COUNT", "1", "STREAMS", "stream", ">")
+	c.mustDo("1", "PFADD", "hll", "a", "b", "c")
+	c.mustDo("OK", "CMS.INITBYDIM", "cms", "100", "4")
+	c.mustDo("[5]", "CMS.INCRBY", "cms", "a", "5")
+	c.mustDo("OK", "TOPK.RESERVE", "tk", "2", "50", "5", "0.9")
+	c.mustDo("[(nil)]", "TOPK.ADD", "tk", "a")
+	c.mustDo("lib", "FUNCTION", "LOAD", "#!lua name=lib\nredis.register_function('f', function() return 7 end)")
+	c.mustDo("OK", "SELECT", "1")
+	c.mustDo("OK", "SET", "other", "db1")
+	c.mustDo("OK", "SAVE")
+
+	c = startTestServerIn(t, dir).connect(t)
+	c.mustDo("hello", "GET", "str")
+	c.mustDo("12345", "GET", "num")
+	c.mustDo("[a b c]", "LRANGE", "list", "0", "-1")
+	c.mustDo("2", "SCARD", "set")
+	c.mustDo("intset", "OBJECT", "ENCODING", "intset")
+	c.mustDo("[m1 1.5 m2 2]", "ZRANGE", "zset", "0", "-1", "WITHSCORES")
+	c.mustDo("2", "HLEN", "hash")
+	c.mustDo("12", "HGET", "hash", "f2")
+	c.mustDo("[[1-1 [f v]] [2-1 [f w g x]]]", "XRANGE", "stream", "-", "+")
+	if got := c.pending("stream", "grp", "-", "+", "10"); got != "[1-1 alice 1]" {
+		t.Fatalf("pending entries after reload: %s", got)
+	}
+	c.mustDo("[[stream [[2-1 [f w g x]]]]]", "XREADGROUP", "GROUP", "grp", "bob", "STREAMS", "stream", ">")
+	c.mustDo("3", "PFCOUNT", "hll")
+	c.mustDo("[5]", "CMS.QUERY", "cms", "a")
+	c.mustDo("[a]", "TOPK.LIST", "tk")
+	c.mustDo("7", "FCALL", "f", "0")
+	c.mustDo("OK", "SELECT", "1")
+	c.mustDo("db1", "GET", "other")
+}
+
+// rdbWithExpire 返回只含有一个带过期时间的字符串键的 RDB 文件内容
+func rdbWithExpire(key, value string, expireAt int64) []byte {
+	return rdbFile(func(e *rdbEncoder) {
+		e.buf = append(e.buf, RDB_OPCODE_EXPIRETIME_MS)
+		e.appendMillis(expireAt)
+		e.buf = append(e.buf, RDB_TYPE_STRING)
+		e.appendString(key)
+		e.appendString(value)
+	})
+}
+
+// rdbFile 返回 0 号数据库中含有 body 写入的键值对的 RDB 文件内容
+func rdbFile(body func(e *rdbEncoder)) []byte {
+	e := &rdbEncoder{buf: []byte("REDIS0011")}
+	e.buf = append(e.buf, RDB_OPCODE_SELECTDB)
+	e.appendLen(0)
+	body(e)
+	e.buf = append(e.buf, RDB_OPCODE_EOF)
+	return binary.LittleEndian.AppendUint64(e.buf, crc64Jones(0, e.buf))
+}
+
+func TestRdbLoadExpireTimes(t *testing.T) {
+	rs := NewRedisServer("127.0.0.1", 0, 16)
+	if _, err := rs.rdbLoad(rdbWithExpire("k", "v", time.Now().Add(-time.Hour).UnixMilli()), nil); err != nil {
+		t.Fatal(err)
+	}
+	if rs.databases[0].store.Len() != 0 {
+		t.Fatal("expired key was loaded")
+	}
+
+	// 尚未过期的键带着过期时间加载，秒为单位的旧操作码同样接受
+	future := time.Now().Add(time.Hour).UnixMilli()
+	seconds := time.Now().Add(2 * time.Hour).Unix()
+	data := rdbFile(func(e *rdbEncoder) {
+		e.buf = append(e.buf, RDB_OPCODE_EXPIRETIME_MS)
+		e.appendMillis(future)
+		e.buf = append(e.buf, RDB_TYPE_STRING)
+		e.appendString("ms")
+		e.appendString("v")
+		e.buf = append(e.buf, RDB_OPCODE_EXPIRETIME)
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(seconds))
+		e.buf = append(e.buf, RDB_TYPE_STRING)
+		e.appendString("s")
+		e.appendString("v")
+		e.buf = append(e.buf, RDB_TYPE_STRING)
+		e.appendString("persistent")
+		e.appendString("v")
+	})
+	rs = NewRedisServer("127.0.0.1", 0, 16)
+	if _, err := rs.rdbLoad(data, nil); err != nil {
+		t.Fatal(err)
+	}
+	store := rs.databases[0].store
+	if store.Len() != 3 || store.GetExpire("ms") != future || store.GetExpire("s") != seconds*1000 || store.GetExpire("persistent") != -1 {
+		t.Fatalf("loaded %d keys, expires ms=%d s=%d persistent=%d", store.Len(), store.GetExpire("ms"), store.GetExpire("s"), store.GetExpire("persistent"))
+	}
+
+	// 副本保留已经过期的键，等待主节点的 DEL
+	rs = NewRedisServer("127.0.0.1", 0, 16)
+	past := time.Now().Add(-time.Hour).UnixMilli()
+	if _, err := rs.rdbLoadKeepExpired(rdbWithExpire("k", "v", past), nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if store := rs.databases[0].store; store.Len() != 1 || store.GetExpire("k") != past || rs.databases[0].lookupKey("k") != nil {
+		t.Fatal("expired key not kept as logically expired")
+	}
+}
+
+func TestRdbSaveKeepsExpireTimes(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("1", "PEXPIREAT", "k", strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10))
+	c.mustDo("OK", "SET", "short", "v")
+	c.mustDo("1", "PEXPIRE", "short", "300")
+	c.mustDo("3", "RPUSH", "persistent", "a", "b", "c")
+	when := replyString(c.do("PEXPIRETIME", "k"))
+	c.mustDo("OK", "SAVE")
+
+	// 后台保存的快照同样带着过期时间
+	c.mustDo("OK", "SELECT", "2")
+	c.mustDo("1", "SADD", "s", "x")
+	c.mustDo("1", "EXPIRE", "s", "100")
+	c.mustDo("Background saving started", "BGSAVE")
+	waitFor(t, "BGSAVE to finish", func() bool { return !ts.rs.rdbSaving.Load() })
+
+	ts = startTestServerIn(t, ts.dir)
+	c = ts.connect(t)
+	c.mustDo(when, "PEXPIRETIME", "k")
+	c.mustDo("-1", "TTL", "persistent")
+	waitFor(t, "short to expire", func() bool { return replyString(c.do("PTTL", "short")) == "-2" })
+	c.mustDo("OK", "SELECT", "2")
+	if ttl, _ := strconv.Atoi(replyString(c.do("TTL", "s"))); ttl <= 0 || ttl > 100 {
+		t.Fatalf("TTL after restart is %d", ttl)
+	}
+}
+
+func TestRdbLoadRejectsCorruptFiles(t *testing.T) {
+	valid := rdbWithExpire("k", "v", time.Now().Add(-time.Hour).UnixMilli())
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+	for name, tt := range map[string]struct {
+		data []byte
+		want string
+	}{
+		"signature": {corrupt(func(b []byte) []byte { b[0] = 'X'; return b }), "Wrong signature"},
+		"version":   {corrupt(func(b []byte) []byte { copy(b[5:], "0012"); return b }), "Can't handle RDB format version 0012"},
+		"checksum":  {corrupt(func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b }), "Wrong RDB checksum"},
+		"truncated": {valid[:len(valid)-12], "unexpected end of RDB data"},
+		"database": {corrupt(func(b []byte) []byte { b[10] = 16; return b }),
+			"configured to handle more than 16 databases"},
+	} {
+		rs := NewRedisServer("127.0.0.1", 0, 16)
+		_, err := rs.rdbLoad(tt.data, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", name, err, tt.want)
+		}
+		if rs.databases[0].store.Len() != 0 {
+			t.Errorf("%s: keys were loaded from a corrupt file", name)
+		}
+	}
+}
+
+func TestStartFailsOnCorruptRdbFile(t *testing.T) {
+	dir := testDir(t)
+	if err := os.WriteFile(filepath.Join(dir, "dump.rdb"), []byte("REDIS0011\xfe"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rs := NewRedisServer("127.0.0.1", 0, 16)
+	setDir(rs, dir)
+	if err := rs.Start(); err == nil || !strings.Contains(err.Error(), "Error loading RDB file") {
+		t.Fatalf("Start returned %v", err)
+	}
+}
+
+func TestRdbReloadLargeValues(t *testing.T) {
+	dir := testDir(t)
+	c := startTestServerIn(t, dir).connect(t)
+	for i := 0; i < 2000; i++ {
+		c.do("RPUSH", "list", strconv.Itoa(i))
+		c.do("ZADD", "zset", strconv.Itoa(i), "m"+strconv.Itoa(i))
+		c.do("XADD", "stream", "*", "n", strconv.Itoa(i))
+	}
+	c.mustDo("OK", "SAVE")
+
+	c = startTestServerIn(t, dir).connect(t)
+	c.mustDo("2000", "LLEN", "list")
+	c.mustDo("[1999]", "LRANGE", "list", "-1", "-1")
+	c.mustDo("[m1000 1000]", "ZRANGE", "zset", "1000", "1000", "WITHSCORES")
+	c.mustDo("2000", "XLEN", "stream")
+}
+
+func TestRdbStringEncodings(t *testing.T) {
+	long := strings.Repeat("abc", 100)
+	for _, tt := range []struct {
+		s        string
+		compress bool
+		want     []byte
+	}{
+		{"-1", true, []byte{0xc0, 0xff}},
+		{"12345", true, []byte{0xc1, 0x39, 0x30}},
+		{"2147483647", true, []byte{0xc2, 0xff, 0xff, 0xff, 0x7f}},
+		// 超出 32 位或不是规范形式的整数按字符串保存
+		{"2147483648", true, append([]byte{10}, "2147483648"...)},
+		{"007", true, []byte{3, '0', '0', '7'}},
+		{long, false, append([]byte{0x41, 0x2c}, long...)},
+	} {
+		e := &rdbEncoder{compress: tt.compress}
+		e.appendString(tt.s)
+		if !bytes.Equal(e.buf, tt.want) {
+			t.Errorf("%.20q: got % x, want % x", tt.s, e.buf, tt.want)
+		}
+	}
+
+	// 压缩后的字符串以 0xc3、压缩长度和原始长度开头，读回后与原文相同
+	e := &rdbEncoder{compress: true}
+	e.appendString(long)
+	if e.buf[0] != 0xc3 || len(e.buf) >= len(long) {
+		t.Fatalf("long string was not compressed: % x", e.buf[:4])
+	}
+	for _, s := range []string{long, "-1", "2147483647", "007"} {
+		e := &rdbEncoder{compress: true}
+		e.appendString(s)
+		r := &rdbReader{data: e.buf}
+		if got, err := r.readString(); err != nil || got != s {
+			t.Errorf("read back %.20q as %.20q, %v", s, got, err)
+		}
+	}
+}
+
+// ziplistOf 按 Redis 的格式构造由字符串元素组成的 ziplist，只支持短字符串和 0 到 12 的整数
+func ziplistOf(elems ...string) []byte {
+	var entries []byte
+	prevlen := 0
+	last := ZIPLIST_HEADER_SIZE
+	for _, elem := range elems {
+		last = ZIPLIST_HEADER_SIZE + len(entries)
+		entry := []byte{byte(prevlen)}
+		if n, err := strconv.Atoi(elem); err == nil && n >= 0 && n <= 12 {
+			entry = append(entry, byte(ZIP_INT_IMM_MIN+n))
+		} else {
+			entry = append(entry, byte(len(elem)))
+			entry = append(entry, elem...)
+		}
+		entries = append(entries, entry...)
+		prevlen = len(entry)
+	}
+	zl := binary.LittleEndian.AppendUint32(nil, uint32(ZIPLIST_HEADER_SIZE+len(entries)+1))
+	zl = binary.LittleEndian.AppendUint32(zl, uint32(last))
+	zl = binary.LittleEndian.AppendUint16(zl, uint16(len(elems)))
+	zl = append(zl, entries...)
+	return append(zl, ZIPLIST_END)
+}
+
+// listpackOf 构造由 elems 组成的 listpack
+func listpackOf(elems ...string) []byte {
+	lp := newListpackWriter()
+	for _, elem := range elems {
+		lp.appendString(elem)
+	}
+	return lp.bytes()
+}
+
+func TestRdbLoadRedisCompactEncodings(t *testing.T) {
+	intset := []byte{2, 0, 0, 0, 3, 0, 0, 0, 1, 0, 2, 0, 0xe8, 0x03}
+	data := rdbFile(func(e *rdbEncoder) {
+		e.buf = append(e.buf, RDB_TYPE_LIST_ZIPLIST)
+		e.appendString("ziplist")
+		e.appendBytes(ziplistOf("a", "5", "bc"))
+		e.buf = append(e.buf, RDB_TYPE_SET_INTSET)
+		e.appendString("intset")
+		e.appendBytes(intset)
+		e.buf = append(e.buf, RDB_TYPE_ZSET_ZIPLIST)
+		e.appendString("zziplist")
+		e.appendBytes(ziplistOf("m1", "1", "m2", "10"))
+		e.buf = append(e.buf, RDB_TYPE_ZSET_LISTPACK)
+		e.appendString("zlistpack")
+		e.appendBytes(listpackOf("x", "1.5", "y", "2"))
+		e.buf = append(e.buf, RDB_TYPE_SET_LISTPACK)
+		e.appendString("slistpack")
+		e.appendBytes(listpackOf("p", "q"))
+		e.buf = append(e.buf, RDB_TYPE_LIST_QUICKLIST_2)
+		e.appendString("quicklist")
+		e.appendLen(2)
+		e.appendLen(QUICKLIST_NODE_CONTAINER_PACKED)
+		e.appendBytes(listpackOf("1", "2"))
+		e.appendLen(QUICKLIST_NODE_CONTAINER_PLAIN)
+		e.appendString("plain")
+	})
+	dir := testDir(t)
+	if err := os.WriteFile(filepath.Join(dir, "dump.rdb"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := startTestServerIn(t, dir).connect(t)
+	c.mustDo("[a 5 bc]", "LRANGE", "ziplist", "0", "-1")
+	c.mustDo("[1 2 1000]", "SMEMBERS", "intset")
+	c.mustDo("[m1 1 m2 10]", "ZRANGE", "zziplist", "0", "-1", "WITHSCORES")
+	c.mustDo("[x 1.5 y 2]", "ZRANGE", "zlistpack", "0", "-1", "WITHSCORES")
+	c.mustDo("2", "SCARD", "slistpack")
+	c.mustDo("[1 2 plain]", "LRANGE", "quicklist", "0", "-1")
+}
+
+// zipmapOf 构造由交替排列的字段和值组成的 zipmap，值之后留 1 个空闲字节
+func zipmapOf(elems ...string) []byte {
+	zm := []byte{byte(len(elems) / 2)}
+	for i, elem := range elems {
+		zm = append(zm, byte(len(elem)))
+		if i%2 == 1 {
+			zm = append(zm, 1)
+			zm = append(append(zm, elem...), 0)
+			continue
+		}
+		zm = append(zm, elem...)
+	}
+	return append(zm, ZIPMAP_END)
+}
+
+func TestRdbLoadHashes(t *testing.T) {
+	data := rdbFile(func(e *rdbEncoder) {
+		e.buf = append(e.buf, RDB_TYPE_HASH)
+		e.appendString("hash")
+		e.appendLen(2)
+		e.appendString("a")
+		e.appendString("1")
+		e.appendString("b")
+		e.appendString("2")
+		e.buf = append(e.buf, RDB_TYPE_HASH_ZIPMAP)
+		e.appendString("zipmap")
+		e.appendBytes(zipmapOf("f", "v", "g", "w"))
+		e.buf = append(e.buf, RDB_TYPE_HASH_ZIPLIST)
+		e.appendString("ziplist")
+		e.appendBytes(ziplistOf("f", "5", "g", "x"))
+		e.buf = append(e.buf, RDB_TYPE_HASH_LISTPACK)
+		e.appendString("listpack")
+		e.appendBytes(listpackOf("f", "v"))
+	})
+	dir := testDir(t)
+	if err := os.WriteFile(filepath.Join(dir, "dump.rdb"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := startTestServerIn(t, dir).connect(t)
+	c.mustDo("hashtable", "OBJECT", "ENCODING", "hash")
+	c.mustDo("2", "HGET", "hash", "b")
+	c.mustDo("w", "HGET", "zipmap", "g")
+	c.mustDo("5", "HGET", "ziplist", "f")
+	c.mustDo("x", "HGET", "ziplist", "g")
+	c.mustDo("[f v]", "HGETALL", "listpack")
+
+	// 字段和值不成对、字段重复时拒绝加载
+	for _, lp := range [][]byte{listpackOf("f", "v", "g"), listpackOf("f", "v", "f", "w")} {
+		data := rdbFile(func(e *rdbEncoder) {
+			e.buf = append(e.buf, RDB_TYPE_HASH_LISTPACK)
+			e.appendString("h")
+			e.appendBytes(lp)
+		})
+		rs := NewRedisServer("127.0.0.1", 0, 16)
+		if _, err := rs.rdbLoad(data, nil); err == nil || !strings.Contains(err.Error(), "Error loading key 'h'") {
+			t.Fatalf("got error %v", err)
+		}
+	}
+}
+
+func TestRdbCompressionAndChecksumConfig(t *testing.T) {
+	dir := testDir(t)
+	ts := startTestServerIn(t, dir)
+	c := ts.connect(t)
+	long := strings.Repeat("compressible ", 100)
+	c.mustDo("OK", "SET", "k", long)
+	c.mustDo("OK", "SAVE")
+	if bytes.Contains(readRdbFile(t, ts), []byte(long)) {
+		t.Fatal("long string was saved uncompressed")
+	}
+
+	c.mustDo("OK", "CONFIG", "SET", "rdbcompression", "no", "rdbchecksum", "no")
+	c.mustDo("[rdbchecksum no rdbcompression no]", "CONFIG", "GET", "rdb*")
+	c.mustDo("OK", "SAVE")
+	data, err := os.ReadFile(filepath.Join(dir, "dump.rdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(long)) || binary.LittleEndian.Uint64(data[len(data)-8:]) != 0 {
+		t.Fatal("rdbcompression no / rdbchecksum no not applied")
+	}
+	// 校验和为 0 的文件加载时跳过校验
+	startTestServerIn(t, dir).connect(t).mustDo(long, "GET", "k")
+}
@@ -0,0 +1,1361 @@
+package goredis
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 副本到主节点的连接的状态
+const (
+	REPL_STATE_CONNECT    = iota // 等待连接主节点
+	REPL_STATE_CONNECTING        // 正在连接和握手
+	REPL_STATE_TRANSFER          // 正在接收并加载主节点的 RDB
+	REPL_STATE_CONNECTED         // 同步完成，正在接收命令流
+)
+
+const (
+	// replTimeout 是与主节点的连接上没有任何数据的最长时间，超过后断开重连
+	replTimeout = 60 * time.Second
+	// replConnectTimeout 是连接主节点的超时时间
+	replConnectTimeout = 5 * time.Second
+	// replRetryPeriod 是连接断开或同步失败后重新连接主节点的间隔
+	replRetryPeriod = time.Second
+	// replEOFMarkSize 是无盘复制时标记 RDB 结束的随机串的长度
+	replEOFMarkSize = 40
+)
+
+// errReplCancelled 表示 REPLICAOF 已经改变了主节点，当前的连接不再需要
+var errReplCancelled = errors.New("replication cancelled")
+
+// masterLink 是副本到主节点的连接
+//
+// 每次 REPLICAOF 设置主节点都创建新的 masterLink，由 replicationLoop 负责连接、同步和重连；
+// 主节点改变或者 REPLICAOF NO ONE 时关闭 done 并断开连接，replicationLoop 随之退出。
+// conn、state 和 lastIO 由 replMu 保护；命令流开始后 ACK 可能由不同的 goroutine 发送，
+// 写入 conn 时持有 writeMu（在 replMu 之前取得）。
+//
+// INFO replication 使用的其他状态同样由 replMu 保护：downSince 是连接断开的时间（还没有连上过时
+// 为零值）；transferSize、transferRead 和 transferLastIO 是正在接收的 RDB 的大小（无盘复制的格式
+// 不知道大小，为 -1）、已经读取的字节数和最近读到数据的时间；pending 是命令流中已经读取、
+// 还没有执行的字节数。
+type masterLink struct {
+	host    string
+	port    int
+	done    chan struct{}
+	conn    net.Conn
+	state   int
+	lastIO  time.Time
+	writeMu sync.Mutex
+
+	downSince      time.Time
+	transferSize   int64
+	transferRead   int64
+	transferLastIO time.Time
+	pending        int64
+}
+
+// cancelled 返回连接是否已经不再需要
+func (link *masterLink) cancelled() bool {
+	select {
+	case <-link.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// newReplid 生成 40 个十六进制字符的随机复制 ID
+func newReplid() string {
+	buf := make([]byte, 20)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// newMasterClient 创建执行主节点命令流的伪客户端
+//
+// 命令的回复不发送给主节点，阻塞命令不会阻塞；master 标志让这些写命令总是执行，不受 MISCONF 等限制。
+func newMasterClient(rs *RedisServer, conn net.Conn) *client {
+	return &client{
+		id:                  rs.lastClientID.Add(1),
+		conn:                conn,
+		server:              rs,
+		db:                  rs.databases[0],
+		resp:                RESP2,
+		master:              true,
+		denyBlocking:        true,
+		replyOff:            true,
+		pubsubChannels:      make(map[string]struct{}),
+		pubsubPatterns:      make(map[string]struct{}),
+		pubsubShardChannels: make(map[string]struct{}),
+	}
+}
+
+// handleReplicaof 处理 REPLICAOF host port 和 REPLICAOF NO ONE 命令（SLAVEOF 是它的别名）
+//
+// 设置主节点后立即返回，连接、握手和全量同步在后台进行，之后持续执行主节点传来的写命令；
+// NO ONE 断开与主节点的连接，保留已有的数据重新成为主节点。
+func (rs *RedisServer) handleReplicaof(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if rs.clusterEnabled {
+		return NewErrorValue("ERR REPLICAOF not allowed in cluster mode.")
+	}
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if rs.failover != nil {
+		return NewErrorValue("ERR REPLICAOF not allowed while failing over.")
+	}
+	if strings.EqualFold(args[0], "no") && strings.EqualFold(args[1], "one") {
+		if rs.masterHost != "" {
+			rs.replicationUnsetMaster()
+			log.Printf("MASTER MODE enabled (user request from 'id=%d addr=%s')", c.id, clientAddr(c))
+		}
+		return NewSimpleStringValue("OK")
+	}
+
+	port, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || port < 0 || port > 65535 {
+		return NewErrorValue("ERR Invalid master port")
+	}
+	if rs.masterHost != "" && strings.EqualFold(rs.masterHost, args[0]) && rs.masterPort == int(port) {
+		log.Println("REPLICAOF would result into synchronization with the master we are already connected with. No operation performed.")
+		return NewSimpleStringValue("OK Already connected to specified master")
+	}
+	rs.replicationSetMaster(args[0], int(port))
+	log.Printf("REPLICAOF %s:%d enabled (user request from 'id=%d addr=%s')", args[0], port, c.id, clientAddr(c))
+	return NewSimpleStringValue("OK")
+}
+
+// writeDeniedByReadOnlyReplica 在本节点是只读副本（replica-read-only 为 yes）时返回拒绝写命令的
+// READONLY 错误，否则返回 nil；主节点传来的命令不做这项检查
+func (rs *RedisServer) writeDeniedByReadOnlyReplica() *RESPValue {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if rs.masterHost != "" && rs.replicaReadOnly {
+		return NewErrorValue("READONLY You can't write against a read only replica.")
+	}
+	return nil
+}
+
+// clientAddr 返回客户端的远端地址，伪客户端没有连接时返回空字符串
+func clientAddr(c *client) string {
+	if c.conn == nil {
+		return ""
+	}
+	return c.conn.RemoteAddr().String()
+}
+
+// replicationSetMaster 把主节点设置为 host:port 并开始与它同步（调用方需持有 replMu）
+//
+// 本节点原来是主节点时，自己的复制 ID 和偏移量就是数据集的位置，新的主节点如果曾经是
+// 本节点的副本，可以从这里部分同步。
+func (rs *RedisServer) replicationSetMaster(host string, port int) {
+	if rs.masterHost == "" {
+		rs.replCachedMaster = true
+	}
+	rs.replicationCancelLink()
+	rs.masterHost, rs.masterPort = host, port
+	rs.masterLink = &masterLink{host: host, port: port, done: make(chan struct{}), state: REPL_STATE_CONNECT}
+	go rs.replicationLoop(rs.masterLink)
+}
+
+// replicationUnsetMaster 断开与主节点的连接，重新成为主节点（调用方需持有 replMu）
+//
+// 数据集从此可能与原来的主节点不同，使用新的复制 ID；原来的复制 ID 保留为 replid2，
+// 同一个主节点的其他副本改为复制本节点时，仍然可以从当前的偏移量部分同步。
+// 连接到本节点的副本被断开，重新连接后从 +CONTINUE 得知新的复制 ID。
+func (rs *RedisServer) replicationUnsetMaster() {
+	rs.replicationCancelLink()
+	rs.masterHost, rs.masterPort = "", 0
+	rs.replid2, rs.secondReplidOffset = rs.replid, rs.masterReplOffset+1
+	rs.replid = newReplid()
+	log.Printf("Setting secondary replication ID to %s, valid up to offset: %d. New replication ID is %s", rs.replid2, rs.secondReplidOffset, rs.replid)
+	rs.replicationDisconnectReplicas()
+	rs.replSelectedDB = -1
+	rs.replNoSlavesSince = time.Now()
+}
+
+// replicationCancelLink 关闭当前到主节点的连接（调用方需持有 replMu）
+func (rs *RedisServer) replicationCancelLink() {
+	link := rs.masterLink
+	if link == nil {
+		return
+	}
+	rs.masterLink = nil
+	close(link.done)
+	if link.conn != nil {
+		link.conn.Close()
+	}
+}
+
+// replicationStart 在启动时按 replicaof 配置开始与主节点同步
+func (rs *RedisServer) replicationStart() {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if rs.masterHost != "" && rs.masterLink == nil {
+		rs.replicationSetMaster(rs.masterHost, rs.masterPort)
+	}
+}
+
+// replicationLoop 连接主节点并同步，连接断开或同步失败后每隔 replRetryPeriod 重试，直到 link 被取消
+func (rs *RedisServer) replicationLoop(link *masterLink) {
+	for {
+		err := rs.syncWithMaster(link)
+		if link.cancelled() {
+			return
+		}
+		rs.replMu.Lock()
+		connected := link.state == REPL_STATE_CONNECTED
+		link.state, link.conn = REPL_STATE_CONNECT, nil
+		if fo := rs.failover; fo != nil && fo.state == FAILOVER_IN_PROGRESS && rs.masterLink == link {
+			// 故障转移的目标副本没有接受同步，重新成为主节点
+			rs.abortFailover(err.Error())
+			rs.replMu.Unlock()
+			return
+		}
+		if connected {
+			link.downSince = time.Now()
+		}
+		rs.replMu.Unlock()
+		if connected {
+			log.Printf("Connection with master lost: %v", err)
+		} else {
+			log.Printf("Error condition on socket for SYNC: %v", err)
+		}
+		select {
+		case <-link.done:
+			return
+		case <-time.After(replRetryPeriod):
+		}
+	}
+}
+
+// syncWithMaster 连接主节点，握手并同步，然后执行主节点传来的命令流，直到连接出错
+//
+// 握手与 Redis 相同：PING，REPLCONF listening-port 和 capa，然后发送 PSYNC。数据集对应已知的
+// 复制 ID 和偏移量时以 PSYNC replid offset+1 请求部分同步，主节点回复 +CONTINUE 后直接接着
+// 接收命令流；否则以 PSYNC ? -1 请求全量同步。主节点回复 +FULLRESYNC replid offset 后发送 RDB，
+// 格式为 $长度 加上内容，或者无盘复制时的 $EOF:随机串 加上内容和同一个随机串；
+// 加载之后复制 ID 和偏移量与主节点相同。FAILOVER 中本节点以 PSYNC replid offset FAILOVER
+// 让目标副本成为主节点，它不接受时放弃故障转移（见 replicationLoop）。
+func (rs *RedisServer) syncWithMaster(link *masterLink) error {
+	log.Printf("Connecting to MASTER %s:%d", link.host, link.port)
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(link.host, strconv.Itoa(link.port)), replConnectTimeout)
+	if err != nil {
+		return err
+	}
+	rs.replMu.Lock()
+	if link.cancelled() {
+		rs.replMu.Unlock()
+		conn.Close()
+		return errReplCancelled
+	}
+	link.conn, link.state, link.lastIO = conn, REPL_STATE_CONNECTING, time.Now()
+	rs.replMu.Unlock()
+	defer conn.Close()
+	log.Println("MASTER <-> REPLICA sync started")
+
+	counter := &countingReader{r: conn}
+	reader := bufio.NewReader(counter)
+	conn.SetDeadline(time.Now().Add(replTimeout))
+	reply, err := replSendCommand(conn, reader, "PING")
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(reply, "-") {
+		return fmt.Errorf("Error reply to PING from master: '%s'", reply)
+	}
+	log.Println("Master replied to PING, replication can continue...")
+	if reply, err = replSendCommand(conn, reader, "REPLCONF", "listening-port", strconv.Itoa(rs.port)); err != nil {
+		return err
+	}
+	if strings.HasPrefix(reply, "-") {
+		log.Printf("(Non critical) Master does not understand REPLCONF listening-port: %s", reply)
+	}
+	if reply, err = replSendCommand(conn, reader, "REPLCONF", "capa", "eof", "capa", "psync2"); err != nil {
+		return err
+	}
+	if strings.HasPrefix(reply, "-") {
+		log.Printf("(Non critical) Master does not understand REPLCONF capa: %s", reply)
+	}
+
+	rs.replMu.Lock()
+	psyncReplid, psyncOffset := "?", int64(-1)
+	if rs.replCachedMaster {
+		psyncReplid, psyncOffset = rs.replid, rs.masterReplOffset+1
+	}
+	failover := rs.failover != nil && rs.failover.state == FAILOVER_IN_PROGRESS
+	rs.replMu.Unlock()
+	if psyncReplid == "?" {
+		log.Println("Partial resynchronization not possible (no cached master)")
+	} else {
+		log.Printf("Trying a partial resynchronization (request %s:%d).", psyncReplid, psyncOffset)
+	}
+	psyncArgs := []string{"PSYNC", psyncReplid, strconv.FormatInt(psyncOffset, 10)}
+	if failover {
+		psyncArgs = append(psyncArgs, "FAILOVER")
+	}
+	if reply, err = replSendCommand(conn, reader, psyncArgs...); err != nil {
+		return err
+	}
+	if failover {
+		if !strings.HasPrefix(reply, "+CONTINUE") && !strings.HasPrefix(reply, "+FULLRESYNC") {
+			log.Printf("Failover target rejected psync request: %s", reply)
+			return errFailoverRejected
+		}
+		rs.failoverFinished(link)
+	}
+	if newReplid, ok := strings.CutPrefix(reply, "+CONTINUE"); ok {
+		if err := rs.replicationContinue(link, strings.TrimSpace(newReplid)); err != nil {
+			return err
+		}
+		return rs.replicationStream(link, conn, reader, counter)
+	}
+	fields := strings.Fields(reply)
+	if len(fields) != 3 || fields[0] != "+FULLRESYNC" {
+		return fmt.Errorf("Unexpected reply to PSYNC from master: %s", reply)
+	}
+	replid := fields[1]
+	offset, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || len(replid) != 40 {
+		return fmt.Errorf("Master replied with wrong +FULLRESYNC syntax: %s", reply)
+	}
+	log.Printf("Full resync from master: %s:%d", replid, offset)
+
+	rs.replMu.Lock()
+	link.state = REPL_STATE_TRANSFER
+	link.transferSize, link.transferRead, link.transferLastIO = -1, 0, time.Now()
+	rs.replMu.Unlock()
+	data, err := rs.replReadPayload(link, conn, reader)
+	if err != nil {
+		return err
+	}
+	if err := rs.replicationLoadPayload(link, data, replid, offset); err != nil {
+		return err
+	}
+
+	rs.replMu.Lock()
+	link.state, link.lastIO = REPL_STATE_CONNECTED, time.Now()
+	rs.replMu.Unlock()
+	log.Println("MASTER <-> REPLICA sync: Finished with success")
+	return rs.replicationStream(link, conn, reader, counter)
+}
+
+// replicationContinue 在主节点接受部分同步后调用，newReplid 是 +CONTINUE 带来的主节点的复制 ID
+//
+// 主节点的复制 ID 变了（它的主节点发生了故障转移）时，原来的 ID 保留为 replid2，
+// 连接到本节点的副本被断开，重新连接后得知新的复制 ID。
+func (rs *RedisServer) replicationContinue(link *masterLink, newReplid string) error {
+	log.Println("Successful partial resynchronization with master.")
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if link.cancelled() {
+		return errReplCancelled
+	}
+	if newReplid != "" && newReplid != rs.replid {
+		rs.replid2, rs.secondReplidOffset = rs.replid, rs.masterReplOffset+1
+		rs.replid = newReplid
+		log.Printf("Master replication ID changed to %s", newReplid)
+		rs.replicationDisconnectReplicas()
+	}
+	if rs.replBacklog == nil {
+		rs.replBacklog = newReplBacklog(rs.replBacklogSize, rs.masterReplOffset+1)
+	}
+	link.state, link.lastIO = REPL_STATE_CONNECTED, time.Now()
+	log.Println("MASTER <-> REPLICA sync: Master accepted a Partial Resynchronization.")
+	return nil
+}
+
+// replicationStream 执行主节点传来的命令流
+//
+// 每条命令在命令流中的原始字节交给执行它的主节点客户端，执行后计入复制偏移量，
+// 写入积压缓冲区并原样转发给本节点的副本（见 replicationFeedStreamFromMaster）。
+// 主节点客户端从上次命令流选择的数据库开始，部分同步之后接着执行的命令仍在原来的数据库中。
+func (rs *RedisServer) replicationStream(link *masterLink, conn net.Conn, reader *bufio.Reader, counter *countingReader) error {
+	mc := newMasterClient(rs, conn)
+	// 从这里开始记录命令流，已经读入 reader 缓冲区的部分也属于命令流
+	buffered, _ := reader.Peek(reader.Buffered())
+	rs.replMu.Lock()
+	if rs.replSelectedDB >= 0 {
+		mc.db = rs.databases[rs.replSelectedDB]
+	}
+	link.pending = int64(len(buffered))
+	rs.replMu.Unlock()
+	counter.rec, counter.recording = append([]byte(nil), buffered...), true
+	read := counter.n - int64(reader.Buffered())
+	if err := rs.replicationSendAck(link, conn); err != nil {
+		return err
+	}
+	for {
+		conn.SetReadDeadline(time.Now().Add(replTimeout))
+		command, err := ParseRESP(reader)
+		if err != nil {
+			return err
+		}
+		consumed := counter.n - int64(reader.Buffered())
+		n := int(consumed - read)
+		mc.replStream = append(mc.replStream, counter.rec[:n]...)
+		counter.rec, read = counter.rec[n:], consumed
+		rs.processCommand(mc, command)
+		// 出错而没有执行的命令不经过 call，在这里计入复制偏移量
+		if len(mc.replStream) > 0 && !mc.multi {
+			rs.propagateMu.Lock()
+			rs.replicationFeedStreamFromMaster(mc)
+			rs.propagateMu.Unlock()
+		}
+		rs.replicationSendFack()
+
+		rs.replMu.Lock()
+		if link.cancelled() {
+			rs.replMu.Unlock()
+			return errReplCancelled
+		}
+		link.lastIO = time.Now()
+		link.pending = int64(len(mc.replStream) + len(counter.rec))
+		rs.replMu.Unlock()
+	}
+}
+
+// replicationFeedStreamFromMaster 把主节点客户端执行过的命令流计入复制偏移量，
+// 写入积压缓冲区并转发给副本（调用方需持有 propagateMu 或命令写锁）
+//
+// 与命令的执行在同一把锁下进行，副本全量同步的快照因此与偏移量一致；事务中排队的命令
+// 等 EXEC 执行后一起计入，快照不会落在事务的中间。连接已经不是当前主节点的连接时丢弃。
+// 计入之后记录 AOF 中执行到这个偏移量的位置，fsync 之后以 FACK 报告给主节点。
+func (rs *RedisServer) replicationFeedStreamFromMaster(c *client) {
+	if c.multi {
+		return
+	}
+	rs.replMu.Lock()
+	offset := int64(-1)
+	if link := rs.masterLink; link != nil && link.conn == c.conn {
+		rs.replicationFeedStream(c.replStream)
+		rs.replSelectedDB = c.db.id
+		offset = rs.masterReplOffset
+	}
+	rs.replMu.Unlock()
+	c.replStream = nil
+	if offset >= 0 {
+		rs.aofTrackReplOffset(offset)
+	}
+}
+
+// replicationLoadPayload 用主节点发来的 RDB 替换整个数据集
+//
+// 与 Redis 一样先把 RDB 保存为本地的 RDB 文件，再清空所有数据库和函数后加载，期间持有命令写锁，
+// 其他命令都要等待。进行中的 BGSAVE 和 AOF 重写基于旧的数据集：前者等待它结束，以免之后覆盖
+// 新的 RDB 文件，后者直接停止；开启了 AOF 时加载后重写 AOF，新的 AOF 从同步得到的数据集开始。
+// 加载成功后积压缓冲区从主节点给出的偏移量重新开始。
+func (rs *RedisServer) replicationLoadPayload(link *masterLink, data []byte, replid string, offset int64) error {
+	for rs.lockExec(true) != nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer rs.unlockExec(true)
+	if link.cancelled() {
+		return errReplCancelled
+	}
+
+	// 持有命令写锁期间不会开始新的保存
+	for !rs.rdbSaving.CompareAndSwap(false, true) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rs.mutex.RLock()
+	dir, filename, aofEnabled := rs.dir, rs.dbfilename, rs.aofEnabled
+	rs.mutex.RUnlock()
+	rs.rdbFileMu.Lock()
+	err := rs.rdbWriteFile(dir, filename, data)
+	rs.rdbFileMu.Unlock()
+	rs.rdbSaving.Store(false)
+	if err != nil {
+		return fmt.Errorf("Failed trying to save the MASTER synchronization DB on disk: %v", err)
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	if aofEnabled {
+		rs.stopAppendOnly()
+	}
+	rs.aofKillRewrite()
+	// 旧的数据集不再对应任何复制偏移量，本节点的副本也要重新同步
+	rs.replMu.Lock()
+	rs.replCachedMaster, rs.replBacklog = false, nil
+	rs.replicationDisconnectReplicas()
+	rs.replMu.Unlock()
+
+	log.Println("MASTER <-> REPLICA sync: Flushing old data")
+	for _, db := range rs.databases {
+		rs.touchAllWatchedKeysInDb(db, nil)
+		freeKeyspace(db.empty(), true)
+	}
+	rs.functionsLua.Close()
+	rs.functionsInit()
+
+	log.Println("MASTER <-> REPLICA sync: Loading DB in memory")
+	rsi := &rdbSaveInfo{streamDB: -1}
+	_, loadErr := rs.rdbLoad(data, rsi)
+	if loadErr == nil {
+		rs.savedDirty.Store(rs.dirty.Load())
+		rs.lastSave.Store(time.Now().Unix())
+		rs.replMu.Lock()
+		rs.replid, rs.masterReplOffset = replid, offset
+		rs.replid2, rs.secondReplidOffset = "", -1
+		rs.replBacklog = newReplBacklog(rs.replBacklogSize, offset+1)
+		rs.replSelectedDB, rs.replCachedMaster = rsi.streamDB, true
+		rs.replMu.Unlock()
+	}
+	// 之前报告的 FACK 属于旧的数据集，加载的数据集在 AOF 重写完成并 fsync 之后才算持久化
+	rs.aofMu.Lock()
+	rs.aofReplOffs, rs.aofFsyncedReplOff = nil, 0
+	rs.aofMu.Unlock()
+	if aofEnabled {
+		log.Println("MASTER <-> REPLICA sync: Restarting AOF after a successful sync")
+		if err := rs.startAppendOnly(); err != nil {
+			log.Printf("Failed enabling the AOF after successful master synchronization: %v", err)
+		}
+	}
+	if loadErr != nil {
+		return fmt.Errorf("Failed trying to load the MASTER synchronization DB from disk: %v", loadErr)
+	}
+	rs.aofTrackReplOffset(offset)
+	return nil
+}
+
+// replicationSendAck 以 REPLCONF ACK offset 向主节点报告已经执行到的复制偏移量，
+// 开启了 AOF 时以 FACK aofoffset 同时报告 AOF 中已经 fsync 的偏移量，供主节点的 WAITAOF 使用
+//
+// 同步完成后立即发送一次，无盘复制的主节点收到之后才开始发送命令流；之后 replicationCron
+// 每秒发送一次，主节点在命令流中发送 REPLCONF GETACK 时，以及 FACK 前进时也立即发送。
+func (rs *RedisServer) replicationSendAck(link *masterLink, conn net.Conn) error {
+	link.writeMu.Lock()
+	defer link.writeMu.Unlock()
+	rs.aofMu.Lock()
+	aofOffset, aofOn := rs.aofFsyncedReplOff, rs.aofFile != nil || rs.aofWaitRewrite
+	rs.aofFackChanged.Store(false)
+	rs.aofMu.Unlock()
+	rs.replMu.Lock()
+	offset := rs.masterReplOffset
+	rs.replMu.Unlock()
+	args := []string{"REPLCONF", "ACK", strconv.FormatInt(offset, 10)}
+	if aofOn {
+		args = append(args, "FACK", strconv.FormatInt(aofOffset, 10))
+	}
+	conn.SetWriteDeadline(time.Now().Add(replTimeout))
+	_, err := conn.Write(appendRESPCommand(nil, args))
+	return err
+}
+
+// replicationSendFack 在 AOF 中已经 fsync 的复制偏移量前进之后立即向主节点发送 ACK，
+// 主节点上等待的 WAITAOF 不必等到下一次定期的 ACK
+func (rs *RedisServer) replicationSendFack() {
+	if !rs.aofFackChanged.Load() {
+		return
+	}
+	rs.replMu.Lock()
+	link := rs.masterLink
+	var conn net.Conn
+	if link != nil && link.state == REPL_STATE_CONNECTED {
+		conn = link.conn
+	}
+	rs.replMu.Unlock()
+	if conn != nil {
+		rs.replicationSendAck(link, conn)
+	}
+}
+
+// replSendCommand 向主节点发送一条命令并读取单行的回复
+//
+// 主节点在开始为同步进行 BGSAVE 之前，会在回复 PSYNC 之前发送单独的换行保持连接，这里跳过。
+func replSendCommand(conn net.Conn, reader *bufio.Reader, args ...string) (string, error) {
+	argv := make([]*RESPValue, len(args))
+	for i, arg := range args {
+		argv[i] = NewBulkStringValue(arg)
+	}
+	if _, err := conn.Write(NewArrayValue(argv).SerializeRESP()); err != nil {
+		return "", err
+	}
+	for {
+		conn.SetReadDeadline(time.Now().Add(replTimeout))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			return line, nil
+		}
+	}
+}
+
+// replReadPayload 读取主节点发送的 RDB
+//
+// 主节点准备 RDB 期间发送单独的换行保持连接，这里跳过；收到数据就延长读取的超时时间，
+// 并记录在 link 中供 INFO replication 报告接收的进度。
+func (rs *RedisServer) replReadPayload(link *masterLink, conn net.Conn, reader *bufio.Reader) ([]byte, error) {
+	var line string
+	for {
+		conn.SetReadDeadline(time.Now().Add(replTimeout))
+		var err error
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			break
+		}
+	}
+	if line[0] == '-' {
+		return nil, fmt.Errorf("MASTER aborted replication with an error: %s", line[1:])
+	}
+	if line[0] != '$' {
+		return nil, fmt.Errorf("Bad protocol from MASTER, the first byte is not '$' (we received '%s'), are you sure the host and port are right?", line)
+	}
+
+	if mark, ok := strings.CutPrefix(line, "$EOF:"); ok {
+		if len(mark) != replEOFMarkSize {
+			return nil, fmt.Errorf("Bad EOF mark from MASTER: %s", line)
+		}
+		log.Println("MASTER <-> REPLICA sync: receiving streamed RDB from master with EOF to disk")
+		var data []byte
+		buf := make([]byte, 64*1024)
+		for {
+			conn.SetReadDeadline(time.Now().Add(replTimeout))
+			n, err := reader.Read(buf)
+			data = append(data, buf[:n]...)
+			rs.replTransferProgress(link, int64(n))
+			if bytes.HasSuffix(data, []byte(mark)) {
+				return data[:len(data)-replEOFMarkSize], nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	size, err := strconv.ParseInt(line[1:], 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("Bad protocol from MASTER, invalid bulk length: %s", line)
+	}
+	log.Printf("MASTER <-> REPLICA sync: receiving %d bytes from master to disk", size)
+	rs.replMu.Lock()
+	link.transferSize = size
+	rs.replMu.Unlock()
+	data := make([]byte, size)
+	for read := 0; read < len(data); {
+		conn.SetReadDeadline(time.Now().Add(replTimeout))
+		n, err := reader.Read(data[read:])
+		read += n
+		rs.replTransferProgress(link, int64(n))
+		if err != nil && read < len(data) {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// replTransferProgress 记录接收 RDB 时又读取了 n 个字节
+func (rs *RedisServer) replTransferProgress(link *masterLink, n int64) {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	link.transferRead += n
+	link.transferLastIO = time.Now()
+}
+
+// countingReader 统计从 r 读取的字节数，用于计算命令流中每条命令占用的字节数；
+// recording 为 true 时读取的内容还追加到 rec，由读取命令流的一方取走
+type countingReader struct {
+	r         io.Reader
+	n         int64
+	recording bool
+	rec       []byte
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	if cr.recording {
+		cr.rec = append(cr.rec, p[:n]...)
+	}
+	return n, err
+}
+
+// 连接到本节点的副本的同步状态
+const (
+	SLAVE_STATE_NONE              = iota // 不是副本
+	SLAVE_STATE_WAIT_BGSAVE_START        // 等待开始新的 BGSAVE
+	SLAVE_STATE_WAIT_BGSAVE_END          // 等待 BGSAVE 完成
+	SLAVE_STATE_SEND_BULK                // 正在发送 RDB
+	SLAVE_STATE_ONLINE                   // 同步完成，正在接收命令流
+)
+
+// slaveStateNames 是 INFO replication 中各状态的名称
+var slaveStateNames = map[int]string{
+	SLAVE_STATE_WAIT_BGSAVE_START: "wait_bgsave",
+	SLAVE_STATE_WAIT_BGSAVE_END:   "wait_bgsave",
+	SLAVE_STATE_SEND_BULK:         "send_bulk",
+	SLAVE_STATE_ONLINE:            "online",
+}
+
+const (
+	// replPingPeriod 是主节点在命令流中发送 PING 的间隔，副本据此判断连接是否正常
+	replPingPeriod = 10 * time.Second
+)
+
+// replSnapshot 是为全量同步进行的一次 BGSAVE
+//
+// offset 是快照对应的复制偏移量，BGSAVE 完成后 finished 为 true，rdb 是保存的内容（失败时为 nil）。
+// BGSAVE 进行期间新连接的副本复制已有副本暂存的命令流，共用同一个快照。字段由 replMu 保护。
+//
+// diskless 表示无盘复制：快照不写入文件，而是在保存的同时通过 targets 中每个副本的管道发送，
+// 开始之后连接的副本只能等待下一次 BGSAVE。targets 在 ready 关闭之前确定，之后只由发送的一方访问。
+type replSnapshot struct {
+	offset   int64
+	finished bool
+	rdb      []byte
+	diskless bool
+	ready    chan struct{}
+	targets  []disklessTarget
+}
+
+// disklessTarget 是无盘复制时接收快照的副本，pw 是连接到副本 writeLoop 的管道
+type disklessTarget struct {
+	c  *client
+	pw *io.PipeWriter
+}
+
+// handleSync 处理 PSYNC replid offset 和 SYNC 命令，连接从此成为副本
+//
+// PSYNC 请求的位置在积压缓冲区中时部分同步（见 replicationTryPartialResync），否则全量同步。
+// 全量同步使用 BGSAVE 保存的 RDB：回复 +FULLRESYNC replid offset（SYNC 不回复）后，
+// BGSAVE 完成时发送 $长度 和 RDB 的内容，然后发送从快照时起传播的命令流。已有为同步进行的
+// BGSAVE 时共用它的快照；其他原因的 BGSAVE 在进行时等它结束后再开始新的 BGSAVE。
+// 持有 propagateMu，注册副本和取得快照时没有写命令传播，命令流因此与快照衔接。
+// PSYNC replid offset FAILOVER 是主节点在 FAILOVER 中发送的，本节点先成为主节点再处理同步。
+func (rs *RedisServer) handleSync(c *client, command *RESPValue, psync bool) *RESPValue {
+	var psyncReplid string
+	var psyncOffset int64
+	var failover bool
+	if psync {
+		args, errResp := getArgs(command)
+		if errResp != nil {
+			return errResp
+		}
+		offset, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		psyncReplid, psyncOffset = args[0], offset
+		failover = len(args) > 2 && strings.EqualFold(args[2], "failover")
+	}
+
+	rs.propagateMu.Lock()
+	defer rs.propagateMu.Unlock()
+	rs.replMu.Lock()
+	if c.replState != SLAVE_STATE_NONE {
+		rs.replMu.Unlock()
+		return nil
+	}
+	if failover {
+		// 主节点在 FAILOVER 中把本节点提升为主节点，它的复制 ID 必须与本节点相同，数据集才一致
+		if psyncReplid != rs.replid {
+			rs.replMu.Unlock()
+			return NewErrorValue("ERR PSYNC FAILOVER replid must match my replid.")
+		}
+		if rs.masterHost != "" {
+			rs.replicationUnsetMaster()
+			log.Printf("MASTER MODE enabled (failover request from 'id=%d addr=%s')", c.id, clientAddr(c))
+		}
+	}
+	if rs.failover != nil {
+		rs.replMu.Unlock()
+		return NewErrorValue("NOMASTERLINK Can't SYNC while failing over")
+	}
+	if rs.masterHost != "" && (rs.masterLink == nil || rs.masterLink.state != REPL_STATE_CONNECTED) {
+		rs.replMu.Unlock()
+		return NewErrorValue("NOMASTERLINK Can't SYNC while not connected with my master")
+	}
+	log.Printf("Replica %s asks for synchronization", replicaName(c))
+	if psync && rs.replicationTryPartialResync(c, psyncReplid, psyncOffset) {
+		rs.replMu.Unlock()
+		return nil
+	}
+	c.replState, c.replOldSync, c.replAckTime = SLAVE_STATE_WAIT_BGSAVE_START, !psync, time.Now()
+	rs.replicas = append(rs.replicas, c)
+	c.writeMu.Lock()
+	c.replica, c.replHold = true, true
+	c.writeMu.Unlock()
+	if len(rs.replicas) == 1 && rs.replBacklog == nil {
+		// 没有积压缓冲区时复制偏移量没有随写命令增加，不能与以前的命令流衔接，换用新的复制 ID
+		rs.replid, rs.replid2, rs.secondReplidOffset = newReplid(), "", -1
+		rs.replBacklog = newReplBacklog(rs.replBacklogSize, rs.masterReplOffset+1)
+		log.Printf("Replication backlog created, my new replication IDs are '%s' and '%s'", rs.replid, strings.Repeat("0", 40))
+	}
+
+	if s := rs.replBgsave; s != nil {
+		for _, other := range rs.replicas {
+			if other.replSnapshot != s || other.replState != SLAVE_STATE_WAIT_BGSAVE_END {
+				continue
+			}
+			other.writeMu.Lock()
+			buf := append([]byte(nil), other.replBuf...)
+			other.writeMu.Unlock()
+			c.writeRaw(buf, true)
+			rs.replicationAttach(c, s)
+			log.Println("Waiting for end of BGSAVE for SYNC")
+			rs.replMu.Unlock()
+			return nil
+		}
+	}
+	if rs.rdbSaving.Load() {
+		log.Println("Can't attach the replica to the current BGSAVE. Waiting for next BGSAVE for SYNC")
+		rs.replMu.Unlock()
+		return nil
+	}
+	if rs.replDisklessSync && c.replCapaEOF && rs.replDisklessSyncDelay > 0 {
+		// 等待更多的副本连接，由 replicationCron 开始 BGSAVE，一起同步
+		log.Println("Delay next BGSAVE for diskless SYNC")
+		rs.replMu.Unlock()
+		return nil
+	}
+	rs.replMu.Unlock()
+	rs.replicationStartBgsave()
+	return nil
+}
+
+// replicationTryPartialResync 尝试从积压缓冲区继续副本的复制（调用方需持有 propagateMu 和 replMu）
+//
+// replid 是当前的复制 ID，或者是上一个复制 ID 而 offset 不超过它有效的范围，并且从 offset 开始的
+// 命令流都还在积压缓冲区中时，回复 +CONTINUE（副本支持 psync2 时带上当前的复制 ID），
+// 补发缓冲区中 offset 之后的命令流，副本立即进入 online 状态；否则返回 false，改为全量同步。
+func (rs *RedisServer) replicationTryPartialResync(c *client, replid string, offset int64) bool {
+	if replid != rs.replid && (replid != rs.replid2 || offset > rs.secondReplidOffset) {
+		switch {
+		case replid == "?":
+			log.Printf("Full resync requested by replica %s", replicaName(c))
+		case replid != rs.replid2:
+			log.Printf("Partial resynchronization not accepted: Replication ID mismatch (Replica asked for '%s', my replication IDs are '%s' and '%s')", replid, rs.replid, rs.replid2)
+		default:
+			log.Printf("Partial resynchronization not accepted: Requested offset for second ID was %d, but I can reply up to %d", offset, rs.secondReplidOffset)
+		}
+		return false
+	}
+	if rs.replBacklog == nil || !rs.replBacklog.contains(offset) {
+		log.Printf("Unable to partial resync with replica %s for lack of backlog (Replica request was: %d).", replicaName(c), offset)
+		return false
+	}
+
+	c.replState, c.replAckTime = SLAVE_STATE_ONLINE, time.Now()
+	rs.replicas = append(rs.replicas, c)
+	c.writeMu.Lock()
+	c.replica = true
+	c.writeMu.Unlock()
+	reply := "CONTINUE"
+	if c.replCapaPsync2 {
+		reply += " " + rs.replid
+	}
+	c.write(NewSimpleStringValue(reply))
+	data := rs.replBacklog.copyFrom(offset)
+	c.writeRaw(data, true)
+	log.Printf("Partial resynchronization request from %s accepted. Sending %d bytes of backlog starting from offset %d.", replicaName(c), len(data), offset)
+	return true
+}
+
+// replicaAddr 返回副本的地址和端口，分别是 REPLCONF ip-address 和 listening-port 报告的地址和端口，
+// 没有报告时是连接的地址和端口（调用方需持有 replMu）
+func replicaAddr(c *client) (string, int) {
+	host, port, _ := net.SplitHostPort(clientAddr(c))
+	n, _ := strconv.Atoi(port)
+	if c.replIPAddress != "" {
+		host = c.replIPAddress
+	}
+	if c.replListeningPort != 0 {
+		n = c.replListeningPort
+	}
+	return host, n
+}
+
+// replicaName 返回副本在日志中的名称（调用方需持有 replMu）
+func replicaName(c *client) string {
+	host, port := replicaAddr(c)
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// replicationStartBgsave 为等待同步的副本开始 BGSAVE（调用方需持有命令锁和 propagateMu）
+//
+// BGSAVE 已经在进行时什么都不做，副本继续等待，由 replicationCron 稍后重试。
+// 快照中记录复制 ID、偏移量和命令流此时选择的数据库（见 rdbSaveInfo）。开启了 repl-diskless-sync
+// 并且等待的副本都支持 EOF 格式（REPLCONF capa eof）时使用无盘复制，否则保存到磁盘。
+func (rs *RedisServer) replicationStartBgsave() {
+	s := &replSnapshot{}
+	rs.replMu.Lock()
+	rsi := &rdbSaveInfo{streamDB: max(rs.replSelectedDB, 0), replid: rs.replid, offset: rs.masterReplOffset}
+	s.diskless = rs.replDisklessSync
+	for _, c := range rs.replicas {
+		if c.replState == SLAVE_STATE_WAIT_BGSAVE_START && !c.replCapaEOF {
+			s.diskless = false
+		}
+	}
+	rs.replMu.Unlock()
+	var err error
+	if s.diskless {
+		s.ready = make(chan struct{})
+		err = rs.rdbSaveBackgroundStream(rsi, func(writeTo func(io.Writer) error) {
+			rs.replicationStreamRdb(s, writeTo)
+		})
+	} else {
+		err = rs.rdbSaveBackgroundNotify(rsi, func(rdb []byte) {
+			rs.replicationBgsaveDone(s, rdb)
+		})
+	}
+	if err != nil {
+		return
+	}
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if s.diskless {
+		log.Println("Starting BGSAVE for SYNC with target: replicas sockets")
+		defer close(s.ready)
+	} else {
+		log.Println("Starting BGSAVE for SYNC with target: disk")
+	}
+	s.offset = rs.masterReplOffset
+	// 主节点快照之后的命令流从 SELECT 开始；副本转发的命令流不能改变，它的副本从 repl-stream-db 开始
+	if rs.masterHost == "" {
+		rs.replSelectedDB = -1
+	}
+	if !s.finished && !s.diskless {
+		rs.replBgsave = s
+	}
+	for _, c := range rs.replicas {
+		if c.replState == SLAVE_STATE_WAIT_BGSAVE_START {
+			rs.replicationAttach(c, s)
+		}
+	}
+}
+
+// replicationAttach 让副本使用快照 s 全量同步：回复 +FULLRESYNC，快照已经保存完时立即发送（调用方需持有 replMu）
+func (rs *RedisServer) replicationAttach(c *client, s *replSnapshot) {
+	c.replSnapshot, c.replPsyncOffset = s, s.offset
+	c.replState = SLAVE_STATE_WAIT_BGSAVE_END
+	if !c.replOldSync {
+		c.write(NewSimpleStringValue(fmt.Sprintf("FULLRESYNC %s %d", rs.replid, s.offset)))
+	}
+	if s.diskless {
+		pr, pw := io.Pipe()
+		s.targets = append(s.targets, disklessTarget{c: c, pw: pw})
+		c.replState = SLAVE_STATE_SEND_BULK
+		c.writeMu.Lock()
+		c.replBulk = pr
+		c.writeCond.Signal()
+		c.writeMu.Unlock()
+	} else if s.finished {
+		rs.replicationSendBulk(c, s.rdb)
+	}
+}
+
+// replicationStreamRdb 在无盘复制的后台保存中调用，把快照以 $EOF:随机串 加上内容和同一个随机串的
+// 格式同时发送给所有接收快照的副本
+//
+// 发送给某个副本失败（连接断开）时跳过它，其余的副本继续；快照保存失败或者副本都已断开时，
+// 断开剩下的副本，它们重新连接后再同步。
+func (rs *RedisServer) replicationStreamRdb(s *replSnapshot, writeTo func(io.Writer) error) {
+	<-s.ready
+	mark := newReplid()
+	w := &disklessWriter{targets: s.targets}
+	// 快照逐个键写出，先攒成较大的块再交给副本
+	bw := bufio.NewWriterSize(w, 64*1024)
+	bw.WriteString("$EOF:" + mark + "\r\n")
+	err := writeTo(bw)
+	if err == nil {
+		bw.WriteString(mark)
+		err = bw.Flush()
+	}
+	for _, t := range s.targets {
+		if err != nil {
+			t.pw.CloseWithError(err)
+			t.c.conn.Close()
+		} else {
+			t.pw.Close()
+		}
+	}
+	if err != nil {
+		log.Printf("Diskless rdb transfer failed: %v", err)
+		return
+	}
+	log.Printf("Diskless rdb transfer done, %d bytes sent to %d replicas", w.n, w.alive())
+}
+
+// disklessWriter 把无盘复制的快照依次写入每个副本的管道，写入失败的副本被跳过
+type disklessWriter struct {
+	targets []disklessTarget
+	failed  map[int]bool
+	n       int64
+}
+
+// errNoReplicasLeft 表示无盘复制时接收快照的副本都已断开
+var errNoReplicasLeft = errors.New("all the replicas disconnected")
+
+func (w *disklessWriter) Write(p []byte) (int, error) {
+	for i, t := range w.targets {
+		if w.failed[i] {
+			continue
+		}
+		if _, err := t.pw.Write(p); err != nil {
+			if w.failed == nil {
+				w.failed = make(map[int]bool)
+			}
+			w.failed[i] = true
+		}
+	}
+	if w.alive() == 0 {
+		return 0, errNoReplicasLeft
+	}
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// alive 返回还在接收快照的副本数
+func (w *disklessWriter) alive() int {
+	return len(w.targets) - len(w.failed)
+}
+
+// replicationBgsaveDone 在同步使用的 BGSAVE 结束时调用，向等待它的副本发送 RDB，失败时断开这些副本
+func (rs *RedisServer) replicationBgsaveDone(s *replSnapshot, rdb []byte) {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	s.finished, s.rdb = true, rdb
+	if rs.replBgsave == s {
+		rs.replBgsave = nil
+	}
+	for _, c := range rs.replicas {
+		if c.replSnapshot == s && c.replState == SLAVE_STATE_WAIT_BGSAVE_END {
+			rs.replicationSendBulk(c, rdb)
+		}
+	}
+}
+
+// replicationSendBulk 把 RDB 交给副本的 writeLoop 发送，rdb 为 nil 表示 BGSAVE 失败，断开副本（调用方需持有 replMu）
+func (rs *RedisServer) replicationSendBulk(c *client, rdb []byte) {
+	if rdb == nil {
+		log.Printf("SYNC failed. BGSAVE child returned an error, closing replica %s", replicaName(c))
+		c.conn.Close()
+		return
+	}
+	c.replState = SLAVE_STATE_SEND_BULK
+	c.writeMu.Lock()
+	c.replBulk = &net.Buffers{[]byte("$" + strconv.Itoa(len(rdb)) + "\r\n"), rdb}
+	c.writeCond.Signal()
+	c.writeMu.Unlock()
+}
+
+// replicationBulkSent 在副本的 RDB 发送完毕后由 writeLoop 调用
+//
+// 磁盘方式同步的副本立即开始接收命令流。无盘复制与 Redis 相同，等副本加载完快照、发送第一个
+// REPLCONF ACK 之后再发送命令流（见 handleReplconf），在此之前命令流暂存在主节点。
+func (rs *RedisServer) replicationBulkSent(c *client) {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if c.replState != SLAVE_STATE_SEND_BULK {
+		// 副本已经断开
+		return
+	}
+	if c.replSnapshot.diskless {
+		c.replWaitAck = true
+		log.Printf("Streamed RDB transfer with replica %s succeeded (socket). Waiting for REPLCONF ACK from replica to enable streaming", replicaName(c))
+		return
+	}
+	rs.replicaOnline(c)
+}
+
+// replicaOnline 让副本进入 online 状态，开始发送暂存的命令流（调用方需持有 replMu）
+func (rs *RedisServer) replicaOnline(c *client) {
+	// 从现在开始计算 ACK 的超时
+	c.replState, c.replSnapshot, c.replAckTime, c.replWaitAck = SLAVE_STATE_ONLINE, nil, time.Now(), false
+	log.Printf("Synchronization with replica %s succeeded", replicaName(c))
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.obuf = append(c.obuf, c.replBuf...)
+	c.replBuf, c.replHold = nil, false
+	c.writeCond.Signal()
+}
+
+// replicationRemoveReplica 在副本的连接关闭时把它从副本列表中移除
+func (rs *RedisServer) replicationRemoveReplica(c *client) {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if c.replState == SLAVE_STATE_NONE {
+		return
+	}
+	for i, replica := range rs.replicas {
+		if replica == c {
+			rs.replicas = append(rs.replicas[:i], rs.replicas[i+1:]...)
+			break
+		}
+	}
+	log.Printf("Connection with replica %s lost.", replicaName(c))
+	c.replState, c.replSnapshot, c.replWaitAck = SLAVE_STATE_NONE, nil, false
+	if len(rs.replicas) == 0 {
+		rs.replNoSlavesSince = time.Now()
+	}
+}
+
+// replicationDisconnectReplicas 断开所有的副本，它们重新连接后再同步（调用方需持有 replMu）
+func (rs *RedisServer) replicationDisconnectReplicas() {
+	for _, c := range rs.replicas {
+		c.conn.Close()
+	}
+}
+
+// replicationFeedSlaves 把传播的命令加入命令流（调用方需持有 propagateMu 或命令写锁）
+//
+// 命令编码一次后交给 replicationFeedStream。副本的命令流来自主节点（见 replicationFeedStreamFromMaster），
+// 自己执行的命令不发送给副本；没有积压缓冲区也没有副本时不产生命令流，偏移量也不变。
+func (rs *RedisServer) replicationFeedSlaves(cmds []propagatedCommand) {
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	if rs.masterHost != "" || (rs.replBacklog == nil && len(rs.replicas) == 0) {
+		return
+	}
+	rs.replicationFeedStream(catAppendOnlyCommands(nil, cmds, &rs.replSelectedDB))
+}
+
+// replicationFeedStream 把一段命令流写入积压缓冲区并追加到每个副本的输出，复制偏移量增加它的长度
+// （调用方需持有 replMu）
+//
+// 还在等待 BGSAVE 开始的副本之后会从快照开始同步，不需要这些命令。
+func (rs *RedisServer) replicationFeedStream(buf []byte) {
+	if rs.replBacklog != nil {
+		rs.replBacklog.feed(buf)
+	}
+	rs.masterReplOffset += int64(len(buf))
+	for _, c := range rs.replicas {
+		if c.replState != SLAVE_STATE_WAIT_BGSAVE_START {
+			c.writeRaw(buf, true)
+		}
+	}
+}
+
+// handleReplconf 处理副本在同步过程中发送的 REPLCONF option value [option value ...] 命令
+//
+// listening-port 和 ip-address 是副本接受连接的端口和地址，capa 是副本支持的能力（eof 表示接受无盘复制的格式，
+// psync2 表示接受带复制 ID 的 +CONTINUE）。ACK offset 是副本报告的复制偏移量，
+// GETACK 是主节点在命令流中要求副本立即发送 ACK，两者都不回复。
+func (rs *RedisServer) handleReplconf(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args)%2 != 0 {
+		return NewErrorValue("ERR syntax error")
+	}
+	if strings.EqualFold(args[0], "getack") {
+		rs.replMu.Lock()
+		link := rs.masterLink
+		current := c.master && link != nil && link.conn == c.conn
+		rs.replMu.Unlock()
+		if current {
+			rs.replicationSendAck(link, c.conn)
+		}
+		return nil
+	}
+	// ACK 可能让等待的 WAIT 和 WAITAOF 返回，在释放 replMu 之后服务它们
+	defer rs.handleClientsWaitingAcks()
+	rs.replMu.Lock()
+	defer rs.replMu.Unlock()
+	for i := 0; i < len(args); i += 2 {
+		switch strings.ToLower(args[i]) {
+		case "listening-port":
+			port, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || port < 0 || port > 65535 {
+				return NewErrorValue("ERR value is not an integer or out of range")
+			}
+			c.replListeningPort = int(port)
+		case "ip-address":
+			c.replIPAddress = args[i+1]
+		case "capa":
+			switch strings.ToLower(args[i+1]) {
+			case "eof":
+				c.replCapaEOF = true
+			case "psync2":
+				c.replCapaPsync2 = true
+			}
+		case "ack":
+			// 不是副本的连接发送的 ACK 被忽略；开启了 AOF 的副本在后面带上 FACK offset
+			offset, err := strconv.ParseInt(args[i+1], 10, 64)
+			if c.replState == SLAVE_STATE_NONE || err != nil {
+				return nil
+			}
+			c.replAckOff = max(c.replAckOff, offset)
+			c.replAckTime = time.Now()
+			if i+3 < len(args) && strings.EqualFold(args[i+2], "fack") {
+				if aofOffset, err := strconv.ParseInt(args[i+3], 10, 64); err == nil {
+					c.replAofOff = max(c.replAofOff, aofOffset)
+				}
+			}
+			if c.replWaitAck {
+				rs.replicaOnline(c)
+			}
+			rs.signalAcksReady()
+			rs.updateFailoverStatus()
+			return nil
+		default:
+			return NewErrorValue("ERR Unrecognized REPLCONF option: " + args[i])
+		}
+	}
+	return NewSimpleStringValue("OK")
+}
+
+// handleWait 处理 WAIT numreplicas timeout 命令
+//
+// 阻塞到至少 numreplicas 个副本确认了命令开始时的复制偏移量，返回已经确认的副本数。
+// 等待的是命令开始时已经传播的所有写命令，其中包括这个客户端的写命令。timeout 是毫秒数，
+// 0 表示永久等待，超时时返回当时确认的副本数；事务中不阻塞，直接返回当前的数量。
+// 需要等待时在命令流中发送 REPLCONF GETACK *，副本收到后立即回复 ACK，不必等到下一次
+// 定期的 ACK。与阻塞命令一样以 blockClient 等待，按阻塞的先后顺序被服务。
+func (rs *RedisServer) handleWait(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	numreplicas, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return NewErrorValue("ERR value is not an integer or out of range")
+	}
+	ms, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return NewErrorValue("ERR timeout is not an integer or out of range")
+	}
+	if ms < 0 {
+		return NewErrorValue("ERR timeout is negative")
+	}
+
+	// 正在执行的写命令（包括刚刚服务了这个客户端的阻塞命令的写入方）传播完成之后再取偏移量
+	rs.propagateMu.Lock()
+	rs.replMu.Lock()
+	if rs.masterHost != "" {
+		rs.replMu.Unlock()
+		rs.propagateMu.Unlock()
+		return NewErrorValue("ERR WAIT cannot be used with replica instances. Please also note that writes to replicas are just local and are not propagated.")
+	}
+	target := rs.masterReplOffset
+	acked := rs.replicationCountAcks(target)
+	rs.replMu.Unlock()
+	if acked < numreplicas && !c.denyBlocking {
+		rs.replicationFeedSlaves([]propagatedCommand{{dbid: -1, argv: []string{"REPLCONF", "GETACK", "*"}}})
+	}
+	rs.propagateMu.Unlock()
+
+	current := func() *RESPValue {
+		rs.replMu.Lock()
+		defer rs.replMu.Unlock()
+		return NewIntegerValue(rs.replicationCountAcks(target))
+	}
+	return rs.blockForAcks(c, time.Duration(ms)*time.Millisecond, func() *RESPValue {
+		if reply := current(); reply.Num >= numreplicas {
+			return reply
+		}
+		return nil
+	}, current)
+}
+
+// replicationCountAcks 返回已经确认了复制偏移量 offset 的在线副本数（调用方需持有 replMu）
+func (rs *RedisServer) replicationCountAcks(offset int64) int64 {
+	var n int64
+	for _, c := range rs.replicas {
+		if c.replState == SLAVE_STATE_ONLINE && c.replAckOff >= offset {
+			n++
+		}
+	}
+	return n
+}
+
+// replicationCountAofAcks 返回已经以 FACK 确认在 AOF 中 fsync 了复制偏移量 offset 的在线副本数（调用方需持有 replMu）
+func (rs *RedisServer) replicationCountAofAcks(offset int64) int64 {
+	var n int64
+	for _, c := range rs.replicas {
+		if c.replState == SLAVE_STATE_ONLINE && c.replAofOff >= offset {
+			n++
+		}
+	}
+	return n
+}
+
+// replicationCron 每秒执行一次：作为副本时向主节点发送 ACK；向等待 BGSAVE 的副本发送换行保持连接，
+// 断开超过 replTimeout 没有 ACK 的副本；作为主节点时每隔 replPingPeriod 在命令流中发送 PING，
+// 没有副本超过 repl-backlog-ttl 秒后释放积压缓冲区；检查故障转移是否超时；并为等待的副本开始 BGSAVE
+func (rs *RedisServer) replicationCron() {
+	rs.replMu.Lock()
+	var ackLink *masterLink
+	var ackConn net.Conn
+	if link := rs.masterLink; link != nil && link.state == REPL_STATE_CONNECTED {
+		ackLink, ackConn = link, link.conn
+	}
+	if rs.masterHost == "" && len(rs.replicas) == 0 && rs.replBacklog != nil && rs.replBacklogTTL > 0 &&
+		time.Since(rs.replNoSlavesSince) > time.Duration(rs.replBacklogTTL)*time.Second {
+		// 之后的写命令不计入偏移量，以后的副本不能从现在的位置部分同步
+		rs.replid, rs.replid2, rs.secondReplidOffset = newReplid(), "", -1
+		rs.replBacklog = nil
+		log.Printf("Replication backlog freed after %d seconds without connected replicas.", rs.replBacklogTTL)
+	}
+	waiting, maxIdle := 0, time.Duration(0)
+	for _, c := range rs.replicas {
+		switch c.replState {
+		case SLAVE_STATE_WAIT_BGSAVE_START:
+			waiting++
+			maxIdle = max(maxIdle, time.Since(c.replAckTime))
+			c.writeRaw([]byte("\n"), false)
+		case SLAVE_STATE_WAIT_BGSAVE_END:
+			c.writeRaw([]byte("\n"), false)
+		case SLAVE_STATE_ONLINE:
+			// 以 SYNC 同步的旧副本不发送 ACK
+			if !c.replOldSync && time.Since(c.replAckTime) > replTimeout {
+				log.Printf("Disconnecting timedout replica (streaming sync): %s", replicaName(c))
+				c.conn.Close()
+			}
+		}
+	}
+	rs.updateFailoverStatus()
+	// 故障转移等待副本赶上时不发送 PING，复制偏移量保持不变
+	// 无盘复制时等第一个副本等待了 repl-diskless-sync-delay 秒，或者等待的副本达到
+	// repl-diskless-sync-max-replicas 个时再开始，让更多的副本共用一次传输
+	startBgsave := waiting > 0 && (!rs.replDisklessSync ||
+		(rs.replDisklessSyncMaxReplicas > 0 && int64(waiting) >= rs.replDisklessSyncMaxReplicas) ||
+		maxIdle >= time.Duration(rs.replDisklessSyncDelay)*time.Second)
+	ping := rs.masterHost == "" && rs.failover == nil && len(rs.replicas) > 0 && time.Since(rs.replLastPing) >= replPingPeriod
+	if ping {
+		rs.replLastPing = time.Now()
+	}
+	rs.replMu.Unlock()
+	if ackLink != nil {
+		// 发送失败时连接已经断开，由 replicationStream 处理
+		rs.replicationSendAck(ackLink, ackConn)
+	}
+	if !ping && (!startBgsave || rs.rdbSaving.Load()) {
+		return
+	}
+
+	// 与写命令一样取得命令锁和 propagateMu，脚本超时时跳过这一次
+	if run := rs.lockExec(false); run != nil {
+		return
+	}
+	defer rs.unlockExec(false)
+	rs.propagateMu.Lock()
+	defer rs.propagateMu.Unlock()
+	if ping {
+		rs.replicationFeedSlaves([]propagatedCommand{{dbid: -1, argv: []string{"PING"}}})
+	}
+	if startBgsave && !rs.rdbSaving.Load() {
+		rs.replicationStartBgsave()
+	}
+}
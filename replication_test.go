@@ -0,0 +1,536 @@
+package goredis
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startReplica 启动 master 的副本，等待全量同步完成
+func startReplica(t *testing.T, master *testServer, conf ...string) *testServer {
+	t.Helper()
+	host, port, _ := strings.Cut(master.addr, ":")
+	replica := startTestServer(t, append([]string{fmt.Sprintf("replicaof %s %s", host, port)}, conf...)...)
+	waitFor(t, "replica to come online", func() bool { return master.onlineReplicas() == 1 && replica.masterLinkUp() })
+	return replica
+}
+
+// onlineReplicas 返回已经完成同步的副本数
+func (ts *testServer) onlineReplicas() int {
+	ts.rs.replMu.Lock()
+	defer ts.rs.replMu.Unlock()
+	n := 0
+	for _, c := range ts.rs.replicas {
+		if c.replState == SLAVE_STATE_ONLINE {
+			n++
+		}
+	}
+	return n
+}
+
+// waitingAcks 返回阻塞在 WAIT 或 WAITAOF 上的客户端数量
+func (ts *testServer) waitingAcks() int {
+	ts.rs.mutex.RLock()
+	defer ts.rs.mutex.RUnlock()
+	return len(ts.rs.clientsWaitingAcks)
+}
+
+// replicaOffsets 返回唯一的副本以 ACK 和 FACK 报告的复制偏移量，以及本节点的复制偏移量
+func (ts *testServer) replicaOffsets() (ack, fack, master int64) {
+	ts.rs.replMu.Lock()
+	defer ts.rs.replMu.Unlock()
+	c := ts.rs.replicas[0]
+	return c.replAckOff, c.replAofOff, ts.rs.masterReplOffset
+}
+
+// masterLinkUp 返回副本是否已经加载了主节点的数据，正在接收命令流
+func (ts *testServer) masterLinkUp() bool {
+	ts.rs.replMu.Lock()
+	defer ts.rs.replMu.Unlock()
+	return ts.rs.masterLink != nil && ts.rs.masterLink.state == REPL_STATE_CONNECTED
+}
+
+// fakeMaster 是只会全量同步的最小主节点：回复握手，以 rdb 全量同步，之后由测试发送命令流
+type fakeMaster struct {
+	t      *testing.T
+	ln     net.Listener
+	replid string
+	rdb    []byte
+	links  chan *fakeMasterLink
+}
+
+// fakeMasterLink 是 fakeMaster 与一个副本之间完成了全量同步的连接
+type fakeMasterLink struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	sent   int64
+}
+
+// startFakeMaster 在随机端口上启动 fakeMaster，副本连接后用 rdb 全量同步
+func startFakeMaster(t *testing.T, rdb []byte) *fakeMaster {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	fm := &fakeMaster{t: t, ln: ln, replid: strings.Repeat("ab", 20), rdb: rdb, links: make(chan *fakeMasterLink, 4)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			go fm.handshake(conn)
+		}
+	}()
+	return fm
+}
+
+// handshake 回复副本的 PING、REPLCONF 和 PSYNC，发送 RDB 后把连接交给测试
+func (fm *fakeMaster) handshake(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		command, err := ParseRESP(reader)
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(command.Array[0].Str) {
+		case "PING":
+			conn.Write([]byte("+PONG\r\n"))
+		case "REPLCONF":
+			conn.Write([]byte("+OK\r\n"))
+		case "PSYNC":
+			fmt.Fprintf(conn, "+FULLRESYNC %s 0\r\n$%d\r\n", fm.replid, len(fm.rdb))
+			conn.Write(fm.rdb)
+			fm.links <- &fakeMasterLink{t: fm.t, conn: conn, reader: reader}
+			return
+		default:
+			conn.Write([]byte("-ERR unexpected command\r\n"))
+		}
+	}
+}
+
+// replicaof 返回指向 fakeMaster 的 replicaof 配置
+func (fm *fakeMaster) replicaof() string {
+	host, port, _ := strings.Cut(fm.ln.Addr().String(), ":")
+	return fmt.Sprintf("replicaof %s %s", host, port)
+}
+
+// accept 等待下一个副本完成全量同步
+func (fm *fakeMaster) accept() *fakeMasterLink {
+	fm.t.Helper()
+	select {
+	case link := <-fm.links:
+		return link
+	case <-time.After(10 * time.Second):
+		fm.t.Fatal("timed out waiting for the replica to sync")
+		return nil
+	}
+}
+
+// send 把一条命令写入命令流
+func (link *fakeMasterLink) send(args ...string) {
+	link.t.Helper()
+	argv := make([]*RESPValue, len(args))
+	for i, arg := range args {
+		argv[i] = NewBulkStringValue(arg)
+	}
+	data := NewArrayValue(argv).SerializeRESP()
+	if _, err := link.conn.Write(data); err != nil {
+		link.t.Fatal(err)
+	}
+	link.sent += int64(len(data))
+}
+
+// readAck 读取副本发送的 REPLCONF ACK，返回其中的复制偏移量
+func (link *fakeMasterLink) readAck() string {
+	link.t.Helper()
+	link.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	command, err := ParseRESP(link.reader)
+	if err != nil {
+		link.t.Fatalf("reading REPLCONF ACK: %v", err)
+	}
+	if len(command.Array) < 3 || !strings.EqualFold(command.Array[0].Str, "REPLCONF") || !strings.EqualFold(command.Array[1].Str, "ACK") {
+		link.t.Fatalf("replica sent %s", replyString(command))
+	}
+	return command.Array[2].Str
+}
+
+// masterDataset 返回含有 str、list 和 5 号数据库中 set 的数据集的 RDB 内容
+func masterDataset() []byte {
+	src := NewRedisServer("127.0.0.1", 0, 16)
+	src.databases[0].store.Set("str", NewStringObject("v"))
+	list := NewListObject()
+	list.Value.(*List).PushRight("a")
+	list.Value.(*List).PushRight("b")
+	src.databases[0].store.Set("list", list)
+	set := NewSetObject()
+	set.Value.(*Set).Add("x")
+	src.databases[5].store.Set("set", set)
+	return src.rdbEncode(false)
+}
+
+func TestReplicaFullSync(t *testing.T) {
+	fm := startFakeMaster(t, masterDataset())
+	replica := startTestServer(t, fm.replicaof())
+	link := fm.accept()
+	// 加载完成后立即以 ACK 报告偏移量
+	if off := link.readAck(); off != "0" {
+		t.Fatalf("first ACK reports offset %s", off)
+	}
+	waitFor(t, "replica to come online", replica.masterLinkUp)
+
+	r := replica.connect(t)
+	r.mustDo("v", "GET", "str")
+	r.mustDo("[a b]", "LRANGE", "list", "0", "-1")
+	r.mustDo("OK", "SELECT", "5")
+	r.mustDo("[x]", "SMEMBERS", "set")
+	info := r.do("INFO", "replication").Str
+	if infoValue(t, info, "role") != "slave" || infoValue(t, info, "master_link_status") != "up" {
+		t.Fatalf("INFO replication:\n%s", info)
+	}
+	host, port, _ := strings.Cut(fm.ln.Addr().String(), ":")
+	r.mustDo(fmt.Sprintf("[replicaof %s %s]", host, port), "CONFIG", "GET", "replicaof")
+	if replica.rs.replid != fm.replid {
+		t.Fatalf("replica replid %s, want the master's %s", replica.rs.replid, fm.replid)
+	}
+}
+
+func TestReplicaAppliesCommandStream(t *testing.T) {
+	fm := startFakeMaster(t, NewRedisServer("127.0.0.1", 0, 16).rdbEncode(false))
+	replica := startTestServer(t)
+	r := replica.connect(t)
+	r.mustDo("OK", "SET", "local", "x")
+
+	// REPLICAOF 丢弃本地的数据，从主节点同步
+	host, port, _ := strings.Cut(fm.ln.Addr().String(), ":")
+	r.mustDo("OK", "REPLICAOF", host, port)
+	link := fm.accept()
+	link.readAck()
+	waitFor(t, "replica to come online", replica.masterLinkUp)
+	r.mustDo("(nil)", "GET", "local")
+
+	link.send("SELECT", "0")
+	link.send("SET", "k", "v")
+	link.send("SELECT", "2")
+	link.send("MULTI")
+	link.send("RPUSH", "list", "a", "b")
+	link.send("LPOP", "list")
+	link.send("EXEC")
+	// 偏移量随执行的命令流增加，与主节点发送的字节数相同
+	waitFor(t, "replica to apply the stream", func() bool {
+		replica.rs.replMu.Lock()
+		defer replica.rs.replMu.Unlock()
+		return replica.rs.masterReplOffset == link.sent
+	})
+	r.mustDo("v", "GET", "k")
+	r.mustDo("OK", "SELECT", "2")
+	r.mustDo("[b]", "LRANGE", "list", "0", "-1")
+
+	// REPLICAOF NO ONE 保留数据，断开与主节点的连接
+	r.mustDo("OK", "REPLICAOF", "NO", "ONE")
+	r.mustDo("2", "RPUSH", "list", "c")
+	link.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		if _, err := ParseRESP(link.reader); err != nil {
+			break
+		}
+	}
+	if role := infoValue(t, r.do("INFO", "replication").Str, "role"); role != "master" {
+		t.Fatalf("role:%s after REPLICAOF NO ONE", role)
+	}
+	r.mustDo("[replicaof ]", "CONFIG", "GET", "replicaof")
+}
+
+func TestReplicaResyncsAfterDisconnect(t *testing.T) {
+	fm := startFakeMaster(t, masterDataset())
+	replica := startTestServer(t, fm.replicaof())
+	link := fm.accept()
+	waitFor(t, "replica to come online", replica.masterLinkUp)
+	link.send("SET", "str", "changed")
+	r := replica.connect(t)
+	waitFor(t, "replica to apply the stream", func() bool { return replyString(r.do("GET", "str")) == "changed" })
+
+	// 连接断开后重新连接，再次全量同步
+	link.conn.Close()
+	waitFor(t, "replica to notice the disconnect", func() bool { return !replica.masterLinkUp() })
+	fm.accept()
+	waitFor(t, "replica to come online", replica.masterLinkUp)
+	r.mustDo("v", "GET", "str")
+}
+
+func TestReplicaofErrors(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(error) ERR Invalid master port", "REPLICAOF", "127.0.0.1", "x")
+	c.mustDo("(error) ERR wrong number of arguments for 'replicaof' command", "REPLICAOF", "127.0.0.1")
+	// 本来就是主节点时 NO ONE 什么都不做
+	c.mustDo("OK", "SLAVEOF", "NO", "ONE")
+}
+
+func TestMasterFullSync(t *testing.T) {
+	for _, diskless := range []string{"no", "yes"} {
+		t.Run("diskless="+diskless, func(t *testing.T) {
+			master := startTestServer(t, "repl-diskless-sync "+diskless, "repl-diskless-sync-delay 1")
+			c := master.connect(t)
+			c.mustDo("OK", "SET", "str", "v")
+			c.mustDo("3", "RPUSH", "list", "a", "b", "c")
+			c.mustDo("OK", "SELECT", "5")
+			c.mustDo("2", "SADD", "set", "x", "y")
+
+			// 两个副本同时连接，都从快照得到已有的数据
+			host, port, _ := strings.Cut(master.addr, ":")
+			replicaof := fmt.Sprintf("replicaof %s %s", host, port)
+			replicas := []*testServer{startTestServer(t, replicaof), startTestServer(t, replicaof)}
+			waitFor(t, "replicas to come online", func() bool {
+				return master.onlineReplicas() == 2 && replicas[0].masterLinkUp() && replicas[1].masterLinkUp()
+			})
+			for _, replica := range replicas {
+				r := replica.connect(t)
+				r.mustDo("v", "GET", "str")
+				r.mustDo("[a b c]", "LRANGE", "list", "0", "-1")
+				r.mustDo("OK", "SELECT", "5")
+				r.mustDo("2", "SCARD", "set")
+			}
+			if got := infoValue(t, c.do("INFO", "replication").Str, "connected_slaves"); got != "2" {
+				t.Fatalf("connected_slaves:%s", got)
+			}
+		})
+	}
+}
+
+func TestDisklessSyncWaitsForMaxReplicas(t *testing.T) {
+	master := startTestServer(t, "repl-diskless-sync yes", "repl-diskless-sync-delay 60", "repl-diskless-sync-max-replicas 1")
+	master.connect(t).mustDo("OK", "SET", "k", "v")
+	// 连接的副本数达到上限时不等 delay 结束就开始传输
+	replica := startReplica(t, master)
+	replica.connect(t).mustDo("v", "GET", "k")
+	if _, err := os.Stat(filepath.Join(master.dir, "dump.rdb")); err == nil {
+		t.Fatal("diskless sync wrote an RDB file on the master")
+	}
+}
+
+func TestMasterStreamsWrites(t *testing.T) {
+	master := startTestServer(t)
+	replica := startReplica(t, master)
+	r := replica.connect(t)
+
+	c := master.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("OK", "SELECT", "2")
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "RPUSH", "list", "a", "b")
+	c.mustDo("QUEUED", "LPOP", "list")
+	c.mustDo("[2 a]", "EXEC")
+	c.mustDo("OK", "SET", "last", "x")
+	r.mustDo("OK", "SELECT", "2")
+	waitFor(t, "replica to apply the stream", func() bool { return replyString(r.do("GET", "last")) == "x" })
+	r.mustDo("[b]", "LRANGE", "list", "0", "-1")
+	r.mustDo("OK", "SELECT", "0")
+	r.mustDo("v", "GET", "k")
+
+	// 副本提升为主节点后不再接收原主节点的写命令
+	r.mustDo("OK", "REPLICAOF", "NO", "ONE")
+	waitFor(t, "master to drop the replica", func() bool { return master.onlineReplicas() == 0 })
+	c.mustDo("OK", "SET", "after", "promotion")
+	r.mustDo("(nil)", "GET", "after")
+}
+
+func TestReplicaPartialResyncAfterReconnect(t *testing.T) {
+	master := startTestServer(t)
+	replica := startReplica(t, master, "replica-read-only no")
+	c, r := master.connect(t), replica.connect(t)
+	c.mustDo("OK", "SET", "k", "1")
+	waitFor(t, "replica to apply the stream", func() bool { return replyString(r.do("GET", "k")) == "1" })
+	// 全量同步会丢弃副本本地写入的键，部分同步保留它
+	r.mustDo("OK", "SET", "local", "x")
+
+	master.rs.replMu.Lock()
+	master.rs.replicationDisconnectReplicas()
+	master.rs.replMu.Unlock()
+	waitFor(t, "replica to be disconnected", func() bool { return master.onlineReplicas() == 0 })
+	c.mustDo("OK", "SET", "k", "2")
+
+	waitFor(t, "replica to reconnect", func() bool { return master.onlineReplicas() == 1 && replica.masterLinkUp() })
+	waitFor(t, "replica to catch up", func() bool { return replyString(r.do("GET", "k")) == "2" })
+	r.mustDo("x", "GET", "local")
+	info := c.do("INFO", "replication").Str
+	if infoValue(t, info, "repl_backlog_active") != "1" || infoValue(t, info, "master_repl_offset") == "0" {
+		t.Fatalf("INFO replication:\n%s", info)
+	}
+}
+
+func TestReplBacklogSizeConfig(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "CONFIG", "SET", "repl-backlog-size", "1mb")
+	c.mustDo("[repl-backlog-size 1048576]", "CONFIG", "GET", "repl-backlog-size")
+	// 小于最小值时使用最小值
+	c.mustDo("OK", "CONFIG", "SET", "repl-backlog-size", "1")
+	c.mustDo("[repl-backlog-size 16384]", "CONFIG", "GET", "repl-backlog-size")
+	if v := c.do("CONFIG", "SET", "repl-backlog-size", "x"); v.Type != RESP_ERROR {
+		t.Fatalf("invalid size accepted: %s", replyString(v))
+	}
+}
+
+func TestReplicaAnswersGetack(t *testing.T) {
+	fm := startFakeMaster(t, masterDataset())
+	replica := startTestServer(t, fm.replicaof())
+	link := fm.accept()
+	link.readAck()
+	waitFor(t, "replica to come online", replica.masterLinkUp)
+
+	link.send("SET", "k", "v")
+	before := link.sent
+	link.send("REPLCONF", "GETACK", "*")
+	// 每秒一次的 ACK 可能先到达，GETACK 的回复报告执行 GETACK 之前的偏移量
+	for off := link.readAck(); off != fmt.Sprint(before); off = link.readAck() {
+		if off != "0" {
+			t.Fatalf("replica acknowledged offset %s, want %d", off, before)
+		}
+	}
+}
+
+func TestMasterReceivesAcks(t *testing.T) {
+	master := startTestServer(t)
+	startReplica(t, master)
+	c := master.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	waitFor(t, "replica to acknowledge the write", func() bool {
+		master.rs.replMu.Lock()
+		defer master.rs.replMu.Unlock()
+		return master.rs.replicas[0].replAckOff == master.rs.masterReplOffset
+	})
+	if lag := infoValue(t, c.do("INFO", "replication").Str, "slave0"); !strings.Contains(lag, "lag=") {
+		t.Fatalf("slave0:%s", lag)
+	}
+}
+
+func TestReadOnlyReplica(t *testing.T) {
+	master := startTestServer(t)
+	replica := startReplica(t, master)
+	r := replica.connect(t)
+	r.mustDo("(error) READONLY You can't write against a read only replica.", "SET", "k", "v")
+	r.mustDo("(nil)", "GET", "k")
+
+	// 含有写命令的事务在排队时被拒绝
+	r.mustDo("OK", "MULTI")
+	r.mustDo("(error) READONLY You can't write against a read only replica.", "RPUSH", "list", "a")
+	r.mustDo("(error) EXECABORT Transaction discarded because of previous errors.", "EXEC")
+	if got := replyString(r.do("EVAL", "return redis.call('SET', KEYS[1], 'v')", "1", "k")); !strings.Contains(got, "READONLY") {
+		t.Fatalf("script write on a replica returned %s", got)
+	}
+
+	// 主节点传来的写命令照常执行
+	c := master.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("1", "WAIT", "1", "0")
+	r.mustDo("v", "GET", "k")
+
+	r.mustDo("[replica-read-only yes]", "CONFIG", "GET", "replica-read-only")
+	r.mustDo("OK", "CONFIG", "SET", "slave-read-only", "no")
+	r.mustDo("OK", "SET", "local", "x")
+	c.mustDo("(nil)", "GET", "local")
+}
+
+func TestChainedReplication(t *testing.T) {
+	master := startTestServer(t)
+	c := master.connect(t)
+	c.mustDo("OK", "SELECT", "3")
+	c.mustDo("OK", "SET", "k", "v")
+	r1 := startReplica(t, master)
+	r2 := startReplica(t, r1)
+
+	c.mustDo("OK", "SET", "k2", "v2")
+	c2 := r2.connect(t)
+	c2.mustDo("OK", "SELECT", "3")
+	waitFor(t, "write to reach the sub-replica", func() bool { return replyString(c2.do("GET", "k2")) == "v2" })
+	c2.mustDo("v", "GET", "k")
+
+	// 命令流已经选择了 3 号数据库，之后的命令不带 SELECT；下级副本从快照记录的 repl-stream-db 开始执行
+	host, port, _ := strings.Cut(r1.addr, ":")
+	r3 := startTestServer(t, fmt.Sprintf("replicaof %s %s", host, port))
+	waitFor(t, "second sub-replica to come online", func() bool { return r1.onlineReplicas() == 2 && r3.masterLinkUp() })
+	c.mustDo("OK", "SET", "k3", "v3")
+	c3 := r3.connect(t)
+	c3.mustDo("OK", "SELECT", "3")
+	waitFor(t, "write to reach the second sub-replica", func() bool { return replyString(c3.do("GET", "k3")) == "v3" })
+	c3.mustDo("OK", "SELECT", "0")
+	c3.mustDo("0", "DBSIZE")
+
+	// 复制 ID 和偏移量与主节点相同
+	info := func(ts *testServer, field string) string {
+		return infoValue(t, ts.connect(t).do("INFO", "replication").Str, field)
+	}
+	if info(r2, "master_replid") != info(master, "master_replid") {
+		t.Fatal("sub-replica has a different replication ID")
+	}
+	waitFor(t, "offsets to converge", func() bool { return info(r3, "master_repl_offset") == info(master, "master_repl_offset") })
+}
+
+func TestRdbReplicationAuxFields(t *testing.T) {
+	want := rdbSaveInfo{streamDB: 7, replid: strings.Repeat("c", 40), offset: 1234}
+	e := NewRedisServer("127.0.0.1", 0, 16).rdbEncodeHeader(false, &want)
+	e.buf = append(e.buf, RDB_OPCODE_EOF)
+	data := binary.LittleEndian.AppendUint64(e.buf, crc64Jones(0, e.buf))
+
+	got := rdbSaveInfo{streamDB: -1}
+	if _, err := NewRedisServer("127.0.0.1", 0, 16).rdbLoad(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("loaded %+v, want %+v", got, want)
+	}
+}
+
+func TestReplicaReportsLinkDown(t *testing.T) {
+	fm := startFakeMaster(t, masterDataset())
+	replica := startTestServer(t, fm.replicaof())
+	link := fm.accept()
+	waitFor(t, "replica to come online", replica.masterLinkUp)
+	fm.ln.Close()
+	link.conn.Close()
+	waitFor(t, "replica to notice the disconnect", func() bool { return !replica.masterLinkUp() })
+
+	info := replica.connect(t).do("INFO", "replication").Str
+	if infoValue(t, info, "master_link_status") != "down" || infoValue(t, info, "master_link_down_since_seconds") == "-1" {
+		t.Fatalf("INFO replication:\n%s", info)
+	}
+}
+
+func TestReplicaReportsAofFsyncedOffset(t *testing.T) {
+	for _, policy := range []string{"always", "everysec", "no"} {
+		t.Run(policy, func(t *testing.T) {
+			master := startTestServer(t)
+			startReplica(t, master, "appendonly yes", "appendfsync "+policy)
+			c := master.connect(t)
+			for i := 0; i < 10; i++ {
+				c.mustDo("OK", "SET", "k", fmt.Sprint(i))
+			}
+			waitFor(t, "replica to report FACK", func() bool {
+				_, fack, offset := master.replicaOffsets()
+				return fack == offset
+			})
+		})
+	}
+}
+
+func TestReplicaWithoutAofDoesNotReportFack(t *testing.T) {
+	master := startTestServer(t)
+	startReplica(t, master)
+	c := master.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("1", "WAIT", "1", "0")
+	if ack, fack, _ := master.replicaOffsets(); ack == 0 || fack != 0 {
+		t.Fatalf("replica reported ACK %d FACK %d", ack, fack)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package goredis
 
 import (
 	"bufio"
@@ -16,6 +16,17 @@ const (
 	RESP_INTEGER       = ':'
 	RESP_BULK_STRING   = '$'
 	RESP_ARRAY         = '*'
+
+	// RESP3 新增的类型，只用于回复；对 RESP2 客户端按数组发送
+	RESP_MAP  = '%'
+	RESP_PUSH = '>'
+	RESP_NULL = '_'
+)
+
+// 客户端可以通过 HELLO 协商的协议版本
+const (
+	RESP2 = 2
+	RESP3 = 3
 )
 
 // RESPValue 表示一个 RESP 值
@@ -34,6 +45,51 @@ func NewRESPValue(respType byte) *RESPValue {
 	}
 }
 
+// NewSimpleStringValue 创建简单字符串值
+func NewSimpleStringValue(str string) *RESPValue {
+	return &RESPValue{Type: RESP_SIMPLE_STRING, Str: str}
+}
+
+// NewErrorValue 创建错误值
+func NewErrorValue(msg string) *RESPValue {
+	return &RESPValue{Type: RESP_ERROR, Str: msg}
+}
+
+// NewIntegerValue 创建整数值
+func NewIntegerValue(num int64) *RESPValue {
+	return &RESPValue{Type: RESP_INTEGER, Num: num}
+}
+
+// NewBulkStringValue 创建批量字符串值
+func NewBulkStringValue(str string) *RESPValue {
+	return &RESPValue{Type: RESP_BULK_STRING, Str: str}
+}
+
+// NewNullBulkStringValue 创建 null 批量字符串
+func NewNullBulkStringValue() *RESPValue {
+	return &RESPValue{Type: RESP_BULK_STRING, IsNull: true}
+}
+
+// NewArrayValue 创建数组值
+func NewArrayValue(elems []*RESPValue) *RESPValue {
+	return &RESPValue{Type: RESP_ARRAY, Array: elems}
+}
+
+// NewNullArrayValue 创建 null 数组
+func NewNullArrayValue() *RESPValue {
+	return &RESPValue{Type: RESP_ARRAY, IsNull: true}
+}
+
+// NewMapValue 创建映射值，elems 中键和值交替排列
+func NewMapValue(elems []*RESPValue) *RESPValue {
+	return &RESPValue{Type: RESP_MAP, Array: elems}
+}
+
+// NewPushValue 创建推送值，用于发布订阅等服务器主动发送的消息
+func NewPushValue(elems []*RESPValue) *RESPValue {
+	return &RESPValue{Type: RESP_PUSH, Array: elems}
+}
+
 // ParseRESP 从 reader 解析 RESP 数据
 func ParseRESP(reader *bufio.Reader) (*RESPValue, error) {
 	line, err := reader.ReadString('\n')
@@ -120,9 +176,28 @@ func ParseRESP(reader *bufio.Reader) (*RESPValue, error) {
 	}
 }
 
-// SerializeRESP 将 RESP 值序列化为字节数组
+// SerializeRESP 将 RESP 值按 RESP2 序列化为字节数组
 func (v *RESPValue) SerializeRESP() []byte {
+	return v.SerializeRESPProto(RESP2)
+}
+
+// SerializeRESPProto 按指定的协议版本序列化 RESP 值
+//
+// RESP3 下 null 统一编码为 _，映射和推送使用各自的类型前缀；
+// RESP2 下映射和推送都编码为数组，映射的键和值交替排列。
+func (v *RESPValue) SerializeRESPProto(proto int) []byte {
 	var buf bytes.Buffer
+	v.serialize(&buf, proto)
+	return buf.Bytes()
+}
+
+// serialize 把 RESP 值写入 buf
+func (v *RESPValue) serialize(buf *bytes.Buffer, proto int) {
+	if v.IsNull && proto == RESP3 {
+		buf.WriteByte(RESP_NULL)
+		buf.WriteString("\r\n")
+		return
+	}
 
 	switch v.Type {
 	case RESP_SIMPLE_STRING:
@@ -151,16 +226,27 @@ func (v *RESPValue) SerializeRESP() []byte {
 			buf.WriteString("\r\n")
 		}
 
-	case RESP_ARRAY:
-		buf.WriteByte(RESP_ARRAY)
-		buf.WriteString(strconv.Itoa(len(v.Array)))
+	case RESP_ARRAY, RESP_MAP, RESP_PUSH:
+		length := len(v.Array)
+		switch {
+		case proto == RESP2:
+			buf.WriteByte(RESP_ARRAY)
+		case v.Type == RESP_MAP:
+			buf.WriteByte(RESP_MAP)
+			length /= 2
+		default:
+			buf.WriteByte(v.Type)
+		}
+		if v.IsNull {
+			buf.WriteString("-1\r\n")
+			break
+		}
+		buf.WriteString(strconv.Itoa(length))
 		buf.WriteString("\r\n")
 		for _, elem := range v.Array {
-			buf.Write(elem.SerializeRESP())
+			elem.serialize(buf, proto)
 		}
 	}
-
-	return buf.Bytes()
 }
 
 // ToString 将 RESP 值转换为字符串（用于调试）
@@ -177,7 +263,7 @@ func (v *RESPValue) ToString() string {
 			return "BulkString: null"
 		}
 		return fmt.Sprintf("BulkString: %s", v.Str)
-	case RESP_ARRAY:
+	case RESP_ARRAY, RESP_MAP, RESP_PUSH:
 		if v.IsNull {
 			return "Array: null"
 		}
@@ -185,7 +271,8 @@ func (v *RESPValue) ToString() string {
 		for i, elem := range v.Array {
 			parts[i] = elem.ToString()
 		}
-		return fmt.Sprintf("Array[%d]: [%s]", len(v.Array), strings.Join(parts, ", "))
+		kind := map[byte]string{RESP_ARRAY: "Array", RESP_MAP: "Map", RESP_PUSH: "Push"}[v.Type]
+		return fmt.Sprintf("%s[%d]: [%s]", kind, len(v.Array), strings.Join(parts, ", "))
 	default:
 		return "Unknown"
 	}
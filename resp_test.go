@@ -0,0 +1,83 @@
+package goredis
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestSerializeRESPProto(t *testing.T) {
+	m := NewMapValue([]*RESPValue{NewBulkStringValue("k"), NewIntegerValue(1)})
+	push := NewPushValue([]*RESPValue{NewBulkStringValue("message"), NewNullBulkStringValue()})
+	for _, tt := range []struct {
+		v      *RESPValue
+		proto  int
+		expect string
+	}{
+		{m, RESP2, "*2\r\n$1\r\nk\r\n:1\r\n"},
+		{m, RESP3, "%1\r\n$1\r\nk\r\n:1\r\n"},
+		{push, RESP2, "*2\r\n$7\r\nmessage\r\n$-1\r\n"},
+		{push, RESP3, ">2\r\n$7\r\nmessage\r\n_\r\n"},
+		{NewNullArrayValue(), RESP2, "*-1\r\n"},
+		{NewNullArrayValue(), RESP3, "_\r\n"},
+	} {
+		if got := string(tt.v.SerializeRESPProto(tt.proto)); got != tt.expect {
+			t.Errorf("%s as RESP%d: got %q, want %q", tt.v.ToString(), tt.proto, got, tt.expect)
+		}
+	}
+}
+
+// expectRaw 读取与 want 等长的原始回复并逐字节比较，用于检查 RESP3 编码
+func (tc *testClient) expectRaw(want string) {
+	tc.t.Helper()
+	buf := make([]byte, len(want))
+	if _, err := io.ReadFull(tc.reader, buf); err != nil {
+		tc.t.Fatalf("reading reply: %v", err)
+	}
+	if string(buf) != want {
+		tc.t.Fatalf("got %q, want %q", buf, want)
+	}
+}
+
+func TestHello(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(error) NOPROTO unsupported protocol version", "HELLO", "4")
+	c.mustDo("(error) ERR Protocol version is not an integer or out of range", "HELLO", "x")
+	c.mustDo("(error) WRONGPASS invalid username-password pair or user is disabled.",
+		"HELLO", "3", "AUTH", "alice", "secret")
+	// 出错的 HELLO 不切换协议，RESP2 下映射按名称、值交替排列
+	hello := c.do("HELLO", "2", "AUTH", "default", "any", "SETNAME", "conn1")
+	id := hello.Array[7].Num
+	want := fmt.Sprintf("[server redis version 0.1.0 proto 2 id %d mode standalone role master modules []]", id)
+	if got := replyString(hello); got != want {
+		t.Fatalf("HELLO 2: got %s, want %s", got, want)
+	}
+
+	c.send("HELLO", "3")
+	c.expectRaw(fmt.Sprintf("%%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$5\r\n0.1.0\r\n"+
+		"$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:%d\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n"+
+		"$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n", id))
+	c.send("GET", "missing")
+	c.expectRaw("_\r\n")
+}
+
+func TestResp3PubSubPush(t *testing.T) {
+	ts := startTestServer(t)
+	sub, pub := ts.connect(t), ts.connect(t)
+	sub.send("HELLO", "3")
+	// 连接 ID 取决于连接建立的顺序，只跳过 HELLO 的回复，它以空的 modules 数组结尾
+	for line := ""; line != "*0\r\n"; {
+		var err error
+		if line, err = sub.reader.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub.send("SUBSCRIBE", "ch")
+	sub.expectRaw(">3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n")
+	// RESP3 客户端订阅后仍然可以执行普通命令
+	sub.send("SET", "k", "v")
+	sub.expectRaw("+OK\r\n")
+	pub.mustDo("1", "PUBLISH", "ch", "hi")
+	sub.expectRaw(">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n")
+}
@@ -0,0 +1,66 @@
+package goredis
+
+import (
+	"strconv"
+	"strings"
+)
+
+// scanOptions 表示 SCAN 系列命令的公共参数
+type scanOptions struct {
+	cursor   uint64
+	pattern  string
+	count    int
+	typeName string // 仅 SCAN 支持，为空表示不过滤
+}
+
+// parseScanArgs 解析 cursor [MATCH pattern] [COUNT count] 参数，allowType 为 true 时还接受 [TYPE type]
+func parseScanArgs(args []string, allowType bool) (*scanOptions, *RESPValue) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return nil, NewErrorValue("ERR invalid cursor")
+	}
+
+	opts := &scanOptions{cursor: cursor, count: 10}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, NewErrorValue("ERR syntax error")
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			opts.pattern = args[i+1]
+		case "COUNT":
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return nil, NewErrorValue("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, NewErrorValue("ERR syntax error")
+			}
+			opts.count = count
+		case "TYPE":
+			if !allowType {
+				return nil, NewErrorValue("ERR syntax error")
+			}
+			opts.typeName = strings.ToLower(args[i+1])
+			if !validTypeName(opts.typeName) {
+				return nil, NewErrorValue("ERR unknown type name '" + args[i+1] + "'")
+			}
+		default:
+			return nil, NewErrorValue("ERR syntax error")
+		}
+	}
+	return opts, nil
+}
+
+// matches 判断元素是否满足 MATCH 条件
+func (opts *scanOptions) matches(str string) bool {
+	return opts.pattern == "" || stringMatch(opts.pattern, str, false)
+}
+
+// scanReply 构造 SCAN 系列命令的响应：[next-cursor, [elements...]]
+func scanReply(cursor uint64, elems []*RESPValue) *RESPValue {
+	return NewArrayValue([]*RESPValue{
+		NewBulkStringValue(strconv.FormatUint(cursor, 10)),
+		NewArrayValue(elems),
+	})
+}
@@ -0,0 +1,188 @@
+package goredis
+
+import (
+	"maps"
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// scanAll 用 cmd 反复迭代直到游标回到 0，返回排序后的全部元素；
+// prefix 是游标之前的参数（如 SSCAN 的键名），extra 是游标之后的参数
+func (tc *testClient) scanAll(cmd string, prefix []string, extra ...string) []string {
+	tc.t.Helper()
+	var result []string
+	cursor := "0"
+	for {
+		args := append(append(append([]string{cmd}, prefix...), cursor), extra...)
+		v := tc.do(args...)
+		if v.Type != RESP_ARRAY || len(v.Array) != 2 {
+			tc.t.Fatalf("%v: unexpected reply %s", args, replyString(v))
+		}
+		for _, e := range v.Array[1].Array {
+			result = append(result, e.Str)
+		}
+		cursor = v.Array[0].Str
+		if cursor == "0" {
+			break
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+func TestSScan(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[0 []]", "SSCAN", "missing", "0")
+
+	var members []string
+	for i := 0; i < 50; i++ {
+		members = append(members, string(rune('a'+i%26))+string(rune('a'+i/26)))
+	}
+	c.mustDo("50", append([]string{"SADD", "s"}, members...)...)
+	slices.Sort(members)
+	if got := c.scanAll("SSCAN", []string{"s"}, "COUNT", "7"); !slices.Equal(got, members) {
+		t.Fatalf("SSCAN: got %v, want %v", got, members)
+	}
+	if got := c.scanAll("SSCAN", []string{"s"}, "MATCH", "a*"); !slices.Equal(got, []string{"aa", "ab"}) {
+		t.Fatalf("SSCAN MATCH a*: got %v", got)
+	}
+
+	c.mustDo("(error) ERR invalid cursor", "SSCAN", "s", "x")
+	c.mustDo("(error) ERR syntax error", "SSCAN", "s", "0", "COUNT", "0")
+	c.mustDo("(error) ERR syntax error", "SSCAN", "s", "0", "MATCH")
+}
+
+func TestSScanWithConcurrentRemovals(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	for i := 0; i < 100; i++ {
+		c.mustDo("1", "SADD", "s", "m"+string(rune('0'+i/10))+string(rune('0'+i%10)))
+	}
+
+	// 遍历期间删除一半元素，一直存在的元素仍然都要被返回
+	seen := make(map[string]bool)
+	cursor := "0"
+	for round := 0; ; round++ {
+		v := c.do("SSCAN", "s", cursor, "COUNT", "5")
+		for _, e := range v.Array[1].Array {
+			seen[e.Str] = true
+		}
+		if round < 10 {
+			for i := round * 5; i < round*5+5; i++ {
+				c.do("SREM", "s", "m"+string(rune('0'+i/10))+string(rune('0'+i%10)))
+			}
+		}
+		cursor = v.Array[0].Str
+		if cursor == "0" {
+			break
+		}
+	}
+	for i := 50; i < 100; i++ {
+		if m := "m" + string(rune('0'+i/10)) + string(rune('0'+i%10)); !seen[m] {
+			t.Fatalf("member %s was not returned", m)
+		}
+	}
+}
+
+func TestZScan(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[0 []]", "ZSCAN", "missing", "0")
+	want := make(map[string]string)
+	for i := 0; i < 40; i++ {
+		member := "m" + strconv.Itoa(i)
+		want[member] = strconv.Itoa(i * 2)
+		c.mustDo("1", "ZADD", "z", want[member], member)
+	}
+
+	// 回复中成员与分数成对出现
+	got := make(map[string]string)
+	cursor := "0"
+	for {
+		v := c.do("ZSCAN", "z", cursor, "COUNT", "3")
+		for i := 0; i+1 < len(v.Array[1].Array); i += 2 {
+			got[v.Array[1].Array[i].Str] = v.Array[1].Array[i+1].Str
+		}
+		if cursor = v.Array[0].Str; cursor == "0" {
+			break
+		}
+	}
+	if !maps.Equal(got, want) {
+		t.Fatalf("ZSCAN: got %v, want %v", got, want)
+	}
+	if got := c.scanAll("ZSCAN", []string{"z"}, "MATCH", "m1?"); len(got) != 20 {
+		t.Fatalf("ZSCAN MATCH m1?: got %v", got)
+	}
+}
+
+func TestScan(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[0 []]", "SCAN", "0")
+	var strs []string
+	for i := 0; i < 30; i++ {
+		key := "str" + strconv.Itoa(i)
+		strs = append(strs, key)
+		c.mustDo("OK", "SET", key, "v")
+	}
+	c.mustDo("1", "RPUSH", "list", "a")
+	c.mustDo("1", "SADD", "set", "a")
+	slices.Sort(strs)
+
+	if got := c.scanAll("SCAN", nil, "COUNT", "4"); len(got) != 32 {
+		t.Fatalf("SCAN returned %d keys, want 32", len(got))
+	}
+	if got := c.scanAll("SCAN", nil, "TYPE", "string"); !slices.Equal(got, strs) {
+		t.Fatalf("SCAN TYPE string: got %v", got)
+	}
+	if got := c.scanAll("SCAN", nil, "MATCH", "*i*", "TYPE", "LIST"); !slices.Equal(got, []string{"list"}) {
+		t.Fatalf("SCAN MATCH *i* TYPE list: got %v", got)
+	}
+	c.mustDo("(error) ERR unknown type name 'foo'", "SCAN", "0", "TYPE", "foo")
+	c.mustDo("(error) ERR syntax error", "SSCAN", "set", "0", "TYPE", "string")
+}
+
+func TestKeyspaceScanGuarantee(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 100; round++ {
+		ks := newKeyspace()
+		for i := 0; i < 200; i++ {
+			ks.Set("k"+strconv.Itoa(i), &RedisObject{})
+		}
+
+		// 扫描期间随机增删键，整个扫描期间一直存在的键必须至少返回一次
+		stable := make(map[string]bool)
+		for i := 0; i < 200; i++ {
+			stable["k"+strconv.Itoa(i)] = true
+		}
+		seen := make(map[string]bool)
+		cursor := uint64(0)
+		for {
+			var entries []keyspaceEntry
+			cursor, entries = ks.Scan(cursor, 1+r.Intn(10))
+			for _, e := range entries {
+				seen[e.key] = true
+			}
+			if cursor == 0 {
+				break
+			}
+			for j := 0; j < 3; j++ {
+				key := "k" + strconv.Itoa(r.Intn(300))
+				if r.Intn(2) == 0 {
+					ks.Delete(key)
+					delete(stable, key)
+				} else if ks.Get(key) == nil {
+					ks.Set(key, &RedisObject{})
+				}
+			}
+		}
+		for key := range stable {
+			if !seen[key] {
+				t.Fatalf("round %d: key %s was present during the whole scan but not returned", round, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,554 @@
+package goredis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// luaScript 是缓存的脚本：源码以及编译后的函数原型
+type luaScript struct {
+	body  string
+	proto *lua.FunctionProto
+}
+
+// scriptRun 是一次正在执行的脚本或函数调用
+//
+// 脚本超时后 SCRIPT KILL 在其他连接的 goroutine 中通过 exclusiveCall 访问它。
+type scriptRun struct {
+	function bool               // FCALL 调用的函数，由 FUNCTION KILL 而不是 SCRIPT KILL 终止
+	cancel   context.CancelFunc // 终止脚本，解释器在执行下一条指令时报错
+	killed   atomic.Bool        // 被 SCRIPT KILL 或 FUNCTION KILL 终止
+	wrote    atomic.Bool        // 已经执行过写命令，不能再终止
+}
+
+// busyError 返回脚本超时期间拒绝其他命令的错误
+func (run *scriptRun) busyError() *RESPValue {
+	if run.function {
+		return NewErrorValue("BUSY Redis is busy running a script. You can only call FUNCTION KILL or SHUTDOWN NOSAVE.")
+	}
+	return NewErrorValue("BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.")
+}
+
+// allowedWhileBusy 判断命令能否在脚本超时期间执行：SCRIPT KILL、FUNCTION KILL 和 SHUTDOWN NOSAVE
+func allowedWhileBusy(cmd *redisCommand, command *RESPValue) bool {
+	args := command.Array[1:]
+	switch cmd.name {
+	case "script", "function":
+		return len(args) == 1 && strings.EqualFold(args[0].Str, "KILL")
+	case "shutdown":
+		for _, arg := range args {
+			if strings.EqualFold(arg.Str, "NOSAVE") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scriptKill 处理 SCRIPT KILL 和 FUNCTION KILL，终止超时的脚本或函数
+//
+// 脚本超时期间这个命令不取命令锁直接执行；脚本没有超时时它与其他命令一样等待脚本结束，
+// 此时没有正在执行的脚本。
+func (rs *RedisServer) scriptKill(function bool) *RESPValue {
+	var run *scriptRun
+	if ec := rs.exclusiveCall.Load(); ec != nil {
+		run = ec.script.Load()
+	}
+	if run == nil || run.function != function {
+		return NewErrorValue("NOTBUSY No scripts in execution right now.")
+	}
+	if run.wrote.Load() {
+		return NewErrorValue("UNKILLABLE Sorry the script already executed write commands against the dataset. You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.")
+	}
+	run.killed.Store(true)
+	run.cancel()
+	return NewSimpleStringValue("OK")
+}
+
+// luaScriptChunkName 是脚本在错误信息中的名称，与 Redis 相同
+const luaScriptChunkName = "user_script"
+
+// luaProtectGlobals 禁止脚本创建全局变量或访问不存在的全局变量，避免脚本之间互相影响
+const luaProtectGlobals = `
+setmetatable(_G, {
+	__index = function(t, name)
+		error("Script attempted to access nonexistent global variable '" .. tostring(name) .. "'", 3)
+	end,
+	__newindex = function(t, name, value)
+		error("Script attempted to create global variable '" .. tostring(name) .. "'", 3)
+	end,
+})
+`
+
+// scriptingInit 创建执行 EVAL 脚本的 Lua 解释器并清空脚本缓存
+//
+// 所有脚本共用同一个解释器。EVAL 在独占命令锁的情况下执行（见 call），
+// 同一时刻只有一个脚本在运行，因此解释器不需要额外的锁。
+func (rs *RedisServer) scriptingInit() {
+	rs.lua = rs.newLuaState()
+	rs.luaScripts = make(map[string]*luaScript)
+}
+
+// newLuaState 创建打开了基础库并注册了 redis 库的 Lua 解释器，全局变量受保护
+func (rs *RedisServer) newLuaState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// 脚本不能访问文件系统
+	L.SetGlobal("dofile", lua.LNil)
+	L.SetGlobal("loadfile", lua.LNil)
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"call":         func(L *lua.LState) int { return rs.luaRedisCall(L, true) },
+		"pcall":        func(L *lua.LState) int { return rs.luaRedisCall(L, false) },
+		"status_reply": luaStatusReply,
+		"error_reply":  luaErrorReply,
+		"sha1hex":      luaSha1Hex,
+		"log":          luaLog,
+	})
+	for level, name := range []string{"LOG_DEBUG", "LOG_VERBOSE", "LOG_NOTICE", "LOG_WARNING"} {
+		redis.RawSetString(name, lua.LNumber(level))
+	}
+	L.SetGlobal("redis", redis)
+
+	if err := L.DoString(luaProtectGlobals); err != nil {
+		panic(err)
+	}
+	return L
+}
+
+// newScriptClient 创建执行脚本中命令的伪客户端，它没有连接，命令的回复直接交给脚本
+func newScriptClient(rs *RedisServer) *client {
+	return &client{
+		server:              rs,
+		db:                  rs.databases[0],
+		resp:                RESP2,
+		denyBlocking:        true,
+		pubsubChannels:      make(map[string]struct{}),
+		pubsubPatterns:      make(map[string]struct{}),
+		pubsubShardChannels: make(map[string]struct{}),
+	}
+}
+
+// sha1hex 返回字符串 SHA1 摘要的小写十六进制表示
+func sha1hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// luaCreateScript 编译脚本并加入缓存，返回脚本的 SHA1；脚本已缓存时直接返回
+func (rs *RedisServer) luaCreateScript(body string) (string, *RESPValue) {
+	sha := sha1hex(body)
+	if _, ok := rs.luaScripts[sha]; ok {
+		return sha, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(body), luaScriptChunkName)
+	if err != nil {
+		return "", NewErrorValue("ERR Error compiling script (new function): " + luaErrorLine(err.Error()))
+	}
+	proto, err := lua.Compile(chunk, luaScriptChunkName)
+	if err != nil {
+		return "", NewErrorValue("ERR Error compiling script (new function): " + luaErrorLine(err.Error()))
+	}
+	rs.luaScripts[sha] = &luaScript{body: body, proto: proto}
+	return sha, nil
+}
+
+// luaErrorMessage 返回脚本出错时的错误信息，不包括调用栈；redis.call 抛出的错误表取其 err 字段
+func luaErrorMessage(err error) string {
+	apiErr, ok := err.(*lua.ApiError)
+	if !ok {
+		return err.Error()
+	}
+	if tbl, ok := apiErr.Object.(*lua.LTable); ok {
+		if e, ok := tbl.RawGetString("err").(lua.LString); ok {
+			return string(e)
+		}
+	}
+	return apiErr.Object.String()
+}
+
+// luaErrorLine 去掉 Lua 错误信息中的换行，RESP 错误只能有一行
+func luaErrorLine(msg string) string {
+	return strings.Join(strings.Fields(msg), " ")
+}
+
+// handleEval 处理 EVAL script numkeys [key ...] [arg ...] 命令
+func (rs *RedisServer) handleEval(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	sha, errResp := rs.luaCreateScript(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	return rs.evalGeneric(c, sha, args[1:])
+}
+
+// handleEvalSha 处理 EVALSHA sha1 numkeys [key ...] [arg ...] 命令，执行缓存中的脚本
+func (rs *RedisServer) handleEvalSha(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	sha := strings.ToLower(args[0])
+	if _, ok := rs.luaScripts[sha]; !ok {
+		return NewErrorValue("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return rs.evalGeneric(c, sha, args[1:])
+}
+
+// handleScript 处理 SCRIPT LOAD/EXISTS/KILL/FLUSH 命令，管理按 SHA1 缓存的脚本
+func (rs *RedisServer) handleScript(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "LOAD":
+		if len(args) != 2 {
+			return wrongArgsError("script|load")
+		}
+		sha, errResp := rs.luaCreateScript(args[1])
+		if errResp != nil {
+			return errResp
+		}
+		return NewBulkStringValue(sha)
+	case "EXISTS":
+		if len(args) < 2 {
+			return wrongArgsError("script|exists")
+		}
+		elems := make([]*RESPValue, 0, len(args)-1)
+		for _, sha := range args[1:] {
+			if _, ok := rs.luaScripts[strings.ToLower(sha)]; ok {
+				elems = append(elems, NewIntegerValue(1))
+			} else {
+				elems = append(elems, NewIntegerValue(0))
+			}
+		}
+		return NewArrayValue(elems)
+	case "KILL":
+		if len(args) != 1 {
+			return wrongArgsError("script|kill")
+		}
+		return rs.scriptKill(false)
+	case "FLUSH":
+		if len(args) > 2 {
+			return wrongArgsError("script|flush")
+		}
+		if len(args) == 2 && !strings.EqualFold(args[1], "SYNC") && !strings.EqualFold(args[1], "ASYNC") {
+			return NewErrorValue("ERR SCRIPT FLUSH only support SYNC|ASYNC option")
+		}
+		rs.scriptingReset()
+		return NewSimpleStringValue("OK")
+	default:
+		return NewErrorValue("ERR unknown subcommand '" + args[0] + "'. Try SCRIPT HELP.")
+	}
+}
+
+// scriptingReset 清空脚本缓存并重建解释器，脚本对 Lua 环境的修改一并丢弃
+func (rs *RedisServer) scriptingReset() {
+	rs.lua.Close()
+	rs.scriptingInit()
+}
+
+// evalGeneric 以 numkeys [key ...] [arg ...] 设置 KEYS 和 ARGV 并执行缓存中的脚本
+func (rs *RedisServer) evalGeneric(c *client, sha string, args []string) *RESPValue {
+	keys, argv, errResp := splitNumKeys(args)
+	if errResp != nil {
+		return errResp
+	}
+	L := rs.lua
+	L.G.Global.RawSetString("KEYS", luaStringArray(L, keys))
+	L.G.Global.RawSetString("ARGV", luaStringArray(L, argv))
+	return rs.luaCall(c, L, L.NewFunctionFromProto(rs.luaScripts[sha].proto), nil, "f_"+sha, false)
+}
+
+// splitNumKeys 按 numkeys [key ...] [arg ...] 把参数分为键名和其余参数
+func splitNumKeys(args []string) ([]string, []string, *RESPValue) {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, nil, NewErrorValue("ERR value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return nil, nil, NewErrorValue("ERR Number of keys can't be negative")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, NewErrorValue("ERR Number of keys can't be greater than number of args")
+	}
+	return args[1 : 1+numKeys], args[1+numKeys:], nil
+}
+
+// luaCall 调用脚本或函数并把返回值转换为回复，name 用于错误信息
+//
+// 脚本中的命令由伪客户端执行，使用调用者当前的数据库；脚本中的 SELECT 不影响调用者。
+// readOnly 为 true 时脚本中不能执行写命令。执行超过 lua-time-limit 后脚本被标记为超时，
+// 其他连接的命令以 BUSY 拒绝，直到脚本结束或被终止。
+func (rs *RedisServer) luaCall(c *client, L *lua.LState, fn *lua.LFunction, args []lua.LValue, name string, readOnly bool) *RESPValue {
+	rs.luaClient.db = c.db
+	rs.luaReadOnly = readOnly
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	run := &scriptRun{function: L == rs.functionsLua, cancel: cancel}
+	rs.luaRun = run
+	ec := rs.exclusiveCall.Load()
+	ec.script.Store(run)
+	if rs.luaTimeLimit > 0 {
+		limit := rs.luaTimeLimit
+		timer := time.AfterFunc(time.Duration(limit)*time.Millisecond, func() {
+			log.Printf("Slow script detected: still in execution after %d milliseconds. You can try killing the script using the SCRIPT KILL command.", limit)
+			ec.setBusy()
+		})
+		defer timer.Stop()
+	}
+	defer func() {
+		ec.script.Store(nil)
+		rs.luaRun = nil
+	}()
+
+	L.SetContext(ctx)
+	L.Push(fn)
+	for _, arg := range args {
+		L.Push(arg)
+	}
+	err := L.PCall(len(args), 1, nil)
+	L.RemoveContext()
+	if err != nil {
+		if run.killed.Load() {
+			if run.function {
+				return NewErrorValue("ERR Script killed by user with FUNCTION KILL...")
+			}
+			return NewErrorValue("ERR Script killed by user with SCRIPT KILL...")
+		}
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			if tbl, ok := apiErr.Object.(*lua.LTable); ok {
+				// redis.call 抛出的命令错误，原样作为回复
+				if e, ok := tbl.RawGetString("err").(lua.LString); ok {
+					return NewErrorValue(string(e))
+				}
+			}
+		}
+		return NewErrorValue("ERR Error running script (call to " + name + "): " + luaErrorLine(luaErrorMessage(err)))
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	return luaToResp(ret)
+}
+
+// luaStringArray 把字符串切片转换为 Lua 数组
+func luaStringArray(L *lua.LState, strs []string) *lua.LTable {
+	tbl := L.CreateTable(len(strs), 0)
+	for _, s := range strs {
+		tbl.Append(lua.LString(s))
+	}
+	return tbl
+}
+
+// luaRedisCall 实现 redis.call 和 redis.pcall
+//
+// 命令出错时 redis.call 抛出 {err = 错误信息} 表，脚本没有捕获时整个脚本以该错误结束；
+// redis.pcall 则把这个表作为返回值交给脚本处理。
+func (rs *RedisServer) luaRedisCall(L *lua.LState, raise bool) int {
+	reply := rs.luaExecCommand(L)
+	if reply.Type == RESP_ERROR && raise {
+		tbl := L.NewTable()
+		tbl.RawSetString("err", lua.LString(reply.Str))
+		L.Error(tbl, 1)
+		return 0
+	}
+	L.Push(respToLua(L, reply))
+	return 1
+}
+
+// luaExecCommand 以 Lua 栈上的参数构造命令并用伪客户端执行
+func (rs *RedisServer) luaExecCommand(L *lua.LState) *RESPValue {
+	if rs.functionsLoading != nil {
+		return NewErrorValue("ERR redis.call can only be called inside a script invocation")
+	}
+	argc := L.GetTop()
+	if argc == 0 {
+		return NewErrorValue("ERR Please specify at least one argument for this redis lib call")
+	}
+	elems := make([]*RESPValue, argc)
+	for i := 1; i <= argc; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			elems[i-1] = NewBulkStringValue(string(v))
+		case lua.LNumber:
+			elems[i-1] = NewBulkStringValue(luaFormatNumber(float64(v)))
+		default:
+			return NewErrorValue("ERR Lua redis lib command arguments must be strings or integers")
+		}
+	}
+	return rs.scriptExecCommand(elems)
+}
+
+// scriptExecCommand 用伪客户端执行脚本、函数或 Go 函数中的命令，不能在脚本中使用的命令报错
+func (rs *RedisServer) scriptExecCommand(elems []*RESPValue) *RESPValue {
+	argc := len(elems)
+	cmd := lookupCommand(elems[0].Str)
+	if cmd == nil {
+		return NewErrorValue("ERR Unknown Redis command called from script")
+	}
+	if !cmd.checkArity(argc) {
+		return NewErrorValue("ERR Wrong number of args calling Redis command from script")
+	}
+	if cmd.flags&CMD_NO_SCRIPT != 0 {
+		return NewErrorValue("ERR This Redis command is not allowed from script")
+	}
+	if rs.clusterEnabled {
+		if errResp := rs.scriptVerifyClusterState(cmd, NewArrayValue(elems)); errResp != nil {
+			return errResp
+		}
+	}
+	if cmd.flags&CMD_WRITE != 0 {
+		if rs.luaReadOnly {
+			return NewErrorValue("ERR Write commands are not allowed from read-only scripts.")
+		}
+		if errResp := rs.writeDeniedByDiskError(); errResp != nil {
+			return errResp
+		}
+		if errResp := rs.writeDeniedByReadOnlyReplica(); errResp != nil {
+			return errResp
+		}
+		if rs.luaRun != nil {
+			rs.luaRun.wrote.Store(true)
+		}
+	}
+	return rs.runCommand(rs.luaClient, cmd, NewArrayValue(elems))
+}
+
+// luaFormatNumber 把作为命令参数的 Lua 数字转换为字符串，整数不带小数部分
+func luaFormatNumber(n float64) string {
+	if n == math.Trunc(n) && math.Abs(n) < 1<<63 {
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return strconv.FormatFloat(n, 'g', 17, 64)
+}
+
+// respToLua 按 Redis 的规则把命令回复转换为 Lua 值
+//
+// 整数转换为数字，批量字符串转换为字符串，数组（以及映射、推送）转换为 Lua 数组，
+// null 转换为 false，状态回复转换为 {ok = ...}，错误转换为 {err = ...}。
+func respToLua(L *lua.LState, v *RESPValue) lua.LValue {
+	if v.IsNull {
+		return lua.LFalse
+	}
+	switch v.Type {
+	case RESP_INTEGER:
+		return lua.LNumber(v.Num)
+	case RESP_BULK_STRING:
+		return lua.LString(v.Str)
+	case RESP_SIMPLE_STRING:
+		tbl := L.NewTable()
+		tbl.RawSetString("ok", lua.LString(v.Str))
+		return tbl
+	case RESP_ERROR:
+		tbl := L.NewTable()
+		tbl.RawSetString("err", lua.LString(v.Str))
+		return tbl
+	default:
+		tbl := L.CreateTable(len(v.Array), 0)
+		for _, elem := range v.Array {
+			tbl.Append(respToLua(L, elem))
+		}
+		return tbl
+	}
+}
+
+// luaToResp 按 Redis 的规则把脚本的返回值转换为回复
+//
+// 数字截断为整数，true 转换为 1，false 和 nil 转换为 null，带 ok 或 err 字段的表
+// 转换为状态回复或错误，其他表作为数组转换，遇到第一个 nil 为止。
+func luaToResp(v lua.LValue) *RESPValue {
+	switch v := v.(type) {
+	case lua.LString:
+		return NewBulkStringValue(string(v))
+	case lua.LNumber:
+		return NewIntegerValue(int64(v))
+	case lua.LBool:
+		if v {
+			return NewIntegerValue(1)
+		}
+		return NewNullBulkStringValue()
+	case *lua.LTable:
+		if ok, isStr := v.RawGetString("ok").(lua.LString); isStr {
+			return NewSimpleStringValue(string(ok))
+		}
+		if e, isStr := v.RawGetString("err").(lua.LString); isStr {
+			return NewErrorValue(string(e))
+		}
+		elems := make([]*RESPValue, 0)
+		for i := 1; ; i++ {
+			elem := v.RawGetInt(i)
+			if elem == lua.LNil {
+				break
+			}
+			elems = append(elems, luaToResp(elem))
+		}
+		return NewArrayValue(elems)
+	default:
+		return NewNullBulkStringValue()
+	}
+}
+
+// luaStatusReply 实现 redis.status_reply，返回 {ok = msg}
+func luaStatusReply(L *lua.LState) int {
+	tbl := L.NewTable()
+	tbl.RawSetString("ok", lua.LString(L.CheckString(1)))
+	L.Push(tbl)
+	return 1
+}
+
+// luaErrorReply 实现 redis.error_reply，返回 {err = msg}
+func luaErrorReply(L *lua.LState) int {
+	tbl := L.NewTable()
+	tbl.RawSetString("err", lua.LString(L.CheckString(1)))
+	L.Push(tbl)
+	return 1
+}
+
+// luaSha1Hex 实现 redis.sha1hex
+func luaSha1Hex(L *lua.LState) int {
+	L.Push(lua.LString(sha1hex(L.CheckString(1))))
+	return 1
+}
+
+// luaLog 实现 redis.log(level, message ...)，写入服务器日志
+func luaLog(L *lua.LState) int {
+	level := L.CheckInt(1)
+	if level < 0 || level > 3 {
+		L.RaiseError("Invalid debug level.")
+	}
+	parts := make([]string, 0, L.GetTop()-1)
+	for i := 2; i <= L.GetTop(); i++ {
+		parts = append(parts, L.ToStringMeta(L.Get(i)).String())
+	}
+	log.Printf("[lua] %s", strings.Join(parts, " "))
+	return 0
+}
@@ -0,0 +1,170 @@
+package goredis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestEvalReplyConversion(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("3", "EVAL", "return 3.99", "0")
+	c.mustDo("hello", "EVAL", "return 'hello'", "0")
+	c.mustDo("[1 2 x]", "EVAL", "return {1, 2, 'x', nil, 'ignored'}", "0")
+	c.mustDo("1", "EVAL", "return true", "0")
+	c.mustDo("(nil)", "EVAL", "return false", "0")
+	c.mustDo("OK", "EVAL", "return redis.status_reply('OK')", "0")
+	c.mustDo("(error) my error", "EVAL", "return redis.error_reply('my error')", "0")
+	c.mustDo("[k1 k2 a1]", "EVAL", "return {KEYS[1], KEYS[2], ARGV[1]}", "2", "k1", "k2", "a1")
+}
+
+func TestEvalCallsCommands(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("v", "EVAL", "redis.call('SET', KEYS[1], ARGV[1]); return redis.call('GET', KEYS[1])", "1", "k", "v")
+	c.mustDo("v", "GET", "k")
+
+	// redis.call 的错误中止脚本，redis.pcall 把错误作为返回值交给脚本
+	c.mustDo("3", "RPUSH", "list", "a", "b", "c")
+	if got := replyString(c.do("EVAL", "return redis.call('GET', KEYS[1])", "1", "list")); !strings.Contains(got, "WRONGTYPE") {
+		t.Fatalf("redis.call error returned %s", got)
+	}
+	c.mustDo("caught", "EVAL", "local r = redis.pcall('GET', KEYS[1]); if r.err then return 'caught' end", "1", "list")
+}
+
+func TestEvalsha(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	script := "return ARGV[1]"
+	sum := sha1.Sum([]byte(script))
+	sha := hex.EncodeToString(sum[:])
+
+	c.mustDo("(error) NOSCRIPT No matching script. Please use EVAL.", "EVALSHA", sha, "0", "x")
+	// EVAL 执行过的脚本按 SHA1 缓存，EVALSHA 的摘要不区分大小写
+	c.mustDo("x", "EVAL", script, "0", "x")
+	c.mustDo("y", "EVALSHA", sha, "0", "y")
+	c.mustDo("z", "EVALSHA", strings.ToUpper(sha), "0", "z")
+	c.mustDo(sha, "EVAL", "return redis.sha1hex(ARGV[1])", "0", script)
+}
+
+func TestEvalRestrictions(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(error) ERR Number of keys can't be greater than number of args", "EVAL", "return 1", "2", "k")
+	c.mustDo("(error) ERR Number of keys can't be negative", "EVAL", "return 1", "-1")
+	for _, script := range []string{
+		"x = 1",
+		"return undefined_var",
+		"return redis.call('MULTI')",
+		"return redis.call('SUBSCRIBE', 'ch')",
+		"return redis.call('EVAL', 'return 1', '0')",
+		"return redis.call('NOSUCH')",
+		"return dofile('/etc/passwd')",
+		"return (",
+	} {
+		if got := replyString(c.do("EVAL", script, "0")); !strings.HasPrefix(got, "(error)") {
+			t.Errorf("EVAL %q returned %s", script, got)
+		}
+	}
+
+	// 脚本中的阻塞命令不会阻塞，SELECT 不影响调用者
+	c.mustDo("(nil)", "EVAL", "return redis.call('BLPOP', KEYS[1], 0)", "1", "q")
+	c.mustDo("OK", "SELECT", "2")
+	c.mustDo("1", "EVAL", "redis.call('SELECT', 3); return redis.call('RPUSH', KEYS[1], 'x')", "1", "l")
+	c.mustDo("0", "LLEN", "l")
+	c.mustDo("OK", "SELECT", "3")
+	c.mustDo("1", "LLEN", "l")
+}
+
+func TestScriptCache(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	script := "return ARGV[1]"
+	sha := sha1hex(script)
+
+	c.mustDo(sha, "SCRIPT", "LOAD", script)
+	c.mustDo("[1 0]", "SCRIPT", "EXISTS", sha, strings.Repeat("0", 40))
+	c.mustDo("x", "EVALSHA", sha, "0", "x")
+	c.mustDo("[1]", "SCRIPT", "EXISTS", strings.ToUpper(sha))
+	if got := replyString(c.do("SCRIPT", "LOAD", "return (")); !strings.HasPrefix(got, "(error) ERR Error compiling script") {
+		t.Fatalf("SCRIPT LOAD of a bad script returned %s", got)
+	}
+
+	c.mustDo("(error) ERR SCRIPT FLUSH only support SYNC|ASYNC option", "SCRIPT", "FLUSH", "NOW")
+	c.mustDo("OK", "SCRIPT", "FLUSH", "ASYNC")
+	c.mustDo("[0]", "SCRIPT", "EXISTS", sha)
+	c.mustDo("(error) NOSCRIPT No matching script. Please use EVAL.", "EVALSHA", sha, "0", "x")
+	c.mustDo("(error) ERR unknown subcommand 'NOPE'. Try SCRIPT HELP.", "SCRIPT", "NOPE")
+	c.mustDo("(error) ERR This Redis command is not allowed from script", "EVAL", "return redis.pcall('SCRIPT', 'FLUSH')", "0")
+}
+
+// busyScript 是写入一个键后空转的脚本，空转的次数由 ARGV[1] 指定
+const busyScript = "if ARGV[2] == 'write' then redis.call('SET', KEYS[1], 'v') end; local i = 0; while i < tonumber(ARGV[1]) do i = i + 1 end; return i"
+
+// waitBusy 等待服务器因脚本超时而以 BUSY 拒绝命令
+func waitBusy(t *testing.T, c *testClient) {
+	t.Helper()
+	waitFor(t, "the script to time out", func() bool {
+		return strings.HasPrefix(replyString(c.do("PING")), "(error) BUSY")
+	})
+}
+
+func TestScriptKill(t *testing.T) {
+	ts := startTestServer(t)
+	runner, c := ts.connect(t), ts.connect(t)
+	c.mustDo("(error) NOTBUSY No scripts in execution right now.", "SCRIPT", "KILL")
+	c.mustDo("OK", "CONFIG", "SET", "lua-time-limit", "10")
+
+	runner.send("EVAL", "while true do end", "0")
+	waitBusy(t, c)
+	c.mustDo("(error) BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.", "GET", "k")
+	c.mustDo("(error) NOTBUSY No scripts in execution right now.", "FUNCTION", "KILL")
+	c.mustDo("OK", "SCRIPT", "KILL")
+	runner.expect("(error) ERR Script killed by user with SCRIPT KILL...")
+	c.mustDo("PONG", "PING")
+	runner.mustDo("PONG", "PING")
+}
+
+func TestScriptKillAfterWriteIsUnkillable(t *testing.T) {
+	ts := startTestServer(t)
+	runner, c := ts.connect(t), ts.connect(t)
+	c.mustDo("OK", "CONFIG", "SET", "lua-time-limit", "10")
+
+	// 已经执行过写命令的脚本不能终止，只能等它结束
+	runner.send("EVAL", busyScript, "1", "k", "2000000", "write")
+	waitBusy(t, c)
+	if got := replyString(c.do("SCRIPT", "KILL")); !strings.HasPrefix(got, "(error) UNKILLABLE") {
+		t.Fatalf("SCRIPT KILL returned %s", got)
+	}
+	runner.expect("2000000")
+	c.mustDo("v", "GET", "k")
+}
+
+func TestFunctionKill(t *testing.T) {
+	ts := startTestServer(t)
+	runner, c := ts.connect(t), ts.connect(t)
+	c.mustDo("OK", "CONFIG", "SET", "busy-reply-threshold", "10")
+	c.mustDo("[lua-time-limit 10]", "CONFIG", "GET", "lua-time-limit")
+	c.mustDo("spin", "FUNCTION", "LOAD", "#!lua name=spin\nredis.register_function('spin', function() while true do end end)")
+	if got := replyString(c.do("FUNCTION", "LOAD", "#!lua name=slow\nwhile true do end")); got != "(error) ERR FUNCTION LOAD timeout" {
+		t.Fatalf("FUNCTION LOAD of a looping library returned %s", got)
+	}
+
+	runner.send("FCALL", "spin", "0")
+	waitBusy(t, c)
+	c.mustDo("(error) BUSY Redis is busy running a script. You can only call FUNCTION KILL or SHUTDOWN NOSAVE.", "PING")
+	c.mustDo("(error) NOTBUSY No scripts in execution right now.", "SCRIPT", "KILL")
+	c.mustDo("OK", "FUNCTION", "KILL")
+	runner.expect("(error) ERR Script killed by user with FUNCTION KILL...")
+}
+
+func TestScriptWritesReachReplica(t *testing.T) {
+	master := startTestServer(t)
+	replica := startReplica(t, master)
+	c := master.connect(t)
+	c.mustDo("2", "EVAL", "redis.call('RPUSH', KEYS[1], 'a'); return redis.call('RPUSH', KEYS[1], 'b')", "1", "list")
+	r := replica.connect(t)
+	waitFor(t, "replica to apply the script", func() bool { return replyString(r.do("LRANGE", "list", "0", "-1")) == "[a b]" })
+}
@@ -1,33 +1,303 @@
-package main
+package goredis
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
 )
 
+// redisVersion 是 INFO 和 HELLO 报告的服务器版本
+const redisVersion = "0.1.0"
+
 // RedisServer 表示 Redis 服务器
 type RedisServer struct {
-	host  string
-	port  int
-	store map[string]string
-	mutex sync.RWMutex
+	host      string
+	port      int
+	databases []*redisDb
+	mutex     sync.RWMutex
+
+	// 等待服务阻塞客户端的就绪键，以及按阻塞顺序排列的 WAIT 和 WAITAOF，由服务器写锁保护；
+	// hasAcksReady 表示副本的确认或本地 AOF 的 fsync 有了进展，见 handleClientsWaitingAcks
+	readyKeys          map[readyKey]struct{}
+	hasReadyKeys       atomic.Bool
+	clientsWaitingAcks []*blockedClient
+	hasAcksReady       atomic.Bool
+
+	// 各频道、模式和分片频道的订阅者，发布订阅不涉及键空间，使用单独的锁
+	pubsubMu            sync.RWMutex
+	pubsubChannels      map[string]map[*client]struct{}
+	pubsubPatterns      map[string]map[*client]struct{}
+	pubsubShardChannels map[string]map[*client]struct{}
+
+	// notify-keyspace-events 配置启用的通知类别
+	notifyKeyspaceEvents int
+
+	// 命令锁，EXEC 和 EVAL 等持有写锁以保证事务和脚本中的命令连续执行，其他命令持有读锁；
+	// 持有写锁的命令之间先用 exclusiveMu 排队，当前的命令发布在 exclusiveCall 中
+	execMu        sync.RWMutex
+	exclusiveMu   sync.Mutex
+	exclusiveCall atomic.Pointer[exclusiveCall]
+
+	// 上一个分配的客户端 ID
+	lastClientID atomic.Int64
+
+	// 各类客户端的输出缓冲区限制，写回复时不持有服务器锁，因此整体原子替换
+	clientOutputBufferLimits atomic.Pointer[[CLIENT_TYPE_COUNT]clientBufferLimit]
+
+	// Lua 解释器、执行脚本中命令的伪客户端，以及按 SHA1 缓存的脚本，只在持有命令写锁时访问；
+	// luaReadOnly 表示正在执行的脚本不能执行写命令
+	lua         *lua.LState
+	luaClient   *client
+	luaScripts  map[string]*luaScript
+	luaReadOnly bool
+
+	// 正在执行的脚本，以及 lua-time-limit 配置的脚本超时时间（毫秒），超时后其他命令以 BUSY 拒绝
+	luaRun       *scriptRun
+	luaTimeLimit int64
+
+	// 执行函数的 Lua 解释器、已加载的函数库和按名称索引的函数，同样只在持有命令写锁时访问；
+	// functionsLoading 是 FUNCTION LOAD 正在加载的库
+	functionsLua     *lua.LState
+	libraries        map[string]*functionLibrary
+	functions        map[string]*luaFunction
+	functionsLoading *functionLibrary
+
+	// RegisterGoFunction 注册的 Go 函数，由 execMu 保护
+	goFunctions map[string]GoFunction
+
+	// RDB 文件所在的目录（绝对路径）、文件名和 rdbcompression、rdbchecksum 配置，由服务器锁保护；
+	// rdbSaving 表示正在执行 SAVE 或 BGSAVE，rdbFileMu 保证同一时刻只有一个写入者替换 RDB 文件
+	dir            string
+	dbfilename     string
+	rdbCompression bool
+	rdbChecksum    bool
+	rdbSaving      atomic.Bool
+	rdbFileMu      sync.Mutex
+
+	// 持久化的存储后端，见 Persister
+	persister Persister
+
+	// 写命令从执行到传播期间持有 propagateMu（见 call）；pendingPropagate 是当前命令
+	// （包括事务和脚本中的命令）产生的、等待写入 AOF 的命令，由 propagateMu 或命令写锁保护
+	propagateMu      sync.Mutex
+	pendingPropagate []propagatedCommand
+
+	// appendonly、appendfilename、aof-load-truncated、aof-use-rdb-preamble 和 appendfsync 配置，
+	// 前四者由服务器锁保护；loaded 表示启动时的加载已经完成，在此之前设置 appendonly 只记录配置，
+	// 由 Start 打开 AOF 文件
+	aofEnabled        bool
+	aofFilename       string
+	aofLoadTruncated  bool
+	aofUseRdbPreamble bool
+	aofFsync          atomic.Int32
+	loaded            bool
+
+	// 打开的 AOF 文件及其状态，由 aofMu 保护：aofBuf 是尚未写入文件的命令，aofSelectedDB 是文件中
+	// 最后一条 SELECT 选择的数据库，aofCurrentSize 是已经完整写入的长度；aofLastWriteErr 和
+	// aofLastFsyncErr 是最近一次写入和后台 fsync 的错误，出错期间拒绝写命令；aofFsyncPending 表示
+	// 上次 fsync 之后有新的写入，aofFsyncInProgress 表示后台 fsync 正在进行
+	aofMu              sync.Mutex
+	aofFile            AppendLog
+	aofBuf             []byte
+	aofSelectedDB      int
+	aofCurrentSize     int64
+	aofLastWriteErr    error
+	aofLastFsyncErr    error
+	aofFsyncPending    bool
+	aofFsyncInProgress bool
+
+	// WAITAOF 使用的命令序号，同样由 aofMu 保护：开启 AOF 时每次传播的命令得到递增的序号 aofSeq，
+	// aofWrittenSeq 和 aofFsyncedSeq 是已经写入文件和已经 fsync 的最大序号
+	aofSeq        int64
+	aofWrittenSeq int64
+	aofFsyncedSeq int64
+
+	// 作为副本时 AOF 中已经 fsync 的复制偏移量，同样由 aofMu 保护：aofReplOffs 是还没有 fsync 的
+	// 命令序号和执行到它时的复制偏移量，aofFsyncedReplOff 是以 FACK 报告给主节点的偏移量；
+	// aofFackChanged 表示它前进之后还没有向主节点发送 ACK
+	aofReplOffs       []aofReplOffset
+	aofFsyncedReplOff int64
+	aofFackChanged    atomic.Bool
+
+	// 后台重写 AOF 的状态，同样由 aofMu 保护：aofRewriting 表示重写在进行，期间传播的命令同时追加到
+	// aofRewriteBuf，aofRewriteSelectedDB 是其中最后一条 SELECT 选择的数据库，aofRewriteLog 是
+	// 重写写入的新日志；aofWaitRewrite 表示开启了 AOF、在等待重写完成后打开文件；
+	// aofRewriteBaseSize 是上次重写后 AOF 文件的长度，aofRewriteTry 和 aofLastBgrewriteOK 是
+	// 上次重写的开始时间和结果，aofLastRewriteTime 是上次重写用的秒数（还没有时为 -1），
+	// aofRewrites 是开始过的重写次数
+	aofRewriting         bool
+	aofRewriteBuf        []byte
+	aofRewriteSelectedDB int
+	aofRewriteLog        LogWriter
+	aofWaitRewrite       bool
+	aofRewriteBaseSize   int64
+	aofRewriteTry        int64
+	aofLastBgrewriteOK   bool
+	aofLastRewriteTime   int64
+	aofRewrites          int64
+
+	// auto-aof-rewrite-percentage 和 auto-aof-rewrite-min-size 配置：AOF 文件超过最小长度、
+	// 并且比上次重写后增长了这个百分比时自动重写，百分比为 0 时不自动重写；
+	// aofRewriteScheduled 表示有重写在等待后台保存或事务结束
+	aofRewritePerc      atomic.Int64
+	aofRewriteMinSize   atomic.Int64
+	aofRewriteScheduled atomic.Bool
+
+	// save 配置的自动保存规则，由服务器锁保护；bgsaveScheduled 表示 BGSAVE SCHEDULE
+	// 在等待正在进行的保存结束
+	saveParams      []saveParam
+	bgsaveScheduled atomic.Bool
+
+	// dirty 是启动以来数据集的修改次数，只增不减，savedDirty 是上次成功保存的快照包含的修改次数，
+	// 两者之差就是尚未保存的修改；lastSave 是上次成功保存的 Unix 时间（启动时视为已保存），
+	// lastBgsaveTry 和 lastBgsaveOK 是上次后台保存的开始时间和结果，失败后自动保存要间隔一段时间再重试
+	dirty         atomic.Int64
+	savedDirty    atomic.Int64
+	lastSave      atomic.Int64
+	lastBgsaveTry atomic.Int64
+	lastBgsaveOK  atomic.Bool
+
+	// INFO persistence 的统计：rdbBgsaveStart 是正在进行的后台保存的开始时间（没有时为 0），
+	// rdbLastBgsaveTime 是上次后台保存用的秒数（还没有时为 -1），rdbSaves 是成功保存的次数
+	rdbBgsaveStart    atomic.Int64
+	rdbLastBgsaveTime atomic.Int64
+	rdbSaves          atomic.Int64
+
+	// 复制的状态，由 replMu 保护：masterHost 和 masterPort 是 REPLICAOF 或 replicaof 配置的主节点，
+	// masterHost 为空表示本节点是主节点；masterLink 是到主节点的连接；replid 和 masterReplOffset
+	// 是复制 ID 和复制偏移量，作为副本时与主节点相同，随执行的命令流增加。replid2 是上一个复制 ID，
+	// 副本成为主节点后，原来的副本仍然可以用它在 secondReplidOffset 之前的偏移量部分同步。
+	// replBacklog 是复制积压缓冲区（没有时为 nil），大小为 replBacklogSize，没有副本 replBacklogTTL
+	// 秒后释放，replNoSlavesSince 是最后一个副本断开的时间；replCachedMaster 表示 replid 和
+	// masterReplOffset 对应当前的数据集，连接主节点时可以先尝试部分同步。
+	// 作为主节点时，replicas 是连接到本节点的副本，replBgsave 是为全量同步进行中的 BGSAVE，
+	// replSelectedDB 是命令流中最后一条 SELECT 选择的数据库，replLastPing 是上次在命令流中发送 PING 的时间，
+	// replicaReadOnly 是 replica-read-only 配置。
+	// replDisklessSync、replDisklessSyncDelay 和 replDisklessSyncMaxReplicas 是 repl-diskless-sync 等
+	// 无盘复制的配置。replicaPriority 和 replicaAnnounced 是 replica-priority 和 replica-announced 配置，只在
+	// INFO replication 中报告，供 Sentinel 等工具选择副本；failover 是进行中的 FAILOVER，没有时为 nil。
+	// 锁的顺序是 propagateMu、服务器锁、replMu，replMu 之后还可以取得客户端的 writeMu
+	replMu                      sync.Mutex
+	masterHost                  string
+	masterPort                  int
+	masterLink                  *masterLink
+	replid                      string
+	replid2                     string
+	masterReplOffset            int64
+	secondReplidOffset          int64
+	replBacklog                 *replBacklog
+	replBacklogSize             int64
+	replBacklogTTL              int64
+	replNoSlavesSince           time.Time
+	replCachedMaster            bool
+	replicas                    []*client
+	replBgsave                  *replSnapshot
+	replSelectedDB              int
+	replLastPing                time.Time
+	replicaReadOnly             bool
+	replDisklessSync            bool
+	replDisklessSyncDelay       int64
+	replDisklessSyncMaxReplicas int64
+	replicaPriority             int64
+	replicaAnnounced            bool
+	failover                    *failoverState
+
+	// 集群模式：clusterEnabled 和 clusterConfigFile 是 cluster-enabled 和 cluster-config-file 配置，
+	// 只在启动时设置；cluster 是本节点看到的集群状态，没有开启集群模式时为 nil。cluster 的内容和
+	// cluster-require-full-coverage、cluster-allow-reads-when-down、cluster-node-timeout 配置由 clusterMu 保护，
+	// 持有 clusterMu 时不再取得其他锁
+	clusterEnabled             bool
+	clusterConfigFile          string
+	clusterMu                  sync.RWMutex
+	cluster                    *clusterState
+	clusterRequireFullCoverage bool
+	clusterAllowReadsWhenDown  bool
+	clusterNodeTimeout         int64
 }
 
-// NewRedisServer 创建新的 Redis 服务器实例
-func NewRedisServer(host string, port int) *RedisServer {
-	return &RedisServer{
-		host:  host,
-		port:  port,
-		store: make(map[string]string),
+// NewRedisServer 创建新的 Redis 服务器实例，dbnum 为逻辑数据库的数量
+func NewRedisServer(host string, port int, dbnum int) *RedisServer {
+	rs := &RedisServer{
+		host:      host,
+		port:      port,
+		databases: make([]*redisDb, dbnum),
+
+		readyKeys:                  make(map[readyKey]struct{}),
+		luaTimeLimit:               5000,
+		goFunctions:                make(map[string]GoFunction),
+		dir:                        defaultDir(),
+		dbfilename:                 "dump.rdb",
+		persister:                  FilePersister{},
+		rdbCompression:             true,
+		rdbChecksum:                true,
+		saveParams:                 defaultSaveParams,
+		aofFilename:                "appendonly.aof",
+		aofLoadTruncated:           true,
+		aofUseRdbPreamble:          true,
+		replid:                     newReplid(),
+		secondReplidOffset:         -1,
+		replBacklogSize:            1 << 20,
+		replBacklogTTL:             3600,
+		replNoSlavesSince:          time.Now(),
+		replSelectedDB:             -1,
+		replicaReadOnly:            true,
+		replDisklessSyncDelay:      5,
+		replicaPriority:            100,
+		replicaAnnounced:           true,
+		clusterConfigFile:          "nodes.conf",
+		clusterRequireFullCoverage: true,
+		clusterNodeTimeout:         15000,
+		pubsubChannels:             make(map[string]map[*client]struct{}),
+		pubsubPatterns:             make(map[string]map[*client]struct{}),
+		pubsubShardChannels:        make(map[string]map[*client]struct{}),
 	}
+	for i := range rs.databases {
+		rs.databases[i] = newRedisDb(i)
+	}
+	limits := defaultClientOutputBufferLimits
+	rs.clientOutputBufferLimits.Store(&limits)
+	rs.luaClient = newScriptClient(rs)
+	rs.scriptingInit()
+	rs.functionsInit()
+	rs.lastSave.Store(time.Now().Unix())
+	rs.lastBgsaveOK.Store(true)
+	rs.aofFsync.Store(AOF_FSYNC_EVERYSEC)
+	rs.aofLastBgrewriteOK = true
+	rs.aofLastRewriteTime = -1
+	rs.rdbLastBgsaveTime.Store(-1)
+	rs.aofRewritePerc.Store(100)
+	rs.aofRewriteMinSize.Store(64 * 1024 * 1024)
+	return rs
 }
 
-// Start 启动服务器
+// Start 加载 AOF 或 RDB 文件（集群模式下先加载 nodes.conf），按 appendonly 配置打开 AOF 文件，然后开始接受连接
 func (rs *RedisServer) Start() error {
+	if rs.clusterEnabled {
+		if err := rs.clusterInit(); err != nil {
+			return err
+		}
+	}
+	if err := rs.loadDataFromDisk(); err != nil {
+		return err
+	}
+	if rs.clusterEnabled {
+		if err := rs.clusterVerifyConfigWithData(); err != nil {
+			return err
+		}
+	}
+	if err := rs.aofOpenOnServerStart(); err != nil {
+		return err
+	}
+
 	address := fmt.Sprintf("%s:%d", rs.host, rs.port)
 	listener, err := net.Listen("tcp", address)
 	if err != nil {
@@ -38,6 +308,12 @@ func (rs *RedisServer) Start() error {
 	fmt.Printf("Redis server listening on %s\n", address)
 	fmt.Println("Press Ctrl+C to stop the server")
 
+	go rs.serverCron()
+	rs.replicationStart()
+	if rs.clusterEnabled {
+		rs.clusterStart()
+	}
+
 	// 接受客户端连接
 	for {
 		conn, err := listener.Accept()
@@ -53,39 +329,48 @@ func (rs *RedisServer) Start() error {
 
 // handleConnection 处理客户端连接
 func (rs *RedisServer) handleConnection(conn net.Conn) {
-	defer conn.Close()
-
 	clientAddr := conn.RemoteAddr().String()
 	fmt.Printf("Client connected: %s\n", clientAddr)
 
-	reader := bufio.NewReader(conn)
+	c := newClient(rs, conn)
+	defer c.close()
+	defer rs.pubsubUnsubscribeAll(c)
+	defer rs.unwatchAllKeys(c)
+	defer rs.replicationRemoveReplica(c)
 
 	for {
 		// 解析 RESP 命令
-		command, err := ParseRESP(reader)
+		command, err := ParseRESP(c.reader)
 		if err != nil {
 			if err.Error() == "EOF" {
 				fmt.Printf("Client disconnected: %s\n", clientAddr)
 				break
 			}
+			if errors.Is(err, net.ErrClosed) {
+				// 超过输出缓冲区限制的客户端已被关闭
+				break
+			}
 			log.Printf("Error parsing command from %s: %v\n", clientAddr, err)
 			// 发送错误响应
 			errorResp := NewRESPValue(RESP_ERROR)
 			errorResp.Str = "ERR " + err.Error()
-			conn.Write(errorResp.SerializeRESP())
+			c.write(errorResp)
 			continue
 		}
 
 		fmt.Printf("Received from %s: %s\n", clientAddr, command.ToString())
 
-		// 处理命令
-		response := rs.processCommand(command)
-		conn.Write(response.SerializeRESP())
+		// 处理命令，订阅类命令自行发送多条回复，返回 nil
+		response := rs.processCommand(c, command)
+		if response != nil {
+			c.write(response)
+		}
+		c.afterCommand()
 	}
 }
 
 // processCommand 处理 Redis 命令
-func (rs *RedisServer) processCommand(command *RESPValue) *RESPValue {
+func (rs *RedisServer) processCommand(c *client, command *RESPValue) *RESPValue {
 	// 检查命令是否为数组类型
 	if command.Type != RESP_ARRAY || command.IsNull {
 		errorResp := NewRESPValue(RESP_ERROR)
@@ -107,37 +392,270 @@ func (rs *RedisServer) processCommand(command *RESPValue) *RESPValue {
 		return errorResp
 	}
 
-	cmd := strings.ToUpper(cmdValue.Str)
-
-	switch cmd {
-	case "PING":
-		return rs.handlePing()
-	case "ECHO":
-		return rs.handleEcho(command)
-	case "SET":
-		return rs.handleSet(command)
-	case "GET":
-		return rs.handleGet(command)
-	case "QUIT":
-		return rs.handleQuit()
-	case "INFO":
-		return rs.handleInfo()
-	default:
+	cmd := lookupCommand(cmdValue.Str)
+	if cmd == nil {
+		c.flagTransaction()
 		errorResp := NewRESPValue(RESP_ERROR)
-		errorResp.Str = "ERR unknown command '" + cmd + "'"
+		errorResp.Str = "ERR unknown command '" + strings.ToUpper(cmdValue.Str) + "'"
 		return errorResp
 	}
+	if !cmd.checkArity(len(command.Array)) {
+		c.flagTransaction()
+		return wrongArgsError(cmd.name)
+	}
+
+	// ASKING 只对之后的一条命令有效，事务中则持续到 EXEC 或 DISCARD
+	if c.asking && cmd.name != "asking" {
+		defer func() {
+			if !c.multi {
+				c.asking = false
+			}
+		}()
+	}
+
+	// 集群模式下命令的键必须都在本节点负责的同一个槽中，EXEC 时检查整个事务
+	if rs.clusterEnabled {
+		if errResp := rs.clusterCheckCommand(c, cmd, command); errResp != nil {
+			if cmd.name == "exec" {
+				rs.discardTransaction(c)
+			} else {
+				c.flagTransaction()
+			}
+			return errResp
+		}
+	}
+
+	// RESP3 客户端可以用推送类型区分消息和回复，订阅后仍然可以执行任意命令
+	if !subscribeModeCommands[cmd.name] && c.resp == RESP2 && rs.inSubscribeMode(c) {
+		return subscribeModeError(cmd.name)
+	}
+
+	// AOF 写入失败时拒绝写命令和含有写命令的事务，不再接受无法持久化的修改；只读副本同样拒绝。
+	// 主节点传来的命令总是执行，否则副本与主节点不再一致
+	if !c.master && (cmd.flags&CMD_WRITE != 0 || (cmd.name == "exec" && c.multiHasWrite())) {
+		errResp := rs.writeDeniedByDiskError()
+		if errResp == nil {
+			errResp = rs.writeDeniedByReadOnlyReplica()
+		}
+		if errResp != nil {
+			if c.multi && cmd.name == "exec" {
+				rs.discardTransaction(c)
+				return NewErrorValue("EXECABORT Transaction discarded because of: " + errResp.Str)
+			}
+			c.flagTransaction()
+			return errResp
+		}
+	}
+
+	// 事务中除了 EXEC、DISCARD 等控制命令，其他命令只排队不执行
+	if c.multi && !multiControlCommands[cmd.name] {
+		if cmd.flags&CMD_NO_MULTI != 0 {
+			c.flagTransaction()
+			return NewErrorValue("ERR Command not allowed inside a transaction")
+		}
+		c.queueMultiCommand(cmd, command)
+		return NewSimpleStringValue("QUEUED")
+	}
+
+	return rs.call(c, cmd, command)
+}
+
+// call 执行一条命令，然后服务因这条命令而就绪的阻塞客户端
+//
+// 普通命令执行期间持有 execMu 的读锁，可以并发执行；带 CMD_EXCLUSIVE 标志的命令
+// （EXEC、EVAL 等）持有写锁，执行期间其他连接的命令都要等待，因此事务和脚本中的命令
+// 不会与其他命令交错。脚本执行超时后，等待的命令以 BUSY 拒绝，只有 SCRIPT KILL 等
+// 少数命令不取锁直接执行。
+//
+// 写命令还要持有 propagateMu 直到修改被传播（写入 AOF），写命令之间因此串行执行，
+// 传播的顺序就是它们修改数据集的顺序；只读命令不受影响，仍然并发执行。主节点传来的命令
+// 都按写命令执行，执行后在同样的锁下把它们在命令流中的原始字节计入复制偏移量。
+// FAILOVER 期间可能写入的命令在取得命令锁后让出锁，等待故障转移结束。
+func (rs *RedisServer) call(c *client, cmd *redisCommand, command *RESPValue) *RESPValue {
+	exclusive := cmd.flags&CMD_EXCLUSIVE != 0
+	if run := rs.lockExec(exclusive); run != nil {
+		if allowedWhileBusy(cmd, command) {
+			return cmd.proc(rs, c, command)
+		}
+		return run.busyError()
+	}
+	if paused := rs.failoverPausedFor(c, cmd); paused != nil {
+		// 故障转移暂停了写入，结束后重新处理命令，本节点这时可能已经是只读副本
+		rs.unlockExec(exclusive)
+		<-paused
+		return rs.processCommand(c, command)
+	}
+	defer rs.unlockExec(exclusive)
+
+	if !exclusive && cmd.flags&CMD_WRITE == 0 && !c.master {
+		c.current = command
+		return cmd.proc(rs, c, command)
+	}
+	if !exclusive {
+		rs.propagateMu.Lock()
+		c.propagateLocked = true
+	}
+	resp := rs.runCommand(c, cmd, command)
+	// 阻塞过的命令已经释放了 propagateMu，它的效果由服务它的写入方传播
+	if exclusive || c.propagateLocked {
+		rs.propagatePending()
+		rs.handleClientsBlockedOnKeys()
+		rs.handleClientsWaitingAcks()
+		if c.master {
+			rs.replicationFeedStreamFromMaster(c)
+		}
+	}
+	if c.propagateLocked {
+		c.propagateLocked = false
+		rs.propagateMu.Unlock()
+	}
+	return resp
+}
+
+// runCommand 执行一条写命令或独占命令，命令修改了数据集时把它加入待传播的命令
+//
+// 调用方需持有 propagateMu 或命令写锁，这时数据集只会被这条命令修改，dirty 的变化就是它的修改。
+// 命令的键中已经过期的先被删除并传播 DEL（见 expireCommandKeys）；主节点传来的命令则把过期的键视为存在。
+// 命令可以用 rewriteArgv 改写传播的参数，或者用 alsoPropagate 传播若干等价的命令后调用
+// preventPropagation；带 CMD_NO_PROPAGATE 标志的命令（EXEC、EVAL 等）自身不传播，
+// 其中执行的命令各自调用 runCommand。
+func (rs *RedisServer) runCommand(c *client, cmd *redisCommand, command *RESPValue) *RESPValue {
+	rs.mutex.Lock()
+	rs.expireCommandKeys(c, cmd, command)
+	if c.master {
+		rs.setKeepExpired(true)
+		defer func() {
+			rs.mutex.Lock()
+			rs.setKeepExpired(false)
+			rs.mutex.Unlock()
+		}()
+	}
+	rs.mutex.Unlock()
+	before := rs.dirty.Load()
+	c.current, c.rewrittenArgv, c.preventPropagate = command, nil, false
+	resp := cmd.proc(rs, c, command)
+	if rs.dirty.Load() != before && cmd.flags&CMD_NO_PROPAGATE == 0 && !c.preventPropagate {
+		rs.alsoPropagate(c.db.id, c.propagateArgv())
+	}
+	return resp
+}
+
+// exclusiveCall 是正在执行的独占命令
+//
+// 独占命令在取得 execMu 写锁之前发布自己，等待 execMu 的命令据此得知在等待什么：
+// 命令中的脚本执行超过 lua-time-limit 之后，它们不再等待，而是立即以 BUSY 拒绝。
+type exclusiveCall struct {
+	done     chan struct{} // 命令执行完毕时关闭
+	busy     chan struct{} // 命令中的脚本超时时关闭
+	busyOnce sync.Once
+	script   atomic.Pointer[scriptRun] // 正在执行的脚本
+}
+
+// setBusy 标记命令中的脚本已超时
+func (ec *exclusiveCall) setBusy() {
+	ec.busyOnce.Do(func() { close(ec.busy) })
+}
+
+// lockExec 取得执行命令所需的 execMu，exclusive 时取得写锁并发布 exclusiveCall
+//
+// 独占命令之间先用 exclusiveMu 排队。等待期间如果挡住自己的脚本已超时，不再等待，
+// 返回该脚本，此时没有取得任何锁。
+func (rs *RedisServer) lockExec(exclusive bool) *scriptRun {
+	for {
+		var locked bool
+		if exclusive {
+			locked = rs.exclusiveMu.TryLock()
+		} else {
+			locked = rs.execMu.TryRLock()
+		}
+		if locked {
+			break
+		}
+		ec := rs.exclusiveCall.Load()
+		if ec == nil {
+			// 挡住自己的独占命令刚开始或即将结束，直接等待
+			if exclusive {
+				rs.exclusiveMu.Lock()
+			} else {
+				rs.execMu.RLock()
+			}
+			break
+		}
+		select {
+		case <-ec.busy:
+			if run := ec.script.Load(); run != nil {
+				return run
+			}
+			// 超时的脚本已经结束，等待命令的其余部分（如 EXEC 中的其他命令）
+			<-ec.done
+		case <-ec.done:
+		}
+	}
+	if exclusive {
+		rs.exclusiveCall.Store(&exclusiveCall{done: make(chan struct{}), busy: make(chan struct{})})
+		rs.execMu.Lock()
+	}
+	return nil
+}
+
+// unlockExec 释放 lockExec 取得的锁
+func (rs *RedisServer) unlockExec(exclusive bool) {
+	if !exclusive {
+		rs.execMu.RUnlock()
+		return
+	}
+	ec := rs.exclusiveCall.Load()
+	rs.execMu.Unlock()
+	rs.exclusiveCall.Store(nil)
+	close(ec.done)
+	rs.exclusiveMu.Unlock()
+}
+
+// getArgs 提取命令参数（不含命令名），要求每个参数都是批量字符串
+func getArgs(command *RESPValue) ([]string, *RESPValue) {
+	args := make([]string, 0, len(command.Array)-1)
+	for _, arg := range command.Array[1:] {
+		if arg.Type != RESP_BULK_STRING {
+			return nil, NewErrorValue("ERR Protocol error: expected bulk string for argument")
+		}
+		args = append(args, arg.Str)
+	}
+	return args, nil
+}
+
+// wrongArgsError 返回参数数量错误
+func wrongArgsError(name string) *RESPValue {
+	return NewErrorValue("ERR wrong number of arguments for '" + name + "' command")
 }
 
 // handlePing 处理 PING 命令
-func (rs *RedisServer) handlePing() *RESPValue {
+//
+// 订阅模式下以 ["pong", message] 数组回复，以便与推送的消息区分。
+func (rs *RedisServer) handlePing(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) > 1 {
+		return wrongArgsError("ping")
+	}
+	if c.resp == RESP2 && rs.inSubscribeMode(c) {
+		message := ""
+		if len(args) == 1 {
+			message = args[0]
+		}
+		return NewArrayValue([]*RESPValue{NewBulkStringValue("pong"), NewBulkStringValue(message)})
+	}
+	if len(args) == 1 {
+		return NewBulkStringValue(args[0])
+	}
 	resp := NewRESPValue(RESP_SIMPLE_STRING)
 	resp.Str = "PONG"
 	return resp
 }
 
 // handleEcho 处理 ECHO 命令
-func (rs *RedisServer) handleEcho(command *RESPValue) *RESPValue {
+func (rs *RedisServer) handleEcho(c *client, command *RESPValue) *RESPValue {
 	if len(command.Array) < 2 {
 		errorResp := NewRESPValue(RESP_ERROR)
 		errorResp.Str = "ERR wrong number of arguments for 'echo' command"
@@ -157,7 +675,7 @@ func (rs *RedisServer) handleEcho(command *RESPValue) *RESPValue {
 }
 
 // handleSet 处理 SET 命令
-func (rs *RedisServer) handleSet(command *RESPValue) *RESPValue {
+func (rs *RedisServer) handleSet(c *client, command *RESPValue) *RESPValue {
 	if len(command.Array) < 3 {
 		errorResp := NewRESPValue(RESP_ERROR)
 		errorResp.Str = "ERR wrong number of arguments for 'set' command"
@@ -176,7 +694,9 @@ func (rs *RedisServer) handleSet(command *RESPValue) *RESPValue {
 
 	// 线程安全地设置键值对
 	rs.mutex.Lock()
-	rs.store[key] = value
+	c.db.store.Set(key, NewStringObject(value))
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_STRING, "set", key, c.db.id)
 	rs.mutex.Unlock()
 
 	resp := NewRESPValue(RESP_SIMPLE_STRING)
@@ -185,7 +705,7 @@ func (rs *RedisServer) handleSet(command *RESPValue) *RESPValue {
 }
 
 // handleGet 处理 GET 命令
-func (rs *RedisServer) handleGet(command *RESPValue) *RESPValue {
+func (rs *RedisServer) handleGet(c *client, command *RESPValue) *RESPValue {
 	if len(command.Array) < 2 {
 		errorResp := NewRESPValue(RESP_ERROR)
 		errorResp.Str = "ERR wrong number of arguments for 'get' command"
@@ -201,33 +721,164 @@ func (rs *RedisServer) handleGet(command *RESPValue) *RESPValue {
 
 	key := command.Array[1].Str
 
-	// 线程安全地获取值
+	// 线程安全地获取值，字符串内容可能被原地修改，需在持有锁时复制
 	rs.mutex.RLock()
-	value, exists := rs.store[key]
-	rs.mutex.RUnlock()
+	defer rs.mutex.RUnlock()
 
-	if !exists {
+	obj := c.db.lookupKey(key)
+	if obj == nil {
 		// 返回 null bulk string
 		resp := NewRESPValue(RESP_BULK_STRING)
 		resp.IsNull = true
 		return resp
 	}
 
+	if obj.Type != OBJ_STRING {
+		return NewErrorValue(wrongTypeErr)
+	}
+
 	resp := NewRESPValue(RESP_BULK_STRING)
-	resp.Str = value
+	resp.Str = string(obj.Value.([]byte))
 	return resp
 }
 
 // handleQuit 处理 QUIT 命令
-func (rs *RedisServer) handleQuit() *RESPValue {
+func (rs *RedisServer) handleQuit(c *client) *RESPValue {
 	resp := NewRESPValue(RESP_SIMPLE_STRING)
 	resp.Str = "OK"
 	return resp
 }
 
-// handleInfo 处理 INFO 命令
-func (rs *RedisServer) handleInfo() *RESPValue {
-	resp := NewRESPValue(RESP_BULK_STRING)
-	resp.Str = "# Server\r\nredis_version:0.1.0\r\n"
-	return resp
+// handleShutdown 处理 SHUTDOWN [NOSAVE|SAVE] [NOW] [FORCE] 命令，退出服务器进程
+//
+// 指定 SAVE，或者两者都未指定而配置了 save 规则时，退出前同步保存 RDB 文件，保存失败则不退出；
+// FORCE 表示保存失败也退出。
+func (rs *RedisServer) handleShutdown(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	save, nosave, force := false, false, false
+	for _, arg := range args {
+		switch strings.ToUpper(arg) {
+		case "NOSAVE":
+			nosave = true
+		case "SAVE":
+			save = true
+		case "FORCE":
+			force = true
+		case "NOW":
+		default:
+			return NewErrorValue("ERR syntax error")
+		}
+	}
+	if save && nosave {
+		return NewErrorValue("ERR syntax error")
+	}
+	if !save && !nosave {
+		rs.mutex.RLock()
+		save = len(rs.saveParams) > 0
+		rs.mutex.RUnlock()
+	}
+	log.Println("User requested shutdown...")
+	if !rs.aofKillRewriteOnShutdown(force) {
+		return NewErrorValue("ERR Errors trying to SHUTDOWN. Check logs.")
+	}
+	if save {
+		// 正在进行的 BGSAVE 不必等待：这里保存的快照更新，持有 rdbFileMu 直到退出，
+		// 后台的写入不会再覆盖它
+		log.Println("Saving the final RDB snapshot before exiting.")
+		data, dir, filename, _ := rs.rdbSnapshot()
+		rs.rdbFileMu.Lock()
+		if err := rs.rdbWriteFile(dir, filename, data); err != nil {
+			if !force {
+				rs.rdbFileMu.Unlock()
+				log.Println("Error trying to save the DB, can't exit.")
+				return NewErrorValue("ERR Errors trying to SHUTDOWN. Check logs.")
+			}
+			log.Println("Error trying to save the DB. Exit anyway.")
+		} else {
+			log.Println("DB saved on disk")
+		}
+	}
+	rs.aofFlushOnShutdown()
+	log.Println("Redis is now ready to exit, bye bye...")
+	os.Exit(0)
+	return nil
+}
+
+// handleHello 处理 HELLO [protover [AUTH username password] [SETNAME clientname]] 命令
+//
+// 切换连接使用的协议版本并以映射返回服务器信息。服务器没有配置密码，
+// AUTH 只接受默认用户 default，密码任意。
+func (rs *RedisServer) handleHello(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+
+	proto := c.resp
+	if len(args) > 0 {
+		ver, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return NewErrorValue("ERR Protocol version is not an integer or out of range")
+		}
+		if ver != RESP2 && ver != RESP3 {
+			return NewErrorValue("NOPROTO unsupported protocol version")
+		}
+		proto = int(ver)
+	}
+
+	name, setName := "", false
+	for i := 1; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "AUTH") && i+2 < len(args):
+			if args[i+1] != "default" {
+				return NewErrorValue("WRONGPASS invalid username-password pair or user is disabled.")
+			}
+			i += 2
+		case strings.EqualFold(args[i], "SETNAME") && i+1 < len(args):
+			name, setName = args[i+1], true
+			if !validClientName(name) {
+				return NewErrorValue("ERR Client names cannot contain spaces, newlines or special characters.")
+			}
+			i++
+		default:
+			return NewErrorValue("ERR Syntax error in HELLO option '" + args[i] + "'")
+		}
+	}
+
+	if setName {
+		c.name = name
+	}
+	c.setProtocol(proto)
+	role := "master"
+	rs.replMu.Lock()
+	if rs.masterHost != "" {
+		role = "replica"
+	}
+	rs.replMu.Unlock()
+	mode := "standalone"
+	if rs.clusterEnabled {
+		mode = "cluster"
+	}
+	return NewMapValue([]*RESPValue{
+		NewBulkStringValue("server"), NewBulkStringValue("redis"),
+		NewBulkStringValue("version"), NewBulkStringValue(redisVersion),
+		NewBulkStringValue("proto"), NewIntegerValue(int64(proto)),
+		NewBulkStringValue("id"), NewIntegerValue(c.id),
+		NewBulkStringValue("mode"), NewBulkStringValue(mode),
+		NewBulkStringValue("role"), NewBulkStringValue(role),
+		NewBulkStringValue("modules"), NewArrayValue([]*RESPValue{}),
+	})
+}
+
+// validClientName 判断连接名是否只包含可见字符（不含空格）
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,184 @@
+package goredis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer 是测试中启动的服务器，监听 127.0.0.1 上的随机端口，数据目录是临时目录
+type testServer struct {
+	rs   *RedisServer
+	addr string
+	dir  string
+}
+
+// startTestServer 以 conf 中的配置行启动服务器，默认关闭自动保存
+func startTestServer(t *testing.T, conf ...string) *testServer {
+	t.Helper()
+	return startTestServerIn(t, testDir(t), conf...)
+}
+
+// startTestServerIn 在 dir 下启动服务器，用于重启后加载同一目录中的持久化文件
+func startTestServerIn(t *testing.T, dir string, conf ...string) *testServer {
+	t.Helper()
+	return startTestServerWith(t, dir, nil, conf...)
+}
+
+// startTestServerWith 与 startTestServerIn 相同，setup 在 Start 之前调用
+func startTestServerWith(t *testing.T, dir string, setup func(rs *RedisServer), conf ...string) *testServer {
+	t.Helper()
+	port := freePort(t)
+	lines := append([]string{"save \"\"", fmt.Sprintf("dir %q", dir)}, conf...)
+	path := filepath.Join(dir, fmt.Sprintf("test-%d.conf", port))
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	directives, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := NewRedisServer("127.0.0.1", port, 16)
+	if err := rs.applyConfigFile(directives); err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(rs)
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- rs.Start() }()
+
+	ts := &testServer{rs: rs, addr: fmt.Sprintf("127.0.0.1:%d", port), dir: dir}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		select {
+		case err := <-errCh:
+			t.Fatalf("server failed to start: %v", err)
+		default:
+		}
+		conn, err := net.Dial("tcp", ts.addr)
+		if err == nil {
+			conn.Close()
+			return ts
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start listening on %s", ts.addr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// testDir 返回测试使用的临时目录；服务器在测试结束后不会停止，删除目录时忽略错误
+func testDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "goredis-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// freePort 返回一个当前没有被使用的端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// testClient 是以 RESP2 与服务器通信的测试客户端
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// connect 连接测试服务器，测试结束时关闭连接
+func (ts *testServer) connect(t *testing.T) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", ts.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// send 发送一条命令，不读取回复
+func (tc *testClient) send(args ...string) {
+	tc.t.Helper()
+	argv := make([]*RESPValue, len(args))
+	for i, arg := range args {
+		argv[i] = NewBulkStringValue(arg)
+	}
+	if _, err := tc.conn.Write(NewArrayValue(argv).SerializeRESP()); err != nil {
+		tc.t.Fatal(err)
+	}
+}
+
+// read 读取一条回复
+func (tc *testClient) read() *RESPValue {
+	tc.t.Helper()
+	tc.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	v, err := ParseRESP(tc.reader)
+	if err != nil {
+		tc.t.Fatalf("reading reply: %v", err)
+	}
+	return v
+}
+
+// do 发送一条命令并返回回复
+func (tc *testClient) do(args ...string) *RESPValue {
+	tc.t.Helper()
+	tc.send(args...)
+	return tc.read()
+}
+
+// mustDo 执行命令并检查回复的文本形式，见 replyString
+func (tc *testClient) mustDo(want string, args ...string) {
+	tc.t.Helper()
+	if got := replyString(tc.do(args...)); got != want {
+		tc.t.Fatalf("%s: got %s, want %s", strings.Join(args, " "), got, want)
+	}
+}
+
+// replyString 把回复转换为便于比较的文本：错误为 (error) 加内容，空值为 (nil)，数组为 [a b ...]
+func replyString(v *RESPValue) string {
+	switch {
+	case v.IsNull:
+		return "(nil)"
+	case v.Type == RESP_ERROR:
+		return "(error) " + v.Str
+	case v.Type == RESP_INTEGER:
+		return fmt.Sprint(v.Num)
+	case v.Type == RESP_ARRAY:
+		elems := make([]string, len(v.Array))
+		for i, e := range v.Array {
+			elems[i] = replyString(e)
+		}
+		return "[" + strings.Join(elems, " ") + "]"
+	default:
+		return v.Str
+	}
+}
+
+// waitFor 等待 cond 成立，超时时测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,222 @@
+package goredis
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// intset 编码允许的最大元素数量，对应 Redis 的 set-max-intset-entries
+const setMaxIntsetEntries = 512
+
+// Set 表示集合类型的值
+//
+// 与 Redis 一样有两种编码：元素全部是整数且数量较少时使用 intset 编码，
+// 元素以有序 int64 切片保存，比哈希表节省大量内存；一旦插入非整数元素或
+// 超过 setMaxIntsetEntries，就自动升级为哈希表编码（之后不再降级）。
+//
+// 哈希表编码下元素紧凑地存放在 members 中，index 记录每个元素的下标，
+// 这样随机取元素（SPOP/SRANDMEMBER）是 O(1) 的，删除时与末尾元素交换即可。
+type Set struct {
+	intset  []int64
+	index   map[string]int
+	members []string
+}
+
+// NewSet 创建空集合，初始为 intset 编码
+func NewSet() *Set {
+	return &Set{intset: []int64{}}
+}
+
+// isIntset 判断当前是否为 intset 编码
+func (s *Set) isIntset() bool {
+	return s.index == nil
+}
+
+// Encoding 返回当前编码名称
+func (s *Set) Encoding() string {
+	if s.isIntset() {
+		return "intset"
+	}
+	return "hashtable"
+}
+
+// parseIntsetValue 判断元素能否以整数形式保存，要求是规范的十进制表示
+func parseIntsetValue(member string) (int64, bool) {
+	v, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != member {
+		return 0, false
+	}
+	return v, true
+}
+
+// intsetSearch 二分查找整数在 intset 中的位置
+func (s *Set) intsetSearch(v int64) (int, bool) {
+	i := sort.Search(len(s.intset), func(i int) bool { return s.intset[i] >= v })
+	return i, i < len(s.intset) && s.intset[i] == v
+}
+
+// convertToHashtable 将 intset 编码升级为哈希表编码
+func (s *Set) convertToHashtable() {
+	s.index = make(map[string]int, len(s.intset)+1)
+	s.members = make([]string, 0, len(s.intset)+1)
+	for _, v := range s.intset {
+		member := strconv.FormatInt(v, 10)
+		s.index[member] = len(s.members)
+		s.members = append(s.members, member)
+	}
+	s.intset = nil
+}
+
+// Len 返回集合元素数量
+func (s *Set) Len() int {
+	if s.isIntset() {
+		return len(s.intset)
+	}
+	return len(s.members)
+}
+
+// Add 添加元素，返回元素是否为新添加
+func (s *Set) Add(member string) bool {
+	if s.isIntset() {
+		if v, ok := parseIntsetValue(member); ok {
+			i, found := s.intsetSearch(v)
+			if found {
+				return false
+			}
+			if len(s.intset) < setMaxIntsetEntries {
+				s.intset = append(s.intset, 0)
+				copy(s.intset[i+1:], s.intset[i:])
+				s.intset[i] = v
+				return true
+			}
+		}
+		s.convertToHashtable()
+	}
+
+	if _, ok := s.index[member]; ok {
+		return false
+	}
+	s.index[member] = len(s.members)
+	s.members = append(s.members, member)
+	return true
+}
+
+// Remove 删除元素，返回元素是否存在
+func (s *Set) Remove(member string) bool {
+	if s.isIntset() {
+		v, ok := parseIntsetValue(member)
+		if !ok {
+			return false
+		}
+		i, found := s.intsetSearch(v)
+		if !found {
+			return false
+		}
+		s.intset = append(s.intset[:i], s.intset[i+1:]...)
+		return true
+	}
+
+	i, ok := s.index[member]
+	if !ok {
+		return false
+	}
+	last := len(s.members) - 1
+	if i != last {
+		s.members[i] = s.members[last]
+		s.index[s.members[i]] = i
+	}
+	s.members[last] = ""
+	s.members = s.members[:last]
+	delete(s.index, member)
+	return true
+}
+
+// Contains 判断元素是否存在
+func (s *Set) Contains(member string) bool {
+	if s.isIntset() {
+		v, ok := parseIntsetValue(member)
+		if !ok {
+			return false
+		}
+		_, found := s.intsetSearch(v)
+		return found
+	}
+	_, ok := s.index[member]
+	return ok
+}
+
+// at 返回第 i 个元素
+func (s *Set) at(i int) string {
+	if s.isIntset() {
+		return strconv.FormatInt(s.intset[i], 10)
+	}
+	return s.members[i]
+}
+
+// Iterate 遍历所有元素（顺序不确定），fn 返回 false 时停止
+func (s *Set) Iterate(fn func(member string) bool) {
+	for i := 0; i < s.Len(); i++ {
+		if !fn(s.at(i)) {
+			return
+		}
+	}
+}
+
+// Members 返回所有元素（顺序不确定）
+func (s *Set) Members() []string {
+	result := make([]string, s.Len())
+	for i := range result {
+		result[i] = s.at(i)
+	}
+	return result
+}
+
+// Random 随机返回一个元素，集合不能为空
+func (s *Set) Random() string {
+	return s.at(rand.Intn(s.Len()))
+}
+
+// RandomDistinct 随机返回 count 个互不相同的元素，count 不能超过集合大小
+//
+// 使用 Floyd 抽样算法，只需 O(count) 的时间和空间，无需复制整个集合。
+func (s *Set) RandomDistinct(count int) []string {
+	n := s.Len()
+	chosen := make(map[int]struct{}, count)
+	result := make([]string, 0, count)
+	for j := n - count; j < n; j++ {
+		t := rand.Intn(j + 1)
+		if _, ok := chosen[t]; ok {
+			t = j
+		}
+		chosen[t] = struct{}{}
+		result = append(result, s.at(t))
+	}
+	return result
+}
+
+// Scan 从游标处开始返回大约 count 个元素及下一个游标，游标为 0 表示遍历结束
+//
+// intset 编码的集合很小，与 Redis 一样一次返回全部元素。
+// 哈希表编码下遍历从 members 的末尾向前进行：删除元素时只会把末尾（已遍历过的）
+// 元素交换到前面，新增元素追加在末尾，因此遍历期间一直存在的元素至少会被返回一次。
+// 游标的值为下一个待访问的下标加一，0 表示从末尾开始。
+func (s *Set) Scan(cursor uint64, count int) (uint64, []string) {
+	if s.isIntset() {
+		return 0, s.Members()
+	}
+
+	next := len(s.members) - 1
+	if cursor > 0 && int(cursor-1) < next {
+		next = int(cursor - 1)
+	}
+
+	result := make([]string, 0, count)
+	for ; next >= 0 && len(result) < count; next-- {
+		result = append(result, s.members[next])
+	}
+	if next < 0 {
+		return 0, result
+	}
+	return uint64(next + 1), result
+}
@@ -0,0 +1,589 @@
+package goredis
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// membersToArray 将集合元素转换为数组响应
+func membersToArray(members []string) *RESPValue {
+	elems := make([]*RESPValue, len(members))
+	for i, member := range members {
+		elems[i] = NewBulkStringValue(member)
+	}
+	return NewArrayValue(elems)
+}
+
+// handleSAdd 处理 SADD 命令
+func (rs *RedisServer) handleSAdd(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("sadd")
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	set, errResp := c.db.lookupSetWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		obj := NewSetObject()
+		c.db.store.Set(key, obj)
+		set = obj.Value.(*Set)
+	}
+
+	added := 0
+	for _, member := range args[1:] {
+		if set.Add(member) {
+			added++
+		}
+	}
+	if added > 0 {
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_SET, "sadd", key, c.db.id)
+	}
+	return NewIntegerValue(int64(added))
+}
+
+// handleSRem 处理 SREM 命令
+func (rs *RedisServer) handleSRem(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("srem")
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	set, errResp := c.db.lookupSetWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		return NewIntegerValue(0)
+	}
+
+	removed := 0
+	for _, member := range args[1:] {
+		if set.Remove(member) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_SET, "srem", key, c.db.id)
+		if set.Len() == 0 {
+			c.db.store.Delete(key)
+			rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+		}
+	}
+	return NewIntegerValue(int64(removed))
+}
+
+// handleSMembers 处理 SMEMBERS 命令
+func (rs *RedisServer) handleSMembers(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 {
+		return wrongArgsError("smembers")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	set, errResp := c.db.lookupSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		return NewArrayValue([]*RESPValue{})
+	}
+	return membersToArray(set.Members())
+}
+
+// handleSIsMember 处理 SISMEMBER 命令
+func (rs *RedisServer) handleSIsMember(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("sismember")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	set, errResp := c.db.lookupSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if set != nil && set.Contains(args[1]) {
+		return NewIntegerValue(1)
+	}
+	return NewIntegerValue(0)
+}
+
+// handleSMIsMember 处理 SMISMEMBER 命令
+func (rs *RedisServer) handleSMIsMember(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("smismember")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	set, errResp := c.db.lookupSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+
+	elems := make([]*RESPValue, len(args)-1)
+	for i, member := range args[1:] {
+		if set != nil && set.Contains(member) {
+			elems[i] = NewIntegerValue(1)
+		} else {
+			elems[i] = NewIntegerValue(0)
+		}
+	}
+	return NewArrayValue(elems)
+}
+
+// handleSCard 处理 SCARD 命令
+func (rs *RedisServer) handleSCard(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 {
+		return wrongArgsError("scard")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	set, errResp := c.db.lookupSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		return NewIntegerValue(0)
+	}
+	return NewIntegerValue(int64(set.Len()))
+}
+
+// handleSPop 处理 SPOP 命令
+func (rs *RedisServer) handleSPop(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return wrongArgsError("spop")
+	}
+
+	count := -1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return NewErrorValue("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	set, errResp := c.db.lookupSetWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		if count >= 0 {
+			return NewArrayValue([]*RESPValue{})
+		}
+		return NewNullBulkStringValue()
+	}
+
+	var popped []string
+	if count < 0 {
+		popped = []string{set.Random()}
+	} else if count >= set.Len() {
+		popped = set.Members()
+	} else {
+		popped = set.RandomDistinct(count)
+	}
+	for _, member := range popped {
+		set.Remove(member)
+	}
+	if len(popped) > 0 {
+		// 弹出的成员是随机的，改写为删除这些成员，重放时结果相同
+		c.rewriteArgv(append([]string{"SREM", key}, popped...)...)
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_SET, "spop", key, c.db.id)
+		if set.Len() == 0 {
+			c.db.store.Delete(key)
+			rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+		}
+	}
+
+	if count < 0 {
+		return NewBulkStringValue(popped[0])
+	}
+	return membersToArray(popped)
+}
+
+// handleSRandMember 处理 SRANDMEMBER 命令
+func (rs *RedisServer) handleSRandMember(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return wrongArgsError("srandmember")
+	}
+
+	hasCount := len(args) == 2
+	count := 0
+	if hasCount {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		count = n
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	set, errResp := c.db.lookupSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		if hasCount {
+			return NewArrayValue([]*RESPValue{})
+		}
+		return NewNullBulkStringValue()
+	}
+	if !hasCount {
+		return NewBulkStringValue(set.Random())
+	}
+
+	// 负数表示允许重复，返回恰好 |count| 个元素
+	if count < 0 {
+		members := make([]string, -count)
+		for i := range members {
+			members[i] = set.Random()
+		}
+		return membersToArray(members)
+	}
+	if count >= set.Len() {
+		return membersToArray(set.Members())
+	}
+	return membersToArray(set.RandomDistinct(count))
+}
+
+// 集合运算类型
+const (
+	SET_OP_UNION = iota
+	SET_OP_INTER
+	SET_OP_DIFF
+)
+
+// setAlgebra 对多个键执行集合运算，不存在的键视为空集合（调用方需持有锁）
+func (rs *RedisServer) setAlgebra(c *client, keys []string, op int) ([]string, *RESPValue) {
+	sets := make([]*Set, len(keys))
+	for i, key := range keys {
+		set, errResp := c.db.lookupSet(key)
+		if errResp != nil {
+			return nil, errResp
+		}
+		if set == nil {
+			set = NewSet()
+		}
+		sets[i] = set
+	}
+
+	switch op {
+	case SET_OP_INTER:
+		// 从最小的集合开始检查，减少比较次数
+		smallest := 0
+		for i, set := range sets {
+			if set.Len() < sets[smallest].Len() {
+				smallest = i
+			}
+		}
+		result := []string{}
+		sets[smallest].Iterate(func(member string) bool {
+			for i, set := range sets {
+				if i != smallest && !set.Contains(member) {
+					return true
+				}
+			}
+			result = append(result, member)
+			return true
+		})
+		return result, nil
+
+	case SET_OP_DIFF:
+		result := []string{}
+		sets[0].Iterate(func(member string) bool {
+			for _, set := range sets[1:] {
+				if set.Contains(member) {
+					return true
+				}
+			}
+			result = append(result, member)
+			return true
+		})
+		return result, nil
+
+	default:
+		union := NewSet()
+		for _, set := range sets {
+			set.Iterate(func(member string) bool {
+				union.Add(member)
+				return true
+			})
+		}
+		return union.Members(), nil
+	}
+}
+
+// handleSetAlgebra 处理 SINTER/SUNION/SDIFF 命令
+func (rs *RedisServer) handleSetAlgebra(c *client, command *RESPValue, name string, op int) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError(name)
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	members, errResp := rs.setAlgebra(c, args, op)
+	if errResp != nil {
+		return errResp
+	}
+	return membersToArray(members)
+}
+
+// handleSetAlgebraStore 处理 SINTERSTORE/SUNIONSTORE/SDIFFSTORE 命令
+func (rs *RedisServer) handleSetAlgebraStore(c *client, command *RESPValue, name string, op int) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError(name)
+	}
+
+	destination := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	members, errResp := rs.setAlgebra(c, args[1:], op)
+	if errResp != nil {
+		return errResp
+	}
+
+	// 结果为空时删除目标键，否则无论原类型如何都整体替换
+	if len(members) == 0 {
+		if c.db.lookupKey(destination) != nil {
+			c.db.store.Delete(destination)
+			rs.signalModifiedKey(c.db, destination)
+			rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", destination, c.db.id)
+		}
+		return NewIntegerValue(0)
+	}
+
+	obj := NewSetObject()
+	set := obj.Value.(*Set)
+	for _, member := range members {
+		set.Add(member)
+	}
+	c.db.store.Set(destination, obj)
+	rs.signalModifiedKey(c.db, destination)
+	rs.notifyKeyspaceEvent(NOTIFY_SET, name, destination, c.db.id)
+	return NewIntegerValue(int64(set.Len()))
+}
+
+// handleSMove 处理 SMOVE 命令
+func (rs *RedisServer) handleSMove(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 {
+		return wrongArgsError("smove")
+	}
+
+	source, destination, member := args[0], args[1], args[2]
+
+	// 整个移动在同一把写锁内完成，其他客户端不会观察到中间状态
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	srcSet, errResp := c.db.lookupSetWrite(source)
+	if errResp != nil {
+		return errResp
+	}
+	dstSet, errResp := c.db.lookupSetWrite(destination)
+	if errResp != nil {
+		return errResp
+	}
+
+	if srcSet == nil || !srcSet.Contains(member) {
+		return NewIntegerValue(0)
+	}
+	if source == destination {
+		return NewIntegerValue(1)
+	}
+
+	srcSet.Remove(member)
+	rs.signalModifiedKey(c.db, source)
+	rs.notifyKeyspaceEvent(NOTIFY_SET, "srem", source, c.db.id)
+	if srcSet.Len() == 0 {
+		c.db.store.Delete(source)
+		rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", source, c.db.id)
+	}
+	if dstSet == nil {
+		obj := NewSetObject()
+		c.db.store.Set(destination, obj)
+		dstSet = obj.Value.(*Set)
+	}
+	if dstSet.Add(member) {
+		rs.signalModifiedKey(c.db, destination)
+		rs.notifyKeyspaceEvent(NOTIFY_SET, "sadd", destination, c.db.id)
+	}
+	return NewIntegerValue(1)
+}
+
+// handleSScan 处理 SSCAN 命令
+func (rs *RedisServer) handleSScan(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("sscan")
+	}
+
+	opts, errResp := parseScanArgs(args[1:], false)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	set, errResp := c.db.lookupSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		return scanReply(0, []*RESPValue{})
+	}
+
+	cursor, members := set.Scan(opts.cursor, opts.count)
+	elems := make([]*RESPValue, 0, len(members))
+	for _, member := range members {
+		if opts.matches(member) {
+			elems = append(elems, NewBulkStringValue(member))
+		}
+	}
+	return scanReply(cursor, elems)
+}
+
+// handleSInterCard 处理 SINTERCARD 命令
+func (rs *RedisServer) handleSInterCard(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("sintercard")
+	}
+
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys <= 0 {
+		return NewErrorValue("ERR numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return NewErrorValue("ERR Number of keys can't be greater than number of args")
+	}
+	keys := args[1 : numKeys+1]
+
+	limit := 0
+	rest := args[numKeys+1:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToUpper(rest[0]) != "LIMIT" {
+			return NewErrorValue("ERR syntax error")
+		}
+		limit, err = strconv.Atoi(rest[1])
+		if err != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return NewErrorValue("ERR LIMIT can't be negative")
+		}
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	sets := make([]*Set, len(keys))
+	empty := false
+	for i, key := range keys {
+		set, errResp := c.db.lookupSet(key)
+		if errResp != nil {
+			return errResp
+		}
+		if set == nil {
+			empty = true
+		}
+		sets[i] = set
+	}
+	if empty {
+		return NewIntegerValue(0)
+	}
+
+	// 从最小的集合开始检查，计数达到 LIMIT（0 表示不限制）后立即返回
+	sort.Slice(sets, func(i, j int) bool { return sets[i].Len() < sets[j].Len() })
+	count := 0
+	sets[0].Iterate(func(member string) bool {
+		for _, set := range sets[1:] {
+			if !set.Contains(member) {
+				return true
+			}
+		}
+		count++
+		return limit == 0 || count < limit
+	})
+	return NewIntegerValue(int64(count))
+}
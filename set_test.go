@@ -0,0 +1,200 @@
+package goredis
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// mustDoSorted 与 mustDo 相同，但先把数组回复按字典序排序，用于元素顺序不确定的命令
+func (tc *testClient) mustDoSorted(want string, args ...string) {
+	tc.t.Helper()
+	v := tc.do(args...)
+	if v.Type == RESP_ARRAY && !v.IsNull {
+		slices.SortFunc(v.Array, func(a, b *RESPValue) int { return strings.Compare(a.Str, b.Str) })
+	}
+	if got := replyString(v); got != want {
+		tc.t.Fatalf("%s: got %s, want %s", strings.Join(args, " "), got, want)
+	}
+}
+
+func TestSetBasics(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("3", "SADD", "s", "a", "b", "c")
+	c.mustDo("1", "SADD", "s", "a", "d")
+	c.mustDoSorted("[a b c d]", "SMEMBERS", "s")
+	c.mustDo("1", "SISMEMBER", "s", "a")
+	c.mustDo("0", "SISMEMBER", "s", "x")
+	c.mustDo("2", "SREM", "s", "a", "b", "x")
+	c.mustDoSorted("[c d]", "SMEMBERS", "s")
+
+	// 删除最后一个成员后键不再存在，可以用作其他类型
+	c.mustDo("2", "SREM", "s", "c", "d")
+	c.mustDo("[]", "SMEMBERS", "s")
+	c.mustDo("1", "RPUSH", "s", "x")
+	c.mustDo("(error) WRONGTYPE Operation against a key holding the wrong kind of value", "SADD", "s", "a")
+}
+
+func TestSCardAndSMIsMember(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("0", "SCARD", "s")
+	c.mustDo("3", "SADD", "s", "a", "b", "c")
+	c.mustDo("3", "SCARD", "s")
+	c.mustDo("[1 0 1]", "SMISMEMBER", "s", "a", "x", "c")
+	c.mustDo("[0 0]", "SMISMEMBER", "missing", "a", "b")
+}
+
+func TestSPopAndSRandMember(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(nil)", "SPOP", "s")
+	c.mustDo("[]", "SRANDMEMBER", "s", "3")
+	c.mustDo("5", "SADD", "s", "a", "b", "c", "d", "e")
+
+	// 正数 COUNT 返回互不相同的元素，不超过集合大小
+	if v := c.do("SRANDMEMBER", "s", "3"); len(v.Array) != 3 || len(distinct(v)) != 3 {
+		t.Fatalf("SRANDMEMBER s 3: got %s", replyString(v))
+	}
+	c.mustDoSorted("[a b c d e]", "SRANDMEMBER", "s", "10")
+	// 负数 COUNT 允许重复，返回恰好 |count| 个元素
+	if v := c.do("SRANDMEMBER", "s", "-20"); len(v.Array) != 20 {
+		t.Fatalf("SRANDMEMBER s -20: got %s", replyString(v))
+	}
+	c.mustDo("5", "SCARD", "s")
+
+	popped := c.do("SPOP", "s", "2")
+	if len(popped.Array) != 2 || len(distinct(popped)) != 2 {
+		t.Fatalf("SPOP s 2: got %s", replyString(popped))
+	}
+	for _, e := range popped.Array {
+		c.mustDo("0", "SISMEMBER", "s", e.Str)
+	}
+	c.mustDo("3", "SCARD", "s")
+	c.mustDo("(error) ERR value is out of range, must be positive", "SPOP", "s", "-1")
+
+	// 弹出全部元素后键被删除
+	if v := c.do("SPOP", "s", "10"); len(v.Array) != 3 {
+		t.Fatalf("SPOP s 10: got %s", replyString(v))
+	}
+	c.mustDo("0", "SCARD", "s")
+}
+
+// distinct 返回数组回复中不同元素的集合
+func distinct(v *RESPValue) map[string]bool {
+	seen := make(map[string]bool)
+	for _, e := range v.Array {
+		seen[e.Str] = true
+	}
+	return seen
+}
+
+func TestSetAlgebra(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("4", "SADD", "s1", "a", "b", "c", "d")
+	c.mustDo("3", "SADD", "s2", "c", "d", "e")
+	c.mustDo("1", "SADD", "s3", "d")
+	c.mustDoSorted("[d]", "SINTER", "s1", "s2", "s3")
+	c.mustDoSorted("[a b c d e]", "SUNION", "s1", "s2", "s3")
+	c.mustDoSorted("[a b]", "SDIFF", "s1", "s2", "s3")
+	// 不存在的键视为空集合
+	c.mustDo("[]", "SINTER", "s1", "missing")
+	c.mustDoSorted("[c d e]", "SUNION", "missing", "s2")
+	c.mustDoSorted("[a b c d]", "SDIFF", "s1", "missing")
+	c.mustDo("1", "RPUSH", "l", "x")
+	c.mustDo("(error) WRONGTYPE Operation against a key holding the wrong kind of value", "SUNION", "s1", "l")
+}
+
+func TestSetAlgebraStore(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("3", "SADD", "s1", "a", "b", "c")
+	c.mustDo("2", "SADD", "s2", "b", "c")
+	c.mustDo("2", "SINTERSTORE", "dst", "s1", "s2")
+	c.mustDoSorted("[b c]", "SMEMBERS", "dst")
+	c.mustDo("3", "SUNIONSTORE", "dst", "s1", "s2")
+	c.mustDoSorted("[a b c]", "SMEMBERS", "dst")
+
+	// 目标键无论原类型如何都被整体替换
+	c.mustDo("1", "RPUSH", "l", "x")
+	c.mustDo("1", "SDIFFSTORE", "l", "s1", "s2")
+	c.mustDo("[a]", "SMEMBERS", "l")
+
+	// 结果为空时删除目标键
+	c.mustDo("0", "SDIFFSTORE", "dst", "s2", "s1")
+	c.mustDo("0", "SCARD", "dst")
+}
+
+func TestSMove(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("2", "SADD", "src", "a", "b")
+	c.mustDo("1", "SMOVE", "src", "dst", "a")
+	c.mustDo("[b]", "SMEMBERS", "src")
+	c.mustDo("[a]", "SMEMBERS", "dst")
+	c.mustDo("0", "SMOVE", "src", "dst", "x")
+	c.mustDo("1", "SMOVE", "src", "src", "b")
+
+	// 源集合被移空后删除
+	c.mustDo("1", "SMOVE", "src", "dst", "b")
+	c.mustDo("0", "SCARD", "src")
+	c.mustDoSorted("[a b]", "SMEMBERS", "dst")
+
+	c.mustDo("1", "RPUSH", "l", "x")
+	c.mustDo("(error) WRONGTYPE Operation against a key holding the wrong kind of value", "SMOVE", "dst", "l", "a")
+	c.mustDo("2", "SCARD", "dst")
+}
+
+func TestSInterCard(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("4", "SADD", "s1", "a", "b", "c", "d")
+	c.mustDo("3", "SADD", "s2", "b", "c", "d")
+	c.mustDo("3", "SINTERCARD", "2", "s1", "s2")
+	c.mustDo("2", "SINTERCARD", "2", "s1", "s2", "LIMIT", "2")
+	c.mustDo("3", "SINTERCARD", "2", "s1", "s2", "LIMIT", "0")
+	c.mustDo("0", "SINTERCARD", "2", "s1", "missing")
+	c.mustDo("(error) ERR numkeys should be greater than 0", "SINTERCARD", "0", "s1")
+	c.mustDo("(error) ERR Number of keys can't be greater than number of args", "SINTERCARD", "3", "s1", "s2")
+	c.mustDo("(error) ERR LIMIT can't be negative", "SINTERCARD", "1", "s1", "LIMIT", "-1")
+	c.mustDo("(error) ERR syntax error", "SINTERCARD", "1", "s1", "s2")
+}
+
+func TestSetIntsetEncoding(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("3", "SADD", "s", "3", "1", "2")
+	c.mustDo("intset", "OBJECT", "ENCODING", "s")
+	c.mustDoSorted("[1 2 3]", "SMEMBERS", "s")
+	c.mustDo("1", "SISMEMBER", "s", "2")
+	// 非规范的整数表示不能与 intset 中的整数混淆
+	c.mustDo("0", "SISMEMBER", "s", "02")
+	c.mustDo("0", "SREM", "s", "+1")
+
+	// 插入非整数元素后升级为哈希表编码，已有元素保持不变
+	c.mustDo("1", "SADD", "s", "x")
+	c.mustDo("hashtable", "OBJECT", "ENCODING", "s")
+	c.mustDoSorted("[1 2 3 x]", "SMEMBERS", "s")
+	c.mustDo("1", "SREM", "s", "x")
+	c.mustDo("hashtable", "OBJECT", "ENCODING", "s")
+
+	// 超过 setMaxIntsetEntries 个整数后同样升级
+	args := []string{"SADD", "big"}
+	for i := 0; i < setMaxIntsetEntries; i++ {
+		args = append(args, strconv.Itoa(i))
+	}
+	c.mustDo(strconv.Itoa(setMaxIntsetEntries), args...)
+	c.mustDo("intset", "OBJECT", "ENCODING", "big")
+	c.mustDo("1", "SADD", "big", "-1")
+	c.mustDo("hashtable", "OBJECT", "ENCODING", "big")
+	c.mustDo(strconv.Itoa(setMaxIntsetEntries+1), "SCARD", "big")
+	c.mustDo("1", "SISMEMBER", "big", "511")
+	c.mustDo("1", "SISMEMBER", "big", "-1")
+
+	c.mustDo("(nil)", "OBJECT", "ENCODING", "missing")
+	c.mustDo("1", "RPUSH", "l", "a")
+	c.mustDo("quicklist", "OBJECT", "ENCODING", "l")
+}
@@ -0,0 +1,127 @@
+package goredis
+
+import (
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// zsetModel 是按 (score, member) 排序的切片，作为跳表的参照实现
+type zsetModel []zsetEntry
+
+func (m zsetModel) find(member string) int {
+	return slices.IndexFunc(m, func(e zsetEntry) bool { return e.member == member })
+}
+
+func (m *zsetModel) add(member string, score float64) {
+	if i := m.find(member); i >= 0 {
+		*m = slices.Delete(*m, i, i+1)
+	}
+	i, _ := slices.BinarySearchFunc(*m, zsetEntry{member, score}, compareEntries)
+	*m = slices.Insert(*m, i, zsetEntry{member, score})
+}
+
+func compareEntries(a, b zsetEntry) int {
+	switch {
+	case a.score < b.score:
+		return -1
+	case a.score > b.score:
+		return 1
+	}
+	return strings.Compare(a.member, b.member)
+}
+
+// checkZSet 检查跳表的每个节点、排名和反向指针都与参照实现一致
+func checkZSet(t *testing.T, z *ZSet, model zsetModel) {
+	t.Helper()
+	if z.Len() != len(model) || len(z.index) != len(model) || len(z.entries) != len(model) {
+		t.Fatalf("length %d (index %d, entries %d), want %d", z.Len(), len(z.index), len(z.entries), len(model))
+	}
+	if got := z.RangeByRank(0, len(model)-1, false); len(model) > 0 && !slices.Equal(got, model) {
+		t.Fatalf("forward range %v, want %v", got, model)
+	}
+	if len(model) > 0 {
+		reversed := slices.Clone(model)
+		slices.Reverse(reversed)
+		if got := z.RangeByRank(0, len(model)-1, true); !slices.Equal(got, reversed) {
+			t.Fatalf("reverse range %v, want %v", got, reversed)
+		}
+	}
+	for rank, e := range model {
+		if got, ok := z.Rank(e.member); !ok || got != rank {
+			t.Fatalf("Rank(%s) = %d, %v; want %d", e.member, got, ok, rank)
+		}
+		if got := z.At(rank); got != e {
+			t.Fatalf("At(%d) = %v, want %v", rank, got, e)
+		}
+		if score, ok := z.Score(e.member); !ok || score != e.score {
+			t.Fatalf("Score(%s) = %v, %v; want %v", e.member, score, ok, e.score)
+		}
+	}
+}
+
+func TestSkiplistMatchesSortedSliceModel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	z := NewZSet()
+	var model zsetModel
+
+	for i := 0; i < 5000; i++ {
+		member := "m" + strconv.Itoa(r.Intn(300))
+		// 分数取值较少，保证有大量分数相同、按 member 排序的元素
+		score := float64(r.Intn(20))
+		switch op := r.Intn(10); {
+		case op < 6:
+			z.Add(member, score)
+			model.add(member, score)
+		case op < 9:
+			removed := z.Remove(member)
+			j := model.find(member)
+			if removed != (j >= 0) {
+				t.Fatalf("Remove(%s) = %v", member, removed)
+			}
+			if j >= 0 {
+				model = slices.Delete(model, j, j+1)
+			}
+		default:
+			if len(model) == 0 {
+				continue
+			}
+			start := r.Intn(len(model))
+			stop := start + r.Intn(min(10, len(model)-start))
+			if n := z.DeleteRangeByRank(start, stop); n != stop-start+1 {
+				t.Fatalf("DeleteRangeByRank(%d, %d) = %d", start, stop, n)
+			}
+			model = slices.Delete(model, start, stop+1)
+		}
+
+		if i%50 == 0 {
+			checkZSet(t, z, model)
+		}
+		if len(model) == 0 {
+			continue
+		}
+
+		// 随机的排名区间与分数区间
+		start := r.Intn(len(model))
+		stop := start + r.Intn(len(model)-start)
+		if got := z.RangeByRank(start, stop, false); !slices.Equal(got, model[start:stop+1]) {
+			t.Fatalf("RangeByRank(%d, %d) = %v, want %v", start, stop, got, model[start:stop+1])
+		}
+		sr := &zscoreRange{min: float64(r.Intn(20)), max: float64(r.Intn(20)), minex: r.Intn(2) == 0, maxex: r.Intn(2) == 0}
+		lo, hi := z.ScoreRangeRanks(sr)
+		wantLo := slices.IndexFunc(model, func(e zsetEntry) bool { return sr.gteMin(e.score) })
+		if wantLo < 0 {
+			wantLo = len(model)
+		}
+		wantHi := len(model) - 1
+		for wantHi >= 0 && !sr.lteMax(model[wantHi].score) {
+			wantHi--
+		}
+		if lo != wantLo || hi != wantHi {
+			t.Fatalf("ScoreRangeRanks(%+v) = [%d, %d], want [%d, %d]", sr, lo, hi, wantLo, wantHi)
+		}
+	}
+	checkZSet(t, z, model)
+}
@@ -0,0 +1,152 @@
+package goredis
+
+import (
+	"encoding/binary"
+	"io"
+	"maps"
+	"runtime"
+	"sync"
+)
+
+// rdbCowYieldEntries 是后台保存每次让出处理器之间写出的键的数量
+const rdbCowYieldEntries = 128
+
+// rdbCowSnapshot 是后台保存使用的写时复制快照
+//
+// Redis 通过 fork 得到数据集的快照，由操作系统按页写时复制。这里在开始时复制各个数据库的
+// 键值对列表和过期时间，并让快照中的每个对象指向快照：之后删除或整体替换键只改变键空间，不影响快照；
+// 原地修改对象之前，lookupKeyWrite 先调用 preserve 把对象序列化下来，此后对象与快照无关，
+// 只读取对象的命令不需要保存它。
+// 后台 goroutine 按列表的顺序写出每个键，已经保存下来的直接使用，其余的在 mu 的保护下序列化，
+// 因此不需要持有服务器锁，写命令只在修改尚未写出的对象时等待这一个对象序列化完成。
+type rdbCowSnapshot struct {
+	mu        sync.Mutex
+	compress  bool
+	checksum  bool
+	header    []byte
+	dbs       []rdbCowDB
+	preserved map[*RedisObject][]byte
+}
+
+// rdbCowDB 是快照中的一个非空数据库，expires 是开始时各个键的过期时间
+type rdbCowDB struct {
+	id      int
+	entries []keyspaceEntry
+	expires map[string]int64
+}
+
+// newRdbCowSnapshot 取得当前数据集的快照（调用方需持有命令锁和服务器读锁），rsi 见 rdbEncodeHeader
+//
+// 同一时刻只能有一个快照，由 rdbSaving 保证。复制键列表并标记每个对象的耗时与键的数量成正比，
+// 期间命令都要等待，相当于 Redis 中 fork 复制页表的停顿：BenchmarkNewRdbCowSnapshot 测得
+// 每个键约 0.1 微秒，一百万个键约 0.1 秒。
+func (rs *RedisServer) newRdbCowSnapshot(rsi *rdbSaveInfo) *rdbCowSnapshot {
+	s := &rdbCowSnapshot{
+		compress:  rs.rdbCompression,
+		checksum:  rs.rdbChecksum,
+		header:    rs.rdbEncodeHeader(false, rsi).buf,
+		preserved: make(map[*RedisObject][]byte),
+	}
+	for _, db := range rs.databases {
+		if db.store.Len() == 0 {
+			continue
+		}
+		entries := append([]keyspaceEntry(nil), db.store.entries...)
+		for _, entry := range entries {
+			entry.obj.snapshot.Store(s)
+		}
+		s.dbs = append(s.dbs, rdbCowDB{id: db.id, entries: entries, expires: maps.Clone(db.store.expires)})
+	}
+	return s
+}
+
+// preserve 在对象被修改之前把它序列化并保存下来（调用方需持有服务器锁，读锁即可）
+//
+// 保存的是类型和值，写出时再插入键：MOVE 之后对象在另一个数据库中被修改，键名仍然相同。
+func (s *rdbCowSnapshot) preserve(obj *RedisObject) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if obj.snapshot.Load() != s {
+		return
+	}
+	e := &rdbEncoder{buf: []byte{rdbObjectType(obj)}, compress: s.compress}
+	e.appendObject(obj)
+	s.preserved[obj] = e.buf
+	obj.snapshot.Store(nil)
+}
+
+// appendEntry 追加快照中的一个键值对，对象已被保存时使用保存的内容
+func (s *rdbCowSnapshot) appendEntry(e *rdbEncoder, entry keyspaceEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value, ok := s.preserved[entry.obj]; ok {
+		delete(s.preserved, entry.obj)
+		e.buf = append(e.buf, value[0])
+		e.appendString(entry.key)
+		e.buf = append(e.buf, value[1:]...)
+		return
+	}
+	e.appendEntry(entry.key, entry.obj)
+	entry.obj.snapshot.Store(nil)
+}
+
+// writeTo 把快照以 RDB 格式写入 w，校验和在写出的同时计算
+//
+// 写出的键值对从列表中清除，之后被删除的对象可以尽早回收。序列化是 CPU 密集的，
+// 每写出 rdbCowYieldEntries 个键让出一次处理器，CPU 核数较少时命令的延迟不会因此明显增加。
+func (s *rdbCowSnapshot) writeTo(w io.Writer) error {
+	var crc uint64
+	write := func(b []byte) error {
+		if s.checksum {
+			crc = crc64Jones(crc, b)
+		}
+		_, err := w.Write(b)
+		return err
+	}
+
+	if err := write(s.header); err != nil {
+		return err
+	}
+	e := &rdbEncoder{compress: s.compress}
+	for _, db := range s.dbs {
+		e.buf = e.buf[:0]
+		e.appendSelectDB(db.id, len(db.entries), len(db.expires))
+		if err := write(e.buf); err != nil {
+			return err
+		}
+		for i, entry := range db.entries {
+			e.buf = e.buf[:0]
+			if when, ok := db.expires[entry.key]; ok {
+				e.appendExpireTime(when)
+			}
+			s.appendEntry(e, entry)
+			db.entries[i] = keyspaceEntry{}
+			if i%rdbCowYieldEntries == rdbCowYieldEntries-1 {
+				runtime.Gosched()
+			}
+			if err := write(e.buf); err != nil {
+				return err
+			}
+		}
+	}
+	if err := write([]byte{RDB_OPCODE_EOF}); err != nil {
+		return err
+	}
+	_, err := w.Write(binary.LittleEndian.AppendUint64(nil, crc))
+	return err
+}
+
+// release 结束快照，让还没有写出的对象不再指向它，写入失败时也不会留下需要保存的对象
+func (s *rdbCowSnapshot) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, db := range s.dbs {
+		for _, entry := range db.entries {
+			if entry.obj != nil {
+				entry.obj.snapshot.CompareAndSwap(s, nil)
+			}
+		}
+	}
+	s.dbs = nil
+	s.preserved = nil
+}
@@ -0,0 +1,97 @@
+package goredis
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// BenchmarkNewRdbCowSnapshot 测量开始后台保存时取得快照的耗时，这段时间内写命令都要等待
+func BenchmarkNewRdbCowSnapshot(b *testing.B) {
+	for _, keys := range []int{10_000, 100_000, 1_000_000} {
+		b.Run(fmt.Sprintf("keys=%d", keys), func(b *testing.B) {
+			rs := NewRedisServer("127.0.0.1", 0, 16)
+			for i := 0; i < keys; i++ {
+				rs.databases[0].store.Set(fmt.Sprintf("key:%d", i), NewStringObject("value"))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s := rs.newRdbCowSnapshot(nil)
+				b.StopTimer()
+				s.release()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func TestRdbCowSnapshotIsolatesWrites(t *testing.T) {
+	rs := NewRedisServer("127.0.0.1", 0, 16)
+	db := rs.databases[0]
+	list := NewListObject()
+	list.Value.(*List).PushRight("a")
+	db.store.Set("list", list)
+	db.store.Set("str", NewStringObject("old"))
+	db.store.Set("gone", NewStringObject("x"))
+
+	s := rs.newRdbCowSnapshot(nil)
+	defer s.release()
+	// 读取不保存对象，原地修改之前保存，整体替换和删除不影响快照
+	db.lookupList("list")
+	if len(s.preserved) != 0 {
+		t.Fatal("read lookup preserved the object")
+	}
+	l, _ := db.lookupListWrite("list")
+	if len(s.preserved) != 1 {
+		t.Fatalf("%d objects preserved, want 1", len(s.preserved))
+	}
+	l.PushRight("b")
+	db.store.Set("str", NewStringObject("new"))
+	db.store.Delete("gone")
+
+	var buf bytes.Buffer
+	if err := s.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewRedisServer("127.0.0.1", 0, 16)
+	if _, err := loaded.rdbLoad(buf.Bytes(), nil); err != nil {
+		t.Fatal(err)
+	}
+	ldb := loaded.databases[0]
+	if l, _ := ldb.lookupList("list"); l == nil || fmt.Sprint(l.Range(0, l.Len()-1)) != "[a]" {
+		t.Fatalf("snapshot list is %v", l)
+	}
+	if obj, _ := ldb.lookupString("str"); obj == nil || string(obj.Value.([]byte)) != "old" {
+		t.Fatalf("snapshot string is %v", obj)
+	}
+	if obj := ldb.lookupKey("gone"); obj == nil {
+		t.Fatal("key deleted after the snapshot is missing from it")
+	}
+	// 写出之后对象不再属于快照
+	if list.snapshot.Load() != nil || len(s.preserved) != 0 {
+		t.Fatal("objects still attached to the snapshot after it was written")
+	}
+}
+
+func TestBgsaveWhileWriting(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	for i := 0; i < 2000; i++ {
+		c.send("RPUSH", fmt.Sprintf("list:%d", i%100), "x")
+	}
+	for i := 0; i < 2000; i++ {
+		c.read()
+	}
+	c.mustDo("Background saving started", "BGSAVE")
+	// 写出期间修改快照中的对象，快照仍然是 BGSAVE 时的内容
+	for i := 0; i < 100; i++ {
+		c.mustDo("21", "RPUSH", fmt.Sprintf("list:%d", i), "y")
+	}
+	waitFor(t, "BGSAVE to finish", func() bool { return !ts.rs.rdbSaving.Load() })
+
+	restarted := startTestServerIn(t, ts.dir)
+	rc := restarted.connect(t)
+	for i := 0; i < 100; i++ {
+		rc.mustDo("20", "LLEN", fmt.Sprintf("list:%d", i))
+	}
+}
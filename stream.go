@@ -0,0 +1,559 @@
+package goredis
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 每个节点最多保存的条目数量，对应 Redis 的 stream-node-max-entries
+const streamNodeMaxEntries = 100
+
+// streamID 表示流条目的 ID，由毫秒时间戳和同一毫秒内的序号组成
+type streamID struct {
+	ms, seq uint64
+}
+
+// String 返回 ID 的文本形式 <ms>-<seq>
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+// compare 比较两个 ID，返回 -1/0/1
+func (id streamID) compare(other streamID) int {
+	switch {
+	case id.ms < other.ms:
+		return -1
+	case id.ms > other.ms:
+		return 1
+	case id.seq < other.seq:
+		return -1
+	case id.seq > other.seq:
+		return 1
+	}
+	return 0
+}
+
+// incr 返回紧随其后的 ID，已是最大 ID 时 ok 为 false
+func (id streamID) incr() (streamID, bool) {
+	if id.seq < math.MaxUint64 {
+		return streamID{id.ms, id.seq + 1}, true
+	}
+	if id.ms < math.MaxUint64 {
+		return streamID{id.ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// decr 返回紧邻其前的 ID，已是 0-0 时 ok 为 false
+func (id streamID) decr() (streamID, bool) {
+	if id.seq > 0 {
+		return streamID{id.ms, id.seq - 1}, true
+	}
+	if id.ms > 0 {
+		return streamID{id.ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// nextAuto 返回在当前毫秒时间 now 自动生成的、大于 id 的新 ID
+func (id streamID) nextAuto(now uint64) (streamID, bool) {
+	if now > id.ms {
+		return streamID{now, 0}, true
+	}
+	return id.incr()
+}
+
+// parseStreamID 解析形如 <ms>-<seq> 或 <ms> 的 ID，省略序号时使用 missingSeq
+func parseStreamID(str string, missingSeq uint64) (streamID, bool) {
+	msPart, seqPart, hasSeq := strings.Cut(str, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, false
+	}
+	if !hasSeq {
+		return streamID{ms, missingSeq}, true
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return streamID{}, false
+	}
+	return streamID{ms, seq}, true
+}
+
+// streamEntry 表示流中的一个条目，fields 依次保存 field/value
+type streamEntry struct {
+	id     streamID
+	fields []string
+}
+
+// streamNode 是一组按 ID 连续存放的条目，裁剪时可以整个丢弃
+type streamNode struct {
+	entries []streamEntry
+}
+
+// Stream 表示流类型的值
+//
+// 与 Redis 用基数树连接多个 listpack 类似，条目按 ID 升序分组存放在若干节点中，
+// 每个节点最多 streamNodeMaxEntries 个条目。新条目总是追加在末尾，
+// 近似裁剪（~）只丢弃整个节点，无需移动剩余条目。
+type Stream struct {
+	nodes        []*streamNode
+	length       int
+	lastID       streamID
+	entriesAdded uint64
+	cgroups      map[string]*streamCG
+}
+
+// NewStream 创建空流
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+// Len 返回条目数量
+func (s *Stream) Len() int {
+	return s.length
+}
+
+// Append 在末尾追加条目，调用方需保证 id 大于 lastID
+func (s *Stream) Append(id streamID, fields []string) {
+	var node *streamNode
+	if n := len(s.nodes); n > 0 && len(s.nodes[n-1].entries) < streamNodeMaxEntries {
+		node = s.nodes[n-1]
+	} else {
+		node = &streamNode{entries: make([]streamEntry, 0, streamNodeMaxEntries)}
+		s.nodes = append(s.nodes, node)
+	}
+	node.entries = append(node.entries, streamEntry{id, fields})
+	s.length++
+	s.lastID = id
+	s.entriesAdded++
+}
+
+// seek 返回第一个 ID 不小于 id 的条目位置（节点下标，节点内下标），
+// 不存在时节点下标为 len(s.nodes)
+func (s *Stream) seek(id streamID) (int, int) {
+	ni := sort.Search(len(s.nodes), func(i int) bool {
+		entries := s.nodes[i].entries
+		return entries[len(entries)-1].id.compare(id) >= 0
+	})
+	if ni == len(s.nodes) {
+		return ni, 0
+	}
+	entries := s.nodes[ni].entries
+	return ni, sort.Search(len(entries), func(i int) bool { return entries[i].id.compare(id) >= 0 })
+}
+
+// Range 返回 ID 在 [start, end] 内的条目，最多 count 个（负数表示不限制）；
+// reverse 为 true 时从大到小返回
+func (s *Stream) Range(start, end streamID, count int, reverse bool) []streamEntry {
+	result := []streamEntry{}
+	if start.compare(end) > 0 || count == 0 {
+		return result
+	}
+
+	if !reverse {
+		ni, ei := s.seek(start)
+		for ; ni < len(s.nodes); ni, ei = ni+1, 0 {
+			entries := s.nodes[ni].entries
+			for ; ei < len(entries); ei++ {
+				if entries[ei].id.compare(end) > 0 {
+					return result
+				}
+				result = append(result, entries[ei])
+				if len(result) == count {
+					return result
+				}
+			}
+		}
+		return result
+	}
+
+	// 逆序：从第一个大于 end 的位置开始向前遍历
+	ni, ei := len(s.nodes), 0
+	if next, ok := end.incr(); ok {
+		ni, ei = s.seek(next)
+	}
+	for {
+		if ei == 0 {
+			if ni == 0 {
+				return result
+			}
+			ni--
+			ei = len(s.nodes[ni].entries)
+		}
+		ei--
+		entry := s.nodes[ni].entries[ei]
+		if entry.id.compare(start) < 0 {
+			return result
+		}
+		result = append(result, entry)
+		if len(result) == count {
+			return result
+		}
+	}
+}
+
+// Lookup 返回 ID 对应的条目
+func (s *Stream) Lookup(id streamID) (streamEntry, bool) {
+	ni, ei := s.seek(id)
+	if ni == len(s.nodes) || s.nodes[ni].entries[ei].id != id {
+		return streamEntry{}, false
+	}
+	return s.nodes[ni].entries[ei], true
+}
+
+// 裁剪策略
+const (
+	STREAM_TRIM_NONE = iota
+	STREAM_TRIM_MAXLEN
+	STREAM_TRIM_MINID
+)
+
+// streamTrimSpec 表示 MAXLEN/MINID 裁剪参数
+//
+// approx 为 true 时只删除整个节点，结果可能比要求的多保留一些条目；
+// limit 限制一次近似裁剪最多删除的条目数，0 表示不限制。
+type streamTrimSpec struct {
+	strategy int
+	maxlen   int
+	minid    streamID
+	approx   bool
+	limit    int
+}
+
+// Trim 按裁剪参数从头部删除条目，返回删除数量
+func (s *Stream) Trim(spec *streamTrimSpec) int {
+	removed := 0
+	for len(s.nodes) > 0 {
+		node := s.nodes[0]
+		n := len(node.entries)
+
+		var whole bool
+		if spec.strategy == STREAM_TRIM_MAXLEN {
+			whole = s.length-n >= spec.maxlen
+		} else {
+			whole = node.entries[n-1].id.compare(spec.minid) < 0
+		}
+		if whole {
+			if spec.limit > 0 && removed+n > spec.limit {
+				break
+			}
+			s.nodes[0] = nil
+			s.nodes = s.nodes[1:]
+			s.length -= n
+			removed += n
+			continue
+		}
+		if spec.approx {
+			break
+		}
+
+		// 精确裁剪：删除首节点中的一部分条目
+		var k int
+		if spec.strategy == STREAM_TRIM_MAXLEN {
+			k = s.length - spec.maxlen
+		} else {
+			k = sort.Search(n, func(i int) bool { return node.entries[i].id.compare(spec.minid) >= 0 })
+		}
+		if k > 0 {
+			node.entries = node.entries[k:]
+			s.length -= k
+			removed += k
+		}
+		break
+	}
+	return removed
+}
+
+// streamNACK 表示已投递但尚未确认的条目
+type streamNACK struct {
+	deliveryTime  int64
+	deliveryCount int64
+	consumer      *streamConsumer
+}
+
+// streamPEL 是按 ID 有序的待确认条目表（Pending Entries List）
+//
+// 条目保存在 nacks 中，ids 按升序记录 ID。新投递的条目 ID 通常最大，直接追加即可；
+// 删除时只从 nacks 中移除，ids 中失效的 ID 在遍历时跳过，积累过多时再统一压缩。
+type streamPEL struct {
+	nacks map[streamID]*streamNACK
+	ids   []streamID
+}
+
+// newStreamPEL 创建空的待确认条目表
+func newStreamPEL() *streamPEL {
+	return &streamPEL{nacks: make(map[streamID]*streamNACK)}
+}
+
+// Len 返回待确认条目数量
+func (p *streamPEL) Len() int {
+	return len(p.nacks)
+}
+
+// Get 返回 ID 对应的待确认条目，不存在时返回 nil
+func (p *streamPEL) Get(id streamID) *streamNACK {
+	return p.nacks[id]
+}
+
+// Add 添加待确认条目，调用方需保证 ID 不存在
+func (p *streamPEL) Add(id streamID, nack *streamNACK) {
+	p.nacks[id] = nack
+	n := len(p.ids)
+	if n == 0 || p.ids[n-1].compare(id) < 0 {
+		p.ids = append(p.ids, id)
+		return
+	}
+	i := sort.Search(n, func(i int) bool { return p.ids[i].compare(id) >= 0 })
+	if p.ids[i] == id {
+		// 之前删除后残留的失效 ID，重新生效即可
+		return
+	}
+	p.ids = append(p.ids, streamID{})
+	copy(p.ids[i+1:], p.ids[i:])
+	p.ids[i] = id
+}
+
+// Remove 删除待确认条目，返回是否存在
+func (p *streamPEL) Remove(id streamID) bool {
+	if _, ok := p.nacks[id]; !ok {
+		return false
+	}
+	delete(p.nacks, id)
+	if len(p.ids) > 2*len(p.nacks)+32 {
+		ids := make([]streamID, 0, len(p.nacks))
+		for _, id := range p.ids {
+			if _, ok := p.nacks[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		p.ids = ids
+	}
+	return true
+}
+
+// Ascend 按 ID 升序遍历不小于 start 的待确认条目，fn 返回 false 时停止；遍历期间不能修改 PEL
+func (p *streamPEL) Ascend(start streamID, fn func(id streamID, nack *streamNACK) bool) {
+	i := sort.Search(len(p.ids), func(i int) bool { return p.ids[i].compare(start) >= 0 })
+	for ; i < len(p.ids); i++ {
+		nack, ok := p.nacks[p.ids[i]]
+		if !ok {
+			continue
+		}
+		if !fn(p.ids[i], nack) {
+			return
+		}
+	}
+}
+
+// streamConsumer 表示消费者组中的一个消费者
+type streamConsumer struct {
+	name       string
+	seenTime   int64
+	activeTime int64
+	pel        *streamPEL
+}
+
+// entriesRead 未知时的取值
+const streamInvalidEntriesRead = -1
+
+// streamCG 表示一个消费者组
+//
+// lastID 是最后投递给该组的条目 ID；entriesRead 是该组已读取的条目在流的全部历史中的序号，
+// 用于计算 lag，无法确定时为 streamInvalidEntriesRead。pel 记录组内所有已投递未确认的条目，
+// 每个条目同时也出现在所属消费者自己的 pel 中。
+type streamCG struct {
+	lastID      streamID
+	entriesRead int64
+	pel         *streamPEL
+	consumers   map[string]*streamConsumer
+}
+
+// lookupGroup 查找消费者组，不存在时返回 nil
+func (s *Stream) lookupGroup(name string) *streamCG {
+	return s.cgroups[name]
+}
+
+// createGroup 创建消费者组，已存在时返回 nil
+func (s *Stream) createGroup(name string, lastID streamID, entriesRead int64) *streamCG {
+	if _, ok := s.cgroups[name]; ok {
+		return nil
+	}
+	if s.cgroups == nil {
+		s.cgroups = make(map[string]*streamCG)
+	}
+	cg := &streamCG{
+		lastID:      lastID,
+		entriesRead: entriesRead,
+		pel:         newStreamPEL(),
+		consumers:   make(map[string]*streamConsumer),
+	}
+	s.cgroups[name] = cg
+	return cg
+}
+
+// firstEntry 返回第一个条目
+func (s *Stream) firstEntry() (streamEntry, bool) {
+	if s.length == 0 {
+		return streamEntry{}, false
+	}
+	return s.nodes[0].entries[0], true
+}
+
+// lastEntry 返回最后一个条目
+func (s *Stream) lastEntry() (streamEntry, bool) {
+	if s.length == 0 {
+		return streamEntry{}, false
+	}
+	entries := s.nodes[len(s.nodes)-1].entries
+	return entries[len(entries)-1], true
+}
+
+// estimateEntriesRead 估算 id 在流的全部历史中的序号，无法确定时返回 streamInvalidEntriesRead
+//
+// 条目只会从头部被裁剪，所以 id 不小于第一个条目时可以由 entriesAdded 和当前长度推算出来。
+func (s *Stream) estimateEntriesRead(id streamID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	cmpLast := id.compare(s.lastID)
+	if s.length == 0 && cmpLast <= 0 {
+		return int64(s.entriesAdded)
+	}
+	switch {
+	case cmpLast == 0:
+		return int64(s.entriesAdded)
+	case cmpLast > 0:
+		return streamInvalidEntriesRead
+	}
+	first, _ := s.firstEntry()
+	switch id.compare(first.id) {
+	case -1:
+		return int64(s.entriesAdded) - int64(s.length)
+	case 0:
+		return int64(s.entriesAdded) - int64(s.length) + 1
+	}
+	return streamInvalidEntriesRead
+}
+
+// advanceGroup 将条目投递给组后推进组的 lastID 和 entriesRead
+func (s *Stream) advanceGroup(cg *streamCG, id streamID) {
+	cg.lastID = id
+	if cg.entriesRead != streamInvalidEntriesRead {
+		cg.entriesRead++
+	} else if s.entriesAdded > 0 {
+		cg.entriesRead = s.estimateEntriesRead(id)
+	}
+}
+
+// groupLag 返回组尚未读取的条目数量，无法确定时 ok 为 false
+func (s *Stream) groupLag(cg *streamCG) (int64, bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	entriesRead := cg.entriesRead
+	if entriesRead == streamInvalidEntriesRead {
+		entriesRead = s.estimateEntriesRead(cg.lastID)
+		if entriesRead == streamInvalidEntriesRead {
+			return 0, false
+		}
+	}
+	return int64(s.entriesAdded) - entriesRead, true
+}
+
+// groupNames 返回按名称排序的所有消费者组名称
+func (s *Stream) groupNames() []string {
+	names := make([]string, 0, len(s.cgroups))
+	for name := range s.cgroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// consumerNames 返回按名称排序的所有消费者名称
+func (cg *streamCG) consumerNames() []string {
+	names := make([]string, 0, len(cg.consumers))
+	for name := range cg.consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupConsumer 查找消费者，不存在时返回 nil
+func (cg *streamCG) lookupConsumer(name string) *streamConsumer {
+	return cg.consumers[name]
+}
+
+// createConsumer 创建消费者，已存在时返回 nil
+func (cg *streamCG) createConsumer(name string, now int64) *streamConsumer {
+	if _, ok := cg.consumers[name]; ok {
+		return nil
+	}
+	consumer := &streamConsumer{name: name, seenTime: now, activeTime: -1, pel: newStreamPEL()}
+	cg.consumers[name] = consumer
+	return consumer
+}
+
+// lookupOrCreateConsumer 查找消费者，不存在时创建，并更新最近出现时间；created 表示是否新建了消费者
+func (cg *streamCG) lookupOrCreateConsumer(name string, now int64) (consumer *streamConsumer, created bool) {
+	consumer = cg.lookupConsumer(name)
+	if consumer == nil {
+		consumer = cg.createConsumer(name, now)
+		created = true
+	}
+	consumer.seenTime = now
+	return consumer, created
+}
+
+// deleteConsumer 删除消费者及其所有待确认条目，返回被删除的待确认条目数量
+func (cg *streamCG) deleteConsumer(consumer *streamConsumer) int {
+	pending := consumer.pel.Len()
+	consumer.pel.Ascend(streamID{}, func(id streamID, _ *streamNACK) bool {
+		cg.pel.Remove(id)
+		return true
+	})
+	delete(cg.consumers, consumer.name)
+	return pending
+}
+
+// deliver 将条目投递给消费者，记录到组和消费者的待确认条目表中
+//
+// 条目已在组 PEL 中时（例如 SETID 回退后重复投递），转移给新的消费者并重置投递次数。
+func (cg *streamCG) deliver(id streamID, consumer *streamConsumer, now int64) {
+	nack := cg.pel.Get(id)
+	if nack != nil {
+		nack.consumer.pel.Remove(id)
+	} else {
+		nack = &streamNACK{}
+		cg.pel.Add(id, nack)
+	}
+	nack.consumer = consumer
+	nack.deliveryTime = now
+	nack.deliveryCount = 1
+	consumer.pel.Add(id, nack)
+}
+
+// ack 确认条目，将其从组和所属消费者的待确认条目表中删除，返回条目是否处于待确认状态
+func (cg *streamCG) ack(id streamID) bool {
+	nack := cg.pel.Get(id)
+	if nack == nil {
+		return false
+	}
+	cg.pel.Remove(id)
+	nack.consumer.pel.Remove(id)
+	return true
+}
+
+// claim 将待确认条目的所有权转移给消费者
+func (cg *streamCG) claim(id streamID, nack *streamNACK, consumer *streamConsumer) {
+	if nack.consumer == consumer {
+		return
+	}
+	nack.consumer.pel.Remove(id)
+	nack.consumer = consumer
+	consumer.pel.Add(id, nack)
+}
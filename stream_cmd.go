@@ -0,0 +1,1575 @@
+package goredis
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 流命令的错误信息
+const (
+	streamInvalidIDErr = "ERR Invalid stream ID specified as stream command argument"
+	streamAddTooSmall  = "ERR The ID specified in XADD is equal or smaller than the target stream top item"
+)
+
+// parseOption 尝试从 args[i] 开始解析一个 MAXLEN/MINID/LIMIT 选项，
+// 返回消耗的参数个数，0 表示 args[i] 不是裁剪选项
+func (spec *streamTrimSpec) parseOption(args []string, i int) (int, *RESPValue) {
+	opt := strings.ToUpper(args[i])
+	if opt != "MAXLEN" && opt != "MINID" && opt != "LIMIT" {
+		return 0, nil
+	}
+
+	consumed := 1
+	if opt != "LIMIT" && i+1 < len(args) && (args[i+1] == "~" || args[i+1] == "=") {
+		spec.approx = args[i+1] == "~"
+		consumed++
+	}
+	if i+consumed >= len(args) {
+		return 0, NewErrorValue("ERR syntax error")
+	}
+	value := args[i+consumed]
+	consumed++
+
+	switch opt {
+	case "MAXLEN":
+		if spec.strategy == STREAM_TRIM_MINID {
+			return 0, NewErrorValue("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+		}
+		maxlen, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, NewErrorValue("ERR value is not an integer or out of range")
+		}
+		if maxlen < 0 {
+			return 0, NewErrorValue("ERR The MAXLEN argument must be >= 0.")
+		}
+		spec.strategy = STREAM_TRIM_MAXLEN
+		spec.maxlen = maxlen
+	case "MINID":
+		if spec.strategy == STREAM_TRIM_MAXLEN {
+			return 0, NewErrorValue("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+		}
+		minid, ok := parseStreamID(value, 0)
+		if !ok {
+			return 0, NewErrorValue(streamInvalidIDErr)
+		}
+		spec.strategy = STREAM_TRIM_MINID
+		spec.minid = minid
+	case "LIMIT":
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, NewErrorValue("ERR value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return 0, NewErrorValue("ERR The LIMIT argument must be >= 0.")
+		}
+		spec.limit = limit
+	}
+	return consumed, nil
+}
+
+// parseTrimArgs 解析 XADD/XTRIM 中的裁剪选项并检查组合是否合法，
+// 返回第一个不属于裁剪选项的参数位置
+func parseTrimArgs(args []string, i int, spec *streamTrimSpec, other func(opt string) bool) (int, *RESPValue) {
+	spec.limit = -1
+	for ; i < len(args); i++ {
+		if other != nil && other(strings.ToUpper(args[i])) {
+			continue
+		}
+		n, errResp := spec.parseOption(args, i)
+		if errResp != nil {
+			return 0, errResp
+		}
+		if n == 0 {
+			break
+		}
+		i += n - 1
+	}
+
+	if spec.limit >= 0 && !spec.approx {
+		return 0, NewErrorValue("ERR syntax error, LIMIT cannot be used without the special ~ option")
+	}
+	if spec.limit < 0 {
+		spec.limit = 0
+		if spec.approx {
+			spec.limit = 100 * streamNodeMaxEntries
+		}
+	}
+	return i, nil
+}
+
+// handleXAdd 处理 XADD 命令
+func (rs *RedisServer) handleXAdd(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("xadd")
+	}
+
+	noMkStream := false
+	trim := &streamTrimSpec{}
+	i, errResp := parseTrimArgs(args, 1, trim, func(opt string) bool {
+		if opt == "NOMKSTREAM" {
+			noMkStream = true
+			return true
+		}
+		return false
+	})
+	if errResp != nil {
+		return errResp
+	}
+	if i >= len(args) {
+		return wrongArgsError("xadd")
+	}
+	idArg := args[i]
+	fields := args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return wrongArgsError("xadd")
+	}
+
+	// 解析 ID：* 表示自动生成，<ms>-* 表示自动生成序号
+	var id streamID
+	autoID, autoSeq := idArg == "*", false
+	if !autoID {
+		var ok bool
+		if msPart, found := strings.CutSuffix(idArg, "-*"); found {
+			autoSeq = true
+			ms, err := strconv.ParseUint(msPart, 10, 64)
+			id, ok = streamID{ms: ms}, err == nil
+		} else {
+			id, ok = parseStreamID(idArg, 0)
+		}
+		if !ok {
+			return NewErrorValue(streamInvalidIDErr)
+		}
+		if !autoSeq && id.ms == 0 && id.seq == 0 {
+			return NewErrorValue("ERR The ID specified in XADD must be greater than 0-0")
+		}
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	stream, errResp := c.db.lookupStreamWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil && noMkStream {
+		return NewNullBulkStringValue()
+	}
+
+	last := streamID{}
+	if stream != nil {
+		last = stream.lastID
+	}
+	switch {
+	case autoID:
+		var ok bool
+		if id, ok = last.nextAuto(uint64(time.Now().UnixMilli())); !ok {
+			return NewErrorValue("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+	case autoSeq:
+		if id.ms == last.ms {
+			next, ok := last.incr()
+			if !ok || next.ms != id.ms {
+				return NewErrorValue(streamAddTooSmall)
+			}
+			id = next
+		} else if id.ms < last.ms {
+			return NewErrorValue(streamAddTooSmall)
+		}
+	default:
+		if id.compare(last) <= 0 {
+			return NewErrorValue(streamAddTooSmall)
+		}
+	}
+
+	if stream == nil {
+		obj := NewStreamObject()
+		c.db.store.Set(key, obj)
+		stream = obj.Value.(*Stream)
+	}
+	stream.Append(id, append([]string(nil), fields...))
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xadd", key, c.db.id)
+	argv := []string{"XADD", key}
+	if trim.strategy != STREAM_TRIM_NONE {
+		if stream.Trim(trim) > 0 {
+			rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xtrim", key, c.db.id)
+		}
+		argv = append(argv, "MAXLEN", "=", strconv.Itoa(stream.Len()))
+	}
+	// 自动生成的 ID 和近似裁剪的结果在重放时可能不同，传播实际的 ID 和裁剪后的长度
+	c.rewriteArgv(append(append(argv, id.String()), fields...)...)
+	rs.signalKeyAsReady(c.db, key)
+	return NewBulkStringValue(id.String())
+}
+
+// parseStreamRangeID 解析 XRANGE/XREVRANGE 的区间端点
+//
+// - 和 + 分别表示最小和最大 ID，省略序号时起点取 0、终点取最大值，
+// ( 前缀表示开区间，转换为相邻的 ID 后按闭区间处理。
+func parseStreamRangeID(str string, isStart bool) (streamID, *RESPValue) {
+	exclusive := strings.HasPrefix(str, "(")
+	if exclusive {
+		str = str[1:]
+	}
+
+	var id streamID
+	switch str {
+	case "-":
+		id = streamID{}
+	case "+":
+		id = streamID{math.MaxUint64, math.MaxUint64}
+	default:
+		missingSeq := uint64(0)
+		if !isStart {
+			missingSeq = math.MaxUint64
+		}
+		var ok bool
+		if id, ok = parseStreamID(str, missingSeq); !ok {
+			return id, NewErrorValue(streamInvalidIDErr)
+		}
+	}
+	if !exclusive {
+		return id, nil
+	}
+	if str == "-" || str == "+" {
+		return id, NewErrorValue(streamInvalidIDErr)
+	}
+
+	var ok bool
+	if isStart {
+		if id, ok = id.incr(); !ok {
+			return id, NewErrorValue("ERR invalid start ID for the interval")
+		}
+	} else if id, ok = id.decr(); !ok {
+		return id, NewErrorValue("ERR invalid end ID for the interval")
+	}
+	return id, nil
+}
+
+// streamEntryReply 将条目转换为 [id, [field, value, ...]] 形式的响应
+func streamEntryReply(entry streamEntry) *RESPValue {
+	fields := make([]*RESPValue, len(entry.fields))
+	for i, field := range entry.fields {
+		fields[i] = NewBulkStringValue(field)
+	}
+	return NewArrayValue([]*RESPValue{
+		NewBulkStringValue(entry.id.String()),
+		NewArrayValue(fields),
+	})
+}
+
+// streamEntriesReply 将多个条目转换为数组响应
+func streamEntriesReply(entries []streamEntry) *RESPValue {
+	result := make([]*RESPValue, len(entries))
+	for i, entry := range entries {
+		result[i] = streamEntryReply(entry)
+	}
+	return NewArrayValue(result)
+}
+
+// handleXRange 处理 XRANGE/XREVRANGE 命令，XREVRANGE 的参数顺序为 end start
+func (rs *RedisServer) handleXRange(c *client, command *RESPValue, name string, reverse bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 && len(args) != 5 {
+		return wrongArgsError(name)
+	}
+
+	startArg, endArg := args[1], args[2]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, errResp := parseStreamRangeID(startArg, true)
+	if errResp != nil {
+		return errResp
+	}
+	end, errResp := parseStreamRangeID(endArg, false)
+	if errResp != nil {
+		return errResp
+	}
+
+	count := -1
+	if len(args) == 5 {
+		if !strings.EqualFold(args[3], "COUNT") {
+			return NewErrorValue("ERR syntax error")
+		}
+		n, err := strconv.Atoi(args[4])
+		if err != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		count = max(n, 0)
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	stream, errResp := c.db.lookupStream(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return NewArrayValue([]*RESPValue{})
+	}
+	return streamEntriesReply(stream.Range(start, end, count, reverse))
+}
+
+// handleXLen 处理 XLEN 命令
+func (rs *RedisServer) handleXLen(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 {
+		return wrongArgsError("xlen")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	stream, errResp := c.db.lookupStream(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return NewIntegerValue(0)
+	}
+	return NewIntegerValue(int64(stream.Len()))
+}
+
+// handleXTrim 处理 XTRIM 命令
+func (rs *RedisServer) handleXTrim(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 {
+		return wrongArgsError("xtrim")
+	}
+
+	trim := &streamTrimSpec{}
+	i, errResp := parseTrimArgs(args, 1, trim, nil)
+	if errResp != nil {
+		return errResp
+	}
+	if i != len(args) || trim.strategy == STREAM_TRIM_NONE {
+		return NewErrorValue("ERR syntax error")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	stream, errResp := c.db.lookupStreamWrite(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return NewIntegerValue(0)
+	}
+	deleted := stream.Trim(trim)
+	if deleted > 0 {
+		// 近似裁剪的结果取决于条目在节点中的分布，传播裁剪后的长度
+		c.rewriteArgv("XTRIM", args[0], "MAXLEN", "=", strconv.Itoa(stream.Len()))
+		rs.signalModifiedKey(c.db, args[0])
+		rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xtrim", args[0], c.db.id)
+	}
+	return NewIntegerValue(int64(deleted))
+}
+
+// handleXSetID 处理 XSETID key last-id [ENTRIESADDED entries-added] [MAXDELETEDID max-deleted-id] 命令
+//
+// 设置流的最后 ID 和添加过的条目数，AOF 重写用它恢复这些无法由 XADD 重建的状态。
+// 流没有 XDEL，不记录删除过的最大 ID，MAXDELETEDID 只做检查。
+func (rs *RedisServer) handleXSetID(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 && len(args) != 4 && len(args) != 6 {
+		return NewErrorValue("ERR syntax error")
+	}
+	id, ok := parseStreamID(args[1], 0)
+	if !ok {
+		return NewErrorValue(streamInvalidIDErr)
+	}
+	entriesAdded := int64(-1)
+	maxDeleted := streamID{}
+	for i := 2; i < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "ENTRIESADDED":
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return NewErrorValue("ERR value is not an integer or out of range")
+			}
+			if n < 0 {
+				return NewErrorValue("ERR entries_added must be positive")
+			}
+			entriesAdded = n
+		case "MAXDELETEDID":
+			if maxDeleted, ok = parseStreamID(args[i+1], 0); !ok {
+				return NewErrorValue(streamInvalidIDErr)
+			}
+			if id.compare(maxDeleted) < 0 {
+				return NewErrorValue("ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+			}
+		default:
+			return NewErrorValue("ERR syntax error")
+		}
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	stream, errResp := c.db.lookupStreamWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return NewErrorValue("ERR no such key")
+	}
+	if last, ok := stream.lastEntry(); ok && id.compare(last.id) < 0 {
+		return NewErrorValue("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+	if entriesAdded >= 0 && entriesAdded < int64(stream.Len()) {
+		return NewErrorValue("ERR The entries_added specified in XSETID is smaller than the target stream length")
+	}
+	stream.lastID = id
+	if entriesAdded >= 0 {
+		stream.entriesAdded = uint64(entriesAdded)
+	}
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xsetid", key, c.db.id)
+	return NewSimpleStringValue("OK")
+}
+
+// xreadSpec 表示 XREAD/XREADGROUP 的参数，ids 中可能包含尚未解析的特殊 ID $ 或 >
+type xreadSpec struct {
+	count    int
+	blocking bool
+	timeout  time.Duration
+	group    string
+	consumer string
+	noack    bool
+	keys     []string
+	ids      []string
+}
+
+// withoutBlockOption 返回去掉 BLOCK 选项的 XREAD/XREADGROUP 参数
+func withoutBlockOption(argv []string) []string {
+	out := make([]string, 0, len(argv))
+	for i := 0; i < len(argv); i++ {
+		switch strings.ToUpper(argv[i]) {
+		case "STREAMS":
+			return append(out, argv[i:]...)
+		case "BLOCK":
+			i++
+			continue
+		case "GROUP":
+			// 组名和消费者名可能恰好是选项名，原样保留
+			out = append(out, argv[i:min(i+3, len(argv))]...)
+			i += 2
+			continue
+		}
+		out = append(out, argv[i])
+	}
+	return out
+}
+
+// parseXReadArgs 解析 XREAD 的参数：[COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]，
+// xreadgroup 为 true 时还需要 GROUP group consumer，并支持 NOACK
+func parseXReadArgs(args []string, xreadgroup bool) (*xreadSpec, *RESPValue) {
+	spec := &xreadSpec{count: -1}
+	i := 0
+parseOptions:
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == "STREAMS":
+			break parseOptions
+		case (opt == "COUNT" || opt == "BLOCK") && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			switch {
+			case opt == "BLOCK" && err != nil:
+				return nil, NewErrorValue("ERR timeout is not an integer or out of range")
+			case opt == "BLOCK" && n < 0:
+				return nil, NewErrorValue("ERR timeout is negative")
+			case opt == "BLOCK":
+				spec.blocking = true
+				spec.timeout = time.Duration(n) * time.Millisecond
+			case err != nil:
+				return nil, NewErrorValue("ERR value is not an integer or out of range")
+			case n > 0:
+				spec.count = int(n)
+			}
+			i++
+		case opt == "GROUP" && i+2 < len(args):
+			if !xreadgroup {
+				return nil, NewErrorValue("ERR The GROUP option is only supported by XREADGROUP. You called XREAD instead.")
+			}
+			spec.group, spec.consumer = args[i+1], args[i+2]
+			i += 2
+		case opt == "NOACK" && xreadgroup:
+			spec.noack = true
+		default:
+			return nil, NewErrorValue("ERR syntax error")
+		}
+	}
+	if i >= len(args) {
+		return nil, NewErrorValue("ERR syntax error")
+	}
+	if xreadgroup && spec.group == "" {
+		return nil, NewErrorValue("ERR Missing GROUP option for XREADGROUP")
+	}
+
+	streams := args[i+1:]
+	if len(streams) == 0 || len(streams)%2 != 0 {
+		if xreadgroup {
+			return nil, NewErrorValue("ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.")
+		}
+		return nil, NewErrorValue("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+	half := len(streams) / 2
+	spec.keys, spec.ids = streams[:half], streams[half:]
+	for _, id := range spec.ids {
+		switch {
+		case id == "$" && xreadgroup:
+			return nil, NewErrorValue("ERR The $ ID is meaningful only for XREAD command")
+		case id == ">" && !xreadgroup:
+			return nil, NewErrorValue("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		case id == "$" || id == ">":
+			continue
+		}
+		if _, ok := parseStreamID(id, 0); !ok {
+			return nil, NewErrorValue(streamInvalidIDErr)
+		}
+	}
+	return spec, nil
+}
+
+// resolveXReadIDs 将 XREAD 的 ID 参数解析为具体 ID，$ 表示流当前的最后一个 ID（调用方需持有锁）
+func (rs *RedisServer) resolveXReadIDs(c *client, spec *xreadSpec) ([]streamID, *RESPValue) {
+	ids := make([]streamID, len(spec.keys))
+	for i, key := range spec.keys {
+		stream, errResp := c.db.lookupStream(key)
+		if errResp != nil {
+			return nil, errResp
+		}
+		if spec.ids[i] == "$" {
+			if stream != nil {
+				ids[i] = stream.lastID
+			}
+			continue
+		}
+		ids[i], _ = parseStreamID(spec.ids[i], 0)
+	}
+	return ids, nil
+}
+
+// xread 读取各个流中 ID 大于 ids 的条目，没有任何新条目时返回 nil（调用方需持有锁）
+func (rs *RedisServer) xread(c *client, keys []string, ids []streamID, count int) *RESPValue {
+	var result []*RESPValue
+	for i, key := range keys {
+		stream, _ := c.db.lookupStream(key)
+		if stream == nil {
+			continue
+		}
+		start, ok := ids[i].incr()
+		if !ok {
+			continue
+		}
+		entries := stream.Range(start, streamID{math.MaxUint64, math.MaxUint64}, count, false)
+		if len(entries) == 0 {
+			continue
+		}
+		result = append(result, NewArrayValue([]*RESPValue{
+			NewBulkStringValue(key),
+			streamEntriesReply(entries),
+		}))
+	}
+	if result == nil {
+		return nil
+	}
+	return NewArrayValue(result)
+}
+
+// handleXRead 处理 XREAD 命令
+func (rs *RedisServer) handleXRead(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 {
+		return wrongArgsError("xread")
+	}
+
+	spec, errResp := parseXReadArgs(args, false)
+	if errResp != nil {
+		return errResp
+	}
+
+	if spec.blocking {
+		// $ 在开始阻塞时解析一次，之后只等待比它更新的条目
+		var ids []streamID
+		return rs.blockForKeys(c, spec.keys, spec.timeout, func() *RESPValue {
+			if ids == nil {
+				var errResp *RESPValue
+				if ids, errResp = rs.resolveXReadIDs(c, spec); errResp != nil {
+					return errResp
+				}
+			}
+			return rs.xread(c, spec.keys, ids, spec.count)
+		})
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	ids, errResp := rs.resolveXReadIDs(c, spec)
+	if errResp != nil {
+		return errResp
+	}
+	if reply := rs.xread(c, spec.keys, ids, spec.count); reply != nil {
+		return reply
+	}
+	return NewNullArrayValue()
+}
+
+// streamKeyMustExistErr 是 XGROUP 子命令作用于不存在的键时的错误信息
+const streamKeyMustExistErr = "ERR The XGROUP subcommand requires the key to exist. " +
+	"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."
+
+// noGroupError 返回消费者组不存在的错误
+func noGroupError(key, group string) *RESPValue {
+	return NewErrorValue("NOGROUP No such consumer group '" + group + "' for key name '" + key + "'")
+}
+
+// handleXGroup 处理 XGROUP 命令，支持 CREATE/SETID/DESTROY/CREATECONSUMER/DELCONSUMER 子命令
+func (rs *RedisServer) handleXGroup(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("xgroup")
+	}
+
+	sub := strings.ToUpper(args[0])
+	var arityOK bool
+	switch sub {
+	case "CREATE":
+		arityOK = len(args) >= 4 && len(args) <= 7
+	case "SETID":
+		arityOK = len(args) == 4 || len(args) == 6
+	case "CREATECONSUMER", "DELCONSUMER":
+		arityOK = len(args) == 4
+	case "DESTROY":
+		arityOK = len(args) == 3
+	}
+	if !arityOK {
+		return NewErrorValue("ERR unknown subcommand or wrong number of arguments for '" + args[0] + "'. Try XGROUP HELP.")
+	}
+
+	key, groupName := args[1], args[2]
+	var id streamID
+	mkStream := false
+	entriesRead := int64(streamInvalidEntriesRead)
+	if sub == "CREATE" || sub == "SETID" {
+		if args[3] != "$" {
+			var ok bool
+			if id, ok = parseStreamID(args[3], 0); !ok {
+				return NewErrorValue(streamInvalidIDErr)
+			}
+		}
+		for i := 4; i < len(args); i++ {
+			opt := strings.ToUpper(args[i])
+			switch {
+			case opt == "MKSTREAM" && sub == "CREATE":
+				mkStream = true
+			case opt == "ENTRIESREAD" && i+1 < len(args):
+				n, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil {
+					return NewErrorValue("ERR value is not an integer or out of range")
+				}
+				if n < 0 && n != streamInvalidEntriesRead {
+					return NewErrorValue("ERR value for ENTRIESREAD must be positive or -1")
+				}
+				entriesRead = n
+				i++
+			default:
+				return NewErrorValue("ERR syntax error")
+			}
+		}
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	stream, errResp := c.db.lookupStreamWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		if !mkStream {
+			return NewErrorValue(streamKeyMustExistErr)
+		}
+		obj := NewStreamObject()
+		c.db.store.Set(key, obj)
+		stream = obj.Value.(*Stream)
+	}
+	if (sub == "CREATE" || sub == "SETID") && args[3] == "$" {
+		id = stream.lastID
+	}
+
+	if sub == "CREATE" {
+		if stream.createGroup(groupName, id, entriesRead) == nil {
+			return NewErrorValue("BUSYGROUP Consumer Group name already exists")
+		}
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xgroup-create", key, c.db.id)
+		return NewSimpleStringValue("OK")
+	}
+
+	group := stream.lookupGroup(groupName)
+	if group == nil {
+		if sub == "DESTROY" {
+			return NewIntegerValue(0)
+		}
+		return noGroupError(key, groupName)
+	}
+
+	switch sub {
+	case "SETID":
+		group.lastID = id
+		group.entriesRead = entriesRead
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xgroup-setid", key, c.db.id)
+		return NewSimpleStringValue("OK")
+	case "DESTROY":
+		delete(stream.cgroups, groupName)
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xgroup-destroy", key, c.db.id)
+		// 唤醒阻塞在该组上的 XREADGROUP，让它们返回错误
+		rs.signalKeyAsReady(c.db, key)
+		return NewIntegerValue(1)
+	case "CREATECONSUMER":
+		if group.createConsumer(args[3], time.Now().UnixMilli()) == nil {
+			return NewIntegerValue(0)
+		}
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xgroup-createconsumer", key, c.db.id)
+		return NewIntegerValue(1)
+	default: // DELCONSUMER
+		consumer := group.lookupConsumer(args[3])
+		if consumer == nil {
+			return NewIntegerValue(0)
+		}
+		pending := group.deleteConsumer(consumer)
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xgroup-delconsumer", key, c.db.id)
+		return NewIntegerValue(int64(pending))
+	}
+}
+
+// xreadGroup 以消费者组的身份读取各个流（调用方需持有写锁）
+//
+// ID 为 > 时投递组内尚未投递过的新条目，并记入待确认条目表（NOACK 时除外）；
+// 其他 ID 表示读取该消费者自己的待确认条目历史，已被删除的条目以 null 代替字段。
+// 所有流都没有新条目且没有历史读取时返回 nil。
+func (rs *RedisServer) xreadGroup(c *client, spec *xreadSpec) *RESPValue {
+	now := time.Now().UnixMilli()
+	var result []*RESPValue
+	for i, key := range spec.keys {
+		stream, errResp := c.db.lookupStreamWrite(key)
+		if errResp != nil {
+			return errResp
+		}
+		var group *streamCG
+		if stream != nil {
+			group = stream.lookupGroup(spec.group)
+		}
+		if group == nil {
+			return NewErrorValue("NOGROUP No such key '" + key + "' or consumer group '" + spec.group + "' in XREADGROUP with GROUP option")
+		}
+		consumer, created := group.lookupOrCreateConsumer(spec.consumer, now)
+		if created {
+			rs.signalModifiedKey(c.db, key)
+			rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xgroup-createconsumer", key, c.db.id)
+		}
+
+		var replies []*RESPValue
+		if spec.ids[i] == ">" {
+			start, ok := group.lastID.incr()
+			if !ok {
+				continue
+			}
+			entries := stream.Range(start, streamID{math.MaxUint64, math.MaxUint64}, spec.count, false)
+			if len(entries) == 0 {
+				continue
+			}
+			for _, entry := range entries {
+				stream.advanceGroup(group, entry.id)
+				if !spec.noack {
+					group.deliver(entry.id, consumer, now)
+				}
+				replies = append(replies, streamEntryReply(entry))
+			}
+			consumer.activeTime = now
+			rs.dirty.Add(1)
+		} else {
+			id, _ := parseStreamID(spec.ids[i], 0)
+			replies = []*RESPValue{}
+			if start, ok := id.incr(); ok {
+				consumer.pel.Ascend(start, func(id streamID, nack *streamNACK) bool {
+					if entry, ok := stream.Lookup(id); ok {
+						nack.deliveryTime = now
+						nack.deliveryCount++
+						rs.dirty.Add(1)
+						replies = append(replies, streamEntryReply(entry))
+					} else {
+						replies = append(replies, NewArrayValue([]*RESPValue{
+							NewBulkStringValue(id.String()),
+							NewNullArrayValue(),
+						}))
+					}
+					return len(replies) != spec.count
+				})
+			}
+		}
+		result = append(result, NewArrayValue([]*RESPValue{
+			NewBulkStringValue(key),
+			NewArrayValue(replies),
+		}))
+	}
+	if result == nil {
+		return nil
+	}
+	return NewArrayValue(result)
+}
+
+// handleXReadGroup 处理 XREADGROUP 命令
+func (rs *RedisServer) handleXReadGroup(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 6 {
+		return wrongArgsError("xreadgroup")
+	}
+
+	spec, errResp := parseXReadArgs(args, true)
+	if errResp != nil {
+		return errResp
+	}
+
+	if spec.blocking {
+		// 去掉 BLOCK 选项传播，重放时不会阻塞
+		c.rewriteArgv(withoutBlockOption(c.propagateArgv())...)
+		return rs.blockForKeys(c, spec.keys, spec.timeout, func() *RESPValue {
+			return rs.xreadGroup(c, spec)
+		})
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if reply := rs.xreadGroup(c, spec); reply != nil {
+		return reply
+	}
+	return NewNullArrayValue()
+}
+
+// handleXAck 处理 XACK 命令
+func (rs *RedisServer) handleXAck(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 {
+		return wrongArgsError("xack")
+	}
+
+	ids := make([]streamID, len(args)-2)
+	for i, arg := range args[2:] {
+		var ok bool
+		if ids[i], ok = parseStreamID(arg, 0); !ok {
+			return NewErrorValue(streamInvalidIDErr)
+		}
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	stream, errResp := c.db.lookupStreamWrite(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return NewIntegerValue(0)
+	}
+	group := stream.lookupGroup(args[1])
+	if group == nil {
+		return NewIntegerValue(0)
+	}
+
+	acked := 0
+	for _, id := range ids {
+		if group.ack(id) {
+			acked++
+		}
+	}
+	rs.dirty.Add(int64(acked))
+	return NewIntegerValue(int64(acked))
+}
+
+// noKeyOrGroupError 返回键或消费者组不存在的错误
+func noKeyOrGroupError(key, group string) *RESPValue {
+	return NewErrorValue("NOGROUP No such key '" + key + "' or consumer group '" + group + "'")
+}
+
+// lookupStreamGroup 查找流及其消费者组，键或组不存在时返回 NOGROUP 错误（调用方需持有锁）
+func (db *redisDb) lookupStreamGroup(key, groupName string) (*Stream, *streamCG, *RESPValue) {
+	stream, errResp := db.lookupStream(key)
+	if errResp != nil {
+		return nil, nil, errResp
+	}
+	if stream == nil {
+		return nil, nil, noKeyOrGroupError(key, groupName)
+	}
+	group := stream.lookupGroup(groupName)
+	if group == nil {
+		return nil, nil, noKeyOrGroupError(key, groupName)
+	}
+	return stream, group, nil
+}
+
+// lookupStreamGroupWrite 与 lookupStreamGroup 相同，用于原地修改流及其消费者组（调用方需持有写锁）
+func (db *redisDb) lookupStreamGroupWrite(key, groupName string) (*Stream, *streamCG, *RESPValue) {
+	db.lookupKeyWrite(key)
+	return db.lookupStreamGroup(key, groupName)
+}
+
+// handleXPending 处理 XPENDING 命令
+//
+// 只给出 key 和 group 时返回摘要：待确认数量、最小和最大 ID 以及每个消费者的待确认数量；
+// 给出范围时返回每个条目的 ID、所属消费者、空闲毫秒数和投递次数。
+func (rs *RedisServer) handleXPending(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("xpending")
+	}
+
+	key, groupName := args[0], args[1]
+	extended := len(args) > 2
+	var minIdle int64
+	var start, end streamID
+	count := 0
+	consumerName := ""
+	if extended {
+		rest := args[2:]
+		if strings.EqualFold(rest[0], "IDLE") && len(rest) >= 2 {
+			var err error
+			if minIdle, err = strconv.ParseInt(rest[1], 10, 64); err != nil {
+				return NewErrorValue("ERR value is not an integer or out of range")
+			}
+			rest = rest[2:]
+		}
+		if len(rest) != 3 && len(rest) != 4 {
+			return NewErrorValue("ERR syntax error")
+		}
+		if start, errResp = parseStreamRangeID(rest[0], true); errResp != nil {
+			return errResp
+		}
+		if end, errResp = parseStreamRangeID(rest[1], false); errResp != nil {
+			return errResp
+		}
+		n, err := strconv.Atoi(rest[2])
+		if err != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		count = max(n, 0)
+		if len(rest) == 4 {
+			consumerName = rest[3]
+		}
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	_, group, errResp := c.db.lookupStreamGroup(key, groupName)
+	if errResp != nil {
+		return errResp
+	}
+
+	if !extended {
+		if group.pel.Len() == 0 {
+			return NewArrayValue([]*RESPValue{
+				NewIntegerValue(0),
+				NewNullBulkStringValue(),
+				NewNullBulkStringValue(),
+				NewNullArrayValue(),
+			})
+		}
+		var first, last streamID
+		group.pel.Ascend(streamID{}, func(id streamID, _ *streamNACK) bool {
+			first = id
+			return false
+		})
+		counts := make(map[string]int)
+		group.pel.Ascend(streamID{}, func(id streamID, nack *streamNACK) bool {
+			last = id
+			counts[nack.consumer.name]++
+			return true
+		})
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		consumers := make([]*RESPValue, len(names))
+		for i, name := range names {
+			consumers[i] = NewArrayValue([]*RESPValue{
+				NewBulkStringValue(name),
+				NewBulkStringValue(strconv.Itoa(counts[name])),
+			})
+		}
+		return NewArrayValue([]*RESPValue{
+			NewIntegerValue(int64(group.pel.Len())),
+			NewBulkStringValue(first.String()),
+			NewBulkStringValue(last.String()),
+			NewArrayValue(consumers),
+		})
+	}
+
+	pel := group.pel
+	if consumerName != "" {
+		consumer := group.lookupConsumer(consumerName)
+		if consumer == nil {
+			return NewArrayValue([]*RESPValue{})
+		}
+		pel = consumer.pel
+	}
+
+	now := time.Now().UnixMilli()
+	result := []*RESPValue{}
+	if count == 0 || start.compare(end) > 0 {
+		return NewArrayValue(result)
+	}
+	pel.Ascend(start, func(id streamID, nack *streamNACK) bool {
+		if id.compare(end) > 0 {
+			return false
+		}
+		idle := now - nack.deliveryTime
+		if idle < minIdle {
+			return true
+		}
+		result = append(result, NewArrayValue([]*RESPValue{
+			NewBulkStringValue(id.String()),
+			NewBulkStringValue(nack.consumer.name),
+			NewIntegerValue(idle),
+			NewIntegerValue(nack.deliveryCount),
+		}))
+		return len(result) < count
+	})
+	return NewArrayValue(result)
+}
+
+// handleXClaim 处理 XCLAIM 命令
+func (rs *RedisServer) handleXClaim(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 5 {
+		return wrongArgsError("xclaim")
+	}
+
+	key, groupName, consumerName := args[0], args[1], args[2]
+	minIdle, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return NewErrorValue("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	minIdle = max(minIdle, 0)
+
+	// 先解析 ID 列表，遇到第一个不是 ID 的参数后开始解析选项
+	var ids []streamID
+	i := 4
+	for ; i < len(args); i++ {
+		id, ok := parseStreamID(args[i], 0)
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return NewErrorValue(streamInvalidIDErr)
+	}
+
+	now := time.Now().UnixMilli()
+	deliveryTime := now
+	retryCount := int64(-1)
+	force, justID := false, false
+	var lastID *streamID
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		hasValue := i+1 < len(args)
+		switch {
+		case opt == "FORCE":
+			force = true
+		case opt == "JUSTID":
+			justID = true
+		case opt == "IDLE" && hasValue:
+			idle, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return NewErrorValue("ERR Invalid IDLE option argument for XCLAIM")
+			}
+			deliveryTime = now - idle
+			i++
+		case opt == "TIME" && hasValue:
+			t, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return NewErrorValue("ERR Invalid TIME option argument for XCLAIM")
+			}
+			deliveryTime = t
+			i++
+		case opt == "RETRYCOUNT" && hasValue:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return NewErrorValue("ERR Invalid RETRYCOUNT option argument for XCLAIM")
+			}
+			retryCount = n
+			i++
+		case opt == "LASTID" && hasValue:
+			id, ok := parseStreamID(args[i+1], 0)
+			if !ok {
+				return NewErrorValue(streamInvalidIDErr)
+			}
+			lastID = &id
+			i++
+		default:
+			return NewErrorValue("ERR Unrecognized XCLAIM option '" + args[i] + "'")
+		}
+	}
+	// 投递时间不能晚于当前时间
+	deliveryTime = min(deliveryTime, now)
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	stream, group, errResp := c.db.lookupStreamGroupWrite(key, groupName)
+	if errResp != nil {
+		return errResp
+	}
+	// 认领与当前时间和空闲时间有关，传播为逐个条目的 XCLAIM FORCE JUSTID 等确定的命令
+	c.preventPropagation()
+	lastIDChanged := lastID != nil && lastID.compare(group.lastID) > 0
+	if lastIDChanged {
+		group.lastID = *lastID
+		rs.dirty.Add(1)
+	}
+
+	consumer, created := group.lookupOrCreateConsumer(consumerName, now)
+	if created {
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xgroup-createconsumer", key, c.db.id)
+		rs.alsoPropagate(c.db.id, []string{"XGROUP", "CREATECONSUMER", key, groupName, consumerName})
+	}
+	propagated := false
+	result := []*RESPValue{}
+	for _, id := range ids {
+		nack := group.pel.Get(id)
+		entry, exists := stream.Lookup(id)
+		if nack == nil {
+			// FORCE 时为仍存在于流中的条目创建待确认记录
+			if !force || !exists {
+				continue
+			}
+			nack = &streamNACK{consumer: consumer, deliveryTime: now}
+			group.pel.Add(id, nack)
+			consumer.pel.Add(id, nack)
+		}
+		if !exists {
+			// 条目已被删除，直接从待确认条目表中移除
+			group.ack(id)
+			rs.dirty.Add(1)
+			rs.alsoPropagate(c.db.id, []string{"XACK", key, groupName, id.String()})
+			continue
+		}
+		if minIdle > 0 && now-nack.deliveryTime < minIdle {
+			continue
+		}
+
+		group.claim(id, nack, consumer)
+		nack.deliveryTime = deliveryTime
+		if retryCount >= 0 {
+			nack.deliveryCount = retryCount
+		} else if !justID {
+			nack.deliveryCount++
+		}
+		consumer.activeTime = now
+		rs.dirty.Add(1)
+		rs.streamPropagateXClaim(c, key, groupName, group, id, nack)
+		propagated = true
+
+		if justID {
+			result = append(result, NewBulkStringValue(id.String()))
+		} else {
+			result = append(result, streamEntryReply(entry))
+		}
+	}
+	// 没有认领任何条目时单独传播 LASTID 的修改，否则它已经包含在 XCLAIM 中
+	if lastIDChanged && !propagated {
+		rs.alsoPropagate(c.db.id, []string{"XGROUP", "SETID", key, groupName, group.lastID.String(),
+			"ENTRIESREAD", strconv.FormatInt(group.entriesRead, 10)})
+	}
+	return NewArrayValue(result)
+}
+
+// streamPropagateXClaim 把一个待确认条目的当前状态传播为 XCLAIM ... FORCE JUSTID，
+// 重放时直接设置条目的所属消费者、投递时间和投递次数，并带上组的最后投递 ID（调用方需持有写锁）
+func (rs *RedisServer) streamPropagateXClaim(c *client, key, groupName string, group *streamCG, id streamID, nack *streamNACK) {
+	rs.alsoPropagate(c.db.id, []string{"XCLAIM", key, groupName, nack.consumer.name, "0", id.String(),
+		"TIME", strconv.FormatInt(nack.deliveryTime, 10),
+		"RETRYCOUNT", strconv.FormatInt(nack.deliveryCount, 10),
+		"FORCE", "JUSTID", "LASTID", group.lastID.String()})
+}
+
+// handleXAutoClaim 处理 XAUTOCLAIM 命令
+//
+// 从 start 开始扫描组的待确认条目表，把空闲时间足够长的条目转移给指定消费者，
+// 最多扫描 count*10 个条目。返回下一次扫描的起点（0-0 表示已扫描完）、
+// 认领到的条目以及已从流中删除而被移出待确认条目表的 ID。
+func (rs *RedisServer) handleXAutoClaim(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 5 {
+		return wrongArgsError("xautoclaim")
+	}
+
+	key, groupName, consumerName := args[0], args[1], args[2]
+	minIdle, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return NewErrorValue("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	minIdle = max(minIdle, 0)
+	start, errResp := parseStreamRangeID(args[4], true)
+	if errResp != nil {
+		return errResp
+	}
+
+	count := 100
+	justID := false
+	for i := 5; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == "JUSTID":
+			justID = true
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return NewErrorValue("ERR value is not an integer or out of range")
+			}
+			if n < 1 || n > math.MaxInt32 {
+				return NewErrorValue("ERR COUNT must be > 0")
+			}
+			count = n
+			i++
+		default:
+			return NewErrorValue("ERR syntax error")
+		}
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	stream, group, errResp := c.db.lookupStreamGroupWrite(key, groupName)
+	if errResp != nil {
+		return errResp
+	}
+
+	// 先收集待扫描的条目，处理时会修改组的待确认条目表
+	type pending struct {
+		id   streamID
+		nack *streamNACK
+	}
+	var scanned []pending
+	next := streamID{}
+	group.pel.Ascend(start, func(id streamID, nack *streamNACK) bool {
+		if len(scanned) == count*10 {
+			next = id
+			return false
+		}
+		scanned = append(scanned, pending{id, nack})
+		return true
+	})
+
+	// 与 XCLAIM 一样传播为逐个条目的确定的命令
+	c.preventPropagation()
+	now := time.Now().UnixMilli()
+	consumer, created := group.lookupOrCreateConsumer(consumerName, now)
+	if created {
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_STREAM, "xgroup-createconsumer", key, c.db.id)
+		rs.alsoPropagate(c.db.id, []string{"XGROUP", "CREATECONSUMER", key, groupName, consumerName})
+	}
+	claimed := []*RESPValue{}
+	deleted := []*RESPValue{}
+	for _, p := range scanned {
+		if len(claimed) == count {
+			next = p.id
+			break
+		}
+		entry, exists := stream.Lookup(p.id)
+		if !exists {
+			group.ack(p.id)
+			rs.dirty.Add(1)
+			rs.alsoPropagate(c.db.id, []string{"XACK", key, groupName, p.id.String()})
+			deleted = append(deleted, NewBulkStringValue(p.id.String()))
+			continue
+		}
+		if minIdle > 0 && now-p.nack.deliveryTime < minIdle {
+			continue
+		}
+
+		group.claim(p.id, p.nack, consumer)
+		p.nack.deliveryTime = now
+		if !justID {
+			p.nack.deliveryCount++
+		}
+		consumer.activeTime = now
+		rs.dirty.Add(1)
+		rs.streamPropagateXClaim(c, key, groupName, group, p.id, p.nack)
+
+		if justID {
+			claimed = append(claimed, NewBulkStringValue(p.id.String()))
+		} else {
+			claimed = append(claimed, streamEntryReply(entry))
+		}
+	}
+
+	return NewArrayValue([]*RESPValue{
+		NewBulkStringValue(next.String()),
+		NewArrayValue(claimed),
+		NewArrayValue(deleted),
+	})
+}
+
+// entriesReadReply 返回组的 entries-read 字段，未知时为 null
+func entriesReadReply(cg *streamCG) *RESPValue {
+	if cg.entriesRead == streamInvalidEntriesRead {
+		return NewNullBulkStringValue()
+	}
+	return NewIntegerValue(cg.entriesRead)
+}
+
+// groupLagReply 返回组的 lag 字段，无法计算时为 null
+func groupLagReply(stream *Stream, cg *streamCG) *RESPValue {
+	lag, ok := stream.groupLag(cg)
+	if !ok {
+		return NewNullBulkStringValue()
+	}
+	return NewIntegerValue(lag)
+}
+
+// xinfoStream 构造 XINFO STREAM 的响应，full 为 true 时包含条目、消费者组和待确认条目的明细，
+// count 限制各个明细列表的长度（0 表示不限制）
+func xinfoStream(stream *Stream, full bool, count int) *RESPValue {
+	recordedFirstID := streamID{}
+	if first, ok := stream.firstEntry(); ok {
+		recordedFirstID = first.id
+	}
+	reply := []*RESPValue{
+		NewBulkStringValue("length"), NewIntegerValue(int64(stream.Len())),
+		NewBulkStringValue("radix-tree-keys"), NewIntegerValue(int64(len(stream.nodes))),
+		NewBulkStringValue("last-generated-id"), NewBulkStringValue(stream.lastID.String()),
+		NewBulkStringValue("max-deleted-entry-id"), NewBulkStringValue(streamID{}.String()),
+		NewBulkStringValue("entries-added"), NewIntegerValue(int64(stream.entriesAdded)),
+		NewBulkStringValue("recorded-first-entry-id"), NewBulkStringValue(recordedFirstID.String()),
+	}
+
+	if !full {
+		firstEntry, lastEntry := NewNullBulkStringValue(), NewNullBulkStringValue()
+		if first, ok := stream.firstEntry(); ok {
+			firstEntry = streamEntryReply(first)
+		}
+		if last, ok := stream.lastEntry(); ok {
+			lastEntry = streamEntryReply(last)
+		}
+		return NewArrayValue(append(reply,
+			NewBulkStringValue("groups"), NewIntegerValue(int64(len(stream.cgroups))),
+			NewBulkStringValue("first-entry"), firstEntry,
+			NewBulkStringValue("last-entry"), lastEntry,
+		))
+	}
+
+	limit := count
+	if limit == 0 {
+		limit = -1
+	}
+	entries := stream.Range(streamID{}, streamID{math.MaxUint64, math.MaxUint64}, limit, false)
+
+	groups := make([]*RESPValue, 0, len(stream.cgroups))
+	for _, name := range stream.groupNames() {
+		cg := stream.cgroups[name]
+
+		pending := []*RESPValue{}
+		cg.pel.Ascend(streamID{}, func(id streamID, nack *streamNACK) bool {
+			pending = append(pending, NewArrayValue([]*RESPValue{
+				NewBulkStringValue(id.String()),
+				NewBulkStringValue(nack.consumer.name),
+				NewIntegerValue(nack.deliveryTime),
+				NewIntegerValue(nack.deliveryCount),
+			}))
+			return len(pending) != count
+		})
+
+		consumers := make([]*RESPValue, 0, len(cg.consumers))
+		for _, consumerName := range cg.consumerNames() {
+			consumer := cg.consumers[consumerName]
+			consumerPending := []*RESPValue{}
+			consumer.pel.Ascend(streamID{}, func(id streamID, nack *streamNACK) bool {
+				consumerPending = append(consumerPending, NewArrayValue([]*RESPValue{
+					NewBulkStringValue(id.String()),
+					NewIntegerValue(nack.deliveryTime),
+					NewIntegerValue(nack.deliveryCount),
+				}))
+				return len(consumerPending) != count
+			})
+			consumers = append(consumers, NewArrayValue([]*RESPValue{
+				NewBulkStringValue("name"), NewBulkStringValue(consumer.name),
+				NewBulkStringValue("seen-time"), NewIntegerValue(consumer.seenTime),
+				NewBulkStringValue("active-time"), NewIntegerValue(consumer.activeTime),
+				NewBulkStringValue("pel-count"), NewIntegerValue(int64(consumer.pel.Len())),
+				NewBulkStringValue("pending"), NewArrayValue(consumerPending),
+			}))
+		}
+
+		groups = append(groups, NewArrayValue([]*RESPValue{
+			NewBulkStringValue("name"), NewBulkStringValue(name),
+			NewBulkStringValue("last-delivered-id"), NewBulkStringValue(cg.lastID.String()),
+			NewBulkStringValue("entries-read"), entriesReadReply(cg),
+			NewBulkStringValue("lag"), groupLagReply(stream, cg),
+			NewBulkStringValue("pel-count"), NewIntegerValue(int64(cg.pel.Len())),
+			NewBulkStringValue("pending"), NewArrayValue(pending),
+			NewBulkStringValue("consumers"), NewArrayValue(consumers),
+		}))
+	}
+
+	return NewArrayValue(append(reply,
+		NewBulkStringValue("entries"), streamEntriesReply(entries),
+		NewBulkStringValue("groups"), NewArrayValue(groups),
+	))
+}
+
+// handleXInfo 处理 XINFO 命令，支持 STREAM/GROUPS/CONSUMERS 子命令
+func (rs *RedisServer) handleXInfo(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 {
+		return wrongArgsError("xinfo")
+	}
+
+	sub := strings.ToUpper(args[0])
+	var arityOK bool
+	switch sub {
+	case "STREAM":
+		arityOK = len(args) == 2 || len(args) == 3 || len(args) == 5
+	case "GROUPS":
+		arityOK = len(args) == 2
+	case "CONSUMERS":
+		arityOK = len(args) == 3
+	}
+	if !arityOK {
+		return NewErrorValue("ERR unknown subcommand or wrong number of arguments for '" + args[0] + "'. Try XINFO HELP.")
+	}
+
+	full := false
+	count := 10
+	if sub == "STREAM" && len(args) > 2 {
+		if !strings.EqualFold(args[2], "FULL") {
+			return NewErrorValue("ERR syntax error")
+		}
+		full = true
+		if len(args) == 5 {
+			if !strings.EqualFold(args[3], "COUNT") {
+				return NewErrorValue("ERR syntax error")
+			}
+			n, err := strconv.Atoi(args[4])
+			if err != nil {
+				return NewErrorValue("ERR value is not an integer or out of range")
+			}
+			count = max(n, 0)
+		}
+	}
+
+	key := args[1]
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	stream, errResp := c.db.lookupStream(key)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return NewErrorValue("ERR no such key")
+	}
+
+	switch sub {
+	case "STREAM":
+		return xinfoStream(stream, full, count)
+	case "GROUPS":
+		groups := make([]*RESPValue, 0, len(stream.cgroups))
+		for _, name := range stream.groupNames() {
+			cg := stream.cgroups[name]
+			groups = append(groups, NewArrayValue([]*RESPValue{
+				NewBulkStringValue("name"), NewBulkStringValue(name),
+				NewBulkStringValue("consumers"), NewIntegerValue(int64(len(cg.consumers))),
+				NewBulkStringValue("pending"), NewIntegerValue(int64(cg.pel.Len())),
+				NewBulkStringValue("last-delivered-id"), NewBulkStringValue(cg.lastID.String()),
+				NewBulkStringValue("entries-read"), entriesReadReply(cg),
+				NewBulkStringValue("lag"), groupLagReply(stream, cg),
+			}))
+		}
+		return NewArrayValue(groups)
+	default: // CONSUMERS
+		cg := stream.lookupGroup(args[2])
+		if cg == nil {
+			return noGroupError(key, args[2])
+		}
+		now := time.Now().UnixMilli()
+		consumers := make([]*RESPValue, 0, len(cg.consumers))
+		for _, name := range cg.consumerNames() {
+			consumer := cg.consumers[name]
+			inactive := int64(-1)
+			if consumer.activeTime >= 0 {
+				inactive = now - consumer.activeTime
+			}
+			consumers = append(consumers, NewArrayValue([]*RESPValue{
+				NewBulkStringValue("name"), NewBulkStringValue(name),
+				NewBulkStringValue("pending"), NewIntegerValue(int64(consumer.pel.Len())),
+				NewBulkStringValue("idle"), NewIntegerValue(now - consumer.seenTime),
+				NewBulkStringValue("inactive"), NewIntegerValue(inactive),
+			}))
+		}
+		return NewArrayValue(consumers)
+	}
+}
@@ -0,0 +1,395 @@
+package goredis
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestStream 创建包含 ID 为 1-0 到 n-0 的 n 个条目的流
+func newTestStream(n int) *Stream {
+	s := NewStream()
+	for i := 1; i <= n; i++ {
+		s.Append(streamID{uint64(i), 0}, []string{"f", "v"})
+	}
+	return s
+}
+
+// firstID 返回流中第一个条目的 ID
+func (s *Stream) firstID() streamID {
+	return s.nodes[0].entries[0].id
+}
+
+func TestStreamTrim(t *testing.T) {
+	s := newTestStream(350)
+	if len(s.nodes) != 4 {
+		t.Fatalf("350 entries in %d nodes, want 4", len(s.nodes))
+	}
+
+	// 近似裁剪只丢弃整个节点
+	if n := s.Trim(&streamTrimSpec{strategy: STREAM_TRIM_MAXLEN, maxlen: 240, approx: true}); n != 100 {
+		t.Fatalf("approx MAXLEN 240 removed %d, want 100", n)
+	}
+	// LIMIT 限制近似裁剪删除的条目数
+	if n := s.Trim(&streamTrimSpec{strategy: STREAM_TRIM_MAXLEN, maxlen: 0, approx: true, limit: 150}); n != 100 {
+		t.Fatalf("approx MAXLEN 0 LIMIT 150 removed %d, want 100", n)
+	}
+	if s.Len() != 150 || s.firstID() != (streamID{201, 0}) {
+		t.Fatalf("after approx trims: len %d, first %v", s.Len(), s.firstID())
+	}
+
+	// 精确裁剪可以删除节点中的一部分条目
+	if n := s.Trim(&streamTrimSpec{strategy: STREAM_TRIM_MAXLEN, maxlen: 120}); n != 30 {
+		t.Fatalf("MAXLEN 120 removed %d, want 30", n)
+	}
+	if n := s.Trim(&streamTrimSpec{strategy: STREAM_TRIM_MINID, minid: streamID{305, 0}}); n != 74 {
+		t.Fatalf("MINID 305-0 removed %d, want 74", n)
+	}
+	if s.Len() != 46 || s.firstID() != (streamID{305, 0}) {
+		t.Fatalf("after exact trims: len %d, first %v", s.Len(), s.firstID())
+	}
+	if n := s.Trim(&streamTrimSpec{strategy: STREAM_TRIM_MINID, minid: streamID{1, 0}}); n != 0 {
+		t.Fatalf("MINID 1-0 removed %d", n)
+	}
+}
+
+func TestXAddIDs(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("1-1", "XADD", "s", "1-1", "f", "v")
+	c.mustDo("1-2", "XADD", "s", "1-*", "f", "v")
+	c.mustDo("5-0", "XADD", "s", "5", "f", "v")
+	c.mustDo("(error) ERR The ID specified in XADD is equal or smaller than the target stream top item", "XADD", "s", "5-0", "f", "v")
+	c.mustDo("(error) ERR The ID specified in XADD is equal or smaller than the target stream top item", "XADD", "s", "4-*", "f", "v")
+	c.mustDo("(error) ERR The ID specified in XADD must be greater than 0-0", "XADD", "s2", "0-0", "f", "v")
+	c.mustDo("(error) ERR Invalid stream ID specified as stream command argument", "XADD", "s", "x", "f", "v")
+
+	// 自动生成的 ID 使用当前毫秒时间，并且大于已有 ID
+	id := c.do("XADD", "s", "*", "f", "v").Str
+	if ms, _, _ := strings.Cut(id, "-"); len(ms) < 13 {
+		t.Fatalf("auto ID %q does not look like a millisecond timestamp", id)
+	}
+	c.mustDo("18446744073709551615-18446744073709551615", "XADD", "max", "18446744073709551615-18446744073709551615", "f", "v")
+	c.mustDo("(error) ERR The stream has exhausted the last possible ID, unable to add more items", "XADD", "max", "*", "f", "v")
+
+	c.mustDo("(nil)", "XADD", "missing", "NOMKSTREAM", "*", "f", "v")
+	c.mustDo("(error) ERR wrong number of arguments for 'xadd' command", "XADD", "s", "*", "f")
+	c.mustDo("(error) ERR syntax error, LIMIT cannot be used without the special ~ option", "XADD", "s", "MAXLEN", "1", "LIMIT", "10", "*", "f", "v")
+	c.mustDo("(error) ERR The MAXLEN argument must be >= 0.", "XADD", "s", "MAXLEN", "-1", "*", "f", "v")
+}
+
+func TestStreamRangeAcrossNodes(t *testing.T) {
+	s := newTestStream(250)
+	ids := func(entries []streamEntry) []uint64 {
+		result := make([]uint64, len(entries))
+		for i, e := range entries {
+			result[i] = e.id.ms
+		}
+		return result
+	}
+	for _, tt := range []struct {
+		start, end uint64
+		count      int
+		reverse    bool
+		want       []uint64
+	}{
+		{98, 102, -1, false, []uint64{98, 99, 100, 101, 102}},
+		{98, 102, 3, false, []uint64{98, 99, 100}},
+		{98, 102, 3, true, []uint64{102, 101, 100}},
+		{199, 201, -1, true, []uint64{201, 200, 199}},
+		{250, 300, -1, false, []uint64{250}},
+		{260, 300, -1, false, []uint64{}},
+		{5, 4, -1, false, []uint64{}},
+	} {
+		got := ids(s.Range(streamID{tt.start, 0}, streamID{tt.end, 0}, tt.count, tt.reverse))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Range(%d, %d, %d, %v) = %v, want %v", tt.start, tt.end, tt.count, tt.reverse, got, tt.want)
+		}
+	}
+}
+
+func TestXRange(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[]", "XRANGE", "s", "-", "+")
+	c.mustDo("1-0", "XADD", "s", "1-0", "a", "1")
+	c.mustDo("1-1", "XADD", "s", "1-1", "b", "2")
+	c.mustDo("2-0", "XADD", "s", "2-0", "c", "3", "d", "4")
+	c.mustDo("[[1-0 [a 1]] [1-1 [b 2]] [2-0 [c 3 d 4]]]", "XRANGE", "s", "-", "+")
+	// 省略序号时起点为 0、终点为最大序号
+	c.mustDo("[[1-0 [a 1]] [1-1 [b 2]]]", "XRANGE", "s", "1", "1")
+	c.mustDo("[[1-1 [b 2]] [2-0 [c 3 d 4]]]", "XRANGE", "s", "(1-0", "+")
+	c.mustDo("[[2-0 [c 3 d 4]]]", "XREVRANGE", "s", "+", "-", "COUNT", "1")
+	c.mustDo("[[1-1 [b 2]] [1-0 [a 1]]]", "XREVRANGE", "s", "(2-0", "-")
+	c.mustDo("(error) ERR invalid start ID for the interval", "XRANGE", "s", "(18446744073709551615-18446744073709551615", "+")
+	c.mustDo("(error) ERR Invalid stream ID specified as stream command argument", "XRANGE", "s", "x", "+")
+}
+
+func TestXLenAndXTrim(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("0", "XLEN", "s")
+	for i := 1; i <= 250; i++ {
+		c.do("XADD", "s", strconv.Itoa(i), "f", "v")
+	}
+	c.mustDo("250", "XLEN", "s")
+	// 近似裁剪只删除整个节点
+	c.mustDo("100", "XTRIM", "s", "MAXLEN", "~", "120")
+	c.mustDo("30", "XTRIM", "s", "MAXLEN", "=", "120")
+	c.mustDo("20", "XTRIM", "s", "MINID", "151")
+	c.mustDo("[[151-0 [f v]]]", "XRANGE", "s", "-", "+", "COUNT", "1")
+	c.mustDo("100", "XLEN", "s")
+
+	// XADD 也可以在追加后裁剪
+	c.mustDo("251-0", "XADD", "s", "MAXLEN", "2", "251", "f", "v")
+	c.mustDo("2", "XLEN", "s")
+	c.mustDo("(error) ERR syntax error, MAXLEN and MINID options at the same time are not compatible", "XTRIM", "s", "MAXLEN", "1", "MINID", "1")
+	c.mustDo("(error) ERR syntax error", "XTRIM", "s", "FOO", "1")
+}
+
+func TestXRead(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(nil)", "XREAD", "STREAMS", "s1", "0")
+	c.mustDo("1-0", "XADD", "s1", "1-0", "a", "1")
+	c.mustDo("2-0", "XADD", "s1", "2-0", "b", "2")
+	c.mustDo("3-0", "XADD", "s2", "3-0", "c", "3")
+	c.mustDo("[[s1 [[2-0 [b 2]]]] [s2 [[3-0 [c 3]]]]]", "XREAD", "STREAMS", "s1", "s2", "1-0", "0")
+	c.mustDo("[[s1 [[1-0 [a 1]]]]]", "XREAD", "COUNT", "1", "STREAMS", "s1", "s2", "0", "3")
+	// $ 表示只读取之后新增的条目
+	c.mustDo("(nil)", "XREAD", "STREAMS", "s1", "$")
+	c.mustDo("(error) ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.", "XREAD", "STREAMS", "s1", "s2", "0")
+	c.mustDo("(error) ERR Invalid stream ID specified as stream command argument", "XREAD", "STREAMS", "s1", "x")
+	c.mustDo("(error) ERR syntax error", "XREAD", "COUNT", "1", "s1", "0")
+}
+
+func TestXReadBlock(t *testing.T) {
+	ts := startTestServer(t)
+	c, writer := ts.connect(t), ts.connect(t)
+	writer.mustDo("1-0", "XADD", "s", "1-0", "a", "1")
+
+	// $ 在阻塞前解析，只返回之后新增的条目
+	c.send("XREAD", "BLOCK", "0", "STREAMS", "s", "$")
+	waitFor(t, "client to block", func() bool { return ts.blockedOn("s") == 1 })
+	writer.mustDo("2-0", "XADD", "s", "2-0", "b", "2")
+	if got := replyString(c.read()); got != "[[s [[2-0 [b 2]]]]]" {
+		t.Fatalf("XREAD BLOCK got %s", got)
+	}
+
+	// 有数据时立即返回
+	c.mustDo("[[s [[1-0 [a 1]]]]]", "XREAD", "COUNT", "1", "BLOCK", "0", "STREAMS", "s", "0")
+	c.mustDo("(nil)", "XREAD", "BLOCK", "50", "STREAMS", "s", "$")
+	c.mustDo("(error) ERR timeout is negative", "XREAD", "BLOCK", "-1", "STREAMS", "s", "$")
+}
+
+func TestConsumerGroups(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(error) ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.", "XGROUP", "CREATE", "s", "g", "$")
+	c.mustDo("OK", "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM")
+	c.mustDo("(error) BUSYGROUP Consumer Group name already exists", "XGROUP", "CREATE", "s", "g", "0")
+	c.mustDo("1-0", "XADD", "s", "1-0", "a", "1")
+	c.mustDo("2-0", "XADD", "s", "2-0", "b", "2")
+	c.mustDo("3-0", "XADD", "s", "3-0", "c", "3")
+
+	// > 读取新条目并记入消费者的待确认条目表
+	c.mustDo("[[s [[1-0 [a 1]] [2-0 [b 2]]]]]", "XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">")
+	c.mustDo("[[s [[3-0 [c 3]]]]]", "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">")
+	c.mustDo("(nil)", "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">")
+	// 其他 ID 读取该消费者自己的待确认条目
+	c.mustDo("[[s [[2-0 [b 2]]]]]", "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "1-0")
+	c.mustDo("1", "XACK", "s", "g", "1-0", "9-0")
+	c.mustDo("[[s [[2-0 [b 2]]]]]", "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0")
+
+	// NOACK 不记入待确认条目表
+	c.mustDo("4-0", "XADD", "s", "4-0", "d", "4")
+	c.mustDo("[[s [[4-0 [d 4]]]]]", "XREADGROUP", "GROUP", "g", "alice", "NOACK", "STREAMS", "s", ">")
+	c.mustDo("[[s [[2-0 [b 2]]]]]", "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0")
+
+	// SETID 后重新投递
+	c.mustDo("OK", "XGROUP", "SETID", "s", "g", "2-0")
+	c.mustDo("[[s [[3-0 [c 3]] [4-0 [d 4]]]]]", "XREADGROUP", "GROUP", "g", "carol", "STREAMS", "s", ">")
+
+	c.mustDo("1", "XGROUP", "DELCONSUMER", "s", "g", "alice")
+	c.mustDo("1", "XGROUP", "CREATECONSUMER", "s", "g", "dave")
+	c.mustDo("0", "XGROUP", "CREATECONSUMER", "s", "g", "dave")
+	c.mustDo("1", "XGROUP", "DESTROY", "s", "g")
+	c.mustDo("0", "XGROUP", "DESTROY", "s", "g")
+	c.mustDo("(error) NOGROUP No such key 's' or consumer group 'g' in XREADGROUP with GROUP option", "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+	c.mustDo("(error) ERR The $ ID is meaningful only for XREAD command", "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "$")
+}
+
+func TestXReadGroupBlock(t *testing.T) {
+	ts := startTestServer(t)
+	c, writer := ts.connect(t), ts.connect(t)
+	writer.mustDo("OK", "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM")
+	c.send("XREADGROUP", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", "s", ">")
+	waitFor(t, "client to block", func() bool { return ts.blockedOn("s") == 1 })
+	writer.mustDo("1-0", "XADD", "s", "1-0", "a", "1")
+	if got := replyString(c.read()); got != "[[s [[1-0 [a 1]]]]]" {
+		t.Fatalf("XREADGROUP BLOCK got %s", got)
+	}
+	c.mustDo("[[s [[1-0 [a 1]]]]]", "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0")
+}
+
+// pending 返回 XPENDING 明细中每个条目的 ID、消费者和投递次数，省略与时间有关的空闲毫秒数
+func (tc *testClient) pending(args ...string) string {
+	tc.t.Helper()
+	v := tc.do(append([]string{"XPENDING"}, args...)...)
+	if v.Type != RESP_ARRAY {
+		tc.t.Fatalf("XPENDING %v: got %s", args, replyString(v))
+	}
+	rows := make([]string, len(v.Array))
+	for i, row := range v.Array {
+		rows[i] = row.Array[0].Str + " " + row.Array[1].Str + " " + replyString(row.Array[3])
+	}
+	return "[" + strings.Join(rows, ", ") + "]"
+}
+
+func TestXPendingAndXClaim(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	for i := 1; i <= 6; i++ {
+		c.do("XADD", "s", strconv.Itoa(i), "f", strconv.Itoa(i))
+	}
+	c.mustDo("OK", "XGROUP", "CREATE", "s", "g", "0")
+	c.mustDo("[0 (nil) (nil) (nil)]", "XPENDING", "s", "g")
+	c.do("XREADGROUP", "GROUP", "g", "alice", "COUNT", "5", "STREAMS", "s", ">")
+	c.mustDo("[5 1-0 5-0 [[alice 5]]]", "XPENDING", "s", "g")
+
+	// 重新投递给其他消费者时投递次数加一
+	c.mustDo("[[1-0 [f 1]] [2-0 [f 2]]]", "XCLAIM", "s", "g", "bob", "0", "1-0", "2-0")
+	if got := c.pending("s", "g", "-", "+", "10"); got != "[1-0 bob 2, 2-0 bob 2, 3-0 alice 1, 4-0 alice 1, 5-0 alice 1]" {
+		t.Fatalf("XPENDING after XCLAIM: %s", got)
+	}
+	c.mustDo("[5 1-0 5-0 [[alice 3] [bob 2]]]", "XPENDING", "s", "g")
+	if got := c.pending("s", "g", "-", "+", "10", "bob"); got != "[1-0 bob 2, 2-0 bob 2]" {
+		t.Fatalf("XPENDING for bob: %s", got)
+	}
+
+	// 空闲时间不够的条目不会被认领
+	c.mustDo("[]", "XCLAIM", "s", "g", "bob", "3600000", "3-0")
+	// JUSTID 不增加投递次数，RETRYCOUNT 直接设置投递次数
+	c.mustDo("[3-0]", "XCLAIM", "s", "g", "bob", "0", "3-0", "JUSTID")
+	c.mustDo("[[4-0 [f 4]]]", "XCLAIM", "s", "g", "bob", "0", "4-0", "RETRYCOUNT", "7")
+	if got := c.pending("s", "g", "3-0", "4-0", "10"); got != "[3-0 bob 1, 4-0 bob 7]" {
+		t.Fatalf("XPENDING after JUSTID/RETRYCOUNT: %s", got)
+	}
+
+	// IDLE 设置空闲时间，XPENDING IDLE 只返回空闲足够久的条目
+	c.mustDo("[5-0]", "XCLAIM", "s", "g", "alice", "0", "5-0", "IDLE", "60000", "JUSTID")
+	if got := c.pending("s", "g", "IDLE", "30000", "-", "+", "10"); got != "[5-0 alice 1]" {
+		t.Fatalf("XPENDING IDLE: %s", got)
+	}
+
+	// FORCE 为不在待确认条目表中的条目创建记录
+	c.mustDo("[]", "XCLAIM", "s", "g", "bob", "0", "6-0")
+	c.mustDo("[6-0]", "XCLAIM", "s", "g", "bob", "0", "6-0", "FORCE", "JUSTID")
+
+	// 已从流中删除的条目被移出待确认条目表
+	c.mustDo("1", "XTRIM", "s", "MINID", "2")
+	c.mustDo("[]", "XCLAIM", "s", "g", "alice", "0", "1-0")
+	c.mustDo("[5 2-0 6-0 [[alice 1] [bob 4]]]", "XPENDING", "s", "g")
+
+	c.mustDo("(error) NOGROUP No such key 's' or consumer group 'x'", "XCLAIM", "s", "x", "bob", "0", "1-0")
+	c.mustDo("(error) ERR Invalid min-idle-time argument for XCLAIM", "XCLAIM", "s", "g", "bob", "x", "1-0")
+	c.mustDo("(error) ERR Unrecognized XCLAIM option 'FOO'", "XCLAIM", "s", "g", "bob", "0", "1-0", "FOO")
+}
+
+func TestXAutoClaim(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	for i := 1; i <= 5; i++ {
+		c.do("XADD", "s", strconv.Itoa(i), "f", strconv.Itoa(i))
+	}
+	c.mustDo("OK", "XGROUP", "CREATE", "s", "g", "0")
+	c.do("XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+	c.mustDo("1", "XTRIM", "s", "MINID", "2")
+
+	// 已删除的 1-0 出现在第三个元素中，并且不计入 COUNT
+	c.mustDo("[4-0 [[2-0 [f 2]] [3-0 [f 3]]] [1-0]]", "XAUTOCLAIM", "s", "g", "bob", "0", "0", "COUNT", "2")
+	c.mustDo("[0-0 [4-0 5-0] []]", "XAUTOCLAIM", "s", "g", "bob", "0", "4-0", "JUSTID")
+	c.mustDo("[4 2-0 5-0 [[bob 4]]]", "XPENDING", "s", "g")
+	if got := c.pending("s", "g", "-", "+", "10"); got != "[2-0 bob 2, 3-0 bob 2, 4-0 bob 1, 5-0 bob 1]" {
+		t.Fatalf("XPENDING after XAUTOCLAIM: %s", got)
+	}
+
+	// 空闲时间不够时什么也不认领
+	c.mustDo("[0-0 [] []]", "XAUTOCLAIM", "s", "g", "carol", "3600000", "0")
+	c.mustDo("(error) ERR COUNT must be > 0", "XAUTOCLAIM", "s", "g", "bob", "0", "0", "COUNT", "0")
+}
+
+// field 在以 name/value 交替排列的数组回复中查找字段，返回其文本形式
+func field(t *testing.T, v *RESPValue, name string) string {
+	t.Helper()
+	for i := 0; i+1 < len(v.Array); i += 2 {
+		if v.Array[i].Str == name {
+			return replyString(v.Array[i+1])
+		}
+	}
+	t.Fatalf("field %q not found in %s", name, replyString(v))
+	return ""
+}
+
+func TestXInfo(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(error) ERR no such key", "XINFO", "STREAM", "s")
+	for i := 1; i <= 4; i++ {
+		c.do("XADD", "s", strconv.Itoa(i), "f", strconv.Itoa(i))
+	}
+	c.mustDo("OK", "XGROUP", "CREATE", "s", "g", "0")
+	c.do("XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">")
+	c.do("XREADGROUP", "GROUP", "g", "bob", "COUNT", "2", "STREAMS", "s", ">")
+
+	info := c.do("XINFO", "STREAM", "s")
+	for name, want := range map[string]string{
+		"length":            "4",
+		"last-generated-id": "4-0",
+		"entries-added":     "4",
+		"groups":            "1",
+		"first-entry":       "[1-0 [f 1]]",
+		"last-entry":        "[4-0 [f 4]]",
+	} {
+		if got := field(t, info, name); got != want {
+			t.Errorf("XINFO STREAM %s = %s, want %s", name, got, want)
+		}
+	}
+
+	// lag 为组还没有读到的条目数量
+	groups := c.do("XINFO", "GROUPS", "s")
+	if len(groups.Array) != 1 {
+		t.Fatalf("XINFO GROUPS: %s", replyString(groups))
+	}
+	for name, want := range map[string]string{
+		"name":              "g",
+		"consumers":         "2",
+		"pending":           "3",
+		"last-delivered-id": "3-0",
+		"entries-read":      "3",
+		"lag":               "1",
+	} {
+		if got := field(t, groups.Array[0], name); got != want {
+			t.Errorf("XINFO GROUPS %s = %s, want %s", name, got, want)
+		}
+	}
+
+	consumers := c.do("XINFO", "CONSUMERS", "s", "g")
+	if len(consumers.Array) != 2 || field(t, consumers.Array[0], "name") != "alice" || field(t, consumers.Array[0], "pending") != "1" || field(t, consumers.Array[1], "pending") != "2" {
+		t.Fatalf("XINFO CONSUMERS: %s", replyString(consumers))
+	}
+
+	full := c.do("XINFO", "STREAM", "s", "FULL", "COUNT", "2")
+	if got := field(t, full, "entries"); got != "[[1-0 [f 1]] [2-0 [f 2]]]" {
+		t.Fatalf("XINFO STREAM FULL entries = %s", got)
+	}
+
+	// ENTRIESREAD 设置组已读取的条目数量
+	c.mustDo("OK", "XGROUP", "CREATE", "s", "g2", "2-0", "ENTRIESREAD", "2")
+	groups = c.do("XINFO", "GROUPS", "s")
+	if got := field(t, groups.Array[1], "lag"); got != "2" {
+		t.Fatalf("lag of g2 = %s, want 2", got)
+	}
+	c.mustDo("(error) NOGROUP No such consumer group 'x' for key name 's'", "XINFO", "CONSUMERS", "s", "x")
+}
@@ -0,0 +1,155 @@
+package goredis
+
+import (
+	"bytes"
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// topkDecayLookup 的长度，计数更大的桶使用最后一项的衰减概率
+const topkDecayLookupSize = 256
+
+// topkFingerprintSeed 是计算元素指纹时使用的哈希种子，与各行的种子（行号）区分开
+const topkFingerprintSeed = 0x5bd1e995
+
+// topkBucket 是 HeavyKeeper 中的一个桶，记录占据该桶的元素指纹及其计数
+type topkBucket struct {
+	fp    uint64
+	count uint32
+}
+
+// topkHeapEntry 是最小堆中的一个元素
+type topkHeapEntry struct {
+	fp    uint64
+	item  []byte // 为 nil 表示空位
+	count uint32
+}
+
+// TopK 表示 Top-K 类型的值，使用 HeavyKeeper 算法
+//
+// depth 行、每行 width 个桶，元素在每一行按哈希落到一个桶上：桶为空或被同一元素占据时计数增加，
+// 被其他元素占据时以 decay^count 的概率把计数减一，减到 0 后由新元素接管。这样低频元素
+// 很难占住桶，高频元素的计数接近真实值。另有一个容量为 k 的最小堆保存当前的前 k 个元素，
+// 元素的估计计数超过堆顶时替换堆顶，被替换的元素作为 TOPK.ADD 的返回值。
+//
+// 衰减使用保存在值中的伪随机数发生器（splitmix64），状态随值一起保存到 RDB 和 DUMP 载荷中。
+// 同样的命令序列因此总是得到同样的结果，副本和重放 AOF 得到的 Top-K 与主节点相同。
+type TopK struct {
+	k       int
+	width   uint64
+	depth   uint64
+	decay   float64
+	buckets []topkBucket
+	heap    topkHeap
+	lookup  [topkDecayLookupSize]float64
+	rng     uint64 // 衰减使用的伪随机数发生器状态
+}
+
+// NewTopK 创建保存前 k 个元素的 Top-K
+func NewTopK(k int, width, depth uint64, decay float64) *TopK {
+	topk := &TopK{
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		buckets: make([]topkBucket, width*depth),
+		heap:    make(topkHeap, k),
+	}
+	for i := range topk.lookup {
+		topk.lookup[i] = math.Pow(decay, float64(i))
+	}
+	return topk
+}
+
+// topkHeap 是按计数排列的最小堆，实现 container/heap 的接口
+type topkHeap []topkHeapEntry
+
+func (h topkHeap) Len() int           { return len(h) }
+func (h topkHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h topkHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *topkHeap) Push(x any)        { *h = append(*h, x.(topkHeapEntry)) }
+func (h *topkHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// heapFind 返回元素在堆中的下标，不在堆中时返回 -1
+func (topk *TopK) heapFind(fp uint64, item []byte) int {
+	for i := range topk.heap {
+		if topk.heap[i].item != nil && topk.heap[i].fp == fp && bytes.Equal(topk.heap[i].item, item) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add 加入一个元素，元素进入前 k 名而挤出另一个元素时返回被挤出的元素，否则返回 nil
+func (topk *TopK) Add(item []byte) []byte {
+	fp := murmurHash64A(item, topkFingerprintSeed)
+	var maxCount uint32
+	for row := uint64(0); row < topk.depth; row++ {
+		bucket := &topk.buckets[row*topk.width+murmurHash64A(item, row)%topk.width]
+		switch {
+		case bucket.count == 0:
+			bucket.fp = fp
+			bucket.count = 1
+		case bucket.fp == fp:
+			if bucket.count < math.MaxUint32 {
+				bucket.count++
+			}
+		default:
+			decay := topk.lookup[min(bucket.count, topkDecayLookupSize-1)]
+			if topk.random() < decay {
+				bucket.count--
+				if bucket.count == 0 {
+					bucket.fp = fp
+					bucket.count = 1
+				}
+			}
+		}
+		if bucket.fp == fp {
+			maxCount = max(maxCount, bucket.count)
+		}
+	}
+
+	if maxCount == 0 || maxCount < topk.heap[0].count {
+		return nil
+	}
+	if i := topk.heapFind(fp, item); i >= 0 {
+		// 所在的桶可能被其他元素接管过，计数既可能变大也可能变小
+		topk.heap[i].count = maxCount
+		heap.Fix(&topk.heap, i)
+		return nil
+	}
+	expelled := topk.heap[0].item
+	topk.heap[0] = topkHeapEntry{fp: fp, item: bytes.Clone(item), count: maxCount}
+	heap.Fix(&topk.heap, 0)
+	return expelled
+}
+
+// random 推进伪随机数发生器，返回 [0, 1) 中的一个数
+func (topk *TopK) random() float64 {
+	topk.rng += 0x9e3779b97f4a7c15
+	z := topk.rng
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return float64(z>>11) / (1 << 53)
+}
+
+// List 返回前 k 名中的元素，按估计计数从高到低排列
+func (topk *TopK) List() []topkHeapEntry {
+	entries := make([]topkHeapEntry, 0, topk.k)
+	for _, entry := range topk.heap {
+		if entry.item != nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].count > entries[j].count
+	})
+	return entries
+}
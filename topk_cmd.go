@@ -0,0 +1,137 @@
+package goredis
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TOPK.RESERVE 的默认参数，与 RedisBloom 相同
+const (
+	topkDefaultWidth = 8
+	topkDefaultDepth = 7
+	topkDefaultDecay = 0.9
+)
+
+// topkMaxBuckets 限制单个 Top-K 的桶总数，避免一条命令分配过多内存
+const topkMaxBuckets = 1 << 27
+
+// lookupTopK 查找 Top-K，键不存在或类型不匹配时返回错误响应（调用方需持有锁）
+func (db *redisDb) lookupTopK(key string) (*TopK, *RESPValue) {
+	obj := db.lookupKey(key)
+	if obj == nil {
+		return nil, NewErrorValue("TopK: key does not exist")
+	}
+	if obj.Type != OBJ_TOPK {
+		return nil, NewErrorValue(wrongTypeErr)
+	}
+	return obj.Value.(*TopK), nil
+}
+
+// lookupTopKWrite 与 lookupTopK 相同，用于原地修改Top-K（调用方需持有写锁）
+func (db *redisDb) lookupTopKWrite(key string) (*TopK, *RESPValue) {
+	db.lookupKeyWrite(key)
+	return db.lookupTopK(key)
+}
+
+// handleTopKReserve 处理 TOPK.RESERVE 命令
+func (rs *RedisServer) handleTopKReserve(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 && len(args) != 5 {
+		return wrongArgsError("topk.reserve")
+	}
+	k, err := strconv.Atoi(args[1])
+	if err != nil || k <= 0 || k > topkMaxBuckets {
+		return NewErrorValue("TopK: invalid k")
+	}
+	width, depth, decay := uint64(topkDefaultWidth), uint64(topkDefaultDepth), topkDefaultDecay
+	if len(args) == 5 {
+		if width, err = strconv.ParseUint(args[2], 10, 64); err != nil || width == 0 {
+			return NewErrorValue("TopK: invalid width")
+		}
+		if depth, err = strconv.ParseUint(args[3], 10, 64); err != nil || depth == 0 {
+			return NewErrorValue("TopK: invalid depth")
+		}
+		if decay, err = strconv.ParseFloat(args[4], 64); err != nil || decay <= 0 || decay > 1 {
+			return NewErrorValue("TopK: invalid decay value. must be '<= 1' & '> 0'")
+		}
+		if width > topkMaxBuckets/depth {
+			return NewErrorValue("TopK: width * depth is too large")
+		}
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if c.db.lookupKey(args[0]) != nil {
+		return NewErrorValue("TopK: key already exists")
+	}
+	c.db.store.Set(args[0], NewTopKObject(k, width, depth, decay))
+	rs.signalModifiedKey(c.db, args[0])
+	return NewSimpleStringValue("OK")
+}
+
+// handleTopKAdd 处理 TOPK.ADD 命令，对每个元素返回因它进入前 k 名而被挤出的元素，没有时返回 null
+func (rs *RedisServer) handleTopKAdd(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("topk.add")
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	topk, errResp := c.db.lookupTopKWrite(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	replies := make([]*RESPValue, len(args)-1)
+	for i, item := range args[1:] {
+		if expelled := topk.Add([]byte(item)); expelled != nil {
+			replies[i] = NewBulkStringValue(string(expelled))
+		} else {
+			replies[i] = NewNullBulkStringValue()
+		}
+	}
+	rs.signalModifiedKey(c.db, args[0])
+	return NewArrayValue(replies)
+}
+
+// handleTopKList 处理 TOPK.LIST 命令，按估计计数从高到低返回前 k 名，WITHCOUNT 时同时返回计数
+func (rs *RedisServer) handleTopKList(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgsError("topk.list")
+	}
+	withCount := false
+	if len(args) == 2 {
+		if strings.ToUpper(args[1]) != "WITHCOUNT" {
+			return NewErrorValue("TopK: wrong number of arguments")
+		}
+		withCount = true
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	topk, errResp := c.db.lookupTopK(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	replies := make([]*RESPValue, 0)
+	for _, entry := range topk.List() {
+		replies = append(replies, NewBulkStringValue(string(entry.item)))
+		if withCount {
+			replies = append(replies, NewIntegerValue(int64(entry.count)))
+		}
+	}
+	return NewArrayValue(replies)
+}
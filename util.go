@@ -0,0 +1,74 @@
+package goredis
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseFloat 按 Redis 的规则解析浮点数，支持 inf/-inf，拒绝 NaN
+func parseFloat(str string) (float64, bool) {
+	if str == "" || strings.TrimSpace(str) != str {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// formatFloat 按 Redis 的规则格式化浮点数：使用能精确还原数值的最短表示，
+// 整数不带小数点，正负无穷为 inf/-inf
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	abs := math.Abs(f)
+	if abs == 0 || (abs >= 1e-5 && abs < 1e17) {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatHumanFloat 以 17 位小数格式化浮点数并去掉末尾的 0，与 Redis 输出坐标等数值的方式相同
+func formatHumanFloat(f float64) string {
+	str := strconv.FormatFloat(f, 'f', 17, 64)
+	str = strings.TrimRight(str, "0")
+	str = strings.TrimSuffix(str, ".")
+	if str == "-0" {
+		return "0"
+	}
+	return str
+}
+
+// memoryUnits 是内存大小可以使用的单位，k/m/g 以 1000 为进制，kb/mb/gb 以 1024 为进制
+var memoryUnits = []struct {
+	suffix string
+	mul    int64
+}{
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// parseMemory 按 Redis 配置文件的规则解析内存大小，如 "32mb"、"1g"，单位不区分大小写
+func parseMemory(str string) (int64, bool) {
+	lower := strings.ToLower(str)
+	mul := int64(1)
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			mul = unit.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/mul {
+		return 0, false
+	}
+	return n * mul, true
+}
@@ -0,0 +1,68 @@
+package goredis
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseFloat(t *testing.T) {
+	valid := map[string]float64{
+		"1":    1,
+		"-2.5": -2.5,
+		"1e3":  1000,
+		"inf":  math.Inf(1),
+		"-inf": math.Inf(-1),
+		"+inf": math.Inf(1),
+	}
+	for str, want := range valid {
+		if got, ok := parseFloat(str); !ok || got != want {
+			t.Errorf("parseFloat(%q) = %v, %v; want %v", str, got, ok, want)
+		}
+	}
+	for _, str := range []string{"", " 1", "1 ", "abc", "nan", "1.2.3"} {
+		if _, ok := parseFloat(str); ok {
+			t.Errorf("parseFloat(%q) should fail", str)
+		}
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := map[float64]string{
+		0:            "0",
+		1:            "1",
+		-3:           "-3",
+		1.5:          "1.5",
+		0.1:          "0.1",
+		1e20:         "1e+20",
+		1.5e-7:       "1.5e-07",
+		math.Inf(1):  "inf",
+		math.Inf(-1): "-inf",
+	}
+	for f, want := range tests {
+		if got := formatFloat(f); got != want {
+			t.Errorf("formatFloat(%v) = %q, want %q", f, got, want)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	valid := map[string]int64{
+		"0":    0,
+		"100":  100,
+		"1k":   1000,
+		"1kb":  1024,
+		"32MB": 32 << 20,
+		"2g":   2000 * 1000 * 1000,
+		"5b":   5,
+	}
+	for str, want := range valid {
+		if got, ok := parseMemory(str); !ok || got != want {
+			t.Errorf("parseMemory(%q) = %d, %v; want %d", str, got, ok, want)
+		}
+	}
+	for _, str := range []string{"", "mb", "-1", "1tb", "1.5m", "99999999999gb"} {
+		if _, ok := parseMemory(str); ok {
+			t.Errorf("parseMemory(%q) should fail", str)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package goredis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaitaofLocalFsync(t *testing.T) {
+	for _, policy := range []string{"always", "everysec", "no"} {
+		t.Run(policy, func(t *testing.T) {
+			ts := startTestServer(t, "appendonly yes", "appendfsync "+policy)
+			c := ts.connect(t)
+			c.mustDo("OK", "SET", "k", "v")
+			// everysec 时等到下一次后台 fsync，no 时写入文件即视为 fsync
+			c.mustDo("[1 0]", "WAITAOF", "1", "0", "0")
+		})
+	}
+
+	off := startTestServer(t).connect(t)
+	off.mustDo("(error) ERR WAITAOF cannot be used when numlocal is set but appendonly is disabled.", "WAITAOF", "1", "0", "0")
+	off.mustDo("[0 0]", "WAITAOF", "0", "0", "0")
+	off.mustDo("(error) ERR timeout is negative", "WAITAOF", "0", "0", "-1")
+	off.mustDo("(error) ERR value is not an integer or out of range", "WAITAOF", "x", "0", "0")
+}
+
+func TestWaitaofTimeout(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "appendfsync always")
+	c := ts.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	// 没有副本，要求的副本数达不到时等待到超时，返回当时的状态
+	start := time.Now()
+	c.mustDo("[1 0]", "WAITAOF", "1", "1", "100")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("WAITAOF returned after %v", elapsed)
+	}
+}
+
+func TestWaitaofInsideTransactionDoesNotBlock(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "WAITAOF", "0", "1", "0")
+	c.mustDo("[[0 0]]", "EXEC")
+}
+
+func TestWaitaofDoesNotBlockOtherClients(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes", "appendfsync always")
+	c, other := ts.connect(t), ts.connect(t)
+	c.send("WAITAOF", "0", "1", "0")
+	// 等待期间让出命令锁，事务照常执行
+	other.mustDo("OK", "MULTI")
+	other.mustDo("QUEUED", "SET", "k", "v")
+	other.mustDo("[OK]", "EXEC")
+	other.mustDo("[1 0]", "WAITAOF", "1", "0", "0")
+}
+
+func TestWait(t *testing.T) {
+	master := startTestServer(t)
+	c := master.connect(t)
+	c.mustDo("0", "WAIT", "0", "0")
+	replica := startReplica(t, master)
+	c.mustDo("OK", "SET", "k", "v")
+	// WAIT 返回时副本已经执行了之前的写命令
+	c.mustDo("1", "WAIT", "1", "0")
+	replica.connect(t).mustDo("v", "GET", "k")
+
+	// 要求的副本数达不到时等待到超时，返回已经确认的副本数
+	start := time.Now()
+	c.mustDo("1", "WAIT", "2", "100")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("WAIT returned after %v", elapsed)
+	}
+	if n := master.waitingAcks(); n != 0 {
+		t.Fatalf("%d clients still waiting after timeout", n)
+	}
+
+	// 事务中不阻塞，直接返回当前的数量
+	c.mustDo("OK", "MULTI")
+	c.mustDo("QUEUED", "WAIT", "2", "0")
+	if got := c.do("EXEC"); len(got.Array) != 1 || got.Array[0].Type != RESP_INTEGER || got.Array[0].Num > 1 {
+		t.Fatalf("EXEC got %s", replyString(got))
+	}
+
+	c.mustDo("(error) ERR timeout is negative", "WAIT", "1", "-1")
+	c.mustDo("(error) ERR value is not an integer or out of range", "WAIT", "x", "0")
+	replica.connect(t).mustDo("(error) ERR WAIT cannot be used with replica instances. Please also note that writes to replicas are just local and are not propagated.", "WAIT", "0", "0")
+}
+
+func TestWaitDoesNotBlockOtherClients(t *testing.T) {
+	master := startTestServer(t)
+	startReplica(t, master)
+	c, other := master.connect(t), master.connect(t)
+	c.send("WAIT", "2", "0")
+	other.mustDo("OK", "MULTI")
+	other.mustDo("QUEUED", "SET", "k", "v")
+	other.mustDo("[OK]", "EXEC")
+	other.mustDo("1", "WAIT", "1", "0")
+}
+
+func TestWaitClientDisconnect(t *testing.T) {
+	ts := startTestServer(t, "appendonly yes")
+	for _, cmd := range [][]string{{"WAIT", "1", "0"}, {"WAITAOF", "0", "1", "0"}} {
+		c := ts.connect(t)
+		c.send(cmd...)
+		waitFor(t, "client to wait", func() bool { return ts.waitingAcks() == 1 })
+		c.conn.Close()
+		waitFor(t, "disconnected client to stop waiting", func() bool { return ts.waitingAcks() == 0 })
+	}
+}
+
+func TestWaitaofCountsReplicaFsyncs(t *testing.T) {
+	master := startTestServer(t, "appendonly yes", "appendfsync always")
+	replica := startReplica(t, master, "appendonly yes", "appendfsync everysec")
+	c := master.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("[1 1]", "WAITAOF", "1", "1", "0")
+	c.mustDo("[1 1]", "WAITAOF", "0", "2", "100")
+
+	replica.connect(t).mustDo("(error) ERR WAITAOF cannot be used with replica instances. Please also note that writes to replicas are just local and are not propagated.", "WAITAOF", "0", "0", "0")
+}
+
+func TestWaitaofIgnoresReplicasWithoutAof(t *testing.T) {
+	master := startTestServer(t)
+	startReplica(t, master)
+	c := master.connect(t)
+	c.mustDo("OK", "SET", "k", "v")
+	c.mustDo("1", "WAIT", "1", "0")
+	c.mustDo("[0 0]", "WAITAOF", "0", "1", "50")
+}
@@ -0,0 +1,128 @@
+package goredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// ziplist 是 Redis 7.0 之前保存小列表、有序集合和哈希的紧凑编码，被 listpack 取代，
+// 但旧版本生成的 RDB 文件中仍然使用，加载时需要解码
+//
+// 格式为 4 字节总长度、4 字节末元素偏移、2 字节元素个数（都是小端），之后是各个元素，
+// 最后是结束标记 0xFF。每个元素由前一个元素的长度（1 字节，或 0xFE 加 4 字节）、
+// 编码（及长度）和数据组成。
+const (
+	ZIPLIST_HEADER_SIZE = 10
+	ZIPLIST_END         = 0xFF
+	ZIPLIST_BIG_PREVLEN = 0xFE
+)
+
+// ziplist 元素的编码
+const (
+	ZIP_STR_06B = 0 << 6
+	ZIP_STR_14B = 1 << 6
+	ZIP_STR_32B = 2 << 6
+	ZIP_INT_16B = 0xC0
+	ZIP_INT_32B = 0xD0
+	ZIP_INT_64B = 0xE0
+	ZIP_INT_24B = 0xF0
+	ZIP_INT_8B  = 0xFE
+
+	// 0xF1 到 0xFD 是立即数 0 到 12
+	ZIP_INT_IMM_MIN = 0xF1
+	ZIP_INT_IMM_MAX = 0xFD
+)
+
+// errZiplistCorrupt 表示 ziplist 的结构与其头部或各元素的编码不一致
+var errZiplistCorrupt = errors.New("corrupt ziplist")
+
+// ziplistDecode 校验并解码 ziplist，以字符串返回所有元素，整数元素转换为十进制文本
+func ziplistDecode(zl []byte) ([]string, error) {
+	if len(zl) < ZIPLIST_HEADER_SIZE+1 || binary.LittleEndian.Uint32(zl) != uint32(len(zl)) || zl[len(zl)-1] != ZIPLIST_END {
+		return nil, errZiplistCorrupt
+	}
+	count := int(binary.LittleEndian.Uint16(zl[8:]))
+	var entries []string
+	p := ZIPLIST_HEADER_SIZE
+	end := len(zl) - 1
+	prevLen := 0
+	for p < end {
+		start := p
+		var prev int
+		if zl[p] < ZIPLIST_BIG_PREVLEN {
+			prev = int(zl[p])
+			p++
+		} else {
+			if zl[p] != ZIPLIST_BIG_PREVLEN || end-p < 5 {
+				return nil, errZiplistCorrupt
+			}
+			prev = int(binary.LittleEndian.Uint32(zl[p+1:]))
+			p += 5
+		}
+		if prev != prevLen {
+			return nil, errZiplistCorrupt
+		}
+		value, n, ok := ziplistDecodeEntry(zl[p:end])
+		if !ok {
+			return nil, errZiplistCorrupt
+		}
+		p += n
+		prevLen = p - start
+		entries = append(entries, value)
+	}
+	// 元素个数达到 65535 时头部不再记录准确的个数
+	if count != 65535 && count != len(entries) {
+		return nil, errZiplistCorrupt
+	}
+	return entries, nil
+}
+
+// ziplistDecodeEntry 解码 buf 开头元素的编码和数据，返回元素的值和占用的字节数（不含前一个元素的长度）
+func ziplistDecodeEntry(buf []byte) (string, int, bool) {
+	if len(buf) == 0 {
+		return "", 0, false
+	}
+	b := buf[0]
+	switch {
+	case b>>6 == ZIP_STR_06B>>6:
+		return listpackString(buf, 1, int(b&0x3F))
+	case b>>6 == ZIP_STR_14B>>6:
+		if len(buf) < 2 {
+			return "", 0, false
+		}
+		return listpackString(buf, 2, int(b&0x3F)<<8|int(buf[1]))
+	case b == ZIP_STR_32B:
+		if len(buf) < 5 {
+			return "", 0, false
+		}
+		return listpackString(buf, 5, int(binary.BigEndian.Uint32(buf[1:])))
+	case b >= ZIP_INT_IMM_MIN && b <= ZIP_INT_IMM_MAX:
+		return strconv.Itoa(int(b&0x0F) - 1), 1, true
+	}
+
+	var size int
+	switch b {
+	case ZIP_INT_8B:
+		size = 1
+	case ZIP_INT_16B:
+		size = 2
+	case ZIP_INT_24B:
+		size = 3
+	case ZIP_INT_32B:
+		size = 4
+	case ZIP_INT_64B:
+		size = 8
+	default:
+		return "", 0, false
+	}
+	if len(buf) < 1+size {
+		return "", 0, false
+	}
+	var u uint64
+	for i := size; i >= 1; i-- {
+		u = u<<8 | uint64(buf[i])
+	}
+	shift := 64 - 8*size
+	return strconv.FormatInt(int64(u<<shift)>>shift, 10), 1 + size, true
+}
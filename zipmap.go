@@ -0,0 +1,68 @@
+package goredis
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// zipmap 是 Redis 2.6 之前保存小哈希的紧凑编码，只在旧版本生成的 RDB 文件中出现
+//
+// 格式为 1 字节的字段数（超过 253 时不可用），之后交替排列字段和值，最后是结束标记 0xFF。
+// 长度小于 254 时占 1 字节，否则为 0xFE 加 4 字节小端长度；值的长度之后还有 1 字节的空闲字节数，
+// 值之后跟着这么多未使用的字节。
+const (
+	ZIPMAP_BIGLEN = 0xFE
+	ZIPMAP_END    = 0xFF
+)
+
+// errZipmapCorrupt 表示 zipmap 的结构不完整或长度越界
+var errZipmapCorrupt = errors.New("corrupt zipmap")
+
+// zipmapDecode 校验并解码 zipmap，返回交替排列的字段和值
+func zipmapDecode(zm []byte) ([]string, error) {
+	if len(zm) < 2 {
+		return nil, errZipmapCorrupt
+	}
+	pos := 1
+	readLen := func() (int, bool) {
+		if pos >= len(zm) || zm[pos] == ZIPMAP_END {
+			return 0, false
+		}
+		if zm[pos] < ZIPMAP_BIGLEN {
+			pos++
+			return int(zm[pos-1]), true
+		}
+		if len(zm)-pos < 5 {
+			return 0, false
+		}
+		n := binary.LittleEndian.Uint32(zm[pos+1:])
+		pos += 5
+		return int(n), true
+	}
+
+	var elems []string
+	for pos < len(zm) && zm[pos] != ZIPMAP_END {
+		n, ok := readLen()
+		if !ok || len(zm)-pos < n {
+			return nil, errZipmapCorrupt
+		}
+		field := string(zm[pos : pos+n])
+		pos += n
+
+		n, ok = readLen()
+		if !ok || pos >= len(zm) {
+			return nil, errZipmapCorrupt
+		}
+		free := int(zm[pos])
+		pos++
+		if len(zm)-pos < n+free {
+			return nil, errZipmapCorrupt
+		}
+		elems = append(elems, field, string(zm[pos:pos+n]))
+		pos += n + free
+	}
+	if pos != len(zm)-1 {
+		return nil, errZipmapCorrupt
+	}
+	return elems, nil
+}
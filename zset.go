@@ -0,0 +1,230 @@
+package goredis
+
+import (
+	"strings"
+)
+
+// zsetEntry 表示有序集合中的一个元素
+type zsetEntry struct {
+	member string
+	score  float64
+}
+
+// ZSet 表示有序集合类型的值
+//
+// 与 Redis 一样由两部分组成：字典保存 member 到 score 的映射用于 O(1) 查分，
+// 跳表 zsl 按 (score, member) 升序排列，插入、删除、排名和范围查询都是 O(log n)。
+//
+// 字典的元素紧凑地存放在 entries 中，index 记录每个元素的下标，删除时与末尾元素交换，
+// 布局与集合的哈希表编码相同，便于 ZSCAN 在集合被修改时仍能稳定地遍历。
+type ZSet struct {
+	index   map[string]int
+	entries []zsetEntry
+	zsl     *zskiplist
+}
+
+// NewZSet 创建空有序集合
+func NewZSet() *ZSet {
+	return &ZSet{index: make(map[string]int), zsl: newZSkiplist()}
+}
+
+// Len 返回元素数量
+func (z *ZSet) Len() int {
+	return z.zsl.length
+}
+
+// Score 返回元素的分数
+func (z *ZSet) Score(member string) (float64, bool) {
+	i, ok := z.index[member]
+	if !ok {
+		return 0, false
+	}
+	return z.entries[i].score, true
+}
+
+// Add 添加元素或更新已有元素的分数，返回元素是否为新添加
+func (z *ZSet) Add(member string, score float64) bool {
+	i, exists := z.index[member]
+	if exists {
+		old := z.entries[i].score
+		if old == score {
+			return false
+		}
+		z.zsl.delete(old, member)
+		z.entries[i].score = score
+	} else {
+		z.index[member] = len(z.entries)
+		z.entries = append(z.entries, zsetEntry{member, score})
+	}
+	z.zsl.insert(score, member)
+	return !exists
+}
+
+// Remove 删除元素，返回元素是否存在
+func (z *ZSet) Remove(member string) bool {
+	score, ok := z.Score(member)
+	if !ok {
+		return false
+	}
+	z.zsl.delete(score, member)
+	z.dictDelete(member)
+	return true
+}
+
+// dictDelete 从字典中删除元素，把末尾元素交换到空出的位置
+func (z *ZSet) dictDelete(member string) {
+	i := z.index[member]
+	last := len(z.entries) - 1
+	if i != last {
+		z.entries[i] = z.entries[last]
+		z.index[z.entries[i].member] = i
+	}
+	z.entries[last] = zsetEntry{}
+	z.entries = z.entries[:last]
+	delete(z.index, member)
+}
+
+// Scan 从游标处开始返回大约 count 个元素及下一个游标，游标为 0 表示遍历结束
+//
+// 与集合的哈希表编码一样从 entries 的末尾向前遍历，遍历期间一直存在的元素至少会被返回一次。
+// 游标的值为下一个待访问的下标加一，0 表示从末尾开始。
+func (z *ZSet) Scan(cursor uint64, count int) (uint64, []zsetEntry) {
+	next := len(z.entries) - 1
+	if cursor > 0 && int(cursor-1) < next {
+		next = int(cursor - 1)
+	}
+
+	result := make([]zsetEntry, 0, count)
+	for ; next >= 0 && len(result) < count; next-- {
+		result = append(result, z.entries[next])
+	}
+	if next < 0 {
+		return 0, result
+	}
+	return uint64(next + 1), result
+}
+
+// zscoreRange 表示分数范围，minex/maxex 为 true 时对应端点不包含在内
+type zscoreRange struct {
+	min, max     float64
+	minex, maxex bool
+}
+
+// gteMin 判断分数是否满足下界
+func (r *zscoreRange) gteMin(score float64) bool {
+	if r.minex {
+		return score > r.min
+	}
+	return score >= r.min
+}
+
+// lteMax 判断分数是否满足上界
+func (r *zscoreRange) lteMax(score float64) bool {
+	if r.maxex {
+		return score < r.max
+	}
+	return score <= r.max
+}
+
+// 字典序边界类型
+const (
+	LEX_BOUND_VALUE = iota
+	LEX_BOUND_NEG_INF
+	LEX_BOUND_POS_INF
+)
+
+// zlexBound 表示字典序范围的一个端点
+type zlexBound struct {
+	kind      int
+	value     string
+	exclusive bool
+}
+
+// compare 比较 member 与端点，返回 -1/0/1
+func (b *zlexBound) compare(member string) int {
+	switch b.kind {
+	case LEX_BOUND_NEG_INF:
+		return 1
+	case LEX_BOUND_POS_INF:
+		return -1
+	}
+	return strings.Compare(member, b.value)
+}
+
+// zlexRange 表示字典序范围
+type zlexRange struct {
+	min, max zlexBound
+}
+
+// gteMin 判断元素是否满足下界
+func (r *zlexRange) gteMin(member string) bool {
+	c := r.min.compare(member)
+	if r.min.exclusive {
+		return c > 0
+	}
+	return c >= 0
+}
+
+// lteMax 判断元素是否满足上界
+func (r *zlexRange) lteMax(member string) bool {
+	c := r.max.compare(member)
+	if r.max.exclusive {
+		return c < 0
+	}
+	return c <= 0
+}
+
+// ScoreRangeRanks 返回分数范围对应的排名区间 [lo, hi]，lo > hi 表示为空
+func (z *ZSet) ScoreRangeRanks(r *zscoreRange) (int, int) {
+	lo := z.zsl.countWhile(func(x *zskiplistNode) bool { return !r.gteMin(x.score) })
+	hi := z.zsl.countWhile(func(x *zskiplistNode) bool { return r.lteMax(x.score) }) - 1
+	return lo, hi
+}
+
+// LexRangeRanks 返回字典序范围对应的排名区间 [lo, hi]，要求所有元素分数相同
+func (z *ZSet) LexRangeRanks(r *zlexRange) (int, int) {
+	lo := z.zsl.countWhile(func(x *zskiplistNode) bool { return !r.gteMin(x.member) })
+	hi := z.zsl.countWhile(func(x *zskiplistNode) bool { return r.lteMax(x.member) }) - 1
+	return lo, hi
+}
+
+// RangeByRank 返回排名在 [start, stop] 内的元素，索引需已归一化；reverse 为 true 时从高到低返回
+func (z *ZSet) RangeByRank(start, stop int, reverse bool) []zsetEntry {
+	result := make([]zsetEntry, 0, stop-start+1)
+	if reverse {
+		x := z.zsl.byRank(stop + 1)
+		for i := stop; i >= start; i-- {
+			result = append(result, zsetEntry{x.member, x.score})
+			x = x.backward
+		}
+		return result
+	}
+	x := z.zsl.byRank(start + 1)
+	for i := start; i <= stop; i++ {
+		result = append(result, zsetEntry{x.member, x.score})
+		x = x.level[0].forward
+	}
+	return result
+}
+
+// Rank 返回元素的升序排名（从 0 开始）
+func (z *ZSet) Rank(member string) (int, bool) {
+	score, ok := z.Score(member)
+	if !ok {
+		return 0, false
+	}
+	return z.zsl.rank(score, member) - 1, true
+}
+
+// DeleteRangeByRank 删除排名在 [start, stop] 内的元素，索引需已归一化，返回删除数量
+func (z *ZSet) DeleteRangeByRank(start, stop int) int {
+	return z.zsl.deleteRangeByRank(start+1, stop+1, func(x *zskiplistNode) {
+		z.dictDelete(x.member)
+	})
+}
+
+// At 返回升序排名为 rank 的元素
+func (z *ZSet) At(rank int) zsetEntry {
+	x := z.zsl.byRank(rank + 1)
+	return zsetEntry{x.member, x.score}
+}
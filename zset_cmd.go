@@ -0,0 +1,1324 @@
+package goredis
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// ZADD 选项标志
+const (
+	ZADD_NX = 1 << iota
+	ZADD_XX
+	ZADD_GT
+	ZADD_LT
+	ZADD_CH
+	ZADD_INCR
+)
+
+// zsetAdd 按 ZADD 的选项添加或更新一个元素
+//
+// 返回值 added/updated 表示元素是否被新增/修改了分数，newScore 为最终分数；
+// processed 为 false 表示由于 NX/XX/GT/LT 条件未执行任何操作。
+func zsetAdd(zset *ZSet, member string, score float64, flags int) (added, updated, processed bool, newScore float64, errResp *RESPValue) {
+	cur, exists := zset.Score(member)
+	if exists {
+		if flags&ZADD_NX != 0 {
+			return false, false, false, cur, nil
+		}
+		if flags&ZADD_INCR != 0 {
+			score += cur
+			if math.IsNaN(score) {
+				return false, false, false, 0, NewErrorValue("ERR resulting score is not a number (NaN)")
+			}
+		}
+		if (flags&ZADD_GT != 0 && score <= cur) || (flags&ZADD_LT != 0 && score >= cur) {
+			return false, false, false, cur, nil
+		}
+		if score != cur {
+			zset.Add(member, score)
+			updated = true
+		}
+		return false, updated, true, score, nil
+	}
+
+	if flags&ZADD_XX != 0 {
+		return false, false, false, 0, nil
+	}
+	zset.Add(member, score)
+	return true, false, true, score, nil
+}
+
+// handleZAdd 处理 ZADD 命令
+func (rs *RedisServer) handleZAdd(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 {
+		return wrongArgsError("zadd")
+	}
+
+	key := args[0]
+
+	// 解析选项
+	flags := 0
+	i := 1
+parseFlags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			flags |= ZADD_NX
+		case "XX":
+			flags |= ZADD_XX
+		case "GT":
+			flags |= ZADD_GT
+		case "LT":
+			flags |= ZADD_LT
+		case "CH":
+			flags |= ZADD_CH
+		case "INCR":
+			flags |= ZADD_INCR
+		default:
+			break parseFlags
+		}
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return NewErrorValue("ERR syntax error")
+	}
+	if flags&ZADD_NX != 0 && flags&ZADD_XX != 0 {
+		return NewErrorValue("ERR XX and NX options at the same time are not compatible")
+	}
+	if (flags&ZADD_GT != 0 && flags&ZADD_NX != 0) || (flags&ZADD_LT != 0 && flags&ZADD_NX != 0) ||
+		(flags&ZADD_GT != 0 && flags&ZADD_LT != 0) {
+		return NewErrorValue("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if flags&ZADD_INCR != 0 && len(pairs) > 2 {
+		return NewErrorValue("ERR INCR option supports a single increment-element pair")
+	}
+
+	// 先解析所有分数，保证出错时不修改任何数据
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		score, ok := parseFloat(pairs[j*2])
+		if !ok {
+			return NewErrorValue("ERR value is not a valid float")
+		}
+		scores[j] = score
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	zset, errResp := c.db.lookupZSetWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		if flags&ZADD_XX != 0 {
+			if flags&ZADD_INCR != 0 {
+				return NewNullBulkStringValue()
+			}
+			return NewIntegerValue(0)
+		}
+		obj := NewZSetObject()
+		c.db.store.Set(key, obj)
+		zset = obj.Value.(*ZSet)
+	}
+
+	added, changed := 0, 0
+	var lastScore float64
+	var lastProcessed bool
+	for j, score := range scores {
+		a, u, processed, newScore, errResp := zsetAdd(zset, pairs[j*2+1], score, flags)
+		if errResp != nil {
+			if zset.Len() == 0 {
+				c.db.store.Delete(key)
+			}
+			return errResp
+		}
+		if a {
+			added++
+		}
+		if u {
+			changed++
+		}
+		lastScore, lastProcessed = newScore, processed
+	}
+	if added > 0 || changed > 0 {
+		event := "zadd"
+		if flags&ZADD_INCR != 0 {
+			event = "zincr"
+		}
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_ZSET, event, key, c.db.id)
+	}
+	if zset.Len() == 0 {
+		c.db.store.Delete(key)
+	}
+	if added > 0 {
+		rs.signalKeyAsReady(c.db, key)
+	}
+
+	if flags&ZADD_INCR != 0 {
+		if !lastProcessed {
+			return NewNullBulkStringValue()
+		}
+		return NewBulkStringValue(formatFloat(lastScore))
+	}
+	if flags&ZADD_CH != 0 {
+		return NewIntegerValue(int64(added + changed))
+	}
+	return NewIntegerValue(int64(added))
+}
+
+// handleZScore 处理 ZSCORE 命令
+func (rs *RedisServer) handleZScore(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 {
+		return wrongArgsError("zscore")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return NewNullBulkStringValue()
+	}
+	score, ok := zset.Score(args[1])
+	if !ok {
+		return NewNullBulkStringValue()
+	}
+	return NewBulkStringValue(formatFloat(score))
+}
+
+// handleZMScore 处理 ZMSCORE 命令
+func (rs *RedisServer) handleZMScore(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("zmscore")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+
+	elems := make([]*RESPValue, len(args)-1)
+	for i, member := range args[1:] {
+		elems[i] = NewNullBulkStringValue()
+		if zset == nil {
+			continue
+		}
+		if score, ok := zset.Score(member); ok {
+			elems[i] = NewBulkStringValue(formatFloat(score))
+		}
+	}
+	return NewArrayValue(elems)
+}
+
+// parseScoreBound 解析分数端点，"(" 前缀表示开区间
+func parseScoreBound(arg string) (float64, bool, bool) {
+	exclusive := false
+	if strings.HasPrefix(arg, "(") {
+		exclusive = true
+		arg = arg[1:]
+	}
+	score, ok := parseFloat(arg)
+	return score, exclusive, ok
+}
+
+// parseScoreRange 解析分数范围参数
+func parseScoreRange(min, max string) (*zscoreRange, *RESPValue) {
+	r := &zscoreRange{}
+	var ok1, ok2 bool
+	r.min, r.minex, ok1 = parseScoreBound(min)
+	r.max, r.maxex, ok2 = parseScoreBound(max)
+	if !ok1 || !ok2 {
+		return nil, NewErrorValue("ERR min or max is not a float")
+	}
+	return r, nil
+}
+
+// parseLexBound 解析字典序端点："-"/"+" 表示负/正无穷，"[" 和 "(" 分别表示闭/开区间
+func parseLexBound(arg string) (zlexBound, bool) {
+	switch {
+	case arg == "-":
+		return zlexBound{kind: LEX_BOUND_NEG_INF}, true
+	case arg == "+":
+		return zlexBound{kind: LEX_BOUND_POS_INF}, true
+	case strings.HasPrefix(arg, "["):
+		return zlexBound{value: arg[1:]}, true
+	case strings.HasPrefix(arg, "("):
+		return zlexBound{value: arg[1:], exclusive: true}, true
+	}
+	return zlexBound{}, false
+}
+
+// parseLexRange 解析字典序范围参数
+func parseLexRange(min, max string) (*zlexRange, *RESPValue) {
+	minBound, ok1 := parseLexBound(min)
+	maxBound, ok2 := parseLexBound(max)
+	if !ok1 || !ok2 {
+		return nil, NewErrorValue("ERR min or max not valid string range item")
+	}
+	return &zlexRange{min: minBound, max: maxBound}, nil
+}
+
+// ZRANGE 的范围类型
+const (
+	ZRANGE_RANK = iota
+	ZRANGE_SCORE
+	ZRANGE_LEX
+)
+
+// zrangeSpec 表示一次范围查询的全部参数
+type zrangeSpec struct {
+	kind       int
+	start      int
+	stop       int
+	score      *zscoreRange
+	lex        *zlexRange
+	reverse    bool
+	offset     int
+	limit      int // 负数表示不限制
+	withScores bool
+}
+
+// parseZRangeSpec 根据范围类型解析 min/max 参数，REV 时参数顺序为 max min
+func parseZRangeSpec(spec *zrangeSpec, min, max string) *RESPValue {
+	if spec.reverse && spec.kind != ZRANGE_RANK {
+		min, max = max, min
+	}
+
+	var errResp *RESPValue
+	switch spec.kind {
+	case ZRANGE_SCORE:
+		spec.score, errResp = parseScoreRange(min, max)
+	case ZRANGE_LEX:
+		spec.lex, errResp = parseLexRange(min, max)
+	default:
+		var err1, err2 error
+		spec.start, err1 = strconv.Atoi(min)
+		spec.stop, err2 = strconv.Atoi(max)
+		if err1 != nil || err2 != nil {
+			errResp = NewErrorValue("ERR value is not an integer or out of range")
+		}
+	}
+	return errResp
+}
+
+// parseLimit 解析 LIMIT offset count 参数
+func parseLimit(offsetArg, countArg string) (int, int, *RESPValue) {
+	offset, err1 := strconv.Atoi(offsetArg)
+	count, err2 := strconv.Atoi(countArg)
+	if err1 != nil || err2 != nil {
+		return 0, 0, NewErrorValue("ERR value is not an integer or out of range")
+	}
+	return offset, count, nil
+}
+
+// zrangeRanks 将范围参数转换为升序排名区间 [lo, hi]，lo > hi 表示为空
+func zrangeRanks(zset *ZSet, spec *zrangeSpec) (int, int) {
+	switch spec.kind {
+	case ZRANGE_SCORE:
+		return zset.ScoreRangeRanks(spec.score)
+	case ZRANGE_LEX:
+		return zset.LexRangeRanks(spec.lex)
+	}
+
+	// 归一化负索引，REV 时索引按降序计算
+	length := zset.Len()
+	start, stop := spec.start, spec.stop
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return 0, -1
+	}
+	if spec.reverse {
+		start, stop = length-1-stop, length-1-start
+	}
+	return start, stop
+}
+
+// zrangeGeneric 执行范围查询，返回匹配的元素
+func zrangeGeneric(zset *ZSet, spec *zrangeSpec) []zsetEntry {
+	lo, hi := zrangeRanks(zset, spec)
+	if lo > hi {
+		return nil
+	}
+
+	// 在排名区间上应用 LIMIT
+	if spec.offset < 0 {
+		return nil
+	}
+	if spec.reverse {
+		hi -= spec.offset
+	} else {
+		lo += spec.offset
+	}
+	if spec.limit >= 0 && hi-lo+1 > spec.limit {
+		if spec.reverse {
+			lo = hi - spec.limit + 1
+		} else {
+			hi = lo + spec.limit - 1
+		}
+	}
+	if lo > hi {
+		return nil
+	}
+	return zset.RangeByRank(lo, hi, spec.reverse)
+}
+
+// zsetEntriesReply 将元素列表转换为数组响应
+func zsetEntriesReply(entries []zsetEntry, withScores bool) *RESPValue {
+	elems := make([]*RESPValue, 0, len(entries)*2)
+	for _, entry := range entries {
+		elems = append(elems, NewBulkStringValue(entry.member))
+		if withScores {
+			elems = append(elems, NewBulkStringValue(formatFloat(entry.score)))
+		}
+	}
+	return NewArrayValue(elems)
+}
+
+// parseZRangeArgs 解析 ZRANGE/ZRANGESTORE 的 min max [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func parseZRangeArgs(args []string, allowWithScores bool) (*zrangeSpec, *RESPValue) {
+	spec := &zrangeSpec{limit: -1}
+	hasLimit := false
+	var errResp *RESPValue
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "BYSCORE":
+			spec.kind = ZRANGE_SCORE
+		case "BYLEX":
+			spec.kind = ZRANGE_LEX
+		case "REV":
+			spec.reverse = true
+		case "WITHSCORES":
+			if !allowWithScores {
+				return nil, NewErrorValue("ERR syntax error")
+			}
+			spec.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, NewErrorValue("ERR syntax error")
+			}
+			spec.offset, spec.limit, errResp = parseLimit(args[i+1], args[i+2])
+			if errResp != nil {
+				return nil, errResp
+			}
+			hasLimit = true
+			i += 2
+		default:
+			return nil, NewErrorValue("ERR syntax error")
+		}
+	}
+	if hasLimit && spec.kind == ZRANGE_RANK {
+		return nil, NewErrorValue("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.kind == ZRANGE_LEX {
+		return nil, NewErrorValue("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	if errResp := parseZRangeSpec(spec, args[0], args[1]); errResp != nil {
+		return nil, errResp
+	}
+	return spec, nil
+}
+
+// handleZRange 处理 ZRANGE 命令
+func (rs *RedisServer) handleZRange(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 {
+		return wrongArgsError("zrange")
+	}
+
+	spec, errResp := parseZRangeArgs(args[1:], true)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return NewArrayValue([]*RESPValue{})
+	}
+	return zsetEntriesReply(zrangeGeneric(zset, spec), spec.withScores)
+}
+
+// handleZRangeStore 处理 ZRANGESTORE 命令
+func (rs *RedisServer) handleZRangeStore(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 4 {
+		return wrongArgsError("zrangestore")
+	}
+
+	spec, errResp := parseZRangeArgs(args[2:], false)
+	if errResp != nil {
+		return errResp
+	}
+
+	destination := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	zset, errResp := c.db.lookupZSet(args[1])
+	if errResp != nil {
+		return errResp
+	}
+
+	var entries []zsetEntry
+	if zset != nil {
+		entries = zrangeGeneric(zset, spec)
+	}
+
+	// 结果为空时删除目标键，否则无论原类型如何都整体替换
+	if len(entries) == 0 {
+		if c.db.lookupKey(destination) != nil {
+			c.db.store.Delete(destination)
+			rs.signalModifiedKey(c.db, destination)
+			rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", destination, c.db.id)
+		}
+		return NewIntegerValue(0)
+	}
+	result := NewZSet()
+	for _, entry := range entries {
+		result.Add(entry.member, entry.score)
+	}
+	c.db.store.Set(destination, &RedisObject{Type: OBJ_ZSET, Value: result})
+	rs.signalModifiedKey(c.db, destination)
+	rs.notifyKeyspaceEvent(NOTIFY_ZSET, "zrangestore", destination, c.db.id)
+	rs.signalKeyAsReady(c.db, destination)
+	return NewIntegerValue(int64(result.Len()))
+}
+
+// handleZRangeByGeneric 处理旧式的 ZRANGEBYSCORE/ZREVRANGEBYSCORE 等命令
+//
+// 这些命令等价于带 BYSCORE/BYLEX（以及 REV）的 ZRANGE，只是选项写法不同。
+func (rs *RedisServer) handleZRangeByGeneric(c *client, command *RESPValue, name string, kind int, reverse bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 {
+		return wrongArgsError(name)
+	}
+
+	spec := &zrangeSpec{kind: kind, reverse: reverse, limit: -1}
+	for i := 3; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "WITHSCORES") && kind == ZRANGE_SCORE:
+			spec.withScores = true
+		case strings.EqualFold(args[i], "LIMIT") && i+2 < len(args):
+			spec.offset, spec.limit, errResp = parseLimit(args[i+1], args[i+2])
+			if errResp != nil {
+				return errResp
+			}
+			i += 2
+		default:
+			return NewErrorValue("ERR syntax error")
+		}
+	}
+	if errResp := parseZRangeSpec(spec, args[1], args[2]); errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return NewArrayValue([]*RESPValue{})
+	}
+	return zsetEntriesReply(zrangeGeneric(zset, spec), spec.withScores)
+}
+
+// handleZLexCount 处理 ZLEXCOUNT 命令，与 ZCOUNT 一样通过排名查找计数
+func (rs *RedisServer) handleZLexCount(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 {
+		return wrongArgsError("zlexcount")
+	}
+
+	r, errResp := parseLexRange(args[1], args[2])
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return NewIntegerValue(0)
+	}
+	lo, hi := zset.LexRangeRanks(r)
+	if lo > hi {
+		return NewIntegerValue(0)
+	}
+	return NewIntegerValue(int64(hi - lo + 1))
+}
+
+// handleZIncrBy 处理 ZINCRBY 命令
+func (rs *RedisServer) handleZIncrBy(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 {
+		return wrongArgsError("zincrby")
+	}
+
+	increment, ok := parseFloat(args[1])
+	if !ok {
+		return NewErrorValue("ERR value is not a valid float")
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	zset, errResp := c.db.lookupZSetWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		obj := NewZSetObject()
+		c.db.store.Set(key, obj)
+		zset = obj.Value.(*ZSet)
+	}
+
+	_, _, _, score, errResp := zsetAdd(zset, args[2], increment, ZADD_INCR)
+	if errResp != nil {
+		if zset.Len() == 0 {
+			c.db.store.Delete(key)
+		}
+		return errResp
+	}
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_ZSET, "zincr", key, c.db.id)
+	rs.signalKeyAsReady(c.db, key)
+	return NewBulkStringValue(formatFloat(score))
+}
+
+// handleZRank 处理 ZRANK/ZREVRANK 命令
+func (rs *RedisServer) handleZRank(c *client, command *RESPValue, name string, reverse bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 2 && len(args) != 3 {
+		return wrongArgsError(name)
+	}
+
+	withScore := false
+	if len(args) == 3 {
+		if !strings.EqualFold(args[2], "WITHSCORE") {
+			return NewErrorValue("ERR syntax error")
+		}
+		withScore = true
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+
+	var rank int
+	found := false
+	if zset != nil {
+		rank, found = zset.Rank(args[1])
+	}
+	if !found {
+		if withScore {
+			return NewNullArrayValue()
+		}
+		return NewNullBulkStringValue()
+	}
+
+	if reverse {
+		rank = zset.Len() - 1 - rank
+	}
+	if !withScore {
+		return NewIntegerValue(int64(rank))
+	}
+	score, _ := zset.Score(args[1])
+	return NewArrayValue([]*RESPValue{
+		NewIntegerValue(int64(rank)),
+		NewBulkStringValue(formatFloat(score)),
+	})
+}
+
+// handleZRem 处理 ZREM 命令
+func (rs *RedisServer) handleZRem(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("zrem")
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	zset, errResp := c.db.lookupZSetWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return NewIntegerValue(0)
+	}
+
+	removed := 0
+	for _, member := range args[1:] {
+		if zset.Remove(member) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		rs.signalModifiedKey(c.db, key)
+		rs.notifyKeyspaceEvent(NOTIFY_ZSET, "zrem", key, c.db.id)
+		if zset.Len() == 0 {
+			c.db.store.Delete(key)
+			rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+		}
+	}
+	return NewIntegerValue(int64(removed))
+}
+
+// handleZRemRangeGeneric 处理 ZREMRANGEBYRANK/ZREMRANGEBYSCORE/ZREMRANGEBYLEX 命令
+func (rs *RedisServer) handleZRemRangeGeneric(c *client, command *RESPValue, name string, kind int) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 {
+		return wrongArgsError(name)
+	}
+
+	spec := &zrangeSpec{kind: kind}
+	if errResp := parseZRangeSpec(spec, args[1], args[2]); errResp != nil {
+		return errResp
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	zset, errResp := c.db.lookupZSetWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return NewIntegerValue(0)
+	}
+
+	lo, hi := zrangeRanks(zset, spec)
+	if lo > hi {
+		return NewIntegerValue(0)
+	}
+	removed := zset.DeleteRangeByRank(lo, hi)
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_ZSET, name, key, c.db.id)
+	if zset.Len() == 0 {
+		c.db.store.Delete(key)
+		rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+	}
+	return NewIntegerValue(int64(removed))
+}
+
+// handleZCard 处理 ZCARD 命令
+func (rs *RedisServer) handleZCard(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 {
+		return wrongArgsError("zcard")
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return NewIntegerValue(0)
+	}
+	return NewIntegerValue(int64(zset.Len()))
+}
+
+// handleZCount 处理 ZCOUNT 命令，通过两次排名查找计数而无需遍历范围内的元素
+func (rs *RedisServer) handleZCount(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 3 {
+		return wrongArgsError("zcount")
+	}
+
+	r, errResp := parseScoreRange(args[1], args[2])
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return NewIntegerValue(0)
+	}
+	lo, hi := zset.ScoreRangeRanks(r)
+	if lo > hi {
+		return NewIntegerValue(0)
+	}
+	return NewIntegerValue(int64(hi - lo + 1))
+}
+
+// zsetPop 从有序集合弹出最多 count 个最小（或最大）元素，集合为空时删除键（调用方需持有写锁）
+func (rs *RedisServer) zsetPop(c *client, key string, zset *ZSet, max bool, count int) []zsetEntry {
+	if count > zset.Len() {
+		count = zset.Len()
+	}
+	if count == 0 {
+		return nil
+	}
+
+	var popped []zsetEntry
+	if max {
+		popped = zset.RangeByRank(zset.Len()-count, zset.Len()-1, true)
+		zset.DeleteRangeByRank(zset.Len()-count, zset.Len()-1)
+	} else {
+		popped = zset.RangeByRank(0, count-1, false)
+		zset.DeleteRangeByRank(0, count-1)
+	}
+	event := "zpopmin"
+	if max {
+		event = "zpopmax"
+	}
+	rs.signalModifiedKey(c.db, key)
+	rs.notifyKeyspaceEvent(NOTIFY_ZSET, event, key, c.db.id)
+	if zset.Len() == 0 {
+		c.db.store.Delete(key)
+		rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", key, c.db.id)
+	}
+	return popped
+}
+
+// handleZPop 处理 ZPOPMIN/ZPOPMAX 命令
+func (rs *RedisServer) handleZPop(c *client, command *RESPValue, name string, max bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgsError(name)
+	}
+
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return NewErrorValue("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	key := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	zset, errResp := c.db.lookupZSetWrite(key)
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return NewArrayValue([]*RESPValue{})
+	}
+	return zsetEntriesReply(rs.zsetPop(c, key, zset, max, count), true)
+}
+
+// handleBZPop 处理 BZPOPMIN/BZPOPMAX 命令
+func (rs *RedisServer) handleBZPop(c *client, command *RESPValue, name string, max bool) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError(name)
+	}
+
+	timeout, errResp := parseTimeout(args[len(args)-1])
+	if errResp != nil {
+		return errResp
+	}
+
+	keys := args[:len(args)-1]
+	return rs.blockForKeys(c, keys, timeout, func() *RESPValue {
+		for _, key := range keys {
+			zset, errResp := c.db.lookupZSetWrite(key)
+			if errResp != nil {
+				return errResp
+			}
+			if zset == nil {
+				continue
+			}
+			entry := rs.zsetPop(c, key, zset, max, 1)[0]
+			// 按 ZPOPMIN/ZPOPMAX 传播实际弹出成员的键
+			c.rewriteArgv(strings.ToUpper(name[1:]), key)
+			return NewArrayValue([]*RESPValue{
+				NewBulkStringValue(key),
+				NewBulkStringValue(entry.member),
+				NewBulkStringValue(formatFloat(entry.score)),
+			})
+		}
+		return nil
+	})
+}
+
+// handleZRandMember 处理 ZRANDMEMBER 命令
+func (rs *RedisServer) handleZRandMember(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 1 || len(args) > 3 {
+		return wrongArgsError("zrandmember")
+	}
+
+	hasCount := len(args) >= 2
+	count := 0
+	withScores := false
+	if hasCount {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return NewErrorValue("ERR value is not an integer or out of range")
+		}
+		count = n
+	}
+	if len(args) == 3 {
+		if !strings.EqualFold(args[2], "WITHSCORES") {
+			return NewErrorValue("ERR syntax error")
+		}
+		withScores = true
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		if hasCount {
+			return NewArrayValue([]*RESPValue{})
+		}
+		return NewNullBulkStringValue()
+	}
+
+	length := zset.Len()
+	if !hasCount {
+		return NewBulkStringValue(zset.At(rand.Intn(length)).member)
+	}
+
+	var entries []zsetEntry
+	switch {
+	case count < 0:
+		// 负数表示允许重复，返回恰好 |count| 个元素
+		entries = make([]zsetEntry, -count)
+		for i := range entries {
+			entries[i] = zset.At(rand.Intn(length))
+		}
+	case count >= length:
+		entries = zset.RangeByRank(0, length-1, false)
+	default:
+		// Floyd 抽样：O(count) 地选出互不相同的排名
+		chosen := make(map[int]struct{}, count)
+		entries = make([]zsetEntry, 0, count)
+		for j := length - count; j < length; j++ {
+			t := rand.Intn(j + 1)
+			if _, ok := chosen[t]; ok {
+				t = j
+			}
+			chosen[t] = struct{}{}
+			entries = append(entries, zset.At(t))
+		}
+	}
+	return zsetEntriesReply(entries, withScores)
+}
+
+// handleZScan 处理 ZSCAN 命令
+func (rs *RedisServer) handleZScan(c *client, command *RESPValue) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError("zscan")
+	}
+
+	opts, errResp := parseScanArgs(args[1:], false)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	zset, errResp := c.db.lookupZSet(args[0])
+	if errResp != nil {
+		return errResp
+	}
+	if zset == nil {
+		return scanReply(0, []*RESPValue{})
+	}
+
+	cursor, entries := zset.Scan(opts.cursor, opts.count)
+	elems := make([]*RESPValue, 0, len(entries)*2)
+	for _, entry := range entries {
+		if opts.matches(entry.member) {
+			elems = append(elems, NewBulkStringValue(entry.member), NewBulkStringValue(formatFloat(entry.score)))
+		}
+	}
+	return scanReply(cursor, elems)
+}
+
+// 有序集合运算的聚合方式
+const (
+	ZAGGREGATE_SUM = iota
+	ZAGGREGATE_MIN
+	ZAGGREGATE_MAX
+)
+
+// zsetSource 表示集合运算的一个输入，可以是有序集合，也可以是普通集合（分数视为 1）
+type zsetSource struct {
+	zset   *ZSet
+	set    *Set
+	weight float64
+}
+
+// len 返回输入的元素数量
+func (src *zsetSource) len() int {
+	switch {
+	case src.zset != nil:
+		return src.zset.Len()
+	case src.set != nil:
+		return src.set.Len()
+	}
+	return 0
+}
+
+// score 返回元素的原始分数
+func (src *zsetSource) score(member string) (float64, bool) {
+	switch {
+	case src.zset != nil:
+		return src.zset.Score(member)
+	case src.set != nil:
+		return 1, src.set.Contains(member)
+	}
+	return 0, false
+}
+
+// iterate 遍历输入的所有元素及其原始分数
+func (src *zsetSource) iterate(fn func(member string, score float64)) {
+	switch {
+	case src.zset != nil:
+		for _, entry := range src.zset.RangeByRank(0, src.zset.Len()-1, false) {
+			fn(entry.member, entry.score)
+		}
+	case src.set != nil:
+		src.set.Iterate(func(member string) bool {
+			fn(member, 1)
+			return true
+		})
+	}
+}
+
+// weighted 计算加权分数，inf*0 得到的 NaN 视为 0
+func (src *zsetSource) weighted(score float64) float64 {
+	value := score * src.weight
+	if math.IsNaN(value) {
+		return 0
+	}
+	return value
+}
+
+// zsetAggregate 按聚合方式合并两个分数，inf 与 -inf 相加得到的 NaN 视为 0
+func zsetAggregate(aggregate int, a, b float64) float64 {
+	switch aggregate {
+	case ZAGGREGATE_MIN:
+		return math.Min(a, b)
+	case ZAGGREGATE_MAX:
+		return math.Max(a, b)
+	}
+	sum := a + b
+	if math.IsNaN(sum) {
+		return 0
+	}
+	return sum
+}
+
+// zsetOpSpec 表示一次有序集合运算的参数
+type zsetOpSpec struct {
+	op         int
+	keys       []string
+	weights    []float64
+	aggregate  int
+	withScores bool
+}
+
+// parseZSetOpArgs 解析 numkeys key [key ...] [WEIGHTS ...] [AGGREGATE ...] [WITHSCORES]
+func parseZSetOpArgs(name string, op int, args []string, allowWithScores bool) (*zsetOpSpec, *RESPValue) {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, NewErrorValue("ERR value is not an integer or out of range")
+	}
+	if numKeys < 1 {
+		return nil, NewErrorValue("ERR at least 1 input key is needed for '" + name + "' command")
+	}
+	if numKeys > len(args)-1 {
+		return nil, NewErrorValue("ERR syntax error")
+	}
+
+	spec := &zsetOpSpec{op: op, keys: args[1 : numKeys+1], aggregate: ZAGGREGATE_SUM}
+	for i := numKeys + 1; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch {
+		case strings.EqualFold(args[i], "WEIGHTS") && op != SET_OP_DIFF && remaining >= numKeys:
+			spec.weights = make([]float64, numKeys)
+			for j := range spec.weights {
+				w, ok := parseFloat(args[i+1+j])
+				if !ok {
+					return nil, NewErrorValue("ERR weight value is not a float")
+				}
+				spec.weights[j] = w
+			}
+			i += numKeys
+		case strings.EqualFold(args[i], "AGGREGATE") && op != SET_OP_DIFF && remaining >= 1:
+			switch strings.ToUpper(args[i+1]) {
+			case "SUM":
+				spec.aggregate = ZAGGREGATE_SUM
+			case "MIN":
+				spec.aggregate = ZAGGREGATE_MIN
+			case "MAX":
+				spec.aggregate = ZAGGREGATE_MAX
+			default:
+				return nil, NewErrorValue("ERR syntax error")
+			}
+			i++
+		case strings.EqualFold(args[i], "WITHSCORES") && allowWithScores:
+			spec.withScores = true
+		default:
+			return nil, NewErrorValue("ERR syntax error")
+		}
+	}
+	return spec, nil
+}
+
+// zsetOperation 执行有序集合的并集/交集/差集运算（调用方需持有锁）
+func (rs *RedisServer) zsetOperation(c *client, spec *zsetOpSpec) (*ZSet, *RESPValue) {
+	sources := make([]*zsetSource, len(spec.keys))
+	for i, key := range spec.keys {
+		src := &zsetSource{weight: 1}
+		if spec.weights != nil {
+			src.weight = spec.weights[i]
+		}
+		obj := c.db.lookupKey(key)
+		if obj != nil {
+			switch obj.Type {
+			case OBJ_ZSET:
+				src.zset = obj.Value.(*ZSet)
+			case OBJ_SET:
+				src.set = obj.Value.(*Set)
+			default:
+				return nil, NewErrorValue(wrongTypeErr)
+			}
+		}
+		sources[i] = src
+	}
+
+	result := NewZSet()
+	switch spec.op {
+	case SET_OP_INTER:
+		// 从最小的输入开始检查，减少查找次数
+		smallest := 0
+		for i, src := range sources {
+			if src.len() < sources[smallest].len() {
+				smallest = i
+			}
+		}
+		sources[smallest].iterate(func(member string, score float64) {
+			value := sources[smallest].weighted(score)
+			for i, src := range sources {
+				if i == smallest {
+					continue
+				}
+				other, ok := src.score(member)
+				if !ok {
+					return
+				}
+				value = zsetAggregate(spec.aggregate, value, src.weighted(other))
+			}
+			result.Add(member, value)
+		})
+
+	case SET_OP_DIFF:
+		sources[0].iterate(func(member string, score float64) {
+			for _, src := range sources[1:] {
+				if _, ok := src.score(member); ok {
+					return
+				}
+			}
+			result.Add(member, score)
+		})
+
+	default:
+		scores := make(map[string]float64)
+		for _, src := range sources {
+			src.iterate(func(member string, score float64) {
+				value := src.weighted(score)
+				if cur, ok := scores[member]; ok {
+					value = zsetAggregate(spec.aggregate, cur, value)
+				}
+				scores[member] = value
+			})
+		}
+		for member, score := range scores {
+			result.Add(member, score)
+		}
+	}
+	return result, nil
+}
+
+// handleZSetOp 处理 ZUNION/ZINTER/ZDIFF 命令
+func (rs *RedisServer) handleZSetOp(c *client, command *RESPValue, name string, op int) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 2 {
+		return wrongArgsError(name)
+	}
+
+	spec, errResp := parseZSetOpArgs(name, op, args, true)
+	if errResp != nil {
+		return errResp
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	result, errResp := rs.zsetOperation(c, spec)
+	if errResp != nil {
+		return errResp
+	}
+	if result.Len() == 0 {
+		return NewArrayValue([]*RESPValue{})
+	}
+	return zsetEntriesReply(result.RangeByRank(0, result.Len()-1, false), spec.withScores)
+}
+
+// handleZSetOpStore 处理 ZUNIONSTORE/ZINTERSTORE/ZDIFFSTORE 命令
+func (rs *RedisServer) handleZSetOpStore(c *client, command *RESPValue, name string, op int) *RESPValue {
+	args, errResp := getArgs(command)
+	if errResp != nil {
+		return errResp
+	}
+	if len(args) < 3 {
+		return wrongArgsError(name)
+	}
+
+	spec, errResp := parseZSetOpArgs(name, op, args[1:], false)
+	if errResp != nil {
+		return errResp
+	}
+
+	destination := args[0]
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	result, errResp := rs.zsetOperation(c, spec)
+	if errResp != nil {
+		return errResp
+	}
+
+	// 结果为空时删除目标键，否则无论原类型如何都整体替换
+	if result.Len() == 0 {
+		if c.db.lookupKey(destination) != nil {
+			c.db.store.Delete(destination)
+			rs.signalModifiedKey(c.db, destination)
+			rs.notifyKeyspaceEvent(NOTIFY_GENERIC, "del", destination, c.db.id)
+		}
+		return NewIntegerValue(0)
+	}
+	c.db.store.Set(destination, &RedisObject{Type: OBJ_ZSET, Value: result})
+	rs.signalModifiedKey(c.db, destination)
+	rs.notifyKeyspaceEvent(NOTIFY_ZSET, name, destination, c.db.id)
+	rs.signalKeyAsReady(c.db, destination)
+	return NewIntegerValue(int64(result.Len()))
+}
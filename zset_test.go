@@ -0,0 +1,257 @@
+package goredis
+
+import "testing"
+
+func TestZAddOptions(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("2", "ZADD", "z", "1", "a", "2", "b")
+	c.mustDo("0", "ZADD", "z", "5", "a")
+	// CH 同时统计新增和分数被修改的成员
+	c.mustDo("2", "ZADD", "z", "CH", "6", "a", "1", "c")
+
+	// INCR 返回新分数，可以借此检查当前分数
+	c.mustDo("7", "ZADD", "z", "INCR", "1", "a")
+	c.mustDo("(nil)", "ZADD", "z", "NX", "INCR", "1", "a")
+	c.mustDo("(nil)", "ZADD", "z", "XX", "INCR", "1", "missing")
+	c.mustDo("0", "ZADD", "z", "XX", "1", "missing")
+
+	// GT/LT 只在新分数更大/更小时更新
+	c.mustDo("0", "ZADD", "z", "GT", "CH", "3", "a")
+	c.mustDo("7", "ZADD", "z", "INCR", "0", "a")
+	c.mustDo("1", "ZADD", "z", "LT", "CH", "3", "a")
+	c.mustDo("3", "ZADD", "z", "INCR", "0", "a")
+	c.mustDo("(nil)", "ZADD", "z", "GT", "INCR", "-1", "a")
+
+	c.mustDo("inf", "ZADD", "z", "INCR", "inf", "b")
+	c.mustDo("(error) ERR resulting score is not a number (NaN)", "ZADD", "z", "INCR", "-inf", "b")
+	c.mustDo("(error) ERR XX and NX options at the same time are not compatible", "ZADD", "z", "NX", "XX", "1", "a")
+	c.mustDo("(error) ERR GT, LT, and/or NX options at the same time are not compatible", "ZADD", "z", "GT", "LT", "1", "a")
+	c.mustDo("(error) ERR INCR option supports a single increment-element pair", "ZADD", "z", "INCR", "1", "a", "2", "b")
+	c.mustDo("(error) ERR value is not a valid float", "ZADD", "z", "x", "a")
+	c.mustDo("(error) ERR syntax error", "ZADD", "z", "1", "a", "2")
+	c.mustDo("1", "RPUSH", "l", "x")
+	c.mustDo("(error) WRONGTYPE Operation against a key holding the wrong kind of value", "ZADD", "l", "1", "a")
+}
+
+func TestZScoreAndZMScore(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(nil)", "ZSCORE", "z", "a")
+	c.mustDo("[(nil) (nil)]", "ZMSCORE", "z", "a", "b")
+	c.mustDo("2", "ZADD", "z", "1.5", "a", "-inf", "b")
+	c.mustDo("1.5", "ZSCORE", "z", "a")
+	c.mustDo("(nil)", "ZSCORE", "z", "x")
+	c.mustDo("[1.5 (nil) -inf]", "ZMSCORE", "z", "a", "x", "b")
+}
+
+func TestZRange(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[]", "ZRANGE", "z", "0", "-1")
+	c.mustDo("5", "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+	c.mustDo("[a b c d e]", "ZRANGE", "z", "0", "-1")
+	c.mustDo("[b 2 c 3]", "ZRANGE", "z", "1", "2", "WITHSCORES")
+	c.mustDo("[e d]", "ZRANGE", "z", "0", "1", "REV")
+	c.mustDo("[]", "ZRANGE", "z", "3", "1")
+	c.mustDo("[d e]", "ZRANGE", "z", "-2", "100")
+
+	// BYSCORE：( 表示开区间，REV 时先写 max 再写 min
+	c.mustDo("[b c d]", "ZRANGE", "z", "2", "4", "BYSCORE")
+	c.mustDo("[c d]", "ZRANGE", "z", "(2", "4", "BYSCORE")
+	c.mustDo("[a b c d e]", "ZRANGE", "z", "-inf", "+inf", "BYSCORE")
+	c.mustDo("[d c]", "ZRANGE", "z", "4", "(2", "BYSCORE", "REV")
+	c.mustDo("[c d]", "ZRANGE", "z", "-inf", "+inf", "BYSCORE", "LIMIT", "2", "2")
+	c.mustDo("[c d e]", "ZRANGE", "z", "-inf", "+inf", "BYSCORE", "LIMIT", "2", "-1")
+
+	// BYLEX 要求分数相同
+	c.mustDo("4", "ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d")
+	c.mustDo("[b c]", "ZRANGE", "lex", "[b", "(d", "BYLEX")
+	c.mustDo("[a b c d]", "ZRANGE", "lex", "-", "+", "BYLEX")
+	c.mustDo("[d c]", "ZRANGE", "lex", "+", "(b", "BYLEX", "REV")
+	c.mustDo("[b]", "ZRANGE", "lex", "-", "+", "BYLEX", "LIMIT", "1", "1")
+
+	c.mustDo("(error) ERR min or max is not a float", "ZRANGE", "z", "x", "1", "BYSCORE")
+	c.mustDo("(error) ERR min or max not valid string range item", "ZRANGE", "lex", "b", "d", "BYLEX")
+	c.mustDo("(error) ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX", "ZRANGE", "z", "0", "1", "LIMIT", "0", "1")
+	c.mustDo("(error) ERR syntax error, WITHSCORES not supported in combination with BYLEX", "ZRANGE", "lex", "-", "+", "BYLEX", "WITHSCORES")
+}
+
+func TestZRangeByScore(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("4", "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+	c.mustDo("[b c]", "ZRANGEBYSCORE", "z", "(1", "3")
+	c.mustDo("[a 1 b 2]", "ZRANGEBYSCORE", "z", "-inf", "2", "WITHSCORES")
+	c.mustDo("[b c]", "ZRANGEBYSCORE", "z", "-inf", "+inf", "LIMIT", "1", "2")
+	c.mustDo("[d c b]", "ZREVRANGEBYSCORE", "z", "+inf", "(1")
+	c.mustDo("[c 3]", "ZREVRANGEBYSCORE", "z", "4", "1", "WITHSCORES", "LIMIT", "1", "1")
+	c.mustDo("(error) ERR syntax error", "ZRANGEBYSCORE", "z", "1", "2", "LIMIT", "1")
+}
+
+func TestZRangeByLex(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("5", "ZADD", "z", "0", "a", "0", "b", "0", "c", "0", "d", "0", "e")
+	c.mustDo("[b c d]", "ZRANGEBYLEX", "z", "[b", "[d")
+	c.mustDo("[c d]", "ZRANGEBYLEX", "z", "(b", "[d", "LIMIT", "0", "2")
+	c.mustDo("[e d c]", "ZREVRANGEBYLEX", "z", "+", "[c")
+	c.mustDo("5", "ZLEXCOUNT", "z", "-", "+")
+	c.mustDo("2", "ZLEXCOUNT", "z", "(a", "(d")
+	c.mustDo("0", "ZLEXCOUNT", "missing", "-", "+")
+	c.mustDo("(error) ERR min or max not valid string range item", "ZLEXCOUNT", "z", "a", "+")
+}
+
+func TestZIncrBy(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("2.5", "ZINCRBY", "z", "2.5", "a")
+	c.mustDo("1", "ZINCRBY", "z", "-1.5", "a")
+	c.mustDo("[a 1]", "ZRANGE", "z", "0", "-1", "WITHSCORES")
+	c.mustDo("inf", "ZINCRBY", "z", "inf", "a")
+	c.mustDo("(error) ERR resulting score is not a number (NaN)", "ZINCRBY", "z", "-inf", "a")
+	c.mustDo("(error) ERR value is not a valid float", "ZINCRBY", "z", "x", "a")
+}
+
+func TestZRank(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("3", "ZADD", "z", "10", "a", "20", "b", "30", "c")
+	c.mustDo("0", "ZRANK", "z", "a")
+	c.mustDo("2", "ZRANK", "z", "c")
+	c.mustDo("0", "ZREVRANK", "z", "c")
+	c.mustDo("[1 20]", "ZRANK", "z", "b", "WITHSCORE")
+	c.mustDo("[2 10]", "ZREVRANK", "z", "a", "WITHSCORE")
+	c.mustDo("(nil)", "ZRANK", "z", "x")
+	c.mustDo("(nil)", "ZRANK", "missing", "x", "WITHSCORE")
+	c.mustDo("(error) ERR syntax error", "ZRANK", "z", "a", "FOO")
+}
+
+func TestZRemAndRemRange(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("5", "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+	c.mustDo("2", "ZREM", "z", "a", "e", "x")
+	c.mustDo("[b c d]", "ZRANGE", "z", "0", "-1")
+	c.mustDo("1", "ZREMRANGEBYRANK", "z", "-1", "-1")
+	c.mustDo("1", "ZREMRANGEBYSCORE", "z", "(1", "2")
+	c.mustDo("[c]", "ZRANGE", "z", "0", "-1")
+	// 删除最后一个元素后键被删除
+	c.mustDo("1", "ZREMRANGEBYRANK", "z", "0", "-1")
+	c.mustDo("[]", "ZRANGE", "z", "0", "-1")
+	c.mustDo("1", "RPUSH", "z", "x")
+
+	c.mustDo("4", "ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d")
+	c.mustDo("2", "ZREMRANGEBYLEX", "lex", "[b", "(d")
+	c.mustDo("[a d]", "ZRANGE", "lex", "0", "-1")
+	c.mustDo("0", "ZREMRANGEBYRANK", "missing", "0", "-1")
+	c.mustDo("(error) ERR min or max is not a float", "ZREMRANGEBYSCORE", "lex", "a", "b")
+}
+
+func TestZCardAndZCount(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("0", "ZCARD", "z")
+	c.mustDo("4", "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+	c.mustDo("4", "ZCARD", "z")
+	c.mustDo("2", "ZCOUNT", "z", "(1", "3")
+	c.mustDo("4", "ZCOUNT", "z", "-inf", "+inf")
+	c.mustDo("0", "ZCOUNT", "z", "5", "10")
+	c.mustDo("0", "ZCOUNT", "missing", "-inf", "+inf")
+}
+
+func TestZPop(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("[]", "ZPOPMIN", "z")
+	c.mustDo("4", "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+	c.mustDo("[a 1]", "ZPOPMIN", "z")
+	c.mustDo("[d 4 c 3]", "ZPOPMAX", "z", "2")
+	c.mustDo("[b 2]", "ZPOPMIN", "z", "10")
+	c.mustDo("0", "ZCARD", "z")
+	c.mustDo("(error) ERR value is out of range, must be positive", "ZPOPMIN", "z", "-1")
+}
+
+func TestBZPopWakesUpOnZAdd(t *testing.T) {
+	ts := startTestServer(t)
+	c, writer := ts.connect(t), ts.connect(t)
+
+	// 已有元素时立即返回
+	writer.mustDo("2", "ZADD", "z1", "1", "a", "2", "b")
+	c.mustDo("[z1 b 2]", "BZPOPMAX", "missing", "z1", "0")
+
+	c.send("BZPOPMIN", "z2", "z3", "0")
+	waitFor(t, "client to block", func() bool { return ts.blockedOn("z3") == 1 })
+	writer.mustDo("2", "ZADD", "z3", "5", "x", "3", "y")
+	if got := replyString(c.read()); got != "[z3 y 3]" {
+		t.Fatalf("BZPOPMIN got %s", got)
+	}
+	writer.mustDo("[x]", "ZRANGE", "z3", "0", "-1")
+	c.mustDo("(nil)", "BZPOPMIN", "z2", "0.05")
+}
+
+func TestZRandMember(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("(nil)", "ZRANDMEMBER", "z")
+	c.mustDo("[]", "ZRANDMEMBER", "z", "2")
+	c.mustDo("3", "ZADD", "z", "1", "a", "2", "b", "3", "c")
+
+	if v := c.do("ZRANDMEMBER", "z", "2"); len(v.Array) != 2 || len(distinct(v)) != 2 {
+		t.Fatalf("ZRANDMEMBER z 2: got %s", replyString(v))
+	}
+	if v := c.do("ZRANDMEMBER", "z", "-10"); len(v.Array) != 10 {
+		t.Fatalf("ZRANDMEMBER z -10: got %s", replyString(v))
+	}
+	// WITHSCORES 时成员与分数成对出现
+	v := c.do("ZRANDMEMBER", "z", "5", "WITHSCORES")
+	if len(v.Array) != 6 {
+		t.Fatalf("ZRANDMEMBER z 5 WITHSCORES: got %s", replyString(v))
+	}
+	for i := 0; i < len(v.Array); i += 2 {
+		c.mustDo(v.Array[i+1].Str, "ZSCORE", "z", v.Array[i].Str)
+	}
+	c.mustDo("(error) ERR syntax error", "ZRANDMEMBER", "z", "1", "FOO")
+}
+
+func TestZSetOperations(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("3", "ZADD", "z1", "1", "a", "2", "b", "3", "c")
+	c.mustDo("2", "ZADD", "z2", "10", "b", "20", "d")
+	c.mustDo("[a 1 c 3 b 12 d 20]", "ZUNION", "2", "z1", "z2", "WITHSCORES")
+	c.mustDo("[b 2]", "ZINTER", "2", "z1", "z2", "AGGREGATE", "MIN", "WITHSCORES")
+	c.mustDo("[b 14]", "ZINTER", "2", "z1", "z2", "WEIGHTS", "2", "1", "WITHSCORES")
+	c.mustDo("[a c]", "ZDIFF", "2", "z1", "z2")
+
+	// 普通集合的元素分数视为 1
+	c.mustDo("2", "SADD", "s", "a", "d")
+	c.mustDo("[a 2]", "ZINTER", "2", "s", "z1", "WITHSCORES")
+	c.mustDo("[d 21]", "ZINTER", "2", "s", "z2", "WITHSCORES")
+
+	c.mustDo("4", "ZUNIONSTORE", "dst", "2", "z1", "z2", "AGGREGATE", "MAX")
+	c.mustDo("[a 1 c 3 b 10 d 20]", "ZRANGE", "dst", "0", "-1", "WITHSCORES")
+	c.mustDo("1", "ZINTERSTORE", "dst", "2", "z1", "z2")
+	c.mustDo("[b 12]", "ZRANGE", "dst", "0", "-1", "WITHSCORES")
+	c.mustDo("0", "ZDIFFSTORE", "dst", "2", "z1", "z1")
+	c.mustDo("0", "ZCARD", "dst")
+
+	c.mustDo("(error) ERR at least 1 input key is needed for 'zunion' command", "ZUNION", "0", "z1")
+	c.mustDo("(error) ERR weight value is not a float", "ZUNION", "1", "z1", "WEIGHTS", "x")
+	c.mustDo("(error) ERR syntax error", "ZUNION", "2", "z1", "z2", "WEIGHTS", "1")
+	c.mustDo("(error) ERR syntax error", "ZUNIONSTORE", "dst", "1", "z1", "WITHSCORES")
+}
+
+func TestZRangeStore(t *testing.T) {
+	ts := startTestServer(t)
+	c := ts.connect(t)
+	c.mustDo("4", "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+	c.mustDo("2", "ZRANGESTORE", "dst", "z", "1", "2")
+	c.mustDo("[b 2 c 3]", "ZRANGE", "dst", "0", "-1", "WITHSCORES")
+	c.mustDo("2", "ZRANGESTORE", "dst", "z", "+inf", "(2", "BYSCORE", "REV")
+	c.mustDo("[c d]", "ZRANGE", "dst", "0", "-1")
+	// 结果为空时删除目标键
+	c.mustDo("0", "ZRANGESTORE", "dst", "z", "10", "20", "BYSCORE")
+	c.mustDo("0", "ZCARD", "dst")
+	c.mustDo("(error) ERR syntax error", "ZRANGESTORE", "dst", "z", "0", "-1", "WITHSCORES")
+}